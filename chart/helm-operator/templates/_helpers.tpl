@@ -31,6 +31,15 @@ Create chart name and version as used by the chart label.
 {{- printf "%s-%s" .Chart.Name .Chart.Version | replace "+" "_" | trunc 63 | trimSuffix "-" -}}
 {{- end -}}
 
+{{/*
+Serve /metrics and the API over TLS, for the metrics or the admission webhook.
+*/}}
+{{- define "helm-operator.tlsEnabled" -}}
+{{- if or .Values.prometheus.tls.enable .Values.admissionWebhook.enabled -}}
+true
+{{- end -}}
+{{- end -}}
+
 {{/*
 Create the name of the service account to use.
 */}}
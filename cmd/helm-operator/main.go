@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	golog "log"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
@@ -12,23 +14,45 @@ import (
 
 	"github.com/go-kit/kit/log"
 	"github.com/spf13/pflag"
+	"golang.org/x/time/rate"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog"
 
+	"github.com/lstack-org/helm-operator/pkg/alerting"
+	helmfluxv1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/approval"
 	"github.com/lstack-org/helm-operator/pkg/chartsync"
 	clientset "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned"
-	ifinformers "github.com/lstack-org/helm-operator/pkg/client/informers/externalversions"
+	"github.com/lstack-org/helm-operator/pkg/conversion"
+	"github.com/lstack-org/helm-operator/pkg/freeze"
+	"github.com/lstack-org/helm-operator/pkg/halt"
 	"github.com/lstack-org/helm-operator/pkg/helm"
 	helmv3 "github.com/lstack-org/helm-operator/pkg/helm/v3"
 	v3 "github.com/lstack-org/helm-operator/pkg/helm/v3"
 	daemonhttp "github.com/lstack-org/helm-operator/pkg/http/daemon"
+	"github.com/lstack-org/helm-operator/pkg/imageautomation"
+	"github.com/lstack-org/helm-operator/pkg/logging"
+	"github.com/lstack-org/helm-operator/pkg/messages"
+	"github.com/lstack-org/helm-operator/pkg/metrics"
+	"github.com/lstack-org/helm-operator/pkg/notify"
+	"github.com/lstack-org/helm-operator/pkg/opa"
 	"github.com/lstack-org/helm-operator/pkg/operator"
+	"github.com/lstack-org/helm-operator/pkg/receiver"
 	"github.com/lstack-org/helm-operator/pkg/release"
+	"github.com/lstack-org/helm-operator/pkg/releasehook"
+	"github.com/lstack-org/helm-operator/pkg/resolver"
 	"github.com/lstack-org/helm-operator/pkg/status"
 	"github.com/lstack-org/helm-operator/pkg/utils"
+	"github.com/lstack-org/helm-operator/pkg/vault"
 )
 
 var (
@@ -37,14 +61,33 @@ var (
 
 	versionFlag *bool
 
-	logFormat *string
+	logFormat   *string
+	logLevel    *string
+	logLanguage *string
 
 	kubeconfig *string
 	master     *string
 	namespace  *string
 
+	watchNamespaces    *[]string
+	watchLabelSelector *string
+
+	targetClientTTL     *time.Duration
+	allowRemoteTargets  *bool
+	remoteTargetServers *[]string
+
 	workers *int
 
+	shardSelector *string
+	shardIndex    *int
+	shardTotal    *int
+
+	workqueueBaseDelay *time.Duration
+	workqueueMaxDelay  *time.Duration
+	workqueueQPS       *float64
+	workqueueBurst     *int
+	workqueueRetries   *int64
+
 	tillerIP        *string
 	tillerPort      *string
 	tillerNamespace *string
@@ -58,21 +101,114 @@ var (
 
 	convertTillerOutCluster *bool
 	convertReleaseStorage   *string
+	convertTimeout          *time.Duration
+	convertAttempts         *int
 
 	chartsSyncInterval   *time.Duration
+	resyncInterval       *time.Duration
 	statusUpdateInterval *time.Duration
+	imageUpdateInterval  *time.Duration
 	logReleaseDiffs      *bool
+	liveDiff             *bool
+	serverSideApply      *bool
+	fieldManager         *string
+	releaseDiffEvents    *bool
 	updateDependencies   *bool
+	capacityCheck        *string
+	platformCheck        *string
+	backupLabels         *map[string]string
+	chartDefaultsDrift   *bool
+	freezeWindows        *string
+	freezeCalendarURL    *string
+	freezeCalendarPeriod *time.Duration
+	approvalURL          *string
+	approvalTimeout      *time.Duration
+	approvalPolicy       *string
+	approvalNamespaces   *[]string
+	vaultAddress         *string
+	vaultAuthMount       *string
+	vaultRole            *string
+	vaultServiceAccounts *[]string
+	vaultCAFile          *string
+	vaultCacheTTL        *time.Duration
+	policyOPAURL         *string
+	policyOPATimeout     *time.Duration
+	policyOPADecisions   *[]string
+	haltConfigMap        *string
+	postRenderFailure    *string
+	allowCrossNsValues   *bool
+	namespaceDefaults    *bool
+	inlineValuesWarnSize *int
+	rejectLargeValues    *bool
+	externalizeValues    *bool
+	workspaceQuota       *int64
+	chartCacheMaxSize    *int64
+	chartCacheMaxAge     *time.Duration
+	chartCacheGCInterval *time.Duration
+
+	releaseStorageGCInterval *time.Duration
+	chartKeyring             *string
+	chartCosignKey           *string
+	ossDecryptionKey         *string
+	migrateOssCredentials    *bool
+	ossAmbientCredentials    *bool
+	ossAmbientNamespaces     *[]string
+	ossAmbientRoles          *[]string
+	gitProviderCredentials   *bool
+	gitProviderNamespaces    *[]string
+	codeupHosts              *[]string
+	codehubHosts             *[]string
+
+	releaseHookURLs     *[]string
+	releaseHookSpoolDir *string
+	releaseHookTimeout  *time.Duration
+
+	notifySinks     *[]string
+	notifyConfigMap *string
+	notifyEvents    *[]string
+	notifyTimeout   *time.Duration
 
 	gitTimeout      *time.Duration
 	gitPollInterval *time.Duration
 	gitDefaultRef   *string
 
-	listenAddr *string
+	listenAddr             *string
+	listenTLSCert          *string
+	listenTLSKey           *string
+	listenTLSAutoGenerate  *bool
+	metricsClientCA        *string
+	metricsBearerTokenFile *string
+	receiverSecretPath     *string
+	profiling              *bool
+	admissionWebhook       *bool
+	conversionWebhook      *bool
+	migrateLegacy          *bool
+	operationsAPI          *bool
+	introspectionAPI       *bool
+
+	metricsReleaseLabels      *string
+	metricsReleaseHashBuckets *int
+	metricsReleaseAllowlist   *[]string
+
+	enableLeaderElection        *bool
+	leaderElectionNamespace     *string
+	leaderElectionName          *string
+	leaderElectionLeaseDuration *time.Duration
+	leaderElectionRenewDeadline *time.Duration
+	leaderElectionRetryPeriod   *time.Duration
+
+	prometheusRules            *bool
+	prometheusRulesNotReadyFor *time.Duration
+	prometheusRulesLabels      *map[string]string
 
 	versionedHelmRepositoryIndexes *[]string
+	repositoryIndexTTL             *time.Duration
+	repositoryIndexCacheSize       *int
+	hostAliases                    *[]string
+	nameservers                    *[]string
 
 	enabledHelmVersions *[]string
+	helmStorageDriver   *string
 	defaultHelmVersion  *string
 )
 
@@ -95,15 +231,58 @@ func init() {
 
 	versionFlag = fs.Bool("version", false, "print version and exit")
 
-	logFormat = fs.String("log-format", "fmt", "change the log format.")
+	logFormat = fs.String("log-format", "fmt", "format of the logs; one of 'fmt' (logfmt) or 'json', unknown formats fall back to 'fmt'")
+	logLevel = fs.String("log-level", "info", "minimum level of the logged records, one of 'debug', 'info', 'warning' or 'error', optionally followed by the levels of components in the form <component>=<level>, e.g. warning,release=debug")
+	logLanguage = fs.String("log-language", messages.English, "language of the catalogued log messages; error messages are always in English")
 
 	kubeconfig = fs.String("kubeconfig", "", "path to a kubeconfig; required if out-of-cluster")
 	master = fs.String("master", "", "address of the Kubernetes API server; overrides any value in kubeconfig; required if out-of-cluster")
 	namespace = fs.String("allow-namespace", "", "if set, this limits the scope to a single namespace; if not specified, all namespaces will be watched")
+	watchNamespaces = fs.StringSlice("watch-namespaces", nil, "comma separated namespaces of the HelmReleases watched by this instance, e.g. to dedicate instances to tenants; all namespaces are watched if not set; mutually exclusive with --allow-namespace")
+	watchLabelSelector = fs.String("watch-label-selector", "", "label selector of the HelmReleases watched by this instance, e.g. tenant=a; unlike --shard-selector, the HelmReleases are filtered by the API server; the releases of HelmReleases relabeled out of the selector are kept")
+	targetClientTTL = fs.Duration("target-client-ttl", 10*time.Minute, "duration the Helm clients for the remote clusters of HelmReleases with a kubeConfig are cached")
+	allowRemoteTargets = fs.Bool("allow-remote-targets", false, "allow HelmReleases with a kubeConfig to release to remote clusters, with the credentials of their kubeconfig Secret")
+	remoteTargetServers = fs.StringSlice("remote-target-servers", nil, "host patterns the HTTPS servers of the remote clusters of HelmReleases must match, e.g. *.clusters.example.com; any host is allowed if not set; may be repeated")
 
 	workers = fs.Int("workers", 2, "amount of workers processing releases")
 
+	shardSelector = fs.String("shard-selector", "", "label selector of the HelmReleases processed by this instance, i.e. shard=a")
+	shardIndex = fs.Int("shard-index", 0, "index of the shard of HelmReleases processed by this instance, based on a hash of their namespace and name; requires shard-total")
+	shardTotal = fs.Int("shard-total", 0, "total amount of shards the HelmReleases are split into; disabled if 0 or 1")
+
+	workqueueBaseDelay = fs.Duration("workqueue-base-delay", 5*time.Millisecond, "initial delay before a failed release is requeued; doubles with every consecutive failure")
+	workqueueMaxDelay = fs.Duration("workqueue-max-delay", 1000*time.Second, "maximum delay before a failed release is requeued")
+	workqueueQPS = fs.Float64("workqueue-qps", 10, "overall rate at which releases are requeued, in items per second")
+	workqueueBurst = fs.Int("workqueue-burst", 100, "overall burst of releases which may be requeued at once")
+	workqueueRetries = fs.Int64("workqueue-max-retries", 20, "default amount of retries of consecutive failed syncs of a HelmRelease, overridden by spec.retry.maxRetries; negative values retry forever")
+
 	listenAddr = fs.StringP("listen", "l", ":3030", "Listen address where /metrics and API will be served")
+	listenTLSCert = fs.String("listen-tls-cert-path", "", "path to the certificate file used to serve /metrics and API over TLS; requires listen-tls-key-path")
+	listenTLSKey = fs.String("listen-tls-key-path", "", "path to the private key file used to serve /metrics and API over TLS")
+	listenTLSAutoGenerate = fs.Bool("listen-tls-auto-generate", false, "serve /metrics and API over TLS with a self-signed certificate generated at startup, if no certificate is provided")
+	profiling = fs.Bool("profiling", false, "serve the pprof endpoints at /debug/pprof/, requiring the same authentication as /metrics")
+	admissionWebhook = fs.Bool("admission-webhook", false, "serve the validating admission webhook of HelmReleases at /admission/helmreleases, rejecting invalid specs on create and update; requires TLS")
+	conversionWebhook = fs.Bool("conversion-webhook", false, "serve the conversion webhook of the HelmRelease CRD at /conversion/helmreleases, converting HelmReleases of the legacy helm.fluxcd.io/v1beta1 schema to v1; requires TLS")
+	migrateLegacy = fs.Bool("migrate-legacy-helmreleases", false, "on startup of the leader, create a helm.fluxcd.io/v1 HelmRelease for every flux.weave.works/v1beta1 HelmRelease in scope which has not been migrated yet; the legacy HelmReleases are kept and annotated as migrated")
+	operationsAPI = fs.Bool("operations-api", false, "serve the endpoints requesting a sync, rollback or test of HelmReleases at /api/v1/helmreleases/<namespace>/<name>/{sync,rollback,test}; clients must present a Kubernetes bearer token of a user allowed to patch the HelmRelease")
+	introspectionAPI = fs.Bool("introspection-api", false, "serve the endpoints reporting the release state, manifest, history, values provenance and projected diffs of HelmReleases at /api/v1/helmreleases/<namespace>/<name>[/...]; clients must present a Kubernetes bearer token of a user allowed to get the HelmRelease")
+	metricsClientCA = fs.String("metrics-client-ca-path", "", "path to a CA certificate file; clients presenting a certificate signed by it are allowed to access /metrics; requires TLS")
+	metricsBearerTokenFile = fs.String("metrics-bearer-token-path", "", "path to a file holding the bearer token clients must present to access /metrics")
+	metricsReleaseLabels = fs.String("metrics-release-labels", string(metrics.ReleaseLabelFull), "how the release_name label of metrics is set; one of 'full' (the release name), 'namespace' (empty, aggregating per target namespace) or 'hashed' (a bucket of a hash of the release name); the release image gauge is only recorded with 'full' or for allowlisted releases, the release condition gauge the alerting rules depend on is always recorded")
+	metricsReleaseHashBuckets = fs.Int("metrics-release-hash-buckets", metrics.DefaultHashBuckets, "amount of buckets release names are hashed into with --metrics-release-labels=hashed")
+	metricsReleaseAllowlist = fs.StringSlice("metrics-release-allowlist", nil, "releases which keep the release_name label of metrics regardless of --metrics-release-labels, as <target namespace>/<release name> patterns, e.g. prod/*; may be repeated")
+	receiverSecretPath = fs.String("receiver-secret-path", "", "path to a file holding the secret GitHub, GitLab and Harbor webhooks to /api/v1/receivers/{provider} are verified with; the webhook receiver is disabled if not set")
+
+	enableLeaderElection = fs.Bool("enable-leader-election", false, "elect a leader between the operator replicas using a Lease, only the leader processes releases")
+	leaderElectionNamespace = fs.String("leader-election-namespace", "", "namespace of the leader election Lease; defaults to the namespace the operator runs in")
+	leaderElectionName = fs.String("leader-election-name", "helm-operator", "name of the leader election Lease")
+	leaderElectionLeaseDuration = fs.Duration("leader-election-lease-duration", 15*time.Second, "duration non-leader replicas wait before attempting to acquire leadership of an unrenewed Lease")
+	leaderElectionRenewDeadline = fs.Duration("leader-election-renew-deadline", 10*time.Second, "duration the leader retries renewing the Lease before giving up leadership")
+	leaderElectionRetryPeriod = fs.Duration("leader-election-retry-period", 2*time.Second, "duration between attempts to acquire or renew the Lease")
+
+	prometheusRules = fs.Bool("prometheus-rules", false, "maintain a PrometheusRule with standard alerts for every HelmRelease; requires the Prometheus Operator CRDs")
+	prometheusRulesNotReadyFor = fs.Duration("prometheus-rules-not-ready-for", 15*time.Minute, "duration a HelmRelease may not be released before the generated alert fires")
+	prometheusRulesLabels = fs.StringToString("prometheus-rules-labels", nil, "additional labels to set on the generated alerts, i.e. team=platform,severity=critical")
 
 	tillerIP = fs.String("tiller-ip", "", "Tiller IP address; required if run out-of-cluster")
 	tillerPort = fs.String("tiller-port", "", "Tiller port; required if run out-of-cluster")
@@ -118,22 +297,94 @@ func init() {
 
 	convertTillerOutCluster = fs.Bool("convert-tiller-out-cluster", false, "when Tiller is not running in the cluster e.g. Tillerless")
 	convertReleaseStorage = fs.String("convert-release-storage", "secrets", "v2 release storage type/object. It can be 'secrets' or 'configmaps'. This is only used with the 'tiller-out-cluster' flag (default 'secrets')")
+	convertTimeout = fs.Duration("convert-timeout", 5*time.Minute, "duration after which a 2to3 conversion of a release is killed; 0 disables the timeout")
+	convertAttempts = fs.Int("convert-attempts", 2, "number of times a 2to3 conversion is attempted when it is killed after the timeout")
 
 	chartsSyncInterval = fs.Duration("charts-sync-interval", 3*time.Minute, "period on which to reconcile the Helm releases with HelmRelease resources")
+	resyncInterval = fs.Duration("default-resync-interval", 0, "default interval on which every HelmRelease is requeued to detect and revert drift, overridden by spec.resyncInterval; disabled if 0")
 	statusUpdateInterval = fs.Duration("status-update-interval", 10*time.Second, "period on which to update the Helm release status in HelmRelease resources")
+	imageUpdateInterval = fs.Duration("image-update-interval", 0, "period on which to scan registries for the image update policies of HelmRelease resources; 0 disables image updates")
 	logReleaseDiffs = fs.Bool("log-release-diffs", false, "log the diff when a chart release diverges; potentially insecure")
+	liveDiff = fs.Bool("live-diff", false, "compare releases without changes against the live objects on the cluster, and upgrade if they have drifted")
+	serverSideApply = fs.Bool("server-side-apply", false, "create and update the resources of releases with server-side apply, overridden by spec.serverSideApply")
+	fieldManager = fs.String("field-manager", "helm-operator", "field manager the resources of releases applied server-side, and the annotations set by the operator, are owned by")
+	releaseDiffEvents = fs.Bool("release-diff-events", false, "emit an Event with a summary of the diff when a chart release diverges, requires --log-release-diffs; potentially insecure")
 	updateDependencies = fs.Bool("update-chart-deps", true, "update chart dependencies before installing/upgrading a release")
+	allowCrossNsValues = fs.Bool("allow-cross-namespace-values", false, "allow valuesFrom to reference ConfigMaps and Secrets outside the namespace of the HelmRelease")
+	namespaceDefaults = fs.Bool("namespace-default-values", false, "merge the values.yaml of ConfigMaps labeled helm.fluxcd.io/default-values=true under the values of every HelmRelease in their namespace")
+	inlineValuesWarnSize = fs.Int("inline-values-warn-size", 256*1024, "size in bytes of the inline values of a HelmRelease above which a warning is logged; disabled if 0")
+	rejectLargeValues = fs.Bool("reject-large-inline-values", false, "refuse to release HelmReleases with inline values exceeding inline-values-warn-size, instead of logging a warning")
+	externalizeValues = fs.Bool("externalize-inline-values", false, "copy inline values exceeding inline-values-warn-size to an operator managed Secret, referenced with their checksum from the status of the HelmRelease")
+	chartKeyring = fs.String("chart-verification-keyring", "", "path to the public keyring to verify the provenance of charts against, for HelmReleases with verification enabled that do not reference a keyring Secret")
+	chartCosignKey = fs.String("chart-verification-cosign-key", "", "path to the PEM encoded cosign public key to verify the signatures of OCI charts against, for HelmReleases with verification enabled that do not reference a cosign key Secret")
+	ossDecryptionKey = fs.String("oss-decryption-key-file", "", "path to the file holding the AES key to decrypt the object storage credentials of HelmReleases with, for HelmReleases that do not reference a decryption key Secret")
+	migrateOssCredentials = fs.Bool("migrate-encrypted-oss-credentials", false, "move the encrypted inline object storage credentials of HelmReleases to a Secret referenced from their spec, decrypted with the oss-decryption-key-file or the decryption key Secret of the HelmRelease")
+	ossAmbientCredentials = fs.Bool("oss-ambient-credentials", false, "allow HelmReleases to access object storages with the credentials of the operator, i.e. the 'instanceProfile' and 'workloadIdentity' credential sources; only static credentials are allowed if not set")
+	ossAmbientNamespaces = fs.StringSlice("oss-ambient-credentials-namespaces", nil, "namespaces of the HelmReleases which may use the credentials of the operator with --oss-ambient-credentials; all namespaces may if not set")
+	ossAmbientRoles = fs.StringSlice("oss-ambient-credentials-roles", nil, "RAM roles, by name or ARN, HelmReleases may select for the credentials of the operator with --oss-ambient-credentials; only the default role of the operator may be used if not set")
+	gitProviderCredentials = fs.Bool("git-provider-credentials", false, "allow HelmReleases to clone Git repositories with short-lived credentials of the operator obtained from a code service, i.e. the 'codeup' and 'codehub' credential sources; only credentials from Secrets are allowed if not set")
+	gitProviderNamespaces = fs.StringSlice("git-provider-credentials-namespaces", nil, "namespaces of the HelmReleases which may use the credentials of the operator with --git-provider-credentials; all namespaces may if not set")
+	codeupHosts = fs.StringSlice("git-credentials-codeup-hosts", chartsync.DefaultGitCredentialHosts[helmfluxv1.GitCredentialsCodeup], "host patterns of the Git repositories the 'codeup' credential source obtains credentials of the operator for; may be repeated")
+	codehubHosts = fs.StringSlice("git-credentials-codehub-hosts", chartsync.DefaultGitCredentialHosts[helmfluxv1.GitCredentialsCodeHub], "host patterns of the Git repositories the 'codehub' credential source obtains credentials of the operator for; may be repeated")
+	workspaceQuota = fs.Int64("chart-workspace-quota", 1<<30, "size in bytes the chart files fetched during the sync of a single HelmRelease may take up; disabled if 0")
+	chartCacheMaxSize = fs.Int64("chart-cache-max-size", 0, "size in bytes the chart archives in the chart cache may take up, before the least recently used archives not referenced by any HelmRelease are evicted; unlimited if 0")
+	chartCacheMaxAge = fs.Duration("chart-cache-max-age", 0, "duration after its last use a chart archive not referenced by any HelmRelease is evicted from the chart cache; unlimited if 0")
+	chartCacheGCInterval = fs.Duration("chart-cache-gc-interval", 10*time.Minute, "period on which to evict chart archives from the chart cache, if a maximum size or age is set")
+
+	releaseStorageGCInterval = fs.Duration("release-storage-gc-interval", 0, "period on which the revisions of releases beyond the maxHistory of their HelmRelease, and the releases of HelmReleases which no longer exist, are pruned from the Helm release storage; disabled if 0")
+	capacityCheck = fs.String("upgrade-capacity-check", "", "estimate the additional CPU/memory requested by an upgrade and compare it against the schedulable cluster capacity; one of 'warn' or 'block', disabled if empty")
+	postRenderFailure = fs.String("post-render-failure-policy", string(release.PostRenderFailureFallback), "what to do when the built-in post-renderer fails to mutate the rendered manifests; one of 'fallback' (apply them without the failed mutations) or 'fail' (fail the release), releases with Istio injection enabled always fail")
+	chartDefaultsDrift = fs.Bool("report-chart-defaults-drift", false, "log and emit an Event when the default values of a chart changed in an upgrade of a HelmRelease with reused values, as these changes are ignored")
+	backupLabels = fs.StringToString("backup-labels", nil, "labels to set on HelmReleases and the Secrets managed by the operator, for Velero backups to select them by, i.e. backup=helm-operator")
+	freezeWindows = fs.String("freeze-windows", "", "path to a YAML file listing recurring release freeze windows during which upgrades are held, as cron schedules with a duration")
+	freezeCalendarURL = fs.String("freeze-calendar-url", "", "URL of a calendar API providing the release freeze windows during which upgrades are held")
+	freezeCalendarPeriod = fs.Duration("freeze-calendar-interval", time.Minute, "period on which to refresh the release freeze windows of the calendar API")
+	approvalURL = fs.String("approval-webhook-url", "", "URL the diff of every upgrade is posted to for an external change management system to allow or deny it; as the diff holds the values, the webhook must be trusted with them; disabled if empty")
+	approvalTimeout = fs.Duration("approval-webhook-timeout", 30*time.Second, "duration to wait for the approval webhook to decide on an upgrade")
+	approvalPolicy = fs.String("approval-default-policy", string(approval.PolicyDeny), "decision on upgrades the approval webhook did not decide on in time or failed for; one of 'allow' or 'deny'")
+	approvalNamespaces = fs.StringSlice("approval-namespaces", nil, "protected namespaces of which the upgrades of HelmReleases require approval; upgrades in all namespaces require approval if not set")
+	vaultAddress = fs.String("vault-address", "", "address of the Vault server the secrets of vaultRef values sources are read from, e.g. https://vault:8200; vaultRef values sources are not supported if empty")
+	vaultAuthMount = fs.String("vault-auth-mount", "kubernetes", "mount path of the Kubernetes auth method in Vault, logged in to with a token of the service account of a vaultRef in the namespace of its HelmRelease")
+	vaultRole = fs.String("vault-role", "", "role of the Kubernetes auth method in Vault logged in with for vaultRef values sources which do not set a role")
+	vaultServiceAccounts = fs.StringSlice("vault-service-accounts", []string{"default"}, "names of the service accounts in the namespace of a HelmRelease of which vaultRef values sources may log in to Vault with a token; may be repeated")
+	vaultCAFile = fs.String("vault-ca-file", "", "path to a PEM encoded CA certificate to verify the Vault server with")
+	vaultCacheTTL = fs.Duration("vault-cache-ttl", time.Minute, "duration the secrets read from Vault are cached; not cached if 0")
+	policyOPAURL = fs.String("policy-opa-url", "", "URL of the Open Policy Agent server the rendered manifests of releases are checked against, for the OPA decisions of HelmRelease policy checks and --policy-opa-decisions, e.g. http://opa:8181")
+	policyOPATimeout = fs.Duration("policy-opa-timeout", 10*time.Second, "timeout of a single OPA decision query")
+	policyOPADecisions = fs.StringSlice("policy-opa-decisions", nil, "paths of the OPA decisions all releases are checked against, e.g. helm/deny; releases are blocked by the violations they result in")
+	haltConfigMap = fs.String("halt-configmap", "", "<namespace>/<name> of a ConfigMap halting all installs, upgrades, rollbacks and uninstalls while its 'halted' key is true, e.g. during incidents; releases are still compared and drift is reported, and the releases of deleted HelmReleases are still uninstalled; disabled if empty")
+	platformCheck = fs.String("node-platform-check", "", "check the node OS/architecture requirements of the workloads in a release against the platforms of the schedulable nodes before it is applied; one of 'warn' or 'block', disabled if empty")
+
+	releaseHookURLs = fs.StringSlice("release-hook-url", nil, "URL the metadata of every successful install, upgrade and uninstall is posted to, e.g. to register releases in a CMDB; may be given multiple times")
+	releaseHookSpoolDir = fs.String("release-hook-spool-dir", "/tmp/release-hooks", "directory release hook events are kept in until they have been delivered; mount a persistent volume to retain undelivered events when the pod is rescheduled")
+	releaseHookTimeout = fs.Duration("release-hook-timeout", 10*time.Second, "timeout of a single release hook delivery attempt")
+
+	notifySinks = fs.StringSlice("notify-sink", nil, "sink the lifecycle events of releases are sent to, in the form <type>=<url> with type one of 'webhook', 'slack', 'dingtalk' or 'wecom'; may be repeated")
+	notifyConfigMap = fs.String("notify-configmap", "", "<namespace>/<name> of a ConfigMap holding additional notification sinks as a YAML list in its 'sinks' key, read on every notification")
+	notifyEvents = fs.StringSlice("notify-events", nil, "lifecycle events sent to the sinks of --notify-sink, of 'installed', 'upgraded', 'rolledBack', 'failed' and 'driftDetected'; all events are sent if not set")
+	notifyTimeout = fs.Duration("notify-timeout", 10*time.Second, "timeout of a single notification delivery")
 
 	gitTimeout = fs.Duration("git-timeout", 20*time.Second, "duration after which git operations time out")
 	gitPollInterval = fs.Duration("git-poll-interval", 5*time.Minute, "period on which to poll git chart sources for changes")
 	gitDefaultRef = fs.String("git-default-ref", "master", "ref to clone chart from if ref is unspecified in a HelmRelease")
 
 	versionedHelmRepositoryIndexes = fs.StringSlice("helm-repository-import", nil, "Targeted version and the path of the Helm repository index to import, i.e. v3:/tmp/v3/index.yaml,v2:/tmp/v2/index.yaml")
+	repositoryIndexTTL = fs.Duration("helm-repository-index-ttl", time.Minute, "duration a downloaded Helm repository index is reused for chart fetches; disables the cache if 0")
+	hostAliases = fs.StringSlice("host-alias", nil, "static IPs for a host of a chart source, in the form host=ip[;ip...], e.g. charts.internal=10.0.0.1; may be repeated")
+	nameservers = fs.StringSlice("dns-server", nil, "name servers, in the form ip[:port], used instead of the name servers of the pod to resolve hosts; may be repeated")
+	repositoryIndexCacheSize = fs.Int("helm-repository-index-cache-size", 100, "maximum amount of Helm repository indexes held in the cache; unlimited if 0")
 
 	enabledHelmVersions = fs.StringSlice("enabled-helm-versions", []string{helmv3.VERSION}, "Helm versions supported by this operator instance")
+	helmStorageDriver = fs.String("helm-storage-driver", "secret", "storage driver of the Helm v3 releases, one of 'secret' or 'configmap'; releases stored with another driver are not seen, and installed again")
 }
 
 func main() {
+	// the 2to3 conversion of a release runs in a child process of the
+	// operator, so that it can be killed when it hangs
+	if len(os.Args) > 1 && os.Args[1] == v3.ConvertCommand {
+		os.Exit(v3.RunConvertCommand(os.Args[2:]))
+	}
+
 	// explicitly initialize klog to enable stderr logging,
 	// and parse our own flags.
 	klog.InitFlags(nil)
@@ -153,21 +404,27 @@ func main() {
 
 	// init go-kit log
 	{
-		switch *logFormat {
-		case "json":
-			logger = log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
-		case "fmt":
-			logger = log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
-		default:
-			logger = log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
+		levels, err := logging.ParseLevels(*logLevel)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --log-level: %v\n", err)
+			os.Exit(1)
+		}
+		var formatErr error
+		logger, formatErr = logging.NewLogger(os.Stderr, *logFormat, levels)
+		if formatErr != nil {
+			logger, _ = logging.NewLogger(os.Stderr, "fmt", levels)
 		}
 		logger = log.With(logger, "ts", log.DefaultTimestampUTC)
 		logger = log.With(logger, "caller", log.DefaultCaller)
+		if formatErr != nil {
+			logger.Log("warning", fmt.Sprintf("invalid --log-format, falling back to 'fmt': %v", formatErr))
+		}
 	}
 
-	// configure go logger to output using go-kit log
-	logWriter := utils.NewLogWriter(logger)
+	// configure go logger and klog to output using go-kit log
+	logWriter := utils.NewLogWriter(log.With(logger, "component", "golog"))
 	golog.SetOutput(logWriter)
+	logging.RedirectKlog(log.With(logger, "component", "klog"))
 
 	// error channel
 	errc := make(chan error)
@@ -185,6 +442,95 @@ func main() {
 
 	mainLogger := log.With(logger, "component", "helm-operator")
 
+	if err := messages.SetLanguage(*logLanguage); err != nil {
+		mainLogger.Log("error", err.Error())
+		os.Exit(1)
+	}
+
+	releaseLabels := metrics.ReleaseLabels{
+		Mode:        metrics.ReleaseLabelMode(*metricsReleaseLabels),
+		HashBuckets: *metricsReleaseHashBuckets,
+		Allowlist:   *metricsReleaseAllowlist,
+	}
+	if err := releaseLabels.Validate(); err != nil {
+		mainLogger.Log("error", err.Error())
+		os.Exit(1)
+	}
+	metrics.Install(releaseLabels)
+
+	// chart sources are requested with a dedicated transport resolving
+	// their hosts with the host aliases and name servers, the default
+	// transport and resolver are left alone
+	var chartTransport *http.Transport
+	if len(*hostAliases) > 0 || len(*nameservers) > 0 {
+		aliases, err := resolver.ParseHostAliases(*hostAliases)
+		if err != nil {
+			mainLogger.Log("error", err.Error())
+			os.Exit(1)
+		}
+		servers, err := resolver.ParseNameservers(*nameservers)
+		if err != nil {
+			mainLogger.Log("error", err.Error())
+			os.Exit(1)
+		}
+		chartTransport = resolver.New(aliases, servers).Transport()
+	}
+
+	var ossKey []byte
+	if *ossDecryptionKey != "" {
+		key, err := chartsync.ReadDecryptionKey(*ossDecryptionKey)
+		if err != nil {
+			mainLogger.Log("error", fmt.Sprintf("failed to read object storage decryption key: %v", err))
+			os.Exit(1)
+		}
+		ossKey = key
+	}
+
+	var freezes freeze.Providers
+	if *freezeWindows != "" {
+		windows, err := freeze.LoadStatic(*freezeWindows)
+		if err != nil {
+			mainLogger.Log("error", fmt.Sprintf("failed to load release freeze windows: %v", err))
+			os.Exit(1)
+		}
+		freezes = append(freezes, windows)
+	}
+	if *freezeCalendarURL != "" {
+		freezes = append(freezes, freeze.NewCalendar(*freezeCalendarURL, nil, *freezeCalendarPeriod))
+	}
+	var freezeProvider freeze.Provider
+	if len(freezes) > 0 {
+		freezeProvider = freezes
+	}
+
+	var approvalWebhook *approval.Webhook
+	if *approvalURL != "" {
+		approvalConfig := approval.Config{
+			URL:           *approvalURL,
+			Timeout:       *approvalTimeout,
+			DefaultPolicy: approval.Policy(*approvalPolicy),
+			Namespaces:    *approvalNamespaces,
+		}
+		if err := approvalConfig.Validate(); err != nil {
+			mainLogger.Log("error", err)
+			os.Exit(1)
+		}
+		approvalWebhook = approval.NewWebhook(approvalConfig)
+	}
+
+	var receiverSecret []byte
+	if *receiverSecretPath != "" {
+		b, err := ioutil.ReadFile(*receiverSecretPath)
+		if err != nil {
+			mainLogger.Log("error", fmt.Sprintf("failed to read webhook receiver secret: %v", err))
+			os.Exit(1)
+		}
+		if receiverSecret = []byte(strings.TrimSpace(string(b))); len(receiverSecret) == 0 {
+			mainLogger.Log("error", fmt.Sprintf("webhook receiver secret file %s is empty", *receiverSecretPath))
+			os.Exit(1)
+		}
+	}
+
 	// build Kubernetes clients
 	cfg, err := clientcmd.BuildConfigFromFlags(*master, *kubeconfig)
 	if err != nil {
@@ -198,19 +544,160 @@ func main() {
 		os.Exit(1)
 	}
 
+	var vaultClient *vault.Client
+	if *vaultAddress != "" {
+		vaultConfig := vault.Config{
+			Address:         *vaultAddress,
+			AuthMount:       *vaultAuthMount,
+			Role:            *vaultRole,
+			ServiceAccounts: *vaultServiceAccounts,
+			CacheTTL:        *vaultCacheTTL,
+		}
+		if *vaultCAFile != "" {
+			if vaultConfig.CACert, err = ioutil.ReadFile(*vaultCAFile); err != nil {
+				mainLogger.Log("error", fmt.Sprintf("failed to read Vault CA certificate: %v", err))
+				os.Exit(1)
+			}
+		}
+		// log in to Vault with short-lived tokens of the service accounts
+		// in the namespaces of the HelmReleases, rather than the token of
+		// the operator, for Vault to authorize these per namespace
+		vaultClient, err = vault.New(vaultConfig, func(namespace, serviceAccount string) (string, error) {
+			expiration := int64(600)
+			tr, err := kubeClient.CoreV1().ServiceAccounts(namespace).CreateToken(serviceAccount, &authenticationv1.TokenRequest{
+				Spec: authenticationv1.TokenRequestSpec{ExpirationSeconds: &expiration},
+			})
+			if err != nil {
+				return "", err
+			}
+			return tr.Status.Token, nil
+		})
+		if err != nil {
+			mainLogger.Log("error", fmt.Sprintf("failed to set up Vault client: %v", err))
+			os.Exit(1)
+		}
+	}
+
+	var opaClient *opa.Client
+	if *policyOPAURL != "" {
+		if opaClient, err = opa.New(*policyOPAURL, *policyOPATimeout); err != nil {
+			mainLogger.Log("error", fmt.Sprintf("failed to set up OPA client: %v", err))
+			os.Exit(1)
+		}
+	}
+
 	ifClient, err := clientset.NewForConfig(cfg)
 	if err != nil {
 		mainLogger.Log("error", fmt.Sprintf("error building integrations clientset: %v", err))
 		os.Exit(1)
 	}
 
-	// initialize versioned Helm clients
+	var haltSwitch halt.Switch
+	if *haltConfigMap != "" {
+		ns, name, ok := splitNamespacedName(*haltConfigMap)
+		if !ok {
+			mainLogger.Log("error", fmt.Sprintf("invalid halt ConfigMap '%s', expected <namespace>/<name>", *haltConfigMap))
+			os.Exit(1)
+		}
+		haltSwitch = halt.NewConfigMap(kubeClient.CoreV1(), ns, name)
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		mainLogger.Log("error", fmt.Sprintf("error building dynamic client: %v", err))
+		os.Exit(1)
+	}
+	restMapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(kubeClient.Discovery()))
+
+	serverConfig := daemonhttp.ServerConfig{
+		TLSCertFile:            *listenTLSCert,
+		TLSKeyFile:             *listenTLSKey,
+		TLSAutoGenerate:        *listenTLSAutoGenerate,
+		MetricsClientCAFile:    *metricsClientCA,
+		MetricsBearerTokenFile: *metricsBearerTokenFile,
+		Profiling:              *profiling,
+		AdmissionWebhook:       *admissionWebhook,
+		ConversionWebhook:      *conversionWebhook,
+		OperationsAPI:          *operationsAPI,
+		IntrospectionAPI:       *introspectionAPI,
+		KubeClient:             kubeClient,
+	}
+	if err := serverConfig.Validate(); err != nil {
+		mainLogger.Log("error", fmt.Sprintf("invalid HTTP server configuration: %v", err))
+		os.Exit(1)
+	}
+
+	switch release.CapacityCheckPolicy(*capacityCheck) {
+	case release.CapacityCheckDisabled, release.CapacityCheckWarn, release.CapacityCheckBlock:
+	default:
+		mainLogger.Log("error", fmt.Sprintf("unsupported upgrade capacity check policy: %s", *capacityCheck))
+		os.Exit(1)
+	}
+
+	switch release.PlatformCheckPolicy(*platformCheck) {
+	case release.PlatformCheckDisabled, release.PlatformCheckWarn, release.PlatformCheckBlock:
+	default:
+		mainLogger.Log("error", fmt.Sprintf("unsupported node platform check policy: %s", *platformCheck))
+		os.Exit(1)
+	}
+
+	if err := helmv3.ValidateStorageDriver(*helmStorageDriver); err != nil {
+		mainLogger.Log("error", err)
+		os.Exit(1)
+	}
+
+	switch release.PostRenderFailurePolicy(*postRenderFailure) {
+	case release.PostRenderFailureFallback, release.PostRenderFailureFail:
+	default:
+		mainLogger.Log("error", fmt.Sprintf("unsupported post-render failure policy: %s", *postRenderFailure))
+		os.Exit(1)
+	}
+
+	if *enableLeaderElection && (*leaderElectionLeaseDuration <= *leaderElectionRenewDeadline ||
+		*leaderElectionRenewDeadline <= *leaderElectionRetryPeriod || *leaderElectionRetryPeriod <= 0) {
+		mainLogger.Log("error", "leader election requires lease-duration > renew-deadline > retry-period > 0")
+		os.Exit(1)
+	}
+
+	shard := operator.Shard{Index: *shardIndex, Total: *shardTotal}
+	if *shardSelector != "" {
+		if shard.Selector, err = labels.Parse(*shardSelector); err != nil {
+			mainLogger.Log("error", fmt.Sprintf("invalid shard selector: %v", err))
+			os.Exit(1)
+		}
+	}
+	if *shardTotal > 1 && (*shardIndex < 0 || *shardIndex >= *shardTotal) {
+		mainLogger.Log("error", fmt.Sprintf("shard index %d out of range for %d shards", *shardIndex, *shardTotal))
+		os.Exit(1)
+	}
+
+	scope := operator.Scope{Namespaces: *watchNamespaces, LabelSelector: *watchLabelSelector}
+	if *namespace != "" {
+		if len(*watchNamespaces) > 0 {
+			mainLogger.Log("error", "--allow-namespace and --watch-namespaces are mutually exclusive")
+			os.Exit(1)
+		}
+		scope.Namespaces = []string{*namespace}
+	}
+	if *watchLabelSelector != "" {
+		if _, err := labels.Parse(*watchLabelSelector); err != nil {
+			mainLogger.Log("error", fmt.Sprintf("invalid watch label selector: %v", err))
+			os.Exit(1)
+		}
+	}
+
+	// initialize versioned Helm clients, sharing the cache for chart
+	// repository indexes
+	var indexCache helm.IndexCache
+	if *repositoryIndexTTL > 0 {
+		indexCache = chartsync.NewRepoIndexCache(*repositoryIndexTTL, *repositoryIndexCacheSize)
+	}
 	helmClients := &helm.Clients{}
 	for _, v := range *enabledHelmVersions {
 		versionedLogger := log.With(logger, "component", "helm", "version", v)
 		switch v {
 		case helmv3.VERSION:
-			client := helmv3.New(versionedLogger, cfg)
+			client := helmv3.New(versionedLogger, cfg, indexCache, *helmStorageDriver, chartTransport)
 			helmClients.Add(helmv3.VERSION, client)
 		default:
 			mainLogger.Log("error", fmt.Sprintf("unsupported Helm version: %s", v))
@@ -223,6 +710,35 @@ func main() {
 		}
 	}
 
+	// initialize the Helm clients for the remote clusters of
+	// HelmReleases, constructed from the kubeconfig in their Secret
+	var targetClients *helm.TargetClients
+	if *allowRemoteTargets {
+		targetClients = helm.NewTargetClients(func(version string, kubeConfig []byte) (helm.Target, error) {
+			if _, ok := helmClients.Load(version); !ok {
+				return helm.Target{}, fmt.Errorf("no client found for Helm '%s'", version)
+			}
+			targetCfg, err := clientcmd.RESTConfigFromKubeConfig(kubeConfig)
+			if err != nil {
+				return helm.Target{}, err
+			}
+			targetKube, err := kubernetes.NewForConfig(targetCfg)
+			if err != nil {
+				return helm.Target{}, err
+			}
+			targetDynamic, err := dynamic.NewForConfig(targetCfg)
+			if err != nil {
+				return helm.Target{}, err
+			}
+			targetLogger := log.With(logger, "component", "helm", "version", version, "cluster", targetCfg.Host)
+			return helm.Target{
+				Client:  helmv3.New(targetLogger, targetCfg, indexCache, *helmStorageDriver, chartTransport),
+				Dynamic: targetDynamic,
+				Mapper:  restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(targetKube.Discovery())),
+			}, nil
+		}, *targetClientTTL)
+	}
+
 	// import Helm chart repositories from provided indexes
 	for _, i := range *versionedHelmRepositoryIndexes {
 		parts := strings.Split(i, ":")
@@ -241,18 +757,30 @@ func main() {
 		}
 	}
 
-	// setup shared informer for HelmReleases
-	nsOpt := ifinformers.WithNamespace(*namespace)
-	ifInformerFactory := ifinformers.NewSharedInformerFactoryWithOptions(ifClient, *chartsSyncInterval, nsOpt)
-	hrInformer := ifInformerFactory.Helm().V1().HelmReleases()
+	// setup shared informer for the HelmReleases in scope
+	hrInformer := scope.NewInformer(ifClient, *chartsSyncInterval)
 
-	// setup workqueue for HelmReleases
-	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ChartRelease")
+	// setup workqueue for HelmReleases, the rate limiter mirrors
+	// `workqueue.DefaultControllerRateLimiter` with configurable
+	// parameters
+	if *workqueueBaseDelay <= 0 || *workqueueMaxDelay < *workqueueBaseDelay {
+		mainLogger.Log("error", "workqueue-base-delay must be positive and may not exceed workqueue-max-delay")
+		os.Exit(1)
+	}
+	if *workqueueQPS <= 0 || *workqueueBurst <= 0 {
+		mainLogger.Log("error", "workqueue-qps and workqueue-burst must be positive")
+		os.Exit(1)
+	}
+	rateLimiter := workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(*workqueueBaseDelay, *workqueueMaxDelay),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(*workqueueQPS), *workqueueBurst)},
+	)
+	queue := workqueue.NewNamedRateLimitingQueue(rateLimiter, "ChartRelease")
 
 	gitChartSync := chartsync.NewGitChartSync(
 		log.With(logger, "component", "gitchartsync"),
 		kubeClient.CoreV1(),
-		hrInformer.Lister(),
+		shard.Lister(hrInformer.Lister()),
 		chartsync.GitConfig{GitTimeout: *gitTimeout, GitPollInterval: *gitPollInterval, GitDefaultRef: *gitDefaultRef},
 		queue,
 	)
@@ -261,24 +789,134 @@ func main() {
 		KubeConfig:       *kubeconfig,
 		TillerOutCluster: *convertTillerOutCluster,
 		StorageType:      *convertReleaseStorage,
+		Timeout:          *convertTimeout,
+		Attempts:         *convertAttempts,
+	}
+	// retry holds the default retries of failed syncs, of which the
+	// failed installs and upgrades remediated by releases are part
+	retry := helmfluxv1.Retry{
+		MaxRetries: workqueueRetries,
+		BaseDelay:  &metav1.Duration{Duration: *workqueueBaseDelay},
+		MaxDelay:   &metav1.Duration{Duration: *workqueueMaxDelay},
 	}
 	rel := release.New(
 		log.With(logger, "component", "release"),
 		helmClients,
 		kubeClient.CoreV1(),
 		ifClient.HelmV1(),
+		dynamicClient,
+		restMapper,
 		gitChartSync,
-		release.Config{LogDiffs: *logReleaseDiffs, UpdateDeps: *updateDependencies, DefaultHelmVersion: *defaultHelmVersion},
+		release.Config{
+			LogDiffs:                *logReleaseDiffs,
+			UpdateDeps:              *updateDependencies,
+			DefaultHelmVersion:      *defaultHelmVersion,
+			CapacityCheck:           release.CapacityCheckPolicy(*capacityCheck),
+			PlatformCheck:           release.PlatformCheckPolicy(*platformCheck),
+			CrossNamespaceValues:    *allowCrossNsValues,
+			NamespaceDefaults:       *namespaceDefaults,
+			InlineValuesWarnSize:    *inlineValuesWarnSize,
+			RejectLargeInlineValues: *rejectLargeValues,
+			ExternalizeInlineValues: *externalizeValues,
+			LiveDiff:                *liveDiff,
+			ServerSideApply:         *serverSideApply,
+			FieldManager:            *fieldManager,
+			DiffEvents:              *releaseDiffEvents,
+			WorkspaceQuota:          *workspaceQuota,
+			HTTPTransport:           chartTransport,
+			GitTimeout:              *gitTimeout,
+			GitDefaultRef:           *gitDefaultRef,
+			Keyring:                 *chartKeyring,
+			CosignKey:               *chartCosignKey,
+			OssDecryptionKey:        ossKey,
+			MigrateOssCredentials:   *migrateOssCredentials,
+			GitProviderCredentials: chartsync.GitProviderCredentials{
+				Enabled:    *gitProviderCredentials,
+				Namespaces: *gitProviderNamespaces,
+				Hosts: chartsync.GitCredentialHosts{
+					helmfluxv1.GitCredentialsCodeup:  *codeupHosts,
+					helmfluxv1.GitCredentialsCodeHub: *codehubHosts,
+				},
+			},
+			OssAmbientCredentials: chartsync.AmbientCredentials{
+				Enabled:    *ossAmbientCredentials,
+				Namespaces: *ossAmbientNamespaces,
+				Roles:      *ossAmbientRoles,
+			},
+			PostRenderFailure:   release.PostRenderFailurePolicy(*postRenderFailure),
+			BackupLabels:        *backupLabels,
+			ChartDefaultsDrift:  *chartDefaultsDrift,
+			Freeze:              freezeProvider,
+			Approval:            approvalWebhook,
+			Retry:               retry,
+			Halt:                haltSwitch,
+			TargetClients:       targetClients,
+			RemoteTargetServers: *remoteTargetServers,
+			Vault:               vaultClient,
+			OPA:                 opaClient,
+			PolicyDecisions:     *policyOPADecisions,
+		},
 		converter,
 	)
+	if len(*releaseHookURLs) > 0 {
+		hooks, err := releasehook.NewDispatcher(releasehook.Config{
+			URLs:     *releaseHookURLs,
+			SpoolDir: *releaseHookSpoolDir,
+			Timeout:  *releaseHookTimeout,
+		}, log.With(logger, "component", "releasehook"))
+		if err != nil {
+			mainLogger.Log("error", fmt.Sprintf("failed to set up release hooks: %v", err))
+			os.Exit(1)
+		}
+		rel.SetReleaseHooks(hooks)
+		hooks.Run(shutdown, shutdownWg)
+	}
+	if len(*notifySinks) > 0 || *notifyConfigMap != "" {
+		notifyConfig := notify.Config{Timeout: *notifyTimeout}
+		var events []notify.EventType
+		for _, e := range *notifyEvents {
+			events = append(events, notify.EventType(e))
+		}
+		for _, s := range *notifySinks {
+			parts := strings.SplitN(s, "=", 2)
+			if len(parts) != 2 {
+				mainLogger.Log("error", fmt.Sprintf("invalid notification sink '%s', expected <type>=<url>", s))
+				os.Exit(1)
+			}
+			notifyConfig.Sinks = append(notifyConfig.Sinks, notify.SinkConfig{Type: notify.SinkType(parts[0]), URL: parts[1], Events: events})
+		}
+		if *notifyConfigMap != "" {
+			ns, name, ok := splitNamespacedName(*notifyConfigMap)
+			if !ok {
+				mainLogger.Log("error", fmt.Sprintf("invalid notification ConfigMap '%s', expected <namespace>/<name>", *notifyConfigMap))
+				os.Exit(1)
+			}
+			notifyConfig.ConfigMapNamespace, notifyConfig.ConfigMapName = ns, name
+		}
+		notifier, err := notify.NewNotifier(notifyConfig, kubeClient.CoreV1(), log.With(logger, "component", "notify"))
+		if err != nil {
+			mainLogger.Log("error", fmt.Sprintf("failed to set up notifications: %v", err))
+			os.Exit(1)
+		}
+		rel.SetNotifier(notifier)
+		notifier.Run(shutdown, shutdownWg)
+	}
 
 	// prepare operator and start FluxRelease informer
 	// NB: the operator needs to do its magic with the informer
 	// _before_ starting it or else the cache sync seems to hang at
 	// random
+	var alertRules *alerting.Generator
+	if *prometheusRules {
+		alertRules = alerting.NewGenerator(dynamicClient, alerting.Config{
+			NotReadyFor: *prometheusRulesNotReadyFor,
+			Labels:      *prometheusRulesLabels,
+		})
+	}
+
 	opr := operator.New(log.With(logger, "component", "operator"),
-		*logReleaseDiffs, kubeClient, hrInformer, queue, rel, gitChartSync)
-	go ifInformerFactory.Start(shutdown)
+		*logReleaseDiffs, kubeClient, hrInformer, queue, rel, gitChartSync, alertRules, *resyncInterval, shard, retry)
+	hrInformer.Start(shutdown)
 
 	// wait for the caches to be synced before starting _any_ workers
 	mainLogger.Log("info", "waiting for informer caches to sync")
@@ -288,19 +926,88 @@ func main() {
 	}
 	mainLogger.Log("info", "informer caches synced")
 
-	// start operator
-	go opr.Run(*workers, shutdown, shutdownWg)
-
 	// start git chart sync loop
 	go gitChartSync.Run(shutdown, errc, shutdownWg)
 
-	// the status updater, to keep track of the release status for
-	// every HelmRelease
-	statusUpdater := status.New(ifClient, hrInformer.Lister(), helmClients, *defaultHelmVersion)
-	go statusUpdater.Loop(shutdown, *statusUpdateInterval, log.With(logger, "component", "statusupdater"))
+	// start the chart cache garbage collection; every instance has
+	// its own cache, so this runs regardless of leader election
+	if *chartCacheMaxSize > 0 || *chartCacheMaxAge > 0 {
+		cacheGC := chartsync.NewCacheGC(release.Config{}.WithDefaults().ChartCache, chartsync.CacheGCConfig{
+			MaxSize:            *chartCacheMaxSize,
+			MaxAge:             *chartCacheMaxAge,
+			DefaultHelmVersion: *defaultHelmVersion,
+		}, hrInformer.Lister())
+		go cacheGC.Loop(shutdown, *chartCacheGCInterval, log.With(logger, "component", "chartcachegc"))
+	}
+
+	// start the components processing releases; with leader election
+	// enabled, these only run on the elected leader
+	start := func(stop <-chan struct{}) {
+		// the migration of legacy HelmReleases, which only runs on
+		// the leader to not race other replicas creating them
+		if *migrateLegacy {
+			migrateLogger := log.With(logger, "component", "migration")
+			namespaces := scope.Namespaces
+			if len(namespaces) == 0 {
+				namespaces = []string{metav1.NamespaceAll}
+			}
+			for _, ns := range namespaces {
+				n, err := conversion.Migrate(migrateLogger, dynamicClient, ns)
+				if err != nil {
+					migrateLogger.Log("error", fmt.Sprintf("failed to migrate legacy HelmReleases: %v", err))
+					continue
+				}
+				if n > 0 {
+					migrateLogger.Log("info", fmt.Sprintf("migrated %d legacy HelmRelease(s)", n))
+				}
+			}
+		}
+
+		// the status updater, to keep track of the release status for
+		// every HelmRelease
+		statusUpdater := status.New(ifClient, shard.Lister(hrInformer.Lister()), helmClients, *defaultHelmVersion)
+		statusUpdater.SetClientFunc(rel.HelmClient)
+		go statusUpdater.Loop(stop, *statusUpdateInterval, log.With(logger, "component", "statusupdater"))
+
+		// the image updater, to update image tags in the values of
+		// HelmReleases with image update policies
+		if *imageUpdateInterval > 0 {
+			imageUpdater := imageautomation.New(ifClient, shard.Lister(hrInformer.Lister()), kubeClient.CoreV1())
+			go imageUpdater.Loop(stop, *imageUpdateInterval, log.With(logger, "component", "imageupdater"))
+		}
+
+		// the release storage garbage collection, to prune the history
+		// of releases and orphaned releases
+		if *releaseStorageGCInterval > 0 {
+			historyGC := release.NewHistoryGC(release.HistoryGCConfig{
+				StorageDriver: *helmStorageDriver,
+				Namespaces:    scope.Namespaces,
+			}, kubeClient.CoreV1(), ifClient.HelmV1(), shard.Lister(hrInformer.Lister()), dynamicClient, restMapper)
+			go historyGC.Loop(stop, *releaseStorageGCInterval, log.With(logger, "component", "historygc"))
+		}
 
-	// start HTTP server
-	go daemonhttp.ListenAndServe(*listenAddr, gitChartSync, log.With(logger, "component", "daemonhttp"), shutdown)
+		// start operator
+		opr.Run(*workers, stop, shutdownWg)
+	}
+	if *enableLeaderElection {
+		go func() {
+			errc <- operator.RunWithLeaderElection(kubeClient, operator.LeaderElectionConfig{
+				Namespace:     *leaderElectionNamespace,
+				Name:          *leaderElectionName,
+				LeaseDuration: *leaderElectionLeaseDuration,
+				RenewDeadline: *leaderElectionRenewDeadline,
+				RetryPeriod:   *leaderElectionRetryPeriod,
+			}, log.With(logger, "component", "leaderelection"), shutdown, start)
+		}()
+	} else {
+		go start(shutdown)
+	}
+
+	// start HTTP server, with the webhook receiver enqueueing the
+	// HelmReleases of this shard
+	hookReceiver := receiver.New(log.With(logger, "component", "receiver"), receiverSecret,
+		shard.Lister(hrInformer.Lister()), gitChartSync, queue, *gitDefaultRef)
+	go daemonhttp.ListenAndServe(*listenAddr, serverConfig, apiServer{gitChartSync, rel, hookReceiver}, log.With(logger, "component", "daemonhttp"), shutdown)
 
 	checkpoint.CheckForUpdates(product, version, nil, log.With(logger, "component", "checkpoint"))
 
@@ -310,6 +1017,24 @@ func main() {
 	shutdownWg.Wait()
 }
 
+// apiServer serves the HTTP API requests using the git chart sync,
+// the release and the webhook receiver.
+type apiServer struct {
+	*chartsync.GitChartSync
+	*release.Release
+	*receiver.Receiver
+}
+
+// splitNamespacedName splits the given <namespace>/<name> reference
+// of an object.
+func splitNamespacedName(s string) (string, string, bool) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
 func getEnv(key string, defaultValue string) string {
 	if v, ok := os.LookupEnv(key); ok {
 		return v
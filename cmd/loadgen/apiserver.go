@@ -0,0 +1,83 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	k8stesting "k8s.io/client-go/testing"
+
+	helmfluxv1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+)
+
+// watchQueueLength is the amount of HelmRelease events buffered for
+// every watch.
+const watchQueueLength = 1000
+
+// emulateAPIServer makes the fake clientset maintain the resource
+// version and generation of HelmReleases like the API server, and
+// reject updates of outdated HelmReleases with a conflict. Without
+// this, the status updates of the operator would silently overwrite
+// each other. Watch events are broadcast without a limit on pending
+// events, as the watches of the fake clientset panic once more than
+// a hundred events are pending. It returns a function to stop the
+// broadcasting of events.
+func emulateAPIServer(client *ifclientsetfake.Clientset) func() {
+	var mu sync.Mutex
+	var version int
+	resource := helmfluxv1.SchemeGroupVersion.WithResource("helmreleases")
+	events := watch.NewBroadcaster(watchQueueLength, watch.WaitIfChannelFull)
+
+	client.PrependWatchReactor("helmreleases", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		return true, events.Watch(), nil
+	})
+	client.PrependReactor("create", "helmreleases", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		hr := action.(k8stesting.CreateAction).GetObject().(*helmfluxv1.HelmRelease).DeepCopy()
+		version++
+		hr.ResourceVersion = strconv.Itoa(version)
+		hr.Generation = 1
+		if err := client.Tracker().Create(resource, hr, hr.Namespace); err != nil {
+			return true, nil, err
+		}
+		events.Action(watch.Added, hr.DeepCopy())
+		return true, hr, nil
+	})
+	client.PrependReactor("update", "helmreleases", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		hr := action.(k8stesting.UpdateAction).GetObject().(*helmfluxv1.HelmRelease).DeepCopy()
+		obj, err := client.Tracker().Get(resource, hr.Namespace, hr.Name)
+		if err != nil {
+			return true, nil, err
+		}
+		cur := obj.(*helmfluxv1.HelmRelease)
+		if hr.ResourceVersion != cur.ResourceVersion {
+			return true, nil, apierrors.NewConflict(resource.GroupResource(), hr.Name,
+				apierrors.NewBadRequest("the object has been modified; please apply your changes to the latest version and try again"))
+		}
+		if action.GetSubresource() == "status" {
+			// the status subresource ignores changes to the spec
+			hr.Spec = cur.Spec
+			hr.Generation = cur.Generation
+		} else {
+			hr.Status = cur.Status
+			if !reflect.DeepEqual(hr.Spec, cur.Spec) {
+				hr.Generation = cur.Generation + 1
+			}
+		}
+		version++
+		hr.ResourceVersion = strconv.Itoa(version)
+		if err := client.Tracker().Update(resource, hr, hr.Namespace); err != nil {
+			return true, nil, err
+		}
+		events.Action(watch.Modified, hr.DeepCopy())
+		return true, hr, nil
+	})
+	return events.Shutdown
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"sigs.k8s.io/yaml"
+
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+// fakeHelm is a Helm client keeping releases in memory. It loads the
+// charts it is given like Helm, but does not render or apply them;
+// installs and upgrades take the configured latency instead, to
+// simulate the time spent waiting on the cluster.
+type fakeHelm struct {
+	latency time.Duration
+
+	mu       sync.Mutex
+	releases map[string][]*helm.Release
+}
+
+func newFakeHelm(latency time.Duration) *fakeHelm {
+	return &fakeHelm{
+		latency:  latency,
+		releases: make(map[string][]*helm.Release),
+	}
+}
+
+func releaseKey(namespace, releaseName string) string {
+	return namespace + "/" + releaseName
+}
+
+func (h *fakeHelm) Get(releaseName string, opts helm.GetOptions) (*helm.Release, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	history := h.releases[releaseKey(opts.Namespace, releaseName)]
+	if len(history) == 0 {
+		return nil, nil
+	}
+	if opts.Version == 0 {
+		return history[len(history)-1], nil
+	}
+	for _, rel := range history {
+		if rel.Version == opts.Version {
+			return rel, nil
+		}
+	}
+	return nil, nil
+}
+
+func (h *fakeHelm) Status(releaseName string, opts helm.StatusOptions) (helm.Status, error) {
+	rel, _ := h.Get(releaseName, helm.GetOptions{Namespace: opts.Namespace, Version: opts.Version})
+	if rel == nil {
+		return "", fmt.Errorf("release '%s' not found", releaseName)
+	}
+	return rel.Info.Status, nil
+}
+
+func (h *fakeHelm) UpgradeFromPath(chartPath string, releaseName string, values []byte, opts helm.UpgradeOptions) (*helm.Release, error) {
+	c, err := loader.Load(chartPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chart: %w", err)
+	}
+	var vals map[string]interface{}
+	if err := yaml.Unmarshal(values, &vals); err != nil {
+		return nil, fmt.Errorf("failed to parse values: %w", err)
+	}
+	if !opts.DryRun {
+		time.Sleep(h.latency)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := releaseKey(opts.Namespace, releaseName)
+	history := h.releases[key]
+	if len(history) == 0 && !opts.Install {
+		return nil, fmt.Errorf("release '%s' has no deployed releases", releaseName)
+	}
+	rel := &helm.Release{
+		Name:      releaseName,
+		Namespace: opts.Namespace,
+		Chart: &helm.Chart{
+			Name:       c.Metadata.Name,
+			Version:    c.Metadata.Version,
+			AppVersion: c.Metadata.AppVersion,
+			Values:     c.Values,
+		},
+		Info: &helm.Info{
+			LastDeployed: time.Now(),
+			Status:       helm.StatusDeployed,
+		},
+		Values:  vals,
+		Version: len(history) + 1,
+	}
+	if opts.DryRun {
+		return rel, nil
+	}
+	if len(history) > 0 {
+		history[len(history)-1].Info.Status = helm.StatusSuperseded
+	}
+	h.releases[key] = append(history, rel)
+	return rel, nil
+}
+
+func (h *fakeHelm) History(releaseName string, opts helm.HistoryOptions) ([]*helm.Release, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	history := h.releases[releaseKey(opts.Namespace, releaseName)]
+	res := make([]*helm.Release, 0, len(history))
+	for i := len(history) - 1; i >= 0 && (opts.Max == 0 || len(res) < opts.Max); i-- {
+		res = append(res, history[i])
+	}
+	return res, nil
+}
+
+func (h *fakeHelm) Rollback(releaseName string, opts helm.RollbackOptions) (*helm.Release, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := releaseKey(opts.Namespace, releaseName)
+	history := h.releases[key]
+	if len(history) < 2 {
+		return nil, fmt.Errorf("release '%s' has no previous release", releaseName)
+	}
+	prev := *history[len(history)-2]
+	prev.Info = &helm.Info{LastDeployed: time.Now(), Status: helm.StatusDeployed}
+	prev.Version = len(history) + 1
+	history[len(history)-1].Info.Status = helm.StatusSuperseded
+	h.releases[key] = append(history, &prev)
+	return &prev, nil
+}
+
+func (h *fakeHelm) Test(releaseName string, opts helm.TestOptions) error {
+	return nil
+}
+
+func (h *fakeHelm) DependencyUpdate(chartPath string) error {
+	return nil
+}
+
+func (h *fakeHelm) RepositoryIndex() error {
+	return nil
+}
+
+func (h *fakeHelm) RepositoryAdd(name, url, username, password, certFile, keyFile, caFile string) error {
+	return nil
+}
+
+func (h *fakeHelm) RepositoryRemove(name string) error {
+	return nil
+}
+
+func (h *fakeHelm) RepositoryImport(path string) error {
+	return nil
+}
+
+func (h *fakeHelm) Pull(ref, version, dest string) (string, error) {
+	return "", fmt.Errorf("pulling charts by reference is not supported")
+}
+
+// PullWithRepoURL downloads the chart archive from the fake chart
+// repository, which serves every chart at `<name>-<version>.tgz`.
+func (h *fakeHelm) PullWithRepoURL(repoURL, name, version, dest string, opts helm.PullOptions) (string, error) {
+	filename := fmt.Sprintf("%s-%s.tgz", name, version)
+	res, err := http.Get(strings.TrimSuffix(repoURL, "/") + "/" + filename)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch chart %s: %s", filename, res.Status)
+	}
+	path := filepath.Join(dest, filename)
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, res.Body); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func (h *fakeHelm) ResolveChartVersion(repoURL, name, version string, opts helm.PullOptions) (string, error) {
+	return version, nil
+}
+
+func (h *fakeHelm) Uninstall(releaseName string, opts helm.UninstallOptions) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.releases, releaseKey(opts.Namespace, releaseName))
+	return nil
+}
+
+func (h *fakeHelm) GetChartRevision(chartPath string) (string, error) {
+	c, err := loader.Load(chartPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to load chart to determine revision: %w", err)
+	}
+	return c.Metadata.Version, nil
+}
+
+func (h *fakeHelm) GetChartValues(chartPath string) (helm.Values, error) {
+	c, err := loader.Load(chartPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chart to read its values: %w", err)
+	}
+	return c.Values, nil
+}
+
+func (h *fakeHelm) VerifyChart(chartPath, provPath, keyring string) error {
+	return nil
+}
+
+func (h *fakeHelm) ValidateValues(chartPath string, values []byte, opts helm.ValidateOptions) error {
+	return nil
+}
+
+func (h *fakeHelm) Lint(chartPath string, values []byte, opts helm.LintOptions) ([]helm.LintMessage, error) {
+	return nil, nil
+}
+
+func (h *fakeHelm) Version() string {
+	return "v3"
+}
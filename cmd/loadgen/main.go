@@ -0,0 +1,114 @@
+// Command loadgen measures the reconcile throughput and latency of
+// the operator, for capacity planning and to detect performance
+// regressions before upgrades. For every configuration it runs the
+// operator in process against fake Kubernetes clients, a fake chart
+// repository and a fake Helm backend, creates the synthetic
+// HelmReleases and reports how fast they are installed and upgraded.
+// No cluster is required; the latency of Helm operations on a cluster
+// is simulated.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/spf13/pflag"
+	"k8s.io/klog"
+)
+
+func main() {
+	fs := pflag.NewFlagSet("loadgen", pflag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "DESCRIPTION\n")
+		fmt.Fprintf(os.Stderr, "  loadgen measures the reconcile throughput and latency of the helm-operator with synthetic HelmReleases.\n")
+		fmt.Fprintf(os.Stderr, "\n")
+		fmt.Fprintf(os.Stderr, "FLAGS\n")
+		fs.PrintDefaults()
+	}
+
+	releases := fs.IntSlice("releases", []int{100}, "amounts of synthetic HelmReleases to measure, i.e. 100,1000")
+	workers := fs.IntSlice("workers", []int{2}, "amounts of workers processing releases to measure, i.e. 1,2,4")
+	charts := fs.Int("charts", 10, "amount of distinct charts in the fake chart repository the HelmReleases are spread over")
+	helmLatency := fs.Duration("helm-latency", 50*time.Millisecond, "simulated duration of every Helm install and upgrade")
+	upgrade := fs.Bool("upgrade", true, "measure an upgrade of all HelmReleases after their installation")
+	workqueueQPS := fs.Float64("workqueue-qps", 10, "overall rate at which releases are requeued, in items per second")
+	workqueueBurst := fs.Int("workqueue-burst", 100, "overall burst of releases which may be requeued at once")
+	timeout := fs.Duration("timeout", 10*time.Minute, "maximum duration of every phase of a configuration")
+	verbose := fs.Bool("verbose", false, "log the output of the operator to stderr")
+	fs.Parse(os.Args[1:])
+
+	if *charts <= 0 || *workqueueQPS <= 0 || *workqueueBurst <= 0 {
+		fmt.Fprintln(os.Stderr, "charts, workqueue-qps and workqueue-burst must be positive")
+		os.Exit(1)
+	}
+
+	logger := log.NewNopLogger()
+	if *verbose {
+		logger = log.With(log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr)), "ts", log.DefaultTimestampUTC)
+	} else {
+		// the events of the operator are rejected by the fake clientset
+		klogFlags := flag.NewFlagSet("klog", flag.ContinueOnError)
+		klog.InitFlags(klogFlags)
+		klogFlags.Set("logtostderr", "false")
+		klogFlags.Set("stderrthreshold", "FATAL")
+		klog.SetOutput(ioutil.Discard)
+	}
+
+	repoURL, shutdown, err := newChartRepository(*charts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to set up fake chart repository: %v\n", err)
+		os.Exit(1)
+	}
+	defer shutdown()
+
+	opts := options{
+		repoURL:        repoURL,
+		charts:         *charts,
+		helmLatency:    *helmLatency,
+		upgrade:        *upgrade,
+		workqueueQPS:   *workqueueQPS,
+		workqueueBurst: *workqueueBurst,
+		timeout:        *timeout,
+	}
+	var results []result
+	failed := false
+	for _, r := range *releases {
+		for _, w := range *workers {
+			if r <= 0 || w <= 0 {
+				fmt.Fprintf(os.Stderr, "skipping configuration with %d releases and %d workers\n", r, w)
+				continue
+			}
+			res, err := run(configuration{releases: r, workers: w}, opts, logger)
+			results = append(results, res...)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				failed = true
+			}
+		}
+	}
+
+	report(os.Stdout, results)
+	if failed {
+		shutdown()
+		os.Exit(1)
+	}
+}
+
+// report writes the results as a table.
+func report(w io.Writer, results []result) {
+	tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(tw, "RELEASES\tWORKERS\tPHASE\tRECONCILED\tDURATION\tTHROUGHPUT (/s)\tP50\tP90\tP99\tMAX")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%d\t%s\t%.2f\t%s\t%s\t%s\t%s\n",
+			r.releases, r.workers, r.phase, len(r.latencies), r.duration.Round(time.Millisecond), r.throughput(),
+			r.percentile(50).Round(time.Millisecond), r.percentile(90).Round(time.Millisecond),
+			r.percentile(99).Round(time.Millisecond), r.percentile(100).Round(time.Millisecond))
+	}
+	tw.Flush()
+}
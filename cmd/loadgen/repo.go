@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// chartVersion is the version of every synthetic chart.
+const chartVersion = "1.0.0"
+
+// newChartRepository writes the given number of synthetic charts to a
+// temporary directory and serves them over HTTP. It returns the URL
+// of the repository, and a function to shut it down.
+func newChartRepository(charts int) (string, func(), error) {
+	dir, err := ioutil.TempDir("", "loadgen-charts")
+	if err != nil {
+		return "", nil, err
+	}
+	for i := 0; i < charts; i++ {
+		if _, err := chartutil.Save(syntheticChart(chartName(i)), dir); err != nil {
+			os.RemoveAll(dir)
+			return "", nil, fmt.Errorf("failed to save chart: %w", err)
+		}
+	}
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	return server.URL, func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}, nil
+}
+
+func chartName(i int) string {
+	return fmt.Sprintf("loadgen-%d", i)
+}
+
+// syntheticChart returns a chart with the given name, with a single
+// templated Deployment so the archive resembles a real chart.
+func syntheticChart(name string) *chart.Chart {
+	return &chart.Chart{
+		Metadata: &chart.Metadata{
+			APIVersion: chart.APIVersionV2,
+			Name:       name,
+			Version:    chartVersion,
+			AppVersion: chartVersion,
+		},
+		Raw: []*chart.File{
+			{Name: chartutil.ValuesfileName, Data: []byte("replicas: 1\nimage: nginx:1.19\n")},
+		},
+		Templates: []*chart.File{
+			{Name: "templates/deployment.yaml", Data: []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Release.Name }}
+spec:
+  replicas: {{ .Values.replicas }}
+  selector:
+    matchLabels:
+      app: {{ .Release.Name }}
+  template:
+    metadata:
+      labels:
+        app: {{ .Release.Name }}
+    spec:
+      containers:
+      - name: app
+        image: {{ .Values.image }}
+`)},
+		},
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	helmfluxv1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+	ifinformers "github.com/lstack-org/helm-operator/pkg/client/informers/externalversions"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+	v3 "github.com/lstack-org/helm-operator/pkg/helm/v3"
+	"github.com/lstack-org/helm-operator/pkg/operator"
+	"github.com/lstack-org/helm-operator/pkg/release"
+)
+
+// loadNamespace is the namespace of the synthetic HelmReleases.
+const loadNamespace = "loadgen"
+
+// The phases of a run.
+const (
+	phaseInstall = "install"
+	phaseUpgrade = "upgrade"
+)
+
+// configuration is a configuration of the operator to measure.
+type configuration struct {
+	releases int
+	workers  int
+}
+
+// options are the options shared by all runs.
+type options struct {
+	repoURL        string
+	charts         int
+	helmLatency    time.Duration
+	upgrade        bool
+	workqueueQPS   float64
+	workqueueBurst int
+	timeout        time.Duration
+}
+
+// result holds the measurements of a phase of a run.
+type result struct {
+	configuration
+	phase     string
+	duration  time.Duration
+	latencies []time.Duration
+}
+
+// throughput returns the reconciled releases per second.
+func (r result) throughput() float64 {
+	if r.duration <= 0 {
+		return 0
+	}
+	return float64(len(r.latencies)) / r.duration.Seconds()
+}
+
+// percentile returns the p-th percentile of the latencies.
+func (r result) percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(r.latencies))*p/100+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(r.latencies) {
+		i = len(r.latencies) - 1
+	}
+	return r.latencies[i]
+}
+
+// run runs the operator with the given configuration against fake
+// Kubernetes clients and the fake Helm backend, and measures the
+// reconciliation of the synthetic HelmReleases: their installation,
+// and their upgrade after a change of their values.
+func run(config configuration, opts options, logger log.Logger) ([]result, error) {
+	cacheDir, err := ioutil.TempDir("", "loadgen-cache")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(cacheDir)
+
+	kubeClient := kubefake.NewSimpleClientset()
+	ifClient := ifclientsetfake.NewSimpleClientset()
+	defer emulateAPIServer(ifClient)()
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	restMapper := meta.NewDefaultRESTMapper(nil)
+
+	backend := newFakeHelm(opts.helmLatency)
+	helmClients := &helm.Clients{}
+	helmClients.Add(backend.Version(), backend)
+
+	ifInformerFactory := ifinformers.NewSharedInformerFactory(ifClient, 0)
+	hrInformer := ifInformerFactory.Helm().V1().HelmReleases()
+	tracker := newTracker()
+	hrInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(_, new interface{}) {
+			tracker.observe(new)
+		},
+	})
+
+	// mirrors the rate limiter of the operator
+	rateLimiter := workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(5*time.Millisecond, 1000*time.Second),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(opts.workqueueQPS), opts.workqueueBurst)},
+	)
+	queue := workqueue.NewRateLimitingQueue(rateLimiter)
+
+	rel := release.New(
+		log.With(logger, "component", "release"),
+		helmClients,
+		kubeClient.CoreV1(),
+		ifClient.HelmV1(),
+		dynamicClient,
+		restMapper,
+		nil,
+		release.Config{
+			ChartCache:         cacheDir,
+			DefaultHelmVersion: backend.Version(),
+		},
+		v3.Converter{},
+	)
+	opr := operator.New(log.With(logger, "component", "operator"),
+		false, kubeClient, hrInformer, queue, rel, nil, nil, 0, operator.Shard{}, helmfluxv1.Retry{})
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+	go ifInformerFactory.Start(stop)
+	if ok := cache.WaitForCacheSync(stop, hrInformer.Informer().HasSynced); !ok {
+		return nil, fmt.Errorf("failed to wait for caches to sync")
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		opr.Run(config.workers, stop, &wg)
+	}()
+
+	hrClient := ifClient.HelmV1().HelmReleases(loadNamespace)
+	var results []result
+
+	tracker.reset(config.releases, 1)
+	start := time.Now()
+	for i := 0; i < config.releases; i++ {
+		hr := syntheticHelmRelease(i, opts)
+		tracker.start(hr)
+		if _, err := hrClient.Create(hr); err != nil {
+			return results, fmt.Errorf("failed to create HelmRelease: %w", err)
+		}
+	}
+	res, err := tracker.wait(config, phaseInstall, start, opts.timeout)
+	results = append(results, res)
+	if err != nil || !opts.upgrade {
+		return results, err
+	}
+
+	tracker.reset(config.releases, 2)
+	start = time.Now()
+	for i := 0; i < config.releases; i++ {
+		hr, err := hrClient.Get(fmt.Sprintf("release-%d", i), metav1.GetOptions{})
+		if err != nil {
+			return results, fmt.Errorf("failed to get HelmRelease: %w", err)
+		}
+		hr.Spec.Values = helmfluxv1.HelmValues{Data: map[string]interface{}{"replicas": 2}}
+		tracker.start(hr)
+		if _, err := hrClient.Update(hr); err != nil {
+			return results, fmt.Errorf("failed to update HelmRelease: %w", err)
+		}
+	}
+	res, err = tracker.wait(config, phaseUpgrade, start, opts.timeout)
+	return append(results, res), err
+}
+
+// syntheticHelmRelease returns the i-th synthetic HelmRelease, with
+// one of the charts of the fake chart repository.
+func syntheticHelmRelease(i int, opts options) *helmfluxv1.HelmRelease {
+	return &helmfluxv1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: loadNamespace,
+			Name:      fmt.Sprintf("release-%d", i),
+		},
+		Spec: helmfluxv1.HelmReleaseSpec{
+			HelmVersion: helmfluxv1.HelmV3,
+			ChartSource: helmfluxv1.ChartSource{
+				RepoChartSource: &helmfluxv1.RepoChartSource{
+					RepoURL: opts.repoURL,
+					Name:    chartName(i % opts.charts),
+					Version: chartVersion,
+				},
+			},
+		},
+	}
+}
+
+// tracker records the latency of the HelmReleases of a phase, from
+// the change of a HelmRelease until the operator reports it has been
+// released successfully.
+type tracker struct {
+	mu         sync.Mutex
+	generation int64
+	expected   int
+	pending    map[string]time.Time
+	latencies  []time.Duration
+	done       chan struct{}
+}
+
+func newTracker() *tracker {
+	return &tracker{}
+}
+
+// reset starts tracking a phase in which the given number of
+// HelmReleases are changed to the given generation.
+func (t *tracker) reset(expected int, generation int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.generation = generation
+	t.expected = expected
+	t.pending = make(map[string]time.Time, expected)
+	t.latencies = nil
+	t.done = make(chan struct{})
+}
+
+// start records the change of the given HelmRelease.
+func (t *tracker) start(hr *helmfluxv1.HelmRelease) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending[hr.Namespace+"/"+hr.Name] = time.Now()
+}
+
+// observe records the given HelmRelease as reconciled, once the
+// operator observed its generation and released it successfully.
+func (t *tracker) observe(obj interface{}) {
+	hr, ok := obj.(*helmfluxv1.HelmRelease)
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if hr.Status.Phase != helmfluxv1.HelmReleasePhaseSucceeded || hr.Status.ObservedGeneration < t.generation {
+		return
+	}
+	key := hr.Namespace + "/" + hr.Name
+	start, ok := t.pending[key]
+	if !ok {
+		return
+	}
+	delete(t.pending, key)
+	t.latencies = append(t.latencies, time.Since(start))
+	if len(t.latencies) == t.expected {
+		close(t.done)
+	}
+}
+
+// wait waits until all HelmReleases of the phase are reconciled, or
+// the timeout expires, and returns the measurements.
+func (t *tracker) wait(config configuration, phase string, start time.Time, timeout time.Duration) (result, error) {
+	t.mu.Lock()
+	done := t.done
+	t.mu.Unlock()
+
+	var err error
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		err = fmt.Errorf("timed out after %s waiting for releases to be reconciled", timeout)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	latencies := append([]time.Duration(nil), t.latencies...)
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	res := result{
+		configuration: config,
+		phase:         phase,
+		duration:      time.Since(start),
+		latencies:     latencies,
+	}
+	if err != nil {
+		err = fmt.Errorf("%s of %d releases with %d workers: %w (%d reconciled)",
+			phase, config.releases, config.workers, err, len(latencies))
+	}
+	return res, err
+}
@@ -0,0 +1,359 @@
+/*
+Package admission validates HelmReleases on admission, so that specs
+the operator can not release are rejected when they are created or
+updated, rather than failing every sync.
+*/
+package admission
+
+import (
+	"encoding/hex"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/util/jsonpath"
+
+	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+// Validate returns the errors of the spec of the HelmRelease.
+func Validate(hr *v1.HelmRelease) field.ErrorList {
+	spec := field.NewPath("spec")
+	var errs field.ErrorList
+	errs = append(errs, validateChartSource(hr.Spec.ChartSource, spec.Child("chart"))...)
+	errs = append(errs, validateValuesFrom(hr.Spec.ValuesFrom, spec.Child("valuesFrom"))...)
+	errs = append(errs, validateValuesSchemaFrom(hr.Spec.ValuesSchemaFrom, spec.Child("valuesSchemaFrom"))...)
+	errs = append(errs, validateRollback(hr.Spec.Rollback, spec.Child("rollback"))...)
+	errs = append(errs, validateTest(hr.Spec.Test, spec.Child("test"))...)
+	errs = append(errs, validateRemediation(hr.Spec.Remediation, spec.Child("remediation"))...)
+	errs = append(errs, validatePostBuild(hr.Spec.PostBuild, spec.Child("postBuild"))...)
+	errs = append(errs, validateDecryption(hr.Spec.Decryption, spec.Child("decryption"))...)
+	errs = append(errs, validatePolicyChecks(hr.Spec.PolicyChecks, spec.Child("policyChecks"))...)
+	if hr.Spec.Timeout != nil && *hr.Spec.Timeout < 0 {
+		errs = append(errs, field.Invalid(spec.Child("timeout"), *hr.Spec.Timeout, "must not be negative"))
+	}
+	return errs
+}
+
+// validateChartSource validates that exactly one chart source is set,
+// and that it is complete.
+func validateChartSource(source v1.ChartSource, p *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	var sources []string
+	if git := source.GitChartSource; git != nil && (git.GitURL != "" || git.Path != "") {
+		sources = append(sources, "git")
+		if git.GitURL == "" {
+			errs = append(errs, field.Required(p.Child("git"), "required for a Git chart source"))
+		}
+		if git.Path == "" {
+			errs = append(errs, field.Required(p.Child("path"), "required for a Git chart source"))
+		}
+		if git.Depth < 0 {
+			errs = append(errs, field.Invalid(p.Child("depth"), git.Depth, "must not be negative"))
+		}
+	}
+	if repo := source.RepoChartSource; repo != nil && (repo.RepoURL != "" || repo.Name != "") {
+		sources = append(sources, "repository")
+		if repo.RepoURL == "" {
+			errs = append(errs, field.Required(p.Child("repository"), "required for a Helm repository chart source"))
+		}
+		if repo.Name == "" {
+			errs = append(errs, field.Required(p.Child("name"), "required for a Helm repository chart source"))
+		}
+		if repo.Version == "" {
+			errs = append(errs, field.Required(p.Child("version"), "required for a Helm repository chart source"))
+		} else if !validVersion(repo.Version) {
+			errs = append(errs, field.Invalid(p.Child("version"), repo.Version, "must be a semver version or range"))
+		}
+	}
+	if source.Customize != nil {
+		sources = append(sources, "customize")
+		if source.Customize.Key == "" {
+			errs = append(errs, field.Required(p.Child("customize", "key"), "required for a customize chart source"))
+		}
+	}
+	if source.Oss != nil {
+		sources = append(sources, "oss")
+	}
+	switch len(sources) {
+	case 0:
+		errs = append(errs, field.Required(p, "exactly one of git, repository, customize or oss must be set"))
+	case 1:
+	default:
+		errs = append(errs, field.Forbidden(p, "exactly one chart source must be set, got "+strings.Join(sources, ", ")))
+	}
+	return errs
+}
+
+// validVersion returns if the given chart version is a semver version
+// or range.
+func validVersion(version string) bool {
+	if _, err := semver.NewVersion(version); err == nil {
+		return true
+	}
+	_, err := semver.NewConstraint(version)
+	return err == nil
+}
+
+// validateValuesFrom validates that every values source sets exactly
+// one well-formed reference.
+func validateValuesFrom(sources []v1.ValuesFromSource, p *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	for i, source := range sources {
+		ip := p.Index(i)
+		var refs int
+		if source.ConfigMapKeyRef != nil {
+			refs++
+			if source.ConfigMapKeyRef.Name == "" {
+				errs = append(errs, field.Required(ip.Child("configMapKeyRef", "name"), ""))
+			}
+		}
+		if source.SecretKeyRef != nil {
+			refs++
+			if source.SecretKeyRef.Name == "" {
+				errs = append(errs, field.Required(ip.Child("secretKeyRef", "name"), ""))
+			}
+		}
+		if ref := source.ExternalSourceRef; ref != nil {
+			refs++
+			errs = append(errs, validateExternalSourceRef(ref, ip.Child("externalSourceRef"))...)
+		}
+		if ref := source.ChartFileRef; ref != nil {
+			refs++
+			switch {
+			case ref.Path == "":
+				errs = append(errs, field.Required(ip.Child("chartFileRef", "path"), ""))
+			case path.IsAbs(ref.Path) || strings.HasPrefix(path.Clean(ref.Path), ".."):
+				errs = append(errs, field.Invalid(ip.Child("chartFileRef", "path"), ref.Path, "must be relative to the chart root"))
+			}
+		}
+		if ref := source.ObjectFieldRef; ref != nil {
+			refs++
+			errs = append(errs, validateObjectFieldRef(ref, ip.Child("objectFieldRef"))...)
+		}
+		if ref := source.VaultRef; ref != nil {
+			refs++
+			errs = append(errs, validateVaultRef(ref, ip.Child("vaultRef"))...)
+		}
+		if refs != 1 {
+			errs = append(errs, field.Invalid(ip, refs,
+				"exactly one of configMapKeyRef, secretKeyRef, externalSourceRef, chartFileRef, objectFieldRef or vaultRef must be set"))
+		}
+	}
+	return errs
+}
+
+func validateExternalSourceRef(ref *v1.ExternalSourceSelector, p *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if u, err := url.Parse(ref.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, field.Invalid(p.Child("url"), ref.URL, "must be an absolute HTTP(S) URL"))
+	}
+	if ref.SHA256 != "" {
+		if b, err := hex.DecodeString(ref.SHA256); err != nil || len(b) != 32 {
+			errs = append(errs, field.Invalid(p.Child("sha256"), ref.SHA256, "must be a hex encoded SHA256 checksum"))
+		}
+	}
+	return errs
+}
+
+// validateValuesSchemaFrom validates that the values schema source
+// sets exactly one well-formed reference.
+func validateValuesSchemaFrom(source *v1.ValuesSchemaSource, p *field.Path) field.ErrorList {
+	if source == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	refs := 0
+	if ref := source.ConfigMapKeyRef; ref != nil {
+		refs++
+		if ref.Name == "" {
+			errs = append(errs, field.Required(p.Child("configMapKeyRef", "name"), ""))
+		}
+	}
+	if ref := source.ExternalSourceRef; ref != nil {
+		refs++
+		errs = append(errs, validateExternalSourceRef(ref, p.Child("externalSourceRef"))...)
+	}
+	if refs != 1 {
+		errs = append(errs, field.Invalid(p, refs, "exactly one of configMapKeyRef or externalSourceRef must be set"))
+	}
+	return errs
+}
+
+func validateObjectFieldRef(ref *v1.ObjectFieldSelector, p *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if ref.APIVersion == "" {
+		errs = append(errs, field.Required(p.Child("apiVersion"), ""))
+	}
+	if ref.Kind == "" {
+		errs = append(errs, field.Required(p.Child("kind"), ""))
+	}
+	if ref.Name == "" {
+		errs = append(errs, field.Required(p.Child("name"), ""))
+	}
+	fieldPath := ref.FieldPath
+	if !strings.HasPrefix(fieldPath, "{") {
+		fieldPath = "{" + fieldPath + "}"
+	}
+	switch {
+	case ref.FieldPath == "":
+		errs = append(errs, field.Required(p.Child("fieldPath"), ""))
+	case jsonpath.New("fieldPath").Parse(fieldPath) != nil:
+		errs = append(errs, field.Invalid(p.Child("fieldPath"), ref.FieldPath, "must be a JSONPath expression"))
+	}
+	errs = append(errs, validateTargetPath(ref.TargetPath, p.Child("targetPath"))...)
+	return errs
+}
+
+func validateVaultRef(ref *v1.VaultSelector, p *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if strings.Trim(ref.Path, "/") == "" {
+		errs = append(errs, field.Required(p.Child("path"), ""))
+	}
+	if ref.Version < 0 {
+		errs = append(errs, field.Invalid(p.Child("version"), ref.Version, "must not be negative"))
+	}
+	errs = append(errs, validateTargetPath(ref.TargetPath, p.Child("targetPath"))...)
+	return errs
+}
+
+func validateTargetPath(targetPath string, p *field.Path) field.ErrorList {
+	if targetPath == "" {
+		return nil
+	}
+	for _, k := range strings.Split(targetPath, ".") {
+		if k == "" {
+			return field.ErrorList{field.Invalid(p, targetPath, "must be a dot separated path")}
+		}
+	}
+	return nil
+}
+
+func validateRollback(rollback v1.Rollback, p *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if rollback.Retry && !rollback.Enable {
+		errs = append(errs, field.Forbidden(p.Child("retry"), "upgrades can only be retried after a rollback if rollbacks are enabled"))
+	}
+	if rollback.MaxRetries != nil && *rollback.MaxRetries < 0 {
+		errs = append(errs, field.Invalid(p.Child("maxRetries"), *rollback.MaxRetries, "must not be negative"))
+	}
+	if rollback.Timeout != nil && *rollback.Timeout < 0 {
+		errs = append(errs, field.Invalid(p.Child("timeout"), *rollback.Timeout, "must not be negative"))
+	}
+	return errs
+}
+
+func validateTest(test v1.Test, p *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if test.Timeout != nil && *test.Timeout < 0 {
+		errs = append(errs, field.Invalid(p.Child("timeout"), *test.Timeout, "must not be negative"))
+	}
+	if test.LogTailLines != nil && *test.LogTailLines < 0 {
+		errs = append(errs, field.Invalid(p.Child("logTailLines"), *test.LogTailLines, "must not be negative"))
+	}
+	included := make(map[string]bool, len(test.Filters))
+	excluded := make(map[string]bool, len(test.Filters))
+	for i, f := range test.Filters {
+		name := strings.TrimPrefix(f, "!")
+		switch {
+		case name == "":
+			errs = append(errs, field.Invalid(p.Child("filters").Index(i), f, "must name a test"))
+		case strings.HasPrefix(f, "!"):
+			excluded[name] = true
+		default:
+			included[name] = true
+		}
+		if included[name] && excluded[name] {
+			errs = append(errs, field.Invalid(p.Child("filters").Index(i), f, "test is both included and excluded"))
+		}
+	}
+	return errs
+}
+
+func validateRemediation(remediation *v1.Remediation, p *field.Path) field.ErrorList {
+	if remediation == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	for _, r := range []struct {
+		name   string
+		policy *v1.RemediationPolicy
+	}{{"install", remediation.Install}, {"upgrade", remediation.Upgrade}} {
+		if r.policy == nil {
+			continue
+		}
+		switch r.policy.Strategy {
+		case "", v1.RemediationRollback, v1.RemediationUninstall, v1.RemediationRetain:
+		default:
+			errs = append(errs, field.NotSupported(p.Child(r.name, "strategy"), r.policy.Strategy,
+				[]string{string(v1.RemediationRollback), string(v1.RemediationUninstall), string(v1.RemediationRetain)}))
+		}
+	}
+	return errs
+}
+
+// variableName matches the names of post-build substitution variables.
+var variableName = regexp.MustCompile(`^[_a-zA-Z][_a-zA-Z0-9]*$`)
+
+func validatePostBuild(postBuild *v1.PostBuild, p *field.Path) field.ErrorList {
+	if postBuild == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	for name := range postBuild.Substitute {
+		if !variableName.MatchString(name) {
+			errs = append(errs, field.Invalid(p.Child("substitute").Key(name), name, "must be a valid variable name"))
+		}
+	}
+	for i, ref := range postBuild.SubstituteFrom {
+		ip := p.Child("substituteFrom").Index(i)
+		if ref.Kind != "ConfigMap" && ref.Kind != "Secret" {
+			errs = append(errs, field.NotSupported(ip.Child("kind"), ref.Kind, []string{"ConfigMap", "Secret"}))
+		}
+		if ref.Name == "" {
+			errs = append(errs, field.Required(ip.Child("name"), ""))
+		}
+	}
+	for i, t := range postBuild.Targets {
+		if t != v1.SubstituteValues && t != v1.SubstituteManifests {
+			errs = append(errs, field.NotSupported(p.Child("targets").Index(i), t,
+				[]string{string(v1.SubstituteValues), string(v1.SubstituteManifests)}))
+		}
+	}
+	return errs
+}
+
+func validateDecryption(decryption *v1.Decryption, p *field.Path) field.ErrorList {
+	if decryption == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	if decryption.Provider != v1.DecryptionProviderSOPS {
+		errs = append(errs, field.NotSupported(p.Child("provider"), decryption.Provider, []string{v1.DecryptionProviderSOPS}))
+	}
+	if decryption.SecretRef == nil || decryption.SecretRef.Name == "" {
+		errs = append(errs, field.Required(p.Child("secretRef", "name"), ""))
+	}
+	return errs
+}
+
+func validatePolicyChecks(checks *v1.PolicyChecks, p *field.Path) field.ErrorList {
+	if checks == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	for i, kind := range checks.ForbiddenKinds {
+		if kind == "" {
+			errs = append(errs, field.Required(p.Child("forbiddenKinds").Index(i), ""))
+		}
+	}
+	for i, decision := range checks.OPADecisions {
+		if strings.Trim(decision, "/") == "" {
+			errs = append(errs, field.Required(p.Child("opaDecisions").Index(i), ""))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,80 @@
+package admission
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+func TestValidate(t *testing.T) {
+	repo := v1.ChartSource{RepoChartSource: &v1.RepoChartSource{RepoURL: "https://charts.example.com", Name: "podinfo", Version: "^4.0.0"}}
+	git := v1.ChartSource{GitChartSource: &v1.GitChartSource{GitURL: "git@example.com:charts.git", Path: "charts/podinfo"}}
+	negative := int64(-1)
+
+	for _, tc := range []struct {
+		name   string
+		spec   v1.HelmReleaseSpec
+		fields []string
+	}{
+		{name: "repository chart", spec: v1.HelmReleaseSpec{ChartSource: repo}},
+		{name: "git chart", spec: v1.HelmReleaseSpec{ChartSource: git}},
+		{name: "no chart source", fields: []string{"spec.chart"}},
+		{name: "two chart sources", spec: v1.HelmReleaseSpec{ChartSource: v1.ChartSource{
+			GitChartSource:  git.GitChartSource,
+			RepoChartSource: repo.RepoChartSource,
+		}}, fields: []string{"spec.chart"}},
+		{name: "incomplete repository chart", spec: v1.HelmReleaseSpec{ChartSource: v1.ChartSource{
+			RepoChartSource: &v1.RepoChartSource{Name: "podinfo", Version: "latest"},
+		}}, fields: []string{"spec.chart.repository", "spec.chart.version"}},
+		{name: "values sources", spec: v1.HelmReleaseSpec{ChartSource: repo, ValuesFrom: []v1.ValuesFromSource{
+			{SecretKeyRef: &v1.OptionalSecretKeySelector{SecretKeySelector: v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "values"}}}},
+			{},
+			{ChartFileRef: &v1.ChartFileSelector{Path: "../values.yaml"}},
+			{ExternalSourceRef: &v1.ExternalSourceSelector{URL: "values.yaml", SHA256: "abc"}},
+			{ObjectFieldRef: &v1.ObjectFieldSelector{APIVersion: "v1", Kind: "Service", Name: "db", FieldPath: ".spec.clusterIP", TargetPath: "db.host"}},
+			{ObjectFieldRef: &v1.ObjectFieldSelector{APIVersion: "v1", Kind: "Service", FieldPath: ".spec[", TargetPath: "db..host"}},
+		}}, fields: []string{"spec.valuesFrom[1]", "spec.valuesFrom[2].chartFileRef.path",
+			"spec.valuesFrom[3].externalSourceRef.url", "spec.valuesFrom[3].externalSourceRef.sha256",
+			"spec.valuesFrom[5].objectFieldRef.name", "spec.valuesFrom[5].objectFieldRef.fieldPath",
+			"spec.valuesFrom[5].objectFieldRef.targetPath"}},
+		{name: "retry without rollback", spec: v1.HelmReleaseSpec{ChartSource: repo, Rollback: v1.Rollback{Retry: true, MaxRetries: &negative}},
+			fields: []string{"spec.rollback.retry", "spec.rollback.maxRetries"}},
+		{name: "test filters", spec: v1.HelmReleaseSpec{ChartSource: repo, Test: v1.Test{Enable: true, Filters: []string{"smoke", "!smoke", "!"}}},
+			fields: []string{"spec.test.filters[1]", "spec.test.filters[2]"}},
+		{name: "remediation strategy", spec: v1.HelmReleaseSpec{ChartSource: repo, Remediation: &v1.Remediation{
+			Upgrade: &v1.RemediationPolicy{Strategy: "ignore"},
+		}}, fields: []string{"spec.remediation.upgrade.strategy"}},
+		{name: "negative timeout", spec: v1.HelmReleaseSpec{ChartSource: repo, Timeout: &negative}, fields: []string{"spec.timeout"}},
+		{name: "post-build substitution", spec: v1.HelmReleaseSpec{ChartSource: repo, PostBuild: &v1.PostBuild{
+			Substitute:     map[string]string{"cluster_name": "prod", "cluster-env": "prod"},
+			SubstituteFrom: []v1.SubstituteReference{{Kind: "ConfigMap", Name: "vars"}, {Kind: "Pod"}},
+			Targets:        []v1.SubstituteTarget{v1.SubstituteValues, "hooks"},
+		}}, fields: []string{"spec.postBuild.substitute[cluster-env]", "spec.postBuild.substituteFrom[1].kind",
+			"spec.postBuild.substituteFrom[1].name", "spec.postBuild.targets[1]"}},
+		{name: "vault reference", spec: v1.HelmReleaseSpec{ChartSource: repo, ValuesFrom: []v1.ValuesFromSource{
+			{VaultRef: &v1.VaultSelector{Mount: "kv", Path: "apps/db", TargetPath: "database"}},
+			{VaultRef: &v1.VaultSelector{Path: "/", Version: -1, TargetPath: "database."}},
+		}}, fields: []string{"spec.valuesFrom[1].vaultRef.path", "spec.valuesFrom[1].vaultRef.version",
+			"spec.valuesFrom[1].vaultRef.targetPath"}},
+		{name: "values schema", spec: v1.HelmReleaseSpec{ChartSource: repo, ValuesSchemaFrom: &v1.ValuesSchemaSource{
+			ConfigMapKeyRef:   &v1.ConfigMapKeySelector{},
+			ExternalSourceRef: &v1.ExternalSourceSelector{URL: "schemas.example.com/app.json"},
+		}}, fields: []string{"spec.valuesSchemaFrom.configMapKeyRef.name", "spec.valuesSchemaFrom.externalSourceRef.url",
+			"spec.valuesSchemaFrom"}},
+		{name: "decryption", spec: v1.HelmReleaseSpec{ChartSource: repo, Decryption: &v1.Decryption{Provider: "vault"}},
+			fields: []string{"spec.decryption.provider", "spec.decryption.secretRef.name"}},
+		{name: "policy checks", spec: v1.HelmReleaseSpec{ChartSource: repo, PolicyChecks: &v1.PolicyChecks{
+			ForbiddenKinds: []string{"ClusterRole", ""}, OPADecisions: []string{"/"},
+		}}, fields: []string{"spec.policyChecks.forbiddenKinds[1]", "spec.policyChecks.opaDecisions[0]"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var fields []string
+			for _, err := range Validate(&v1.HelmRelease{Spec: tc.spec}) {
+				fields = append(fields, err.Field)
+			}
+			assert.Equal(t, tc.fields, fields)
+		})
+	}
+}
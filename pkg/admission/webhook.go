@@ -0,0 +1,115 @@
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+// maxReviewSize is the maximum size of an AdmissionReview.
+const maxReviewSize = 3 << 20
+
+// Handler returns the handler of the validating admission webhook of
+// HelmReleases. It accepts the AdmissionReviews of both the v1 and
+// v1beta1 API, which share their schema, and responds with the API
+// version of the request.
+func Handler(logger log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxReviewSize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		var review admissionv1.AdmissionReview
+		if err := json.Unmarshal(body, &review); err != nil || review.Request == nil {
+			http.Error(w, "invalid AdmissionReview", http.StatusBadRequest)
+			return
+		}
+
+		review.Response = respond(logger, review.Request)
+		review.Request = nil
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(review)
+	})
+}
+
+// respond returns the response to the admission request. HelmReleases
+// being deleted are always allowed, so that their finalizers can be
+// removed. Updates are ratcheted against the old object: only errors
+// the old object did not have already are rejected, so that a
+// HelmRelease created before the webhook, or before a validation was
+// added, can still be updated and deleted.
+func respond(logger log.Logger, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	res := &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return res
+	}
+	var hr v1.HelmRelease
+	if err := json.Unmarshal(req.Object.Raw, &hr); err != nil {
+		return decodeFailure(res, err)
+	}
+	if hr.DeletionTimestamp != nil {
+		return res
+	}
+	errs := Validate(&hr)
+	if len(errs) > 0 && req.Operation == admissionv1.Update {
+		var old v1.HelmRelease
+		if err := json.Unmarshal(req.OldObject.Raw, &old); err != nil {
+			return decodeFailure(res, err)
+		}
+		errs = newErrors(errs, Validate(&old))
+	}
+	if len(errs) > 0 {
+		logger.Log("info", "rejected invalid HelmRelease", "namespace", req.Namespace, "name", req.Name, "operation", req.Operation, "err", errs.ToAggregate())
+		res.Allowed = false
+		res.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Reason:  metav1.StatusReasonInvalid,
+			Code:    http.StatusUnprocessableEntity,
+			Message: fmt.Sprintf("HelmRelease '%s' is invalid: %v", hr.Name, errs.ToAggregate()),
+		}
+	}
+	return res
+}
+
+// decodeFailure rejects the admission request with the given error
+// decoding its object.
+func decodeFailure(res *admissionv1.AdmissionResponse, err error) *admissionv1.AdmissionResponse {
+	res.Allowed = false
+	res.Result = &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Reason:  metav1.StatusReasonBadRequest,
+		Code:    http.StatusBadRequest,
+		Message: fmt.Sprintf("failed to decode HelmRelease: %v", err),
+	}
+	return res
+}
+
+// newErrors returns the errors which are not in the old errors. As
+// errors include the invalid value, an invalid field of which the
+// value changed is a new error.
+func newErrors(errs, old field.ErrorList) field.ErrorList {
+	known := make(map[string]bool, len(old))
+	for _, err := range old {
+		known[err.Error()] = true
+	}
+	var result field.ErrorList
+	for _, err := range errs {
+		if !known[err.Error()] {
+			result = append(result, err)
+		}
+	}
+	return result
+}
@@ -0,0 +1,88 @@
+package admission
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestHandler(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		apiVersion string
+		object     string
+		allowed    bool
+	}{
+		{"valid", "admission.k8s.io/v1", `{"spec": {"chart": {"repository": "https://charts.example.com", "name": "podinfo", "version": "4.0.0"}}}`, true},
+		{"invalid", "admission.k8s.io/v1beta1", `{"spec": {"chart": {"name": "podinfo"}}}`, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			body, _ := json.Marshal(admissionv1.AdmissionReview{
+				TypeMeta: metav1.TypeMeta{APIVersion: tc.apiVersion, Kind: "AdmissionReview"},
+				Request: &admissionv1.AdmissionRequest{
+					UID:       "1234",
+					Operation: admissionv1.Create,
+					Object:    runtime.RawExtension{Raw: []byte(tc.object)},
+				},
+			})
+			rec := httptest.NewRecorder()
+			Handler(log.NewNopLogger()).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admission/helmreleases", bytes.NewReader(body)))
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			var review admissionv1.AdmissionReview
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &review))
+			assert.Equal(t, tc.apiVersion, review.APIVersion)
+			if assert.NotNil(t, review.Response) {
+				assert.Equal(t, "1234", string(review.Response.UID))
+				assert.Equal(t, tc.allowed, review.Response.Allowed)
+				assert.Equal(t, tc.allowed, review.Response.Result == nil)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	Handler(log.NewNopLogger()).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admission/helmreleases", bytes.NewReader([]byte("{}"))))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestRespondRatchet(t *testing.T) {
+	const (
+		valid   = `{"spec": {"chart": {"repository": "https://charts.example.com", "name": "podinfo", "version": "4.0.0"}}}`
+		invalid = `{"spec": {"chart": {"repository": "https://charts.example.com", "name": "podinfo", "version": "4.0.0"}, "timeout": -1}}`
+	)
+	for _, tc := range []struct {
+		name      string
+		operation admissionv1.Operation
+		object    string
+		oldObject string
+		allowed   bool
+	}{
+		{"invalid create", admissionv1.Create, invalid, "", false},
+		{"update keeping an existing error", admissionv1.Update, `{"metadata": {"labels": {"app": "podinfo"}}, "spec": {"chart": {"repository": "https://charts.example.com", "name": "podinfo", "version": "4.0.0"}, "timeout": -1}}`, invalid, true},
+		{"update introducing an error", admissionv1.Update, invalid, valid, false},
+		{"update changing an invalid value", admissionv1.Update, `{"spec": {"chart": {"repository": "https://charts.example.com", "name": "podinfo", "version": "4.0.0"}, "timeout": -2}}`, invalid, false},
+		{"update of an object being deleted", admissionv1.Update, `{"metadata": {"deletionTimestamp": "2020-01-01T00:00:00Z"}, "spec": {"chart": {"name": "podinfo"}}}`, invalid, true},
+		{"invalid old object", admissionv1.Update, invalid, `[]`, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := &admissionv1.AdmissionRequest{
+				UID:       "1234",
+				Operation: tc.operation,
+				Object:    runtime.RawExtension{Raw: []byte(tc.object)},
+			}
+			if tc.oldObject != "" {
+				req.OldObject = runtime.RawExtension{Raw: []byte(tc.oldObject)}
+			}
+			res := respond(log.NewNopLogger(), req)
+			assert.Equal(t, tc.allowed, res.Allowed)
+		})
+	}
+}
@@ -0,0 +1,175 @@
+/*
+Package alerting maintains a `PrometheusRule` resource (as defined by
+the Prometheus Operator) with a standard set of alerts for every
+`HelmRelease`, based on the metrics exposed by the operator.
+*/
+package alerting
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/retry"
+
+	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+// ManagedByLabel is set on every generated rule so they can be told
+// apart from rules managed by humans.
+const ManagedByLabel = "helm.fluxcd.io/managed-by"
+
+var prometheusRuleGroupVersionResource = schema.GroupVersionResource{
+	Group:    "monitoring.coreos.com",
+	Version:  "v1",
+	Resource: "prometheusrules",
+}
+
+// Config holds the configuration for the generated alerting rules.
+type Config struct {
+	// NotReadyFor is the duration a release may not be released
+	// before the not ready alert fires.
+	NotReadyFor time.Duration
+	// Labels are added to every generated alert, e.g. to route
+	// them to the right receiver.
+	Labels map[string]string
+}
+
+// WithDefaults sets the default values for the alerting config.
+func (c Config) WithDefaults() Config {
+	if c.NotReadyFor == 0 {
+		c.NotReadyFor = 15 * time.Minute
+	}
+	return c
+}
+
+// Generator creates and updates the `PrometheusRule` for HelmReleases.
+type Generator struct {
+	client dynamic.Interface
+	config Config
+}
+
+// NewGenerator returns a new Generator.
+func NewGenerator(client dynamic.Interface, config Config) *Generator {
+	return &Generator{
+		client: client,
+		config: config.WithDefaults(),
+	}
+}
+
+// Ensure creates or updates the `PrometheusRule` for the given
+// HelmRelease. The rule is owned by the HelmRelease, and is
+// garbage collected by Kubernetes once it is removed. An existing
+// rule is only updated if its spec, labels or owner references
+// differ, so syncs do not bump its resource version.
+func (g *Generator) Ensure(hr *v1.HelmRelease) error {
+	desired := g.rule(hr)
+	client := g.client.Resource(prometheusRuleGroupVersionResource).Namespace(hr.Namespace)
+
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		current, err := client.Get(desired.GetName(), metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			_, err = client.Create(desired, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if upToDate(current, desired) {
+			return nil
+		}
+		desired.SetResourceVersion(current.GetResourceVersion())
+		_, err = client.Update(desired, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// upToDate returns if the current rule has the spec, labels and owner
+// references of the desired rule.
+func upToDate(current, desired *unstructured.Unstructured) bool {
+	return equality.Semantic.DeepEqual(current.Object["spec"], desired.Object["spec"]) &&
+		equality.Semantic.DeepEqual(current.GetLabels(), desired.GetLabels()) &&
+		equality.Semantic.DeepEqual(current.GetOwnerReferences(), desired.GetOwnerReferences())
+}
+
+// RuleName returns the name of the `PrometheusRule` for the given
+// HelmRelease.
+func RuleName(hr *v1.HelmRelease) string {
+	return fmt.Sprintf("%s-helmrelease", hr.Name)
+}
+
+func (g *Generator) rule(hr *v1.HelmRelease) *unstructured.Unstructured {
+	selector := fmt.Sprintf(`target_namespace=%q,release_name=%q`, hr.GetTargetNamespace(), hr.GetReleaseName())
+	alert := func(name, condition, expr, forDuration, summary string) map[string]interface{} {
+		labels := map[string]interface{}{
+			"severity":  "warning",
+			"namespace": hr.Namespace,
+		}
+		for k, v := range g.config.Labels {
+			labels[k] = v
+		}
+		rule := map[string]interface{}{
+			"alert":  name,
+			"expr":   fmt.Sprintf(expr, fmt.Sprintf(`%s,condition=%q`, selector, condition)),
+			"labels": labels,
+			"annotations": map[string]interface{}{
+				"summary": fmt.Sprintf(summary, hr.Namespace, hr.Name),
+			},
+		}
+		if forDuration != "" {
+			rule["for"] = forDuration
+		}
+		return rule
+	}
+
+	rules := []interface{}{
+		alert("HelmReleaseNotReady", string(v1.HelmReleaseReleased),
+			"flux_helm_operator_release_condition_info{%s} < 1", promDuration(g.config.NotReadyFor),
+			"HelmRelease %s/%s has not been released for "+g.config.NotReadyFor.String()+"."),
+		alert("HelmReleaseRolledBack", string(v1.HelmReleaseRolledBack),
+			"flux_helm_operator_release_condition_info{%s} == 1", "",
+			"HelmRelease %s/%s has been rolled back."),
+		alert("HelmReleaseTestFailing", string(v1.HelmReleaseTested),
+			"flux_helm_operator_release_condition_info{%s} == -1", "",
+			"Tests of HelmRelease %s/%s are failing."),
+	}
+
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"groups": []interface{}{
+				map[string]interface{}{
+					"name":  fmt.Sprintf("helmrelease.%s.%s", hr.Namespace, hr.Name),
+					"rules": rules,
+				},
+			},
+		},
+	}}
+	u.SetAPIVersion(prometheusRuleGroupVersionResource.GroupVersion().String())
+	u.SetKind("PrometheusRule")
+	u.SetNamespace(hr.Namespace)
+	u.SetName(RuleName(hr))
+	u.SetLabels(map[string]string{ManagedByLabel: "helm-operator"})
+	controller := true
+	u.SetOwnerReferences([]metav1.OwnerReference{{
+		APIVersion: v1.SchemeGroupVersion.String(),
+		Kind:       "HelmRelease",
+		Name:       hr.Name,
+		UID:        hr.UID,
+		Controller: &controller,
+	}})
+	return u
+}
+
+// promDuration formats the given duration in a format understood by
+// all Prometheus versions, which do not support compound units.
+func promDuration(d time.Duration) string {
+	if d%time.Minute == 0 {
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return fmt.Sprintf("%ds", d/time.Second)
+}
@@ -0,0 +1,38 @@
+package alerting
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+func TestEnsure(t *testing.T) {
+	hr := &v1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "podinfo", UID: "1234"}}
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	g := NewGenerator(client, Config{})
+
+	assert.NoError(t, g.Ensure(hr))
+	assert.NoError(t, g.Ensure(hr))
+	var updates int
+	for _, a := range client.Actions() {
+		if a.GetVerb() == "update" {
+			updates++
+		}
+	}
+	assert.Equal(t, 0, updates)
+
+	// a changed config updates the rule
+	g.config.Labels = map[string]string{"team": "platform"}
+	assert.NoError(t, g.Ensure(hr))
+	for _, a := range client.Actions() {
+		if a.GetVerb() == "update" {
+			updates++
+		}
+	}
+	assert.Equal(t, 1, updates)
+}
@@ -1,7 +1,121 @@
 package api
 
+import (
+	"net/http"
+	"time"
+
+	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
 // Server is the interface that must be satisfied in order to serve
 // HTTP API requests.
 type Server interface {
 	SyncMirrors()
+	ValuesProvenance(namespace, name string) (map[string][]string, error)
+	Receive(provider string, header http.Header, payload []byte) (int, error)
+	ProjectDiff(namespace, name string, mutation SpecMutation) (ProjectedDiff, error)
+	ReleaseState(namespace, name string) (ReleaseState, error)
+	ReleaseManifest(namespace, name string) (string, error)
+	ReleaseHistory(namespace, name string) ([]ReleaseRevision, error)
+	RequestAction(namespace, name string, action ReleaseAction, target RollbackTarget) error
+}
+
+// ReleaseAction is an action requested on demand for a HelmRelease.
+type ReleaseAction string
+
+const (
+	// ReleaseActionSync requests a sync of the HelmRelease.
+	ReleaseActionSync ReleaseAction = "sync"
+	// ReleaseActionRollback requests a rollback of the Helm release
+	// to the RollbackTarget.
+	ReleaseActionRollback ReleaseAction = "rollback"
+	// ReleaseActionTest requests a run of the tests of the Helm
+	// release.
+	ReleaseActionTest ReleaseAction = "test"
+)
+
+// RollbackTarget is the revision a rollback is requested to, the
+// previous revision if it is empty. It is either a Helm revision, or
+// a generation of the HelmRelease, which targets the latest revision
+// released for it.
+type RollbackTarget struct {
+	Revision   int
+	Generation int64
+}
+
+// InvalidActionError is returned for requested actions which can not
+// be run, e.g. a rollback to a generation without a revision.
+type InvalidActionError struct {
+	Reason string
+}
+
+// ReleaseState is the sync state of a HelmRelease.
+type ReleaseState struct {
+	Namespace       string `json:"namespace"`
+	Name            string `json:"name"`
+	ReleaseName     string `json:"releaseName"`
+	TargetNamespace string `json:"targetNamespace"`
+	// Generation is the generation of the spec, which is synced once
+	// it equals the observed generation of the status.
+	Generation int64                `json:"generation"`
+	Suspended  bool                 `json:"suspended"`
+	Status     v1.HelmReleaseStatus `json:"status"`
+}
+
+// ReleaseRevision describes a revision in the history of the Helm
+// release of a HelmRelease.
+type ReleaseRevision struct {
+	Version int `json:"version"`
+	// Generation is the generation of the HelmRelease the revision
+	// was released for, if it is in the history of its status.
+	Generation   int64     `json:"generation,omitempty"`
+	Status       string    `json:"status"`
+	Chart        string    `json:"chart"`
+	ChartVersion string    `json:"chartVersion"`
+	AppVersion   string    `json:"appVersion,omitempty"`
+	Updated      time.Time `json:"updated"`
+	Description  string    `json:"description,omitempty"`
+}
+
+// SpecMutation is a hypothetical change of the spec of a HelmRelease,
+// e.g. a chart version bump, to project the diff of.
+type SpecMutation struct {
+	// ChartVersion replaces the version of a Helm repository chart
+	// source.
+	ChartVersion string `json:"chartVersion,omitempty"`
+	// GitRef replaces the ref of a Git chart source.
+	GitRef string `json:"gitRef,omitempty"`
+	// Values are merged into the inline values.
+	Values map[string]interface{} `json:"values,omitempty"`
+}
+
+// ProjectedDiff is the difference a SpecMutation would make to the
+// Helm release of a HelmRelease.
+type ProjectedDiff struct {
+	// Action is the action a sync would run, `install` or `upgrade`.
+	Action string `json:"action"`
+	// Revision of the chart the diff was rendered with.
+	Revision string `json:"revision"`
+	// ChartVersion is the version of the rendered chart.
+	ChartVersion string `json:"chartVersion,omitempty"`
+	// Changed is true when the release would change.
+	Changed bool `json:"changed"`
+	// Diff is the diff of the manifests of the release, in which the
+	// data of Secrets and the values read from Secrets are redacted.
+	Diff string `json:"diff"`
+}
+
+// InvalidMutationError is returned for SpecMutations which do not
+// apply to the HelmRelease, e.g. a chart version for a Git chart
+// source.
+type InvalidMutationError struct {
+	Reason string
+}
+
+func (err InvalidMutationError) Error() string {
+	return "invalid spec mutation: " + err.Reason
+}
+
+func (err InvalidActionError) Error() string {
+	return "invalid action: " + err.Reason
 }
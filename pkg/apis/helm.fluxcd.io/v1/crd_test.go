@@ -0,0 +1,65 @@
+package v1
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/yaml"
+)
+
+func TestPrinterColumns(t *testing.T) {
+	b, err := ioutil.ReadFile("../../../../chart/helm-operator/crds/helmrelease.yaml")
+	if !assert.NoError(t, err) {
+		return
+	}
+	var crd apiextensionsv1beta1.CustomResourceDefinition
+	if !assert.NoError(t, yaml.Unmarshal(b, &crd)) {
+		return
+	}
+
+	hr := HelmRelease{Status: HelmReleaseStatus{
+		ReleaseName:             "default-podinfo",
+		Phase:                   HelmReleasePhaseSucceeded,
+		ReleaseStatus:           "deployed",
+		Revision:                "3.2.0",
+		LastAppliedChartVersion: "3.2.0",
+		Conditions: []HelmReleaseCondition{
+			{Type: HelmReleaseReady, Status: ConditionTrue},
+			{Type: HelmReleaseReleased, Status: ConditionTrue, Message: "Helm release sync succeeded"},
+		},
+	}}
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&hr)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	expected := map[string]string{
+		"Release":  "default-podinfo",
+		"Phase":    string(HelmReleasePhaseSucceeded),
+		"Status":   "deployed",
+		"Revision": "3.2.0",
+		"Chart":    "3.2.0",
+		"Ready":    string(ConditionTrue),
+		"Message":  "Helm release sync succeeded",
+	}
+	for _, column := range crd.Spec.AdditionalPrinterColumns {
+		want, ok := expected[column.Name]
+		if !ok {
+			continue
+		}
+		delete(expected, column.Name)
+		j := jsonpath.New(column.Name)
+		if !assert.NoError(t, j.Parse("{"+column.JSONPath+"}"), column.Name) {
+			continue
+		}
+		var out bytes.Buffer
+		assert.NoError(t, j.Execute(&out, obj), column.Name)
+		assert.Equal(t, want, out.String(), column.Name)
+	}
+	assert.Empty(t, expected, "missing printer columns")
+}
@@ -17,6 +17,13 @@ import (
 // be a serialised `resource.ID`.
 const AntecedentAnnotation = "helm.fluxcd.io/antecedent"
 
+// ReconcileAtAnnotation is an annotation on a HelmRelease requesting an
+// immediate reconciliation, even if its generation has been synced
+// already. Its value is an arbitrary token, e.g. a timestamp, and
+// changing it requests another reconciliation. The last handled
+// value is recorded in `status.lastHandledReconcileAt`.
+const ReconcileAtAnnotation = "helm.fluxcd.io/reconcileAt"
+
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
@@ -25,7 +32,10 @@ const AntecedentAnnotation = "helm.fluxcd.io/antecedent"
 // +kubebuilder:printcolumn:name="Release",type="string",JSONPath=".status.releaseName",description="Release is the name of the Helm release, as given by Helm."
 // +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase",description="Phase is the current release phase being performed for the HelmRelease."
 // +kubebuilder:printcolumn:name="ReleaseStatus",type="string",JSONPath=".status.releaseStatus",description="ReleaseStatus is the status of the Helm release, as given by Helm."
-// +kubebuilder:printcolumn:name="Message",type="string",JSONPath=".status.conditions[?(@.type==\"Released\")].message",description=""
+// +kubebuilder:printcolumn:name="Revision",type="string",JSONPath=".status.revision",description="Revision is the Git hash or version of the chart currently deployed."
+// +kubebuilder:printcolumn:name="Chart",type="string",JSONPath=".status.lastAppliedChartVersion",description="LastAppliedChartVersion is the version of the chart of the last successful release."
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description="Ready is the status of the Ready condition."
+// +kubebuilder:printcolumn:name="Message",type="string",JSONPath=".status.conditions[?(@.type==\"Released\")].message",description="",priority=1
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="CreationTimestamp is a timestamp representing the server time when this object was created. It is not guaranteed to be set in happens-before order across separate operations. Clients may not set this value. It is represented in RFC3339 form and is in UTC."
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:path=helmreleases,shortName=hr;hrs
@@ -37,7 +47,6 @@ type HelmRelease struct {
 	Status HelmReleaseStatus `json:"status,omitempty"`
 }
 
-
 // GetReleaseName returns the configured release name, or constructs and
 // returns one based on the namespace and name of the HelmRelease.
 // When the HelmRelease's metadata.namespace and spec.targetNamespace
@@ -86,6 +95,15 @@ func (hr HelmRelease) GetHelmVersion(defaultVersion string) string {
 	return string(HelmV2)
 }
 
+// GetServerSideApply returns if the resources of the release are
+// applied server-side, defaulting to the given default.
+func (hr HelmRelease) GetServerSideApply(defaultValue bool) bool {
+	if hr.Spec.ServerSideApply != nil {
+		return *hr.Spec.ServerSideApply
+	}
+	return defaultValue
+}
+
 // GetTimeout returns the install or upgrade timeout (defaults to 300s)
 func (hr HelmRelease) GetTimeout() time.Duration {
 	if hr.Spec.Timeout == nil {
@@ -128,6 +146,15 @@ func (hr HelmRelease) GetWait() bool {
 	}
 }
 
+// GetResyncInterval returns the configured resync interval, or the
+// given default if not set.
+func (hr HelmRelease) GetResyncInterval(defaultInterval time.Duration) time.Duration {
+	if hr.Spec.ResyncInterval == nil {
+		return defaultInterval
+	}
+	return hr.Spec.ResyncInterval.Duration
+}
+
 // GetValuesFromSources maintains backwards compatibility with
 // ValueFileSecrets by merging them into the ValuesFrom array.
 func (hr HelmRelease) GetValuesFromSources() []ValuesFromSource {
@@ -162,6 +189,31 @@ type ChartSource struct {
 	*RepoChartSource `json:",inline"`
 	Oss              *Oss       `json:"oss"`
 	Customize        *Customize `json:"customize"`
+	// OverlaysFrom holds the sources of files which are copied into
+	// the fetched chart before it is rendered, e.g. extra templates or
+	// patched helpers, so small customizations of vendor charts do not
+	// require a fork. Later overlays overwrite the files of earlier
+	// ones.
+	// +optional
+	OverlaysFrom []ChartOverlaySource `json:"overlaysFrom,omitempty"`
+}
+
+// ChartOverlaySource is a source of files copied into a chart. Exactly
+// one of ConfigMapRef and GitPath must be set.
+type ChartOverlaySource struct {
+	// ConfigMapRef references a ConfigMap in the namespace of the
+	// HelmRelease, every key of which is copied as a file into the
+	// target path.
+	// +optional
+	ConfigMapRef *LocalObjectReference `json:"configMapRef,omitempty"`
+	// GitPath is a directory in the Git repository of the Git chart
+	// source, the files below which are copied into the target path.
+	// +optional
+	GitPath string `json:"gitPath,omitempty"`
+	// TargetPath is the directory in the chart the files are copied
+	// into, e.g. `templates`. Defaults to the root of the chart.
+	// +optional
+	TargetPath string `json:"targetPath,omitempty"`
 }
 
 type Oss struct {
@@ -169,14 +221,97 @@ type Oss struct {
 	RegionId      string `json:"regionId"`
 	AckId         string `json:"ackId"`
 	AckSecret     string `json:"ackSecret"`
-	Bucket        string `json:"bucket"`
-	Key           string `json:"key"`
-	AckEncrypted  bool   `json:"ackEncrypted"`
-	UseCache      bool   `json:"useCache"`
+	// SecretRef holds the name of a Secret in the namespace of the
+	// HelmRelease holding the `ackId` and `ackSecret` to access the
+	// object storage with, instead of the inline credentials. The
+	// Secret may hold a `securityToken` for temporary credentials;
+	// it is read for every download, so it can be rotated.
+	// +optional
+	SecretRef *LocalObjectReference `json:"secretRef,omitempty"`
+	// CredentialSource is where the credentials to access the object
+	// storage with are obtained from. Defaults to `static`. The
+	// `instanceProfile` and `workloadIdentity` sources use the
+	// credentials of the operator, and must be enabled for the
+	// namespace of the HelmRelease in the operator.
+	// +kubebuilder:validation:Enum="static";"instanceProfile";"workloadIdentity"
+	// +optional
+	CredentialSource OssCredentialSource `json:"credentialSource,omitempty"`
+	// RoleName is the name of the RAM role attached to the instance
+	// for the `instanceProfile` credential source on Alibaba Cloud.
+	// Defaults to the role attached to the instance.
+	// +optional
+	RoleName string `json:"roleName,omitempty"`
+	// RoleArn is the ARN of the RAM role to assume for the
+	// `workloadIdentity` credential source. Defaults to the role
+	// configured for the service account of the operator.
+	// +optional
+	RoleArn string `json:"roleArn,omitempty"`
+	// CustomEndpoint overrides the endpoint of the object storage for
+	// the region, e.g. for a private endpoint. It is either a host,
+	// or a URL with a scheme.
+	// +optional
+	CustomEndpoint string `json:"customEndpoint,omitempty"`
+	// UseHTTPS connects to the endpoint over HTTPS. It is ignored for
+	// custom endpoints with a scheme.
+	// +optional
+	UseHTTPS bool `json:"useHTTPS,omitempty"`
+	// Internal uses the internal endpoint of the region, to download
+	// from within the VPC of the cloud provider. Huawei Cloud serves
+	// internal access on the regular endpoint.
+	// +optional
+	Internal bool   `json:"internal,omitempty"`
+	Bucket   string `json:"bucket"`
+	Key      string `json:"key"`
+	// ValuesKey is the key of a values file in the bucket, which is
+	// merged before the values of the valuesFrom sources. Its content
+	// contributes to the revision of the release, so changes to it
+	// are released like changes to the chart. With UseCache, the cached
+	// file is revalidated against the ETag or Last-Modified of the
+	// object on every sync.
+	// +optional
+	ValuesKey string `json:"valuesKey,omitempty"`
+	// Checksum is the expected digest of the chart archive, in the
+	// form `sha256:<hex>` or `md5:<hex>`. Cached charts which do not
+	// match it are downloaded again.
+	// +optional
+	Checksum string `json:"checksum,omitempty"`
+	// AckEncrypted marks the credentials as AES encrypted, with the
+	// key from DecryptionKeyRef or the key configured in the operator.
+	AckEncrypted bool `json:"ackEncrypted"`
+	// DecryptionKeyRef references the Secret key holding the AES key
+	// to decrypt the credentials of this release with. The Secret
+	// must be in the namespace of the HelmRelease. The key defaults
+	// to `key`.
+	// +optional
+	DecryptionKeyRef *SecretKeySelector `json:"decryptionKeyRef,omitempty"`
+	UseCache         bool               `json:"useCache"`
 }
 
+// OssCredentialSource is where the credentials for an object storage
+// are obtained from.
+type OssCredentialSource string
+
+const (
+	// OssCredentialsStatic uses the credentials given inline or in the
+	// referenced Secret.
+	OssCredentialsStatic OssCredentialSource = "static"
+	// OssCredentialsInstanceProfile uses the temporary credentials of
+	// the role attached to the cloud instance, from the instance
+	// metadata service.
+	OssCredentialsInstanceProfile OssCredentialSource = "instanceProfile"
+	// OssCredentialsWorkloadIdentity exchanges the OIDC token of the
+	// service account of the operator for temporary credentials of a
+	// role, i.e. RRSA on Alibaba Cloud.
+	OssCredentialsWorkloadIdentity OssCredentialSource = "workloadIdentity"
+)
+
 type Customize struct {
-	Key      string `json:"key"`
+	Key string `json:"key"`
+	// Checksum is the expected digest of the chart archive, in the
+	// form `sha256:<hex>` or `md5:<hex>`. Cached charts which do not
+	// match it are downloaded again.
+	// +optional
+	Checksum string `json:"checksum,omitempty"`
 	UseCache bool   `json:"useCache"`
 }
 
@@ -195,17 +330,61 @@ type GitChartSource struct {
 	// +kubebuilder:validation:Optional
 	Path string `json:"path"`
 	// SecretRef holds the authentication secret for accessing the Git
-	// repository (over HTTPS). The credentials will be added to an
-	// HTTPS GitURL before the mirror is started.
+	// repository, in the namespace of the HelmRelease unless given;
+	// other namespaces require cross-namespace references to be
+	// allowed in the operator. For HTTPS, it holds a `username` and `password`, or a `token`;
+	// the credentials are added to the GitURL before the mirror is
+	// started. For SSH, it holds the private key as `identity`, and
+	// optionally the `known_hosts` of the Git server.
 	// +optional
 	SecretRef *ObjectReference `json:"secretRef,omitempty"`
+	// CredentialSource is where the credentials for accessing the Git
+	// repository are obtained from. Defaults to `secret`, using the
+	// SecretRef if given. `codeup` and `codehub` exchange the OIDC
+	// token of the service account of the operator for short-lived
+	// HTTPS credentials of Alibaba Cloud Codeup or Huawei Cloud
+	// CodeHub, which are refreshed before they expire. These are only
+	// obtained if the operator allows them for the namespace of the
+	// HelmRelease, for the Git hosts allowed by the operator, and the
+	// repository is cloned for every release instead of mirrored.
+	// +kubebuilder:validation:Enum="secret";"codeup";"codehub"
+	// +optional
+	CredentialSource GitCredentialSource `json:"credentialSource,omitempty"`
 	// SkipDepUpdate will tell the operator to skip running
 	// 'helm dep update' before installing or upgrading the chart, the
 	// chart dependencies _must_ be present for this to succeed.
 	// +optional
 	SkipDepUpdate bool `json:"skipDepUpdate,omitempty"`
+	// Depth limits the history cloned from the Git repository to the
+	// given number of commits; the full history is cloned if 0.
+	// +optional
+	Depth int `json:"depth,omitempty"`
+	// Submodules tells the operator to check out the submodules of the
+	// Git repository.
+	// +optional
+	Submodules bool `json:"submodules,omitempty"`
+	// SparseCheckout tells the operator to only check out the path to
+	// the chart, instead of the whole working tree of the repository.
+	// +optional
+	SparseCheckout bool `json:"sparseCheckout,omitempty"`
 }
 
+// GitCredentialSource is where the credentials for a Git repository
+// are obtained from.
+type GitCredentialSource string
+
+const (
+	// GitCredentialsSecret uses the credentials held by the Secret
+	// referenced by the chart source.
+	GitCredentialsSecret GitCredentialSource = "secret"
+	// GitCredentialsCodeup uses short-lived credentials of Alibaba
+	// Cloud Codeup, for the RRSA OIDC token of the service account.
+	GitCredentialsCodeup GitCredentialSource = "codeup"
+	// GitCredentialsCodeHub uses short-lived credentials of Huawei
+	// Cloud CodeHub, for the OIDC token of the service account.
+	GitCredentialsCodeHub GitCredentialSource = "codehub"
+)
+
 // RefOrDefault returns the configured ref of the chart source. If the chart source
 // does not specify a ref, the provided default is used instead.
 func (s GitChartSource) RefOrDefault(defaultGitRef string) string {
@@ -227,12 +406,15 @@ type RepoChartSource struct {
 	// redis (for `helm upgrade [flags] stable/redis`).
 	// +kubebuilder:validation:Optional
 	Name string `json:"name"`
-	// Version is the targeted Helm chart version, e.g. 7.0.1.
+	// Version is the targeted Helm chart version, e.g. 7.0.1, or a
+	// semver range, e.g. ^7.0.0, which is resolved to the latest
+	// matching version in the repository on every sync.
 	// +kubebuilder:validation:Optional
 	Version string `json:"version"`
-	// ChartPullSecret holds the reference to the authentication secret for accessing
-	// the Helm repository using HTTPS basic auth.
-	// NOT IMPLEMENTED!
+	// ChartPullSecret holds the reference to a Secret in the namespace
+	// of the HelmRelease with the credentials for the Helm repository;
+	// a `username` and `password` for HTTPS basic auth, and/or a
+	// `certFile`, `keyFile` and `caFile` for TLS.
 	// +kubebuilder:validation:Optional
 	// +optional
 	ChartPullSecret *LocalObjectReference `json:"chartPullSecret,omitempty"`
@@ -263,6 +445,97 @@ type ValuesFromSource struct {
 	// The reference to a local chart file with release values.
 	// +optional
 	ChartFileRef *ChartFileSelector `json:"chartFileRef,omitempty"`
+	// The reference to a field of an object in the cluster with
+	// release values.
+	// +optional
+	ObjectFieldRef *ObjectFieldSelector `json:"objectFieldRef,omitempty"`
+	// The reference to a secret in Vault with release values.
+	// +optional
+	VaultRef *VaultSelector `json:"vaultRef,omitempty"`
+}
+
+type VaultSelector struct {
+	// Mount is the mount path of the KV version 2 secrets engine,
+	// defaults to `secret`.
+	// +optional
+	Mount string `json:"mount,omitempty"`
+	// Path is the path of the secret in the secrets engine.
+	Path string `json:"path"`
+	// Version is the version of the secret, defaults to the latest.
+	// +optional
+	Version int `json:"version,omitempty"`
+	// Key is the key of the secret holding the values in YAML. If not
+	// set, the keys and values of the secret are the values.
+	// +optional
+	Key string `json:"key,omitempty"`
+	// TargetPath is the dot separated path in the values the values of
+	// the secret are set at, e.g. `database.credentials`. If not set,
+	// these are merged into the values.
+	// +optional
+	TargetPath string `json:"targetPath,omitempty"`
+	// Role is the role of the Kubernetes auth method to log in to
+	// Vault with, defaults to the role configured in the operator.
+	// +optional
+	Role string `json:"role,omitempty"`
+	// ServiceAccountName is the name of the service account in the
+	// namespace of the HelmRelease of which a token is used to log in
+	// to Vault, defaults to `default`; other service accounts must be
+	// allowed by the operator.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// Optional will mark this VaultSelector as optional.
+	// The result of this are that operations are permitted without
+	// the source, due to it e.g. being temporarily unavailable.
+	// +optional
+	Optional *bool `json:"optional,omitempty"`
+}
+
+// GetMount returns the mount path of the secrets engine, defaulting
+// to `secret`.
+func (s VaultSelector) GetMount() string {
+	if s.Mount == "" {
+		return "secret"
+	}
+	return s.Mount
+}
+
+// GetServiceAccountName returns the name of the service account to log
+// in with, defaulting to `default`.
+func (s VaultSelector) GetServiceAccountName() string {
+	if s.ServiceAccountName == "" {
+		return "default"
+	}
+	return s.ServiceAccountName
+}
+
+type ObjectFieldSelector struct {
+	// APIVersion is the API version of the object, e.g. v1.
+	APIVersion string `json:"apiVersion"`
+	// Kind is the kind of the object, e.g. Service.
+	Kind string `json:"kind"`
+	// Name is the name of the object.
+	Name string `json:"name"`
+	// Namespace is the namespace of the object, defaults to the
+	// namespace of the HelmRelease. Objects in other namespaces, and
+	// cluster scoped objects, may only be referenced if cross-namespace
+	// values are enabled.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// FieldPath is the JSONPath expression selecting a single field
+	// of the object, e.g. `.spec.clusterIP` or
+	// `.data.config\.json`.
+	FieldPath string `json:"fieldPath"`
+	// TargetPath is the dot separated path in the values the field is
+	// set at, e.g. `service.ip`. If not set, the field must hold a
+	// map, or a string with YAML or JSON, which is merged into the
+	// values.
+	// +optional
+	TargetPath string `json:"targetPath,omitempty"`
+	// Optional will mark this ObjectFieldSelector as optional.
+	// The result of this are that operations are permitted without
+	// the source, due to it e.g. being temporarily unavailable.
+	// +optional
+	Optional *bool `json:"optional,omitempty"`
 }
 
 type ChartFileSelector struct {
@@ -278,6 +551,15 @@ type ChartFileSelector struct {
 type ExternalSourceSelector struct {
 	// URL is the URL of the external source.
 	URL string `json:"url"`
+	// SHA256 is the expected hex encoded SHA256 checksum of the
+	// values retrieved from the URL.
+	// +optional
+	SHA256 string `json:"sha256,omitempty"`
+	// SecretRef holds the local name reference to a secret with the
+	// credentials for the URL; either a `username` and `password`
+	// for basic auth, or a `token` for bearer auth.
+	// +optional
+	SecretRef *LocalObjectReference `json:"secretRef,omitempty"`
 	// Optional will mark this ExternalSourceSelector as optional.
 	// The result of this are that operations are permitted without
 	// the source, due to it e.g. being temporarily unavailable.
@@ -285,6 +567,18 @@ type ExternalSourceSelector struct {
 	Optional *bool `json:"optional,omitempty"`
 }
 
+// ValuesSchemaSource references a JSON schema, which may also be
+// written in YAML. Exactly one of the references must be set.
+type ValuesSchemaSource struct {
+	// The reference to a config map with the schema, in the key
+	// `values.schema.json` if no key is set.
+	// +optional
+	ConfigMapKeyRef *ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+	// The reference to an external source with the schema.
+	// +optional
+	ExternalSourceRef *ExternalSourceSelector `json:"externalSourceRef,omitempty"`
+}
+
 type Rollback struct {
 	// Enable will mark this Helm release for rollbacks.
 	// +optional
@@ -339,6 +633,167 @@ func (r Rollback) GetMaxRetries() int64 {
 	return *r.MaxRetries
 }
 
+// MissingResourcesPolicy is the policy for resources of a release
+// which have been deleted from the cluster.
+type MissingResourcesPolicy string
+
+const (
+	// MissingResourcesIgnore does not verify the inventory.
+	MissingResourcesIgnore MissingResourcesPolicy = "ignore"
+	// MissingResourcesReport sets the ResourcesMissing condition.
+	MissingResourcesReport MissingResourcesPolicy = "report"
+	// MissingResourcesRecreate upgrades the release to recreate the
+	// missing resources.
+	MissingResourcesRecreate MissingResourcesPolicy = "recreate"
+)
+
+// RemediationStrategy is the strategy for remediating a failed
+// install or upgrade of a Helm release.
+type RemediationStrategy string
+
+const (
+	// RemediationRollback rolls back a failed upgrade to the previous
+	// release; failed installs are uninstalled as there is nothing to
+	// roll back to.
+	RemediationRollback RemediationStrategy = "rollback"
+	// RemediationUninstall uninstalls the failed release.
+	RemediationUninstall RemediationStrategy = "uninstall"
+	// RemediationRetain retains the failed release as is.
+	RemediationRetain RemediationStrategy = "retain"
+)
+
+// Remediation holds the settings for remediating failed installs and
+// upgrades of a Helm release. Failed tests count as failures of the
+// install or upgrade they test.
+type Remediation struct {
+	// Install is the remediation of failed installs, by default they
+	// are uninstalled.
+	// +optional
+	Install *RemediationPolicy `json:"install,omitempty"`
+	// Upgrade is the remediation of failed upgrades, by default they
+	// are rolled back if rollbacks are enabled, and retained if not.
+	// +optional
+	Upgrade *RemediationPolicy `json:"upgrade,omitempty"`
+}
+
+// RemediationPolicy holds the settings for remediating a failed
+// install or upgrade.
+type RemediationPolicy struct {
+	// Strategy is the remediation of the failure, one of 'rollback',
+	// 'uninstall' or 'retain'.
+	// +optional
+	Strategy RemediationStrategy `json:"strategy,omitempty"`
+	// RemediateLastFailure remediates the failure after which the
+	// retries of the HelmRelease are exhausted as well; by default the
+	// last failed release is retained for inspection. Failed installs
+	// and upgrades count against the retries of failed syncs.
+	// +optional
+	RemediateLastFailure bool `json:"remediateLastFailure,omitempty"`
+}
+
+// ShouldRemediate returns if the failure should be remediated, given
+// if it exhausted the retries of the HelmRelease.
+func (p RemediationPolicy) ShouldRemediate(exhausted bool) bool {
+	return p.Strategy != RemediationRetain && (!exhausted || p.RemediateLastFailure)
+}
+
+// GetInstallRemediation returns the remediation of failed installs,
+// defaulting to an uninstall.
+func (hr HelmRelease) GetInstallRemediation() RemediationPolicy {
+	var p RemediationPolicy
+	if hr.Spec.Remediation != nil && hr.Spec.Remediation.Install != nil {
+		p = *hr.Spec.Remediation.Install
+	}
+	if p.Strategy == "" || p.Strategy == RemediationRollback {
+		p.Strategy = RemediationUninstall
+	}
+	return p
+}
+
+// GetUpgradeRemediation returns the remediation of failed upgrades,
+// defaulting to a rollback if rollbacks are enabled, and retaining the
+// release if not.
+func (hr HelmRelease) GetUpgradeRemediation() RemediationPolicy {
+	var p RemediationPolicy
+	if hr.Spec.Remediation != nil && hr.Spec.Remediation.Upgrade != nil {
+		p = *hr.Spec.Remediation.Upgrade
+	}
+	if p.Strategy == "" {
+		p.Strategy = RemediationRetain
+		if hr.Spec.Rollback.Enable {
+			p.Strategy = RemediationRollback
+		}
+	}
+	return p
+}
+
+// Retry holds the settings for retrying failed syncs of a Helm
+// release. Failed syncs are retried with an exponential backoff until
+// the retries are exhausted, after which the HelmRelease is not synced
+// again until it changes.
+type Retry struct {
+	// MaxRetries is the amount of retries of consecutive failed syncs
+	// of a generation of the HelmRelease; a negative value retries
+	// forever.
+	// +optional
+	MaxRetries *int64 `json:"maxRetries,omitempty"`
+	// BaseDelay is the delay before the first retry, which doubles
+	// with every consecutive failure.
+	// +optional
+	BaseDelay *metav1.Duration `json:"baseDelay,omitempty"`
+	// MaxDelay is the maximum delay between retries.
+	// +optional
+	MaxDelay *metav1.Duration `json:"maxDelay,omitempty"`
+}
+
+// GetRetry returns the retry settings of the HelmRelease, with the
+// given defaults for settings which are not supplied.
+func (hr HelmRelease) GetRetry(defaults Retry) Retry {
+	if hr.Spec.Retry == nil {
+		return defaults
+	}
+	r := *hr.Spec.Retry
+	if r.MaxRetries == nil {
+		r.MaxRetries = defaults.MaxRetries
+	}
+	if r.BaseDelay == nil {
+		r.BaseDelay = defaults.BaseDelay
+	}
+	if r.MaxDelay == nil {
+		r.MaxDelay = defaults.MaxDelay
+	}
+	return r
+}
+
+// Exhausted returns if no retries are left after the given amount
+// of consecutive failures.
+func (r Retry) Exhausted(failures int64) bool {
+	if r.MaxRetries == nil || *r.MaxRetries < 0 {
+		return false
+	}
+	return failures > *r.MaxRetries
+}
+
+// Delay returns the delay before the retry of the given amount of
+// consecutive failures.
+func (r Retry) Delay(failures int64) time.Duration {
+	var base, max time.Duration
+	if r.BaseDelay != nil {
+		base = r.BaseDelay.Duration
+	}
+	if r.MaxDelay != nil {
+		max = r.MaxDelay.Duration
+	}
+	delay := base
+	for i := int64(1); i < failures && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
 type Test struct {
 	// Enable will mark this Helm release for tests.
 	// +optional
@@ -355,6 +810,16 @@ type Test struct {
 	// test pods between each test run initiated by the Helm Operator.
 	// +optional
 	Cleanup *bool `json:"cleanup,omitempty"`
+	// Filters limits the tests run to the tests with the given names;
+	// names prefixed with `!` are excluded instead. All tests are run
+	// if not supplied.
+	// +optional
+	Filters []string `json:"filters,omitempty"`
+	// LogTailLines is the amount of trailing log lines of failed test
+	// pods which are recorded in an Event and the status. Defaults to
+	// 20, 0 disables recording logs.
+	// +optional
+	LogTailLines *int64 `json:"logTailLines,omitempty"`
 }
 
 // IgnoreFailures returns the configured ignoreFailures flag,
@@ -377,6 +842,24 @@ func (t Test) GetTimeout() time.Duration {
 	return time.Duration(*t.Timeout) * time.Second
 }
 
+// GetLogTailLines returns the configured amount of recorded log
+// lines of failed test pods, or the default of 20.
+func (t Test) GetLogTailLines() int64 {
+	if t.LogTailLines == nil {
+		return 20
+	}
+	return *t.LogTailLines
+}
+
+// TestLog holds the trailing logs of a failed test pod.
+type TestLog struct {
+	// Name of the test pod.
+	Name string `json:"name"`
+	// Log holds the trailing log lines of the test pod.
+	// +optional
+	Log string `json:"log,omitempty"`
+}
+
 // GetCleanup returns the configured test cleanup flag, or the
 // default of true.
 func (t Test) GetCleanup() bool {
@@ -388,6 +871,367 @@ func (t Test) GetCleanup() bool {
 	}
 }
 
+// LintSeverity is the severity of a finding of the chart linter.
+type LintSeverity string
+
+const (
+	LintSeverityInfo    LintSeverity = "info"
+	LintSeverityWarning LintSeverity = "warning"
+	LintSeverityError   LintSeverity = "error"
+)
+
+type Lint struct {
+	// Enable runs the chart linter against the chart and the composed
+	// values before every install or upgrade of this Helm release.
+	// +optional
+	Enable bool `json:"enable,omitempty"`
+	// Severity is the minimum severity of the findings recorded in
+	// the status. Defaults to `warning`.
+	// +kubebuilder:validation:Enum="info";"warning";"error"
+	// +optional
+	Severity LintSeverity `json:"severity,omitempty"`
+	// FailOn is the minimum severity of the findings which fail the
+	// release, e.g. `error`. If not set, findings are only recorded.
+	// +kubebuilder:validation:Enum="info";"warning";"error"
+	// +optional
+	FailOn LintSeverity `json:"failOn,omitempty"`
+}
+
+// GetSeverity returns the configured minimum severity of recorded
+// findings, or the default of `warning`.
+func (l Lint) GetSeverity() LintSeverity {
+	if l.Severity == "" {
+		return LintSeverityWarning
+	}
+	return l.Severity
+}
+
+// LintFinding is a finding of the chart linter.
+type LintFinding struct {
+	// Severity of the finding, one of ('info', 'warning', 'error').
+	Severity LintSeverity `json:"severity"`
+	// Path is the file of the chart the finding is about.
+	// +optional
+	Path string `json:"path,omitempty"`
+	// Message describes the finding.
+	Message string `json:"message"`
+}
+
+// PolicyChecks holds the built-in rules and OPA decisions the rendered
+// manifests of a release are checked against.
+type PolicyChecks struct {
+	// DisallowLatestTag rejects containers with images which are
+	// tagged `latest`, or have neither a tag nor a digest.
+	// +optional
+	DisallowLatestTag bool `json:"disallowLatestTag,omitempty"`
+	// RequireResourceLimits rejects containers without CPU and memory
+	// limits.
+	// +optional
+	RequireResourceLimits bool `json:"requireResourceLimits,omitempty"`
+	// ForbiddenKinds are the kinds of resources the release may not
+	// hold, e.g. `ClusterRoleBinding`.
+	// +optional
+	ForbiddenKinds []string `json:"forbiddenKinds,omitempty"`
+	// OPADecisions are the paths of the decisions, e.g. `helm/deny`,
+	// of the Rego policies in the OPA server configured in the
+	// operator, the manifests are evaluated with.
+	// +optional
+	OPADecisions []string `json:"opaDecisions,omitempty"`
+}
+
+// PolicyViolation is a violation of a policy by the rendered manifests
+// of a release.
+type PolicyViolation struct {
+	// Policy is the violated policy, i.e. the built-in rule or the OPA
+	// decision.
+	Policy string `json:"policy"`
+	// Object is the resource violating the policy, if any.
+	// +optional
+	Object string `json:"object,omitempty"`
+	// Message describes the violation.
+	Message string `json:"message"`
+}
+
+// DeletionPropagation is the policy with which the resources of a
+// Helm release are deleted.
+type DeletionPropagation string
+
+const (
+	DeletionPropagationBackground DeletionPropagation = "background"
+	DeletionPropagationForeground DeletionPropagation = "foreground"
+	DeletionPropagationOrphan     DeletionPropagation = "orphan"
+)
+
+type Uninstall struct {
+	// KeepHistory keeps the release history after the uninstall, the
+	// release is then marked as uninstalled instead of being removed.
+	// +optional
+	KeepHistory bool `json:"keepHistory,omitempty"`
+	// DisableHooks prevents the hooks of the chart from running on
+	// uninstall.
+	// +optional
+	DisableHooks bool `json:"disableHooks,omitempty"`
+	// DeletionPropagation is the policy with which the resources of
+	// the release are deleted. Defaults to `background`.
+	// +kubebuilder:validation:Enum="background";"foreground";"orphan"
+	// +optional
+	DeletionPropagation DeletionPropagation `json:"deletionPropagation,omitempty"`
+	// Timeout is the time to wait for any individual Kubernetes
+	// operation (like Jobs for hooks) during uninstall. Defaults to
+	// the timeout of the Helm release.
+	// +optional
+	Timeout *int64 `json:"timeout,omitempty"`
+}
+
+// GetTimeout returns the configured uninstall timeout, or the given
+// timeout of the Helm release.
+func (u Uninstall) GetTimeout(releaseTimeout time.Duration) time.Duration {
+	if u.Timeout == nil {
+		return releaseTimeout
+	}
+	return time.Duration(*u.Timeout) * time.Second
+}
+
+// PostRenderer is a single post-render step, applied to the manifests
+// rendered by Helm before they are sent to the cluster. A step can set
+// multiple transformations, these are applied in the order labels,
+// annotations, images, patches.
+type PostRenderer struct {
+	// Labels are added to the metadata of all rendered resources,
+	// overwriting existing labels with the same key.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations are added to the metadata of all rendered resources,
+	// overwriting existing annotations with the same key.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Images overrides the name, tag or digest of container images
+	// in the pod templates of rendered resources.
+	// +optional
+	Images []ImageOverride `json:"images,omitempty"`
+	// Patches are JSON 6902 patches applied to the rendered resources
+	// matching their target.
+	// +optional
+	Patches []JSON6902Patch `json:"patches,omitempty"`
+}
+
+// InjectionMode is the mode in which the built-in post-renderer
+// injects the app manager labels and annotations, and the Istio
+// injection labels, into the rendered manifests.
+type InjectionMode string
+
+const (
+	// InjectionAlways injects into the manifests on every install and
+	// upgrade.
+	InjectionAlways InjectionMode = "always"
+	// InjectionOnInstall injects into objects when they are created;
+	// upgrades keep the injected values of the objects in the current
+	// release, rather than mutating them.
+	InjectionOnInstall InjectionMode = "onInstall"
+	// InjectionNever does not inject into the manifests.
+	InjectionNever InjectionMode = "never"
+)
+
+// Injection holds the settings for the injection of the built-in
+// post-renderer.
+type Injection struct {
+	// Mode is the mode in which is injected, defaults to `always`.
+	// +kubebuilder:validation:Enum="always";"onInstall";"never"
+	// +optional
+	Mode InjectionMode `json:"mode,omitempty"`
+}
+
+// GetMode returns the injection mode, defaulting to `always`.
+func (i *Injection) GetMode() InjectionMode {
+	if i == nil || i.Mode == "" {
+		return InjectionAlways
+	}
+	return i.Mode
+}
+
+// SubstituteTarget is a target of the post-build variable
+// substitution.
+type SubstituteTarget string
+
+const (
+	// SubstituteValues substitutes the variables in the string values
+	// of the composed values.
+	SubstituteValues SubstituteTarget = "values"
+	// SubstituteManifests substitutes the variables in the rendered
+	// manifests, after all other post-renderers but image pinning.
+	SubstituteManifests SubstituteTarget = "manifests"
+)
+
+// PostBuild holds the substitution of `${var}` variables, mirroring the
+// `postBuild` of a Flux Kustomization. A variable with a default, as in
+// `${var:=default}`, is replaced with the default if it is not set;
+// other variables which are not set, and variables escaped as
+// `$${var}`, are left as is.
+type PostBuild struct {
+	// Substitute holds the variables by name; these take precedence
+	// over the variables of SubstituteFrom.
+	// +optional
+	Substitute map[string]string `json:"substitute,omitempty"`
+	// SubstituteFrom holds references to ConfigMaps and Secrets in the
+	// namespace of the HelmRelease of which the keys and values are
+	// the variables; later references take precedence over earlier
+	// ones.
+	// +optional
+	SubstituteFrom []SubstituteReference `json:"substituteFrom,omitempty"`
+	// Targets are what the variables are substituted in, defaults to
+	// both the `values` and the `manifests`.
+	// +optional
+	Targets []SubstituteTarget `json:"targets,omitempty"`
+}
+
+// Substitutes returns if the variables are substituted in the given
+// target.
+func (p *PostBuild) Substitutes(target SubstituteTarget) bool {
+	if p == nil {
+		return false
+	}
+	if len(p.Targets) == 0 {
+		return true
+	}
+	for _, t := range p.Targets {
+		if t == target {
+			return true
+		}
+	}
+	return false
+}
+
+// SubstituteReference refers to a ConfigMap or Secret with variables.
+type SubstituteReference struct {
+	// Kind is the kind of the object, `ConfigMap` or `Secret`.
+	// +kubebuilder:validation:Enum="ConfigMap";"Secret"
+	Kind string `json:"kind"`
+	// Name is the name of the object.
+	Name string `json:"name"`
+	// Optional will mark this SubstituteReference as optional.
+	// The result of this are that operations are permitted without
+	// the object.
+	// +optional
+	Optional bool `json:"optional,omitempty"`
+}
+
+// Kustomize holds the kustomize patches and image overrides applied to
+// the rendered manifests, mirroring the respective fields of a
+// `kustomization.yaml`.
+type Kustomize struct {
+	// PatchesStrategicMerge are strategic merge patches, in YAML or
+	// JSON, applied to the rendered resources matching the apiVersion,
+	// kind, name and (optional) namespace of the patch. Resources of
+	// kinds unknown to the operator are patched using a JSON merge
+	// patch.
+	// +optional
+	PatchesStrategicMerge []string `json:"patchesStrategicMerge,omitempty"`
+	// PatchesJSON6902 are JSON 6902 patches applied to the rendered
+	// resources matching their target.
+	// +optional
+	PatchesJSON6902 []JSON6902Patch `json:"patchesJson6902,omitempty"`
+	// Images overrides the name, tag or digest of container images
+	// in the pod templates of rendered resources.
+	// +optional
+	Images []ImageOverride `json:"images,omitempty"`
+}
+
+// ImageOverride replaces the name, tag or digest of a container image.
+type ImageOverride struct {
+	// Name is the image name to match, without a tag or digest,
+	// e.g. `nginx` or `docker.io/library/nginx`.
+	Name string `json:"name"`
+	// NewName replaces the name of the image.
+	// +optional
+	NewName string `json:"newName,omitempty"`
+	// NewTag replaces the tag of the image.
+	// +optional
+	NewTag string `json:"newTag,omitempty"`
+	// Digest replaces the tag of the image with a digest, and takes
+	// precedence over NewTag.
+	// +optional
+	Digest string `json:"digest,omitempty"`
+}
+
+// PatchTarget selects the rendered resources a patch is applied to.
+// Fields which are left empty match any resource.
+type PatchTarget struct {
+	// +optional
+	Group string `json:"group,omitempty"`
+	// +optional
+	Version string `json:"version,omitempty"`
+	// +optional
+	Kind string `json:"kind,omitempty"`
+	// +optional
+	Name string `json:"name,omitempty"`
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// JSON6902Patch is a JSON 6902 patch applied to the rendered
+// resources matching the target.
+type JSON6902Patch struct {
+	// Target selects the resources to patch.
+	Target PatchTarget `json:"target"`
+	// Patch is the list of JSON 6902 operations, in YAML or JSON.
+	Patch string `json:"patch"`
+}
+
+// ImageUpdatePolicy configures the automated update of the tag of an
+// image in the values of a HelmRelease, to the latest tag in the
+// registry selected by the policy.
+type ImageUpdatePolicy struct {
+	// Image is the repository of the image to scan for tags, e.g.
+	// `registry.example.com/team/app`.
+	Image string `json:"image"`
+	// Path is the dot separated path of the value holding the tag of
+	// the image, e.g. `image.tag`.
+	Path string `json:"path"`
+	// SemVer is the semver range the tags must satisfy, the highest
+	// version is selected.
+	// +optional
+	SemVer string `json:"semver,omitempty"`
+	// Regex is the regular expression the tags must match. Without a
+	// SemVer range, the alphabetically last matching tag is selected.
+	// +optional
+	Regex string `json:"regex,omitempty"`
+	// SecretRef holds the local name reference to a Docker config
+	// Secret with the credentials for the registry.
+	// +optional
+	SecretRef *LocalObjectReference `json:"secretRef,omitempty"`
+	// ValuesSecretRef refers to a key of a Secret in the namespace of
+	// the HelmRelease holding YAML values, which is updated instead of
+	// the inline values. The Secret should be listed in `valuesFrom`.
+	// It is required for HelmReleases applied from Git.
+	// +optional
+	ValuesSecretRef *SecretKeySelector `json:"valuesSecretRef,omitempty"`
+}
+
+// ImageUpdateStatus is the state of the automated update of an image
+// by an image update policy.
+type ImageUpdateStatus struct {
+	// Image is the repository of the image of the policy.
+	Image string `json:"image"`
+	// Path is the path of the value holding the tag of the image.
+	Path string `json:"path"`
+	// LatestTag is the latest tag selected by the policy in the last
+	// successful scan of the registry.
+	// +optional
+	LatestTag string `json:"latestTag,omitempty"`
+	// LastScanTime is the last time a scan of the registry for the
+	// tags of the image changed the latest tag, the error or the time
+	// of the last update.
+	// +optional
+	LastScanTime *metav1.Time `json:"lastScanTime,omitempty"`
+	// LastUpdateTime is the last time the tag in the values was
+	// updated to the latest tag.
+	// +optional
+	LastUpdateTime *metav1.Time `json:"lastUpdateTime,omitempty"`
+	// Message holds the error of the last scan, if it failed.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
 // HelmVersion is the version of Helm to target. If not supplied,
 // the lowest _enabled Helm version_ will be targeted.
 // Valid HelmVersion values are:
@@ -402,6 +1246,19 @@ const (
 	HelmV3 HelmVersion = "v3"
 )
 
+// ImagePinning is the mode in which container images are pinned.
+// Valid ImagePinning values are:
+// "digest"
+// +kubebuilder:validation:Enum="digest"
+// +optional
+type ImagePinning string
+
+const (
+	// ImagePinningDigest resolves the tags of the images to digests
+	// by querying the registry, so that upgrades are reproducible.
+	ImagePinningDigest ImagePinning = "digest"
+)
+
 type HelmValues struct {
 	// Data holds the configuration keys and values.
 	// Work around for https://github.com/kubernetes-sigs/kubebuilder/issues/528
@@ -463,6 +1320,11 @@ type HelmReleaseSpec struct {
 	// DEPRECATED, use ValuesFrom.secretKeyRef instead.
 	ValueFileSecrets []LocalObjectReference `json:"valueFileSecrets,omitempty"`
 	ValuesFrom       []ValuesFromSource     `json:"valuesFrom,omitempty"`
+	// ValuesSchemaFrom holds the reference to a JSON schema the
+	// composed values are validated against before an installation or
+	// upgrade, in addition to the `values.schema.json` of the chart.
+	// +optional
+	ValuesSchemaFrom *ValuesSchemaSource `json:"valuesSchemaFrom,omitempty"`
 	// TargetNamespace overrides the targeted namespace for the Helm
 	// release. The default namespace equals to the namespace of the
 	// HelmRelease resource.
@@ -493,18 +1355,247 @@ type HelmReleaseSpec struct {
 	// forces the resource updates through delete/recreate if needed.
 	// +optional
 	ForceUpgrade bool `json:"forceUpgrade,omitempty"`
+	// Atomic will mark this Helm release to `--atomic` installs and
+	// upgrades; Helm then uninstalls a failed install, or rolls back
+	// a failed upgrade, itself. It implies Wait.
+	// +optional
+	Atomic bool `json:"atomic,omitempty"`
+	// CleanupOnFail will mark this Helm release to delete the new
+	// resources created by a failed upgrade.
+	// +optional
+	CleanupOnFail bool `json:"cleanupOnFail,omitempty"`
+	// WaitForJobs will mark this Helm release to wait until all Jobs
+	// have completed, in addition to the resources waited for by Wait,
+	// before marking the release as successful. It only has an effect
+	// if Wait is enabled.
+	// +optional
+	WaitForJobs bool `json:"waitForJobs,omitempty"`
+	// DisableHooks will mark this Helm release to not run the hooks
+	// of the chart on installs and upgrades.
+	// +optional
+	DisableHooks bool `json:"disableHooks,omitempty"`
+	// SubNotes will mark this Helm release to render the notes of the
+	// subcharts, in addition to the notes of the chart.
+	// +optional
+	SubNotes bool `json:"subNotes,omitempty"`
+	// ServerSideApply will mark this Helm release to create and update
+	// its resources with server-side apply, owned by the field manager
+	// of the operator. Fields owned by other field managers are only
+	// taken over if ForceUpgrade is set. Defaults to the server-side
+	// apply setting of the operator.
+	// +optional
+	ServerSideApply *bool `json:"serverSideApply,omitempty"`
 	// The rollback settings for this Helm release.
 	// +optional
 	Rollback Rollback `json:"rollback,omitempty"`
+	// Remediation holds the settings for remediating failed installs
+	// and upgrades of this Helm release.
+	// +optional
+	Remediation *Remediation `json:"remediation,omitempty"`
 	// The test settings for this Helm release.
 	// +optional
 	Test Test `json:"test,omitempty"`
+	// The lint settings for this Helm release.
+	// +optional
+	Lint Lint `json:"lint,omitempty"`
+	// PolicyChecks holds the policies the rendered manifests of this
+	// Helm release are checked against after post-rendering, together
+	// with its hooks and the CRDs of its chart; releases violating
+	// them are blocked.
+	// +optional
+	PolicyChecks *PolicyChecks `json:"policyChecks,omitempty"`
+	// The uninstall settings for this Helm release, applied when the
+	// HelmRelease is deleted or the release is uninstalled to
+	// remediate a failure.
+	// +optional
+	Uninstall Uninstall `json:"uninstall,omitempty"`
 	// Values holds the values for this Helm release.
 	// +optional
 	Values HelmValues `json:"values,omitempty"`
+	// SetValues holds values set at dotted paths, like the `--set` and
+	// `--set-string` flags of Helm, applied after all other values.
+	// +optional
+	SetValues []SetValue `json:"setValues,omitempty"`
 	// DisableOpenAPIValidation controls whether OpenAPI validation is enforced.
 	// +optional
 	DisableOpenAPIValidation bool `json:"disableOpenAPIValidation,omitempty"`
+	// SkipDryRunCompare will mark this Helm release to skip the
+	// dry-run comparison with the current release, which means it is
+	// only upgraded when the chart or the HelmRelease changes and
+	// mutations to the release are not detected.
+	// +optional
+	SkipDryRunCompare bool `json:"skipDryRunCompare,omitempty"`
+	// MissingResources is the policy for resources of the release
+	// which have been deleted from the cluster, detected using the
+	// inventory of the release whenever the HelmRelease is synced:
+	// `recreate` upgrades the release to recreate them, subject to the
+	// approval of upgrades, `report` sets the ResourcesMissing
+	// condition listing them. Defaults to `ignore`.
+	// +kubebuilder:validation:Enum="ignore";"report";"recreate"
+	// +optional
+	MissingResources MissingResourcesPolicy `json:"missingResources,omitempty"`
+	// Prune deletes the resources in the inventory of the release which
+	// are no longer part of it after an upgrade or rollback, and have
+	// been left behind by Helm. Resources which were not part of the
+	// previous release, are no longer annotated as belonging to this
+	// HelmRelease, are kept by their Helm resource policy, or are
+	// annotated with `helm.fluxcd.io/prune: skip` are never pruned.
+	// +optional
+	Prune bool `json:"prune,omitempty"`
+	// ResyncInterval is the interval at which the HelmRelease is
+	// reconciled, regardless of any changes, to detect and revert
+	// mutations of the release resources in the cluster. If not
+	// supplied, the default resync interval of the operator is used.
+	// +optional
+	ResyncInterval *metav1.Duration `json:"resyncInterval,omitempty"`
+	// Retry holds the settings for retrying failed syncs of this Helm
+	// release. If not supplied, the defaults of the operator are used.
+	// +optional
+	Retry *Retry `json:"retry,omitempty"`
+	// PostRenderers holds the post-render steps applied, in order, to
+	// the rendered manifests of this Helm release.
+	// +optional
+	PostRenderers []PostRenderer `json:"postRenderers,omitempty"`
+	// Kustomize holds the kustomize patches applied to the rendered
+	// manifests of this Helm release, before any PostRenderers.
+	// +optional
+	Kustomize *Kustomize `json:"kustomize,omitempty"`
+	// Injection controls when the built-in post-renderer injects the
+	// app manager and Istio labels into the rendered manifests.
+	// +optional
+	Injection *Injection `json:"injection,omitempty"`
+	// ImagePinning sets the mode in which the container images of the
+	// rendered manifests are pinned, after all other post-renderers
+	// have run.
+	// +optional
+	ImagePinning ImagePinning `json:"imagePinning,omitempty"`
+	// Suspend pauses the reconciliation of this Helm release when set
+	// to true; the release itself is left untouched.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+	// ImageUpdates holds the policies for the automated update of image
+	// tags in the values of this Helm release. Tags are updated in the
+	// inline values of the HelmRelease unless a policy has a
+	// `valuesSecretRef`; this is unsupported for HelmReleases applied
+	// from Git, as the updates are reverted with every apply.
+	// +optional
+	ImageUpdates []ImageUpdatePolicy `json:"imageUpdates,omitempty"`
+	// DependsOn holds references to HelmReleases which must have been
+	// released successfully before this Helm release is installed or
+	// upgraded. The namespace defaults to the namespace of this
+	// HelmRelease.
+	// +optional
+	DependsOn []ObjectReference `json:"dependsOn,omitempty"`
+	// Verify enables the verification of the chart before it is
+	// installed or upgraded: charts from Helm repositories are verified
+	// against their provenance file, charts from OCI registries against
+	// their cosign signature.
+	// +optional
+	Verify *ChartVerification `json:"verify,omitempty"`
+	// KubeConfig refers to the kubeconfig of a remote cluster the Helm
+	// release is made to, instead of the cluster of the operator; this
+	// must be allowed by the operator.
+	// +optional
+	KubeConfig *KubeConfig `json:"kubeConfig,omitempty"`
+	// PostBuild holds the variable substitution applied to the composed
+	// values and the rendered manifests of this Helm release.
+	// +optional
+	PostBuild *PostBuild `json:"postBuild,omitempty"`
+	// Decryption holds the keys to decrypt the encrypted valuesFrom
+	// sources of this Helm release with.
+	// +optional
+	Decryption *Decryption `json:"decryption,omitempty"`
+}
+
+// DecryptionProviderSOPS decrypts documents encrypted with SOPS.
+const DecryptionProviderSOPS = "sops"
+
+// Decryption holds the keys to decrypt encrypted values with. The
+// valuesFrom sources encrypted with SOPS, for age or PGP keys, are
+// decrypted before they are merged; other sources are used as is.
+type Decryption struct {
+	// Provider is the decryption provider, only `sops` is supported.
+	// +kubebuilder:validation:Enum="sops"
+	Provider string `json:"provider"`
+	// SecretRef holds the local name reference to the Secret with the
+	// private keys, in the namespace of the HelmRelease; age
+	// identities in keys ending with `.agekey`, and armored PGP
+	// private keys without a passphrase in keys ending with `.asc`.
+	// +kubebuilder:validation:Required
+	SecretRef *LocalObjectReference `json:"secretRef"`
+}
+
+// DefaultKubeConfigKey is the key of the kubeconfig in the Secret of a
+// KubeConfig if no key is given.
+const DefaultKubeConfigKey = "value"
+
+// KubeConfig refers to the kubeconfig of the cluster a Helm release is
+// made to. Helm, the ownership check and the annotations target the
+// remote cluster; live drift detection, inventory verification,
+// capacity and platform checks, image pinning and the recreation of
+// workloads for Istio injection, which look at the cluster of the
+// operator, are skipped for remote releases.
+type KubeConfig struct {
+	// SecretRef holds the local name reference to the Secret with the
+	// kubeconfig, in the namespace of the HelmRelease.
+	// +kubebuilder:validation:Required
+	SecretRef *LocalObjectReference `json:"secretRef"`
+	// Key is the key of the kubeconfig in the Secret; it defaults to
+	// `value`.
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// GetKey returns the key of the kubeconfig in the Secret.
+func (k KubeConfig) GetKey() string {
+	if k.Key == "" {
+		return DefaultKubeConfigKey
+	}
+	return k.Key
+}
+
+// SetValueType is the type a value set at a path is coerced into.
+type SetValueType string
+
+const (
+	// SetValueAuto coerces values like the `--set` flag of Helm, i.e.
+	// into booleans, integers and lists where they match.
+	SetValueAuto SetValueType = "auto"
+	// SetValueString keeps values as strings, like the `--set-string`
+	// flag of Helm.
+	SetValueString SetValueType = "string"
+)
+
+// SetValue is a value set at a path of the values of a Helm release.
+type SetValue struct {
+	// Path is the dotted path of the value, i.e. `image.tag` or
+	// `ingress.hosts[0]`.
+	Path string `json:"path"`
+	// Value is the value set at the path, it is parsed like the value
+	// of the `--set` flag of Helm, so commas must be escaped.
+	Value string `json:"value"`
+	// Type is the type the value is coerced into; one of `auto`, the
+	// default, and `string`.
+	// +kubebuilder:validation:Enum="auto";"string"
+	// +optional
+	Type SetValueType `json:"type,omitempty"`
+}
+
+// ChartVerification holds the keyring the provenance of a chart is
+// verified against, and the public key its cosign signature is
+// verified against.
+type ChartVerification struct {
+	// KeyringRef refers to a key of a Secret in the namespace of the
+	// HelmRelease holding the public keyring, the key defaults to
+	// `pubring.gpg`. Defaults to the keyring configured in the operator.
+	// +optional
+	KeyringRef *SecretKeySelector `json:"keyringRef,omitempty"`
+	// CosignKeyRef refers to a key of a Secret in the namespace of the
+	// HelmRelease holding the PEM encoded cosign public key, the key
+	// defaults to `cosign.pub`. Defaults to the cosign public key
+	// configured in the operator.
+	// +optional
+	CosignKeyRef *SecretKeySelector `json:"cosignKeyRef,omitempty"`
 }
 
 // HelmReleaseConditionType represents an HelmRelease condition value.
@@ -514,7 +1605,17 @@ type HelmReleaseSpec struct {
 // "Released",
 // "RolledBack"
 // "Tested",
-// +kubebuilder:validation:Enum="ChartFetched";"Deployed";"Released";"RolledBack";"Tested"
+// "Suspended",
+// "DependencyNotReady",
+// "PostRenderFailed",
+// "Reconciling",
+// "FrozenPendingChanges",
+// "Halted",
+// "ResourcesMissing",
+// "Ready",
+// "TestSuccess",
+// "Remediated"
+// +kubebuilder:validation:Enum="ChartFetched";"Deployed";"Released";"RolledBack";"Tested";"Suspended";"DependencyNotReady";"PostRenderFailed";"Reconciling";"FrozenPendingChanges";"Halted";"ResourcesMissing";"Ready";"TestSuccess";"Remediated"
 // +optional
 type HelmReleaseConditionType string
 
@@ -534,10 +1635,90 @@ const (
 	// Tested means the chart to which the HelmRelease refers has
 	// been successfully tested.
 	HelmReleaseTested HelmReleaseConditionType = "Tested"
+	// Suspended means the reconciliation of the HelmRelease has been
+	// suspended.
+	HelmReleaseSuspended HelmReleaseConditionType = "Suspended"
+	// DependencyNotReady means one of the HelmReleases the
+	// HelmRelease depends on has not been released successfully.
+	HelmReleaseDependencyNotReady HelmReleaseConditionType = "DependencyNotReady"
+	// PostRenderFailed means the built-in post-renderer failed to
+	// mutate the rendered manifests during the last render.
+	HelmReleasePostRenderFailed HelmReleaseConditionType = "PostRenderFailed"
+	// Reconciling is false when the last sync of the HelmRelease has
+	// been skipped, with the reason it has been skipped for.
+	HelmReleaseReconciling HelmReleaseConditionType = "Reconciling"
+	// FrozenPendingChanges means changes to the release are held
+	// during a release freeze.
+	HelmReleaseFrozenPendingChanges HelmReleaseConditionType = "FrozenPendingChanges"
+	// Halted means mutating Helm actions of the release are held
+	// while the operator is halted.
+	HelmReleaseHalted HelmReleaseConditionType = "Halted"
+	// ResourcesMissing means resources of the release have been
+	// deleted from the cluster.
+	HelmReleaseResourcesMissing HelmReleaseConditionType = "ResourcesMissing"
+
+	// The following conditions are derived from the phase and the
+	// conditions above whenever the status is updated, following the
+	// conventions of the standard Kubernetes conditions so tooling
+	// like kstatus can consume them.
+
+	// Ready means the last release of the HelmRelease succeeded; it
+	// is unknown while a release is in progress.
+	HelmReleaseReady HelmReleaseConditionType = "Ready"
+	// TestSuccess means the Helm tests of the last release passed.
+	HelmReleaseTestSuccess HelmReleaseConditionType = "TestSuccess"
+	// Remediated means a failed release has been remediated by a
+	// rollback.
+	HelmReleaseRemediated HelmReleaseConditionType = "Remediated"
+)
+
+// Reason codes set on the conditions and Events of a HelmRelease when
+// a release fails, so that automation can branch on the type of
+// failure. Other failures have the phase as reason.
+const (
+	// ReasonChartPullBackOff means the chart could not be fetched.
+	ReasonChartPullBackOff = "ChartPullBackOff"
+	// ReasonValuesRenderError means the values could not be composed,
+	// or the chart could not be rendered with them.
+	ReasonValuesRenderError = "ValuesRenderError"
+	// ReasonHelmInstallFailed means the Helm installation failed.
+	ReasonHelmInstallFailed = "HelmInstallFailed"
+	// ReasonHelmUpgradeFailed means the Helm upgrade failed, or the
+	// state of the release does not allow an upgrade.
+	ReasonHelmUpgradeFailed = "HelmUpgradeFailed"
+	// ReasonTestFailed means the Helm tests of the release failed.
+	ReasonTestFailed = "TestFailed"
+	// ReasonMigrationRequired means a Helm v2 release exists which
+	// needs to be migrated to Helm v3 first.
+	ReasonMigrationRequired = "MigrationRequired"
+	// ReasonOwnershipConflict means the release is managed by another
+	// HelmRelease.
+	ReasonOwnershipConflict = "OwnershipConflict"
+	// ReasonChartVerificationFailed means the provenance of the chart
+	// could not be verified.
+	ReasonChartVerificationFailed = "ChartVerificationFailed"
+	// ReasonValuesValidationFailed means the composed values do not
+	// meet the JSON schema of the chart or the HelmRelease.
+	ReasonValuesValidationFailed = "ValuesValidationFailed"
+	// ReasonPolicyViolation means the rendered manifests violate the
+	// policies checked for the release.
+	ReasonPolicyViolation = "PolicyViolation"
+	// ReasonChartLintFailed means the chart linter reported findings
+	// of the severity configured to fail the release.
+	ReasonChartLintFailed = "ChartLintFailed"
+	// ReasonSyncPanicked means the operator recovered from a panic
+	// while syncing the HelmRelease.
+	ReasonSyncPanicked = "SyncPanicked"
+	// ReasonUpgradeDenied means the approval webhook denied the
+	// upgrade of the release.
+	ReasonUpgradeDenied = "UpgradeDenied"
+	// ReasonInlineValuesTooLarge means the inline values exceed the
+	// size the operator is configured to release.
+	ReasonInlineValuesTooLarge = "InlineValuesTooLarge"
 )
 
 type HelmReleaseCondition struct {
-	// Type of the condition, one of ('ChartFetched', 'Deployed', 'Released', 'RolledBack', 'Tested').
+	// Type of the condition, one of ('ChartFetched', 'Deployed', 'Released', 'RolledBack', 'Tested', 'Suspended', 'DependencyNotReady', 'PostRenderFailed', 'Reconciling', 'FrozenPendingChanges', 'Halted', 'Ready', 'TestSuccess', 'Remediated').
 	Type HelmReleaseConditionType `json:"type"`
 
 	// Status of the condition, one of ('True', 'False', 'Unknown').
@@ -562,6 +1743,11 @@ type HelmReleaseCondition struct {
 	// transition, complementing reason.
 	// +optional
 	Message string `json:"message,omitempty"`
+
+	// ObservedGeneration is the generation of the HelmRelease the
+	// condition was set for.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 }
 
 // HelmReleasePhase represents the phase a HelmRelease is in.
@@ -580,7 +1766,9 @@ type HelmReleaseCondition struct {
 // "RollingBack",
 // "RolledBack",
 // "RollbackFailed",
-// +kubebuilder:validation:Enum="ChartFetched";"ChartFetchFailed";"Installing";"Upgrading";"Deployed";"DeployFailed";"Testing";"TestFailed";"Tested";"Succeeded";"Failed";"RollingBack";"RolledBack";"RollbackFailed"
+// "ChartVerificationFailed",
+// "ValuesValidationFailed",
+// +kubebuilder:validation:Enum="ChartFetched";"ChartFetchFailed";"Installing";"Upgrading";"Deployed";"DeployFailed";"Testing";"TestFailed";"Tested";"Succeeded";"Failed";"RollingBack";"RolledBack";"RollbackFailed";"ChartVerificationFailed";"ValuesValidationFailed"
 // +optional
 type HelmReleasePhase string
 
@@ -625,8 +1813,101 @@ const (
 	HelmReleasePhaseRolledBack HelmReleasePhase = "RolledBack"
 	// RolledBackFailed means the rollback for the HelmRelease failed.
 	HelmReleasePhaseRollbackFailed HelmReleasePhase = "RollbackFailed"
+
+	// ChartVerificationFailed means the provenance of the chart to
+	// which the HelmRelease refers could not be verified.
+	HelmReleasePhaseChartVerificationFailed HelmReleasePhase = "ChartVerificationFailed"
+
+	// ValuesValidationFailed means the composed values of the
+	// HelmRelease do not meet the JSON schema of the chart or the
+	// HelmRelease.
+	HelmReleasePhaseValuesValidationFailed HelmReleasePhase = "ValuesValidationFailed"
 )
 
+// ExternalizedValues references a Secret holding a copy of inline
+// values which have been externalized by the operator.
+type ExternalizedValues struct {
+	// SecretName is the name of the Secret, in the namespace of the
+	// HelmRelease, holding the values.
+	SecretName string `json:"secretName"`
+	// SHA256 is the hex encoded SHA256 checksum of the values.
+	SHA256 string `json:"sha256"`
+}
+
+// ReleaseDiff holds a summary of a difference detected between the
+// Helm release and the desired state of the HelmRelease.
+type ReleaseDiff struct {
+	// Time the difference was detected.
+	Time metav1.Time `json:"time"`
+	// Revision of the chart the release was compared with.
+	// +optional
+	Revision string `json:"revision,omitempty"`
+	// Summary of the difference.
+	Summary string `json:"summary"`
+	// Truncated is true when the summary has been truncated.
+	// +optional
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// ResourceRef references a resource of a Helm release.
+type ResourceRef struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// Namespace of the resource, empty for cluster scoped resources
+	// and resources in the target namespace.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// ReleasePreview describes the changes a sync of a HelmRelease in
+// dry-run mode would have applied.
+type ReleasePreview struct {
+	// Time the preview was rendered.
+	Time metav1.Time `json:"time"`
+	// Revision of the chart the preview was rendered with.
+	// +optional
+	Revision string `json:"revision,omitempty"`
+	// Action is the action the sync would have run, `install` or
+	// `upgrade`.
+	Action string `json:"action"`
+	// Changed is true when the sync would have changed the release.
+	Changed bool `json:"changed"`
+	// ConfigMapName is the name of the ConfigMap in the namespace of
+	// the HelmRelease holding the diff and the rendered manifest.
+	ConfigMapName string `json:"configMapName"`
+}
+
+// ReleaseHistoryEntry links a revision of the Helm release to the
+// generation of the HelmRelease it was released for.
+type ReleaseHistoryEntry struct {
+	// Generation of the HelmRelease the revision was released for.
+	Generation int64 `json:"generation"`
+	// Version of the Helm release, i.e. the Helm revision.
+	Version int `json:"version"`
+	// ChartVersion is the version of the chart of the revision.
+	// +optional
+	ChartVersion string `json:"chartVersion,omitempty"`
+	// Time the revision was released.
+	Time metav1.Time `json:"time"`
+}
+
+// GitCommit describes a commit of a Git chart source.
+type GitCommit struct {
+	// Revision is the hash of the commit.
+	Revision string `json:"revision"`
+	// Author is the name and email address of the author of the
+	// commit.
+	// +optional
+	Author string `json:"author,omitempty"`
+	// Time the commit was authored.
+	// +optional
+	Time metav1.Time `json:"time,omitempty"`
+	// Subject is the first line of the commit message.
+	// +optional
+	Subject string `json:"subject,omitempty"`
+}
+
 // HelmReleaseStatus contains status information about an HelmRelease.
 type HelmReleaseStatus struct {
 	// ObservedGeneration is the most recent generation observed by
@@ -637,7 +1918,8 @@ type HelmReleaseStatus struct {
 	// Phase the release is in, one of ('ChartFetched',
 	// 'ChartFetchFailed', 'Installing', 'Upgrading', 'Deployed',
 	// 'DeployFailed', 'Testing', 'TestFailed', 'Tested', 'Succeeded',
-	// 'RollingBack', 'RolledBack', 'RollbackFailed')
+	// 'RollingBack', 'RolledBack', 'RollbackFailed',
+	// 'ChartVerificationFailed', 'ValuesValidationFailed')
 	// +optional
 	Phase HelmReleasePhase `json:"phase,omitempty"`
 
@@ -660,12 +1942,95 @@ type HelmReleaseStatus struct {
 	// +optional
 	LastAttemptedRevision string `json:"lastAttemptedRevision,omitempty"`
 
+	// ChartCommit describes the latest commit changing the chart of
+	// the Git chart source, as of the latest chart sync.
+	// +optional
+	ChartCommit *GitCommit `json:"chartCommit,omitempty"`
+
 	// RollbackCount records the amount of rollback attempts made,
 	// it is incremented after a rollback failure and reset after a
 	// successful upgrade or revision change.
 	// +optional
 	RollbackCount int64 `json:"rollbackCount,omitempty"`
 
+	// History links the successful revisions of the Helm release to
+	// the generations of the HelmRelease they were released for, the
+	// latest last. It holds at most as many entries as the release
+	// keeps revisions.
+	// +optional
+	History []ReleaseHistoryEntry `json:"history,omitempty"`
+
+	// Images holds the container images run by the workloads of the
+	// release, as rendered by the last release attempt.
+	// +optional
+	Images []string `json:"images,omitempty"`
+
+	// ImageUpdates holds the state of the image update policies, in
+	// the order of the policies.
+	// +optional
+	ImageUpdates []ImageUpdateStatus `json:"imageUpdates,omitempty"`
+
+	// Inventory holds the resources of the release, as applied by the
+	// last successful release.
+	// +optional
+	Inventory []ResourceRef `json:"inventory,omitempty"`
+
+	// TestLogs holds the trailing logs of the test pods which failed
+	// in the last test run.
+	// +optional
+	TestLogs []TestLog `json:"testLogs,omitempty"`
+
+	// LintFindings holds the findings of the chart linter for the
+	// last release attempt, of at least the configured severity.
+	// +optional
+	LintFindings []LintFinding `json:"lintFindings,omitempty"`
+
+	// PolicyViolations holds the violations of the policies by the
+	// rendered manifests of the last release attempt.
+	// +optional
+	PolicyViolations []PolicyViolation `json:"policyViolations,omitempty"`
+
+	// LastDiff holds a summary of the last difference detected while
+	// comparing the release, only recorded when diffs are logged.
+	// +optional
+	LastDiff *ReleaseDiff `json:"lastDiff,omitempty"`
+
+	// Preview describes the changes the last sync in dry-run mode
+	// would have applied.
+	// +optional
+	Preview *ReleasePreview `json:"preview,omitempty"`
+
+	// ChartVersion is the chart version the version range of the
+	// chart source resolved to during the last sync.
+	// +optional
+	ChartVersion string `json:"chartVersion,omitempty"`
+
+	// LastAppliedChartVersion is the version of the chart of the last
+	// successful release.
+	// +optional
+	LastAppliedChartVersion string `json:"lastAppliedChartVersion,omitempty"`
+
+	// Notes holds the rendered NOTES.txt of the chart of the last
+	// successful release, e.g. with instructions to connect to the
+	// application. Long notes are truncated.
+	// +optional
+	Notes string `json:"notes,omitempty"`
+
+	// ExternalizedValues references the Secret the inline values of
+	// the HelmRelease have been externalized to by the operator.
+	// +optional
+	ExternalizedValues *ExternalizedValues `json:"externalizedValues,omitempty"`
+
+	// Failures is the amount of consecutive failed syncs of the
+	// observed generation, it is reset after a successful sync.
+	// +optional
+	Failures int64 `json:"failures,omitempty"`
+
+	// LastHandledReconcileAt holds the value of the reconcileAt
+	// annotation of the last reconciliation requested with it.
+	// +optional
+	LastHandledReconcileAt string `json:"lastHandledReconcileAt,omitempty"`
+
 	// Conditions contains observations of the resource's state, e.g.,
 	// has the chart which it refers to been fetched.
 	// +optional
@@ -2,8 +2,10 @@ package v1
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestHelmValues(t *testing.T) {
@@ -66,3 +68,31 @@ func TestRefOrDefault(t *testing.T) {
 		assert.Equal(t, tc.expected, got)
 	}
 }
+
+func TestRetry(t *testing.T) {
+	maxRetries, retryForever := int64(3), int64(-1)
+	defaults := Retry{
+		MaxRetries: &maxRetries,
+		BaseDelay:  &metav1.Duration{Duration: time.Second},
+		MaxDelay:   &metav1.Duration{Duration: 5 * time.Second},
+	}
+
+	retry := HelmRelease{}.GetRetry(defaults)
+	assert.Equal(t, defaults, retry)
+	assert.Equal(t, time.Second, retry.Delay(1))
+	assert.Equal(t, 4*time.Second, retry.Delay(3))
+	assert.Equal(t, 5*time.Second, retry.Delay(10))
+	assert.False(t, retry.Exhausted(3))
+	assert.True(t, retry.Exhausted(4))
+
+	hr := HelmRelease{Spec: HelmReleaseSpec{Retry: &Retry{MaxRetries: &retryForever}}}
+	retry = hr.GetRetry(defaults)
+	assert.False(t, retry.Exhausted(100))
+	assert.Equal(t, defaults.MaxDelay, retry.MaxDelay)
+}
+
+func TestUninstallGetTimeout(t *testing.T) {
+	timeout := int64(30)
+	assert.Equal(t, time.Minute, Uninstall{}.GetTimeout(time.Minute))
+	assert.Equal(t, 30*time.Second, Uninstall{Timeout: &timeout}.GetTimeout(time.Minute))
+}
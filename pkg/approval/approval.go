@@ -0,0 +1,180 @@
+/*
+Package approval asks an external change management system to approve
+the upgrades of HelmReleases, by posting the changes of an upgrade as
+JSON to a webhook and waiting for it to allow or deny the upgrade.
+
+The webhook is expected to respond to a POST request with a Request
+in the body with its decision:
+
+	{"allowed": false, "reason": "change CHG0042 is not scheduled"}
+
+If the webhook can not be reached, does not respond within the
+timeout, or responds with an unexpected status, the default policy
+decides whether the upgrade proceeds.
+*/
+package approval
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+// Policy decides upgrades for which the webhook did not respond.
+type Policy string
+
+const (
+	PolicyAllow Policy = "allow"
+	PolicyDeny  Policy = "deny"
+)
+
+// Request holds the changes of an upgrade, as posted to the webhook.
+type Request struct {
+	// Namespace and Name are those of the HelmRelease.
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// ReleaseName and TargetNamespace are those of the Helm release.
+	ReleaseName     string `json:"releaseName"`
+	TargetNamespace string `json:"targetNamespace"`
+	// Revision is the revision of the chart to upgrade to.
+	Revision string `json:"revision,omitempty"`
+	// Chart is the chart of the current and the upgraded release.
+	Chart ChartChange `json:"chart"`
+	// Diff holds the differences between the current and the
+	// upgraded release.
+	Diff Diff `json:"diff"`
+}
+
+// ChartChange holds the chart versions of an upgrade.
+type ChartChange struct {
+	Name        string `json:"name"`
+	FromVersion string `json:"fromVersion,omitempty"`
+	ToVersion   string `json:"toVersion,omitempty"`
+}
+
+// Diff holds the differences of an upgrade, each as a textual diff.
+type Diff struct {
+	// Values is the diff of the values of the release.
+	Values string `json:"values,omitempty"`
+	// Chart is the diff of the chart of the release.
+	Chart string `json:"chart,omitempty"`
+	// Live is the diff of the live objects of the release to the
+	// objects of the release, if they drifted.
+	Live string `json:"live,omitempty"`
+	// Missing are the resources of the release which have been deleted
+	// from the cluster, and are recreated by the upgrade.
+	Missing []string `json:"missing,omitempty"`
+}
+
+// Empty returns if the diff holds no differences.
+func (d Diff) Empty() bool {
+	return d.Values == "" && d.Chart == "" && d.Live == "" && len(d.Missing) == 0
+}
+
+// Decision is the decision on an upgrade.
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+	// Default is set if the decision was made by the default policy.
+	Default bool `json:"-"`
+}
+
+// Config holds the configuration of the Webhook.
+type Config struct {
+	// URL is the endpoint the requests are posted to.
+	URL string
+	// Timeout is the duration to wait for a decision.
+	Timeout time.Duration
+	// DefaultPolicy decides upgrades for which the webhook did not
+	// respond.
+	DefaultPolicy Policy
+	// Namespaces are the protected namespaces of the HelmReleases of
+	// which upgrades require approval; upgrades of all HelmReleases
+	// require approval if empty.
+	Namespaces []string
+}
+
+// WithDefaults sets the default values for the webhook config.
+func (c Config) WithDefaults() Config {
+	if c.Timeout == 0 {
+		c.Timeout = 30 * time.Second
+	}
+	if c.DefaultPolicy == "" {
+		c.DefaultPolicy = PolicyDeny
+	}
+	return c
+}
+
+// Validate returns an error if the config is invalid.
+func (c Config) Validate() error {
+	switch c.DefaultPolicy {
+	case PolicyAllow, PolicyDeny:
+		return nil
+	default:
+		return fmt.Errorf("unsupported approval default policy '%s', must be one of: %s, %s", c.DefaultPolicy, PolicyAllow, PolicyDeny)
+	}
+}
+
+// Webhook asks the approval webhook to decide on upgrades.
+type Webhook struct {
+	config Config
+	client *http.Client
+}
+
+// NewWebhook returns a new Webhook with the given config.
+func NewWebhook(config Config) *Webhook {
+	config = config.WithDefaults()
+	return &Webhook{config: config, client: &http.Client{Timeout: config.Timeout}}
+}
+
+// Applies returns if upgrades of the HelmRelease require approval.
+func (w *Webhook) Applies(hr *v1.HelmRelease) bool {
+	if len(w.config.Namespaces) == 0 {
+		return true
+	}
+	for _, ns := range w.config.Namespaces {
+		if ns == hr.Namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// Review posts the request to the webhook and returns its decision.
+// If the webhook did not decide, the decision of the default policy
+// is returned together with the error.
+func (w *Webhook) Review(req Request) (Decision, error) {
+	decision, err := w.post(req)
+	if err != nil {
+		return Decision{
+			Allowed: w.config.DefaultPolicy == PolicyAllow,
+			Reason:  fmt.Sprintf("%s by default policy: %v", w.config.DefaultPolicy, err),
+			Default: true,
+		}, err
+	}
+	return decision, nil
+}
+
+func (w *Webhook) post(req Request) (Decision, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return Decision{}, err
+	}
+	res, err := w.client.Post(w.config.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to request approval: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return Decision{}, fmt.Errorf("failed to request approval: %s", res.Status)
+	}
+	var decision Decision
+	if err := json.NewDecoder(res.Body).Decode(&decision); err != nil {
+		return Decision{}, fmt.Errorf("failed to parse approval decision: %w", err)
+	}
+	return decision, nil
+}
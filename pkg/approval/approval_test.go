@@ -0,0 +1,74 @@
+package approval
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+func TestWebhookReview(t *testing.T) {
+	var received Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch received.Name {
+		case "allowed":
+			w.Write([]byte(`{"allowed": true}`))
+		case "denied":
+			w.Write([]byte(`{"allowed": false, "reason": "change CHG0042 is not scheduled"}`))
+		case "slow":
+			time.Sleep(100 * time.Millisecond)
+			w.Write([]byte(`{"allowed": true}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		name     string
+		policy   Policy
+		decision Decision
+		err      bool
+	}{
+		{name: "allowed", decision: Decision{Allowed: true}},
+		{name: "denied", decision: Decision{Reason: "change CHG0042 is not scheduled"}},
+		{name: "failed", err: true},
+		{name: "failed", policy: PolicyAllow, decision: Decision{Allowed: true}, err: true},
+		{name: "slow", err: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := NewWebhook(Config{URL: srv.URL, Timeout: 50 * time.Millisecond, DefaultPolicy: tc.policy})
+			decision, err := w.Review(Request{Namespace: "prod", Name: tc.name, Diff: Diff{Values: "-replicas: 1\n+replicas: 2\n"}})
+			assert.Equal(t, tc.err, err != nil)
+			assert.Equal(t, tc.decision.Allowed, decision.Allowed)
+			assert.Equal(t, tc.err, decision.Default)
+			if !tc.err {
+				assert.Equal(t, tc.decision.Reason, decision.Reason)
+			}
+		})
+	}
+	assert.Equal(t, "-replicas: 1\n+replicas: 2\n", received.Diff.Values)
+}
+
+func TestWebhookApplies(t *testing.T) {
+	hr := &v1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Name: "podinfo"}}
+	assert.True(t, NewWebhook(Config{}).Applies(hr))
+	assert.True(t, NewWebhook(Config{Namespaces: []string{"staging", "prod"}}).Applies(hr))
+	assert.False(t, NewWebhook(Config{Namespaces: []string{"staging"}}).Applies(hr))
+}
+
+func TestConfigValidate(t *testing.T) {
+	assert.NoError(t, Config{}.WithDefaults().Validate())
+	assert.NoError(t, Config{DefaultPolicy: PolicyAllow}.Validate())
+	assert.Error(t, Config{DefaultPolicy: "maybe"}.Validate())
+}
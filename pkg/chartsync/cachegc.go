@@ -0,0 +1,265 @@
+package chartsync
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"k8s.io/apimachinery/pkg/labels"
+
+	helmfluxv1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	iflister "github.com/lstack-org/helm-operator/pkg/client/listers/helm.fluxcd.io/v1"
+)
+
+// The reasons a chart archive is evicted from the cache for.
+const (
+	EvictedForAge  = "age"
+	EvictedForSize = "size"
+)
+
+// CacheGCConfig holds the configuration of the chart cache garbage
+// collection.
+type CacheGCConfig struct {
+	// MaxSize is the size in bytes the chart archives in the cache may
+	// take up; unlimited if 0.
+	MaxSize int64
+	// MaxAge is the duration after its last use an archive is evicted;
+	// unlimited if 0.
+	MaxAge time.Duration
+	// DefaultHelmVersion is the Helm version of HelmReleases which do
+	// not specify one.
+	DefaultHelmVersion string
+}
+
+// CacheGC evicts chart archives which are not referenced by any
+// HelmRelease from the chart cache. Archives are evicted once they
+// have not been used for the maximum age, and the least recently
+// used first while the cache exceeds the maximum size. Archives are
+// marked as used whenever they are served from the cache. Only the
+// archives the operator downloaded are considered, other files in
+// the cache directory, e.g. workspaces, are left alone.
+type CacheGC struct {
+	base     string
+	config   CacheGCConfig
+	hrLister iflister.HelmReleaseLister
+}
+
+// NewCacheGC returns a new garbage collector for the chart cache at
+// base.
+func NewCacheGC(base string, config CacheGCConfig, hrLister iflister.HelmReleaseLister) *CacheGC {
+	return &CacheGC{
+		base:     base,
+		config:   config,
+		hrLister: hrLister,
+	}
+}
+
+// Loop collects the garbage in the chart cache on every interval,
+// until stop is closed.
+func (gc *CacheGC) Loop(stop <-chan struct{}, interval time.Duration, logger log.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			logger.Log("loop", "stopping")
+			return
+		case <-ticker.C:
+		}
+		if err := gc.Collect(logger); err != nil {
+			logger.Log("error", fmt.Sprintf("chart cache garbage collection failed: %v", err))
+		}
+	}
+}
+
+// cachedArchive is a chart archive in the cache.
+type cachedArchive struct {
+	path string
+	size int64
+	used time.Time
+}
+
+// Collect evicts the archives from the cache which are unreferenced
+// and either exceed the maximum age, or the maximum size of the cache.
+func (gc *CacheGC) Collect(logger log.Logger) error {
+	hrs, err := gc.hrLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	refs := gc.references(hrs)
+	archives := cachedArchives(gc.base)
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].used.Before(archives[j].used)
+	})
+
+	var size int64
+	for _, a := range archives {
+		size += a.size
+	}
+	count := len(archives)
+	now := time.Now()
+	for _, a := range archives {
+		if refs.has(a.path) {
+			continue
+		}
+		var reason string
+		switch {
+		case gc.config.MaxAge > 0 && now.Sub(a.used) > gc.config.MaxAge:
+			reason = EvictedForAge
+		case gc.config.MaxSize > 0 && size > gc.config.MaxSize:
+			reason = EvictedForSize
+		default:
+			continue
+		}
+		if err := os.Remove(a.path); err != nil && !os.IsNotExist(err) {
+			logger.Log("warning", fmt.Sprintf("failed to evict chart archive: %v", err), "path", a.path)
+			continue
+		}
+		size -= a.size
+		count--
+		ObserveCacheEviction(reason)
+		logger.Log("info", "evicted chart archive from cache", "path", a.path, "reason", reason)
+	}
+	gc.collectProvenance(logger, now)
+	ObserveCache(count, size)
+	if gc.config.MaxSize > 0 && size > gc.config.MaxSize {
+		logger.Log("warning", fmt.Sprintf("chart archives referenced by HelmReleases take up %d bytes, exceeding the chart cache size of %d bytes",
+			size, gc.config.MaxSize))
+	}
+	return nil
+}
+
+// collectProvenance removes the cached provenance files which have not
+// been used for the maximum age. As they are cached by the digest of
+// their chart, they can not be told apart by the HelmReleases
+// referring to them, but they are marked as used along with their
+// chart.
+func (gc *CacheGC) collectProvenance(logger log.Logger, now time.Time) {
+	if gc.config.MaxAge <= 0 {
+		return
+	}
+	dir := filepath.Join(gc.base, provenanceDir)
+	files, _ := ioutil.ReadDir(dir)
+	for _, f := range files {
+		if !f.Mode().IsRegular() || !strings.HasSuffix(f.Name(), ".prov") || now.Sub(f.ModTime()) <= gc.config.MaxAge {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, f.Name())); err != nil && !os.IsNotExist(err) {
+			logger.Log("warning", fmt.Sprintf("failed to evict provenance file: %v", err), "path", filepath.Join(dir, f.Name()))
+		}
+	}
+}
+
+// cacheReferences are the paths of the archives in the cache which
+// are referenced by a HelmRelease. Charts with a version range
+// reference every version of the chart in their repository.
+type cacheReferences struct {
+	paths    map[string]bool
+	prefixes []string
+}
+
+func (r cacheReferences) has(path string) bool {
+	if r.paths[path] {
+		return true
+	}
+	for _, p := range r.prefixes {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// references returns the paths of the archives in the cache the
+// given HelmReleases refer to.
+func (gc *CacheGC) references(hrs []*helmfluxv1.HelmRelease) cacheReferences {
+	refs := cacheReferences{paths: make(map[string]bool)}
+	for _, hr := range hrs {
+		source := hr.Spec.ChartSource
+		if source.Oss != nil {
+			refs.paths[ossCachePath(gc.base, hr.Namespace, source.Oss, source.Oss.Key)] = true
+			if source.Oss.ValuesKey != "" {
+				refs.paths[ossCachePath(gc.base, hr.Namespace, source.Oss, source.Oss.ValuesKey)] = true
+				refs.paths[ossValidatorPath(gc.base, hr.Namespace, source.Oss, source.Oss.ValuesKey)] = true
+			}
+		}
+		if source.Customize != nil {
+			refs.paths[cacheFilePath(gc.base, source.Customize.Key)] = true
+		}
+		if source.RepoChartSource != nil {
+			repoPath := chartRepoPath(gc.base, hr.GetHelmVersion(gc.config.DefaultHelmVersion), hr.Namespace, source.RepoChartSource)
+			if IsVersionRange(source.RepoChartSource.Version) {
+				refs.prefixes = append(refs.prefixes, filepath.Join(repoPath, source.RepoChartSource.Name+"-"))
+				continue
+			}
+			refs.paths[filepath.Join(repoPath, chartFilename(source.RepoChartSource))] = true
+		}
+	}
+	return refs
+}
+
+// cachedArchives returns the chart archives in the cache at base: the
+// files downloaded from OSS and custom URLs in base itself, and the
+// charts downloaded from repositories in the directories of the Helm
+// versions.
+func cachedArchives(base string) []cachedArchive {
+	var archives []cachedArchive
+	files, _ := ioutil.ReadDir(base)
+	for _, f := range files {
+		if f.Mode().IsRegular() && isCacheKey(f.Name()) {
+			archives = append(archives, cachedArchive{filepath.Join(base, f.Name()), f.Size(), f.ModTime()})
+		}
+	}
+	for _, version := range []helmfluxv1.HelmVersion{helmfluxv1.HelmV2, helmfluxv1.HelmV3} {
+		repos, _ := ioutil.ReadDir(filepath.Join(base, string(version)))
+		for _, repo := range repos {
+			if !repo.IsDir() || !isCacheKey(repo.Name()) {
+				continue
+			}
+			repoPath := filepath.Join(base, string(version), repo.Name())
+			charts, _ := ioutil.ReadDir(repoPath)
+			for _, f := range charts {
+				if f.Mode().IsRegular() && strings.HasSuffix(f.Name(), ".tgz") {
+					archives = append(archives, cachedArchive{filepath.Join(repoPath, f.Name()), f.Size(), f.ModTime()})
+				}
+			}
+		}
+	}
+	return archives
+}
+
+// cacheFilePrefix is the prefix of the names of the files in the cache,
+// so files of others in its directory, which is shared with the
+// workspaces and may be a common directory like /tmp, are never taken
+// for files of the cache and collected.
+const cacheFilePrefix = "helm-operator-cache-"
+
+// isCacheKey returns if the given file name is an encoded cache key,
+// to tell the files of the cache apart from other files in its
+// directory.
+func isCacheKey(name string) bool {
+	if !strings.HasPrefix(name, cacheFilePrefix) {
+		return false
+	}
+	b, err := base64.URLEncoding.DecodeString(strings.TrimPrefix(name, cacheFilePrefix))
+	return err == nil && len(b) > 0
+}
+
+// cacheFilePath returns the path to the file for the given key in the
+// cache at base.
+func cacheFilePath(base, key string) string {
+	return filepath.Join(base, cacheFilePrefix+base64.URLEncoding.EncodeToString([]byte(key)))
+}
+
+// touch marks the file at path as used, for the garbage collection to
+// evict the least recently used files first.
+func touch(path string) {
+	now := time.Now()
+	os.Chtimes(path, now, now)
+}
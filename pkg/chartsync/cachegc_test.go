@@ -0,0 +1,82 @@
+package chartsync
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	helmfluxv1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	iflister "github.com/lstack-org/helm-operator/pkg/client/listers/helm.fluxcd.io/v1"
+)
+
+func TestCacheGCCollect(t *testing.T) {
+	base, err := ioutil.TempDir("", "chart-cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(base)
+
+	repo := &helmfluxv1.RepoChartSource{RepoURL: "https://charts.example.com", Name: "podinfo", Version: "1.0.0"}
+	ranged := &helmfluxv1.RepoChartSource{RepoURL: "https://charts.example.com", Name: "redis", Version: "^2.0.0"}
+	repoPath := chartRepoPath(base, "v3", "default", repo)
+	assert.NoError(t, os.MkdirAll(repoPath, 00750))
+
+	old := time.Now().Add(-2 * time.Hour)
+	write := func(path string, size int, used time.Time) string {
+		assert.NoError(t, ioutil.WriteFile(path, make([]byte, size), 00644))
+		assert.NoError(t, os.Chtimes(path, used, used))
+		return path
+	}
+	oss := &helmfluxv1.Oss{CloudProvider: Ali, RegionId: "cn-hangzhou", Bucket: "charts", Key: "charts/app.tgz", ValuesKey: "values/app.yaml"}
+	referencedOss := write(ossCachePath(base, "default", oss, oss.Key), 10, old)
+	referencedValues := write(ossCachePath(base, "default", oss, oss.ValuesKey), 1, old)
+	referencedValidator := write(ossValidatorPath(base, "default", oss, oss.ValuesKey), 1, old)
+	unreferencedOss := write(ossCachePath(base, "default", oss, "charts/old.tgz"), 10, old)
+	otherNamespaceOss := write(ossCachePath(base, "other", oss, oss.Key), 10, old)
+	referencedRepo := write(filepath.Join(repoPath, "podinfo-1.0.0.tgz"), 10, old)
+	rangedRepo := write(filepath.Join(repoPath, "redis-2.1.0.tgz"), 10, old)
+	recentRepo := write(filepath.Join(repoPath, "podinfo-0.9.0.tgz"), 10, time.Now().Add(-time.Minute))
+	oldestRepo := write(filepath.Join(repoPath, "podinfo-0.8.0.tgz"), 10, time.Now().Add(-2*time.Minute))
+	other := write(filepath.Join(base, "operator.lock"), 10, old)
+	// a file of someone else which happens to be a valid cache key
+	foreign := write(filepath.Join(base, base64.URLEncoding.EncodeToString([]byte("charts/app.tgz"))), 10, old)
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for i, source := range []helmfluxv1.ChartSource{
+		{Oss: oss},
+		{RepoChartSource: repo},
+		{RepoChartSource: ranged},
+	} {
+		indexer.Add(&helmfluxv1.HelmRelease{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: fmt.Sprint("release-", i)},
+			Spec:       helmfluxv1.HelmReleaseSpec{HelmVersion: helmfluxv1.HelmV3, ChartSource: source},
+		})
+	}
+
+	gc := NewCacheGC(base, CacheGCConfig{MaxSize: 45, MaxAge: time.Hour}, iflister.NewHelmReleaseLister(indexer))
+	assert.NoError(t, gc.Collect(log.NewNopLogger()))
+
+	for path, kept := range map[string]bool{
+		referencedOss:       true,
+		referencedValues:    true,
+		referencedValidator: true,
+		unreferencedOss:     false, // expired
+		otherNamespaceOss:   false, // expired, as it is cached for another namespace
+		referencedRepo:      true,
+		rangedRepo:          true,
+		recentRepo:          true,
+		oldestRepo:          false, // least recently used while exceeding the size
+		other:               true,
+		foreign:             true,
+	} {
+		_, err := os.Stat(path)
+		assert.Equal(t, kept, err == nil, path)
+	}
+}
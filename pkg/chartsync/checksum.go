@@ -0,0 +1,147 @@
+package chartsync
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// ChecksumMismatchError is returned when the digest of a downloaded
+// file does not match the expected checksum.
+type ChecksumMismatchError struct {
+	Expected Checksum
+	Actual   string
+}
+
+func (err ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("%s checksum mismatch: expected %s, got %s", err.Expected.Algorithm, err.Expected.Digest, err.Actual)
+}
+
+// Checksum is the expected digest of a file.
+type Checksum struct {
+	Algorithm string
+	Digest    string
+}
+
+// ParseChecksum parses a checksum in the form `<algorithm>:<hex
+// digest>`, with algorithm either `sha256` or `md5`. An empty string
+// yields a nil checksum.
+func ParseChecksum(s string) (*Checksum, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid checksum '%s', expected <algorithm>:<digest>", s)
+	}
+	c := &Checksum{Algorithm: strings.ToLower(parts[0]), Digest: strings.ToLower(parts[1])}
+	h, err := c.hash()
+	if err != nil {
+		return nil, err
+	}
+	if b, err := hex.DecodeString(c.Digest); err != nil || len(b) != h.Size() {
+		return nil, fmt.Errorf("invalid %s digest '%s'", c.Algorithm, parts[1])
+	}
+	return c, nil
+}
+
+func (c Checksum) hash() (hash.Hash, error) {
+	switch c.Algorithm {
+	case "sha256":
+		return sha256.New(), nil
+	case "md5":
+		return md5.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported checksum algorithm '%s'", c.Algorithm)
+}
+
+// Verify returns a ChecksumMismatchError if the digest of the file at
+// path does not match the checksum.
+func (c Checksum) Verify(path string) error {
+	h, err := c.hash()
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(h.Sum(nil)); actual != c.Digest {
+		return ChecksumMismatchError{Expected: c, Actual: actual}
+	}
+	return nil
+}
+
+// verifier returns the function to verify a fetched file with, or nil
+// without a checksum.
+func (c *Checksum) verifier() func(path string) error {
+	if c == nil {
+		return nil
+	}
+	return c.Verify
+}
+
+// downloadBackoff is the backoff between the attempts of a download.
+var downloadBackoff = wait.Backoff{
+	Duration: time.Second,
+	Factor:   2,
+	Steps:    4,
+}
+
+// permanentError marks a download error which retrying won't resolve.
+type permanentError struct {
+	error
+}
+
+func (err permanentError) Unwrap() error {
+	return err.error
+}
+
+// retryAfterError marks a download error of a server asking to retry
+// after the delay.
+type retryAfterError struct {
+	error
+	delay time.Duration
+}
+
+func (err retryAfterError) Unwrap() error {
+	return err.error
+}
+
+// retryDownload calls download until it succeeds, it fails with a
+// permanent error or quota error, or the backoff is exhausted. Retries
+// are delayed by at least the delay a server asked for. It returns the
+// last error.
+func retryDownload(download func() error) error {
+	var lastErr error
+	err := wait.ExponentialBackoff(downloadBackoff, func() (bool, error) {
+		lastErr = download()
+		switch e := lastErr.(type) {
+		case nil:
+			return true, nil
+		case permanentError:
+			return false, e.error
+		case QuotaExceededError:
+			return false, lastErr
+		case retryAfterError:
+			time.Sleep(e.delay)
+		}
+		return false, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return lastErr
+	}
+	return err
+}
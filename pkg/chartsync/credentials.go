@@ -0,0 +1,173 @@
+package chartsync
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	helmfluxv1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+// repositoryCredentials returns the pull options with the credentials
+// for the Helm repository of the given source, read from the Secret
+// it references in the given namespace. TLS files are written to the
+// workspace. Without a Secret reference empty options are returned.
+func repositoryCredentials(coreV1Client corev1client.CoreV1Interface, namespace string, ws *Workspace,
+	source *helmfluxv1.RepoChartSource) (helm.PullOptions, error) {
+	ref := source.ChartPullSecret
+	if ref == nil {
+		return helm.PullOptions{}, nil
+	}
+	secret, err := coreV1Client.Secrets(namespace).Get(ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return helm.PullOptions{}, fmt.Errorf("failed to get repository credentials: %w", err)
+	}
+	return pullOptionsFromSecret(secret, ws)
+}
+
+// pullOptionsFromSecret returns the pull options with the credentials
+// held by the given Secret.
+func pullOptionsFromSecret(secret *corev1.Secret, ws *Workspace) (helm.PullOptions, error) {
+	opts := helm.PullOptions{
+		Username: string(secret.Data["username"]),
+		Password: string(secret.Data["password"]),
+	}
+	if (opts.Username == "") != (opts.Password == "") {
+		return helm.PullOptions{}, fmt.Errorf("Secret '%s' must hold both a username and password, or neither", secret.Name)
+	}
+
+	dir := filepath.Join(ws.Dir(), "credentials")
+	for key, path := range map[string]*string{
+		"certFile": &opts.CertFile,
+		"keyFile":  &opts.KeyFile,
+		"caFile":   &opts.CAFile,
+	} {
+		data, ok := secret.Data[key]
+		if !ok {
+			continue
+		}
+		if err := os.MkdirAll(dir, 00700); err != nil {
+			return helm.PullOptions{}, err
+		}
+		*path = filepath.Join(dir, key)
+		if err := ioutil.WriteFile(*path, data, 00600); err != nil {
+			return helm.PullOptions{}, err
+		}
+	}
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return helm.PullOptions{}, fmt.Errorf("Secret '%s' must hold both a certFile and keyFile, or neither", secret.Name)
+	}
+	if !opts.HasCredentials() {
+		return helm.PullOptions{}, fmt.Errorf("Secret '%s' holds no repository credentials", secret.Name)
+	}
+	return opts, nil
+}
+
+// GitCredentials are the credentials for the Git repository of a
+// chart source.
+type GitCredentials struct {
+	// URL is the URL of the repository, with the HTTPS credentials
+	// added.
+	URL string
+	// Env is the environment git is run with, configuring the SSH
+	// private key and known hosts.
+	Env []string
+	// Expiration is when short-lived credentials expire, after which
+	// they must be obtained again; zero for static credentials.
+	Expiration time.Time
+}
+
+// GitCredentialsFor returns the credentials for the Git repository of
+// the given source, read from the Secret it references; the Secret is
+// looked up in the given namespace unless the reference has one, which
+// is only allowed with crossNamespace set. SSH
+// keys are written to the workspace. Without a Secret reference, the
+// URL of the source is returned without credentials. For the credential
+// sources of code services, short-lived credentials are obtained from
+// the service instead, if allowed for the namespace and host.
+func GitCredentialsFor(coreV1Client corev1client.CoreV1Interface, namespace string, crossNamespace bool,
+	providers GitProviderCredentials, ws *Workspace, source *helmfluxv1.GitChartSource) (GitCredentials, error) {
+	if ProviderCredentials(source) {
+		return gitCredentialsFromProvider(ws.HTTPClient(credentialsTimeout), providers, namespace, source.GitURL, source.CredentialSource)
+	}
+	ref := source.SecretRef
+	if ref == nil {
+		return GitCredentials{URL: source.GitURL}, nil
+	}
+	if ref.Namespace != "" && ref.Namespace != namespace {
+		if !crossNamespace {
+			return GitCredentials{}, fmt.Errorf("reference to Secret %s/%s is not allowed, cross-namespace references are disabled", ref.Namespace, ref.Name)
+		}
+		namespace = ref.Namespace
+	}
+	secret, err := coreV1Client.Secrets(namespace).Get(ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return GitCredentials{}, fmt.Errorf("failed to get Git credentials: %w", err)
+	}
+	return gitCredentialsFromSecret(source.GitURL, secret, ws)
+}
+
+// ProviderCredentials returns if the credentials of the Git chart
+// source are obtained from a code service. As these are short-lived,
+// the repository is cloned for every release instead of mirrored.
+func ProviderCredentials(source *helmfluxv1.GitChartSource) bool {
+	return source.CredentialSource != "" && source.CredentialSource != helmfluxv1.GitCredentialsSecret
+}
+
+// gitCredentialsFromSecret returns the credentials held by the given
+// Secret for the Git repository at gitURL.
+func gitCredentialsFromSecret(gitURL string, secret *corev1.Secret, ws *Workspace) (GitCredentials, error) {
+	if identity, ok := secret.Data["identity"]; ok {
+		if isHTTPURL(gitURL) {
+			return GitCredentials{}, fmt.Errorf("Secret '%s' holds an SSH identity, but Git URL '%s' is not an SSH URL", secret.Name, gitURL)
+		}
+		dir := filepath.Join(ws.Dir(), "git-credentials")
+		if err := os.MkdirAll(dir, 00700); err != nil {
+			return GitCredentials{}, err
+		}
+		identityFile := filepath.Join(dir, "identity")
+		if err := ioutil.WriteFile(identityFile, identity, 00600); err != nil {
+			return GitCredentials{}, err
+		}
+		sshCommand := []string{"ssh", "-i", identityFile, "-o", "IdentitiesOnly=yes"}
+		if knownHosts, ok := secret.Data["known_hosts"]; ok {
+			knownHostsFile := filepath.Join(dir, "known_hosts")
+			if err := ioutil.WriteFile(knownHostsFile, knownHosts, 00600); err != nil {
+				return GitCredentials{}, err
+			}
+			sshCommand = append(sshCommand, "-o", "UserKnownHostsFile="+knownHostsFile, "-o", "StrictHostKeyChecking=yes")
+		}
+		return GitCredentials{URL: gitURL, Env: []string{"GIT_SSH_COMMAND=" + strings.Join(sshCommand, " ")}}, nil
+	}
+
+	username, password := string(secret.Data["username"]), string(secret.Data["password"])
+	if token, ok := secret.Data["token"]; ok {
+		if username == "" {
+			username = "git"
+		}
+		password = string(token)
+	}
+	if username == "" || password == "" {
+		return GitCredentials{}, fmt.Errorf("Secret '%s' must hold an identity, a username and password, or a token", secret.Name)
+	}
+	// credentials are never sent in plain text, over a http:// URL
+	u, err := url.Parse(gitURL)
+	if err != nil || u.Scheme != "https" {
+		return GitCredentials{}, fmt.Errorf("Secret '%s' holds HTTPS credentials, but Git URL '%s' is not an HTTPS URL", secret.Name, gitURL)
+	}
+	u.User = url.UserPassword(username, password)
+	return GitCredentials{URL: u.String()}, nil
+}
+
+func isHTTPURL(u string) bool {
+	return strings.HasPrefix(u, "https://") || strings.HasPrefix(u, "http://")
+}
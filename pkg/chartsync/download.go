@@ -1,55 +1,218 @@
 package chartsync
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/klog"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
 
 	helmfluxv1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
 	"github.com/lstack-org/helm-operator/pkg/helm"
+	"github.com/lstack-org/helm-operator/pkg/messages"
 )
 
-func DownloadFile(key, base string, useCache bool) (string, error) {
-	cachePath := filepath.Join(base, base64.URLEncoding.EncodeToString([]byte(key)))
+// DownloadFile downloads the file at the given URL into the
+// workspace, and returns the path to it. With useCache, the file is
+// moved to the cache and reused if present. The file is verified
+// against the given checksum, if any, and against the Content-MD5
+// returned by the server. Failed downloads are retried, and resumed
+// if the server supports range requests.
+func DownloadFile(key, checksum, base string, ws *Workspace, useCache bool) (string, error) {
+	sum, err := ParseChecksum(checksum)
+	if err != nil {
+		return "", ChartUnavailableError{err}
+	}
+	cachePath := cacheFilePath(base, key)
 	if useCache {
-		klog.Infof("cache used,key: %s,path:%s", key, cachePath)
-		_, err := os.Stat(cachePath)
-		//文件存在
-		if err == nil {
-			return cachePath, nil
-		}
+		klog.Info(messages.Get(messages.ChartCacheUsed, key, cachePath))
 	}
-	res, err := http.Get(key)
+	path, err := ws.FetchVerified(SourceCustomize, cachePath, useCache, sum.verifier(), func(dest string) error {
+		var validator string
+		return retryDownload(func() error {
+			return downloadHTTP(key, dest, ws, &validator)
+		})
+	})
 	if err != nil {
 		return "", ChartUnavailableError{err}
 	}
+	return path, nil
+}
 
-	f, err := os.Create(cachePath)
+// downloadHTTP downloads the file at the given URL to dest. If dest
+// holds the partial download of a previous attempt, the download is
+// resumed with a range request conditional on the validator of that
+// attempt, so the server sends the whole file if it changed in the
+// meantime. The validator of the response is stored in validator.
+func downloadHTTP(u, dest string, ws *Workspace, validator *string) error {
+	var offset int64
+	if info, err := os.Stat(dest); err == nil {
+		offset = info.Size()
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
 	if err != nil {
-		return "", ChartUnavailableError{err}
+		return permanentError{err}
+	}
+	if offset > 0 && *validator != "" {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", *validator)
+	}
+	res, err := ws.HTTPClient(0).Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusOK || res.StatusCode == http.StatusPartialContent {
+		*validator = rangeValidator(res.Header)
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch res.StatusCode {
+	case http.StatusOK:
+		// the server ignored the range, start over
+		flags |= os.O_TRUNC
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case http.StatusRequestedRangeNotSatisfiable:
+		os.Remove(dest)
+		return fmt.Errorf("failed to resume download: %s", res.Status)
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return retryAfterError{fmt.Errorf("failed to download chart: %s", res.Status), retryAfter(res.Header)}
+	default:
+		err := fmt.Errorf("failed to download chart: %s", res.Status)
+		if res.StatusCode >= 400 && res.StatusCode < 500 {
+			return permanentError{err}
+		}
+		if res.StatusCode == http.StatusServiceUnavailable {
+			return retryAfterError{err, retryAfter(res.Header)}
+		}
+		return err
+	}
+
+	f, err := os.OpenFile(dest, flags, 00644)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, ws.Limit(res.Body))
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if res.ContentLength >= 0 && n != res.ContentLength {
+		return fmt.Errorf("incomplete download: got %d of %d bytes", n, res.ContentLength)
+	}
+	// a Content-MD5 of a partial response is that of the range
+	if md5 := res.Header.Get("Content-MD5"); md5 != "" && res.StatusCode == http.StatusOK {
+		b, err := base64.StdEncoding.DecodeString(md5)
+		if err != nil {
+			// a malformed header can not be verified against
+			return nil
+		}
+		if err := (Checksum{Algorithm: "md5", Digest: hex.EncodeToString(b)}).Verify(dest); err != nil {
+			os.Remove(dest)
+			return err
+		}
 	}
-	_, err = io.Copy(f, res.Body)
-	return cachePath, nil
+	return nil
+}
+
+// rangeValidator returns the validator of the response with the given
+// header a range request can be made conditional on with If-Range: its
+// ETag if it is a strong one, or else its Last-Modified date.
+func rangeValidator(header http.Header) string {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return header.Get("Last-Modified")
+}
+
+// maxRetryAfter is the maximum delay of a Retry-After header honoured
+// before retrying a download.
+const maxRetryAfter = time.Minute
+
+// retryAfter returns the delay of the Retry-After header, either in
+// seconds or as a date, capped at maxRetryAfter. It returns zero if
+// the header is missing or invalid.
+func retryAfter(header http.Header) time.Duration {
+	v := header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	var d time.Duration
+	if seconds, err := strconv.Atoi(v); err == nil {
+		d = time.Duration(seconds) * time.Second
+	} else if t, err := http.ParseTime(v); err == nil {
+		d = time.Until(t)
+	}
+	switch {
+	case d < 0:
+		return 0
+	case d > maxRetryAfter:
+		return maxRetryAfter
+	}
+	return d
 }
 
 // EnsureChartFetched returns the path to a downloaded chart, fetching
-// it first if necessary. It returns the (expected) path to the chart,
-// a boolean indicating a fetch, and either an error or nil.
-func EnsureChartFetched(client helm.Client, base string, source *helmfluxv1.RepoChartSource) (string, bool, error) {
-	repoPath, filename, err := makeChartPath(base, client.Version(), source)
+// it into the workspace first if necessary, using the repository
+// credentials from the Secret referenced by the source in the given
+// namespace. With provenance, the provenance file of the chart is
+// fetched alongside the chart and cached by the digest of the chart,
+// see ProvenancePath; a cached chart without a cached provenance file
+// is fetched again. It returns the (expected) path to the chart, a
+// boolean indicating a fetch, and either an error or nil.
+func EnsureChartFetched(client helm.Client, coreV1Client corev1client.CoreV1Interface, namespace, base string, ws *Workspace,
+	source *helmfluxv1.RepoChartSource, provenance bool) (string, bool, error) {
+	repoPath, filename, err := makeChartPath(base, client.Version(), namespace, source)
 	if err != nil {
 		return "", false, ChartUnavailableError{err}
 	}
 	chartPath := filepath.Join(repoPath, filename)
 	stat, err := os.Stat(chartPath)
+	if err == nil && !stat.IsDir() && provenance {
+		if provPath, perr := ProvenancePath(base, chartPath); perr != nil || !fileExists(provPath) {
+			os.Remove(chartPath)
+			err = os.ErrNotExist
+		} else {
+			touch(provPath)
+		}
+	}
 	switch {
 	case os.IsNotExist(err):
-		chartPath, err = downloadChart(client, repoPath, source)
+		chartPath, err = ws.Fetch(repoSourceType(source), chartPath, true, func(dest string) error {
+			opts, err := repositoryCredentials(coreV1Client, namespace, ws, source)
+			if err != nil {
+				return err
+			}
+			opts.Provenance = provenance
+			path, err := downloadChart(client, ws.Dir(), source, opts)
+			if err != nil {
+				return err
+			}
+			if provenance {
+				if err := cacheProvenance(base, path, path+".prov"); err != nil {
+					return err
+				}
+			}
+			if path != dest {
+				return os.Rename(path, dest)
+			}
+			return nil
+		})
 		if err != nil {
 			return chartPath, false, ChartUnavailableError{err}
 		}
@@ -59,26 +222,129 @@ func EnsureChartFetched(client helm.Client, base string, source *helmfluxv1.Repo
 	case stat.IsDir():
 		return chartPath, false, ChartUnavailableError{errors.New("path to chart exists but is a directory")}
 	}
+	touch(chartPath)
+	ObserveChartCache(repoSourceType(source), true)
 	return chartPath, false, nil
 }
 
+// provenanceDir is the directory in the chart cache holding the
+// provenance files of charts.
+const provenanceDir = "provenance"
+
+// ProvenancePath returns the path to the provenance file of the chart
+// archive at chartPath in the chart cache at base. Provenance files
+// are cached by the SHA256 digest of the chart they belong to, so a
+// chart which changed in the repository never matches the provenance
+// file of its previous contents.
+func ProvenancePath(base, chartPath string) (string, error) {
+	f, err := os.Open(chartPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return filepath.Join(base, provenanceDir, hex.EncodeToString(h.Sum(nil))+".prov"), nil
+}
+
+// cacheProvenance moves the provenance file at provPath of the chart
+// archive at chartPath into the chart cache at base.
+func cacheProvenance(base, chartPath, provPath string) error {
+	if !fileExists(provPath) {
+		return fmt.Errorf("repository did not serve a provenance file for the chart")
+	}
+	dest, err := ProvenancePath(base, chartPath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 00750); err != nil {
+		return err
+	}
+	return os.Rename(provPath, dest)
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// repoSourceType returns the source type of the given repository
+// chart source.
+func repoSourceType(source *helmfluxv1.RepoChartSource) string {
+	if strings.HasPrefix(source.RepoURL, "oci://") {
+		return SourceOCI
+	}
+	return SourceRepo
+}
+
+// IsVersionRange returns if the given chart version is a semver range
+// rather than a version.
+func IsVersionRange(version string) bool {
+	if _, err := semver.NewVersion(version); err == nil {
+		return false
+	}
+	_, err := semver.NewConstraint(version)
+	return err == nil
+}
+
+// ResolveChartVersion returns a copy of the source with its version
+// range resolved to the latest matching version in the repository,
+// using the repository credentials from the Secret referenced by the
+// source in the given namespace. Sources with a version instead of a
+// range are returned as is.
+func ResolveChartVersion(client helm.Client, coreV1Client corev1client.CoreV1Interface, namespace string, ws *Workspace,
+	source *helmfluxv1.RepoChartSource) (*helmfluxv1.RepoChartSource, error) {
+	if !IsVersionRange(source.Version) {
+		return source, nil
+	}
+	opts, err := repositoryCredentials(coreV1Client, namespace, ws, source)
+	if err != nil {
+		return nil, ChartUnavailableError{err}
+	}
+	version, err := client.ResolveChartVersion(source.RepoURL, source.Name, source.Version, opts)
+	if err != nil {
+		return nil, ChartUnavailableError{err}
+	}
+	resolved := source.DeepCopy()
+	resolved.Version = version
+	return resolved, nil
+}
+
 // makeChartPath gives the expected filesystem location for a chart,
 // without testing whether the file exists or not.
-func makeChartPath(base string, clientVersion string, source *helmfluxv1.RepoChartSource) (string, string, error) {
+func makeChartPath(base string, clientVersion string, namespace string, source *helmfluxv1.RepoChartSource) (string, string, error) {
 	// We don't need to obscure the location of the charts in the
 	// filesystem; but we do need a stable, filesystem-friendly path
 	// to them that is based on the URL and the client version.
-	repoPath := filepath.Join(base, clientVersion, base64.URLEncoding.EncodeToString([]byte(source.CleanRepoURL())))
+	repoPath := chartRepoPath(base, clientVersion, namespace, source)
 	if err := os.MkdirAll(repoPath, 00750); err != nil {
 		return "", "", err
 	}
-	filename := fmt.Sprintf("%s-%s.tgz", source.Name, source.Version)
-	return repoPath, filename, nil
+	return repoPath, chartFilename(source), nil
+}
+
+// chartRepoPath returns the directory in the cache at base holding
+// the charts of the repository of the source. Charts fetched with
+// credentials are stored per Secret, so they are not served to
+// HelmReleases without access to the Secret.
+func chartRepoPath(base, clientVersion, namespace string, source *helmfluxv1.RepoChartSource) string {
+	key := source.CleanRepoURL()
+	if ref := source.ChartPullSecret; ref != nil {
+		key += "#" + namespace + "/" + ref.Name
+	}
+	return cacheFilePath(filepath.Join(base, clientVersion), key)
+}
+
+// chartFilename returns the file name of the chart of the source.
+func chartFilename(source *helmfluxv1.RepoChartSource) string {
+	return fmt.Sprintf("%s-%s.tgz", source.Name, source.Version)
 }
 
 // downloadChart attempts to pull a chart tarball, given the name,
 // version and repo URL in `source`, and the path to write the file
 // to in `destFolder`.
-func downloadChart(helm helm.Client, destFolder string, source *helmfluxv1.RepoChartSource) (string, error) {
-	return helm.PullWithRepoURL(source.RepoURL, source.Name, source.Version, destFolder)
+func downloadChart(helm helm.Client, destFolder string, source *helmfluxv1.RepoChartSource, opts helm.PullOptions) (string, error) {
+	return helm.PullWithRepoURL(source.RepoURL, source.Name, source.Version, destFolder, opts)
 }
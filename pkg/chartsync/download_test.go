@@ -0,0 +1,224 @@
+package chartsync
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	helmfluxv1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+func TestIsVersionRange(t *testing.T) {
+	for version, expected := range map[string]bool{
+		"1.2.0":          false,
+		"v1.2.0":         false,
+		"1.2.0-rc.1":     false,
+		"^1.2.0":         true,
+		"~1.2":           true,
+		">=1.0.0 <2.0.0": true,
+		"1.x":            true,
+		"*":              true,
+		"not a version":  false,
+	} {
+		assert.Equal(t, expected, IsVersionRange(version), version)
+	}
+}
+
+func TestRepoSourceType(t *testing.T) {
+	for url, expected := range map[string]string{
+		"https://charts.example.com":      SourceRepo,
+		"oci://registry.example.com/apps": SourceOCI,
+	} {
+		source := &helmfluxv1.RepoChartSource{RepoURL: url}
+		assert.Equal(t, expected, repoSourceType(source), url)
+	}
+}
+
+func TestDownloadFile(t *testing.T) {
+	defer func(b time.Duration) { downloadBackoff.Duration = b }(downloadBackoff.Duration)
+	downloadBackoff.Duration = time.Millisecond
+
+	content := bytes.Repeat([]byte("chart"), 1024)
+	sum := sha256.Sum256(content)
+	checksum := "sha256:" + hex.EncodeToString(sum[:])
+
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/missing.tgz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		// the first response is cut off half way, to be resumed
+		if requests == 1 {
+			w.Header().Set("Content-Length", "5120")
+			w.Write(content[:2048])
+			return
+		}
+		if requests == 2 {
+			assert.Equal(t, "bytes=2048-", r.Header.Get("Range"))
+			assert.Equal(t, `"v1"`, r.Header.Get("If-Range"))
+		}
+		http.ServeContent(w, r, "chart.tgz", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	base, err := ioutil.TempDir("", "download")
+	assert.NoError(t, err)
+	defer os.RemoveAll(base)
+	ws, err := NewWorkspace(base, "test", 0, nil)
+	assert.NoError(t, err)
+	defer ws.Clean()
+
+	path, err := DownloadFile(srv.URL+"/chart.tgz", checksum, base, ws, true)
+	assert.NoError(t, err)
+	assert.Equal(t, base, filepath.Dir(path))
+	b, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, content, b)
+	assert.Equal(t, 2, requests)
+
+	// a corrupted cached chart is downloaded again
+	assert.NoError(t, ioutil.WriteFile(path, []byte("corrupt"), 00644))
+	_, err = DownloadFile(srv.URL+"/chart.tgz", checksum, base, ws, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, requests)
+	b, err = ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, content, b)
+
+	// a mismatching chart is rejected
+	_, err = DownloadFile(srv.URL+"/chart.tgz", "sha256:"+hex.EncodeToString(make([]byte, 32)), base, ws, false)
+	assert.Error(t, err)
+
+	// client errors are not retried
+	requests = 0
+	_, err = DownloadFile(srv.URL+"/missing.tgz", "", base, ws, false)
+	assert.Error(t, err)
+	assert.Equal(t, 1, requests)
+}
+
+func TestDownloadFileChanged(t *testing.T) {
+	defer func(b time.Duration) { downloadBackoff.Duration = b }(downloadBackoff.Duration)
+	downloadBackoff.Duration = time.Millisecond
+
+	previous := bytes.Repeat([]byte("old"), 1024)
+	content := bytes.Repeat([]byte("new"), 1024)
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch requests {
+		case 1:
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Content-Length", "3072")
+			w.Write(previous[:1024])
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			// the file changed, so the range of the previous version is ignored
+			w.Header().Set("ETag", `"v2"`)
+			http.ServeContent(w, r, "chart.tgz", time.Time{}, bytes.NewReader(content))
+		}
+	}))
+	defer srv.Close()
+
+	base, err := ioutil.TempDir("", "download")
+	assert.NoError(t, err)
+	defer os.RemoveAll(base)
+	ws, err := NewWorkspace(base, "test", 0, nil)
+	assert.NoError(t, err)
+	defer ws.Clean()
+
+	path, err := DownloadFile(srv.URL+"/chart.tgz", "", base, ws, false)
+	assert.NoError(t, err)
+	b, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, content, b)
+	assert.Equal(t, 3, requests)
+}
+
+func TestRetryAfter(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"5", 5 * time.Second},
+		{"3600", maxRetryAfter},
+		{"-1", 0},
+		{"soon", 0},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0},
+	} {
+		header := http.Header{}
+		if tc.value != "" {
+			header.Set("Retry-After", tc.value)
+		}
+		assert.Equal(t, tc.want, retryAfter(header), tc.value)
+	}
+}
+
+func TestRangeValidator(t *testing.T) {
+	assert.Equal(t, `"v1"`, rangeValidator(http.Header{"Etag": {`"v1"`}}))
+	assert.Equal(t, "Wed, 21 Oct 2015 07:28:00 GMT", rangeValidator(http.Header{
+		"Etag":          {`W/"v1"`},
+		"Last-Modified": {"Wed, 21 Oct 2015 07:28:00 GMT"},
+	}))
+	assert.Equal(t, "", rangeValidator(http.Header{}))
+}
+
+func TestParseChecksum(t *testing.T) {
+	c, err := ParseChecksum("")
+	assert.NoError(t, err)
+	assert.Nil(t, c)
+
+	c, err = ParseChecksum("MD5:D41D8CD98F00B204E9800998ECF8427E")
+	assert.NoError(t, err)
+	assert.Equal(t, &Checksum{Algorithm: "md5", Digest: "d41d8cd98f00b204e9800998ecf8427e"}, c)
+
+	for _, s := range []string{"d41d8cd98f00b204e9800998ecf8427e", "sha1:da39a3ee5e6b4b0d3255bfef95601890afd80709", "sha256:d41d8cd98f00b204e9800998ecf8427e", "md5:xyz"} {
+		_, err := ParseChecksum(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestCacheProvenance(t *testing.T) {
+	base, err := ioutil.TempDir("", "provenance")
+	assert.NoError(t, err)
+	defer os.RemoveAll(base)
+
+	chartPath := filepath.Join(base, "app-1.0.0.tgz")
+	assert.NoError(t, ioutil.WriteFile(chartPath, []byte("chart"), 00644))
+	provPath := chartPath + ".prov"
+	assert.NoError(t, ioutil.WriteFile(provPath, []byte("signature"), 00644))
+
+	assert.NoError(t, cacheProvenance(base, chartPath, provPath))
+	cached, err := ProvenancePath(base, chartPath)
+	assert.NoError(t, err)
+	sum := sha256.Sum256([]byte("chart"))
+	assert.Equal(t, filepath.Join(base, provenanceDir, hex.EncodeToString(sum[:])+".prov"), cached)
+	b, err := ioutil.ReadFile(cached)
+	assert.NoError(t, err)
+	assert.Equal(t, "signature", string(b))
+
+	// a changed chart does not match the provenance file of its
+	// previous contents
+	assert.NoError(t, ioutil.WriteFile(chartPath, []byte("changed"), 00644))
+	changed, err := ProvenancePath(base, chartPath)
+	assert.NoError(t, err)
+	assert.NotEqual(t, cached, changed)
+	assert.False(t, fileExists(changed))
+
+	// a missing provenance file fails
+	assert.Error(t, cacheProvenance(base, chartPath, provPath))
+}
@@ -0,0 +1,154 @@
+package chartsync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	helmfluxv1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+// GitCloneOptions are the options for cloning the repository of a Git
+// chart source.
+type GitCloneOptions struct {
+	// Depth limits the cloned history to the given number of commits;
+	// the full history is cloned if 0.
+	Depth int
+	// Submodules checks out the submodules of the repository.
+	Submodules bool
+	// SparsePaths are the paths checked out of the repository; the
+	// whole working tree is checked out if empty.
+	SparsePaths []string
+	// Env is the environment git is run with, e.g. the Env of the
+	// GitCredentials of the repository.
+	Env []string
+}
+
+// CloneOptionsFor returns the clone options for the given Git chart
+// source. A sparse checkout checks out the path to the chart.
+func CloneOptionsFor(source *helmfluxv1.GitChartSource) GitCloneOptions {
+	opts := GitCloneOptions{
+		Depth:      source.Depth,
+		Submodules: source.Submodules,
+	}
+	if source.SparseCheckout {
+		if p := strings.Trim(path.Clean("/"+source.Path), "/"); p != "" {
+			opts.SparsePaths = []string{p}
+		}
+	}
+	return opts
+}
+
+// Key returns a string identifying the options, so that clones of the
+// same repository with different options are kept apart. It is empty
+// for the default options.
+func (o GitCloneOptions) Key() string {
+	var parts []string
+	if o.Depth > 0 {
+		parts = append(parts, "depth="+strconv.Itoa(o.Depth))
+	}
+	if o.Submodules {
+		parts = append(parts, "submodules")
+	}
+	if len(o.SparsePaths) > 0 {
+		parts = append(parts, "sparse="+strings.Join(o.SparsePaths, ":"))
+	}
+	return strings.Join(parts, ",")
+}
+
+// CloneArgs returns the arguments to git to clone the given ref of the
+// repository at url into dir. The ref must be a branch or tag, as the
+// history of other refs is not cloned with a limited depth.
+func (o GitCloneOptions) CloneArgs(url, ref, dir string) []string {
+	args := []string{"clone", "--single-branch"}
+	if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	if o.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(o.Depth))
+	}
+	if len(o.SparsePaths) > 0 {
+		// only fetch the blobs of the checked out paths
+		args = append(args, "--filter=blob:none", "--sparse")
+	}
+	if o.Submodules {
+		args = append(args, "--recurse-submodules")
+		if o.Depth > 0 {
+			args = append(args, "--shallow-submodules")
+		}
+	}
+	return append(args, "--", url, dir)
+}
+
+// SparseCheckoutArgs returns the arguments to git to restrict the
+// checkout of a clone to the sparse paths, or nil without them.
+func (o GitCloneOptions) SparseCheckoutArgs() []string {
+	if len(o.SparsePaths) == 0 {
+		return nil
+	}
+	return append([]string{"sparse-checkout", "set", "--cone", "--"}, o.SparsePaths...)
+}
+
+// Clone clones the given ref of the repository at url into dir, with
+// the options.
+func (o GitCloneOptions) Clone(ctx context.Context, url, ref, dir string) error {
+	if err := runGit(ctx, "", o.Env, o.CloneArgs(url, ref, dir)...); err != nil {
+		return err
+	}
+	if args := o.SparseCheckoutArgs(); args != nil {
+		if err := runGit(ctx, dir, o.Env, args...); err != nil {
+			return err
+		}
+		if o.Submodules {
+			// submodules in the sparse paths are only checked out now
+			args := []string{"submodule", "update", "--init", "--recursive"}
+			if o.Depth > 0 {
+				args = append(args, "--depth", strconv.Itoa(o.Depth))
+			}
+			return runGit(ctx, dir, o.Env, args...)
+		}
+	}
+	return nil
+}
+
+// GitHead returns the commit checked out in the Git repository at dir.
+func GitHead(ctx context.Context, dir string) (string, error) {
+	out, err := gitOutput(ctx, dir, nil, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// urlCredentials matches the credentials in URLs, to keep them out of
+// errors.
+var urlCredentials = regexp.MustCompile(`://[^/@\s]+@`)
+
+func runGit(ctx context.Context, dir string, env []string, args ...string) error {
+	_, err := gitOutput(ctx, dir, env, args...)
+	return err
+}
+
+// gitOutput runs git with the given arguments in dir, and returns its
+// standard output.
+func gitOutput(ctx context.Context, dir string, env []string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := urlCredentials.ReplaceAll(stderr.Bytes(), []byte("://***@"))
+		return nil, fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(string(msg)))
+	}
+	return out, nil
+}
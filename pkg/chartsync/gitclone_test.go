@@ -0,0 +1,68 @@
+package chartsync
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	helmfluxv1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+func TestCloneOptionsFor(t *testing.T) {
+	opts := CloneOptionsFor(&helmfluxv1.GitChartSource{Path: "./charts/podinfo/", Depth: 1, Submodules: true, SparseCheckout: true})
+	assert.Equal(t, GitCloneOptions{Depth: 1, Submodules: true, SparsePaths: []string{"charts/podinfo"}}, opts)
+	assert.Equal(t, "depth=1,submodules,sparse=charts/podinfo", opts.Key())
+
+	// the root of the repository can not be checked out sparsely
+	opts = CloneOptionsFor(&helmfluxv1.GitChartSource{Path: ".", SparseCheckout: true})
+	assert.Empty(t, opts.SparsePaths)
+	assert.Equal(t, "", opts.Key())
+}
+
+func TestGitCloneOptionsClone(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	tmp, err := ioutil.TempDir("", "gitclone")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	repo := filepath.Join(tmp, "repo")
+	git := func(dir string, args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+	assert.NoError(t, os.MkdirAll(filepath.Join(repo, "charts", "podinfo"), 00755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(repo, "docs"), 00755))
+	git(repo, "init", "-b", "main")
+	for _, content := range []string{"v1", "v2"} {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(repo, "charts", "podinfo", "Chart.yaml"), []byte(content), 00644))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(repo, "docs", "README.md"), []byte(content), 00644))
+		git(repo, "add", "-A")
+		git(repo, "commit", "-m", content)
+	}
+
+	dir := filepath.Join(tmp, "clone")
+	opts := GitCloneOptions{Depth: 1, SparsePaths: []string{"charts/podinfo"}}
+	assert.NoError(t, opts.Clone(context.Background(), "file://"+repo, "main", dir))
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "charts", "podinfo", "Chart.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", string(b))
+	_, err = os.Stat(filepath.Join(dir, "docs"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, "1", git(dir, "rev-list", "--count", "HEAD"))
+
+	head, err := GitHead(context.Background(), dir)
+	assert.NoError(t, err)
+	assert.Equal(t, git(repo, "rev-parse", "HEAD"), head)
+}
@@ -0,0 +1,50 @@
+package chartsync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	helmfluxv1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+// gitCommitFormat is the format of the commits read by GitCommitOf,
+// with fields separated by NUL characters as they can not be part of
+// a commit message.
+const gitCommitFormat = "%H%x00%an <%ae>%x00%aI%x00%s"
+
+// GitCommitOf returns the latest commit of the given revision changing
+// the given paths, of the Git repository the directory is part of. The
+// paths are relative to the directory; the whole repository is
+// considered if none are given.
+func GitCommitOf(ctx context.Context, dir, revision string, paths ...string) (*helmfluxv1.GitCommit, error) {
+	args := []string{"log", "-1", "--format=" + gitCommitFormat, revision, "--"}
+	out, err := gitOutput(ctx, dir, nil, append(args, paths...)...)
+	if err != nil {
+		return nil, err
+	}
+	return parseGitCommit(strings.TrimSpace(string(out)))
+}
+
+func parseGitCommit(line string) (*helmfluxv1.GitCommit, error) {
+	if line == "" {
+		return nil, fmt.Errorf("no commit found")
+	}
+	fields := strings.SplitN(line, "\x00", 4)
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("unexpected format of commit: %q", line)
+	}
+	t, err := time.Parse(time.RFC3339, fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("unexpected time of commit: %w", err)
+	}
+	return &helmfluxv1.GitCommit{
+		Revision: fields[0],
+		Author:   fields[1],
+		Time:     metav1.NewTime(t),
+		Subject:  fields[3],
+	}, nil
+}
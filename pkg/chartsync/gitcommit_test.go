@@ -0,0 +1,58 @@
+package chartsync
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGitCommitOf(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	repo, err := ioutil.TempDir("", "gitcommit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(repo)
+
+	git := func(date string, args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=Jane Doe", "-c", "user.email=jane@example.com"}, args...)...)
+		cmd.Dir = repo
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date)
+		out, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+	chartDir := filepath.Join(repo, "charts", "podinfo")
+	assert.NoError(t, os.MkdirAll(chartDir, 00755))
+	git("", "init", "-b", "main")
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte("v1"), 00644))
+	git("", "add", "-A")
+	git("2020-01-02T03:04:05Z", "commit", "-m", "Bump podinfo chart\n\nWith a body.")
+	chartRevision := git("", "rev-parse", "HEAD")
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(repo, "README.md"), []byte("docs"), 00644))
+	git("", "add", "-A")
+	git("", "commit", "-m", "Add docs")
+	head := git("", "rev-parse", "HEAD")
+
+	commit, err := GitCommitOf(context.Background(), chartDir, head, ".")
+	assert.NoError(t, err)
+	assert.Equal(t, chartRevision, commit.Revision)
+	assert.Equal(t, "Jane Doe <jane@example.com>", commit.Author)
+	assert.Equal(t, "Bump podinfo chart", commit.Subject)
+	assert.True(t, commit.Time.Time.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)))
+
+	commit, err = GitCommitOf(context.Background(), repo, head)
+	assert.NoError(t, err)
+	assert.Equal(t, head, commit.Revision)
+	assert.Equal(t, "Add docs", commit.Subject)
+
+	_, err = GitCommitOf(context.Background(), repo, "unknown")
+	assert.Error(t, err)
+}
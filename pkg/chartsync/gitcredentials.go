@@ -0,0 +1,270 @@
+package chartsync
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	helmfluxv1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+// The endpoints short-lived Git credentials are obtained from. These
+// are variables so they can be replaced in tests.
+var (
+	codeupTokenURL  = "https://openapi-rdc.aliyuncs.com/oauth/token"
+	codehubTokenURL = "https://iam.myhuaweicloud.com/v3.0/OS-AUTH/id-token/tokens"
+)
+
+// The environment variables the OIDC token of the service account is
+// configured with for workload identity on Huawei Cloud; on Alibaba
+// Cloud the token of RRSA is used.
+const (
+	huaweiIDTokenFileEnv = "HUAWEICLOUD_SDK_ID_TOKEN_FILE"
+	huaweiIdentityIDEnv  = "HUAWEICLOUD_SDK_IDP_ID"
+	huaweiDomainIDEnv    = "HUAWEICLOUD_SDK_DOMAIN_ID"
+)
+
+// GitCredentialHosts are the host patterns of the Git repositories
+// the short-lived credentials of a credential source may be obtained
+// for, as the credentials are those of the service account of the
+// operator. Patterns are matched against the host name of the Git URL
+// with path.Match, e.g. `codehub.devcloud.*.huaweicloud.com`.
+type GitCredentialHosts map[helmfluxv1.GitCredentialSource][]string
+
+// DefaultGitCredentialHosts are the hosts of the repositories of the
+// public Codeup and CodeHub services.
+var DefaultGitCredentialHosts = GitCredentialHosts{
+	helmfluxv1.GitCredentialsCodeup:  {"codeup.aliyun.com"},
+	helmfluxv1.GitCredentialsCodeHub: {"codehub.devcloud.*.huaweicloud.com"},
+}
+
+// allow returns an error if the credentials of the source may not be
+// obtained for the given host.
+func (h GitCredentialHosts) allow(source helmfluxv1.GitCredentialSource, host string) error {
+	for _, pattern := range h[source] {
+		if ok, _ := path.Match(pattern, host); ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("Git credential source '%s' is not allowed for host '%s'", source, host)
+}
+
+// GitProviderCredentials restricts which HelmReleases may clone Git
+// repositories with the short-lived credentials of the code services,
+// which are those of the operator itself.
+type GitProviderCredentials struct {
+	// Enabled allows the credential sources of the code services.
+	Enabled bool
+	// Namespaces are the namespaces of the HelmReleases which may use
+	// the credentials of the operator, all namespaces if empty.
+	Namespaces []string
+	// Hosts are the hosts the credentials may be obtained for.
+	Hosts GitCredentialHosts
+}
+
+// allow returns an error if a HelmRelease in the namespace may not use
+// the credentials of the source for the given host.
+func (p GitProviderCredentials) allow(source helmfluxv1.GitCredentialSource, namespace, host string) error {
+	if !p.Enabled {
+		return fmt.Errorf("Git credential source '%s' is disabled, the operator only allows credentials from Secrets", source)
+	}
+	if len(p.Namespaces) > 0 && !containsString(p.Namespaces, namespace) {
+		return fmt.Errorf("Git credential source '%s' is not allowed for HelmReleases in namespace '%s'", source, namespace)
+	}
+	return p.Hosts.allow(source, host)
+}
+
+// gitToken is a short-lived token for the HTTPS Git repositories of a
+// code service.
+type gitToken struct {
+	Username   string
+	Token      string
+	Expiration time.Time
+}
+
+// gitTokens caches the tokens by their source and Git host, as they
+// are shared by all releases with repositories on the same host.
+var gitTokens = struct {
+	sync.Mutex
+	m map[string]gitToken
+}{m: make(map[string]gitToken)}
+
+// cachedGitToken returns the cached token for the key, if it does not
+// expire within the refresh margin.
+func cachedGitToken(key string) (gitToken, bool) {
+	gitTokens.Lock()
+	defer gitTokens.Unlock()
+	token, ok := gitTokens.m[key]
+	if !ok || time.Until(token.Expiration) < credentialsRefreshMargin {
+		return gitToken{}, false
+	}
+	return token, true
+}
+
+// setGitToken caches the token for the key.
+func setGitToken(key string, token gitToken) {
+	gitTokens.Lock()
+	defer gitTokens.Unlock()
+	gitTokens.m[key] = token
+}
+
+// gitCredentialsFromProvider returns the credentials for the Git
+// repository at gitURL, with a short-lived token of the code service
+// of the given credential source added to the URL, for a HelmRelease
+// in the given namespace. The URL must be an HTTPS URL of one of the
+// allowed hosts of the credential source, so that the credentials are
+// only ever sent to the code service. Tokens are reused until they
+// expire within the refresh margin.
+func gitCredentialsFromProvider(client *http.Client, providers GitProviderCredentials, namespace, gitURL string, source helmfluxv1.GitCredentialSource) (GitCredentials, error) {
+	var exchange func(client *http.Client, host string) (gitToken, error)
+	switch source {
+	case helmfluxv1.GitCredentialsCodeup:
+		exchange = codeupToken
+	case helmfluxv1.GitCredentialsCodeHub:
+		exchange = codehubToken
+	default:
+		return GitCredentials{}, fmt.Errorf("unsupported Git credential source '%s'", source)
+	}
+	u, err := url.Parse(gitURL)
+	if err != nil || u.Scheme != "https" {
+		return GitCredentials{}, fmt.Errorf("Git credential source '%s' requires an HTTPS URL, got '%s'", source, gitURL)
+	}
+	if err := providers.allow(source, namespace, u.Hostname()); err != nil {
+		return GitCredentials{}, err
+	}
+
+	key := string(source) + "/" + u.Host
+	token, ok := cachedGitToken(key)
+	if !ok {
+		if token, err = exchange(client, u.Host); err != nil {
+			return GitCredentials{}, fmt.Errorf("failed to obtain %s credentials: %w", source, err)
+		}
+		setGitToken(key, token)
+	}
+	u.User = url.UserPassword(token.Username, token.Token)
+	return GitCredentials{URL: u.String(), Expiration: token.Expiration}, nil
+}
+
+// codeupToken exchanges the RRSA OIDC token of the service account
+// for an access token of Alibaba Cloud Codeup scoped to the given
+// host, with an OAuth 2.0 token exchange.
+func codeupToken(client *http.Client, host string) (gitToken, error) {
+	idToken, err := readIDToken(aliyunOIDCTokenFileEnv)
+	if err != nil {
+		return gitToken{}, err
+	}
+	resp, err := client.PostForm(codeupTokenURL, url.Values{
+		"grant_type":         {"urn:ietf:params:oauth:grant-type:token-exchange"},
+		"subject_token":      {idToken},
+		"subject_token_type": {"urn:ietf:params:oauth:token-type:jwt"},
+		"audience":           {host},
+	})
+	if err != nil {
+		return gitToken{}, err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return gitToken{}, fmt.Errorf("failed to decode token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || result.AccessToken == "" {
+		return gitToken{}, fmt.Errorf("token exchange failed with status %d: %s %s", resp.StatusCode, result.Error, result.ErrorDescription)
+	}
+	return gitToken{
+		Username:   "oauth2",
+		Token:      result.AccessToken,
+		Expiration: time.Now().Add(time.Duration(result.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// codehubToken exchanges the OIDC token of the service account for a
+// federated IAM token of Huawei Cloud, which CodeHub accepts for HTTPS
+// Git operations.
+func codehubToken(client *http.Client, _ string) (gitToken, error) {
+	idToken, err := readIDToken(huaweiIDTokenFileEnv)
+	if err != nil {
+		return gitToken{}, err
+	}
+	identityID, domainID := os.Getenv(huaweiIdentityIDEnv), os.Getenv(huaweiDomainIDEnv)
+	if identityID == "" || domainID == "" {
+		return gitToken{}, fmt.Errorf("workload identity requires the %s and %s environment variables", huaweiIdentityIDEnv, huaweiDomainIDEnv)
+	}
+	var body struct {
+		Auth struct {
+			IDToken struct {
+				ID string `json:"id"`
+			} `json:"id_token"`
+			Scope struct {
+				Domain struct {
+					ID string `json:"id"`
+				} `json:"domain"`
+			} `json:"scope"`
+		} `json:"auth"`
+	}
+	body.Auth.IDToken.ID = idToken
+	body.Auth.Scope.Domain.ID = domainID
+	b, err := json.Marshal(body)
+	if err != nil {
+		return gitToken{}, err
+	}
+	req, err := http.NewRequest(http.MethodPost, codehubTokenURL, bytes.NewReader(b))
+	if err != nil {
+		return gitToken{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Idp-Id", identityID)
+	resp, err := client.Do(req)
+	if err != nil {
+		return gitToken{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return gitToken{}, fmt.Errorf("token request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	var result struct {
+		Token struct {
+			ExpiresAt string `json:"expires_at"`
+		} `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return gitToken{}, fmt.Errorf("failed to decode token: %w", err)
+	}
+	token := resp.Header.Get("X-Subject-Token")
+	if token == "" {
+		return gitToken{}, fmt.Errorf("no token returned")
+	}
+	expires, err := time.Parse(time.RFC3339Nano, result.Token.ExpiresAt)
+	if err != nil {
+		return gitToken{}, fmt.Errorf("invalid token expiration '%s': %w", result.Token.ExpiresAt, err)
+	}
+	return gitToken{Username: "token", Token: token, Expiration: expires}, nil
+}
+
+// readIDToken reads the OIDC token of the service account from the
+// file configured by the given environment variable; the token is
+// rotated by the kubelet, so it is read every time.
+func readIDToken(fileEnv string) (string, error) {
+	file := os.Getenv(fileEnv)
+	if file == "" {
+		return "", fmt.Errorf("workload identity requires the %s environment variable", fileEnv)
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read OIDC token: %w", err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
@@ -0,0 +1,100 @@
+package chartsync
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+// RepoIndexCache is a thread-safe cache for the indexes of chart
+// repositories. Entries expire after the TTL, and the least recently
+// used entries are evicted once the cache holds more than the maximum
+// amount of entries. Concurrent requests for the same index result in
+// a single fetch.
+type RepoIndexCache struct {
+	ttl     time.Duration
+	maxSize int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+var _ helm.IndexCache = &RepoIndexCache{}
+
+type indexEntry struct {
+	key string
+
+	mu      sync.Mutex
+	value   interface{}
+	fetched time.Time
+}
+
+// NewRepoIndexCache returns a new cache with the given TTL and maximum
+// amount of entries. A maxSize of 0 does not limit the amount of
+// entries.
+func NewRepoIndexCache(ttl time.Duration, maxSize int) *RepoIndexCache {
+	return &RepoIndexCache{
+		ttl:     ttl,
+		maxSize: maxSize,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Get returns the cached index for the given key, calling fetch if it
+// is not cached or has expired. Failed fetches are not cached.
+func (c *RepoIndexCache) Get(key string, fetch func() (interface{}, error)) (interface{}, error) {
+	entry := c.entry(key)
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if !entry.fetched.IsZero() && time.Since(entry.fetched) < c.ttl {
+		ObserveIndexCache(true)
+		return entry.value, nil
+	}
+	ObserveIndexCache(false)
+	value, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	entry.value, entry.fetched = value, time.Now()
+	return value, nil
+}
+
+// Invalidate marks the cached index for the given key as expired, so
+// the next Get fetches it again. It waits for a fetch in progress.
+func (c *RepoIndexCache) Invalidate(key string) {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	entry := e.Value.(*indexEntry)
+	entry.mu.Lock()
+	entry.fetched = time.Time{}
+	entry.mu.Unlock()
+}
+
+// entry returns the entry for the given key, creating it if it does
+// not exist, and marks it as most recently used.
+func (c *RepoIndexCache) entry(key string) *indexEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(e)
+		return e.Value.(*indexEntry)
+	}
+	entry := &indexEntry{key: key}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.maxSize > 0 && c.lru.Len() > c.maxSize {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*indexEntry).key)
+	}
+	cachedIndexes.Set(float64(c.lru.Len()))
+	return entry
+}
@@ -0,0 +1,69 @@
+package chartsync
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepoIndexCache(t *testing.T) {
+	var fetches int
+	fetch := func(v string) func() (interface{}, error) {
+		return func() (interface{}, error) {
+			fetches++
+			return v, nil
+		}
+	}
+
+	c := NewRepoIndexCache(time.Hour, 2)
+	v, err := c.Get("a", fetch("a1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "a1", v)
+	v, _ = c.Get("a", fetch("a2"))
+	assert.Equal(t, "a1", v)
+	assert.Equal(t, 1, fetches)
+
+	// failed fetches are not cached
+	_, err = c.Get("b", func() (interface{}, error) { return nil, errors.New("unavailable") })
+	assert.Error(t, err)
+	v, _ = c.Get("b", fetch("b1"))
+	assert.Equal(t, "b1", v)
+	assert.Equal(t, 2, fetches)
+
+	// "a" is the least recently used entry and gets evicted
+	c.Get("c", fetch("c1"))
+	v, _ = c.Get("a", fetch("a3"))
+	assert.Equal(t, "a3", v)
+	assert.Equal(t, 4, fetches)
+
+	// expired entries are fetched again
+	c = NewRepoIndexCache(0, 0)
+	c.Get("a", fetch("a4"))
+	v, _ = c.Get("a", fetch("a5"))
+	assert.Equal(t, "a5", v)
+	assert.Equal(t, 6, fetches)
+}
+
+func TestRepoIndexCacheInvalidate(t *testing.T) {
+	var fetches int
+	fetch := func() (interface{}, error) {
+		fetches++
+		return fetches, nil
+	}
+
+	c := NewRepoIndexCache(time.Hour, 0)
+	// invalidating an unknown key is a no-op
+	c.Invalidate("a")
+	v, _ := c.Get("a", fetch)
+	assert.Equal(t, 1, v)
+	v, _ = c.Get("a", fetch)
+	assert.Equal(t, 1, v)
+
+	c.Invalidate("a")
+	v, _ = c.Get("a", fetch)
+	assert.Equal(t, 2, v)
+	v, _ = c.Get("a", fetch)
+	assert.Equal(t, 2, v)
+}
@@ -0,0 +1,113 @@
+package chartsync
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	LabelHit     = "hit"
+	LabelReason  = "reason"
+	LabelSource  = "source"
+	LabelSuccess = "success"
+)
+
+// The types of chart sources, the values of the source label.
+const (
+	SourceGit       = "git"
+	SourceRepo      = "repo"
+	SourceOCI       = "oci"
+	SourceOss       = "oss"
+	SourceCustomize = "customize"
+)
+
+var (
+	indexCacheRequests = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "repository_index_cache_requests_total",
+		Help:      "Count of chart repository index cache requests, by hit or miss.",
+	}, []string{LabelHit})
+	cachedIndexes = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "repository_index_cache_size",
+		Help:      "Count of chart repository indexes held in the cache.",
+	}, []string{})
+	chartCacheSize = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "chart_cache_size_bytes",
+		Help:      "Size of the chart archives held in the chart cache.",
+	}, []string{})
+	chartCacheArchives = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "chart_cache_archives",
+		Help:      "Count of chart archives held in the chart cache.",
+	}, []string{})
+	chartCacheEvictions = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "chart_cache_evictions_total",
+		Help:      "Count of chart archives evicted from the chart cache, by reason.",
+	}, []string{LabelReason})
+	chartFetchDuration = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "chart_fetch_duration_seconds",
+		Help:      "Chart fetch duration in seconds, by source type.",
+		Buckets:   []float64{0.1, 0.5, 1, 5, 10, 30, 60, 120, 300},
+	}, []string{LabelSource, LabelSuccess})
+	chartFetchBytes = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "chart_fetch_bytes_total",
+		Help:      "Count of bytes of fetched charts, by source type.",
+	}, []string{LabelSource})
+	chartFetchFailures = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "chart_fetch_failures_total",
+		Help:      "Count of failed chart fetches, by source type.",
+	}, []string{LabelSource})
+	chartCacheRequests = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "chart_cache_requests_total",
+		Help:      "Count of chart cache requests, by source type and hit or miss.",
+	}, []string{LabelSource, LabelHit})
+)
+
+func ObserveIndexCache(hit bool) {
+	indexCacheRequests.With(LabelHit, fmt.Sprint(hit)).Add(1)
+}
+
+func ObserveCache(archives int, size int64) {
+	chartCacheArchives.Set(float64(archives))
+	chartCacheSize.Set(float64(size))
+}
+
+func ObserveCacheEviction(reason string) {
+	chartCacheEvictions.With(LabelReason, reason).Add(1)
+}
+
+// ObserveChartFetch records a fetch of a chart from the given source
+// type which started at start, and failed if err is not nil.
+func ObserveChartFetch(source string, start time.Time, err error) {
+	chartFetchDuration.With(LabelSource, source, LabelSuccess, fmt.Sprint(err == nil)).Observe(time.Since(start).Seconds())
+	if err != nil {
+		chartFetchFailures.With(LabelSource, source).Add(1)
+	}
+}
+
+func ObserveChartFetchBytes(source string, n int64) {
+	chartFetchBytes.With(LabelSource, source).Add(float64(n))
+}
+
+func ObserveChartCache(source string, hit bool) {
+	chartCacheRequests.With(LabelSource, source, LabelHit, fmt.Sprint(hit)).Add(1)
+}
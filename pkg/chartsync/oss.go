@@ -1,180 +1,502 @@
 package chartsync
 
 import (
+	"bytes"
 	"crypto/aes"
 	"encoding/base64"
 	"fmt"
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
 	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/messages"
 	"github.com/huaweicloud/huaweicloud-sdk-go-obs/obs"
-	"k8s.io/klog"
+	"io/ioutil"
 	"os"
-	"path/filepath"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/klog"
+	"net/http"
+	"strings"
 )
 
 const (
-	//Ali 阿里云
+	// Ali is Alibaba Cloud Object Storage Service
 	Ali = "aliyun"
-	//Huawei 华为云
+	// Huawei is Huawei Cloud Object Storage Service
 	Huawei = "huaweiyun"
 )
 
-func NewProvider(oss *v1.Oss, base string) (Provider, error) {
+// ProviderConfig is the configuration of the operator for the object
+// storage sources of all releases.
+type ProviderConfig struct {
+	// DecryptionKey is used to decrypt the credentials of sources
+	// which reference no decryption key themselves.
+	DecryptionKey []byte
+	// Ambient restricts the sources which may use the credentials of
+	// the operator itself.
+	Ambient AmbientCredentials
+}
+
+// NewProvider returns the Provider for the cloud provider of the given
+// object storage source. Credentials read from Secrets and decryption
+// keys referenced by the source are read from the given namespace.
+func NewProvider(coreV1Client corev1client.CoreV1Interface, namespace string, oss *v1.Oss, config ProviderConfig,
+	base string, ws *Workspace) (Provider, error) {
+	source := ossSource{
+		Oss:           oss,
+		base:          base,
+		ws:            ws,
+		coreV1Client:  coreV1Client,
+		namespace:     namespace,
+		decryptionKey: config.DecryptionKey,
+		ambient:       config.Ambient,
+	}
 	switch oss.CloudProvider {
 	case Ali:
-		return &aliImpl{
-			Oss:  oss,
-			base: base,
-		}, nil
+		return &aliImpl{source}, nil
 	case Huawei:
-		return &huaweiImpl{
-			Oss:  oss,
-			base: base,
-		}, nil
+		return &huaweiImpl{source}, nil
 	}
 	return nil, ChartUnavailableError{fmt.Errorf("unknown cloudProvider :%s", oss.CloudProvider)}
 }
 
 type Provider interface {
-	//DownloadFile 将对象存储中的文件下载到本地
-	//返回文件缓存目录
-	//useCache 表示使用缓存
+	// DownloadFile downloads the file from the object storage, and
+	// returns the path to the local file. With useCache, a previously
+	// downloaded file is used if present.
 	DownloadFile(useCache bool) (string, error)
-	//Endpoint 将region转换为oss endpoint
+	// DownloadValuesFile downloads the values file from the object
+	// storage, like DownloadFile. As the values file has no checksum,
+	// a previously downloaded file is revalidated against the ETag or
+	// Last-Modified of the object.
+	DownloadValuesFile(useCache bool) (string, error)
+	// Endpoint returns the object storage endpoint for the region.
 	Endpoint(regionId string) string
+	// Credentials returns the credentials to access the object
+	// storage with, from the configured credential source. Temporary
+	// credentials are refreshed before they expire.
+	Credentials() (Credentials, error)
 }
 
+// ossPartSize is the size of the parts objects are downloaded in, and
+// thus the granularity at which downloads are resumed.
+const ossPartSize = 5 << 20
+
 var (
 	_ Provider = new(aliImpl)
 	_ Provider = new(huaweiImpl)
 )
 
-type aliImpl struct {
+// ossSource holds the object storage source of a release, with what
+// is needed to obtain its credentials.
+type ossSource struct {
 	*v1.Oss
-	base string
+	base          string
+	ws            *Workspace
+	coreV1Client  corev1client.CoreV1Interface
+	namespace     string
+	decryptionKey []byte
+	ambient       AmbientCredentials
 }
 
-func (a *aliImpl) DownloadFile(useCache bool) (string, error) {
-	cachePath := filepath.Join(a.base, base64.URLEncoding.EncodeToString([]byte(a.Key)))
-	if useCache {
-		klog.Infof("cache used,key: %s,path:%s", a.Key, cachePath)
-		_, err := os.Stat(cachePath)
-		//文件存在
-		if err == nil {
-			return cachePath, nil
+// endpoint returns the URL of the endpoint with the given default
+// host, applying the custom endpoint and scheme of the source.
+func (s *ossSource) endpoint(host string) string {
+	if e := s.CustomEndpoint; e != "" {
+		if strings.Contains(e, "://") {
+			return e
 		}
+		host = e
 	}
+	if s.UseHTTPS {
+		return "https://" + host
+	}
+	return "http://" + host
+}
+
+// ossCachePath returns the path to the file in the cache at base for
+// the object with the given key of the object storage source. Objects
+// are identified by the cloud provider, region, endpoint and bucket
+// along with their key, and are cached per namespace, so they are not
+// served to HelmReleases without access to the credentials.
+func ossCachePath(base, namespace string, source *v1.Oss, key string) string {
+	id := fmt.Sprintf("%s://%s/%s/%s/%s#%s", source.CloudProvider, source.RegionId, source.CustomEndpoint, source.Bucket, key, namespace)
+	return cacheFilePath(base, id)
+}
 
-	err := AckDecode(a.Oss)
+// ossValidatorPath returns the path to the file in the cache at base
+// holding the validator of the cached object with the given key.
+func ossValidatorPath(base, namespace string, source *v1.Oss, key string) string {
+	return ossCachePath(base, namespace, source, key+"#validator")
+}
+
+// objectValidator returns the validator of an object to revalidate a
+// cached copy with: its ETag, or else its Last-Modified time.
+func objectValidator(etag, lastModified string) string {
+	if etag != "" {
+		return "etag:" + etag
+	}
+	if lastModified != "" {
+		return "last-modified:" + lastModified
+	}
+	return ""
+}
+
+// downloadRevalidated downloads the object with the given key without
+// a checksum using download. A cached copy is only used while the
+// validator recorded along with it matches the current validator of
+// the object, as objects may change under the same key; objects
+// without a validator are never served from the cache.
+func (s *ossSource) downloadRevalidated(key string, useCache bool, validator func(key string) (string, error),
+	download func(key, checksum string, useCache bool) (string, error)) (string, error) {
+	if !useCache {
+		return download(key, "", false)
+	}
+	current, err := validator(key)
+	if err != nil {
+		return "", ChartUnavailableError{fmt.Errorf("failed to get metadata of object '%s': %w", key, err)}
+	}
+	if current == "" {
+		return download(key, "", false)
+	}
+	validatorPath := ossValidatorPath(s.base, s.namespace, s.Oss, key)
+	if recorded, err := ioutil.ReadFile(validatorPath); err != nil || string(recorded) != current {
+		os.Remove(ossCachePath(s.base, s.namespace, s.Oss, key))
+	}
+	path, err := download(key, "", true)
 	if err != nil {
 		return "", err
 	}
-	client, err := oss.New(a.Endpoint(a.RegionId), a.AckId, a.AckSecret)
+	if err := ioutil.WriteFile(validatorPath, []byte(current), 00640); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+type aliImpl struct {
+	ossSource
+}
+
+func (a *aliImpl) DownloadFile(useCache bool) (string, error) {
+	return a.download(a.Key, a.Checksum, useCache)
+}
+
+func (a *aliImpl) DownloadValuesFile(useCache bool) (string, error) {
+	return a.downloadRevalidated(a.ValuesKey, useCache, a.validator, a.download)
+}
+
+// validator returns the validator of the object with the given key.
+func (a *aliImpl) validator(key string) (string, error) {
+	bucket, err := a.bucket()
 	if err != nil {
-		return "", ChartUnavailableError{err}
+		return "", err
+	}
+	header, err := bucket.GetObjectMeta(key)
+	if err != nil {
+		return "", err
 	}
+	return objectValidator(header.Get("ETag"), header.Get("Last-Modified")), nil
+}
 
+// bucket returns the client for the bucket of the source.
+func (a *aliImpl) bucket() (*oss.Bucket, error) {
+	creds, err := a.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	var options []oss.ClientOption
+	if t := a.ws.Transport(); t != nil {
+		options = append(options, oss.HTTPClient(&http.Client{Transport: t}))
+	}
+	if creds.SecurityToken != "" {
+		options = append(options, oss.SecurityToken(creds.SecurityToken))
+	}
+	client, err := oss.New(a.Endpoint(a.RegionId), creds.AccessKeyID, creds.AccessKeySecret, options...)
+	if err != nil {
+		return nil, ChartUnavailableError{err}
+	}
 	bucket, err := client.Bucket(a.Bucket)
 	if err != nil {
-		return "", ChartUnavailableError{err}
+		return nil, ChartUnavailableError{err}
 	}
+	return bucket, nil
+}
 
-	err = bucket.GetObjectToFile(a.Key, cachePath)
+// download downloads the object with the given key, verifying it
+// against the checksum if given.
+func (a *aliImpl) download(key, checksum string, useCache bool) (string, error) {
+	sum, err := ParseChecksum(checksum)
 	if err != nil {
 		return "", ChartUnavailableError{err}
 	}
-	return cachePath, nil
+	cachePath := ossCachePath(a.base, a.namespace, a.Oss, key)
+	if useCache {
+		klog.Info(messages.Get(messages.ChartCacheUsed, key, cachePath))
+	}
+
+	return a.ws.FetchVerified(SourceOss, cachePath, useCache, sum.verifier(), func(dest string) error {
+		bucket, err := a.bucket()
+		if err != nil {
+			return err
+		}
+
+		// the checkpoint resumes the download on retries, and the
+		// SDK verifies the CRC64 of the object
+		err = retryDownload(func() error {
+			err := bucket.DownloadFile(key, dest, ossPartSize, oss.Checkpoint(true, dest+".cp"))
+			if e, ok := err.(oss.ServiceError); ok && e.StatusCode >= 400 && e.StatusCode < 500 {
+				return permanentError{err}
+			}
+			return err
+		})
+		if err != nil {
+			return ChartUnavailableError{err}
+		}
+		return nil
+	})
 }
 
 func (a *aliImpl) Endpoint(regionId string) string {
-	return fmt.Sprintf("http://%s.aliyuncs.com", regionId)
+	if a.Internal {
+		return a.endpoint(fmt.Sprintf("%s-internal.aliyuncs.com", regionId))
+	}
+	return a.endpoint(fmt.Sprintf("%s.aliyuncs.com", regionId))
 }
 
 type huaweiImpl struct {
-	*v1.Oss
-	base string
+	ossSource
 }
 
 func (h *huaweiImpl) DownloadFile(useCache bool) (string, error) {
-	cachePath := filepath.Join(h.base, base64.URLEncoding.EncodeToString([]byte(h.Key)))
-	if useCache {
-		klog.Infof("cache used,key: %s,path:%s", h.Key, cachePath)
-		_, err := os.Stat(cachePath)
-		//文件存在
-		if err == nil {
-			return cachePath, nil
-		}
-	}
+	return h.download(h.Key, h.Checksum, useCache)
+}
 
-	err := AckDecode(h.Oss)
+func (h *huaweiImpl) DownloadValuesFile(useCache bool) (string, error) {
+	return h.downloadRevalidated(h.ValuesKey, useCache, h.validator, h.download)
+}
+
+// validator returns the validator of the object with the given key.
+func (h *huaweiImpl) validator(key string) (string, error) {
+	client, err := h.client()
 	if err != nil {
 		return "", err
 	}
-	client, err := obs.New(h.AckId, h.AckSecret, h.Endpoint(h.RegionId))
+	defer client.Close()
+	output, err := client.GetObjectMetadata(&obs.GetObjectMetadataInput{Bucket: h.Bucket, Key: key})
 	if err != nil {
-		return "", ChartUnavailableError{err}
+		return "", err
 	}
+	var lastModified string
+	if !output.LastModified.IsZero() {
+		lastModified = output.LastModified.UTC().Format(http.TimeFormat)
+	}
+	return objectValidator(output.ETag, lastModified), nil
+}
 
-	defer client.Close()
-	_, err = client.DownloadFile(&obs.DownloadFileInput{
-		GetObjectMetadataInput: obs.GetObjectMetadataInput{
-			Bucket: h.Bucket,
-			Key:    h.Key,
-		},
-		DownloadFile: cachePath,
-	})
+// client returns the client for the object storage of the source.
+func (h *huaweiImpl) client() (*obs.ObsClient, error) {
+	creds, err := h.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	var client *obs.ObsClient
+	if t := h.ws.Transport(); t != nil {
+		client, err = obs.New(creds.AccessKeyID, creds.AccessKeySecret, h.Endpoint(h.RegionId),
+			obs.WithSecurityToken(creds.SecurityToken), obs.WithHttpTransport(t))
+	} else {
+		client, err = obs.New(creds.AccessKeyID, creds.AccessKeySecret, h.Endpoint(h.RegionId),
+			obs.WithSecurityToken(creds.SecurityToken))
+	}
+	if err != nil {
+		return nil, ChartUnavailableError{err}
+	}
+	return client, nil
+}
+
+// download downloads the object with the given key, verifying it
+// against the checksum if given.
+func (h *huaweiImpl) download(key, checksum string, useCache bool) (string, error) {
+	sum, err := ParseChecksum(checksum)
 	if err != nil {
 		return "", ChartUnavailableError{err}
 	}
-	return cachePath, nil
+	cachePath := ossCachePath(h.base, h.namespace, h.Oss, key)
+	if useCache {
+		klog.Info(messages.Get(messages.ChartCacheUsed, key, cachePath))
+	}
+
+	return h.ws.FetchVerified(SourceOss, cachePath, useCache, sum.verifier(), func(dest string) error {
+		client, err := h.client()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		// the checkpoint resumes the download on retries
+		err = retryDownload(func() error {
+			_, err := client.DownloadFile(&obs.DownloadFileInput{
+				GetObjectMetadataInput: obs.GetObjectMetadataInput{
+					Bucket: h.Bucket,
+					Key:    key,
+				},
+				DownloadFile:     dest,
+				PartSize:         ossPartSize,
+				EnableCheckpoint: true,
+				CheckpointFile:   dest + ".checkpoint",
+			})
+			if e, ok := err.(obs.ObsError); ok && e.StatusCode >= 400 && e.StatusCode < 500 {
+				return permanentError{err}
+			}
+			return err
+		})
+		if err != nil {
+			return ChartUnavailableError{err}
+		}
+		return nil
+	})
 }
 
 func (h *huaweiImpl) Endpoint(regionId string) string {
-	return fmt.Sprintf("http://obs.%s.myhuaweicloud.com", regionId)
+	return h.endpoint(fmt.Sprintf("obs.%s.myhuaweicloud.com", regionId))
 }
 
-func AckDecode(oss *v1.Oss) error {
-	if oss.AckEncrypted {
-		ackId, err := Decrypt(oss.AckId)
+// defaultDecryptionKeyKey is the key of the AES key in the Secret
+// referenced by the decryption key reference if no key is given.
+const defaultDecryptionKeyKey = "key"
+
+// staticCredentials returns the credentials for the object storage,
+// read from the referenced Secret or the source itself, and decrypted
+// if they are encrypted.
+func (s *ossSource) staticCredentials() (Credentials, error) {
+	creds := Credentials{AccessKeyID: s.AckId, AccessKeySecret: s.AckSecret}
+	if ref := s.SecretRef; ref != nil {
+		secret, err := s.coreV1Client.Secrets(s.namespace).Get(ref.Name, metav1.GetOptions{})
 		if err != nil {
-			return err
+			return Credentials{}, fmt.Errorf("failed to get object storage credentials: %w", err)
 		}
-		ackSecret, err := Decrypt(oss.AckSecret)
-		if err != nil {
-			return err
+		creds = Credentials{
+			AccessKeyID:     string(secret.Data["ackId"]),
+			AccessKeySecret: string(secret.Data["ackSecret"]),
+			SecurityToken:   string(secret.Data["securityToken"]),
+		}
+		if creds.AccessKeyID == "" || creds.AccessKeySecret == "" {
+			return Credentials{}, fmt.Errorf("Secret '%s' must hold both an ackId and ackSecret", ref.Name)
 		}
+	}
+	if !s.AckEncrypted {
+		return creds, nil
+	}
 
-		oss.AckId = ackId
-		oss.AckSecret = ackSecret
+	key, err := s.key()
+	if err != nil {
+		return Credentials{}, err
+	}
+	if creds.AccessKeyID, err = Decrypt(creds.AccessKeyID, key); err != nil {
+		return Credentials{}, fmt.Errorf("failed to decrypt object storage credentials: %w", err)
 	}
-	return nil
+	if creds.AccessKeySecret, err = Decrypt(creds.AccessKeySecret, key); err != nil {
+		return Credentials{}, fmt.Errorf("failed to decrypt object storage credentials: %w", err)
+	}
+	return creds, nil
+}
+
+// DecryptOssCredentials returns the decrypted inline credentials of
+// the given object storage source, using the key referenced by the
+// source or else decryptionKey.
+func DecryptOssCredentials(coreV1Client corev1client.CoreV1Interface, namespace string, oss *v1.Oss, decryptionKey []byte) (Credentials, error) {
+	source := ossSource{Oss: oss, coreV1Client: coreV1Client, namespace: namespace, decryptionKey: decryptionKey}
+	return source.staticCredentials()
 }
 
-func Decrypt(encrypted string) (string, error) {
-	defer func() {
-		if err := recover(); err != nil {
-			klog.Error(err)
+// key returns the AES key to decrypt the credentials with, read from
+// the Secret referenced by the source or else the configured key.
+func (s *ossSource) key() ([]byte, error) {
+	ref := s.DecryptionKeyRef
+	if ref == nil {
+		if len(s.decryptionKey) == 0 {
+			return nil, fmt.Errorf("no key configured to decrypt the object storage credentials with")
 		}
-	}()
+		return s.decryptionKey, nil
+	}
+	if ref.Namespace != "" && ref.Namespace != s.namespace {
+		return nil, fmt.Errorf("decryption key Secret '%s' must be in the namespace of the HelmRelease", ref.Name)
+	}
+	k := ref.Key
+	if k == "" {
+		k = defaultDecryptionKeyKey
+	}
+	secret, err := s.coreV1Client.Secrets(s.namespace).Get(ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get decryption key Secret '%s': %w", ref.Name, err)
+	}
+	data, ok := secret.Data[k]
+	if !ok {
+		return nil, fmt.Errorf("key '%s' not found in decryption key Secret '%s'", k, ref.Name)
+	}
+	key := trimKey(data)
+	if err := validateKey(key); err != nil {
+		return nil, fmt.Errorf("invalid decryption key in Secret '%s': %w", ref.Name, err)
+	}
+	return key, nil
+}
+
+// ReadDecryptionKey reads the AES key to decrypt object storage
+// credentials with from the file at the given path. A trailing
+// newline is ignored.
+func ReadDecryptionKey(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key := trimKey(data)
+	if err := validateKey(key); err != nil {
+		return nil, fmt.Errorf("invalid decryption key in '%s': %w", path, err)
+	}
+	return key, nil
+}
+
+func trimKey(data []byte) []byte {
+	return bytes.TrimRight(data, "\r\n")
+}
+
+func validateKey(key []byte) error {
+	switch len(key) {
+	case 16, 24, 32:
+		return nil
+	}
+	return fmt.Errorf("AES keys must be 16, 24 or 32 bytes, got %d", len(key))
+}
+
+// Decrypt decrypts the given base64 encoded, AES encrypted string
+// with the given key.
+func Decrypt(encrypted string, key []byte) (string, error) {
 	bytes, err := base64.StdEncoding.DecodeString(encrypted)
 	if err != nil {
 		return "", err
 	}
-	k := []byte("2367943245267894")
-	decrypted := AESDecrypt(bytes, k)
+	decrypted, err := AESDecrypt(bytes, key)
+	if err != nil {
+		return "", err
+	}
 	return string(decrypted), nil
 }
 
-func AESDecrypt(encrypted []byte, key []byte) (decrypted []byte) {
-	cipher, _ := aes.NewCipher(key)
-	decrypted = make([]byte, len(encrypted))
-	//
-	for bs, be := 0, cipher.BlockSize(); bs < len(encrypted); bs, be = bs+cipher.BlockSize(), be+cipher.BlockSize() {
-		cipher.Decrypt(decrypted[bs:be], encrypted[bs:be])
+// AESDecrypt decrypts the given AES-ECB encrypted bytes with the given
+// key, and removes the PKCS#7 padding.
+func AESDecrypt(encrypted []byte, key []byte) ([]byte, error) {
+	cipher, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	bs := cipher.BlockSize()
+	if len(encrypted) == 0 || len(encrypted)%bs != 0 {
+		return nil, fmt.Errorf("encrypted data is not a multiple of the block size")
+	}
+	decrypted := make([]byte, len(encrypted))
+	for start := 0; start < len(encrypted); start += bs {
+		cipher.Decrypt(decrypted[start:start+bs], encrypted[start:start+bs])
 	}
-	trim := 0
-	if len(decrypted) > 0 {
-		trim = len(decrypted) - int(decrypted[len(decrypted)-1])
+	padding := int(decrypted[len(decrypted)-1])
+	if padding == 0 || padding > bs {
+		return nil, fmt.Errorf("invalid padding, the key is likely wrong")
 	}
-	return decrypted[:trim]
+	return decrypted[:len(decrypted)-padding], nil
 }
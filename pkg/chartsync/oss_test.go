@@ -0,0 +1,239 @@
+package chartsync
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+// encrypt is the inverse of Decrypt.
+func encrypt(t *testing.T, plain string, key []byte) string {
+	c, err := aes.NewCipher(key)
+	assert.NoError(t, err)
+	bs := c.BlockSize()
+	padding := bs - len(plain)%bs
+	data := append([]byte(plain), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	encrypted := make([]byte, len(data))
+	for start := 0; start < len(data); start += bs {
+		c.Encrypt(encrypted[start:start+bs], data[start:start+bs])
+	}
+	return base64.StdEncoding.EncodeToString(encrypted)
+}
+
+func TestDecrypt(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	for _, plain := range []string{"", "id", "exactly16bytes!!", "a somewhat longer access key secret"} {
+		decrypted, err := Decrypt(encrypt(t, plain, key), key)
+		assert.NoError(t, err)
+		assert.Equal(t, plain, decrypted)
+	}
+
+	_, err := Decrypt(encrypt(t, "id", key), []byte("short"))
+	assert.Error(t, err)
+	_, err = Decrypt(base64.StdEncoding.EncodeToString([]byte("not a block")), key)
+	assert.Error(t, err)
+}
+
+func TestOssStaticCredentials(t *testing.T) {
+	operatorKey := []byte("0123456789abcdef")
+	releaseKey := []byte("fedcba9876543210fedcba98")
+	client := fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "oss", Namespace: "flux"},
+			Data:       map[string][]byte{"ackId": []byte("secret-id"), "ackSecret": []byte("secret-secret")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "oss-encrypted", Namespace: "flux"},
+			Data: map[string][]byte{
+				"ackId":     []byte(encrypt(t, "secret-id", releaseKey)),
+				"ackSecret": []byte(encrypt(t, "secret-secret", releaseKey)),
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "oss-key", Namespace: "flux"},
+			Data:       map[string][]byte{"key": append(releaseKey, '\n')},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "oss-incomplete", Namespace: "flux"},
+			Data:       map[string][]byte{"ackId": []byte("secret-id")},
+		},
+	)
+
+	for _, tc := range []struct {
+		name       string
+		oss        v1.Oss
+		key        []byte
+		wantId     string
+		wantSecret string
+		wantErr    bool
+	}{
+		{
+			name:       "inline",
+			oss:        v1.Oss{AckId: "id", AckSecret: "secret"},
+			wantId:     "id",
+			wantSecret: "secret",
+		},
+		{
+			name:       "inline encrypted with operator key",
+			oss:        v1.Oss{AckId: encrypt(t, "id", operatorKey), AckSecret: encrypt(t, "secret", operatorKey), AckEncrypted: true},
+			key:        operatorKey,
+			wantId:     "id",
+			wantSecret: "secret",
+		},
+		{
+			name:    "encrypted without key",
+			oss:     v1.Oss{AckId: encrypt(t, "id", operatorKey), AckSecret: encrypt(t, "secret", operatorKey), AckEncrypted: true},
+			wantErr: true,
+		},
+		{
+			name:       "secret",
+			oss:        v1.Oss{AckId: "ignored", SecretRef: &v1.LocalObjectReference{Name: "oss"}},
+			wantId:     "secret-id",
+			wantSecret: "secret-secret",
+		},
+		{
+			name: "secret encrypted with release key",
+			oss: v1.Oss{
+				SecretRef:        &v1.LocalObjectReference{Name: "oss-encrypted"},
+				AckEncrypted:     true,
+				DecryptionKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "oss-key"}},
+			},
+			key:        operatorKey,
+			wantId:     "secret-id",
+			wantSecret: "secret-secret",
+		},
+		{
+			name:    "incomplete secret",
+			oss:     v1.Oss{SecretRef: &v1.LocalObjectReference{Name: "oss-incomplete"}},
+			wantErr: true,
+		},
+		{
+			name:    "missing secret",
+			oss:     v1.Oss{SecretRef: &v1.LocalObjectReference{Name: "missing"}},
+			wantErr: true,
+		},
+		{
+			name: "key secret in other namespace",
+			oss: v1.Oss{
+				SecretRef:        &v1.LocalObjectReference{Name: "oss-encrypted"},
+				AckEncrypted:     true,
+				DecryptionKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "oss-key"}, Namespace: "other"},
+			},
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			oss := tc.oss
+			source := ossSource{Oss: &oss, coreV1Client: client.CoreV1(), namespace: "flux", decryptionKey: tc.key}
+			creds, err := source.staticCredentials()
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantId, creds.AccessKeyID)
+			assert.Equal(t, tc.wantSecret, creds.AccessKeySecret)
+		})
+	}
+}
+
+func TestOssEndpoint(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		oss  v1.Oss
+		want string
+	}{
+		{"aliyun", v1.Oss{CloudProvider: Ali, RegionId: "oss-cn-hangzhou"}, "http://oss-cn-hangzhou.aliyuncs.com"},
+		{"aliyun https", v1.Oss{CloudProvider: Ali, RegionId: "oss-cn-hangzhou", UseHTTPS: true}, "https://oss-cn-hangzhou.aliyuncs.com"},
+		{"aliyun internal", v1.Oss{CloudProvider: Ali, RegionId: "oss-cn-hangzhou", Internal: true, UseHTTPS: true}, "https://oss-cn-hangzhou-internal.aliyuncs.com"},
+		{"huawei", v1.Oss{CloudProvider: Huawei, RegionId: "cn-north-4"}, "http://obs.cn-north-4.myhuaweicloud.com"},
+		{"huawei internal", v1.Oss{CloudProvider: Huawei, RegionId: "cn-north-4", Internal: true}, "http://obs.cn-north-4.myhuaweicloud.com"},
+		{"custom host", v1.Oss{CloudProvider: Huawei, RegionId: "cn-north-4", CustomEndpoint: "obs.internal", UseHTTPS: true}, "https://obs.internal"},
+		{"custom url", v1.Oss{CloudProvider: Ali, RegionId: "oss-cn-hangzhou", CustomEndpoint: "http://10.0.0.1:8080", UseHTTPS: true}, "http://10.0.0.1:8080"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			oss := tc.oss
+			p, err := NewProvider(nil, "flux", &oss, ProviderConfig{}, "", nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, p.Endpoint(oss.RegionId))
+		})
+	}
+}
+
+func TestOssCachePath(t *testing.T) {
+	source := v1.Oss{CloudProvider: Ali, RegionId: "oss-cn-hangzhou", Bucket: "charts", Key: "app.tgz"}
+	path := ossCachePath("/cache", "flux", &source, source.Key)
+	assert.Equal(t, path, ossCachePath("/cache", "flux", &source, source.Key))
+
+	for name, mutate := range map[string]func(*v1.Oss){
+		"provider": func(o *v1.Oss) { o.CloudProvider = Huawei },
+		"region":   func(o *v1.Oss) { o.RegionId = "oss-cn-beijing" },
+		"endpoint": func(o *v1.Oss) { o.CustomEndpoint = "oss.internal" },
+		"bucket":   func(o *v1.Oss) { o.Bucket = "other" },
+	} {
+		other := source
+		mutate(&other)
+		assert.NotEqual(t, path, ossCachePath("/cache", "flux", &other, other.Key), name)
+	}
+	assert.NotEqual(t, path, ossCachePath("/cache", "flux", &source, "other.tgz"))
+	assert.NotEqual(t, path, ossCachePath("/cache", "other", &source, source.Key))
+}
+
+func TestOssDownloadRevalidated(t *testing.T) {
+	base := t.TempDir()
+	source := &ossSource{Oss: &v1.Oss{CloudProvider: Ali, Bucket: "charts", ValuesKey: "values.yaml"}, base: base, namespace: "default"}
+	cachePath := ossCachePath(base, "default", source.Oss, "values.yaml")
+
+	validator, content := "etag:1", "a"
+	var downloads int
+	download := func(key, checksum string, useCache bool) (string, error) {
+		if _, err := ioutil.ReadFile(cachePath); useCache && err == nil {
+			return cachePath, nil
+		}
+		downloads++
+		return cachePath, ioutil.WriteFile(cachePath, []byte(content), 00640)
+	}
+	get := func(string) (string, error) { return validator, nil }
+	read := func() string {
+		path, err := source.downloadRevalidated("values.yaml", true, get, download)
+		assert.NoError(t, err)
+		data, err := ioutil.ReadFile(path)
+		assert.NoError(t, err)
+		return string(data)
+	}
+
+	assert.Equal(t, "a", read())
+	assert.Equal(t, "a", read())
+	assert.Equal(t, 1, downloads)
+
+	// a changed object is downloaded again
+	validator, content = "etag:2", "b"
+	assert.Equal(t, "b", read())
+	assert.Equal(t, 2, downloads)
+
+	// objects without a validator are not served from the cache
+	validator = ""
+	assert.Equal(t, "b", read())
+	assert.Equal(t, 3, downloads)
+
+	_, err := source.downloadRevalidated("values.yaml", true, func(string) (string, error) {
+		return "", fmt.Errorf("forbidden")
+	}, download)
+	assert.IsType(t, ChartUnavailableError{}, err)
+}
+
+func TestObjectValidator(t *testing.T) {
+	assert.Equal(t, `etag:"abc"`, objectValidator(`"abc"`, "Mon, 02 Jan 2006 15:04:05 GMT"))
+	assert.Equal(t, "last-modified:Mon, 02 Jan 2006 15:04:05 GMT", objectValidator("", "Mon, 02 Jan 2006 15:04:05 GMT"))
+	assert.Equal(t, "", objectValidator("", ""))
+}
@@ -0,0 +1,293 @@
+package chartsync
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+// credentialsRefreshMargin is the duration before their expiration
+// temporary credentials are refreshed, so that they do not expire
+// during a download.
+const credentialsRefreshMargin = 5 * time.Minute
+
+// credentialsTimeout is the timeout of the requests for temporary
+// credentials.
+const credentialsTimeout = 10 * time.Second
+
+// The endpoints temporary credentials are obtained from. These are
+// variables so they can be replaced in tests.
+var (
+	aliyunMetadataURL = "http://100.100.100.200/latest/meta-data/ram/security-credentials/"
+	aliyunSTSURL      = "https://sts.aliyuncs.com/"
+	huaweiMetadataURL = "http://169.254.169.254/openstack/latest/securitykey"
+)
+
+// The environment variables the OIDC token and role for workload
+// identity on Alibaba Cloud (RRSA) are configured with.
+const (
+	aliyunRoleArnEnv         = "ALIBABA_CLOUD_ROLE_ARN"
+	aliyunOIDCProviderArnEnv = "ALIBABA_CLOUD_OIDC_PROVIDER_ARN"
+	aliyunOIDCTokenFileEnv   = "ALIBABA_CLOUD_OIDC_TOKEN_FILE"
+)
+
+// Credentials are the credentials for an object storage. Temporary
+// credentials have a security token and an expiration.
+type Credentials struct {
+	AccessKeyID     string
+	AccessKeySecret string
+	SecurityToken   string
+	Expiration      time.Time
+}
+
+// expiresSoon returns if the credentials expire within the refresh
+// margin. Credentials without an expiration never expire.
+func (c Credentials) expiresSoon() bool {
+	return !c.Expiration.IsZero() && time.Until(c.Expiration) < credentialsRefreshMargin
+}
+
+// temporaryCredentials caches temporary credentials by their source,
+// as they are shared by all releases using the same source.
+var temporaryCredentials = struct {
+	sync.Mutex
+	m map[string]Credentials
+}{m: make(map[string]Credentials)}
+
+// cachedCredentials returns the cached credentials for the key, using
+// fetch to obtain new credentials if they are missing or expire soon.
+func cachedCredentials(key string, fetch func() (Credentials, error)) (Credentials, error) {
+	temporaryCredentials.Lock()
+	defer temporaryCredentials.Unlock()
+	if c, ok := temporaryCredentials.m[key]; ok && !c.expiresSoon() {
+		return c, nil
+	}
+	c, err := fetch()
+	if err != nil {
+		return Credentials{}, err
+	}
+	temporaryCredentials.m[key] = c
+	return c, nil
+}
+
+// AmbientCredentials restricts the HelmReleases which may access
+// object storages with the credentials of the operator itself, i.e.
+// those of the instance it runs on or of its service account. As these
+// are shared by all HelmReleases, they are disabled by default.
+type AmbientCredentials struct {
+	// Enabled allows the `instanceProfile` and `workloadIdentity`
+	// credential sources.
+	Enabled bool
+	// Namespaces are the namespaces of the HelmReleases which may use
+	// the credentials of the operator, all namespaces if empty.
+	Namespaces []string
+	// Roles are the RAM roles, by name or ARN, HelmReleases may select
+	// explicitly. If empty, HelmReleases may only use the default role
+	// of the operator.
+	Roles []string
+}
+
+// allow returns an error if a HelmRelease in the namespace may not use
+// the credentials of the operator for the given role, the default role
+// if empty.
+func (a AmbientCredentials) allow(source v1.OssCredentialSource, namespace, role string) error {
+	if !a.Enabled {
+		return fmt.Errorf("credential source '%s' is disabled, the operator only allows static credentials", source)
+	}
+	if len(a.Namespaces) > 0 && !containsString(a.Namespaces, namespace) {
+		return fmt.Errorf("credential source '%s' is not allowed for HelmReleases in namespace '%s'", source, namespace)
+	}
+	if role != "" && !containsString(a.Roles, role) {
+		return fmt.Errorf("RAM role '%s' is not allowed for credential source '%s'", role, source)
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *aliImpl) Credentials() (Credentials, error) {
+	switch a.CredentialSource {
+	case "", v1.OssCredentialsStatic:
+		return a.staticCredentials()
+	case v1.OssCredentialsInstanceProfile:
+		if err := a.ambient.allow(a.CredentialSource, a.namespace, a.RoleName); err != nil {
+			return Credentials{}, err
+		}
+		return cachedCredentials(Ali+"/instance/"+a.RoleName, func() (Credentials, error) {
+			return aliyunInstanceCredentials(a.ws.HTTPClient(credentialsTimeout), a.RoleName)
+		})
+	case v1.OssCredentialsWorkloadIdentity:
+		if err := a.ambient.allow(a.CredentialSource, a.namespace, a.RoleArn); err != nil {
+			return Credentials{}, err
+		}
+		roleArn := a.RoleArn
+		if roleArn == "" {
+			roleArn = os.Getenv(aliyunRoleArnEnv)
+		}
+		return cachedCredentials(Ali+"/oidc/"+roleArn, func() (Credentials, error) {
+			return aliyunOIDCCredentials(a.ws.HTTPClient(credentialsTimeout), roleArn)
+		})
+	}
+	return Credentials{}, fmt.Errorf("unsupported credential source '%s'", a.CredentialSource)
+}
+
+func (h *huaweiImpl) Credentials() (Credentials, error) {
+	switch h.CredentialSource {
+	case "", v1.OssCredentialsStatic:
+		return h.staticCredentials()
+	case v1.OssCredentialsInstanceProfile:
+		if err := h.ambient.allow(h.CredentialSource, h.namespace, ""); err != nil {
+			return Credentials{}, err
+		}
+		return cachedCredentials(Huawei+"/instance", func() (Credentials, error) {
+			return huaweiInstanceCredentials(h.ws.HTTPClient(credentialsTimeout))
+		})
+	}
+	return Credentials{}, fmt.Errorf("unsupported credential source '%s' for %s", h.CredentialSource, Huawei)
+}
+
+// aliyunInstanceCredentials returns the temporary credentials of the
+// given RAM role of the ECS instance, or of the role attached to the
+// instance if no role is given.
+func aliyunInstanceCredentials(client *http.Client, role string) (Credentials, error) {
+	if role == "" {
+		b, err := getMetadata(client, aliyunMetadataURL)
+		if err != nil {
+			return Credentials{}, fmt.Errorf("failed to determine RAM role of instance: %w", err)
+		}
+		if role = strings.TrimSpace(string(b)); role == "" {
+			return Credentials{}, fmt.Errorf("no RAM role attached to instance")
+		}
+	}
+	b, err := getMetadata(client, aliyunMetadataURL+url.PathEscape(role))
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to get credentials of RAM role '%s': %w", role, err)
+	}
+	var resp struct {
+		Code            string
+		AccessKeyId     string
+		AccessKeySecret string
+		SecurityToken   string
+		Expiration      string
+	}
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return Credentials{}, fmt.Errorf("failed to decode credentials of RAM role '%s': %w", role, err)
+	}
+	if resp.Code != "Success" {
+		return Credentials{}, fmt.Errorf("failed to get credentials of RAM role '%s': %s", role, resp.Code)
+	}
+	return temporary(resp.AccessKeyId, resp.AccessKeySecret, resp.SecurityToken, resp.Expiration)
+}
+
+// aliyunOIDCCredentials exchanges the OIDC token of the service
+// account for temporary credentials of the given RAM role, using the
+// STS AssumeRoleWithOIDC action.
+func aliyunOIDCCredentials(client *http.Client, roleArn string) (Credentials, error) {
+	providerArn, tokenFile := os.Getenv(aliyunOIDCProviderArnEnv), os.Getenv(aliyunOIDCTokenFileEnv)
+	if roleArn == "" || providerArn == "" || tokenFile == "" {
+		return Credentials{}, fmt.Errorf("workload identity requires a role ARN and the %s and %s environment variables",
+			aliyunOIDCProviderArnEnv, aliyunOIDCTokenFileEnv)
+	}
+	// the token is rotated by the kubelet, so it is read every time
+	token, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to read OIDC token: %w", err)
+	}
+
+	query := url.Values{
+		"Action":    {"AssumeRoleWithOIDC"},
+		"Format":    {"JSON"},
+		"Version":   {"2015-04-01"},
+		"Timestamp": {time.Now().UTC().Format("2006-01-02T15:04:05Z")},
+	}
+	form := url.Values{
+		"RoleArn":         {roleArn},
+		"OIDCProviderArn": {providerArn},
+		"OIDCToken":       {strings.TrimSpace(string(token))},
+		"RoleSessionName": {"helm-operator"},
+	}
+	resp, err := client.PostForm(aliyunSTSURL+"?"+query.Encode(), form)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to assume RAM role '%s': %w", roleArn, err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Code        string
+		Message     string
+		Credentials struct {
+			AccessKeyId     string
+			AccessKeySecret string
+			SecurityToken   string
+			Expiration      string
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Credentials{}, fmt.Errorf("failed to decode credentials of RAM role '%s': %w", roleArn, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Credentials{}, fmt.Errorf("failed to assume RAM role '%s': %s: %s", roleArn, result.Code, result.Message)
+	}
+	c := result.Credentials
+	return temporary(c.AccessKeyId, c.AccessKeySecret, c.SecurityToken, c.Expiration)
+}
+
+// huaweiInstanceCredentials returns the temporary credentials of the
+// agency of the ECS instance.
+func huaweiInstanceCredentials(client *http.Client) (Credentials, error) {
+	b, err := getMetadata(client, huaweiMetadataURL)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to get credentials of instance agency: %w", err)
+	}
+	var resp struct {
+		Credential struct {
+			Access        string `json:"access"`
+			Secret        string `json:"secret"`
+			SecurityToken string `json:"securitytoken"`
+			ExpiresAt     string `json:"expires_at"`
+		} `json:"credential"`
+	}
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return Credentials{}, fmt.Errorf("failed to decode credentials of instance agency: %w", err)
+	}
+	c := resp.Credential
+	return temporary(c.Access, c.Secret, c.SecurityToken, c.ExpiresAt)
+}
+
+// temporary returns the temporary credentials with the expiration
+// parsed.
+func temporary(id, secret, token, expiration string) (Credentials, error) {
+	if id == "" || secret == "" {
+		return Credentials{}, fmt.Errorf("no credentials returned")
+	}
+	expires, err := time.Parse(time.RFC3339Nano, expiration)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("invalid credentials expiration '%s': %w", expiration, err)
+	}
+	return Credentials{AccessKeyID: id, AccessKeySecret: secret, SecurityToken: token, Expiration: expires}, nil
+}
+
+func getMetadata(client *http.Client, u string) ([]byte, error) {
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata service responded with status %d", resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,113 @@
+package chartsync
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+func TestAliyunInstanceCredentials(t *testing.T) {
+	var requests int
+	expiration := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, "operator-role")
+		case "/operator-role":
+			fmt.Fprintf(w, `{"Code":"Success","AccessKeyId":"STS.id","AccessKeySecret":"secret","SecurityToken":"token","Expiration":"%s"}`, expiration)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	defer func(u string) { aliyunMetadataURL = u }(aliyunMetadataURL)
+	aliyunMetadataURL = srv.URL + "/"
+
+	base, err := ioutil.TempDir("", "credentials")
+	assert.NoError(t, err)
+	defer os.RemoveAll(base)
+	ws, err := NewWorkspace(base, "test", 0, srv.Client().Transport.(*http.Transport))
+	assert.NoError(t, err)
+
+	a := &aliImpl{ossSource{Oss: &v1.Oss{CloudProvider: Ali, CredentialSource: v1.OssCredentialsInstanceProfile}, ws: ws, namespace: "flux"}}
+	_, err = a.Credentials()
+	assert.Error(t, err, "ambient credentials are disabled by default")
+	assert.Equal(t, 0, requests)
+
+	a.ambient = AmbientCredentials{Enabled: true, Roles: []string{"missing"}}
+	creds, err := a.Credentials()
+	assert.NoError(t, err)
+	assert.Equal(t, "STS.id", creds.AccessKeyID)
+	assert.Equal(t, "secret", creds.AccessKeySecret)
+	assert.Equal(t, "token", creds.SecurityToken)
+	assert.Equal(t, 2, requests)
+
+	// the credentials are cached until they expire soon
+	_, err = a.Credentials()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, requests)
+
+	a.RoleName = "missing"
+	_, err = a.Credentials()
+	assert.Error(t, err)
+}
+
+func TestAmbientCredentialsAllow(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		ambient   AmbientCredentials
+		namespace string
+		role      string
+		allowed   bool
+	}{
+		{name: "disabled", ambient: AmbientCredentials{}, namespace: "flux"},
+		{name: "enabled", ambient: AmbientCredentials{Enabled: true}, namespace: "flux", allowed: true},
+		{name: "allowed namespace", ambient: AmbientCredentials{Enabled: true, Namespaces: []string{"flux"}}, namespace: "flux", allowed: true},
+		{name: "other namespace", ambient: AmbientCredentials{Enabled: true, Namespaces: []string{"flux"}}, namespace: "tenant"},
+		{name: "explicit role", ambient: AmbientCredentials{Enabled: true}, namespace: "flux", role: "admin"},
+		{name: "allowed role", ambient: AmbientCredentials{Enabled: true, Roles: []string{"charts"}}, namespace: "flux", role: "charts", allowed: true},
+		{name: "other role", ambient: AmbientCredentials{Enabled: true, Roles: []string{"charts"}}, namespace: "flux", role: "admin"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.ambient.allow(v1.OssCredentialsInstanceProfile, tc.namespace, tc.role)
+			assert.Equal(t, tc.allowed, err == nil, err)
+		})
+	}
+}
+
+func TestCachedCredentials(t *testing.T) {
+	var fetches int
+	fetch := func(expiration time.Duration) func() (Credentials, error) {
+		return func() (Credentials, error) {
+			fetches++
+			return Credentials{AccessKeyID: "id", Expiration: time.Now().Add(expiration)}, nil
+		}
+	}
+
+	_, err := cachedCredentials("test/soon", fetch(time.Minute))
+	assert.NoError(t, err)
+	_, err = cachedCredentials("test/soon", fetch(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, fetches, "credentials expiring within the margin are refreshed")
+
+	_, err = cachedCredentials("test/later", fetch(time.Hour))
+	assert.NoError(t, err)
+	_, err = cachedCredentials("test/later", fetch(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, fetches)
+}
+
+func TestHuaweiUnsupportedCredentialSource(t *testing.T) {
+	h := &huaweiImpl{ossSource{Oss: &v1.Oss{CloudProvider: Huawei, CredentialSource: v1.OssCredentialsWorkloadIdentity}}}
+	_, err := h.Credentials()
+	assert.Error(t, err)
+}
@@ -0,0 +1,194 @@
+package chartsync
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	helmfluxv1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+// ApplyOverlays copies the files of the given overlays into the chart
+// at chartPath, and returns the path to the chart with the overlays
+// applied. Chart archives are expanded into the workspace first, so
+// charts in the shared cache are never modified; chart directories,
+// i.e. of Git chart sources, are modified in place. Overlays with a
+// Git path are read from the Git repository at repoDir.
+func ApplyOverlays(coreV1Client corev1client.CoreV1Interface, namespace string, ws *Workspace,
+	chartPath, repoDir string, overlays []helmfluxv1.ChartOverlaySource) (string, error) {
+	if len(overlays) == 0 {
+		return chartPath, nil
+	}
+	fi, err := os.Stat(chartPath)
+	if err != nil {
+		return "", err
+	}
+	expanded := !fi.IsDir()
+	if expanded {
+		if chartPath, err = expandChart(ws, chartPath); err != nil {
+			return "", err
+		}
+	}
+
+	for i, overlay := range overlays {
+		target, err := joinWithin(chartPath, overlay.TargetPath)
+		if err != nil {
+			return "", fmt.Errorf("invalid target path of overlay %d: %w", i, err)
+		}
+		switch {
+		case overlay.ConfigMapRef != nil && overlay.GitPath != "":
+			return "", fmt.Errorf("overlay %d has both a ConfigMap reference and a Git path", i)
+		case overlay.ConfigMapRef != nil:
+			err = overlayConfigMap(coreV1Client, namespace, overlay.ConfigMapRef.Name, target)
+		case overlay.GitPath != "":
+			if repoDir == "" {
+				return "", fmt.Errorf("overlay %d has a Git path, but the chart source is not a Git repository", i)
+			}
+			var source string
+			if source, err = joinWithin(repoDir, overlay.GitPath); err != nil {
+				return "", fmt.Errorf("invalid Git path of overlay %d: %w", i, err)
+			}
+			err = copyTree(source, target)
+		default:
+			return "", fmt.Errorf("overlay %d has neither a ConfigMap reference nor a Git path", i)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to apply overlay %d: %w", i, err)
+		}
+	}
+
+	if expanded {
+		err = ws.Check()
+	} else {
+		err = ws.Check(chartPath)
+	}
+	if err != nil {
+		return "", err
+	}
+	return chartPath, nil
+}
+
+// expandChart expands the chart archive into a new directory in the
+// workspace, and returns the path to the chart directory.
+func expandChart(ws *Workspace, archive string) (string, error) {
+	dir, err := ioutil.TempDir(ws.Dir(), "overlay-")
+	if err != nil {
+		return "", err
+	}
+	if err := chartutil.ExpandFile(dir, archive); err != nil {
+		return "", fmt.Errorf("failed to expand chart archive: %w", err)
+	}
+	// the archive holds a single directory named after the chart
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) != 1 || !entries[0].IsDir() {
+		return "", fmt.Errorf("chart archive '%s' does not hold a single chart directory", filepath.Base(archive))
+	}
+	return filepath.Join(dir, entries[0].Name()), nil
+}
+
+// overlayConfigMap writes every key of the ConfigMap as a file into
+// the target directory.
+func overlayConfigMap(coreV1Client corev1client.CoreV1Interface, namespace, name, target string) error {
+	cm, err := coreV1Client.ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	files := make(map[string][]byte, len(cm.Data)+len(cm.BinaryData))
+	for key, data := range cm.Data {
+		files[key] = []byte(data)
+	}
+	for key, data := range cm.BinaryData {
+		files[key] = data
+	}
+	for key, data := range files {
+		path, err := joinWithin(target, key)
+		if err != nil || path == target {
+			return fmt.Errorf("invalid file name '%s' in ConfigMap '%s'", key, name)
+		}
+		if err := writeOverlayFile(path, func(w io.Writer) error {
+			_, err := w.Write(data)
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyTree copies the regular files below source into the target
+// directory; symlinks are skipped, as they may point outside of the
+// repository. For the same reason, source itself may not be a symlink.
+func copyTree(source, target string) error {
+	fi, err := os.Lstat(source)
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("'%s' is a symlink", filepath.Base(source))
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("'%s' is not a directory", filepath.Base(source))
+	}
+	return filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		return writeOverlayFile(filepath.Join(target, rel), func(w io.Writer) error {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(w, f)
+			return err
+		})
+	})
+}
+
+// writeOverlayFile writes the file at path, replacing an existing
+// file instead of writing through it in case it is a symlink.
+func writeOverlayFile(path string, write func(w io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 00750); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 00640)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// joinWithin joins the relative path to base, and returns an error if
+// the result is outside of base.
+func joinWithin(base, rel string) (string, error) {
+	if filepath.IsAbs(rel) {
+		return "", fmt.Errorf("path '%s' is not relative", rel)
+	}
+	base = filepath.Clean(base)
+	path := filepath.Join(base, rel)
+	if path != base && !strings.HasPrefix(path, base+string(filepath.Separator)) {
+		return "", fmt.Errorf("path '%s' is outside of its directory", rel)
+	}
+	return path, nil
+}
@@ -0,0 +1,83 @@
+package chartsync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+func TestApplyOverlays(t *testing.T) {
+	base, err := ioutil.TempDir("", "overlay")
+	assert.NoError(t, err)
+	defer os.RemoveAll(base)
+
+	archive, err := chartutil.Save(&chart.Chart{
+		Metadata:  &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "vendor", Version: "1.0.0"},
+		Templates: []*chart.File{{Name: "templates/_helpers.tpl", Data: []byte("original")}},
+	}, base)
+	assert.NoError(t, err)
+
+	repoDir := filepath.Join(base, "repo")
+	assert.NoError(t, os.MkdirAll(filepath.Join(repoDir, "overlays", "templates"), 00750))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(repoDir, "overlays", "templates", "extra.yaml"), []byte("extra"), 00640))
+	outside := filepath.Join(base, "outside")
+	assert.NoError(t, os.MkdirAll(outside, 00750))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(outside, "secret.yaml"), []byte("secret"), 00640))
+	assert.NoError(t, os.Symlink(outside, filepath.Join(repoDir, "linked")))
+
+	client := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "helpers"},
+		Data:       map[string]string{"_helpers.tpl": "patched"},
+	}, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "escape"},
+		Data:       map[string]string{"..": "escaped"},
+	})
+
+	ws, err := NewWorkspace(base, "test", 0, nil)
+	assert.NoError(t, err)
+	defer ws.Clean()
+
+	chartPath, err := ApplyOverlays(client.CoreV1(), "default", ws, archive, repoDir, []v1.ChartOverlaySource{
+		{ConfigMapRef: &v1.LocalObjectReference{Name: "helpers"}, TargetPath: "templates"},
+		{GitPath: "overlays"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(ws.Dir(), filepath.Base(filepath.Dir(chartPath)), "vendor"), chartPath)
+	for file, want := range map[string]string{
+		"templates/_helpers.tpl": "patched",
+		"templates/extra.yaml":   "extra",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(chartPath, file))
+		assert.NoError(t, err)
+		assert.Equal(t, want, string(data), file)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		repoDir string
+		overlay v1.ChartOverlaySource
+	}{
+		{"target outside of chart", repoDir, v1.ChartOverlaySource{GitPath: "overlays", TargetPath: "../.."}},
+		{"git path outside of repository", repoDir, v1.ChartOverlaySource{GitPath: "../"}},
+		{"git path without git source", "", v1.ChartOverlaySource{GitPath: "overlays"}},
+		{"symlinked git path", repoDir, v1.ChartOverlaySource{GitPath: "linked"}},
+		{"file name outside of target", repoDir, v1.ChartOverlaySource{ConfigMapRef: &v1.LocalObjectReference{Name: "escape"}}},
+		{"missing config map", repoDir, v1.ChartOverlaySource{ConfigMapRef: &v1.LocalObjectReference{Name: "missing"}}},
+		{"no source", repoDir, v1.ChartOverlaySource{TargetPath: "templates"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ApplyOverlays(client.CoreV1(), "default", ws, archive, tc.repoDir, []v1.ChartOverlaySource{tc.overlay})
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package chartsync
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// workspacesDir is the directory in the chart cache holding the
+// workspaces of in-flight syncs.
+const workspacesDir = "workspaces"
+
+// QuotaExceededError is returned when the files of a chart operation
+// exceed the size quota of the workspace.
+type QuotaExceededError struct {
+	Size  int64
+	Quota int64
+}
+
+func (err QuotaExceededError) Error() string {
+	return fmt.Sprintf("chart files of %d bytes exceed the workspace quota of %d bytes", err.Size, err.Quota)
+}
+
+// Workspace is an isolated scratch directory for the chart operations
+// of a single sync. Files are downloaded into the workspace first,
+// and are only moved to the shared cache after they have been written
+// completely and are within the size quota.
+type Workspace struct {
+	dir       string
+	quota     int64
+	transport *http.Transport
+}
+
+// NewWorkspace creates a new workspace for the given name in the
+// chart cache at base. A quota of 0 disables the size quota. Files
+// are downloaded over HTTP using the given transport, or the default
+// transport if nil.
+func NewWorkspace(base, name string, quota int64, transport *http.Transport) (*Workspace, error) {
+	root := filepath.Join(base, workspacesDir)
+	if err := os.MkdirAll(root, 00750); err != nil {
+		return nil, err
+	}
+	dir, err := ioutil.TempDir(root, name+"-")
+	if err != nil {
+		return nil, err
+	}
+	return &Workspace{dir: dir, quota: quota, transport: transport}, nil
+}
+
+// RemoveWorkspaces removes the workspaces left behind in the chart
+// cache at base, e.g. by an operator which got killed mid-sync.
+func RemoveWorkspaces(base string) error {
+	return os.RemoveAll(filepath.Join(base, workspacesDir))
+}
+
+// Dir returns the path to the workspace directory.
+func (w *Workspace) Dir() string {
+	return w.dir
+}
+
+// Transport returns the HTTP transport of the workspace, or nil if it
+// uses the default transport.
+func (w *Workspace) Transport() *http.Transport {
+	return w.transport
+}
+
+// HTTPClient returns an HTTP client with the given timeout, using the
+// transport of the workspace. A nil workspace uses the default
+// transport.
+func (w *Workspace) HTTPClient(timeout time.Duration) *http.Client {
+	client := &http.Client{Timeout: timeout}
+	if w != nil && w.transport != nil {
+		client.Transport = w.transport
+	}
+	return client
+}
+
+// Clean removes the workspace and everything in it.
+func (w *Workspace) Clean() error {
+	return os.RemoveAll(w.dir)
+}
+
+// Limit returns a reader which fails with a QuotaExceededError once
+// more than the remaining quota has been read from r.
+func (w *Workspace) Limit(r io.Reader) io.Reader {
+	if w.quota <= 0 {
+		return r
+	}
+	return &quotaReader{r: r, remaining: w.quota - w.size(), quota: w.quota}
+}
+
+// Check returns a QuotaExceededError if the size of the workspace,
+// plus the size of the given paths outside of it, exceeds the quota.
+func (w *Workspace) Check(paths ...string) error {
+	if w.quota <= 0 {
+		return nil
+	}
+	size := w.size()
+	for _, p := range paths {
+		size += pathSize(p)
+	}
+	if size > w.quota {
+		return QuotaExceededError{Size: size, Quota: w.quota}
+	}
+	return nil
+}
+
+// Fetch returns the path to the file cached at cachePath, fetching it
+// first if useCache is false or it is not cached yet. The file is
+// fetched into the workspace, and moved to cachePath if useCache is
+// true; otherwise the path in the workspace is returned. The fetch is
+// observed for the given source type.
+func (w *Workspace) Fetch(source, cachePath string, useCache bool, fetch func(dest string) error) (string, error) {
+	return w.FetchVerified(source, cachePath, useCache, nil, fetch)
+}
+
+// FetchVerified is like Fetch, but verifies the cached and fetched
+// file with verify if it is not nil. A cached file which fails the
+// verification is fetched again; a fetched file which fails it is
+// discarded.
+func (w *Workspace) FetchVerified(source, cachePath string, useCache bool, verify func(path string) error,
+	fetch func(dest string) error) (string, error) {
+	if useCache {
+		if _, err := os.Stat(cachePath); err == nil {
+			if verify == nil || verify(cachePath) == nil {
+				touch(cachePath)
+				ObserveChartCache(source, true)
+				return cachePath, nil
+			}
+			os.Remove(cachePath)
+		}
+		ObserveChartCache(source, false)
+	}
+	dest := filepath.Join(w.dir, filepath.Base(cachePath))
+	if err := w.fetch(source, dest, fetch); err != nil {
+		os.Remove(dest)
+		return "", err
+	}
+	if err := w.Check(); err != nil {
+		os.Remove(dest)
+		return "", err
+	}
+	if verify != nil {
+		if err := verify(dest); err != nil {
+			os.Remove(dest)
+			return "", err
+		}
+	}
+	if !useCache {
+		return dest, nil
+	}
+	if err := os.Rename(dest, cachePath); err != nil {
+		return "", err
+	}
+	return cachePath, nil
+}
+
+// fetch fetches the file to dest, observing the duration of the fetch
+// and the size of the fetched file.
+func (w *Workspace) fetch(source, dest string, fetch func(dest string) error) (err error) {
+	defer func(start time.Time) {
+		ObserveChartFetch(source, start, err)
+	}(time.Now())
+	if err = fetch(dest); err != nil {
+		return err
+	}
+	if info, err := os.Stat(dest); err == nil {
+		ObserveChartFetchBytes(source, info.Size())
+	}
+	return nil
+}
+
+func (w *Workspace) size() int64 {
+	return pathSize(w.dir)
+}
+
+// pathSize returns the total size of the files at path, ignoring
+// files which can not be read.
+func pathSize(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+type quotaReader struct {
+	r         io.Reader
+	remaining int64
+	quota     int64
+}
+
+func (q *quotaReader) Read(p []byte) (int, error) {
+	n, err := q.r.Read(p)
+	q.remaining -= int64(n)
+	if q.remaining < 0 {
+		return n, QuotaExceededError{Size: q.quota - q.remaining, Quota: q.quota}
+	}
+	return n, err
+}
@@ -0,0 +1,124 @@
+/*
+Package conversion converts HelmReleases of the legacy APIs of Flux
+and the upstream Helm operator to helm.fluxcd.io/v1, so existing
+HelmReleases can be adopted without rewriting them by hand.
+
+The v1beta1 version of the CustomResourceDefinition serves
+HelmReleases in the schema of the prior flux.weave.works/v1beta1 API,
+converted by its conversion webhook, so existing HelmReleases can be
+adopted by only changing their API group. HelmReleases of the
+flux.weave.works/v1beta1 API itself are migrated by creating their v1
+counterpart.
+
+The spec of legacy HelmReleases is compatible with the v1 schema,
+except for the Flux annotations of the legacy `flux.weave.works` prefix
+and the deprecated `valueFileSecrets`, which are converted into their
+v1 counterparts. HelmReleases are converted from v1 to v1beta1 as is,
+as the v1 schema is a superset of the v1beta1 schema.
+*/
+package conversion
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// V1 and V1beta1 are the API versions served by the
+	// CustomResourceDefinition, and Legacy the API version
+	// HelmReleases are migrated from.
+	V1      = "helm.fluxcd.io/v1"
+	V1beta1 = "helm.fluxcd.io/v1beta1"
+	Legacy  = "flux.weave.works/v1beta1"
+
+	// legacyAnnotationPrefix is the prefix of the annotations of the
+	// Flux versions of the flux.weave.works API.
+	legacyAnnotationPrefix = "flux.weave.works/"
+)
+
+// UnsupportedVersionError is returned for conversions from or to an
+// API version which is not supported.
+type UnsupportedVersionError struct {
+	APIVersion string
+}
+
+func (err UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("unsupported API version '%s', must be one of: %s, %s, %s", err.APIVersion, V1, V1beta1, Legacy)
+}
+
+// Convert converts the HelmRelease to the given API version in place.
+// HelmReleases of the legacy API can only be converted to v1.
+func Convert(obj *unstructured.Unstructured, apiVersion string) error {
+	from := obj.GetAPIVersion()
+	switch {
+	case from != V1 && from != V1beta1 && from != Legacy:
+		return UnsupportedVersionError{from}
+	case apiVersion != V1 && (apiVersion != V1beta1 || from == Legacy):
+		return UnsupportedVersionError{apiVersion}
+	}
+	if from != V1 && apiVersion == V1 {
+		if err := convertValueFileSecrets(obj); err != nil {
+			return err
+		}
+		convertAnnotations(obj)
+	}
+	obj.SetAPIVersion(apiVersion)
+	return nil
+}
+
+// convertValueFileSecrets prepends the deprecated value file secrets
+// to the valuesFrom sources as secret references, in the order they
+// are merged in.
+func convertValueFileSecrets(obj *unstructured.Unstructured) error {
+	secrets, ok, err := unstructured.NestedSlice(obj.Object, "spec", "valueFileSecrets")
+	if err != nil || !ok {
+		return err
+	}
+	valuesFrom, _, err := unstructured.NestedSlice(obj.Object, "spec", "valuesFrom")
+	if err != nil {
+		return err
+	}
+	sources := make([]interface{}, 0, len(secrets)+len(valuesFrom))
+	for i, s := range secrets {
+		secret, ok := s.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("spec.valueFileSecrets[%d] is not an object", i)
+		}
+		sources = append(sources, map[string]interface{}{
+			"secretKeyRef": map[string]interface{}{"name": secret["name"]},
+		})
+	}
+	sources = append(sources, valuesFrom...)
+	unstructured.RemoveNestedField(obj.Object, "spec", "valueFileSecrets")
+	return unstructured.SetNestedSlice(obj.Object, sources, "spec", "valuesFrom")
+}
+
+// convertAnnotations renames the legacy Flux annotations, like Flux
+// 1.13 did: the image filters of `flux.weave.works/tag.<container>`
+// become `filter.fluxcd.io/<container>`, and the other annotations
+// move to the `fluxcd.io` prefix. Annotations which are already set
+// with the new name are kept.
+func convertAnnotations(obj *unstructured.Unstructured) {
+	annotations := obj.GetAnnotations()
+	var changed bool
+	for key, value := range annotations {
+		if !strings.HasPrefix(key, legacyAnnotationPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(key, legacyAnnotationPrefix)
+		newKey := "fluxcd.io/" + name
+		if strings.HasPrefix(name, "tag.") {
+			newKey = "filter.fluxcd.io/" + strings.TrimPrefix(name, "tag.")
+		}
+		if _, ok := annotations[newKey]; !ok {
+			annotations[newKey] = value
+		}
+		delete(annotations, key)
+		changed = true
+	}
+	if changed {
+		obj.SetAnnotations(annotations)
+	}
+}
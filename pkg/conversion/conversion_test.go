@@ -0,0 +1,73 @@
+package conversion
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func legacyHelmRelease() *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": Legacy,
+		"kind":       "HelmRelease",
+		"metadata": map[string]interface{}{
+			"name":      "podinfo",
+			"namespace": "default",
+			"annotations": map[string]interface{}{
+				"flux.weave.works/automated":   "true",
+				"flux.weave.works/tag.podinfo": "semver:~1.0",
+				"flux.weave.works/locked":      "true",
+				"fluxcd.io/locked":             "false",
+			},
+		},
+		"spec": map[string]interface{}{
+			"chart":            map[string]interface{}{"repository": "https://charts.example.com", "name": "podinfo", "version": "1.0.0"},
+			"valueFileSecrets": []interface{}{map[string]interface{}{"name": "secret-values"}},
+			"valuesFrom": []interface{}{
+				map[string]interface{}{"configMapKeyRef": map[string]interface{}{"name": "values"}},
+			},
+		},
+	}}
+}
+
+func TestConvert(t *testing.T) {
+	for _, apiVersion := range []string{Legacy, V1beta1} {
+		t.Run(apiVersion, func(t *testing.T) {
+			obj := legacyHelmRelease()
+			obj.SetAPIVersion(apiVersion)
+			testConvert(t, obj)
+		})
+	}
+}
+
+func testConvert(t *testing.T, obj *unstructured.Unstructured) {
+	assert.NoError(t, Convert(obj, V1))
+	assert.Equal(t, V1, obj.GetAPIVersion())
+	assert.Equal(t, map[string]string{
+		"fluxcd.io/automated":      "true",
+		"filter.fluxcd.io/podinfo": "semver:~1.0",
+		"fluxcd.io/locked":         "false",
+	}, obj.GetAnnotations())
+
+	_, ok, _ := unstructured.NestedSlice(obj.Object, "spec", "valueFileSecrets")
+	assert.False(t, ok)
+	valuesFrom, _, _ := unstructured.NestedSlice(obj.Object, "spec", "valuesFrom")
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"secretKeyRef": map[string]interface{}{"name": "secret-values"}},
+		map[string]interface{}{"configMapKeyRef": map[string]interface{}{"name": "values"}},
+	}, valuesFrom)
+
+	// v1 HelmReleases are served as v1beta1 as is
+	spec := obj.Object["spec"]
+	assert.NoError(t, Convert(obj, V1beta1))
+	assert.Equal(t, V1beta1, obj.GetAPIVersion())
+	assert.Equal(t, spec, obj.Object["spec"])
+
+	assert.Error(t, Convert(obj, "helm.toolkit.fluxcd.io/v2beta1"))
+	assert.Error(t, Convert(obj, Legacy))
+	obj.SetAPIVersion(Legacy)
+	assert.Error(t, Convert(obj, V1beta1))
+	obj.SetAPIVersion("helm.toolkit.fluxcd.io/v2beta1")
+	assert.Error(t, Convert(obj, V1))
+}
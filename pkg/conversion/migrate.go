@@ -0,0 +1,122 @@
+package conversion
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// MigratedAnnotation is set on legacy HelmReleases once they have
+// been migrated, so that a v1 HelmRelease deleted afterwards is not
+// migrated again.
+const MigratedAnnotation = "helm.fluxcd.io/migrated"
+
+var (
+	legacyGroupVersionResource = schema.GroupVersionResource{
+		Group:    "flux.weave.works",
+		Version:  "v1beta1",
+		Resource: "helmreleases",
+	}
+	v1GroupVersionResource = schema.GroupVersionResource{
+		Group:    "helm.fluxcd.io",
+		Version:  "v1",
+		Resource: "helmreleases",
+	}
+)
+
+// Migrate creates a v1 HelmRelease for every legacy HelmRelease in
+// the namespace, or in all namespaces if it is empty, which has not
+// been migrated yet. A v1 HelmRelease which already exists is kept.
+// It returns the number of created HelmReleases. HelmReleases the
+// operator is forbidden to list, create or annotate are logged and
+// skipped, as the migration is best effort.
+//
+// Legacy HelmReleases are not deleted, as the operator still managing
+// them would uninstall their release; they should be deleted once it
+// has been removed.
+func Migrate(logger log.Logger, client dynamic.Interface, namespace string) (int, error) {
+	list, err := client.Resource(legacyGroupVersionResource).Namespace(namespace).List(metav1.ListOptions{})
+	if apierrors.IsNotFound(err) {
+		// the legacy API is not served, there is nothing to migrate
+		return 0, nil
+	}
+	if apierrors.IsForbidden(err) {
+		logger.Log("warning", fmt.Sprintf("not migrating legacy HelmReleases, listing them is forbidden: %v", err))
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to list legacy HelmReleases: %w", err)
+	}
+
+	var migrated int
+	for i := range list.Items {
+		legacy := &list.Items[i]
+		if _, ok := legacy.GetAnnotations()[MigratedAnnotation]; ok {
+			continue
+		}
+		hr, err := migration(legacy)
+		if err != nil {
+			return migrated, fmt.Errorf("failed to convert legacy HelmRelease %s/%s: %w", legacy.GetNamespace(), legacy.GetName(), err)
+		}
+		_, err = client.Resource(v1GroupVersionResource).Namespace(hr.GetNamespace()).Create(hr, metav1.CreateOptions{})
+		switch {
+		case apierrors.IsAlreadyExists(err):
+			logger.Log("info", "not migrating legacy HelmRelease, a v1 HelmRelease with the same name exists",
+				"resource", fmt.Sprintf("%s:helmrelease/%s", hr.GetNamespace(), hr.GetName()))
+		case apierrors.IsForbidden(err):
+			logger.Log("warning", fmt.Sprintf("not migrating legacy HelmRelease, creating it is forbidden: %v", err),
+				"resource", fmt.Sprintf("%s:helmrelease/%s", hr.GetNamespace(), hr.GetName()))
+			continue
+		case err != nil:
+			return migrated, fmt.Errorf("failed to create HelmRelease %s/%s: %w", hr.GetNamespace(), hr.GetName(), err)
+		default:
+			migrated++
+			logger.Log("info", "migrated legacy HelmRelease",
+				"resource", fmt.Sprintf("%s:helmrelease/%s", hr.GetNamespace(), hr.GetName()))
+		}
+
+		patch, _ := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]string{MigratedAnnotation: time.Now().UTC().Format(time.RFC3339)},
+			},
+		})
+		_, err = client.Resource(legacyGroupVersionResource).Namespace(legacy.GetNamespace()).Patch(legacy.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+		if apierrors.IsForbidden(err) {
+			logger.Log("warning", fmt.Sprintf("failed to annotate legacy HelmRelease as migrated, patching it is forbidden: %v", err),
+				"resource", fmt.Sprintf("%s:helmrelease/%s", legacy.GetNamespace(), legacy.GetName()))
+			continue
+		}
+		if err != nil {
+			return migrated, fmt.Errorf("failed to annotate legacy HelmRelease %s/%s: %w", legacy.GetNamespace(), legacy.GetName(), err)
+		}
+	}
+	return migrated, nil
+}
+
+// migration returns the v1 HelmRelease for the legacy HelmRelease,
+// with its name, namespace, labels, annotations and spec.
+func migration(legacy *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	hr := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	hr.SetAPIVersion(legacy.GetAPIVersion())
+	hr.SetKind("HelmRelease")
+	hr.SetNamespace(legacy.GetNamespace())
+	hr.SetName(legacy.GetName())
+	hr.SetLabels(legacy.GetLabels())
+	hr.SetAnnotations(legacy.GetAnnotations())
+	if spec, ok := legacy.Object["spec"]; ok {
+		hr.Object["spec"] = runtime.DeepCopyJSONValue(spec)
+	}
+	if err := Convert(hr, V1); err != nil {
+		return nil, err
+	}
+	return hr, nil
+}
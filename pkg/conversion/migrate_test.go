@@ -0,0 +1,71 @@
+package conversion
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestMigrate(t *testing.T) {
+	legacy := legacyHelmRelease()
+	legacy.SetResourceVersion("42")
+	legacy.Object["status"] = map[string]interface{}{"releaseName": "default-podinfo"}
+	existing := legacyHelmRelease()
+	existing.SetName("existing")
+	hr := &unstructured.Unstructured{}
+	hr.SetAPIVersion(V1)
+	hr.SetKind("HelmRelease")
+	hr.SetNamespace("default")
+	hr.SetName("existing")
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), legacy, existing, hr)
+
+	n, err := Migrate(log.NewNopLogger(), client, "default")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	migrated, err := client.Resource(v1GroupVersionResource).Namespace("default").Get("podinfo", metav1.GetOptions{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, V1, migrated.GetAPIVersion())
+		assert.Equal(t, "true", migrated.GetAnnotations()["fluxcd.io/automated"])
+		assert.NotContains(t, migrated.Object, "status")
+		_, ok, _ := unstructured.NestedSlice(migrated.Object, "spec", "valueFileSecrets")
+		assert.False(t, ok)
+	}
+	for _, name := range []string{"podinfo", "existing"} {
+		l, err := client.Resource(legacyGroupVersionResource).Namespace("default").Get(name, metav1.GetOptions{})
+		if assert.NoError(t, err) {
+			assert.Contains(t, l.GetAnnotations(), MigratedAnnotation)
+		}
+	}
+
+	// migrated HelmReleases are not migrated again once deleted
+	assert.NoError(t, client.Resource(v1GroupVersionResource).Namespace("default").Delete("podinfo", &metav1.DeleteOptions{}))
+	n, err = Migrate(log.NewNopLogger(), client, "default")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestMigrateForbidden(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), legacyHelmRelease())
+	client.PrependReactor("create", "helmreleases", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(v1GroupVersionResource.GroupResource(), "podinfo", errors.New("not allowed"))
+	})
+
+	n, err := Migrate(log.NewNopLogger(), client, "default")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// the legacy HelmRelease is not marked as migrated, to be retried
+	l, err := client.Resource(legacyGroupVersionResource).Namespace("default").Get("podinfo", metav1.GetOptions{})
+	if assert.NoError(t, err) {
+		assert.NotContains(t, l.GetAnnotations(), MigratedAnnotation)
+	}
+}
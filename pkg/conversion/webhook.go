@@ -0,0 +1,77 @@
+package conversion
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+	apiextv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// maxReviewSize is the maximum size of a ConversionReview, which may
+// hold a list of HelmReleases.
+const maxReviewSize = 32 << 20
+
+// Handler returns the handler of the conversion webhook of the
+// HelmRelease CustomResourceDefinition. It accepts the
+// ConversionReviews of both the v1 and v1beta1 API, which share their
+// schema, and responds with the API version of the request.
+func Handler(logger log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxReviewSize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		var review apiextv1beta1.ConversionReview
+		if err := json.Unmarshal(body, &review); err != nil || review.Request == nil {
+			http.Error(w, "invalid ConversionReview", http.StatusBadRequest)
+			return
+		}
+
+		review.Response = respond(review.Request)
+		if review.Response.Result.Status == metav1.StatusFailure {
+			logger.Log("warning", "failed to convert HelmReleases", "apiVersion", review.Request.DesiredAPIVersion, "err", review.Response.Result.Message)
+		}
+		review.Request = nil
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(review)
+	})
+}
+
+// respond returns the response to the conversion request; either all
+// objects are converted, or the conversion fails.
+func respond(req *apiextv1beta1.ConversionRequest) *apiextv1beta1.ConversionResponse {
+	res := &apiextv1beta1.ConversionResponse{UID: req.UID, Result: metav1.Status{Status: metav1.StatusSuccess}}
+	for i, o := range req.Objects {
+		converted, err := convertRaw(o.Raw, req.DesiredAPIVersion)
+		if err != nil {
+			return &apiextv1beta1.ConversionResponse{UID: req.UID, Result: metav1.Status{
+				Status:  metav1.StatusFailure,
+				Message: fmt.Sprintf("failed to convert object %d: %v", i, err),
+			}}
+		}
+		res.ConvertedObjects = append(res.ConvertedObjects, runtime.RawExtension{Raw: converted})
+	}
+	return res
+}
+
+func convertRaw(raw []byte, apiVersion string) ([]byte, error) {
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(raw); err != nil {
+		return nil, err
+	}
+	if err := Convert(obj, apiVersion); err != nil {
+		return nil, err
+	}
+	return obj.MarshalJSON()
+}
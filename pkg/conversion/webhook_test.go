@@ -0,0 +1,60 @@
+package conversion
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	apiextv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestHandler(t *testing.T) {
+	hr := legacyHelmRelease()
+	hr.SetAPIVersion(V1beta1)
+	raw, err := hr.MarshalJSON()
+	assert.NoError(t, err)
+
+	for _, tc := range []struct {
+		name       string
+		apiVersion string
+		succeeds   bool
+	}{
+		{"supported version", V1, true},
+		{"unsupported version", "helm.fluxcd.io/v2", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			body, _ := json.Marshal(apiextv1beta1.ConversionReview{
+				TypeMeta: metav1.TypeMeta{APIVersion: "apiextensions.k8s.io/v1beta1", Kind: "ConversionReview"},
+				Request: &apiextv1beta1.ConversionRequest{
+					UID:               "1234",
+					DesiredAPIVersion: tc.apiVersion,
+					Objects:           []runtime.RawExtension{{Raw: raw}},
+				},
+			})
+			rec := httptest.NewRecorder()
+			Handler(log.NewNopLogger()).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/conversion/helmreleases", bytes.NewReader(body)))
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			var review apiextv1beta1.ConversionReview
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &review))
+			assert.Equal(t, "apiextensions.k8s.io/v1beta1", review.APIVersion)
+			if assert.NotNil(t, review.Response) {
+				assert.Equal(t, "1234", string(review.Response.UID))
+				assert.Equal(t, tc.succeeds, review.Response.Result.Status == metav1.StatusSuccess)
+				if tc.succeeds && assert.Len(t, review.Response.ConvertedObjects, 1) {
+					var obj map[string]interface{}
+					assert.NoError(t, json.Unmarshal(review.Response.ConvertedObjects[0].Raw, &obj))
+					assert.Equal(t, V1, obj["apiVersion"])
+				} else {
+					assert.Empty(t, review.Response.ConvertedObjects)
+				}
+			}
+		})
+	}
+}
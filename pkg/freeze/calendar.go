@@ -0,0 +1,90 @@
+package freeze
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+// Calendar provides the freeze windows of an external calendar. The
+// calendar is expected to respond to a GET request of its URL with
+// the upcoming and current windows:
+//
+//   {"windows": [{"name": "black-friday", "start": "2020-11-27T00:00:00Z", "end": "2020-11-30T00:00:00Z"}]}
+//
+// The windows are cached for the refresh interval; if the calendar can
+// not be reached, the previously retrieved windows are used.
+type Calendar struct {
+	url      string
+	client   *http.Client
+	interval time.Duration
+
+	mu        sync.Mutex
+	windows   []Window
+	fetchedAt time.Time
+}
+
+// NewCalendar returns a provider of the windows of the calendar at the
+// given URL, refreshed at the given interval.
+func NewCalendar(url string, client *http.Client, interval time.Duration) *Calendar {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Calendar{url: url, client: client, interval: interval}
+}
+
+// Active returns the window of the calendar applying to the HelmRelease
+// at the given time.
+func (c *Calendar) Active(hr *v1.HelmRelease, t time.Time) (*Window, error) {
+	windows, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range windows {
+		if w.Contains(hr, t) {
+			w := w
+			return &w, nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *Calendar) get() ([]Window, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.fetchedAt.IsZero() && time.Since(c.fetchedAt) < c.interval {
+		return c.windows, nil
+	}
+	windows, err := c.fetch()
+	if err != nil {
+		if c.fetchedAt.IsZero() {
+			return nil, err
+		}
+		// keep using the previously retrieved windows
+		return c.windows, nil
+	}
+	c.windows, c.fetchedAt = windows, time.Now()
+	return windows, nil
+}
+
+func (c *Calendar) fetch() ([]Window, error) {
+	res, err := c.client.Get(c.url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve freeze windows: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to retrieve freeze windows: %s", res.Status)
+	}
+	var body struct {
+		Windows []Window `json:"windows"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to parse freeze windows: %w", err)
+	}
+	return body.Windows, nil
+}
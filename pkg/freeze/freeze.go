@@ -0,0 +1,77 @@
+/*
+Package freeze determines the release freeze windows during which the
+operator holds upgrades of HelmReleases, e.g. during peak business
+hours or holidays. Windows are either defined statically as recurring
+cron schedules, or retrieved from the HTTP API of an external calendar.
+*/
+package freeze
+
+import (
+	"time"
+
+	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+// Window is a release freeze window.
+type Window struct {
+	// Name identifies the window.
+	Name string `json:"name"`
+	// Start and End are the times the window starts and ends at.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Reason is the reason of the freeze, if any.
+	Reason string `json:"reason,omitempty"`
+	// Namespaces are the namespaces of the HelmReleases the window
+	// applies to; it applies to all HelmReleases if empty.
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// Contains returns if the window applies to the HelmRelease at the
+// given time.
+func (w Window) Contains(hr *v1.HelmRelease, t time.Time) bool {
+	if t.Before(w.Start) || !t.Before(w.End) {
+		return false
+	}
+	return appliesTo(w.Namespaces, hr)
+}
+
+// Provider provides the release freeze windows.
+type Provider interface {
+	// Active returns the freeze window applying to the HelmRelease at
+	// the given time, or nil if it is not frozen.
+	Active(hr *v1.HelmRelease, t time.Time) (*Window, error)
+}
+
+// Providers combines the windows of multiple providers.
+type Providers []Provider
+
+// Active returns the first active window of the providers. An error is
+// only returned if none of the providers has an active window.
+func (p Providers) Active(hr *v1.HelmRelease, t time.Time) (*Window, error) {
+	var firstErr error
+	for _, provider := range p {
+		w, err := provider.Active(hr, t)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if w != nil {
+			return w, nil
+		}
+	}
+	return nil, firstErr
+}
+
+func appliesTo(namespaces []string, hr *v1.HelmRelease) bool {
+	if len(namespaces) == 0 {
+		return true
+	}
+	for _, ns := range namespaces {
+		if ns == hr.Namespace {
+			return true
+		}
+	}
+	return false
+}
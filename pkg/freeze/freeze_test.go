@@ -0,0 +1,108 @@
+package freeze
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+func TestParseSchedule(t *testing.T) {
+	for _, tc := range []struct {
+		spec    string
+		time    string
+		matches bool
+	}{
+		{"0 18 * * 5", "2020-11-27T18:00:00Z", true}, // Friday
+		{"0 18 * * 5", "2020-11-26T18:00:00Z", false},
+		{"*/15 9-17 * * 1-5", "2020-11-23T09:45:00Z", true},
+		{"*/15 9-17 * * 1-5", "2020-11-23T09:40:00Z", false},
+		{"0 0 * * 7", "2020-11-29T00:00:00Z", true}, // Sunday
+		{"0 0 24,31 12 *", "2020-12-31T00:00:00Z", true},
+		// either the day of month or week matches if both are restricted
+		{"0 0 1 * 1", "2020-11-23T00:00:00Z", true},
+	} {
+		s, err := parseSchedule(tc.spec)
+		assert.NoError(t, err, tc.spec)
+		tm, _ := time.Parse(time.RFC3339, tc.time)
+		assert.Equal(t, tc.matches, s.matches(tm), "%s at %s", tc.spec, tc.time)
+	}
+
+	for _, spec := range []string{"* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "a * * * *", "5-1 * * * *"} {
+		_, err := parseSchedule(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestStatic(t *testing.T) {
+	static, err := NewStatic([]StaticWindow{
+		{Name: "weekend", Schedule: "0 18 * * 5", Duration: "60h", Timezone: "Europe/Berlin", Namespaces: []string{"prod"}},
+	})
+	assert.NoError(t, err)
+	prod := &v1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Name: "podinfo"}}
+	dev := &v1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "podinfo"}}
+
+	// Friday 18:00 in Berlin is 17:00 UTC
+	start := time.Date(2020, 11, 27, 17, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		time   time.Time
+		hr     *v1.HelmRelease
+		frozen bool
+	}{
+		{start.Add(-time.Minute), prod, false},
+		{start, prod, true},
+		{start.Add(30 * time.Hour), prod, true},
+		{start.Add(60*time.Hour - time.Second), prod, true},
+		{start.Add(60 * time.Hour), prod, false},
+		{start.Add(time.Hour), dev, false},
+	} {
+		w, err := static.Active(tc.hr, tc.time)
+		assert.NoError(t, err)
+		if assert.Equal(t, tc.frozen, w != nil, tc.time) && w != nil {
+			assert.Equal(t, "weekend", w.Name)
+			assert.True(t, w.Start.Equal(start))
+			assert.True(t, w.End.Equal(start.Add(60*time.Hour)))
+		}
+	}
+
+	_, err = NewStatic([]StaticWindow{{Name: "invalid", Schedule: "0 18 * * 5", Duration: "forever"}})
+	assert.Error(t, err)
+}
+
+func TestCalendar(t *testing.T) {
+	available := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"windows": [{"name": "black-friday", "start": "2020-11-27T00:00:00Z", "end": "2020-11-30T00:00:00Z", "reason": "peak traffic"}]}`))
+	}))
+	defer srv.Close()
+
+	hr := &v1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Name: "podinfo"}}
+	calendar := NewCalendar(srv.URL, nil, 0)
+	w, err := calendar.Active(hr, time.Date(2020, 11, 28, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	if assert.NotNil(t, w) {
+		assert.Equal(t, "black-friday", w.Name)
+		assert.Equal(t, "peak traffic", w.Reason)
+	}
+	w, err = calendar.Active(hr, time.Date(2020, 11, 30, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Nil(t, w)
+
+	// the previously retrieved windows are used while unavailable
+	available = false
+	w, err = calendar.Active(hr, time.Date(2020, 11, 28, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.NotNil(t, w)
+
+	_, err = NewCalendar(srv.URL, nil, 0).Active(hr, time.Now())
+	assert.Error(t, err)
+}
@@ -0,0 +1,96 @@
+package freeze
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+// StaticWindow is a recurring freeze window, starting on a cron
+// schedule and lasting the given duration.
+type StaticWindow struct {
+	Name string `json:"name"`
+	// Schedule is the cron schedule the window starts on, i.e.
+	// `0 18 * * 5` for Friday evenings.
+	Schedule string `json:"schedule"`
+	// Duration is the duration of the window, i.e. `60h`.
+	Duration string `json:"duration"`
+	// Timezone is the IANA time zone the schedule is in, by default
+	// UTC.
+	Timezone   string   `json:"timezone,omitempty"`
+	Reason     string   `json:"reason,omitempty"`
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+type staticWindow struct {
+	StaticWindow
+	schedule *schedule
+	duration time.Duration
+	location *time.Location
+}
+
+// Static provides recurring freeze windows.
+type Static struct {
+	windows []staticWindow
+}
+
+// NewStatic returns a provider of the given recurring windows.
+func NewStatic(windows []StaticWindow) (*Static, error) {
+	s := &Static{}
+	for _, w := range windows {
+		schedule, err := parseSchedule(w.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("freeze window '%s': %w", w.Name, err)
+		}
+		duration, err := time.ParseDuration(w.Duration)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("freeze window '%s': invalid duration '%s'", w.Name, w.Duration)
+		}
+		location, err := time.LoadLocation(w.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("freeze window '%s': %w", w.Name, err)
+		}
+		s.windows = append(s.windows, staticWindow{w, schedule, duration, location})
+	}
+	return s, nil
+}
+
+// LoadStatic returns a provider of the recurring windows listed in the
+// YAML file at the given path.
+func LoadStatic(path string) (*Static, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var windows []StaticWindow
+	if err := yaml.Unmarshal(b, &windows); err != nil {
+		return nil, fmt.Errorf("failed to parse freeze windows: %w", err)
+	}
+	return NewStatic(windows)
+}
+
+// Active returns the recurring window applying to the HelmRelease at
+// the given time.
+func (s *Static) Active(hr *v1.HelmRelease, t time.Time) (*Window, error) {
+	for _, w := range s.windows {
+		if !appliesTo(w.Namespaces, hr) {
+			continue
+		}
+		start, ok := w.schedule.lastBefore(t.In(w.location), w.duration)
+		if !ok || !t.Before(start.Add(w.duration)) {
+			continue
+		}
+		return &Window{
+			Name:       w.Name,
+			Start:      start,
+			End:        start.Add(w.duration),
+			Reason:     w.Reason,
+			Namespaces: w.Namespaces,
+		}, nil
+	}
+	return nil, nil
+}
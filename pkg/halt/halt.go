@@ -0,0 +1,70 @@
+/*
+Package halt provides the emergency halt switch of the operator. While
+the switch is set, the operator performs no mutating Helm actions,
+i.e. installs, upgrades, rollbacks and uninstalls, while it continues
+to compare releases and report drift. It is meant for cluster-wide
+incidents and maintenance.
+*/
+package halt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	// HaltedKey is the key of the ConfigMap which halts the operator
+	// while it is true.
+	HaltedKey = "halted"
+	// ReasonKey is the key of the ConfigMap giving the reason of the
+	// halt, if any.
+	ReasonKey = "reason"
+)
+
+// Switch tells if mutating Helm actions are halted.
+type Switch interface {
+	// Halted returns if mutating Helm actions are halted, with the
+	// reason of the halt.
+	Halted() (reason string, halted bool, err error)
+}
+
+// ConfigMap is a switch set by the HaltedKey of a ConfigMap. The
+// ConfigMap is retrieved on every check, so the halt applies
+// immediately; the switch is unset if the ConfigMap does not exist.
+type ConfigMap struct {
+	client    corev1client.ConfigMapsGetter
+	namespace string
+	name      string
+}
+
+// NewConfigMap returns a switch set by the ConfigMap with the given
+// namespace and name.
+func NewConfigMap(client corev1client.ConfigMapsGetter, namespace, name string) *ConfigMap {
+	return &ConfigMap{client: client, namespace: namespace, name: name}
+}
+
+// Halted returns if the HaltedKey of the ConfigMap is true, with the
+// value of its ReasonKey.
+func (c *ConfigMap) Halted() (string, bool, error) {
+	cm, err := c.client.ConfigMaps(c.namespace).Get(c.name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		return "", false, nil
+	case err != nil:
+		return "", false, fmt.Errorf("failed to retrieve halt ConfigMap '%s/%s': %w", c.namespace, c.name, err)
+	}
+	v, ok := cm.Data[HaltedKey]
+	if !ok {
+		return "", false, nil
+	}
+	halted, err := strconv.ParseBool(strings.TrimSpace(v))
+	if err != nil {
+		return "", false, fmt.Errorf("invalid value '%s' of key '%s' in halt ConfigMap '%s/%s'", v, HaltedKey, c.namespace, c.name)
+	}
+	return strings.TrimSpace(cm.Data[ReasonKey]), halted, nil
+}
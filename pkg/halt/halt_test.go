@@ -0,0 +1,41 @@
+package halt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConfigMapHalted(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		data   map[string]string
+		reason string
+		halted bool
+		err    bool
+	}{
+		{name: "missing"},
+		{name: "unset", data: map[string]string{}},
+		{name: "halted", data: map[string]string{HaltedKey: "true", ReasonKey: " incident 42\n"}, reason: "incident 42", halted: true},
+		{name: "resumed", data: map[string]string{HaltedKey: "false", ReasonKey: "incident 42"}, reason: "incident 42"},
+		{name: "invalid", data: map[string]string{HaltedKey: "maybe"}, err: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			if tc.data != nil {
+				client = fake.NewSimpleClientset(&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "flux", Name: "helm-operator-halt"},
+					Data:       tc.data,
+				})
+			}
+
+			reason, halted, err := NewConfigMap(client.CoreV1(), "flux", "helm-operator-halt").Halted()
+			assert.Equal(t, tc.err, err != nil)
+			assert.Equal(t, tc.halted, halted)
+			assert.Equal(t, tc.reason, reason)
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package helm
+
+// TestLog holds the captured logs of a failed test pod.
+type TestLog struct {
+	Name string
+	Log  string
+}
+
+// TestError is returned if the tests of a release failed, with the
+// captured logs of the failed test pods.
+type TestError struct {
+	Err  error
+	Logs []TestLog
+}
+
+func (err TestError) Error() string {
+	return err.Err.Error()
+}
+
+func (err TestError) Unwrap() error {
+	return err.Err
+}
+
+// FailedHook describes a hook of a release which failed.
+type FailedHook struct {
+	Name string
+	Kind string
+	// Events are the events the hook runs on, i.e. `pre-install`.
+	Events string
+	// Log holds the trailing logs of the pod run by the hook.
+	Log string
+}
+
+// HookError is returned if hooks of a release failed during an
+// install or upgrade, with the failed hooks.
+type HookError struct {
+	Err   error
+	Hooks []FailedHook
+}
+
+func (err HookError) Error() string {
+	return err.Err.Error()
+}
+
+func (err HookError) Unwrap() error {
+	return err.Err
+}
@@ -16,12 +16,28 @@ type Client interface {
 	RepositoryRemove(name string) error
 	RepositoryImport(path string) error
 	Pull(ref, version, dest string) (string, error)
-	PullWithRepoURL(repoURL, name, version, dest string) (string, error)
+	PullWithRepoURL(repoURL, name, version, dest string, opts PullOptions) (string, error)
+	ResolveChartVersion(repoURL, name, version string, opts PullOptions) (string, error)
 	Uninstall(releaseName string, opts UninstallOptions) error
 	GetChartRevision(chartPath string) (string, error)
+	GetChartValues(chartPath string) (Values, error)
+	VerifyChart(chartPath, provPath, keyring string) error
+	Lint(chartPath string, values []byte, opts LintOptions) ([]LintMessage, error)
+	ValidateValues(chartPath string, values []byte, opts ValidateOptions) error
 	Version() string
 }
 
+// IndexCache caches the indexes of chart repositories, so they are
+// not downloaded again for every chart that is fetched.
+type IndexCache interface {
+	// Get returns the cached value for the given key, calling fetch
+	// to obtain it if it is not cached or has expired.
+	Get(key string, fetch func() (interface{}, error)) (interface{}, error)
+	// Invalidate marks the cached value for the given key as expired,
+	// so the next Get fetches it again.
+	Invalidate(key string)
+}
+
 // Clients is the storage for clients, indexed by version.
 type Clients struct {
 	sm sync.Map
@@ -0,0 +1,19 @@
+package helm
+
+// LintSeverity is the severity of a finding of the chart linter,
+// higher severities are more severe.
+type LintSeverity int
+
+const (
+	LintInfo LintSeverity = iota + 1
+	LintWarning
+	LintError
+)
+
+// LintMessage is a finding of the chart linter.
+type LintMessage struct {
+	Severity LintSeverity
+	// Path is the file of the chart the finding is about.
+	Path    string
+	Message string
+}
@@ -42,8 +42,33 @@ type UpgradeOptions struct {
 	Recreate          bool
 	MaxHistory        int
 	Atomic            bool
+	CleanupOnFail     bool
+	WaitForJobs       bool
+	SubNotes          bool
 	DisableValidation bool
 	PostRenderer      postrender.PostRenderer
+	// ServerSideApply creates and updates the resources of the
+	// release with server-side apply, owned by the FieldManager.
+	ServerSideApply bool
+	FieldManager    string
+	// ChartAnnotations are added to the annotations of the chart
+	// metadata, which is recorded in the release.
+	ChartAnnotations map[string]string
+	// Progress is called periodically with the progress of the
+	// resources of the release while waiting for them to be ready.
+	Progress func(WaitProgress)
+}
+
+// WaitProgress describes the progress of the resources of a release
+// while waiting for them to be ready.
+type WaitProgress struct {
+	// ReadyPods and DesiredPods are the amount of ready and desired
+	// pods of the workloads of the release.
+	ReadyPods   int
+	DesiredPods int
+	// Unready holds the resources which are not ready yet, as
+	// `Kind/name`.
+	Unready []string
 }
 
 // RollbackOptions holds the options available for Helm rollback
@@ -69,6 +94,12 @@ type TestOptions struct {
 	Namespace string
 	Cleanup   bool
 	Timeout   time.Duration
+	// Filters limits the tests run to the tests with the given
+	// names; names prefixed with `!` are excluded instead.
+	Filters []string
+	// LogTailLines is the amount of trailing log lines captured of
+	// failed test pods, zero disables capturing logs.
+	LogTailLines int64
 }
 
 // UninstallOptions holds the options available for Helm uninstall
@@ -81,6 +112,29 @@ type UninstallOptions struct {
 	DryRun       bool
 	KeepHistory  bool
 	Timeout      time.Duration
+	// DeletionPropagation is the propagation policy the resources
+	// of the release are deleted with, i.e. `Foreground`; the
+	// default of the Helm version is used if empty.
+	DeletionPropagation string
+}
+
+// LintOptions holds the options available for Helm lint
+// operations, the version implementation _must_ implement all
+// fields supported by that version but can (silently) ignore
+// unsupported set values.
+type LintOptions struct {
+	Namespace string
+}
+
+// ValidateOptions holds the options available for Helm values
+// validations, the version implementation _must_ implement all
+// fields supported by that version but can (silently) ignore
+// unsupported set values.
+type ValidateOptions struct {
+	// Schemas are the JSON schemas, by the name of their source, the
+	// values are validated against in addition to the schemas of the
+	// chart.
+	Schemas map[string][]byte
 }
 
 // HistoryOption holds the options available for Helm history
@@ -91,3 +145,24 @@ type HistoryOptions struct {
 	Namespace string
 	Max       int
 }
+
+// PullOptions holds the options available for Helm pull
+// operations, the version implementation _must_ implement all
+// fields supported by that version but can (silently) ignore
+// unsupported set values.
+type PullOptions struct {
+	Username string
+	Password string
+	CertFile string
+	KeyFile  string
+	CAFile   string
+	// Provenance fetches the provenance file of the chart alongside
+	// the chart, without verifying it.
+	Provenance bool
+}
+
+// HasCredentials returns if the options hold credentials for the
+// repository.
+func (o PullOptions) HasCredentials() bool {
+	return o.Username != "" || o.Password != "" || o.CertFile != "" || o.KeyFile != "" || o.CAFile != ""
+}
@@ -33,6 +33,9 @@ type Release struct {
 	Values    map[string]interface{}
 	Manifest  string
 	Version   int
+	// Hooks holds the rendered manifests of the hooks of the
+	// release, named by their template path.
+	Hooks []*File
 }
 
 // Info holds metadata of a chart deployment
@@ -40,6 +43,8 @@ type Info struct {
 	LastDeployed time.Time
 	Description  string
 	Status       Status
+	// Notes holds the rendered NOTES.txt of the chart.
+	Notes string
 }
 
 // Chart describes the chart for a release
@@ -49,6 +54,9 @@ type Chart struct {
 	AppVersion string
 	Values     Values
 	Templates  []*File
+	// CRDs holds the files in the crds/ directories of the chart and
+	// its dependencies.
+	CRDs []*File
 }
 
 // File represents a file as a name/value pair.
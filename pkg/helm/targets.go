@@ -0,0 +1,79 @@
+package helm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/dynamic"
+)
+
+// Target holds the clients for a remote target cluster: the Helm
+// client making the releases, and the clients for the objects of the
+// releases, of which the ownership is determined.
+type Target struct {
+	Client  Client
+	Dynamic dynamic.Interface
+	Mapper  meta.RESTMapper
+}
+
+// NewTargetFunc constructs the clients of the given Helm version for
+// the cluster of the given kubeconfig.
+type NewTargetFunc func(version string, kubeConfig []byte) (Target, error)
+
+// TargetClients caches the clients for remote target clusters, by
+// their Helm version and kubeconfig. Clients expire after the TTL, so
+// the connections and credentials of clusters that are no longer
+// targeted, or of which the kubeconfig was rotated, are released.
+type TargetClients struct {
+	newTarget NewTargetFunc
+	ttl       time.Duration
+	now       func() time.Time
+
+	mu      sync.Mutex
+	clients map[string]targetClient
+}
+
+type targetClient struct {
+	target  Target
+	expires time.Time
+}
+
+// NewTargetClients returns a cache of clients for remote target
+// clusters, constructed with the given function.
+func NewTargetClients(newTarget NewTargetFunc, ttl time.Duration) *TargetClients {
+	return &TargetClients{
+		newTarget: newTarget,
+		ttl:       ttl,
+		now:       time.Now,
+		clients:   make(map[string]targetClient),
+	}
+}
+
+// Load returns the clients of the given Helm version for the cluster of
+// the given kubeconfig, constructing them if they are not cached or have
+// expired.
+func (tc *TargetClients) Load(version string, kubeConfig []byte) (Target, error) {
+	sum := sha256.Sum256(kubeConfig)
+	key := version + "/" + hex.EncodeToString(sum[:])
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	now := tc.now()
+	for k, c := range tc.clients {
+		if !now.Before(c.expires) {
+			delete(tc.clients, k)
+		}
+	}
+	if c, ok := tc.clients[key]; ok {
+		return c.target, nil
+	}
+	target, err := tc.newTarget(version, kubeConfig)
+	if err != nil {
+		return Target{}, err
+	}
+	tc.clients[key] = targetClient{target: target, expires: now.Add(tc.ttl)}
+	return target, nil
+}
@@ -0,0 +1,41 @@
+package helm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type targetTestClient struct {
+	Client
+	id int
+}
+
+func TestTargetClients(t *testing.T) {
+	var created int
+	tc := NewTargetClients(func(version string, kubeConfig []byte) (Target, error) {
+		created++
+		return Target{Client: targetTestClient{id: created}}, nil
+	}, time.Minute)
+	now := time.Now()
+	tc.now = func() time.Time { return now }
+
+	a, err := tc.Load("v3", []byte("a"))
+	assert.NoError(t, err)
+	cached, err := tc.Load("v3", []byte("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, a, cached)
+
+	b, err := tc.Load("v3", []byte("b"))
+	assert.NoError(t, err)
+	assert.NotEqual(t, a, b)
+	assert.Equal(t, 2, created)
+
+	// clients expire after the TTL
+	now = now.Add(time.Minute)
+	expired, err := tc.Load("v3", []byte("a"))
+	assert.NoError(t, err)
+	assert.NotEqual(t, a, expired)
+	assert.Len(t, tc.clients, 1)
+}
@@ -6,15 +6,26 @@ import (
 	"github.com/google/go-cmp/cmp"
 )
 
+// numericOpt compares numeric values regardless of their type.
+var numericOpt = cmp.FilterValues(func(x, y interface{}) bool {
+	isNumeric := func(v interface{}) bool {
+		return v != nil && reflect.TypeOf(v).ConvertibleTo(reflect.TypeOf(float64(0)))
+	}
+	return isNumeric(x) && isNumeric(y)
+}, cmp.Transformer("T", func(v interface{}) float64 {
+	return reflect.ValueOf(v).Convert(reflect.TypeOf(float64(0))).Float()
+}))
+
 func Diff(j *Release, k *Release) string {
-	opt := cmp.FilterValues(func(x, y interface{}) bool {
-		isNumeric := func(v interface{}) bool {
-			return v != nil && reflect.TypeOf(v).ConvertibleTo(reflect.TypeOf(float64(0)))
-		}
-		return isNumeric(x) && isNumeric(y)
-	}, cmp.Transformer("T", func(v interface{}) float64 {
-		return reflect.ValueOf(v).Convert(reflect.TypeOf(float64(0))).Float()
-	}))
+	return DiffValues(j, k) + DiffChart(j, k)
+}
+
+// DiffValues returns the diff of the values of the releases.
+func DiffValues(j *Release, k *Release) string {
+	return cmp.Diff(j.Values, k.Values, numericOpt)
+}
 
-	return cmp.Diff(j.Values, k.Values, opt) + cmp.Diff(j.Chart, k.Chart, opt)
+// DiffChart returns the diff of the charts of the releases.
+func DiffChart(j *Release, k *Release) string {
+	return cmp.Diff(j.Chart, k.Chart, numericOpt)
 }
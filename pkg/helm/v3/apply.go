@@ -0,0 +1,101 @@
+package v3
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/resource"
+
+	"helm.sh/helm/v3/pkg/kube"
+)
+
+// applyClient creates and updates resources with server-side apply
+// under the given field manager, as the Kubernetes client of Helm
+// 3.1 only supports client-side three-way merges. Like Helm, creating
+// a resource which exists already and updating a resource which is not
+// part of the original release fail. Conflicting fields owned by other
+// managers are only taken over when the update is forced.
+type applyClient struct {
+	kube.Interface
+	fieldManager string
+}
+
+func (c *applyClient) Create(resources kube.ResourceList) (*kube.Result, error) {
+	res := &kube.Result{}
+	for _, info := range resources {
+		_, err := resource.NewHelper(info.Client, info.Mapping).Get(info.Namespace, info.Name, info.Export)
+		switch {
+		case err == nil:
+			err = apierrors.NewAlreadyExists(info.Mapping.Resource.GroupResource(), info.Name)
+			return res, fmt.Errorf("failed to create resource: %w", err)
+		case !apierrors.IsNotFound(err):
+			return res, fmt.Errorf("could not get information about the resource: %w", err)
+		}
+		if err := c.apply(info, false); err != nil {
+			return res, fmt.Errorf("failed to create resource: %w", err)
+		}
+		res.Created = append(res.Created, info)
+	}
+	return res, nil
+}
+
+func (c *applyClient) Update(original, target kube.ResourceList, force bool) (*kube.Result, error) {
+	res := &kube.Result{}
+	var applyErrors []string
+	for _, info := range target {
+		helper := resource.NewHelper(info.Client, info.Mapping)
+		_, err := helper.Get(info.Namespace, info.Name, info.Export)
+		switch {
+		case apierrors.IsNotFound(err):
+			res.Created = append(res.Created, info)
+			if err := c.apply(info, force); err != nil {
+				return res, fmt.Errorf("failed to create resource: %w", err)
+			}
+			continue
+		case err != nil:
+			return res, fmt.Errorf("could not get information about the resource: %w", err)
+		case original.Get(info) == nil:
+			// the resource exists, but is not owned by the release
+			return res, fmt.Errorf("no %s with the name %q found", info.Mapping.GroupVersionKind.Kind, info.Name)
+		}
+		if err := c.apply(info, force); err != nil {
+			applyErrors = append(applyErrors, err.Error())
+		}
+		res.Updated = append(res.Updated, info)
+	}
+	if len(applyErrors) > 0 {
+		return res, fmt.Errorf("%s", strings.Join(applyErrors, " && "))
+	}
+
+	// like Helm, delete the resources which are no longer part of the
+	// release
+	for _, info := range original.Difference(target) {
+		res.Deleted = append(res.Deleted, info)
+		helper := resource.NewHelper(info.Client, info.Mapping)
+		policy := metav1.DeletePropagationBackground
+		if _, err := helper.DeleteWithOptions(info.Namespace, info.Name, &metav1.DeleteOptions{PropagationPolicy: &policy}); err != nil && !apierrors.IsNotFound(err) {
+			return res, fmt.Errorf("failed to delete %q: %w", info.Name, err)
+		}
+	}
+	return res, nil
+}
+
+// apply applies the object of the resource with server-side apply,
+// taking over conflicting fields if forced, and refreshes the resource
+// with the applied object.
+func (c *applyClient) apply(info *resource.Info, force bool) error {
+	data, err := json.Marshal(info.Object)
+	if err != nil {
+		return err
+	}
+	obj, err := resource.NewHelper(info.Client, info.Mapping).Patch(info.Namespace, info.Name, types.ApplyPatchType, data,
+		&metav1.PatchOptions{FieldManager: c.fieldManager, Force: &force})
+	if err != nil {
+		return fmt.Errorf("failed to apply %s '%s': %w", info.Mapping.GroupVersionKind.Kind, info.Name, err)
+	}
+	return info.Refresh(obj, true)
+}
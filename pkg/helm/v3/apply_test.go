@@ -0,0 +1,131 @@
+package v3
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/kube"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest/fake"
+)
+
+// applyServer is a fake API server for ConfigMaps, recording the
+// server-side applies it receives.
+type applyServer struct {
+	existing map[string]bool
+	// applied holds the name and force parameter of every apply
+	applied []string
+}
+
+func (s *applyServer) client() *fake.RESTClient {
+	return &fake.RESTClient{
+		NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+		GroupVersion:         corev1.SchemeGroupVersion,
+		Client: fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+			name := path.Base(req.URL.Path)
+			switch req.Method {
+			case http.MethodGet:
+				if !s.existing[name] {
+					return statusResponse(http.StatusNotFound, metav1.StatusReasonNotFound), nil
+				}
+			case http.MethodPatch:
+				s.applied = append(s.applied, name+" force="+req.URL.Query().Get("force"))
+				s.existing[name] = true
+			case http.MethodDelete:
+				delete(s.existing, name)
+				return statusResponse(http.StatusOK, ""), nil
+			}
+			body := fmt.Sprintf(`{"kind":"ConfigMap","apiVersion":"v1","metadata":{"name":%q,"namespace":"default"}}`, name)
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       ioutil.NopCloser(strings.NewReader(body)),
+			}, nil
+		}),
+	}
+}
+
+func statusResponse(code int, reason metav1.StatusReason) *http.Response {
+	body := `{"kind":"Status","apiVersion":"v1","status":"Success"}`
+	if code != http.StatusOK {
+		body = fmt.Sprintf(`{"kind":"Status","apiVersion":"v1","status":"Failure","code":%d,"reason":%q}`, code, reason)
+	}
+	return &http.Response{
+		StatusCode: code,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func (s *applyServer) resources(names ...string) kube.ResourceList {
+	mapping := &meta.RESTMapping{
+		Resource:         schema.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+		GroupVersionKind: corev1.SchemeGroupVersion.WithKind("ConfigMap"),
+		Scope:            meta.RESTScopeNamespace,
+	}
+	var list kube.ResourceList
+	for _, name := range names {
+		list = append(list, &resource.Info{
+			Client:    s.client(),
+			Mapping:   mapping,
+			Namespace: "default",
+			Name:      name,
+			Object: &corev1.ConfigMap{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			},
+		})
+	}
+	return list
+}
+
+func TestApplyClientCreate(t *testing.T) {
+	s := &applyServer{existing: map[string]bool{"foreign": true}}
+	c := &applyClient{fieldManager: "helm-operator"}
+
+	res, err := c.Create(s.resources("new"))
+	assert.NoError(t, err)
+	assert.Len(t, res.Created, 1)
+	assert.Equal(t, []string{"new force=false"}, s.applied)
+
+	// existing resources are not adopted
+	_, err = c.Create(s.resources("foreign"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "already exists")
+	assert.Equal(t, []string{"new force=false"}, s.applied)
+}
+
+func TestApplyClientUpdate(t *testing.T) {
+	s := &applyServer{existing: map[string]bool{"owned": true, "removed": true, "foreign": true}}
+	c := &applyClient{fieldManager: "helm-operator"}
+
+	res, err := c.Update(s.resources("owned", "removed"), s.resources("owned", "new"), false)
+	assert.NoError(t, err)
+	assert.Len(t, res.Updated, 1)
+	assert.Len(t, res.Created, 1)
+	assert.Len(t, res.Deleted, 1)
+	assert.Equal(t, []string{"owned force=false", "new force=false"}, s.applied)
+	assert.False(t, s.existing["removed"])
+
+	// conflicting fields are only taken over when forced
+	s.applied = nil
+	_, err = c.Update(s.resources("owned"), s.resources("owned"), true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"owned force=true"}, s.applied)
+
+	// existing resources not in the original release are not adopted
+	s.applied = nil
+	_, err = c.Update(s.resources("owned"), s.resources("owned", "foreign"), false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `no ConfigMap with the name "foreign" found`)
+}
@@ -1,9 +1,17 @@
 package v3
 
 import (
+	"errors"
 	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/provenance"
+
+	"github.com/lstack-org/helm-operator/pkg/helm"
 )
 
 func (h *HelmV3) GetChartRevision(chartPath string) (string, error) {
@@ -13,3 +21,72 @@ func (h *HelmV3) GetChartRevision(chartPath string) (string, error) {
 	}
 	return chartRequested.Metadata.Version, nil
 }
+
+// GetChartValues returns the default values of the chart at the
+// given path.
+func (h *HelmV3) GetChartValues(chartPath string) (helm.Values, error) {
+	chartRequested, err := loader.Load(chartPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chart to read its values: %w", err)
+	}
+	return chartRequested.Values, nil
+}
+
+// VerifyChart verifies the chart archive at the given path against
+// the provenance file at the given path, using the given public
+// keyring.
+func (h *HelmV3) VerifyChart(chartPath, provPath, keyring string) error {
+	if !strings.EqualFold(filepath.Ext(chartPath), ".tgz") {
+		return fmt.Errorf("failed to verify chart: chart must be a tgz file")
+	}
+	sig, err := provenance.NewFromKeyring(keyring, "")
+	if err != nil {
+		return fmt.Errorf("failed to verify chart: failed to load keyring: %w", err)
+	}
+	if _, err := sig.Verify(chartPath, provPath); err != nil {
+		return fmt.Errorf("failed to verify chart: %w", err)
+	}
+	return nil
+}
+
+// ValidateValues validates the given values, coalesced with the
+// default values of the chart at the given path, against the
+// `values.schema.json` of the chart and its enabled dependencies, and
+// the additional schemas, the way Helm does when rendering the chart.
+// The returned error lists all violations.
+func (h *HelmV3) ValidateValues(chartPath string, values []byte, opts helm.ValidateOptions) error {
+	chartRequested, err := loader.Load(chartPath)
+	if err != nil {
+		return fmt.Errorf("failed to load chart to validate values: %w", err)
+	}
+	vals, err := chartutil.ReadValues(values)
+	if err != nil {
+		return err
+	}
+	if err := chartutil.ProcessDependencies(chartRequested, vals); err != nil {
+		return fmt.Errorf("failed to process chart dependencies to validate values: %w", err)
+	}
+	coalesced, err := chartutil.CoalesceValues(chartRequested, vals)
+	if err != nil {
+		return fmt.Errorf("failed to coalesce values to validate them: %w", err)
+	}
+
+	var violations []string
+	if err := chartutil.ValidateAgainstSchema(chartRequested, coalesced); err != nil {
+		violations = append(violations, strings.TrimSpace(err.Error()))
+	}
+	var names []string
+	for name := range opts.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := chartutil.ValidateAgainstSingleSchema(coalesced, opts.Schemas[name]); err != nil {
+			violations = append(violations, fmt.Sprintf("%s:\n%s", name, strings.TrimSpace(err.Error())))
+		}
+	}
+	if len(violations) > 0 {
+		return errors.New(strings.Join(violations, "\n"))
+	}
+	return nil
+}
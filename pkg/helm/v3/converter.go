@@ -1,19 +1,49 @@
 package v3
 
 import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/helm/helm-2to3/pkg/common"
 	helm2 "github.com/helm/helm-2to3/pkg/v2"
 	helm3 "github.com/helm/helm-2to3/pkg/v3"
+	"github.com/spf13/pflag"
 )
 
+// ConvertCommand is the command the operator binary is invoked with to
+// run a conversion in a child process, so that a hung conversion can
+// be killed.
+const ConvertCommand = "convert-2to3"
+
+// ConvertTimeoutError is returned when a conversion did not complete
+// within the timeout of the converter.
+type ConvertTimeoutError struct {
+	Timeout time.Duration
+}
+
+func (err ConvertTimeoutError) Error() string {
+	return fmt.Sprintf("conversion did not complete within %s and has been killed", err.Timeout)
+}
+
 // Converter Converts a given helm 2 release with all its release versions to helm 3 format and deletes the old release from tiller
 type Converter struct {
 	TillerNamespace  string
 	KubeConfig       string // file path to kubeconfig
 	TillerOutCluster bool
 	StorageType      string
+	// Timeout is the duration after which a conversion is killed;
+	// disabled if 0.
+	Timeout time.Duration
+	// Attempts is the number of times a conversion is attempted before
+	// giving up, when it is killed after the timeout.
+	Attempts int
 }
 
 // V2ReleaseExists helps you check if a helm v2 release exists or not
@@ -38,7 +68,112 @@ func (c Converter) V2ReleaseExists(releaseName string) (bool, error) {
 }
 
 // Convert attempts to convert the given release name from v2 to v3.
-func (c Converter) Convert(releaseName string, dryRun bool) error {
+// The conversion runs in a child process, which is killed and retried
+// if it does not complete within the timeout. Every line of output of
+// the conversion is passed to output.
+func (c Converter) Convert(releaseName string, dryRun bool, output func(line string)) error {
+	attempts := c.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for i := 1; i <= attempts; i++ {
+		err = c.convertProcess(releaseName, dryRun, output)
+		if _, ok := err.(ConvertTimeoutError); !ok {
+			return err
+		}
+		output(fmt.Sprintf("attempt %d of %d: %v", i, attempts, err))
+	}
+	return err
+}
+
+// convertProcess runs the conversion of the given release name in a
+// child process, streaming its output to output.
+func (c Converter) convertProcess(releaseName string, dryRun bool, output func(line string)) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to determine operator executable: %w", err)
+	}
+	args := []string{ConvertCommand,
+		"--release-name", releaseName,
+		"--tiller-namespace", c.TillerNamespace,
+	}
+	if c.KubeConfig != "" {
+		args = append(args, "--kubeconfig", c.KubeConfig)
+	}
+	if dryRun {
+		args = append(args, "--dry-run")
+	}
+
+	ctx := context.Background()
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, exe, args...)
+	pr, pw := io.Pipe()
+	cmd.Stdout, cmd.Stderr = pw, pw
+
+	var last string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(pr)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				last = line
+				output(line)
+			}
+		}
+		// drain the pipe so the child never blocks on writing
+		io.Copy(ioutil.Discard, pr)
+	}()
+	err = cmd.Run()
+	pw.Close()
+	<-done
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return ConvertTimeoutError{Timeout: c.Timeout}
+	}
+	if err != nil {
+		if last != "" {
+			return fmt.Errorf("conversion failed: %s", last)
+		}
+		return fmt.Errorf("conversion failed: %w", err)
+	}
+	return nil
+}
+
+// RunConvertCommand runs the conversion configured by the given
+// arguments of the ConvertCommand in the current process, and returns
+// the exit code.
+func RunConvertCommand(args []string) int {
+	fs := pflag.NewFlagSet(ConvertCommand, pflag.ContinueOnError)
+	releaseName := fs.String("release-name", "", "name of the Helm v2 release to convert")
+	tillerNamespace := fs.String("tiller-namespace", "kube-system", "namespace of Tiller")
+	kubeConfig := fs.String("kubeconfig", "", "path to a kubeconfig")
+	dryRun := fs.Bool("dry-run", false, "simulate the conversion")
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *releaseName == "" {
+		fmt.Fprintln(os.Stderr, "a release name is required")
+		return 2
+	}
+	c := Converter{TillerNamespace: *tillerNamespace, KubeConfig: *kubeConfig}
+	if err := c.convert(*releaseName, *dryRun); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// convert converts the given release name from v2 to v3. Release
+// versions which have already been stored by an earlier, killed
+// attempt are skipped.
+func (c Converter) convert(releaseName string, dryRun bool) error {
 	retrieveOpts := helm2.RetrieveOptions{
 		ReleaseName:     releaseName,
 		TillerNamespace: c.TillerNamespace,
@@ -57,7 +192,8 @@ func (c Converter) Convert(releaseName string, dryRun bool) error {
 			if err != nil {
 				return err
 			}
-			if err := helm3.StoreRelease(v3Release, kubeConfig); err != nil {
+			err = helm3.StoreRelease(v3Release, kubeConfig)
+			if err != nil && !strings.Contains(err.Error(), "already exists") {
 				return err
 			}
 		}
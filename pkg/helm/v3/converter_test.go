@@ -0,0 +1,72 @@
+package v3
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// convertTestMode is the environment variable of the mode the test
+// binary runs the ConvertCommand in, in place of the conversion.
+const convertTestMode = "CONVERT_TEST_MODE"
+
+func TestMain(m *testing.M) {
+	// the converter runs the conversion with the current executable,
+	// which is the test binary
+	if len(os.Args) > 1 && os.Args[1] == ConvertCommand {
+		os.Exit(fakeConvert())
+	}
+	os.Exit(m.Run())
+}
+
+func fakeConvert() int {
+	switch os.Getenv(convertTestMode) {
+	case "hang":
+		fmt.Println("retrieving release")
+		time.Sleep(time.Minute)
+		return 0
+	case "fail":
+		fmt.Println("retrieving release")
+		fmt.Fprintln(os.Stderr, "release 'podinfo' not found")
+		return 1
+	}
+	fmt.Println("converted release")
+	return 0
+}
+
+func TestConverterConvert(t *testing.T) {
+	defer os.Unsetenv(convertTestMode)
+
+	for _, tc := range []struct {
+		mode    string
+		wantErr error
+		output  []string
+	}{
+		{mode: "ok", output: []string{"converted release"}},
+		{mode: "fail", wantErr: fmt.Errorf("conversion failed: release 'podinfo' not found"),
+			output: []string{"retrieving release", "release 'podinfo' not found"}},
+		{mode: "hang", wantErr: ConvertTimeoutError{Timeout: 500 * time.Millisecond}, output: []string{
+			"retrieving release",
+			"attempt 1 of 2: conversion did not complete within 500ms and has been killed",
+			"retrieving release",
+			"attempt 2 of 2: conversion did not complete within 500ms and has been killed",
+		}},
+	} {
+		t.Run(tc.mode, func(t *testing.T) {
+			os.Setenv(convertTestMode, tc.mode)
+			c := Converter{TillerNamespace: "kube-system", Timeout: 500 * time.Millisecond, Attempts: 2}
+			var output []string
+			err := c.Convert("podinfo", false, func(line string) { output = append(output, line) })
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.output, output)
+		})
+	}
+}
+
+func TestRunConvertCommand(t *testing.T) {
+	assert.Equal(t, 2, RunConvertCommand([]string{"--tiller-namespace", "kube-system"}))
+	assert.Equal(t, 2, RunConvertCommand([]string{"--unknown"}))
+}
@@ -1,33 +1,262 @@
 package v3
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/Masterminds/semver/v3"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/helmpath"
 
+	"github.com/lstack-org/helm-operator/pkg/helm"
 	"github.com/lstack-org/helm-operator/pkg/utils"
 )
 
+var (
+	// dependencyCache holds the archives of the dependencies of charts
+	// with a lock file, by the digest of the lock.
+	dependencyCache = helmpath.CachePath("dependencies")
+	// dependencyCacheMaxAge is the duration after its last use the
+	// dependencies of a lock are removed from the cache.
+	dependencyCacheMaxAge = 24 * time.Hour
+	// maxParallelDependencyDownloads is the amount of dependencies of
+	// a chart downloaded in parallel.
+	maxParallelDependencyDownloads = 4
+	// dependencyCacheLock is held for writing while the cache is
+	// garbage collected, and for reading while dependencies are taken
+	// from it, so these are not removed while in use.
+	dependencyCacheLock sync.RWMutex
+)
+
 func (h *HelmV3) DependencyUpdate(chartPath string) error {
 	// Garbage collect before the dependency update so that
 	// anonymous files from previous runs are cleared, with
 	// a safe guard time offset to not touch any files in
 	// use.
-	garbageCollect(repositoryCache, time.Second * 300)
+	garbageCollect(repositoryCache, time.Second*300)
+	garbageCollectDependencies(dependencyCache, dependencyCacheMaxAge)
+
+	// The dependencies of charts with a lock file in sync with the
+	// dependencies of the chart are not resolved again, but taken from
+	// the cache or downloaded in parallel.
+	c, err := loader.LoadDir(chartPath)
+	if err != nil {
+		return err
+	}
+	if lockInSync(c) {
+		return h.lockedDependencies(chartPath, c.Lock)
+	}
+
+	repositoryConfigLock.RLock()
+	repoFile, err := loadRepositoryConfig()
+	repositoryConfigLock.RUnlock()
+	if err != nil {
+		return err
+	}
 	out := utils.NewLogWriter(h.logger)
 	man := &downloader.Manager{
 		Out:              out,
 		ChartPath:        chartPath,
 		RepositoryConfig: repositoryConfig,
 		RepositoryCache:  repositoryCache,
-		Getters:          getterProviders(),
+		Getters:          h.getterProviders(repoFile.Repositories...),
 	}
 	return man.Update()
 }
 
+// lockInSync returns if the given chart has a lock file which locks
+// every dependency of the chart to a version satisfying it, and locks
+// these from chart repositories only. The lock of charts with local
+// dependencies is never considered in sync, as these may change
+// without the lock changing.
+func lockInSync(c *chart.Chart) bool {
+	if c.Lock == nil || c.Lock.Digest == "" || len(c.Metadata.Dependencies) != len(c.Lock.Dependencies) {
+		return false
+	}
+	locked := make(map[string]*chart.Dependency)
+	for _, dep := range c.Lock.Dependencies {
+		if dep.Repository == "" || strings.HasPrefix(dep.Repository, "file://") {
+			return false
+		}
+		locked[dep.Name] = dep
+	}
+	for _, req := range c.Metadata.Dependencies {
+		dep, ok := locked[req.Name]
+		if !ok {
+			return false
+		}
+		constraint, err := semver.NewConstraint(req.Version)
+		if err != nil {
+			return false
+		}
+		v, err := semver.NewVersion(dep.Version)
+		if err != nil || !constraint.Check(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// lockedDependencies saves the archives of the dependencies in the
+// given lock to the charts directory of the chart at chartPath,
+// taking them from the cache if they were downloaded before.
+func (h *HelmV3) lockedDependencies(chartPath string, lock *chart.Lock) error {
+	dependencyCacheLock.RLock()
+	defer dependencyCacheLock.RUnlock()
+
+	sum := sha256.Sum256([]byte(lock.Digest))
+	cached := filepath.Join(dependencyCache, hex.EncodeToString(sum[:16]))
+	if _, err := os.Stat(cached); err != nil {
+		if err := h.downloadDependencies(cached, lock.Dependencies); err != nil {
+			return err
+		}
+	} else {
+		now := time.Now()
+		if err := os.Chtimes(cached, now, now); err != nil {
+			return fmt.Errorf("failed to mark cached dependencies as used: %w", err)
+		}
+	}
+
+	destPath := filepath.Join(chartPath, "charts")
+	if err := os.MkdirAll(destPath, 0755); err != nil {
+		return err
+	}
+	for _, dep := range lock.Dependencies {
+		if err := removeDependency(destPath, dep.Name); err != nil {
+			return err
+		}
+	}
+	archives, err := ioutil.ReadDir(cached)
+	if err != nil {
+		return err
+	}
+	for _, a := range archives {
+		if err := copyFile(filepath.Join(cached, a.Name()), filepath.Join(destPath, a.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// downloadDependencies downloads the archives of the given locked
+// dependencies in parallel, and stores them in the cache at dest.
+func (h *HelmV3) downloadDependencies(dest string, deps []*chart.Dependency) error {
+	if err := os.MkdirAll(dependencyCache, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempDir(dependencyCache, "download-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	repoURLs, err := repositoryURLs()
+	if err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxParallelDependencyDownloads)
+	errs := make([]error, len(deps))
+	for i, dep := range deps {
+		wg.Add(1)
+		go func(i int, dep *chart.Dependency) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			repoURL := dep.Repository
+			if name := strings.TrimPrefix(strings.TrimPrefix(repoURL, "@"), "alias:"); name != repoURL {
+				if repoURL = repoURLs[name]; repoURL == "" {
+					errs[i] = fmt.Errorf("no repository definition for %s", dep.Repository)
+					return
+				}
+			}
+			if _, err := h.PullWithRepoURL(repoURL, dep.Name, dep.Version, tmp, helm.PullOptions{}); err != nil {
+				errs[i] = fmt.Errorf("could not download dependency %s %s: %w", dep.Name, dep.Version, err)
+			}
+		}(i, dep)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	// the dependencies may have been downloaded concurrently for
+	// another chart with the same lock
+	if err := os.Rename(tmp, dest); err != nil {
+		if _, statErr := os.Stat(dest); statErr == nil {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// repositoryURLs returns the URLs of the configured repositories, by
+// their name.
+func repositoryURLs() (map[string]string, error) {
+	repositoryConfigLock.RLock()
+	f, err := loadRepositoryConfig()
+	repositoryConfigLock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	urls := make(map[string]string)
+	for _, e := range f.Repositories {
+		urls[e.Name] = e.URL
+	}
+	return urls, nil
+}
+
+// removeDependency removes the archives of any version of the
+// dependency with the given name from the charts directory at dir.
+func removeDependency(dir, name string) error {
+	files, err := filepath.Glob(filepath.Join(dir, name+"-*.tgz"))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		// the pattern also matches dependencies of which the name has
+		// the given name as a prefix
+		if c, err := loader.LoadFile(f); err != nil || c.Name() != name {
+			continue
+		}
+		if err := os.Remove(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
 // garbageCollect walks over the files in the given path and deletes
 // any anonymous index file with a mod time older than the given
 // duration.
@@ -45,3 +274,18 @@ func garbageCollect(path string, olderThan time.Duration) {
 		return nil
 	})
 }
+
+// garbageCollectDependencies deletes the cached dependencies in the
+// given path which have not been used for the given duration.
+func garbageCollectDependencies(path string, olderThan time.Duration) {
+	dependencyCacheLock.Lock()
+	defer dependencyCacheLock.Unlock()
+
+	now := time.Now()
+	entries, _ := ioutil.ReadDir(path)
+	for _, e := range entries {
+		if e.IsDir() && now.Sub(e.ModTime()) > olderThan {
+			os.RemoveAll(filepath.Join(path, e.Name()))
+		}
+	}
+}
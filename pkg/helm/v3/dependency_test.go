@@ -0,0 +1,68 @@
+package v3
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+func TestLockInSync(t *testing.T) {
+	newChart := func(version, repository string) *chart.Chart {
+		return &chart.Chart{
+			Metadata: &chart.Metadata{Dependencies: []*chart.Dependency{{Name: "redis", Version: "^10.0.0"}}},
+			Lock: &chart.Lock{
+				Digest:       "sha256:abc",
+				Dependencies: []*chart.Dependency{{Name: "redis", Version: version, Repository: repository}},
+			},
+		}
+	}
+	assert.True(t, lockInSync(newChart("10.5.7", "https://charts.example.com")))
+	assert.False(t, lockInSync(newChart("11.0.0", "https://charts.example.com")))
+	assert.False(t, lockInSync(newChart("10.5.7", "file://../redis")))
+
+	c := newChart("10.5.7", "https://charts.example.com")
+	c.Lock = nil
+	assert.False(t, lockInSync(c))
+}
+
+func TestLockedDependencies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dependencies")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(cache string) { dependencyCache = cache }(dependencyCache)
+	dependencyCache = filepath.Join(dir, "cache")
+
+	lock := &chart.Lock{Digest: "sha256:abc", Dependencies: []*chart.Dependency{{Name: "redis", Version: "10.5.7"}}}
+	sum := sha256.Sum256([]byte(lock.Digest))
+	cached := filepath.Join(dependencyCache, hex.EncodeToString(sum[:16]))
+	assert.NoError(t, os.MkdirAll(cached, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(cached, "redis-10.5.7.tgz"), []byte("archive"), 0644))
+	old := time.Now().Add(-2 * dependencyCacheMaxAge)
+	assert.NoError(t, os.Chtimes(cached, old, old))
+
+	// the dependencies are taken from the cache, which marks them used
+	h := &HelmV3{logger: log.NewNopLogger()}
+	chartPath := filepath.Join(dir, "chart")
+	assert.NoError(t, h.lockedDependencies(chartPath, lock))
+	b, err := ioutil.ReadFile(filepath.Join(chartPath, "charts", "redis-10.5.7.tgz"))
+	assert.NoError(t, err)
+	assert.Equal(t, "archive", string(b))
+
+	garbageCollectDependencies(dependencyCache, dependencyCacheMaxAge)
+	_, err = os.Stat(cached)
+	assert.NoError(t, err)
+
+	// unused dependencies are collected
+	assert.NoError(t, os.Chtimes(cached, old, old))
+	garbageCollectDependencies(dependencyCache, dependencyCacheMaxAge)
+	_, err = os.Stat(cached)
+	assert.True(t, os.IsNotExist(err))
+}
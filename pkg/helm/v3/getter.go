@@ -0,0 +1,125 @@
+package v3
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// getterUserAgent is the user agent of the requests of the getter, for
+// chart repositories to tell Helm requests apart.
+const getterUserAgent = "Helm/3.1.2"
+
+// getterProviders returns the getter providers Helm downloads chart
+// repository indexes and charts with. With an HTTP transport
+// configured, HTTP(S) URLs are downloaded using it, authenticating
+// with the credentials of the given repository entries.
+func (h *HelmV3) getterProviders(entries ...*repo.Entry) getter.Providers {
+	providers := getter.All(&cli.EnvSettings{
+		RepositoryConfig: repositoryConfig,
+		RepositoryCache:  repositoryCache,
+		PluginsDirectory: pluginsDir,
+	})
+	if h.transport == nil {
+		return providers
+	}
+	for i, p := range providers {
+		if p.Provides("http") || p.Provides("https") {
+			providers[i].New = func(...getter.Option) (getter.Getter, error) {
+				return &httpGetter{transport: h.transport, entries: entries}, nil
+			}
+		}
+	}
+	return providers
+}
+
+// httpGetter downloads HTTP(S) URLs using the given transport. As the
+// options passed to getters can not be read outside of Helm, the
+// credentials are taken from the repository entry with the longest URL
+// the requested URL starts with.
+type httpGetter struct {
+	transport *http.Transport
+	entries   []*repo.Entry
+}
+
+func (g *httpGetter) Get(href string, _ ...getter.Option) (*bytes.Buffer, error) {
+	entry := entryFor(g.entries, href)
+	client, err := g.client(entry)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, href, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", getterUserAgent)
+	if entry != nil && entry.Username != "" && entry.Password != "" {
+		req.SetBasicAuth(entry.Username, entry.Password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s : %s", href, resp.Status)
+	}
+	buf := bytes.NewBuffer(nil)
+	_, err = io.Copy(buf, resp.Body)
+	return buf, err
+}
+
+// client returns the HTTP client for the given repository entry, with
+// its TLS client certificate and CA, if any.
+func (g *httpGetter) client(entry *repo.Entry) (*http.Client, error) {
+	if entry == nil || (entry.CertFile == "" && entry.KeyFile == "" && entry.CAFile == "") {
+		return &http.Client{Transport: g.transport}, nil
+	}
+	config := &tls.Config{}
+	if g.transport.TLSClientConfig != nil {
+		config = g.transport.TLSClientConfig.Clone()
+	}
+	if entry.CertFile != "" && entry.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(entry.CertFile, entry.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't create TLS config for client: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if entry.CAFile != "" {
+		b, err := ioutil.ReadFile(entry.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't create TLS config for client: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("can't create TLS config for client: no certificates found in CA file")
+		}
+		config.RootCAs = pool
+	}
+	t := g.transport.Clone()
+	t.TLSClientConfig = config
+	return &http.Client{Transport: t}, nil
+}
+
+// entryFor returns the entry with the longest URL the given URL starts
+// with, or nil if there is none.
+func entryFor(entries []*repo.Entry, href string) *repo.Entry {
+	var match *repo.Entry
+	for _, e := range entries {
+		prefix := strings.TrimSuffix(e.URL, "/") + "/"
+		if e.URL != "" && strings.HasPrefix(href, prefix) && (match == nil || len(e.URL) > len(match.URL)) {
+			match = e
+		}
+	}
+	return match
+}
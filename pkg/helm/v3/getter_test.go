@@ -0,0 +1,69 @@
+package v3
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+func TestEntryFor(t *testing.T) {
+	stable := &repo.Entry{Name: "stable", URL: "https://charts.example.com"}
+	team := &repo.Entry{Name: "team", URL: "https://charts.example.com/team/"}
+	entries := []*repo.Entry{stable, team}
+	for _, tc := range []struct {
+		href string
+		want *repo.Entry
+	}{
+		{"https://charts.example.com/index.yaml", stable},
+		{"https://charts.example.com/team/index.yaml", team},
+		{"https://charts.example.com/teams/index.yaml", stable},
+		{"https://charts.example.com.evil.net/index.yaml", nil},
+		{"http://charts.example.com/index.yaml", nil},
+	} {
+		assert.Equal(t, tc.want, entryFor(entries, tc.href), tc.href)
+	}
+}
+
+func TestGetterProviders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("apiVersion: v1"))
+	}))
+	defer srv.Close()
+
+	var dialed bool
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dial := transport.DialContext
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = true
+		return dial(ctx, network, addr)
+	}
+	h := &HelmV3{transport: transport}
+
+	g, err := h.getterProviders(&repo.Entry{URL: srv.URL, Username: "user", Password: "secret"}).ByScheme("http")
+	assert.NoError(t, err)
+	b, err := g.Get(srv.URL + "/index.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "apiVersion: v1", b.String())
+	assert.True(t, dialed)
+
+	// credentials are only sent to the URLs of their repository
+	g, err = h.getterProviders(&repo.Entry{URL: srv.URL + "/other", Username: "user", Password: "secret"}).ByScheme("http")
+	assert.NoError(t, err)
+	_, err = g.Get(srv.URL + "/index.yaml")
+	assert.Error(t, err)
+
+	// without a transport the getters of Helm are used
+	g, err = (&HelmV3{}).getterProviders().ByScheme("http")
+	assert.NoError(t, err)
+	assert.IsType(t, &getter.HTTPGetter{}, g)
+}
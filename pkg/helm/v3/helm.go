@@ -2,19 +2,17 @@ package v3
 
 import (
 	"fmt"
+	"net/http"
 
 	"github.com/go-kit/kit/log"
 
 	apiextv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
-	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"k8s.io/kubectl/pkg/cmd/util"
 
 	"helm.sh/helm/v3/pkg/action"
-	"helm.sh/helm/v3/pkg/cli"
-	"helm.sh/helm/v3/pkg/getter"
 	"helm.sh/helm/v3/pkg/helmpath"
 	"helm.sh/helm/v3/pkg/kube"
 	"helm.sh/helm/v3/pkg/storage"
@@ -37,14 +35,20 @@ type HelmOptions struct {
 }
 
 type HelmV3 struct {
-	kubeConfig *rest.Config
-	logger     log.Logger
+	kubeConfig    *rest.Config
+	logger        log.Logger
+	indexCache    helm.IndexCache
+	storageDriver string
+	transport     *http.Transport
 }
 
 type infoLogFunc func(string, ...interface{})
 
-// New creates a new HelmV3 client
-func New(logger log.Logger, kubeConfig *rest.Config) helm.Client {
+// New creates a new HelmV3 client, storing releases with the given
+// storage driver. Chart repository indexes are cached in the given
+// cache, if not nil. Chart repositories are requested using the given
+// HTTP transport, or the default transport of Helm if nil.
+func New(logger log.Logger, kubeConfig *rest.Config, indexCache helm.IndexCache, storageDriver string, transport *http.Transport) helm.Client {
 	// Add CRDs to the scheme. They are missing by default but required
 	// by Helm v3.
 	if err := apiextv1beta1.AddToScheme(scheme.Scheme); err != nil {
@@ -52,8 +56,11 @@ func New(logger log.Logger, kubeConfig *rest.Config) helm.Client {
 		panic(err)
 	}
 	return &HelmV3{
-		kubeConfig: kubeConfig,
-		logger:     logger,
+		kubeConfig:    kubeConfig,
+		logger:        logger,
+		indexCache:    indexCache,
+		storageDriver: storageDriver,
+		transport:     transport,
 	}
 }
 
@@ -72,7 +79,7 @@ func (h *HelmV3) infoLogFunc(namespace string, releaseName string) infoLogFunc {
 
 func newActionConfig(config *rest.Config, logFunc infoLogFunc, namespace, driver string) (*action.Configuration, error) {
 
-	restClientGetter := newConfigFlags(config, namespace)
+	restClientGetter := newRESTClientGetter(config, namespace)
 	kubeClient := &kube.Client{
 		Factory: util.NewFactory(restClientGetter),
 		Log:     logFunc,
@@ -95,15 +102,6 @@ func newActionConfig(config *rest.Config, logFunc infoLogFunc, namespace, driver
 	}, nil
 }
 
-func newConfigFlags(config *rest.Config, namespace string) *genericclioptions.ConfigFlags {
-	return &genericclioptions.ConfigFlags{
-		Namespace:   &namespace,
-		APIServer:   &config.Host,
-		CAFile:      &config.CAFile,
-		BearerToken: &config.BearerToken,
-	}
-}
-
 func newStorageDriver(client *kubernetes.Clientset, logFunc infoLogFunc, namespace, d string) (*storage.Storage, error) {
 	switch d {
 	case "secret", "secrets", "":
@@ -122,10 +120,17 @@ func newStorageDriver(client *kubernetes.Clientset, logFunc infoLogFunc, namespa
 	}
 }
 
-func getterProviders() getter.Providers {
-	return getter.All(&cli.EnvSettings{
-		RepositoryConfig: repositoryConfig,
-		RepositoryCache:  repositoryCache,
-		PluginsDirectory: pluginsDir,
-	})
+// ValidateStorageDriver validates the given storage driver of the
+// releases. The memory driver is not supported, as its releases do not
+// outlive a single action, and the SQL driver is not available in the
+// Helm 3.1.2 libraries of the operator.
+func ValidateStorageDriver(d string) error {
+	switch d {
+	case "secret", "secrets", "configmap", "configmaps", "":
+		return nil
+	case "sql":
+		return fmt.Errorf("storage driver 'sql' is not available in Helm 3.1.2, which the operator is built with")
+	default:
+		return fmt.Errorf("unsupported storage driver '%s'", d)
+	}
 }
@@ -0,0 +1,20 @@
+package v3
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateStorageDriver(t *testing.T) {
+	for _, d := range []string{"", "secret", "secrets", "configmap", "configmaps"} {
+		assert.NoError(t, ValidateStorageDriver(d), d)
+	}
+
+	err := ValidateStorageDriver("sql")
+	assert.EqualError(t, err, "storage driver 'sql' is not available in Helm 3.1.2, which the operator is built with")
+
+	for _, d := range []string{"memory", "etcd"} {
+		assert.Error(t, ValidateStorageDriver(d), d)
+	}
+}
@@ -0,0 +1,103 @@
+package v3
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+// maxPodLogBytes is the maximum amount of bytes of the logs of a
+// failed hook or test pod which are captured.
+const maxPodLogBytes = 2048
+
+// hookLogTailLines is the amount of trailing log lines captured of
+// the pods of failed hooks.
+const hookLogTailLines = 20
+
+// hookError returns a HookError for the given error of an install or
+// upgrade of the release, capturing the hooks which failed in their
+// last run. The error is returned as is if no hook failed.
+func hookError(cfg *action.Configuration, rel *release.Release, namespace string, err error) error {
+	if rel == nil {
+		return err
+	}
+	var failed []*release.Hook
+	for _, h := range rel.Hooks {
+		if h.LastRun.Phase == release.HookPhaseFailed && !isTestHook(h) {
+			failed = append(failed, h)
+		}
+	}
+	if len(failed) == 0 {
+		return err
+	}
+	client, clientErr := cfg.KubernetesClientSet()
+	hookErr := helm.HookError{Err: err}
+	for _, h := range failed {
+		events := make([]string, 0, len(h.Events))
+		for _, e := range h.Events {
+			events = append(events, e.String())
+		}
+		hook := helm.FailedHook{Name: h.Name, Kind: h.Kind, Events: strings.Join(events, ",")}
+		if clientErr == nil {
+			hook.Log = hookLog(client, namespace, h)
+		}
+		hookErr.Hooks = append(hookErr.Hooks, hook)
+	}
+	return hookErr
+}
+
+// hookLog returns the tail of the logs of the pod of the hook, for a
+// Job the most recent of its pods. It returns an empty string if the
+// logs can not be read, e.g. because the hook has been deleted.
+func hookLog(client kubernetes.Interface, namespace string, h *release.Hook) string {
+	pod := h.Name
+	switch h.Kind {
+	case "Pod":
+	case "Job":
+		pods, err := client.CoreV1().Pods(namespace).List(metav1.ListOptions{LabelSelector: "job-name=" + h.Name})
+		if err != nil || len(pods.Items) == 0 {
+			return ""
+		}
+		sort.Slice(pods.Items, func(i, j int) bool {
+			return pods.Items[j].CreationTimestamp.Before(&pods.Items[i].CreationTimestamp)
+		})
+		pod = pods.Items[0].Name
+	default:
+		return ""
+	}
+	log, err := podLogTail(client, namespace, pod, hookLogTailLines)
+	if err != nil {
+		return ""
+	}
+	return log
+}
+
+// podLogTail returns the given amount of trailing log lines of the
+// pod, of at most maxPodLogBytes.
+func podLogTail(client kubernetes.Interface, namespace, pod string, tailLines int64) (string, error) {
+	limitBytes := int64(maxPodLogBytes)
+	req := client.CoreV1().Pods(namespace).GetLogs(pod, &corev1.PodLogOptions{
+		TailLines:  &tailLines,
+		LimitBytes: &limitBytes,
+	})
+	stream, err := req.Stream()
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, io.LimitReader(stream, maxPodLogBytes)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
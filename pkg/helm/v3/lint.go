@@ -0,0 +1,71 @@
+package v3
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/lint/support"
+
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+// Lint lints the chart at the given path with the given values, and
+// returns the findings of all severities.
+func (h *HelmV3) Lint(chartPath string, values []byte, opts helm.LintOptions) ([]helm.LintMessage, error) {
+	val, err := chartutil.ReadValues(values)
+	if err != nil {
+		return nil, err
+	}
+
+	// Helm only lints archives with a `.tgz` extension, the names
+	// of downloaded charts may have none
+	if fi, err := os.Stat(chartPath); err == nil && !fi.IsDir() {
+		dir, err := ioutil.TempDir("", "helm-lint")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		if err := chartutil.ExpandFile(dir, chartPath); err != nil {
+			return nil, fmt.Errorf("failed to expand chart archive to lint it: %w", err)
+		}
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) != 1 {
+			return nil, fmt.Errorf("chart archive '%s' does not hold a single chart directory", filepath.Base(chartPath))
+		}
+		chartPath = filepath.Join(dir, entries[0].Name())
+	}
+
+	lint := action.NewLint()
+	lint.Namespace = opts.Namespace
+	res := lint.Run([]string{chartPath}, val.AsMap())
+	if res.TotalChartsLinted == 0 && len(res.Errors) > 0 {
+		// the chart could not be loaded to lint it
+		return nil, res.Errors[0]
+	}
+
+	var messages []helm.LintMessage
+	for _, m := range res.Messages {
+		var severity helm.LintSeverity
+		switch m.Severity {
+		case support.ErrorSev:
+			severity = helm.LintError
+		case support.WarningSev:
+			severity = helm.LintWarning
+		default:
+			severity = helm.LintInfo
+		}
+		var message string
+		if m.Err != nil {
+			message = m.Err.Error()
+		}
+		messages = append(messages, helm.LintMessage{Severity: severity, Path: m.Path, Message: message})
+	}
+	return messages, nil
+}
@@ -0,0 +1,151 @@
+package v3
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"helm.sh/helm/v3/pkg/kube"
+
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+// progressInterval is the interval at which the progress of a wait
+// for the resources of a release is reported.
+const progressInterval = 15 * time.Second
+
+// progressClient reports the progress of the resources of a release
+// periodically while the Kubernetes client of Helm waits for them.
+type progressClient struct {
+	kube.Interface
+	client   kubernetes.Interface
+	progress func(helm.WaitProgress)
+}
+
+func newProgressClient(config *rest.Config, kubeClient kube.Interface, progress func(helm.WaitProgress)) (*progressClient, error) {
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &progressClient{Interface: kubeClient, client: client, progress: progress}, nil
+}
+
+func (c *progressClient) Wait(resources kube.ResourceList, timeout time.Duration) error {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				c.progress(c.waitProgress(resources))
+			}
+		}
+	}()
+	err := c.Interface.Wait(resources, timeout)
+	// the progress must not be reported after the wait returned, as
+	// it would overwrite the outcome of the release
+	close(done)
+	wg.Wait()
+	return err
+}
+
+// waitProgress returns the progress of the given resources; resources
+// which can not be read count as unready.
+func (c *progressClient) waitProgress(resources kube.ResourceList) helm.WaitProgress {
+	var p helm.WaitProgress
+	for _, info := range resources {
+		if info.Mapping == nil {
+			continue
+		}
+		gvk := info.Mapping.GroupVersionKind
+		ready, desired, ok, err := c.readiness(gvk.Group, gvk.Kind, info.Namespace, info.Name)
+		if err != nil {
+			p.Unready = append(p.Unready, fmt.Sprintf("%s/%s", gvk.Kind, info.Name))
+			continue
+		}
+		p.ReadyPods += ready
+		p.DesiredPods += desired
+		if !ok {
+			p.Unready = append(p.Unready, fmt.Sprintf("%s/%s", gvk.Kind, info.Name))
+		}
+	}
+	return p
+}
+
+// readiness returns the amount of ready and desired pods of the
+// resource, and if it is ready. Resources of other kinds than
+// workloads, Jobs and PersistentVolumeClaims are considered ready.
+func (c *progressClient) readiness(group, kind, namespace, name string) (int, int, bool, error) {
+	switch {
+	case group == appsv1.GroupName && kind == "Deployment":
+		d, err := c.client.AppsV1().Deployments(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return 0, 0, false, err
+		}
+		desired := int32(1)
+		if d.Spec.Replicas != nil {
+			desired = *d.Spec.Replicas
+		}
+		return int(d.Status.ReadyReplicas), int(desired),
+			d.Status.UpdatedReplicas >= desired && d.Status.ReadyReplicas >= desired, nil
+	case group == appsv1.GroupName && kind == "StatefulSet":
+		s, err := c.client.AppsV1().StatefulSets(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return 0, 0, false, err
+		}
+		desired := int32(1)
+		if s.Spec.Replicas != nil {
+			desired = *s.Spec.Replicas
+		}
+		return int(s.Status.ReadyReplicas), int(desired), s.Status.ReadyReplicas >= desired, nil
+	case group == appsv1.GroupName && kind == "DaemonSet":
+		d, err := c.client.AppsV1().DaemonSets(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return 0, 0, false, err
+		}
+		desired := d.Status.DesiredNumberScheduled
+		return int(d.Status.NumberReady), int(desired), d.Status.NumberReady >= desired, nil
+	case group == corev1.GroupName && kind == "Pod":
+		pod, err := c.client.CoreV1().Pods(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return 0, 0, false, err
+		}
+		for _, cond := range pod.Status.Conditions {
+			if cond.Type == corev1.PodReady && cond.Status == corev1.ConditionTrue {
+				return 1, 1, true, nil
+			}
+		}
+		return 0, 1, false, nil
+	case group == batchv1.GroupName && kind == "Job":
+		job, err := c.client.BatchV1().Jobs(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return 0, 0, false, err
+		}
+		for _, cond := range job.Status.Conditions {
+			if cond.Type == batchv1.JobComplete && cond.Status == corev1.ConditionTrue {
+				return 0, 0, true, nil
+			}
+		}
+		return 0, 0, false, nil
+	case group == corev1.GroupName && kind == "PersistentVolumeClaim":
+		pvc, err := c.client.CoreV1().PersistentVolumeClaims(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return 0, 0, false, err
+		}
+		return 0, 0, pvc.Status.Phase == corev1.ClaimBound, nil
+	}
+	return 0, 0, true, nil
+}
@@ -1,36 +1,91 @@
 package v3
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"k8s.io/helm/pkg/urlutil"
 
 	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/getter"
 	"helm.sh/helm/v3/pkg/helmpath"
 	"helm.sh/helm/v3/pkg/repo"
 
+	"github.com/lstack-org/helm-operator/pkg/helm"
 	"github.com/lstack-org/helm-operator/pkg/utils"
 )
 
 func (h *HelmV3) Pull(ref, version, dest string) (string, error) {
+	return h.pull(ref, version, dest, "", helm.PullOptions{})
+}
+
+// pull downloads the chart with the given reference, using the
+// credentials in the given pull options for the repository at the
+// given URL.
+func (h *HelmV3) pull(ref, version, dest, repoURL string, opts helm.PullOptions) (string, error) {
 	repositoryConfigLock.RLock()
 	defer repositoryConfigLock.RUnlock()
 
+	repoFile, err := loadRepositoryConfig()
+	if err != nil {
+		return "", err
+	}
+	entries := repoFile.Repositories
+	if opts.HasCredentials() {
+		entries = append([]*repo.Entry{{
+			URL:      repoURL,
+			Username: opts.Username,
+			Password: opts.Password,
+			CertFile: opts.CertFile,
+			KeyFile:  opts.KeyFile,
+			CAFile:   opts.CAFile,
+		}}, entries...)
+	}
+
 	out := utils.NewLogWriter(h.logger)
 	c := downloader.ChartDownloader{
 		Out:              out,
 		Verify:           downloader.VerifyNever,
 		RepositoryConfig: repositoryConfig,
 		RepositoryCache:  repositoryCache,
-		Getters:          getterProviders(),
+		Getters:          h.getterProviders(entries...),
+		Options:          getterOptions(opts),
+	}
+	if opts.Provenance {
+		c.Verify = downloader.VerifyLater
+		c.Out = ioutil.Discard
 	}
 	d, _, err := c.DownloadTo(ref, version, dest)
 	return d, err
 }
 
-func (h *HelmV3) PullWithRepoURL(repoURL, name, version, dest string) (string, error) {
+func (h *HelmV3) PullWithRepoURL(repoURL, name, version, dest string, opts helm.PullOptions) (string, error) {
+	// With credentials, the repository does not have to be configured:
+	// the credentials are used to download the repository index to
+	// resolve the absolute URL of the chart, and the chart itself.
+	if opts.HasCredentials() {
+		entry := &repo.Entry{
+			URL:      repoURL,
+			Username: opts.Username,
+			Password: opts.Password,
+			CertFile: opts.CertFile,
+			KeyFile:  opts.KeyFile,
+			CAFile:   opts.CAFile,
+		}
+		chartRef, err := h.findChartInRepository(entry, name, version)
+		if err != nil {
+			return "", err
+		}
+		return h.pull(chartRef, version, dest, repoURL, chartPullOptions(repoURL, chartRef, opts))
+	}
+
 	// This first attempts to look up the repository name by the given
 	// `repoURL`, if found the repository name and given chart name
 	// are used to construct a `chartRef` Helm understands.
@@ -55,8 +110,10 @@ func (h *HelmV3) PullWithRepoURL(repoURL, name, version, dest string) (string, e
 			chartRef = entry.Name + "/" + name
 			// Ensure we have the repository index as this is
 			// later used by Helm.
-			if r, err := newChartRepository(entry); err == nil {
-				r.DownloadIndexFile()
+			if r, err := h.newChartRepository(entry); err == nil {
+				h.cachedIndex("file:"+entry.URL, func() (interface{}, error) {
+					return r.DownloadIndexFile()
+				})
 			}
 			break
 		}
@@ -65,7 +122,7 @@ func (h *HelmV3) PullWithRepoURL(repoURL, name, version, dest string) (string, e
 	if chartRef == "" {
 		// We were unable to find an entry so we need to make a request
 		// to the repository to get the absolute URL of the chart.
-		chartRef, err = repo.FindChartInRepoURL(repoURL, name, version, "", "", "", getterProviders())
+		chartRef, err = h.findChartInRepository(&repo.Entry{URL: repoURL}, name, version)
 		if err != nil {
 			return "", err
 		}
@@ -74,18 +131,179 @@ func (h *HelmV3) PullWithRepoURL(repoURL, name, version, dest string) (string, e
 		// we give to it, and does not ignore missing index files, we need
 		// to be sure all indexes files are present, and we are only able
 		// to do so by updating our indexes.
-		if err := downloadMissingRepositoryIndexes(repoFile.Repositories); err != nil {
+		if err := h.downloadMissingRepositoryIndexes(repoFile.Repositories); err != nil {
+			return "", err
+		}
+	}
+
+	return h.pull(chartRef, version, dest, repoURL, opts)
+}
+
+// chartPullOptions returns the pull options for downloading the chart
+// at the given URL from the repository at the given URL. The
+// credentials of the repository are only sent along when the chart is
+// served by the same host as the repository, so they are not leaked
+// to e.g. a CDN the index points to.
+func chartPullOptions(repoURL, chartURL string, opts helm.PullOptions) helm.PullOptions {
+	if sameHost(repoURL, chartURL) {
+		return opts
+	}
+	return helm.PullOptions{Provenance: opts.Provenance}
+}
+
+// sameHost returns if the given URLs have the same scheme, host and
+// port.
+func sameHost(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Scheme, ub.Scheme) && strings.EqualFold(ua.Host, ub.Host)
+}
+
+// getterOptions returns the getter options for the credentials in the
+// given pull options.
+func getterOptions(opts helm.PullOptions) []getter.Option {
+	if !opts.HasCredentials() {
+		return nil
+	}
+	options := []getter.Option{getter.WithBasicAuth(opts.Username, opts.Password)}
+	if opts.CertFile != "" || opts.KeyFile != "" || opts.CAFile != "" {
+		options = append(options, getter.WithTLSClientConfig(opts.CertFile, opts.KeyFile, opts.CAFile))
+	}
+	return options
+}
+
+// ResolveChartVersion returns the latest version of the chart with
+// the given name in the repository at the given URL which matches the
+// given version or semver range.
+func (h *HelmV3) ResolveChartVersion(repoURL, name, version string, opts helm.PullOptions) (string, error) {
+	entry := &repo.Entry{
+		URL:      repoURL,
+		Username: opts.Username,
+		Password: opts.Password,
+		CertFile: opts.CertFile,
+		KeyFile:  opts.KeyFile,
+		CAFile:   opts.CAFile,
+	}
+	if !opts.HasCredentials() {
+		// use the credentials of the configured repository, if any
+		repositoryConfigLock.RLock()
+		repoFile, err := loadRepositoryConfig()
+		repositoryConfigLock.RUnlock()
+		if err != nil {
 			return "", err
 		}
+		for _, e := range repoFile.Repositories {
+			if urlutil.Equal(repoURL, e.URL) {
+				c := *e
+				entry = &c
+				break
+			}
+		}
+	}
+	cv, err := h.findChartVersion(entry, name, version)
+	if err != nil {
+		return "", err
+	}
+	return cv.Version, nil
+}
+
+// findChartInRepository returns the absolute URL of the chart with
+// the given name and version in the given repository, which is not
+// configured as a repository.
+func (h *HelmV3) findChartInRepository(entry *repo.Entry, name, version string) (string, error) {
+	cv, err := h.findChartVersion(entry, name, version)
+	if err != nil {
+		return "", err
 	}
+	if len(cv.URLs) == 0 {
+		return "", fmt.Errorf("chart %q version %q has no downloadable URLs", name, version)
+	}
+	chartURL, err := repo.ResolveReferenceURL(entry.URL, cv.URLs[0])
+	if err != nil {
+		return "", fmt.Errorf("failed to make chart URL absolute: %w", err)
+	}
+	return chartURL, nil
+}
 
-	return h.Pull(chartRef, version, dest)
+// findChartVersion returns the latest version of the chart with the
+// given name in the index of the given repository matching the given
+// version or semver range.
+func (h *HelmV3) findChartVersion(entry *repo.Entry, name, version string) (*repo.ChartVersion, error) {
+	repoURL := entry.URL
+	// the index is cached and written to a stable location per URL
+	// and credentials, so that repeated downloads overwrite the
+	// previous index instead of leaving them behind
+	entry.Name = "url-" + repositoryKey(entry)
+	key := "index:" + entry.Name
+	fetch := func() (interface{}, error) {
+		r, err := h.newChartRepository(entry)
+		if err != nil {
+			return nil, err
+		}
+		path, err := r.DownloadIndexFile()
+		if err != nil {
+			return nil, fmt.Errorf("looks like %q is not a valid chart repository or cannot be reached: %w", repoURL, err)
+		}
+		return repo.LoadIndexFile(path)
+	}
+	v, err := h.cachedIndex(key, fetch)
+	if err != nil {
+		return nil, err
+	}
+	cv, err := v.(*repo.IndexFile).Get(name, version)
+	if err != nil && h.indexCache != nil {
+		// the chart version may have been published after the index
+		// was cached, refetch it once before giving up
+		h.indexCache.Invalidate(key)
+		if v, err = h.indexCache.Get(key, fetch); err != nil {
+			return nil, err
+		}
+		cv, err = v.(*repo.IndexFile).Get(name, version)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("chart %q version %q not found in %s repository", name, version, repoURL)
+	}
+	return cv, nil
+}
+
+// repositoryKey returns a key identifying the given repository URL
+// and credentials. For TLS files the contents are used, as these are
+// written to a different location for every sync.
+func repositoryKey(entry *repo.Entry) string {
+	h := sha256.New()
+	for _, s := range []string{entry.URL, entry.Username, entry.Password} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	for _, f := range []string{entry.CertFile, entry.KeyFile, entry.CAFile} {
+		if f != "" {
+			b, _ := ioutil.ReadFile(f)
+			h.Write(b)
+		}
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// cachedIndex returns the value for the given key from the index
+// cache, or calls fetch if there is no cache.
+func (h *HelmV3) cachedIndex(key string, fetch func() (interface{}, error)) (interface{}, error) {
+	if h.indexCache == nil {
+		return fetch()
+	}
+	return h.indexCache.Get(key, fetch)
 }
 
-func downloadMissingRepositoryIndexes(repositories []*repo.Entry) error {
+func (h *HelmV3) downloadMissingRepositoryIndexes(repositories []*repo.Entry) error {
 	var wg sync.WaitGroup
 	for _, c := range repositories {
-		r, err := newChartRepository(c)
+		r, err := h.newChartRepository(c)
 		if err != nil {
 			return err
 		}
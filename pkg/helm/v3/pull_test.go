@@ -0,0 +1,54 @@
+package v3
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+func TestChartPullOptions(t *testing.T) {
+	opts := helm.PullOptions{Username: "user", Password: "pass", Provenance: true}
+	for _, tc := range []struct {
+		name     string
+		repoURL  string
+		chartURL string
+		want     helm.PullOptions
+	}{
+		{
+			name:     "same host",
+			repoURL:  "https://charts.example.com/stable",
+			chartURL: "https://charts.example.com/stable/podinfo-1.0.0.tgz",
+			want:     opts,
+		},
+		{
+			name:     "host case differs",
+			repoURL:  "https://Charts.Example.com",
+			chartURL: "https://charts.example.com/podinfo-1.0.0.tgz",
+			want:     opts,
+		},
+		{
+			name:     "other host",
+			repoURL:  "https://charts.example.com",
+			chartURL: "https://cdn.example.net/podinfo-1.0.0.tgz",
+			want:     helm.PullOptions{Provenance: true},
+		},
+		{
+			name:     "other port",
+			repoURL:  "https://charts.example.com",
+			chartURL: "https://charts.example.com:8443/podinfo-1.0.0.tgz",
+			want:     helm.PullOptions{Provenance: true},
+		},
+		{
+			name:     "scheme downgrade",
+			repoURL:  "https://charts.example.com",
+			chartURL: "http://charts.example.com/podinfo-1.0.0.tgz",
+			want:     helm.PullOptions{Provenance: true},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, chartPullOptions(tc.repoURL, tc.chartURL, opts))
+		})
+	}
+}
@@ -23,9 +23,20 @@ func releaseToGenericRelease(r *release.Release) *helm.Release {
 		Values:    configToGenericValues(r.Config),
 		Manifest:  r.Manifest,
 		Version:   r.Version,
+		Hooks:     hooksToGenericFiles(r.Hooks),
 	}
 }
 
+// hooksToGenericFiles transforms the v3 hooks of a release into
+// generic `helm.File`s holding their manifests
+func hooksToGenericFiles(hooks []*release.Hook) []*helm.File {
+	gf := make([]*helm.File, 0, len(hooks))
+	for _, h := range hooks {
+		gf = append(gf, &helm.File{Name: h.Path, Data: []byte(h.Manifest)})
+	}
+	return gf
+}
+
 // chartToGenericChart transforms a v3 chart structure into
 // a generic `helm.Chart`
 func chartToGenericChart(c *chart.Chart) *helm.Chart {
@@ -35,6 +46,7 @@ func chartToGenericChart(c *chart.Chart) *helm.Chart {
 		AppVersion: c.AppVersion(),
 		Values:     c.Values,
 		Templates:  filesToGenericFiles(c.Templates),
+		CRDs:       filesToGenericFiles(c.CRDs()),
 	}
 }
 
@@ -58,6 +70,7 @@ func infoToGenericInfo(i *release.Info) *helm.Info {
 		LastDeployed: i.LastDeployed.Time,
 		Description:  i.Description,
 		Status:       lookUpGenericStatus(i.Status),
+		Notes:        i.Notes,
 	}
 }
 
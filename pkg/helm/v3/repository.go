@@ -20,7 +20,7 @@ func (h *HelmV3) RepositoryIndex() error {
 
 	var wg sync.WaitGroup
 	for _, c := range f.Repositories {
-		r, err := newChartRepository(c)
+		r, err := h.newChartRepository(c)
 		if err != nil {
 			return err
 		}
@@ -60,7 +60,7 @@ func (h *HelmV3) RepositoryAdd(name, url, username, password, certFile, keyFile,
 		return errors.New("chart repository with name '%s' already exists")
 	}
 
-	r, err := newChartRepository(c)
+	r, err := h.newChartRepository(c)
 	if err != nil {
 		return err
 	}
@@ -103,7 +103,7 @@ func (h *HelmV3) RepositoryImport(path string) error {
 			h.logger.Log("error", "repository with name already exists", "name", c.Name, "url", c.URL)
 			continue
 		}
-		r, err := newChartRepository(c)
+		r, err := h.newChartRepository(c)
 		if err != nil {
 			h.logger.Log("error", err, "name", c.Name, "url", c.URL)
 			continue
@@ -123,8 +123,8 @@ func (h *HelmV3) RepositoryImport(path string) error {
 // for the given `repo.Entry`. It exists to stay in control
 // of the cache path and getters while duplicating as less
 // code as possible.
-func newChartRepository(e *repo.Entry) (*repo.ChartRepository, error) {
-	cr, err := repo.NewChartRepository(e, getterProviders())
+func (h *HelmV3) newChartRepository(e *repo.Entry) (*repo.ChartRepository, error) {
+	cr, err := repo.NewChartRepository(e, h.getterProviders(e))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,72 @@
+package v3
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// restClientGetter provides Helm with clients for the given REST
+// config, so that Helm talks to the same cluster with the same
+// credentials as the operator, whether it runs in-cluster or against
+// a kubeconfig.
+type restClientGetter struct {
+	config    *rest.Config
+	namespace string
+}
+
+func newRESTClientGetter(config *rest.Config, namespace string) *restClientGetter {
+	return &restClientGetter{config: config, namespace: namespace}
+}
+
+func (g *restClientGetter) ToRESTConfig() (*rest.Config, error) {
+	return rest.CopyConfig(g.config), nil
+}
+
+func (g *restClientGetter) ToDiscoveryClient() (discovery.CachedDiscoveryInterface, error) {
+	client, err := discovery.NewDiscoveryClientForConfig(g.config)
+	if err != nil {
+		return nil, err
+	}
+	return memory.NewMemCacheClient(client), nil
+}
+
+func (g *restClientGetter) ToRESTMapper() (meta.RESTMapper, error) {
+	client, err := g.ToDiscoveryClient()
+	if err != nil {
+		return nil, err
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(client)
+	return restmapper.NewShortcutExpander(mapper, client), nil
+}
+
+func (g *restClientGetter) ToRawKubeConfigLoader() clientcmd.ClientConfig {
+	return restClientConfig{config: g.config, namespace: g.namespace}
+}
+
+// restClientConfig is a clientcmd.ClientConfig for a REST config,
+// with the given namespace as default namespace.
+type restClientConfig struct {
+	config    *rest.Config
+	namespace string
+}
+
+func (c restClientConfig) RawConfig() (clientcmdapi.Config, error) {
+	return clientcmdapi.Config{}, nil
+}
+
+func (c restClientConfig) ClientConfig() (*rest.Config, error) {
+	return rest.CopyConfig(c.config), nil
+}
+
+func (c restClientConfig) Namespace() (string, bool, error) {
+	return c.namespace, true, nil
+}
+
+func (c restClientConfig) ConfigAccess() clientcmd.ConfigAccess {
+	return clientcmd.NewDefaultClientConfigLoadingRules()
+}
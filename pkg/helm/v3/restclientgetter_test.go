@@ -0,0 +1,65 @@
+package v3
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/rest"
+)
+
+func TestRESTClientGetter(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		config    *rest.Config
+		namespace string
+	}{
+		{
+			name:      "in-cluster",
+			config:    &rest.Config{Host: "https://10.0.0.1:443", BearerToken: "token"},
+			namespace: "default",
+		},
+		{
+			name: "kubeconfig",
+			config: &rest.Config{
+				Host:            "https://remote.example.com:6443",
+				TLSClientConfig: rest.TLSClientConfig{CAData: []byte("ca")},
+				Username:        "admin",
+				Password:        "secret",
+			},
+			namespace: "apps",
+		},
+		{
+			name:   "master without namespace",
+			config: &rest.Config{Host: "http://localhost:8080"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newRESTClientGetter(tc.config, tc.namespace)
+
+			config, err := g.ToRESTConfig()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.config, config)
+			// Helm mutates the config it gets, e.g. to set the user
+			// agent, this must not change the config of the operator
+			assert.True(t, tc.config != config)
+			config.Host = "https://changed.example.com"
+			assert.NotEqual(t, config.Host, tc.config.Host)
+
+			loader := g.ToRawKubeConfigLoader()
+			config, err = loader.ClientConfig()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.config, config)
+			assert.True(t, tc.config != config)
+
+			namespace, explicit, err := loader.Namespace()
+			assert.NoError(t, err)
+			assert.True(t, explicit)
+			assert.Equal(t, tc.namespace, namespace)
+
+			_, err = g.ToDiscoveryClient()
+			assert.NoError(t, err)
+			_, err = g.ToRESTMapper()
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -1,22 +1,39 @@
 package v3
 
 import (
+	"fmt"
+	"strings"
+
 	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
 
 	"github.com/lstack-org/helm-operator/pkg/helm"
 )
 
 func (h *HelmV3) Test(releaseName string, opts helm.TestOptions) error {
-	cfg, err := newActionConfig(h.kubeConfig, h.infoLogFunc(opts.Namespace, releaseName), opts.Namespace, "")
+	cfg, err := newActionConfig(h.kubeConfig, h.infoLogFunc(opts.Namespace, releaseName), opts.Namespace, h.storageDriver)
 	if err != nil {
 		return err
 	}
+	if len(opts.Filters) > 0 {
+		cfg.Releases.Driver = &testFilterDriver{
+			Driver:  cfg.Releases.Driver,
+			filters: opts.Filters,
+			hooks:   make(map[string][]*release.Hook),
+		}
+	}
 
 	test := action.NewReleaseTesting(cfg)
 	testOptions(opts).configure(test)
 
-	if _, err := test.Run(releaseName); err != nil {
-		return err
+	rel, err := test.Run(releaseName)
+	if err != nil {
+		if rel == nil || opts.LogTailLines <= 0 {
+			return err
+		}
+		return helm.TestError{Err: err, Logs: failedTestLogs(cfg, rel, opts)}
 	}
 
 	return nil
@@ -25,5 +42,110 @@ func (h *HelmV3) Test(releaseName string, opts helm.TestOptions) error {
 type testOptions helm.TestOptions
 
 func (opts testOptions) configure(action *action.ReleaseTesting) {
+	action.Namespace = opts.Namespace
 	action.Timeout = opts.Timeout
 }
+
+// failedTestLogs returns the tail of the logs of the failed test pods
+// of the release; pods of which the logs can not be read are skipped.
+func failedTestLogs(cfg *action.Configuration, rel *release.Release, opts helm.TestOptions) []helm.TestLog {
+	client, err := cfg.KubernetesClientSet()
+	if err != nil {
+		return nil
+	}
+	var logs []helm.TestLog
+	for _, h := range rel.Hooks {
+		if h.Kind != "Pod" || h.LastRun.Phase != release.HookPhaseFailed || !isTestHook(h) {
+			continue
+		}
+		log, err := podLogTail(client, opts.Namespace, h.Name, opts.LogTailLines)
+		if err != nil {
+			continue
+		}
+		logs = append(logs, helm.TestLog{Name: h.Name, Log: log})
+	}
+	return logs
+}
+
+func isTestHook(h *release.Hook) bool {
+	for _, e := range h.Events {
+		if e == release.HookTest {
+			return true
+		}
+	}
+	return false
+}
+
+// testFilterDriver hides the test hooks which do not match the
+// filters from the releases read from the storage, as Helm 3.1 does
+// not support filtering tests. The hidden hooks are restored when a
+// release is written back.
+type testFilterDriver struct {
+	driver.Driver
+	filters []string
+	// hooks holds the complete hooks of the releases read, by the
+	// storage key.
+	hooks map[string][]*release.Hook
+}
+
+func (d *testFilterDriver) Query(labels map[string]string) ([]*release.Release, error) {
+	rels, err := d.Driver.Query(labels)
+	if err != nil {
+		return nil, err
+	}
+	filtered := make([]*release.Release, 0, len(rels))
+	for _, rel := range rels {
+		cRel := *rel
+		cRel.Hooks = nil
+		for _, h := range rel.Hooks {
+			if !isTestHook(h) || testSelected(h.Name, d.filters) {
+				cRel.Hooks = append(cRel.Hooks, h)
+			}
+		}
+		d.hooks[releaseKey(rel)] = rel.Hooks
+		filtered = append(filtered, &cRel)
+	}
+	return filtered, nil
+}
+
+func (d *testFilterDriver) Update(key string, rel *release.Release) error {
+	if hooks, ok := d.hooks[key]; ok {
+		// the hooks are shared, so the hidden hooks are restored with
+		// the results of the tests which ran
+		cRel := *rel
+		cRel.Hooks = hooks
+		rel = &cRel
+	}
+	return d.Driver.Update(key, rel)
+}
+
+// releaseKey returns the storage key of the release, like the
+// storage of Helm.
+func releaseKey(rel *release.Release) string {
+	return fmt.Sprintf("%s.%s.v%d", storage.HelmStorageType, rel.Name, rel.Version)
+}
+
+// testSelected returns if the test with the given name matches the
+// filters; names prefixed with `!` are excluded, and if any other
+// names are given only the tests with these names are selected.
+func testSelected(name string, filters []string) bool {
+	var includes bool
+	for _, f := range filters {
+		if strings.HasPrefix(f, "!") {
+			if strings.TrimPrefix(f, "!") == name {
+				return false
+			}
+			continue
+		}
+		includes = true
+	}
+	if !includes {
+		return true
+	}
+	for _, f := range filters {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
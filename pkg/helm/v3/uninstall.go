@@ -1,16 +1,27 @@
 package v3
 
 import (
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/resource"
+
 	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/kube"
 
 	"github.com/lstack-org/helm-operator/pkg/helm"
 )
 
 func (h *HelmV3) Uninstall(releaseName string, opts helm.UninstallOptions) error {
-	cfg, err := newActionConfig(h.kubeConfig, h.infoLogFunc(opts.Namespace, releaseName), opts.Namespace, "")
+	cfg, err := newActionConfig(h.kubeConfig, h.infoLogFunc(opts.Namespace, releaseName), opts.Namespace, h.storageDriver)
 	if err != nil {
 		return err
 	}
+	if opts.DeletionPropagation != "" {
+		cfg.KubeClient = &propagationClient{
+			Interface: cfg.KubeClient,
+			policy:    metav1.DeletionPropagation(opts.DeletionPropagation),
+		}
+	}
 
 	uninstall := action.NewUninstall(cfg)
 	uninstallOptions(opts).configure(uninstall)
@@ -27,3 +38,29 @@ func (opts uninstallOptions) configure(action *action.Uninstall) {
 	action.KeepHistory = opts.KeepHistory
 	action.Timeout = opts.Timeout
 }
+
+// propagationClient deletes resources with the given propagation
+// policy, as the Kubernetes client of Helm always deletes them in
+// the background.
+type propagationClient struct {
+	kube.Interface
+	policy metav1.DeletionPropagation
+}
+
+func (c *propagationClient) Delete(resources kube.ResourceList) (*kube.Result, []error) {
+	var errs []error
+	res := &kube.Result{}
+	for _, info := range resources {
+		opts := &metav1.DeleteOptions{PropagationPolicy: &c.policy}
+		_, err := resource.NewHelper(info.Client, info.Mapping).DeleteWithOptions(info.Namespace, info.Name, opts)
+		switch {
+		case apierrors.IsNotFound(err):
+		case err != nil:
+			// collect the error and continue, like Helm
+			errs = append(errs, err)
+		default:
+			res.Deleted = append(res.Deleted, info)
+		}
+	}
+	return res, errs
+}
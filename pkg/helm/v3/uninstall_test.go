@@ -0,0 +1,77 @@
+package v3
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/kube"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest/fake"
+
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+func TestUninstallOptions(t *testing.T) {
+	uninstall := &action.Uninstall{}
+	uninstallOptions(helm.UninstallOptions{DisableHooks: true, KeepHistory: true, Timeout: 42}).configure(uninstall)
+	assert.True(t, uninstall.DisableHooks)
+	assert.True(t, uninstall.KeepHistory)
+	assert.EqualValues(t, 42, uninstall.Timeout)
+}
+
+func TestPropagationClientDelete(t *testing.T) {
+	var policies []metav1.DeletionPropagation
+	client := &fake.RESTClient{
+		NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+		Client: fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+			var opts metav1.DeleteOptions
+			if err := json.NewDecoder(req.Body).Decode(&opts); err != nil {
+				return nil, err
+			}
+			if opts.PropagationPolicy != nil {
+				policies = append(policies, *opts.PropagationPolicy)
+			}
+			code, reason := http.StatusOK, ""
+			switch {
+			case strings.HasSuffix(req.URL.Path, "/missing"):
+				code, reason = http.StatusNotFound, string(metav1.StatusReasonNotFound)
+			case strings.HasSuffix(req.URL.Path, "/broken"):
+				code, reason = http.StatusInternalServerError, string(metav1.StatusReasonInternalError)
+			}
+			body := `{"kind":"Status","apiVersion":"v1","status":"Success"}`
+			if code != http.StatusOK {
+				body = fmt.Sprintf(`{"kind":"Status","apiVersion":"v1","status":"Failure","code":%d,"reason":%q}`, code, reason)
+			}
+			return &http.Response{
+				StatusCode: code,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       ioutil.NopCloser(strings.NewReader(body)),
+			}, nil
+		}),
+	}
+	mapping := &meta.RESTMapping{
+		Resource: schema.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+		Scope:    meta.RESTScopeNamespace,
+	}
+	info := func(name string) *resource.Info {
+		return &resource.Info{Client: client, Mapping: mapping, Namespace: "default", Name: name}
+	}
+
+	c := &propagationClient{policy: metav1.DeletePropagationForeground}
+	res, errs := c.Delete(kube.ResourceList{info("deleted"), info("missing"), info("broken")})
+	assert.Len(t, errs, 1)
+	if assert.Len(t, res.Deleted, 1) {
+		assert.Equal(t, "deleted", res.Deleted[0].Name)
+	}
+	assert.Equal(t, []metav1.DeletionPropagation{"Foreground", "Foreground", "Foreground"}, policies)
+}
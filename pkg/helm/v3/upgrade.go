@@ -12,10 +12,23 @@ import (
 func (h *HelmV3) UpgradeFromPath(chartPath string, releaseName string, values []byte,
 	opts helm.UpgradeOptions) (*helm.Release, error) {
 
-	cfg, err := newActionConfig(h.kubeConfig, h.infoLogFunc(opts.Namespace, releaseName), opts.Namespace, "")
+	cfg, err := newActionConfig(h.kubeConfig, h.infoLogFunc(opts.Namespace, releaseName), opts.Namespace, h.storageDriver)
 	if err != nil {
 		return nil, err
 	}
+	if opts.ServerSideApply {
+		cfg.KubeClient = &applyClient{Interface: cfg.KubeClient, fieldManager: opts.FieldManager}
+	}
+	if opts.WaitForJobs {
+		if cfg.KubeClient, err = newJobWaitClient(h.kubeConfig, cfg.KubeClient); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Wait && opts.Progress != nil {
+		if cfg.KubeClient, err = newProgressClient(h.kubeConfig, cfg.KubeClient, opts.Progress); err != nil {
+			return nil, err
+		}
+	}
 
 	// Load the chart from the given path, this also ensures that
 	// all chart dependencies are present
@@ -23,6 +36,14 @@ func (h *HelmV3) UpgradeFromPath(chartPath string, releaseName string, values []
 	if err != nil {
 		return nil, err
 	}
+	if len(opts.ChartAnnotations) > 0 && chartRequested.Metadata != nil {
+		if chartRequested.Metadata.Annotations == nil {
+			chartRequested.Metadata.Annotations = make(map[string]string, len(opts.ChartAnnotations))
+		}
+		for k, v := range opts.ChartAnnotations {
+			chartRequested.Metadata.Annotations[k] = v
+		}
+	}
 
 	// Read and set values
 	val, err := chartutil.ReadValues(values)
@@ -42,7 +63,7 @@ func (h *HelmV3) UpgradeFromPath(chartPath string, releaseName string, values []
 	}
 
 	if err != nil {
-		return nil, err
+		return nil, hookError(cfg, res, opts.Namespace, err)
 	}
 	return releaseToGenericRelease(res), err
 }
@@ -60,6 +81,7 @@ func (opts installOptions) configure(action *action.Install, releaseName string)
 	action.Wait = opts.Wait
 	action.SkipCRDs = opts.SkipCRDs
 	action.DisableOpenAPIValidation = opts.DisableValidation
+	action.SubNotes = opts.SubNotes
 	action.PostRenderer = opts.PostRenderer
 }
 
@@ -68,6 +90,7 @@ type upgradeOptions helm.UpgradeOptions
 func (opts upgradeOptions) configure(action *action.Upgrade) {
 	action.Namespace = opts.Namespace
 	action.Atomic = opts.Atomic
+	action.CleanupOnFail = opts.CleanupOnFail
 	action.DisableHooks = opts.DisableHooks
 	action.DryRun = opts.DryRun
 	action.Force = opts.Force
@@ -76,5 +99,6 @@ func (opts upgradeOptions) configure(action *action.Upgrade) {
 	action.ReuseValues = opts.ReuseValues
 	action.Timeout = opts.Timeout
 	action.Wait = opts.Wait
+	action.SubNotes = opts.SubNotes
 	action.PostRenderer = opts.PostRenderer
 }
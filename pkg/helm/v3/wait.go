@@ -0,0 +1,78 @@
+package v3
+
+import (
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"helm.sh/helm/v3/pkg/kube"
+)
+
+// jobPollInterval is the interval at which the completion of Jobs is
+// checked.
+const jobPollInterval = 2 * time.Second
+
+// jobWaitClient waits until the Jobs of a release have completed, in
+// addition to the resources the Kubernetes client of Helm waits for,
+// as Helm 3.1 does not support waiting for Jobs.
+type jobWaitClient struct {
+	kube.Interface
+	client kubernetes.Interface
+}
+
+func newJobWaitClient(config *rest.Config, kubeClient kube.Interface) (*jobWaitClient, error) {
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &jobWaitClient{Interface: kubeClient, client: client}, nil
+}
+
+func (c *jobWaitClient) Wait(resources kube.ResourceList, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	if err := c.Interface.Wait(resources, timeout); err != nil {
+		return err
+	}
+	for _, info := range resources {
+		if info.Mapping == nil || info.Mapping.GroupVersionKind.Group != batchv1.GroupName || info.Mapping.GroupVersionKind.Kind != "Job" {
+			continue
+		}
+		if err := c.waitForJob(info.Namespace, info.Name, time.Until(deadline)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitForJob waits until the Job has completed, and returns an error
+// if it failed or did not complete within the timeout.
+func (c *jobWaitClient) waitForJob(namespace, name string, timeout time.Duration) error {
+	err := wait.PollImmediate(jobPollInterval, timeout, func() (bool, error) {
+		job, err := c.client.BatchV1().Jobs(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, cond := range job.Status.Conditions {
+			if cond.Status != corev1.ConditionTrue {
+				continue
+			}
+			switch cond.Type {
+			case batchv1.JobComplete:
+				return true, nil
+			case batchv1.JobFailed:
+				return false, fmt.Errorf("job '%s' failed: %s", name, cond.Message)
+			}
+		}
+		return false, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("timed out waiting for job '%s' to complete", name)
+	}
+	return err
+}
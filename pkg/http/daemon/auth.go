@@ -0,0 +1,93 @@
+package daemon
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+
+	helmfluxv1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+// operationsAuth wraps the given handler of the operations API with
+// the authentication and authorization of clients against the
+// Kubernetes API, which must be allowed to patch the HelmRelease. The
+// operations API is not found if it is disabled.
+func (c ServerConfig) operationsAuth(next http.Handler) http.Handler {
+	return c.kubeAuth(c.OperationsAPI, "patch", next)
+}
+
+// introspectionAuth wraps the given handler of the introspection API
+// with the authentication and authorization of clients against the
+// Kubernetes API, which must be allowed to get the HelmRelease. The
+// introspection API is not found if it is disabled.
+func (c ServerConfig) introspectionAuth(next http.Handler) http.Handler {
+	return c.kubeAuth(c.IntrospectionAPI, "get", next)
+}
+
+// kubeAuth wraps the given handler with the authentication of clients
+// with a TokenReview of their bearer token, and their authorization
+// for the verb on the HelmRelease of the request with a
+// SubjectAccessReview. The handler is not found if it is disabled.
+func (c ServerConfig) kubeAuth(enabled bool, verb string, next http.Handler) http.Handler {
+	if !enabled {
+		return http.NotFoundHandler()
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="operations"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		review, err := c.KubeClient.AuthenticationV1().TokenReviews().Create(&authenticationv1.TokenReview{
+			Spec: authenticationv1.TokenReviewSpec{Token: strings.TrimPrefix(auth, "Bearer ")},
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to review token: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if !review.Status.Authenticated {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="operations"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		vars := mux.Vars(r)
+		user := review.Status.User
+		extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+		for k, v := range user.Extra {
+			extra[k] = authorizationv1.ExtraValue(v)
+		}
+		access, err := c.KubeClient.AuthorizationV1().SubjectAccessReviews().Create(&authorizationv1.SubjectAccessReview{
+			Spec: authorizationv1.SubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace: vars["namespace"],
+					Verb:      verb,
+					Group:     helmfluxv1.SchemeGroupVersion.Group,
+					Resource:  "helmreleases",
+					Name:      vars["name"],
+				},
+				User:   user.Username,
+				Groups: user.Groups,
+				UID:    user.UID,
+				Extra:  extra,
+			},
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to review access: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if !access.Status.Allowed {
+			http.Error(w, fmt.Sprintf("user '%s' is not allowed to %s HelmRelease %s/%s", user.Username,
+				verb, vars["namespace"], vars["name"]), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
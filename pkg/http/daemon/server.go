@@ -2,9 +2,12 @@ package daemon
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
-	_ "net/http/pprof"
+	"net/http/pprof"
+	"strconv"
 	"sync/atomic"
 	"time"
 
@@ -13,37 +16,88 @@ import (
 	"github.com/go-kit/kit/log"
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/lstack-org/helm-operator/pkg/admission"
+	"github.com/lstack-org/helm-operator/pkg/conversion"
+	"github.com/lstack-org/helm-operator/pkg/receiver"
 )
 
 // ListenAndServe starts a HTTP server instrumented with Prometheus metrics,
-// health and API endpoints on the specified address.
-func ListenAndServe(listenAddr string, apiServer api.Server, logger log.Logger, stopCh <-chan struct{}) {
-	mux := http.DefaultServeMux
+// health and API endpoints on the specified address. The server is
+// served over TLS and the metrics and profiling endpoints require
+// authentication if configured.
+func ListenAndServe(listenAddr string, config ServerConfig, apiServer api.Server, logger log.Logger, stopCh <-chan struct{}) {
+	mux := http.NewServeMux()
+
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		logger.Log("error", fmt.Sprintf("failed to configure TLS for HTTP server: %v", err))
+		return
+	}
+	metricsHandler, err := config.metricsAuth(promhttp.Handler())
+	if err != nil {
+		logger.Log("error", fmt.Sprintf("failed to configure metrics authentication: %v", err))
+		return
+	}
 
 	// setup metrics and health endpoints
-	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/metrics", metricsHandler)
+	if config.Profiling {
+		profilingHandler, err := config.metricsAuth(profiling())
+		if err != nil {
+			logger.Log("error", fmt.Sprintf("failed to configure profiling authentication: %v", err))
+			return
+		}
+		mux.Handle("/debug/pprof/", profilingHandler)
+	}
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	})
 
 	// setup api endpoints
-	handler := NewHandler(apiServer, transport.NewRouter())
+	router := transport.NewRouter()
+	handler := NewHandler(apiServer, router)
+	actions := router.Get(transport.RequestAction)
+	actions.Handler(config.operationsAuth(actions.GetHandler()))
+	for _, name := range []string{transport.ValuesProvenance, transport.ProjectedDiff,
+		transport.ReleaseState, transport.ReleaseManifest, transport.ReleaseHistory} {
+		route := router.Get(name)
+		route.Handler(config.introspectionAuth(route.GetHandler()))
+	}
 	mux.Handle("/api/", http.StripPrefix("/api", handler))
 
+	// setup the validating admission webhook of HelmReleases
+	if config.AdmissionWebhook {
+		mux.Handle("/admission/helmreleases", admission.Handler(logger))
+	}
+	// setup the conversion webhook of the HelmRelease CRD
+	if config.ConversionWebhook {
+		mux.Handle("/conversion/helmreleases", conversion.Handler(logger))
+	}
+
 	srv := &http.Server{
 		Addr:         listenAddr,
 		Handler:      mux,
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 1 * time.Minute,
 		IdleTimeout:  15 * time.Second,
+		TLSConfig:    tlsConfig,
 	}
 
-	logger.Log("info", fmt.Sprintf("starting HTTP server on %s", listenAddr))
+	logger.Log("info", fmt.Sprintf("starting HTTP server on %s", listenAddr), "tls", tlsConfig != nil)
 
 	// run server in background
 	go func() {
-		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		var err error
+		if tlsConfig != nil {
+			// certificates are already part of the TLS config
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
 			logger.Log("error", fmt.Sprintf("HTTP server crashed %v", err))
 		}
 	}()
@@ -60,10 +114,29 @@ func ListenAndServe(listenAddr string, apiServer api.Server, logger log.Logger,
 	}
 }
 
+// profiling returns the handler of the pprof endpoints at
+// /debug/pprof/; the pprof package registers them on the default mux
+// as well, which is not served.
+func profiling() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
 // NewHandler registers handlers on the given router.
 func NewHandler(s api.Server, r *mux.Router) http.Handler {
 	handle := &APIServer{server: s}
 	r.Get(transport.SyncGit).HandlerFunc(handle.SyncGit)
+	r.Get(transport.ValuesProvenance).HandlerFunc(handle.ValuesProvenance)
+	r.Get(transport.Receiver).HandlerFunc(handle.Receiver)
+	r.Get(transport.ProjectedDiff).HandlerFunc(handle.ProjectedDiff)
+	r.Get(transport.ReleaseState).HandlerFunc(handle.ReleaseState)
+	r.Get(transport.ReleaseManifest).HandlerFunc(handle.ReleaseManifest)
+	r.Get(transport.ReleaseHistory).HandlerFunc(handle.ReleaseHistory)
+	r.Get(transport.RequestAction).HandlerFunc(handle.RequestAction)
 	return r
 }
 
@@ -90,3 +163,181 @@ func (s *APIServer) SyncGit(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
 }
+
+// ValuesProvenance writes back a JSON object with, for each top-level
+// values key of the requested HelmRelease, the sources which provided
+// it, as recorded by the last sync of the HelmRelease.
+func (s *APIServer) ValuesProvenance(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	provenance, err := s.server.ValuesProvenance(vars["namespace"], vars["name"])
+	switch {
+	case errors.IsNotFound(err):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(provenance)
+}
+
+// ReleaseState writes back a JSON object with the sync state of the
+// requested HelmRelease, i.e. its status.
+func (s *APIServer) ReleaseState(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	state, err := s.server.ReleaseState(vars["namespace"], vars["name"])
+	writeJSON(w, state, err)
+}
+
+// ReleaseManifest writes back the manifest of the current Helm release
+// of the requested HelmRelease as YAML, with the data of Secrets
+// redacted.
+func (s *APIServer) ReleaseManifest(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	manifest, err := s.server.ReleaseManifest(vars["namespace"], vars["name"])
+	switch {
+	case errors.IsNotFound(err):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write([]byte(manifest))
+}
+
+// ReleaseHistory writes back a JSON array with the revisions of the
+// Helm release of the requested HelmRelease, the latest first.
+func (s *APIServer) ReleaseHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	history, err := s.server.ReleaseHistory(vars["namespace"], vars["name"])
+	writeJSON(w, history, err)
+}
+
+// writeJSON writes back the given value as JSON, or the error with
+// the status code for its kind.
+func writeJSON(w http.ResponseWriter, v interface{}, err error) {
+	switch {
+	case errors.IsNotFound(err):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// RequestAction requests the action in the path for the requested
+// HelmRelease, which is run on its next reconciliation. A rollback
+// targets the revision or generation in the query, if any. It writes
+// back a HTTP 202 status header as the action is run asynchronously.
+func (s *APIServer) RequestAction(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var target api.RollbackTarget
+	if v := r.URL.Query().Get("revision"); v != "" {
+		revision, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid revision: %v", err), http.StatusBadRequest)
+			return
+		}
+		target.Revision = revision
+	}
+	if v := r.URL.Query().Get("generation"); v != "" {
+		generation, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid generation: %v", err), http.StatusBadRequest)
+			return
+		}
+		target.Generation = generation
+	}
+
+	err := s.server.RequestAction(vars["namespace"], vars["name"], api.ReleaseAction(vars["action"]), target)
+	_, invalid := err.(api.InvalidActionError)
+	switch {
+	case invalid:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.IsNotFound(err):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte("Accepted"))
+}
+
+// maxMutationSize is the maximum size of a spec mutation.
+const maxMutationSize = 1 << 20
+
+// ProjectedDiff writes back a JSON object with the diff the spec
+// mutation in the request body would make to the release of the
+// requested HelmRelease. The chart is fetched and rendered to project
+// the diff, which makes this a preview operation rather than one to be
+// polled.
+func (s *APIServer) ProjectedDiff(w http.ResponseWriter, r *http.Request) {
+	var mutation api.SpecMutation
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMutationSize)).Decode(&mutation); err != nil {
+		http.Error(w, fmt.Sprintf("invalid spec mutation: %v", err), http.StatusBadRequest)
+		return
+	}
+	vars := mux.Vars(r)
+	diff, err := s.server.ProjectDiff(vars["namespace"], vars["name"], mutation)
+	_, invalid := err.(api.InvalidMutationError)
+	switch {
+	case errors.IsNotFound(err):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case invalid:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diff)
+}
+
+// maxWebhookPayload is the maximum size of a webhook payload, which
+// equals the limit of GitHub.
+const maxWebhookPayload = 25 << 20
+
+// Receiver verifies the webhook of the requested provider, and
+// enqueues the HelmReleases referring to the pushed repository or
+// chart for a sync. It writes back a JSON object with the number of
+// enqueued HelmReleases.
+func (s *APIServer) Receiver(w http.ResponseWriter, r *http.Request) {
+	payload, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayload))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	n, err := s.server.Receive(mux.Vars(r)["provider"], r.Header, payload)
+	_, unsupported := err.(receiver.UnsupportedProviderError)
+	switch {
+	case err == nil:
+	case unsupported || err == receiver.ErrDisabled:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err == receiver.ErrUnauthorized:
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"enqueued": n})
+}
@@ -0,0 +1,204 @@
+package daemon
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// ServerConfig holds the TLS and authentication configuration for the
+// HTTP server.
+type ServerConfig struct {
+	// TLSCertFile and TLSKeyFile are the paths to the certificate and
+	// key the server is served with.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSAutoGenerate serves the server with a self-signed certificate
+	// generated at startup, when no certificate files are configured.
+	TLSAutoGenerate bool
+	// MetricsClientCAFile is the path to a CA bundle; clients
+	// presenting a certificate signed by it are allowed to access the
+	// metrics endpoint.
+	MetricsClientCAFile string
+	// MetricsBearerTokenFile is the path to a file holding the token
+	// clients must present as a bearer token to access the metrics
+	// endpoint.
+	MetricsBearerTokenFile string
+	// Profiling serves the pprof endpoints at /debug/pprof/, with the
+	// authentication of the metrics endpoint.
+	Profiling bool
+	// AdmissionWebhook serves the validating admission webhook of
+	// HelmReleases at /admission/helmreleases; it requires TLS, as the
+	// API server only calls webhooks over HTTPS.
+	AdmissionWebhook bool
+	// ConversionWebhook serves the conversion webhook of the
+	// HelmRelease CustomResourceDefinition at /conversion/helmreleases;
+	// it requires TLS as well.
+	ConversionWebhook bool
+	// OperationsAPI serves the endpoints requesting syncs, rollbacks
+	// and tests of HelmReleases; clients are authenticated with
+	// TokenReviews, and authorized to patch the HelmRelease with
+	// SubjectAccessReviews, using the KubeClient.
+	OperationsAPI bool
+	// IntrospectionAPI serves the endpoints reporting the release
+	// state, manifest, history, values provenance and projected diffs
+	// of HelmReleases; clients are authenticated like those of the
+	// OperationsAPI, but only need to be authorized to get the
+	// HelmRelease.
+	IntrospectionAPI bool
+	KubeClient       kubernetes.Interface
+}
+
+// TLSEnabled returns if the server should be served over TLS.
+func (c ServerConfig) TLSEnabled() bool {
+	return c.TLSCertFile != "" || c.TLSAutoGenerate
+}
+
+// Validate returns an error if the configuration is not usable.
+func (c ServerConfig) Validate() error {
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return errors.New("both a TLS certificate and key file are required")
+	}
+	if c.MetricsClientCAFile != "" && !c.TLSEnabled() {
+		return errors.New("client certificate authentication requires TLS to be enabled")
+	}
+	if c.AdmissionWebhook && !c.TLSEnabled() {
+		return errors.New("the admission webhook requires TLS to be enabled")
+	}
+	if c.ConversionWebhook && !c.TLSEnabled() {
+		return errors.New("the conversion webhook requires TLS to be enabled")
+	}
+	if c.OperationsAPI && c.KubeClient == nil {
+		return errors.New("the operations API requires a Kubernetes client")
+	}
+	if c.IntrospectionAPI && c.KubeClient == nil {
+		return errors.New("the introspection API requires a Kubernetes client")
+	}
+	return nil
+}
+
+// tlsConfig returns the TLS configuration for the server, or nil if
+// TLS is not enabled.
+func (c ServerConfig) tlsConfig() (*tls.Config, error) {
+	if !c.TLSEnabled() {
+		return nil, nil
+	}
+
+	var cert tls.Certificate
+	var err error
+	switch {
+	case c.TLSCertFile != "":
+		cert, err = tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+	default:
+		cert, err = selfSignedCertificate()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if c.MetricsClientCAFile != "" {
+		b, err := ioutil.ReadFile(c.MetricsClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", c.MetricsClientCAFile)
+		}
+		config.ClientCAs = pool
+		// Client certificates are only required for the metrics
+		// endpoint, health probes must continue to work without.
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
+
+// metricsAuth wraps the given handler with the authentication
+// configured for the metrics endpoint. A request is authorized if it
+// satisfies any of the configured methods.
+func (c ServerConfig) metricsAuth(next http.Handler) (http.Handler, error) {
+	var token []byte
+	if c.MetricsBearerTokenFile != "" {
+		b, err := ioutil.ReadFile(c.MetricsBearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read metrics bearer token file: %w", err)
+		}
+		token = []byte(strings.TrimSpace(string(b)))
+		if len(token) == 0 {
+			return nil, fmt.Errorf("metrics bearer token file %s is empty", c.MetricsBearerTokenFile)
+		}
+	}
+	clientCerts := c.MetricsClientCAFile != ""
+	if token == nil && !clientCerts {
+		return next, nil
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if clientCerts && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if token != nil {
+			auth := r.Header.Get("Authorization")
+			if strings.HasPrefix(auth, "Bearer ") &&
+				subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), token) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+		}
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	}), nil
+}
+
+// selfSignedCertificate generates a self-signed certificate for the
+// hostname of the pod, valid for one year.
+func selfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "helm-operator"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if hostname != "" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
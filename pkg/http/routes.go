@@ -1,5 +1,12 @@
 package http
 
 const (
-	SyncGit = "SyncGit"
+	SyncGit          = "SyncGit"
+	ValuesProvenance = "ValuesProvenance"
+	Receiver         = "Receiver"
+	ProjectedDiff    = "ProjectedDiff"
+	ReleaseState     = "ReleaseState"
+	ReleaseManifest  = "ReleaseManifest"
+	ReleaseHistory   = "ReleaseHistory"
+	RequestAction    = "RequestAction"
 )
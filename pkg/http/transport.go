@@ -9,5 +9,12 @@ import (
 func NewRouter() *mux.Router {
 	r := mux.NewRouter()
 	r.NewRoute().Name(SyncGit).Methods("POST").Path("/v1/sync-git")
+	r.NewRoute().Name(ValuesProvenance).Methods("GET").Path("/v1/helmreleases/{namespace}/{name}/values-provenance")
+	r.NewRoute().Name(Receiver).Methods("POST").Path("/v1/receivers/{provider}")
+	r.NewRoute().Name(ProjectedDiff).Methods("POST").Path("/v1/helmreleases/{namespace}/{name}/projected-diff")
+	r.NewRoute().Name(ReleaseState).Methods("GET").Path("/v1/helmreleases/{namespace}/{name}")
+	r.NewRoute().Name(ReleaseManifest).Methods("GET").Path("/v1/helmreleases/{namespace}/{name}/manifest")
+	r.NewRoute().Name(ReleaseHistory).Methods("GET").Path("/v1/helmreleases/{namespace}/{name}/history")
+	r.NewRoute().Name(RequestAction).Methods("POST").Path("/v1/helmreleases/{namespace}/{name}/{action:sync|rollback|test}")
 	return r
 }
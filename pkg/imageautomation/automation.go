@@ -0,0 +1,360 @@
+/*
+Package imageautomation updates the image tags in the values of
+`HelmRelease` resources to the latest tags in the registry matching
+their image update policies.
+
+Tags in the inline values are updated in the `HelmRelease`, which
+triggers an upgrade of the release. Tags in values Secrets are picked
+up by the next sync of the release. Updating inline values is not
+supported for `HelmReleases` applied from Git, as the next apply
+reverts the update: their policies must update a values Secret. The latest tags, and when they
+were last scanned for and applied, are recorded in the status of the
+`HelmRelease`.
+*/
+package imageautomation
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/go-kit/kit/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/yaml"
+
+	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientset "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned"
+	iflister "github.com/lstack-org/helm-operator/pkg/client/listers/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/registry"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+type Updater struct {
+	hrClient     ifclientset.Interface
+	hrLister     iflister.HelmReleaseLister
+	coreV1Client corev1client.CoreV1Interface
+	registry     *registry.Client
+}
+
+func New(hrClient ifclientset.Interface, hrLister iflister.HelmReleaseLister, coreV1Client corev1client.CoreV1Interface) *Updater {
+	return &Updater{
+		hrClient:     hrClient,
+		hrLister:     hrLister,
+		coreV1Client: coreV1Client,
+		registry:     registry.NewClient(nil),
+	}
+}
+
+// Loop scans the registries for the image update policies of all
+// HelmReleases on every interval, until stop is closed.
+func (u *Updater) Loop(stop <-chan struct{}, interval time.Duration, logger log.Logger) {
+	ticker := time.NewTicker(interval)
+	var logErr error
+
+bail:
+	for {
+		select {
+		case <-stop:
+			break bail
+		case <-ticker.C:
+		}
+		list, err := u.hrLister.List(labels.Everything())
+		if err != nil {
+			logErr = err
+			break bail
+		}
+		for _, hr := range list {
+			if len(hr.Spec.ImageUpdates) == 0 || hr.Spec.Suspend {
+				continue
+			}
+			if err := u.update(hr, logger); err != nil {
+				logger.Log("namespace", hr.Namespace, "resource", hr.Name, "err", err)
+			}
+		}
+	}
+
+	ticker.Stop()
+	logger.Log("loop", "stopping", "err", logErr)
+}
+
+// update applies the image update policies of the given HelmRelease,
+// and records their state in its status. A failing policy does not
+// hold the others. To not write the status on every scan, the time of
+// the scan is only recorded for a policy if its state has changed.
+func (u *Updater) update(hr *v1.HelmRelease, logger log.Logger) error {
+	now := metav1.Now()
+	last := make([]v1.ImageUpdateStatus, len(hr.Spec.ImageUpdates))
+	updates := make([]v1.ImageUpdateStatus, len(hr.Spec.ImageUpdates))
+	inline := make(map[string]string)
+	var errs []string
+	for i, policy := range hr.Spec.ImageUpdates {
+		last[i] = lastImageUpdate(hr.Status.ImageUpdates, policy)
+		updates[i] = last[i]
+		updates[i].Message = ""
+		tag, err := u.latestTag(hr.Namespace, policy)
+		if err != nil {
+			updates[i].Message = err.Error()
+			errs = append(errs, fmt.Sprintf("image update policy %d: %s", i, err))
+			continue
+		}
+		updates[i].LatestTag = tag
+		if tag == "" {
+			continue
+		}
+		if policy.ValuesSecretRef == nil {
+			inline[policy.Path] = tag
+			continue
+		}
+		changed, err := u.updateSecret(hr.Namespace, *policy.ValuesSecretRef, policy.Path, tag)
+		if err != nil {
+			updates[i].Message = err.Error()
+			errs = append(errs, fmt.Sprintf("image update policy %d: %s", i, err))
+			continue
+		}
+		if changed {
+			updates[i].LastUpdateTime = &now
+			logger.Log("info", fmt.Sprintf("updated image '%s' to tag '%s' in Secret '%s'", policy.Image, tag, policy.ValuesSecretRef.Name),
+				"namespace", hr.Namespace, "resource", hr.Name)
+		}
+	}
+	if len(inline) > 0 {
+		var updated map[string]bool
+		var err error
+		hr, updated, err = u.updateInlineValues(hr, inline, logger)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("failed to update inline values: %s", err))
+		}
+		for i, policy := range hr.Spec.ImageUpdates {
+			if policy.ValuesSecretRef != nil || inline[policy.Path] == "" {
+				continue
+			}
+			if err != nil {
+				updates[i].Message = err.Error()
+			} else if updated[policy.Path] {
+				updates[i].LastUpdateTime = &now
+			}
+		}
+	}
+
+	for i := range updates {
+		if imageUpdateChanged(last[i], updates[i]) {
+			updates[i].LastScanTime = &now
+		}
+	}
+	if err := status.SetImageUpdates(u.hrClient.HelmV1().HelmReleases(hr.Namespace), hr, updates); err != nil {
+		errs = append(errs, fmt.Sprintf("failed to record image updates in status: %s", err))
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// lastImageUpdate returns the recorded state of the given image update
+// policy, or the initial state if none is recorded.
+func lastImageUpdate(updates []v1.ImageUpdateStatus, policy v1.ImageUpdatePolicy) v1.ImageUpdateStatus {
+	for _, s := range updates {
+		if s.Image == policy.Image && s.Path == policy.Path {
+			return s
+		}
+	}
+	return v1.ImageUpdateStatus{Image: policy.Image, Path: policy.Path}
+}
+
+// imageUpdateChanged returns if the latest tag, the error or the time
+// of the last update of the given state of an image update policy
+// differ from its recorded state, or if it has never been scanned.
+func imageUpdateChanged(last, update v1.ImageUpdateStatus) bool {
+	return last.LastScanTime == nil || last.LatestTag != update.LatestTag || last.Message != update.Message ||
+		!last.LastUpdateTime.Equal(update.LastUpdateTime)
+}
+
+// latestTag returns the latest tag of the image of the policy, or an
+// empty string if no tag is selected by the policy.
+func (u *Updater) latestTag(namespace string, policy v1.ImageUpdatePolicy) (string, error) {
+	var creds map[string]registry.Credentials
+	if policy.SecretRef != nil {
+		secret, err := u.coreV1Client.Secrets(namespace).Get(policy.SecretRef.Name, metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("failed to get registry credentials: %w", err)
+		}
+		if creds, err = registry.CredentialsFromSecret(secret); err != nil {
+			return "", fmt.Errorf("failed to read registry credentials from Secret '%s': %w", policy.SecretRef.Name, err)
+		}
+	}
+	tags, err := u.registry.Tags(policy.Image, creds)
+	if err != nil {
+		return "", fmt.Errorf("failed to list tags of image '%s': %w", policy.Image, err)
+	}
+	return selectTag(tags, policy)
+}
+
+// selectTag returns the latest of the given tags according to the
+// policy, or an empty string if none of the tags is selected.
+func selectTag(tags []string, policy v1.ImageUpdatePolicy) (string, error) {
+	if policy.SemVer == "" && policy.Regex == "" {
+		return "", fmt.Errorf("either a semver range or a regex is required")
+	}
+	if policy.Regex != "" {
+		re, err := regexp.Compile(policy.Regex)
+		if err != nil {
+			return "", fmt.Errorf("invalid regex '%s': %w", policy.Regex, err)
+		}
+		var matching []string
+		for _, tag := range tags {
+			if re.MatchString(tag) {
+				matching = append(matching, tag)
+			}
+		}
+		tags = matching
+	}
+
+	if policy.SemVer == "" {
+		if len(tags) == 0 {
+			return "", nil
+		}
+		sort.Strings(tags)
+		return tags[len(tags)-1], nil
+	}
+
+	constraint, err := semver.NewConstraint(policy.SemVer)
+	if err != nil {
+		return "", fmt.Errorf("invalid semver range '%s': %w", policy.SemVer, err)
+	}
+	var latest *semver.Version
+	var latestTag string
+	for _, tag := range tags {
+		v, err := semver.NewVersion(tag)
+		if err != nil || !constraint.Check(v) {
+			continue
+		}
+		if latest == nil || v.GreaterThan(latest) {
+			latest, latestTag = v, tag
+		}
+	}
+	return latestTag, nil
+}
+
+// updateInlineValues sets the given tags, by path, in the inline
+// values of the HelmRelease. It returns the HelmRelease as updated,
+// and the paths of the tags which have been changed.
+func (u *Updater) updateInlineValues(hr *v1.HelmRelease, tags map[string]string, logger log.Logger) (*v1.HelmRelease, map[string]bool, error) {
+	client := u.hrClient.HelmV1().HelmReleases(hr.Namespace)
+	firstTry := true
+	var changedPaths map[string]bool
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() (err error) {
+		if !firstTry {
+			var getErr error
+			hr, getErr = client.Get(hr.Name, metav1.GetOptions{})
+			if getErr != nil {
+				return getErr
+			}
+		}
+		firstTry = false
+
+		cHr := hr.DeepCopy()
+		if cHr.Spec.Values.Data == nil {
+			cHr.Spec.Values.Data = make(map[string]interface{})
+		}
+		var updated []string
+		changedPaths = make(map[string]bool)
+		for path, tag := range tags {
+			changed, err := setValue(cHr.Spec.Values.Data, path, tag)
+			if err != nil {
+				return err
+			}
+			if changed {
+				updated = append(updated, fmt.Sprintf("%s=%s", path, tag))
+				changedPaths[path] = true
+			}
+		}
+		if len(updated) == 0 {
+			return nil
+		}
+		if cHr, err = client.Update(cHr); err == nil {
+			hr = cHr
+			sort.Strings(updated)
+			logger.Log("info", fmt.Sprintf("updated image tags %s", strings.Join(updated, ", ")),
+				"namespace", hr.Namespace, "resource", hr.Name)
+		}
+		return err
+	})
+	if err != nil {
+		return hr, nil, err
+	}
+	return hr, changedPaths, nil
+}
+
+// updateSecret sets the tag at the given path in the values held by
+// the referenced Secret. It returns if the Secret has been changed.
+func (u *Updater) updateSecret(namespace string, ref v1.SecretKeySelector, path, tag string) (bool, error) {
+	if ref.Namespace != "" && ref.Namespace != namespace {
+		return false, fmt.Errorf("values Secret '%s' must be in the namespace of the HelmRelease", ref.Name)
+	}
+	key := ref.Key
+	if key == "" {
+		key = "values.yaml"
+	}
+	secrets := u.coreV1Client.Secrets(namespace)
+	var changed bool
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		secret, err := secrets.Get(ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		values := make(map[string]interface{})
+		if err := yaml.Unmarshal(secret.Data[key], &values); err != nil {
+			return fmt.Errorf("unable to yaml.Unmarshal values from %s in Secret %s: %w", key, ref.Name, err)
+		}
+		if values == nil {
+			values = make(map[string]interface{})
+		}
+		if changed, err = setValue(values, path, tag); err != nil || !changed {
+			return err
+		}
+		b, err := yaml.Marshal(values)
+		if err != nil {
+			return err
+		}
+		if secret.Data == nil {
+			secret.Data = make(map[string][]byte)
+		}
+		secret.Data[key] = b
+		_, err = secrets.Update(secret)
+		return err
+	})
+	return changed, err
+}
+
+// setValue sets the value at the given dot separated path, creating
+// intermediate maps where necessary. It returns if the values were
+// changed.
+func setValue(values map[string]interface{}, path string, value string) (bool, error) {
+	keys := strings.Split(path, ".")
+	m := values
+	for i, k := range keys[:len(keys)-1] {
+		next, ok := m[k]
+		if !ok || next == nil {
+			n := make(map[string]interface{})
+			m[k] = n
+			m = n
+			continue
+		}
+		if m, ok = next.(map[string]interface{}); !ok {
+			return false, fmt.Errorf("value at '%s' is not a map", strings.Join(keys[:i+1], "."))
+		}
+	}
+	last := keys[len(keys)-1]
+	if current, ok := m[last]; ok && current == value {
+		return false, nil
+	}
+	m[last] = value
+	return true, nil
+}
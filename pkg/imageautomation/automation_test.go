@@ -0,0 +1,130 @@
+package imageautomation
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+	"github.com/lstack-org/helm-operator/pkg/registry"
+)
+
+func TestSelectTag(t *testing.T) {
+	tags := []string{"1.0.0", "1.2.0", "1.10.1", "2.0.0-rc.1", "2.0.0", "latest", "main-20201001", "main-20201105"}
+	for _, c := range []struct {
+		policy   v1.ImageUpdatePolicy
+		expected string
+	}{
+		{v1.ImageUpdatePolicy{SemVer: "~1"}, "1.10.1"},
+		{v1.ImageUpdatePolicy{SemVer: ">=1.0.0"}, "2.0.0"},
+		{v1.ImageUpdatePolicy{SemVer: ">=3.0.0"}, ""},
+		{v1.ImageUpdatePolicy{Regex: "^main-"}, "main-20201105"},
+		{v1.ImageUpdatePolicy{Regex: `^1\.`, SemVer: "<1.5"}, "1.2.0"},
+	} {
+		tag, err := selectTag(tags, c.policy)
+		assert.NoError(t, err)
+		assert.Equal(t, c.expected, tag, c.policy)
+	}
+
+	_, err := selectTag(tags, v1.ImageUpdatePolicy{})
+	assert.Error(t, err)
+	_, err = selectTag(tags, v1.ImageUpdatePolicy{Regex: "("})
+	assert.Error(t, err)
+}
+
+func TestSetValue(t *testing.T) {
+	values := map[string]interface{}{
+		"image": map[string]interface{}{"tag": "1.0.0"},
+		"name":  "app",
+	}
+	changed, err := setValue(values, "image.tag", "1.0.0")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	changed, err = setValue(values, "image.tag", "1.1.0")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "1.1.0", values["image"].(map[string]interface{})["tag"])
+
+	changed, err = setValue(values, "sidecar.image.tag", "2.0.0")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, map[string]interface{}{"image": map[string]interface{}{"tag": "2.0.0"}}, values["sidecar"])
+
+	_, err = setValue(values, "name.tag", "1.0.0")
+	assert.Error(t, err)
+}
+
+func TestUpdate(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name":"team/app","tags":["1.0.0","1.1.0","2.0.0"]}`)
+	}))
+	defer srv.Close()
+	image := strings.TrimPrefix(srv.URL, "https://") + "/team/app"
+
+	hr := &v1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+		Spec: v1.HelmReleaseSpec{
+			ImageUpdates: []v1.ImageUpdatePolicy{
+				{Image: image, Path: "image.tag", SemVer: "~1"},
+				{Image: image, Path: "sidecar.tag", Regex: "("},
+			},
+		},
+	}
+	hr.Spec.Values.Data = map[string]interface{}{"image": map[string]interface{}{"tag": "1.0.0"}}
+	hrClient := ifclientsetfake.NewSimpleClientset(hr)
+	u := &Updater{hrClient: hrClient, coreV1Client: fake.NewSimpleClientset().CoreV1(), registry: registry.NewClient(srv.Client())}
+
+	// the failing policy does not hold the other
+	assert.Error(t, u.update(hr, log.NewNopLogger()))
+	updated, err := hrClient.HelmV1().HelmReleases(hr.Namespace).Get(hr.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "1.1.0", updated.Spec.Values.Data["image"].(map[string]interface{})["tag"])
+	if assert.Len(t, updated.Status.ImageUpdates, 2) {
+		s := updated.Status.ImageUpdates[0]
+		assert.Equal(t, "1.1.0", s.LatestTag)
+		assert.NotNil(t, s.LastScanTime)
+		assert.NotNil(t, s.LastUpdateTime)
+		assert.Empty(t, s.Message)
+		s = updated.Status.ImageUpdates[1]
+		assert.Equal(t, "sidecar.tag", s.Path)
+		assert.Nil(t, s.LastUpdateTime)
+		assert.Contains(t, s.Message, "invalid regex")
+	}
+
+	// the time of the last update is kept while the tag is unchanged
+	lastUpdate := updated.Status.ImageUpdates[0].LastUpdateTime
+	updated.Spec.ImageUpdates = updated.Spec.ImageUpdates[:1]
+	assert.NoError(t, u.update(updated, log.NewNopLogger()))
+	updated, err = hrClient.HelmV1().HelmReleases(hr.Namespace).Get(hr.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	if assert.Len(t, updated.Status.ImageUpdates, 1) {
+		assert.Equal(t, lastUpdate, updated.Status.ImageUpdates[0].LastUpdateTime)
+	}
+
+	// the status is not written for an unchanged scan
+	hrClient.ClearActions()
+	assert.NoError(t, u.update(updated, log.NewNopLogger()))
+	for _, action := range hrClient.Actions() {
+		assert.NotEqual(t, "update", action.GetVerb())
+	}
+
+	// a failed scan keeps the latest tag
+	updated.Spec.ImageUpdates[0].SemVer = "invalid"
+	assert.Error(t, u.update(updated, log.NewNopLogger()))
+	updated, err = hrClient.HelmV1().HelmReleases(hr.Namespace).Get(hr.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	if assert.Len(t, updated.Status.ImageUpdates, 1) {
+		s := updated.Status.ImageUpdates[0]
+		assert.Equal(t, "1.1.0", s.LatestTag)
+		assert.Contains(t, s.Message, "invalid semver range")
+	}
+}
@@ -0,0 +1,56 @@
+package logging
+
+import (
+	"flag"
+	"io/ioutil"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"k8s.io/klog"
+)
+
+// RedirectKlog redirects the output of klog, as used by the Kubernetes
+// client and Helm, to the given logger.
+func RedirectKlog(logger log.Logger) {
+	flags := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(flags)
+	flags.Set("logtostderr", "false")
+	flags.Set("alsologtostderr", "false")
+	flags.Set("stderrthreshold", "FATAL")
+	// every record is written to the output of the info severity,
+	// and to those of the lower severities
+	klog.SetOutputBySeverity("INFO", &klogWriter{logger})
+	for _, severity := range []string{"WARNING", "ERROR", "FATAL"} {
+		klog.SetOutputBySeverity(severity, ioutil.Discard)
+	}
+}
+
+// klogWriter logs the klog records written to it, with the level of
+// their header.
+type klogWriter struct {
+	logger log.Logger
+}
+
+func (w *klogWriter) Write(p []byte) (int, error) {
+	level, msg := parseKlogRecord(string(p))
+	w.logger.Log(level.String(), msg)
+	return len(p), nil
+}
+
+// parseKlogRecord returns the level and message of the given klog
+// record, of the form `Lmmdd hh:mm:ss.uuuuuu threadid file:line] msg`.
+func parseKlogRecord(record string) (Level, string) {
+	record = strings.TrimSuffix(record, "\n")
+	i := strings.Index(record, "] ")
+	if i < 0 || record == "" {
+		return LevelInfo, record
+	}
+	level := LevelInfo
+	switch record[0] {
+	case 'W':
+		level = LevelWarning
+	case 'E', 'F':
+		level = LevelError
+	}
+	return level, record[i+2:]
+}
@@ -0,0 +1,158 @@
+/*
+Package logging provides the structured logger of the operator. It
+writes the records of every component, including those of klog, in a
+single format, either logfmt or JSON, and filters them by the level of
+their component.
+
+Records are logged with the level as the key of their message, as in
+`logger.Log("info", "upgrade succeeded")`; the logger rewrites these to
+`level=info msg="upgrade succeeded"` so logs can be indexed.
+*/
+package logging
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+)
+
+// Level is the level of a log record.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarning
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug:   "debug",
+	LevelInfo:    "info",
+	LevelWarning: "warning",
+	LevelError:   "error",
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel parses the given level name.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarning, nil
+	case "error":
+		return LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level '%s'", s)
+}
+
+// Levels are the minimum levels of the records logged by components.
+type Levels struct {
+	// Default is the level of components without a level.
+	Default Level
+	// Components are the levels by the name of the component.
+	Components map[string]Level
+}
+
+// ParseLevels parses the given comma separated levels, being the
+// default level and the levels of components in the form
+// <component>=<level>, e.g. `warning,release=debug`.
+func ParseLevels(spec string) (Levels, error) {
+	levels := Levels{Default: LevelInfo, Components: make(map[string]Level)}
+	for _, s := range strings.Split(spec, ",") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		parts := strings.SplitN(s, "=", 2)
+		level, err := ParseLevel(parts[len(parts)-1])
+		if err != nil {
+			return Levels{}, err
+		}
+		if len(parts) == 1 {
+			levels.Default = level
+			continue
+		}
+		levels.Components[strings.TrimSpace(parts[0])] = level
+	}
+	return levels, nil
+}
+
+// Enabled returns if records of the given level of the component are
+// logged.
+func (l Levels) Enabled(component string, level Level) bool {
+	min, ok := l.Components[component]
+	if !ok {
+		min = l.Default
+	}
+	return level >= min
+}
+
+// NewLogger returns a logger writing the records to w in the given
+// format, one of `fmt` or `json`, filtered by the given levels.
+func NewLogger(w io.Writer, format string, levels Levels) (log.Logger, error) {
+	var logger log.Logger
+	switch format {
+	case "json":
+		logger = log.NewJSONLogger(log.NewSyncWriter(w))
+	case "fmt", "logfmt":
+		logger = log.NewLogfmtLogger(log.NewSyncWriter(w))
+	default:
+		return nil, fmt.Errorf("unknown log format '%s'", format)
+	}
+	return &leveledLogger{next: logger, levels: levels}, nil
+}
+
+// leveledLogger filters the records by their level, rewriting the
+// level and message of the records.
+type leveledLogger struct {
+	next   log.Logger
+	levels Levels
+}
+
+func (l *leveledLogger) Log(keyvals ...interface{}) error {
+	level, leveled := LevelInfo, false
+	// at is the index of the level key of the message, if any
+	at := -1
+	var component string
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		key, ok := keyvals[i].(string)
+		if !ok {
+			continue
+		}
+		switch {
+		case key == "component":
+			component = fmt.Sprint(keyvals[i+1])
+		case leveled:
+		case key == "level":
+			if lvl, err := ParseLevel(fmt.Sprint(keyvals[i+1])); err == nil {
+				level = lvl
+			}
+			leveled = true
+		default:
+			if lvl, err := ParseLevel(key); err == nil {
+				level, leveled, at = lvl, true, i
+			}
+		}
+	}
+	if !l.levels.Enabled(component, level) {
+		return nil
+	}
+	switch {
+	case !leveled:
+		keyvals = append([]interface{}{"level", level.String()}, keyvals...)
+	case at >= 0:
+		rewritten := make([]interface{}, 0, len(keyvals)+2)
+		rewritten = append(rewritten, keyvals[:at]...)
+		rewritten = append(rewritten, "level", level.String(), "msg", keyvals[at+1])
+		keyvals = append(rewritten, keyvals[at+2:]...)
+	}
+	return l.next.Log(keyvals...)
+}
@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLevels(t *testing.T) {
+	levels, err := ParseLevels("warning, release=debug,chartsync=error")
+	assert.NoError(t, err)
+	assert.Equal(t, Levels{Default: LevelWarning, Components: map[string]Level{"release": LevelDebug, "chartsync": LevelError}}, levels)
+	assert.True(t, levels.Enabled("release", LevelDebug))
+	assert.False(t, levels.Enabled("operator", LevelInfo))
+	assert.False(t, levels.Enabled("chartsync", LevelWarning))
+
+	levels, err = ParseLevels("")
+	assert.NoError(t, err)
+	assert.Equal(t, LevelInfo, levels.Default)
+
+	_, err = ParseLevels("release=verbose")
+	assert.Error(t, err)
+}
+
+func TestLeveledLogger(t *testing.T) {
+	levels, err := ParseLevels("info,release=warning")
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, "fmt", levels)
+	assert.NoError(t, err)
+
+	log.With(logger, "component", "operator").Log("info", "starting workers", "workers", 2)
+	log.With(logger, "component", "operator").Log("debug", "queued")
+	log.With(logger, "component", "release").Log("info", "running upgrade", "action", "upgrade")
+	log.With(logger, "component", "release").Log("error", "upgrade failed", "action", "upgrade")
+	logger.Log("msg", "no level")
+	logger.Log("level", "warning", "msg", "leveled")
+	assert.Equal(t, `component=operator level=info msg="starting workers" workers=2
+component=release level=error msg="upgrade failed" action=upgrade
+level=info msg="no level"
+level=warning msg=leveled
+`, buf.String())
+
+	_, err = NewLogger(&buf, "xml", levels)
+	assert.Error(t, err)
+}
+
+func TestParseKlogRecord(t *testing.T) {
+	level, msg := parseKlogRecord("W1014 12:00:00.000000    1 reflector.go:302] watch closed\n")
+	assert.Equal(t, LevelWarning, level)
+	assert.Equal(t, "watch closed", msg)
+	level, msg = parseKlogRecord("E1014 12:00:00.000000    1 leaderelection.go:330] error retrieving lease")
+	assert.Equal(t, LevelError, level)
+	assert.Equal(t, "error retrieving lease", msg)
+	level, msg = parseKlogRecord("plain")
+	assert.Equal(t, LevelInfo, level)
+	assert.Equal(t, "plain", msg)
+}
@@ -0,0 +1,81 @@
+/*
+Package messages holds the catalog of log messages of the operator.
+
+Messages are identified by a stable ID and are logged in English by
+default, so that logs are searchable. A different language can be
+selected with SetLanguage; messages without a translation fall back
+to English. Error strings are not localized, so they remain stable
+for matching.
+*/
+package messages
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ID identifies a message in the catalog.
+type ID string
+
+const (
+	ChartCacheUsed        ID = "ChartCacheUsed"
+	IstioInjectionFailed  ID = "IstioInjectionFailed"
+	PostRenderedManifests ID = "PostRenderedManifests"
+)
+
+// English is the default language.
+const English = "en"
+
+var catalog = map[string]map[ID]string{
+	English: {
+		ChartCacheUsed:        "using cached chart for '%s' at '%s'",
+		IstioInjectionFailed:  "failed to handle Istio injection for %s '%s': %v",
+		PostRenderedManifests: "post-rendered manifests of Helm release '%s':\n%s",
+	},
+	"zh": {
+		ChartCacheUsed:        "使用缓存的 chart '%s'，路径 '%s'",
+		IstioInjectionFailed:  "处理 %s '%s' 的 Istio 注入失败: %v",
+		PostRenderedManifests: "Helm release '%s' 后置渲染后的清单:\n%s",
+	},
+}
+
+var (
+	mu       sync.RWMutex
+	language = English
+)
+
+// Languages returns the languages available in the catalog.
+func Languages() []string {
+	var languages []string
+	for l := range catalog {
+		languages = append(languages, l)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// SetLanguage sets the language messages are returned in. It returns
+// an error if the language is not in the catalog.
+func SetLanguage(lang string) error {
+	if _, ok := catalog[lang]; !ok {
+		return fmt.Errorf("unsupported language '%s', available: %v", lang, Languages())
+	}
+	mu.Lock()
+	language = lang
+	mu.Unlock()
+	return nil
+}
+
+// Get returns the message for the given ID in the selected language,
+// formatted with the given arguments.
+func Get(id ID, args ...interface{}) string {
+	mu.RLock()
+	lang := language
+	mu.RUnlock()
+	format, ok := catalog[lang][id]
+	if !ok {
+		format = catalog[English][id]
+	}
+	return fmt.Sprintf(format, args...)
+}
@@ -0,0 +1,31 @@
+package messages
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var verbs = regexp.MustCompile(`%[a-z]`)
+
+func TestCatalog(t *testing.T) {
+	for lang, messages := range catalog {
+		for id, format := range messages {
+			english, ok := catalog[English][id]
+			if assert.True(t, ok, "message %s in %s has no English text", id, lang) {
+				assert.Equal(t, verbs.FindAllString(english, -1), verbs.FindAllString(format, -1),
+					"message %s in %s has different verbs than English", id, lang)
+			}
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	defer SetLanguage(English)
+
+	assert.Equal(t, "using cached chart for 'a' at 'b'", Get(ChartCacheUsed, "a", "b"))
+	assert.Error(t, SetLanguage("xx"))
+	assert.NoError(t, SetLanguage("zh"))
+	assert.Equal(t, "使用缓存的 chart 'a'，路径 'b'", Get(ChartCacheUsed, "a", "b"))
+}
@@ -0,0 +1,109 @@
+// Package metrics controls the cardinality of the release labels of
+// the metrics of the operator.
+package metrics
+
+import (
+	"fmt"
+	"hash/fnv"
+	"path"
+	"sync"
+)
+
+// ReleaseLabelMode is how the release name label of metrics is set.
+type ReleaseLabelMode string
+
+const (
+	// ReleaseLabelFull labels metrics with the release name.
+	ReleaseLabelFull ReleaseLabelMode = "full"
+	// ReleaseLabelNamespace aggregates metrics per target namespace,
+	// leaving the release name label empty.
+	ReleaseLabelNamespace ReleaseLabelMode = "namespace"
+	// ReleaseLabelHashed aggregates metrics into a fixed amount of
+	// buckets per target namespace, by a hash of the release name.
+	ReleaseLabelHashed ReleaseLabelMode = "hashed"
+)
+
+// DefaultHashBuckets is the default amount of buckets release names
+// are hashed into.
+const DefaultHashBuckets = 64
+
+// ReleaseLabels configures the release name label of metrics.
+type ReleaseLabels struct {
+	Mode ReleaseLabelMode
+	// HashBuckets is the amount of buckets release names are hashed
+	// into with the hashed mode.
+	HashBuckets int
+	// Allowlist holds the releases which keep their release name
+	// label, as `<target namespace>/<release name>` patterns, i.e.
+	// `prod/*`.
+	Allowlist []string
+}
+
+// Validate returns an error if the mode or the allowlist are invalid.
+func (l ReleaseLabels) Validate() error {
+	switch l.Mode {
+	case "", ReleaseLabelFull, ReleaseLabelNamespace:
+	case ReleaseLabelHashed:
+		if l.HashBuckets <= 0 {
+			return fmt.Errorf("the amount of hash buckets must be positive")
+		}
+	default:
+		return fmt.Errorf("unknown release label mode '%s'", l.Mode)
+	}
+	for _, p := range l.Allowlist {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid release allowlist pattern '%s': %w", p, err)
+		}
+	}
+	return nil
+}
+
+var (
+	mu        sync.RWMutex
+	installed = ReleaseLabels{Mode: ReleaseLabelFull}
+)
+
+// Install sets the release labels configuration used by all metrics.
+func Install(l ReleaseLabels) {
+	mu.Lock()
+	defer mu.Unlock()
+	installed = l
+}
+
+// ReleaseName returns the value of the release name label for the
+// given release in the target namespace.
+func ReleaseName(targetNamespace, releaseName string) string {
+	mu.RLock()
+	l := installed
+	mu.RUnlock()
+	if l.fineGrained(targetNamespace, releaseName) {
+		return releaseName
+	}
+	if l.Mode == ReleaseLabelHashed {
+		h := fnv.New32a()
+		h.Write([]byte(releaseName))
+		return fmt.Sprintf("bucket-%d", h.Sum32()%uint32(l.HashBuckets))
+	}
+	return ""
+}
+
+// FineGrained returns if metrics of the given release are labeled
+// with its release name. Metrics which can not be aggregated, like
+// the images of a release, are only recorded for these.
+func FineGrained(targetNamespace, releaseName string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return installed.fineGrained(targetNamespace, releaseName)
+}
+
+func (l ReleaseLabels) fineGrained(targetNamespace, releaseName string) bool {
+	if l.Mode == "" || l.Mode == ReleaseLabelFull {
+		return true
+	}
+	for _, p := range l.Allowlist {
+		if ok, _ := path.Match(p, targetNamespace+"/"+releaseName); ok {
+			return true
+		}
+	}
+	return false
+}
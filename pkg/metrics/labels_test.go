@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReleaseName(t *testing.T) {
+	defer Install(ReleaseLabels{Mode: ReleaseLabelFull})
+
+	assert.Equal(t, "podinfo", ReleaseName("default", "podinfo"))
+
+	Install(ReleaseLabels{Mode: ReleaseLabelNamespace, Allowlist: []string{"prod/*"}})
+	assert.Equal(t, "", ReleaseName("default", "podinfo"))
+	assert.False(t, FineGrained("default", "podinfo"))
+	assert.Equal(t, "podinfo", ReleaseName("prod", "podinfo"))
+	assert.True(t, FineGrained("prod", "podinfo"))
+
+	Install(ReleaseLabels{Mode: ReleaseLabelHashed, HashBuckets: 4})
+	bucket := ReleaseName("default", "podinfo")
+	assert.Regexp(t, "^bucket-[0-3]$", bucket)
+	assert.Equal(t, bucket, ReleaseName("other", "podinfo"))
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, ReleaseLabels{Mode: ReleaseLabelNamespace, Allowlist: []string{"prod/*"}}.Validate())
+	assert.Error(t, ReleaseLabels{Mode: "release"}.Validate())
+	assert.Error(t, ReleaseLabels{Mode: ReleaseLabelHashed}.Validate())
+	assert.Error(t, ReleaseLabels{Mode: ReleaseLabelFull, Allowlist: []string{"prod/["}}.Validate())
+}
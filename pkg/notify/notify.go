@@ -0,0 +1,315 @@
+/*
+Package notify sends notifications of the lifecycle events of releases,
+i.e. installs, upgrades, rollbacks, failures and detected drift, to
+chat and alerting systems: generic webhooks, Slack, DingTalk and WeCom
+(WeChat Work). It is meant for teams that want to be alerted without
+running Prometheus.
+
+Sinks are configured statically, or in the `sinks` key of a ConfigMap
+which is read on every notification, so sinks can be changed without
+restarting the operator:
+
+  - type: slack
+    url: https://hooks.slack.com/services/...
+    events: [failed, rolledBack]
+    namespaces: [prod]
+
+Notifications are delivered on a best effort basis: they are queued in
+memory, and dropped if the queue is full or the delivery fails. Failures
+and detected drift are only notified once until the release transitions,
+i.e. until an event of another type or with another message is notified
+for the HelmRelease, as they are detected again on every sync.
+*/
+package notify
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// EventType is the type of a release lifecycle event.
+type EventType string
+
+const (
+	Installed     EventType = "installed"
+	Upgraded      EventType = "upgraded"
+	RolledBack    EventType = "rolledBack"
+	Failed        EventType = "failed"
+	DriftDetected EventType = "driftDetected"
+)
+
+// SinksKey is the key of the ConfigMap holding the sinks.
+const SinksKey = "sinks"
+
+// Event is a release lifecycle event, as posted to generic webhooks.
+type Event struct {
+	Type      EventType `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	// Namespace and Name are those of the HelmRelease.
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// ReleaseName and TargetNamespace are those of the Helm release.
+	ReleaseName     string `json:"releaseName"`
+	TargetNamespace string `json:"targetNamespace"`
+	// Revision is the revision of the Helm release, if any.
+	Revision     int    `json:"revision,omitempty"`
+	ChartName    string `json:"chartName,omitempty"`
+	ChartVersion string `json:"chartVersion,omitempty"`
+	Message      string `json:"message,omitempty"`
+}
+
+// Text returns the event as a single line of text, for chat sinks.
+func (e Event) Text() string {
+	text := fmt.Sprintf("[%s] HelmRelease %s/%s", e.Type, e.Namespace, e.Name)
+	if e.ChartName != "" {
+		text += fmt.Sprintf(" (%s %s", e.ChartName, e.ChartVersion)
+		if e.Revision > 0 {
+			text += fmt.Sprintf(", revision %d", e.Revision)
+		}
+		text += ")"
+	}
+	if e.Message != "" {
+		text += ": " + e.Message
+	}
+	return text
+}
+
+// SinkType is the type of a sink.
+type SinkType string
+
+const (
+	SinkWebhook  SinkType = "webhook"
+	SinkSlack    SinkType = "slack"
+	SinkDingTalk SinkType = "dingtalk"
+	SinkWeCom    SinkType = "wecom"
+)
+
+// SinkConfig configures a sink notifications are sent to.
+type SinkConfig struct {
+	Type SinkType `json:"type"`
+	URL  string   `json:"url"`
+	// Secret signs the notifications of DingTalk robots with
+	// signing enabled.
+	Secret string `json:"secret,omitempty"`
+	// Events are the types of events sent to the sink; all events are
+	// sent if empty.
+	Events []EventType `json:"events,omitempty"`
+	// Namespaces are the namespaces of the HelmReleases the events of
+	// which are sent to the sink; events of all namespaces are sent if
+	// empty.
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// Validate returns an error if the sink is not valid.
+func (c SinkConfig) Validate() error {
+	switch c.Type {
+	case SinkWebhook, SinkSlack, SinkDingTalk, SinkWeCom:
+	default:
+		return fmt.Errorf("unsupported sink type '%s'", c.Type)
+	}
+	if c.URL == "" {
+		return fmt.Errorf("%s sink has no URL", c.Type)
+	}
+	return nil
+}
+
+// accepts returns if the event is sent to the sink.
+func (c SinkConfig) accepts(e Event) bool {
+	if len(c.Events) > 0 {
+		var ok bool
+		for _, t := range c.Events {
+			ok = ok || t == e.Type
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(c.Namespaces) > 0 {
+		for _, ns := range c.Namespaces {
+			if ns == e.Namespace {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Config holds the configuration of the Notifier.
+type Config struct {
+	// Sinks are the statically configured sinks.
+	Sinks []SinkConfig
+	// ConfigMapNamespace and ConfigMapName identify the ConfigMap
+	// holding additional sinks, if any.
+	ConfigMapNamespace string
+	ConfigMapName      string
+	// Timeout is the timeout of a single delivery.
+	Timeout time.Duration
+	// QueueSize is the amount of notifications queued for delivery.
+	QueueSize int
+}
+
+// WithDefaults sets the default values for the notifier config.
+func (c Config) WithDefaults() Config {
+	if c.Timeout == 0 {
+		c.Timeout = 10 * time.Second
+	}
+	if c.QueueSize == 0 {
+		c.QueueSize = 100
+	}
+	return c
+}
+
+// Notifier sends the release lifecycle events to the sinks.
+type Notifier struct {
+	config Config
+	client corev1client.ConfigMapsGetter
+	http   *http.Client
+	logger log.Logger
+	queue  chan Event
+
+	mu sync.Mutex
+	// last holds the digest of the last repeating event notified for
+	// each HelmRelease, by namespace and name
+	last map[string]string
+}
+
+// NewNotifier returns a new Notifier. The client is only used to read
+// the sinks of the ConfigMap, and may be nil if none is configured.
+func NewNotifier(config Config, client corev1client.ConfigMapsGetter, logger log.Logger) (*Notifier, error) {
+	config = config.WithDefaults()
+	for _, s := range config.Sinks {
+		if err := s.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if config.ConfigMapName != "" && client == nil {
+		return nil, fmt.Errorf("a client is required to read the sinks of a ConfigMap")
+	}
+	return &Notifier{
+		config: config,
+		client: client,
+		http:   &http.Client{Timeout: config.Timeout},
+		logger: logger,
+		queue:  make(chan Event, config.QueueSize),
+		last:   make(map[string]string),
+	}, nil
+}
+
+// Notify queues the given event for delivery to the sinks. The
+// timestamp of the event is set if empty. The event is dropped if the
+// queue is full, or if it repeats the last notified failure or drift
+// of the HelmRelease.
+func (n *Notifier) Notify(e Event) {
+	if n.repeated(e) {
+		return
+	}
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now().UTC()
+	}
+	select {
+	case n.queue <- e:
+	default:
+		n.logger.Log("warning", fmt.Sprintf("dropping %s notification of HelmRelease '%s/%s', the queue is full", e.Type, e.Namespace, e.Name))
+	}
+}
+
+// repeated returns if the given event is a failure or drift equal to
+// the last one notified for the HelmRelease, and records it otherwise.
+// Any other event resets the record of the HelmRelease.
+func (n *Notifier) repeated(e Event) bool {
+	key := e.Namespace + "/" + e.Name
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	switch e.Type {
+	case Failed, DriftDetected:
+	default:
+		delete(n.last, key)
+		return false
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%s\x00%s\x00%s", e.Type, e.Revision, e.ChartName, e.ChartVersion, e.Message)))
+	digest := hex.EncodeToString(sum[:])
+	if n.last[key] == digest {
+		return true
+	}
+	n.last[key] = digest
+	return false
+}
+
+// Run delivers the queued events until stop is closed.
+func (n *Notifier) Run(stop <-chan struct{}, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			case e := <-n.queue:
+				n.deliver(e)
+			}
+		}
+	}()
+}
+
+// deliver sends the event to every sink accepting it.
+func (n *Notifier) deliver(e Event) {
+	sinks, err := n.sinks()
+	if err != nil {
+		n.logger.Log("warning", err)
+	}
+	for _, s := range sinks {
+		if !s.accepts(e) {
+			continue
+		}
+		if err := send(n.http, s, e); err != nil {
+			n.logger.Log("warning", fmt.Sprintf("failed to send %s notification of HelmRelease '%s/%s': %v", e.Type, e.Namespace, e.Name, err), "sink", s.Type)
+		}
+	}
+}
+
+// sinks returns the static sinks and those of the ConfigMap. The
+// static sinks are returned along with an error if the sinks of the
+// ConfigMap can not be read.
+func (n *Notifier) sinks() ([]SinkConfig, error) {
+	sinks := n.config.Sinks
+	if n.config.ConfigMapName == "" {
+		return sinks, nil
+	}
+	cm, err := n.client.ConfigMaps(n.config.ConfigMapNamespace).Get(n.config.ConfigMapName, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		return sinks, nil
+	case err != nil:
+		return sinks, fmt.Errorf("failed to retrieve notification ConfigMap '%s/%s': %w", n.config.ConfigMapNamespace, n.config.ConfigMapName, err)
+	}
+	cmSinks, err := ParseSinks([]byte(cm.Data[SinksKey]))
+	if err != nil {
+		return sinks, fmt.Errorf("invalid sinks in notification ConfigMap '%s/%s': %w", n.config.ConfigMapNamespace, n.config.ConfigMapName, err)
+	}
+	return append(append([]SinkConfig{}, sinks...), cmSinks...), nil
+}
+
+// ParseSinks parses the given YAML list of sinks.
+func ParseSinks(b []byte) ([]SinkConfig, error) {
+	var sinks []SinkConfig
+	if err := yaml.Unmarshal(b, &sinks); err != nil {
+		return nil, err
+	}
+	for _, s := range sinks {
+		if err := s.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return sinks, nil
+}
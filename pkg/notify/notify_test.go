@@ -0,0 +1,127 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSend(t *testing.T) {
+	e := Event{Type: Upgraded, Namespace: "flux", Name: "podinfo", Revision: 3, ChartName: "podinfo", ChartVersion: "1.2.0", Message: "upgrade succeeded"}
+	text := "[upgraded] HelmRelease flux/podinfo (podinfo 1.2.0, revision 3): upgrade succeeded"
+	assert.Equal(t, text, e.Text())
+
+	for _, tc := range []struct {
+		sinkType SinkType
+		expected string
+	}{
+		{SinkWebhook, `"type":"upgraded"`},
+		{SinkSlack, `{"text":"` + text + `"}`},
+		{SinkDingTalk, `{"msgtype":"text","text":{"content":"` + text + `"}}`},
+		{SinkWeCom, `{"msgtype":"text","text":{"content":"` + text + `"}}`},
+	} {
+		t.Run(string(tc.sinkType), func(t *testing.T) {
+			var body string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var payload json.RawMessage
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+				body = string(payload)
+				w.Write([]byte(`{"errcode":0}`))
+			}))
+			defer srv.Close()
+
+			assert.NoError(t, send(srv.Client(), SinkConfig{Type: tc.sinkType, URL: srv.URL}, e))
+			assert.Contains(t, body, tc.expected)
+		})
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"errcode":310000,"errmsg":"sign not match"}`))
+	}))
+	defer srv.Close()
+	assert.EqualError(t, send(srv.Client(), SinkConfig{Type: SinkDingTalk, URL: srv.URL}, e), "sink responded with error 310000: sign not match")
+}
+
+func TestSignDingTalk(t *testing.T) {
+	signed, err := signDingTalk("https://oapi.dingtalk.com/robot/send?access_token=abc", "SEC123", time.Unix(1600000000, 0))
+	assert.NoError(t, err)
+	u, err := url.Parse(signed)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", u.Query().Get("access_token"))
+	assert.Equal(t, "1600000000000", u.Query().Get("timestamp"))
+	assert.NotEmpty(t, u.Query().Get("sign"))
+}
+
+func TestSinkAccepts(t *testing.T) {
+	s := SinkConfig{Type: SinkSlack, URL: "http://slack", Events: []EventType{Failed}, Namespaces: []string{"prod"}}
+	assert.True(t, s.accepts(Event{Type: Failed, Namespace: "prod"}))
+	assert.False(t, s.accepts(Event{Type: Upgraded, Namespace: "prod"}))
+	assert.False(t, s.accepts(Event{Type: Failed, Namespace: "dev"}))
+	assert.True(t, SinkConfig{}.accepts(Event{Type: Upgraded, Namespace: "dev"}))
+}
+
+func TestNotifierConfigMapSinks(t *testing.T) {
+	var mu sync.Mutex
+	received := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		received[r.URL.Path]++
+	}))
+	defer srv.Close()
+
+	client := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "flux", Name: "notifications"},
+		Data: map[string]string{SinksKey: `
+- type: webhook
+  url: ` + srv.URL + `/configmap
+  events: [failed]
+`},
+	})
+	n, err := NewNotifier(Config{
+		Sinks:              []SinkConfig{{Type: SinkWebhook, URL: srv.URL + "/static"}},
+		ConfigMapNamespace: "flux",
+		ConfigMapName:      "notifications",
+	}, client.CoreV1(), log.NewNopLogger())
+	assert.NoError(t, err)
+
+	n.deliver(Event{Type: Failed, Namespace: "flux", Name: "podinfo"})
+	n.deliver(Event{Type: Installed, Namespace: "flux", Name: "podinfo"})
+	assert.Equal(t, map[string]int{"/static": 2, "/configmap": 1}, received)
+
+	_, err = NewNotifier(Config{Sinks: []SinkConfig{{Type: "pager", URL: srv.URL}}}, nil, log.NewNopLogger())
+	assert.Error(t, err)
+	_, err = ParseSinks([]byte(`[{"type": "slack"}]`))
+	assert.Error(t, err)
+}
+
+func TestNotifyRepeated(t *testing.T) {
+	n, err := NewNotifier(Config{}, nil, log.NewNopLogger())
+	assert.NoError(t, err)
+
+	failed := Event{Type: Failed, Namespace: "flux", Name: "podinfo", Message: "upgrade failed"}
+	n.Notify(failed)
+	n.Notify(failed)
+	n.Notify(Event{Type: Failed, Namespace: "flux", Name: "nginx", Message: "upgrade failed"})
+	assert.Len(t, n.queue, 2)
+
+	// a failure with another message is a transition
+	n.Notify(Event{Type: Failed, Namespace: "flux", Name: "podinfo", Message: "rollback failed"})
+	assert.Len(t, n.queue, 3)
+
+	// as is any other event
+	n.Notify(Event{Type: Upgraded, Namespace: "flux", Name: "podinfo", Message: "upgrade succeeded"})
+	n.Notify(failed)
+	n.Notify(Event{Type: Upgraded, Namespace: "flux", Name: "podinfo", Message: "upgrade succeeded"})
+	assert.Len(t, n.queue, 6)
+}
@@ -0,0 +1,91 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// send posts the event to the sink, in the format of its type.
+func send(client *http.Client, s SinkConfig, e Event) error {
+	u := s.URL
+	var payload interface{}
+	switch s.Type {
+	case SinkWebhook:
+		payload = e
+	case SinkSlack:
+		payload = map[string]string{"text": e.Text()}
+	case SinkDingTalk:
+		if s.Secret != "" {
+			signed, err := signDingTalk(u, s.Secret, time.Now())
+			if err != nil {
+				return err
+			}
+			u = signed
+		}
+		payload = textMessage(e)
+	case SinkWeCom:
+		payload = textMessage(e)
+	default:
+		return fmt.Errorf("unsupported sink type '%s'", s.Type)
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(u, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return fmt.Errorf("sink responded with status %d", resp.StatusCode)
+	}
+	if s.Type == SinkDingTalk || s.Type == SinkWeCom {
+		// both respond with a 200 status and an error code
+		var result struct {
+			ErrCode int    `json:"errcode"`
+			ErrMsg  string `json:"errmsg"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err == nil && result.ErrCode != 0 {
+			return fmt.Errorf("sink responded with error %d: %s", result.ErrCode, result.ErrMsg)
+		}
+	}
+	return nil
+}
+
+// textMessage returns the text message of the event, in the format of
+// the robots of both DingTalk and WeCom.
+func textMessage(e Event) interface{} {
+	return map[string]interface{}{
+		"msgtype": "text",
+		"text":    map[string]string{"content": e.Text()},
+	}
+}
+
+// signDingTalk returns the URL of a DingTalk robot signed with the
+// given secret at the given time.
+func signDingTalk(rawURL, secret string, t time.Time) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	timestamp := strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + secret))
+	q := u.Query()
+	q.Set("timestamp", timestamp)
+	q.Set("sign", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
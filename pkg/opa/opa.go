@@ -0,0 +1,115 @@
+/*
+Package opa evaluates decisions of an Open Policy Agent server through
+its Data API (https://www.openpolicyagent.org/docs/latest/rest-api/),
+to check the manifests of releases against Rego policies loaded into
+the server.
+
+A decision is queried by posting the input to `/v1/data/<decision>`.
+The decision is expected to result in the violations of the input,
+either as a list of messages or of objects with a `msg`, e.g. a set of
+`deny` rules:
+
+  package helm
+
+  deny[msg] {
+    obj := input.manifests[_]
+    obj.kind == "ClusterRoleBinding"
+    msg := sprintf("%s may not be released", [obj.metadata.name])
+  }
+
+An undefined decision, or one resulting in `true`, has no violations;
+a decision resulting in `false` is a single violation.
+*/
+package opa
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client queries the decisions of an OPA server.
+type Client struct {
+	url  string
+	http *http.Client
+}
+
+// New returns a client for the OPA server at the given URL, e.g.
+// `http://opa:8181`, with the given request timeout.
+func New(serverURL string, timeout time.Duration) (*Client, error) {
+	if u, err := url.Parse(serverURL); err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid OPA URL '%s'", serverURL)
+	}
+	return &Client{url: strings.TrimSuffix(serverURL, "/"), http: &http.Client{Timeout: timeout}}, nil
+}
+
+// Evaluate queries the decision at the given path, e.g. `helm/deny`,
+// with the input, and returns the messages of the violations it
+// results in.
+func (c *Client) Evaluate(decision string, input interface{}) ([]string, error) {
+	body, err := json.Marshal(map[string]interface{}{"input": input})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Post(c.url+"/v1/data/"+strings.Trim(decision, "/"), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Message string `json:"message"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&e) == nil && e.Message != "" {
+			return nil, fmt.Errorf("OPA responded with status '%s': %s", resp.Status, e.Message)
+		}
+		return nil, fmt.Errorf("OPA responded with status '%s'", resp.Status)
+	}
+
+	var out struct {
+		Result *json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("failed to decode OPA response: %w", err)
+	}
+	if out.Result == nil {
+		return nil, nil
+	}
+	return violations(decision, *out.Result)
+}
+
+// violations returns the messages of the violations in the result of
+// a decision.
+func violations(decision string, result json.RawMessage) ([]string, error) {
+	var allowed bool
+	if err := json.Unmarshal(result, &allowed); err == nil {
+		if allowed {
+			return nil, nil
+		}
+		return []string{fmt.Sprintf("denied by %s", decision)}, nil
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(result, &items); err != nil {
+		return nil, errors.New("decision does not result in a list of violations")
+	}
+	var out []string
+	for _, item := range items {
+		var msg string
+		if err := json.Unmarshal(item, &msg); err != nil {
+			var obj struct {
+				Msg string `json:"msg"`
+			}
+			if err := json.Unmarshal(item, &obj); err != nil || obj.Msg == "" {
+				return nil, errors.New("violations must be messages, or objects with a msg")
+			}
+			msg = obj.Msg
+		}
+		out = append(out, msg)
+	}
+	return out, nil
+}
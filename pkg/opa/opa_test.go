@@ -0,0 +1,62 @@
+package opa
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluate(t *testing.T) {
+	var inputs []interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input interface{} `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		inputs = append(inputs, req.Input)
+		switch r.URL.Path {
+		case "/v1/data/helm/undefined":
+			w.Write([]byte(`{}`))
+		case "/v1/data/helm/allow":
+			w.Write([]byte(`{"result":true}`))
+		case "/v1/data/helm/deny":
+			w.Write([]byte(`{"result":false}`))
+		case "/v1/data/helm/messages":
+			w.Write([]byte(`{"result":["no ClusterRoles"]}`))
+		case "/v1/data/helm/objects":
+			w.Write([]byte(`{"result":[{"msg":"no host network"}]}`))
+		case "/v1/data/helm/invalid":
+			w.Write([]byte(`{"result":{"deny":1}}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":"invalid_parameter","message":"error(s) occurred while evaluating query"}`))
+		}
+	}))
+	defer server.Close()
+
+	client, err := New(server.URL+"/", 0)
+	assert.NoError(t, err)
+	for decision, want := range map[string][]string{
+		"helm/undefined": nil,
+		"helm/allow":     nil,
+		"/helm/deny":     {"denied by /helm/deny"},
+		"helm/messages":  {"no ClusterRoles"},
+		"helm/objects":   {"no host network"},
+	} {
+		violations, err := client.Evaluate(decision, map[string]string{"kind": "ClusterRole"})
+		assert.NoError(t, err, decision)
+		assert.Equal(t, want, violations, decision)
+	}
+	assert.Equal(t, map[string]interface{}{"kind": "ClusterRole"}, inputs[0])
+
+	_, err = client.Evaluate("helm/invalid", nil)
+	assert.Error(t, err)
+	_, err = client.Evaluate("helm/error", nil)
+	assert.EqualError(t, err, "OPA responded with status '400 Bad Request': error(s) occurred while evaluating query")
+
+	_, err = New("opa:8181", 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,143 @@
+package operator
+
+import (
+	"fmt"
+	"strings"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+
+	helmfluxv1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+// dependsOnIndex is the name of the index of the HelmReleases by the
+// keys of the HelmReleases they depend on.
+const dependsOnIndex = "dependsOn"
+
+// dependencyKey returns the namespace/name key of the HelmRelease the
+// given HelmRelease depends on with the reference.
+func dependencyKey(hr *helmfluxv1.HelmRelease, dep helmfluxv1.ObjectReference) string {
+	namespace := dep.Namespace
+	if namespace == "" {
+		namespace = hr.Namespace
+	}
+	return namespace + "/" + dep.Name
+}
+
+// indexDependsOn indexes a HelmRelease by the keys of its dependencies.
+func indexDependsOn(obj interface{}) ([]string, error) {
+	hr, ok := obj.(*helmfluxv1.HelmRelease)
+	if !ok {
+		return nil, nil
+	}
+	keys := make([]string, 0, len(hr.Spec.DependsOn))
+	for _, dep := range hr.Spec.DependsOn {
+		keys = append(keys, dependencyKey(hr, dep))
+	}
+	return keys, nil
+}
+
+// checkDependencies returns an error if the dependencies of the given
+// HelmRelease form a cycle, or for the first dependency which has not
+// been released successfully for its current generation.
+func (c *Controller) checkDependencies(hr *helmfluxv1.HelmRelease) error {
+	if cycle := c.dependencyCycle(hr); cycle != nil {
+		return fmt.Errorf("dependency cycle %s", strings.Join(cycle, " -> "))
+	}
+	for _, dep := range hr.Spec.DependsOn {
+		key := dependencyKey(hr, dep)
+		depHr, err := c.getHelmRelease(key)
+		if err != nil {
+			if k8serrors.IsNotFound(err) {
+				return fmt.Errorf("dependency '%s' does not exist", key)
+			}
+			return err
+		}
+		if !dependencyReady(depHr) {
+			return fmt.Errorf("dependency '%s' is not ready", key)
+		}
+	}
+	return nil
+}
+
+// dependencyCycle returns the keys of the HelmReleases on a path from
+// the given HelmRelease through its dependencies back to itself, or
+// nil if there is none. Dependencies which do not exist end a path,
+// they are reported as not ready instead.
+func (c *Controller) dependencyCycle(hr *helmfluxv1.HelmRelease) []string {
+	start := hr.Namespace + "/" + hr.Name
+	visited := make(map[string]bool)
+	var visit func(hr *helmfluxv1.HelmRelease, path []string) []string
+	visit = func(hr *helmfluxv1.HelmRelease, path []string) []string {
+		for _, dep := range hr.Spec.DependsOn {
+			key := dependencyKey(hr, dep)
+			if key == start {
+				return append(path, key)
+			}
+			if visited[key] {
+				continue
+			}
+			visited[key] = true
+			depHr, err := c.getHelmRelease(key)
+			if err != nil {
+				continue
+			}
+			if cycle := visit(depHr, append(path[:len(path):len(path)], key)); cycle != nil {
+				return cycle
+			}
+		}
+		return nil
+	}
+	return visit(hr, []string{start})
+}
+
+// getHelmRelease returns the HelmRelease with the given namespace/name
+// key from the lister.
+func (c *Controller) getHelmRelease(key string) (*helmfluxv1.HelmRelease, error) {
+	namespace, name := key, ""
+	if i := strings.Index(key, "/"); i >= 0 {
+		namespace, name = key[:i], key[i+1:]
+	}
+	return c.hrLister.HelmReleases(namespace).Get(name)
+}
+
+// dependencyReady returns if the given HelmRelease has been released
+// successfully for its current generation.
+func dependencyReady(hr *helmfluxv1.HelmRelease) bool {
+	if !status.HasSynced(hr) {
+		return false
+	}
+	switch hr.Status.Phase {
+	case helmfluxv1.HelmReleasePhaseSucceeded, helmfluxv1.HelmReleasePhaseDeployed, helmfluxv1.HelmReleasePhaseTested:
+		return true
+	}
+	return false
+}
+
+// enqueueDependents enqueues the HelmReleases depending on the given
+// HelmRelease once it is ready, so they do not have to wait for the
+// back-off to expire.
+func (c *Controller) enqueueDependents(hr *helmfluxv1.HelmRelease) {
+	if !dependencyReady(hr) || c.hrIndexer == nil {
+		return
+	}
+	dependents, err := c.hrIndexer.ByIndex(dependsOnIndex, hr.Namespace+"/"+hr.Name)
+	if err != nil {
+		c.logger.Log("error", fmt.Sprintf("failed to look up the dependents of HelmRelease '%s/%s': %v", hr.Namespace, hr.Name, err))
+		return
+	}
+	for _, obj := range dependents {
+		dependent, ok := obj.(*helmfluxv1.HelmRelease)
+		if !ok || !c.shard.Owns(dependent) {
+			continue
+		}
+		key, err := getCacheKey(dependent)
+		if err != nil {
+			continue
+		}
+		// added without rate limiting, which would delay it by the
+		// back-off of the failed dependency checks
+		c.releaseWorkqueue.Add(key)
+		releaseQueueLength.Set(float64(c.releaseWorkqueue.Len()))
+	}
+}
@@ -0,0 +1,105 @@
+package operator
+
+import (
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	helmfluxv1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	iflister "github.com/lstack-org/helm-operator/pkg/client/listers/helm.fluxcd.io/v1"
+)
+
+func newTestController(t *testing.T, hrs ...*helmfluxv1.HelmRelease) *Controller {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{dependsOnIndex: indexDependsOn})
+	for _, hr := range hrs {
+		assert.NoError(t, indexer.Add(hr))
+	}
+	return &Controller{
+		logger:           log.NewNopLogger(),
+		hrLister:         iflister.NewHelmReleaseLister(indexer),
+		hrIndexer:        indexer,
+		releaseWorkqueue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "test"),
+	}
+}
+
+func dependingHelmRelease(namespace, name string, deps ...helmfluxv1.ObjectReference) *helmfluxv1.HelmRelease {
+	hr := newHelmRelease(namespace, name, nil)
+	hr.Spec.DependsOn = deps
+	return hr
+}
+
+func dependency(namespace, name string) helmfluxv1.ObjectReference {
+	return helmfluxv1.ObjectReference{LocalObjectReference: helmfluxv1.LocalObjectReference{Name: name}, Namespace: namespace}
+}
+
+func readyHelmRelease(hr *helmfluxv1.HelmRelease) *helmfluxv1.HelmRelease {
+	hr.Generation = 1
+	hr.Status.ObservedGeneration = 1
+	hr.Status.Phase = helmfluxv1.HelmReleasePhaseDeployed
+	return hr
+}
+
+func TestCheckDependencies(t *testing.T) {
+	c := newTestController(t,
+		readyHelmRelease(dependingHelmRelease("infra", "database")),
+		dependingHelmRelease("infra", "cache"),
+		dependingHelmRelease("apps", "a", dependency("", "b")),
+		dependingHelmRelease("apps", "b", dependency("apps", "c")),
+		dependingHelmRelease("apps", "c", dependency("", "a")),
+		dependingHelmRelease("apps", "d", dependency("", "a")),
+	)
+
+	for _, tc := range []struct {
+		name    string
+		hr      *helmfluxv1.HelmRelease
+		wantErr string
+	}{
+		{name: "ready", hr: dependingHelmRelease("apps", "web", dependency("infra", "database"))},
+		{name: "not ready", hr: dependingHelmRelease("apps", "web", dependency("infra", "cache")),
+			wantErr: "dependency 'infra/cache' is not ready"},
+		{name: "missing", hr: dependingHelmRelease("apps", "web", dependency("", "database")),
+			wantErr: "dependency 'apps/database' does not exist"},
+		{name: "itself", hr: dependingHelmRelease("apps", "web", dependency("", "web")),
+			wantErr: "dependency cycle apps/web -> apps/web"},
+		{name: "cycle", hr: dependingHelmRelease("apps", "a", dependency("", "b")),
+			wantErr: "dependency cycle apps/a -> apps/b -> apps/c -> apps/a"},
+		{name: "depending on a cycle", hr: dependingHelmRelease("apps", "d", dependency("", "a")),
+			wantErr: "dependency 'apps/a' is not ready"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := c.checkDependencies(tc.hr)
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestEnqueueDependents(t *testing.T) {
+	database := readyHelmRelease(dependingHelmRelease("infra", "database"))
+	c := newTestController(t,
+		database,
+		dependingHelmRelease("infra", "cache"),
+		dependingHelmRelease("apps", "web", dependency("infra", "database")),
+		dependingHelmRelease("apps", "api", dependency("infra", "database"), dependency("infra", "cache")),
+		dependingHelmRelease("infra", "backup", dependency("", "database")),
+		dependingHelmRelease("other", "web", dependency("", "database")),
+	)
+
+	c.enqueueDependents(dependingHelmRelease("infra", "cache"))
+	assert.Equal(t, 0, c.releaseWorkqueue.Len())
+
+	c.enqueueDependents(database)
+	var keys []string
+	for c.releaseWorkqueue.Len() > 0 {
+		key, _ := c.releaseWorkqueue.Get()
+		keys = append(keys, key.(string))
+		c.releaseWorkqueue.Done(key)
+	}
+	assert.ElementsMatch(t, []string{"apps/web", "apps/api", "infra/backup"}, keys)
+}
@@ -0,0 +1,107 @@
+package operator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// serviceAccountNamespaceFile holds the namespace of the pod the
+// operator runs in.
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// LeaderElectionConfig holds the configuration for the leader
+// election between operator replicas.
+type LeaderElectionConfig struct {
+	// Namespace and Name of the Lease used as lock. The namespace
+	// defaults to the namespace the operator runs in.
+	Namespace string
+	Name      string
+	// LeaseDuration is the duration non-leader replicas wait before
+	// attempting to acquire leadership of an unrenewed lease.
+	LeaseDuration time.Duration
+	// RenewDeadline is the duration the leader retries renewing the
+	// lease before giving up leadership.
+	RenewDeadline time.Duration
+	// RetryPeriod is the duration between attempts to acquire or
+	// renew the lease.
+	RetryPeriod time.Duration
+}
+
+// RunWithLeaderElection blocks until leadership is acquired, and then
+// runs the given function. It returns an error when leadership is
+// lost, upon which the operator should exit to not process releases
+// concurrently with the new leader, and nil when stopCh is closed.
+func RunWithLeaderElection(kubeClient kubernetes.Interface, config LeaderElectionConfig, logger log.Logger,
+	stopCh <-chan struct{}, run func(stop <-chan struct{})) error {
+
+	namespace := config.Namespace
+	if namespace == "" {
+		b, err := ioutil.ReadFile(serviceAccountNamespaceFile)
+		if err != nil {
+			return fmt.Errorf("unable to determine leader election namespace: %w", err)
+		}
+		namespace = strings.TrimSpace(string(b))
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("unable to determine leader election identity: %w", err)
+	}
+	identity := hostname + "_" + string(uuid.NewUUID())
+
+	lock, err := resourcelock.New(resourcelock.LeasesResourceLock, namespace, config.Name,
+		kubeClient.CoreV1(), kubeClient.CoordinationV1(), resourcelock.ResourceLockConfig{Identity: identity})
+	if err != nil {
+		return fmt.Errorf("failed to create leader election lock: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	logger.Log("info", fmt.Sprintf("waiting for leadership of lease %s/%s", namespace, config.Name), "identity", identity)
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   config.LeaseDuration,
+		RenewDeadline:   config.RenewDeadline,
+		RetryPeriod:     config.RetryPeriod,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				logger.Log("info", "acquired leadership", "identity", identity)
+				run(ctx.Done())
+			},
+			OnStoppedLeading: func() {
+				logger.Log("info", "stopped leading", "identity", identity)
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					logger.Log("info", "new leader elected", "leader", leader)
+				}
+			},
+		},
+	})
+
+	select {
+	case <-stopCh:
+		return nil
+	default:
+		return errors.New("lost leadership")
+	}
+}
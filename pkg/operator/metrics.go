@@ -1,8 +1,14 @@
 package operator
 
 import (
+	"github.com/go-kit/kit/metrics"
 	"github.com/go-kit/kit/metrics/prometheus"
 	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	LabelQueue = "queue"
 )
 
 var (
@@ -18,4 +24,114 @@ var (
 		Name:      "release_count",
 		Help:      "Count of releases managed by the operator.",
 	}, []string{})
+	releaseSyncPanics = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "release_sync_panics_total",
+		Help:      "Count of release syncs the operator recovered from a panic in.",
+	}, []string{})
+
+	queueDurationBuckets = []float64{0.01, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 600, 1800}
+	workqueueDepth       = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "workqueue_depth",
+		Help:      "Count of items waiting in the workqueue, by queue.",
+	}, []string{LabelQueue})
+	workqueueAdds = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "workqueue_adds_total",
+		Help:      "Count of items added to the workqueue, by queue.",
+	}, []string{LabelQueue})
+	workqueueLatency = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "workqueue_queue_duration_seconds",
+		Help:      "Duration in seconds items wait in the workqueue before being processed, by queue.",
+		Buckets:   queueDurationBuckets,
+	}, []string{LabelQueue})
+	workqueueWorkDuration = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "workqueue_work_duration_seconds",
+		Help:      "Duration in seconds of processing items from the workqueue, by queue.",
+		Buckets:   queueDurationBuckets,
+	}, []string{LabelQueue})
+	workqueueUnfinishedWork = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "workqueue_unfinished_work_seconds",
+		Help:      "Sum of the seconds the items in progress have been processed for, by queue.",
+	}, []string{LabelQueue})
+	workqueueLongestRunningProcessor = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "workqueue_longest_running_processor_seconds",
+		Help:      "Seconds the longest running item in progress has been processed for, by queue.",
+	}, []string{LabelQueue})
+	workqueueRetries = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "workqueue_retries_total",
+		Help:      "Count of items requeued with a rate limit, by queue.",
+	}, []string{LabelQueue})
 )
+
+func init() {
+	workqueue.SetProvider(workqueueMetricsProvider{})
+}
+
+// workqueueMetricsProvider provides the metrics of named workqueues,
+// labeled by the name of the queue.
+type workqueueMetricsProvider struct{}
+
+func (workqueueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return gaugeMetric{workqueueDepth.With(LabelQueue, name)}
+}
+
+func (workqueueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return counterMetric{workqueueAdds.With(LabelQueue, name)}
+}
+
+func (workqueueMetricsProvider) NewLatencyMetric(name string) workqueue.HistogramMetric {
+	return workqueueLatency.With(LabelQueue, name)
+}
+
+func (workqueueMetricsProvider) NewWorkDurationMetric(name string) workqueue.HistogramMetric {
+	return workqueueWorkDuration.With(LabelQueue, name)
+}
+
+func (workqueueMetricsProvider) NewUnfinishedWorkSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return workqueueUnfinishedWork.With(LabelQueue, name)
+}
+
+func (workqueueMetricsProvider) NewLongestRunningProcessorSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return workqueueLongestRunningProcessor.With(LabelQueue, name)
+}
+
+func (workqueueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return counterMetric{workqueueRetries.With(LabelQueue, name)}
+}
+
+// gaugeMetric adapts a gauge to the gauge of a workqueue.
+type gaugeMetric struct {
+	metrics.Gauge
+}
+
+func (g gaugeMetric) Inc() {
+	g.Add(1)
+}
+
+func (g gaugeMetric) Dec() {
+	g.Add(-1)
+}
+
+// counterMetric adapts a counter to the counter of a workqueue.
+type counterMetric struct {
+	metrics.Counter
+}
+
+func (c counterMetric) Inc() {
+	c.Add(1)
+}
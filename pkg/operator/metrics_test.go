@@ -0,0 +1,54 @@
+package operator
+
+import (
+	"testing"
+
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// gathered returns the value of the gauge or counter, or the sample
+// count of the histogram, with the given name and queue label.
+func gathered(t *testing.T, name, queue string) float64 {
+	families, err := stdprometheus.DefaultGatherer.Gather()
+	assert.NoError(t, err)
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() != LabelQueue || l.GetValue() != queue {
+					continue
+				}
+				switch {
+				case m.GetGauge() != nil:
+					return m.GetGauge().GetValue()
+				case m.GetCounter() != nil:
+					return m.GetCounter().GetValue()
+				case m.GetHistogram() != nil:
+					return float64(m.GetHistogram().GetSampleCount())
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestWorkqueueMetrics(t *testing.T) {
+	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "metrics-test")
+	defer queue.ShutDown()
+
+	queue.Add("default/podinfo")
+	queue.AddRateLimited("default/nginx")
+	assert.Equal(t, float64(1), gathered(t, "flux_helm_operator_workqueue_depth", "metrics-test"))
+	assert.Equal(t, float64(1), gathered(t, "flux_helm_operator_workqueue_adds_total", "metrics-test"))
+	assert.Equal(t, float64(1), gathered(t, "flux_helm_operator_workqueue_retries_total", "metrics-test"))
+
+	item, _ := queue.Get()
+	assert.Equal(t, float64(0), gathered(t, "flux_helm_operator_workqueue_depth", "metrics-test"))
+	assert.Equal(t, float64(1), gathered(t, "flux_helm_operator_workqueue_queue_duration_seconds", "metrics-test"))
+	queue.Done(item)
+	assert.Equal(t, float64(1), gathered(t, "flux_helm_operator_workqueue_work_duration_seconds", "metrics-test"))
+}
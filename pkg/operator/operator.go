@@ -5,13 +5,16 @@ import (
 	"github.com/lstack-org/helm-operator/pkg/chartsync"
 	"os"
 	"path"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/google/go-cmp/cmp"
 	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
@@ -22,6 +25,7 @@ import (
 	"k8s.io/client-go/util/workqueue"
 
 	"github.com/lstack-org/helm-operator/internal/lockedfile"
+	"github.com/lstack-org/helm-operator/pkg/alerting"
 	helmfluxv1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
 	ifscheme "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/scheme"
 	hrv1 "github.com/lstack-org/helm-operator/pkg/client/informers/externalversions/helm.fluxcd.io/v1"
@@ -34,6 +38,9 @@ const (
 	controllerAgentName = "helm-operator"
 	ReleaseSynced       = "ReleaseSynced"
 	FailedReleaseSync   = "FailedReleaseSync"
+	ReleaseFrozen       = "ReleaseFrozen"
+	ReleaseHalted       = "ReleaseHalted"
+	ReleasePanicked     = "ReleasePanicked"
 )
 
 // Controller is the operator implementation for HelmRelease resources
@@ -41,11 +48,29 @@ type Controller struct {
 	logger   log.Logger
 	logDiffs bool
 
-	hrLister iflister.HelmReleaseLister
-	hrSynced cache.InformerSynced
+	hrLister  iflister.HelmReleaseLister
+	hrIndexer cache.Indexer
+	hrSynced  cache.InformerSynced
 
 	release      *release.Release
 	gitChartSync *chartsync.GitChartSync
+	alertRules   *alerting.Generator
+
+	// resyncInterval is the default interval at which a HelmRelease
+	// is requeued after it has been processed, zero disables it.
+	resyncInterval time.Duration
+
+	// shard determines the HelmReleases processed by this instance.
+	shard Shard
+
+	// running is set while the workers run, i.e. while this replica
+	// is the elected leader if leader election is enabled; the
+	// informer delivers deletions to every replica, but only the
+	// leader uninstalls their releases.
+	running int32
+
+	// retry holds the default settings for retrying failed syncs.
+	retry helmfluxv1.Retry
 
 	// workqueue is a rate limited work queue. This is used to queue work to be
 	// processed instead of performing it as soon as a change happens. This
@@ -67,7 +92,11 @@ func New(
 	hrInformer hrv1.HelmReleaseInformer,
 	releaseWorkqueue workqueue.RateLimitingInterface,
 	release *release.Release,
-	gitChartSync *chartsync.GitChartSync) *Controller {
+	gitChartSync *chartsync.GitChartSync,
+	alertRules *alerting.Generator,
+	resyncInterval time.Duration,
+	shard Shard,
+	retry helmfluxv1.Retry) *Controller {
 
 	// Add helm-operator types to the default Kubernetes Scheme so Events can be
 	// logged for helm-operator types.
@@ -75,16 +104,27 @@ func New(
 	eventBroadcaster := record.NewBroadcaster()
 	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeclientset.CoreV1().Events("")})
 	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
+	release.SetEventRecorder(recorder)
+	status.SetEventRecorder(recorder)
 
 	controller := &Controller{
 		logger:           logger,
 		logDiffs:         logReleaseDiffs,
 		hrLister:         hrInformer.Lister(),
+		hrIndexer:        hrInformer.Informer().GetIndexer(),
 		hrSynced:         hrInformer.Informer().HasSynced,
 		releaseWorkqueue: releaseWorkqueue,
 		recorder:         recorder,
 		release:          release,
 		gitChartSync:     gitChartSync,
+		alertRules:       alertRules,
+		resyncInterval:   resyncInterval,
+		shard:            shard,
+		retry:            retry,
+	}
+
+	if err := hrInformer.Informer().AddIndexers(cache.Indexers{dependsOnIndex: indexDependsOn}); err != nil {
+		controller.logger.Log("error", fmt.Sprintf("failed to index HelmReleases by their dependencies: %v", err))
 	}
 
 	controller.logger.Log("info", "setting up event handlers")
@@ -98,15 +138,7 @@ func New(
 		UpdateFunc: func(old, new interface{}) {
 			controller.enqueueUpdateJob(old, new)
 		},
-		DeleteFunc: func(old interface{}) {
-			if hr, ok := checkCustomResourceType(controller.logger, old); ok {
-				releaseCount.Add(-1)
-				if err := controller.release.Uninstall(hr.DeepCopy()); err != nil {
-					controller.logger.Log("error", err)
-				}
-				status.ObserveReleaseConditions(&hr, nil)
-			}
-		},
+		DeleteFunc: controller.deleteRelease,
 	})
 	controller.logger.Log("info", "event handlers set up")
 
@@ -121,6 +153,12 @@ func (c *Controller) Run(threadiness int, stopCh <-chan struct{}, wg *sync.WaitG
 	defer c.releaseWorkqueue.ShutDown()
 
 	c.logger.Log("info", "starting operator")
+	atomic.StoreInt32(&c.running, 1)
+	defer atomic.StoreInt32(&c.running, 0)
+
+	// events received before the operator started running, e.g. while
+	// waiting for leadership, may not have been processed by a leader
+	c.enqueueAll()
 
 	c.logger.Log("info", "starting workers")
 	for i := 0; i < threadiness; i++ {
@@ -182,7 +220,7 @@ func (c *Controller) processNextWorkItem() bool {
 		// Run the syncHandler, passing it the namespace/name string of the
 		// HelmRelease resource to sync the corresponding Chart release.
 		// If the sync failed, then we return while the item will get requeued
-		if err := c.syncHandler(key); err != nil {
+		if err := c.syncRecovered(key); err != nil {
 			return fmt.Errorf("errored syncing HelmRelease '%s': %s", key, err.Error())
 		}
 		// If no error occurs we Forget this item so it does not
@@ -198,6 +236,102 @@ func (c *Controller) processNextWorkItem() bool {
 	return true
 }
 
+// panicError is returned by recovered for a recovered panic.
+type panicError struct {
+	value interface{}
+}
+
+func (err panicError) Error() string {
+	return fmt.Sprintf("panic: %v", err.value)
+}
+
+// recovered runs fn and recovers from a panic in it, so it does not
+// crash the worker or the informer and the other HelmReleases they
+// handle. The panic is logged with its stack, which is kept out of the
+// status and Events, and returned as a panicError.
+func (c *Controller) recovered(action string, fn func() error) (err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		releaseSyncPanics.Add(1)
+		err = panicError{r}
+		c.logger.Log("error", fmt.Sprintf("recovered from panic while %s: %v", action, r), "stack", string(debug.Stack()))
+	}()
+	return fn()
+}
+
+// syncRecovered runs the syncHandler for the given key, recovering
+// from a panic during the sync. The HelmRelease is marked as failed
+// with the panic.
+func (c *Controller) syncRecovered(key string) error {
+	err := c.recovered(fmt.Sprintf("syncing HelmRelease '%s'", key), func() error {
+		return c.syncHandler(key)
+	})
+	pErr, ok := err.(panicError)
+	if !ok {
+		return err
+	}
+	namespace, name, splitErr := cache.SplitMetaNamespaceKey(key)
+	if splitErr != nil {
+		return err
+	}
+	hr, getErr := c.hrLister.HelmReleases(namespace).Get(name)
+	if getErr != nil {
+		return err
+	}
+	message := panicMessage(hr, pErr)
+	c.recorder.Event(hr, corev1.EventTypeWarning, ReleasePanicked, message)
+	if recordErr := c.release.RecordPanic(hr.DeepCopy(), message); recordErr != nil {
+		c.logger.Log("warning", fmt.Sprintf("failed to record panic of HelmRelease '%s': %v", key, recordErr))
+	}
+	return err
+}
+
+// panicMessage returns the message the panic of the sync of the given
+// HelmRelease is recorded with.
+func panicMessage(hr *helmfluxv1.HelmRelease, err panicError) string {
+	return fmt.Sprintf("synchronization of release '%s' in namespace '%s' panicked: %v",
+		hr.GetReleaseName(), hr.GetTargetNamespace(), err.value)
+}
+
+// deleteRelease uninstalls the Helm release of the deleted HelmRelease,
+// recovering from a panic during the uninstall. Replicas not running
+// the workers, i.e. waiting for leadership, leave it to the leader. HelmReleases which
+// merely left the watched scope, e.g. were relabeled out of the label
+// selector, are reported as deleted as well; their release is kept.
+func (c *Controller) deleteRelease(old interface{}) {
+	hr, ok := checkCustomResourceType(c.logger, old)
+	if !ok {
+		return
+	}
+	releaseCount.Add(-1)
+	if !c.shard.Owns(&hr) {
+		return
+	}
+	defer status.ObserveReleaseImages(&hr, nil)
+	defer status.ObserveReleaseConditions(&hr, nil)
+	if atomic.LoadInt32(&c.running) == 0 {
+		c.logger.Log("info", fmt.Sprintf("not uninstalling HelmRelease '%s/%s', this replica is not the leader", hr.Namespace, hr.Name))
+		return
+	}
+	err := c.recovered(fmt.Sprintf("uninstalling HelmRelease '%s/%s'", hr.Namespace, hr.Name), func() error {
+		deleted, err := c.release.Deleted(&hr)
+		if err != nil {
+			return fmt.Errorf("not uninstalling HelmRelease '%s/%s', failed to determine if it has been deleted: %w", hr.Namespace, hr.Name, err)
+		}
+		if !deleted {
+			c.logger.Log("info", fmt.Sprintf("HelmRelease '%s/%s' left the watched scope, keeping its release", hr.Namespace, hr.Name))
+			return nil
+		}
+		return c.release.Uninstall(hr.DeepCopy())
+	})
+	if err != nil {
+		c.logger.Log("error", err)
+	}
+}
+
 // syncHandler acts according to the action
 // 		Deletes/creates or updates a Chart release
 func (c *Controller) syncHandler(key string) error {
@@ -213,6 +347,9 @@ func (c *Controller) syncHandler(key string) error {
 	unlock, err := c.lock(fmt.Sprintf("%s-%s", namespace, name))
 	if err != nil {
 		c.logger.Log("info", fmt.Sprintf("could not obtain lock: %s", err))
+		if hr, getErr := c.hrLister.HelmReleases(namespace).Get(name); getErr == nil {
+			c.release.RecordSkip(hr, release.SkippedLockContention, fmt.Errorf("could not obtain lock: %w", err))
+		}
 		return nil
 	}
 	defer unlock()
@@ -228,14 +365,94 @@ func (c *Controller) syncHandler(key string) error {
 		c.logger.Log("error", err.Error())
 		return err
 	}
+	if !c.shard.Owns(hr) {
+		// the HelmRelease moved to another shard after it was queued
+		return nil
+	}
+	if hr.Spec.Suspend {
+		c.logger.Log("info", fmt.Sprintf("reconciliation of HelmRelease '%s' is suspended", key))
+		if err := c.release.Suspend(hr.DeepCopy()); err != nil {
+			c.logger.Log("warning", fmt.Sprintf("failed to record suspension of HelmRelease '%s': %v", key, err))
+		}
+		return nil
+	}
+	if err := c.checkDependencies(hr); err != nil {
+		c.logger.Log("info", fmt.Sprintf("HelmRelease '%s' is waiting for its dependencies: %v", key, err))
+		if err := c.release.SetDependencyNotReady(hr.DeepCopy(), err); err != nil {
+			c.logger.Log("warning", fmt.Sprintf("failed to record dependency status of HelmRelease '%s': %v", key, err))
+		}
+		// retry with back-off, the HelmRelease is also enqueued once
+		// a dependency becomes ready
+		c.releaseWorkqueue.AddRateLimited(key)
+		return err
+	}
+	if restore, err := c.release.RestoreInProgress(hr); err != nil {
+		c.logger.Log("warning", fmt.Sprintf("failed to check Velero restore of HelmRelease '%s': %v", key, err))
+	} else if restore != "" {
+		c.logger.Log("info", fmt.Sprintf("HelmRelease '%s' is waiting for Velero restore '%s' to finish", key, restore))
+		err := fmt.Errorf("Velero restore '%s' is in progress", restore)
+		c.release.RecordSkip(hr.DeepCopy(), release.SkippedRestoreInProgress, err)
+		// retry with back-off until the restore has finished, the error
+		// keeps the key from being forgotten so the back-off grows
+		c.releaseWorkqueue.AddRateLimited(key)
+		return err
+	}
+	// failed syncs of this generation are not retried once the
+	// retries are exhausted, until the HelmRelease changes
+	retry := hr.GetRetry(c.retry)
+	retrying := status.IsRetry(hr)
+	if retrying && retry.Exhausted(hr.Status.Failures) {
+		c.logger.Log("info", fmt.Sprintf("retries of HelmRelease '%s' are exhausted after %d failed syncs", key, hr.Status.Failures))
+		c.release.RecordSkip(hr.DeepCopy(), release.SkippedRetriesExhausted, fmt.Errorf("%d consecutive syncs failed", hr.Status.Failures))
+		return nil
+	}
+	// requeue the HelmRelease on its own schedule, so drift is
+	// detected within a bounded time regardless of events
+	if interval := hr.GetResyncInterval(c.resyncInterval); interval > 0 {
+		defer c.releaseWorkqueue.AddAfter(key, interval)
+	}
+
+	var failures int64
 	err = c.release.Sync(hr.DeepCopy())
-	if err != nil {
-		c.recorder.Event(hr, corev1.EventTypeWarning, FailedReleaseSync,
+	if window := release.Frozen(err); window != nil {
+		// the upgrade is held rather than failed, and attempted again
+		// once the freeze ends
+		c.recorder.Event(hr, corev1.EventTypeNormal, ReleaseFrozen, err.Error())
+		c.releaseWorkqueue.AddAfter(key, time.Until(window.End))
+		failures = hr.Status.Failures
+	} else if release.Halted(err) {
+		// the action is held rather than failed, and attempted again
+		// on the next sync once the operator is no longer halted
+		c.recorder.Event(hr, corev1.EventTypeNormal, ReleaseHalted, err.Error())
+		failures = hr.Status.Failures
+	} else if err != nil {
+		reason := release.Reason(err)
+		if reason == "" {
+			reason = FailedReleaseSync
+		}
+		c.recorder.Event(hr, corev1.EventTypeWarning, reason,
 			fmt.Sprintf("synchronization of release '%s' in namespace '%s' failed: %s", hr.GetReleaseName(), hr.GetTargetNamespace(), err.Error()))
+
+		failures = 1
+		if retrying {
+			failures = hr.Status.Failures + 1
+		}
+		if delay := retry.Delay(failures); !retry.Exhausted(failures) && delay > 0 {
+			c.releaseWorkqueue.AddAfter(key, delay)
+		}
 	} else {
 		c.recorder.Event(hr, corev1.EventTypeNormal, ReleaseSynced,
 			fmt.Sprintf("managed release '%s' in namespace '%s' synchronized", hr.GetReleaseName(), hr.GetTargetNamespace()))
 	}
+	if err := c.release.SetFailures(hr.DeepCopy(), failures); err != nil {
+		c.logger.Log("warning", fmt.Sprintf("failed to record failed syncs of HelmRelease '%s': %v", key, err))
+	}
+
+	if c.alertRules != nil {
+		if err := c.alertRules.Ensure(hr); err != nil {
+			c.logger.Log("warning", fmt.Sprintf("failed to ensure alerting rules for HelmRelease '%s': %v", key, err))
+		}
+	}
 	return nil
 }
 
@@ -249,6 +466,9 @@ func (c *Controller) lock(name string) (unlock func(), err error) {
 // string which is then put onto the work queue. This method should not be
 // passed resources of any type other than HelmRelease.
 func (c *Controller) enqueueJob(obj interface{}) {
+	if hr, ok := obj.(*helmfluxv1.HelmRelease); ok && !c.shard.Owns(hr) {
+		return
+	}
 	key, err := getCacheKey(obj)
 	if err != nil {
 		return
@@ -257,6 +477,26 @@ func (c *Controller) enqueueJob(obj interface{}) {
 	releaseQueueLength.Set(float64(c.releaseWorkqueue.Len()))
 }
 
+// enqueueAll enqueues all HelmReleases of the shard.
+func (c *Controller) enqueueAll() {
+	list, err := c.hrLister.List(labels.Everything())
+	if err != nil {
+		c.logger.Log("error", fmt.Sprintf("failed to list HelmReleases to enqueue: %v", err))
+		return
+	}
+	for _, hr := range list {
+		if !c.shard.Owns(hr) {
+			continue
+		}
+		key, err := getCacheKey(hr)
+		if err != nil {
+			continue
+		}
+		c.releaseWorkqueue.Add(key)
+	}
+	releaseQueueLength.Set(float64(c.releaseWorkqueue.Len()))
+}
+
 // enqueueUpdateJob decides if there is a genuine resource update
 func (c *Controller) enqueueUpdateJob(old, new interface{}) {
 	oldHr, ok := checkCustomResourceType(c.logger, old)
@@ -264,7 +504,21 @@ func (c *Controller) enqueueUpdateJob(old, new interface{}) {
 		return
 	}
 	newHr, ok := checkCustomResourceType(c.logger, new)
-	if !ok {
+	if !ok || !c.shard.Owns(&newHr) {
+		return
+	}
+
+	// A reconciliation requested with the annotation is enqueued
+	// immediately, bypassing the rate limiter. The mirror is synced
+	// first, so the reconciliation is of the latest commit of the ref
+	// and not of the commit last fetched by the mirror.
+	if reconcileAt := newHr.GetAnnotations()[helmfluxv1.ReconcileAtAnnotation]; reconcileAt != "" &&
+		reconcileAt != oldHr.GetAnnotations()[helmfluxv1.ReconcileAtAnnotation] {
+		c.gitChartSync.SyncMirror(&newHr)
+		if key, err := getCacheKey(new); err == nil {
+			c.releaseWorkqueue.Add(key)
+			releaseQueueLength.Set(float64(c.releaseWorkqueue.Len()))
+		}
 		return
 	}
 
@@ -276,6 +530,7 @@ func (c *Controller) enqueueUpdateJob(old, new interface{}) {
 	// from the periodic refresh, as we still want to detect (and
 	// undo) mutations to Helm charts.
 	if sDiff := cmp.Diff(oldHr.Status, newHr.Status); diff == "" && sDiff != "" {
+		c.enqueueDependents(&newHr)
 		return
 	}
 
@@ -0,0 +1,114 @@
+package operator
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+	helmv3 "github.com/lstack-org/helm-operator/pkg/helm/v3"
+	"github.com/lstack-org/helm-operator/pkg/release"
+)
+
+func TestEnqueueAll(t *testing.T) {
+	c := newTestController(t,
+		newHelmRelease("a", "podinfo", map[string]string{"tenant": "a"}),
+		newHelmRelease("b", "podinfo", map[string]string{"tenant": "a"}),
+		newHelmRelease("b", "other", map[string]string{"tenant": "b"}),
+	)
+	c.shard = Shard{Selector: labels.SelectorFromSet(labels.Set{"tenant": "a"})}
+
+	c.enqueueAll()
+	var keys []string
+	for c.releaseWorkqueue.Len() > 0 {
+		key, _ := c.releaseWorkqueue.Get()
+		keys = append(keys, key.(string))
+		c.releaseWorkqueue.Done(key)
+	}
+	assert.ElementsMatch(t, []string{"a/podinfo", "b/podinfo"}, keys)
+}
+
+func TestRecovered(t *testing.T) {
+	var logs bytes.Buffer
+	c := newTestController(t)
+	c.logger = log.NewLogfmtLogger(&logs)
+
+	err := c.recovered("testing", func() error { return fmt.Errorf("failed") })
+	assert.EqualError(t, err, "failed")
+	assert.Empty(t, logs.String())
+
+	err = c.recovered("testing", func() error { panic("boom") })
+	assert.Equal(t, panicError{"boom"}, err)
+	// the stack is logged, but not part of the error
+	assert.Contains(t, logs.String(), "recovered from panic while testing: boom")
+	assert.Contains(t, logs.String(), "stack=")
+	assert.NotContains(t, err.Error(), "goroutine")
+}
+
+func TestPanicMessage(t *testing.T) {
+	hr := newHelmRelease("default", "podinfo", nil)
+	message := panicMessage(hr, panicError{"boom"})
+	assert.Equal(t, "synchronization of release 'default-podinfo' in namespace 'default' panicked: boom", message)
+}
+
+func TestDeleteReleaseRecovered(t *testing.T) {
+	var logs bytes.Buffer
+	c := newTestController(t)
+	c.logger = log.NewLogfmtLogger(&logs)
+	c.running = 1
+
+	// without a release, the uninstall panics
+	assert.NotPanics(t, func() { c.deleteRelease(newHelmRelease("default", "podinfo", nil)) })
+	assert.Contains(t, logs.String(), "recovered from panic while uninstalling HelmRelease 'default/podinfo'")
+}
+
+// uninstallHelmClient records the uninstalled releases.
+type uninstallHelmClient struct {
+	helm.Client
+	mu          sync.Mutex
+	uninstalled []string
+}
+
+func (c *uninstallHelmClient) Version() string {
+	return "v3"
+}
+
+func (c *uninstallHelmClient) Uninstall(releaseName string, opts helm.UninstallOptions) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.uninstalled = append(c.uninstalled, releaseName)
+	return nil
+}
+
+func TestDeleteReleaseLeaderOnly(t *testing.T) {
+	chartCache, err := ioutil.TempDir("", "delete-release")
+	assert.NoError(t, err)
+	defer os.RemoveAll(chartCache)
+
+	helmClient := &uninstallHelmClient{}
+	clients := &helm.Clients{}
+	clients.Add("v3", helmClient)
+	rel := release.New(log.NewNopLogger(), clients, fake.NewSimpleClientset().CoreV1(), ifclientsetfake.NewSimpleClientset().HelmV1(),
+		nil, nil, nil, release.Config{ChartCache: chartCache, DefaultHelmVersion: "v3"}, helmv3.Converter{})
+
+	// both replicas are informed of the deletion, only the leader
+	// runs the workers
+	leader, standby := newTestController(t), newTestController(t)
+	leader.release, standby.release = rel, rel
+	leader.running = 1
+
+	hr := newHelmRelease("default", "podinfo", nil)
+	standby.deleteRelease(hr)
+	assert.Empty(t, helmClient.uninstalled)
+	leader.deleteRelease(hr)
+	assert.Equal(t, []string{"default-podinfo"}, helmClient.uninstalled)
+}
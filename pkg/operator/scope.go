@@ -0,0 +1,208 @@
+package operator
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+
+	helmfluxv1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/client/clientset/versioned"
+	hrv1 "github.com/lstack-org/helm-operator/pkg/client/informers/externalversions/helm.fluxcd.io/v1"
+	iflister "github.com/lstack-org/helm-operator/pkg/client/listers/helm.fluxcd.io/v1"
+)
+
+// Scope determines the HelmReleases watched by an operator instance,
+// so that instances can be dedicated to tenants. Unlike with a Shard,
+// the HelmReleases out of scope are filtered by the API server, and
+// are not visible to the instance at all. The zero value watches all
+// HelmReleases.
+type Scope struct {
+	// Namespaces are the namespaces of the watched HelmReleases; all
+	// namespaces are watched if empty.
+	Namespaces []string
+	// LabelSelector, if set, selects the watched HelmReleases.
+	LabelSelector string
+}
+
+// TweakListOptions sets the label selector of the scope on the given
+// options.
+func (s Scope) TweakListOptions(options *metav1.ListOptions) {
+	if s.LabelSelector != "" {
+		options.LabelSelector = s.LabelSelector
+	}
+}
+
+// ScopedInformer is an informer of the HelmReleases in a scope.
+type ScopedInformer interface {
+	hrv1.HelmReleaseInformer
+	// Start runs the informer until stop is closed.
+	Start(stop <-chan struct{})
+}
+
+// NewInformer returns an informer of the HelmReleases in the scope,
+// resynced at the given period.
+func (s Scope) NewInformer(client versioned.Interface, resyncPeriod time.Duration) ScopedInformer {
+	indexers := cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}
+	if len(s.Namespaces) <= 1 {
+		namespace := metav1.NamespaceAll
+		if len(s.Namespaces) == 1 {
+			namespace = s.Namespaces[0]
+		}
+		return scopedInformer{hrv1.NewFilteredHelmReleaseInformer(client, namespace, resyncPeriod, indexers, s.TweakListOptions)}
+	}
+	return scopedInformer{cache.NewSharedIndexInformer(s.listWatch(client), &helmfluxv1.HelmRelease{}, resyncPeriod, indexers)}
+}
+
+type scopedInformer struct {
+	informer cache.SharedIndexInformer
+}
+
+func (i scopedInformer) Informer() cache.SharedIndexInformer {
+	return i.informer
+}
+
+func (i scopedInformer) Lister() iflister.HelmReleaseLister {
+	return iflister.NewHelmReleaseLister(i.informer.GetIndexer())
+}
+
+func (i scopedInformer) Start(stop <-chan struct{}) {
+	go i.informer.Run(stop)
+}
+
+// listWatch lists and watches the HelmReleases in each namespace of
+// the scope. As the resource versions of the namespaces are unrelated
+// to each other, the resource version of each namespace is tracked
+// from its list and the events of its watch, and each namespace is
+// watched from its own version; the resource version of the combined
+// list is only reported to the informer.
+func (s Scope) listWatch(client versioned.Interface) *cache.ListWatch {
+	versions := &namespaceVersions{versions: make(map[string]string)}
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			s.TweakListOptions(&options)
+			list := &helmfluxv1.HelmReleaseList{}
+			listed := make(map[string]string, len(s.Namespaces))
+			for _, ns := range s.Namespaces {
+				nsList, err := client.HelmV1().HelmReleases(ns).List(options)
+				if err != nil {
+					return nil, err
+				}
+				list.Items = append(list.Items, nsList.Items...)
+				listed[ns] = nsList.ResourceVersion
+				list.ResourceVersion = nsList.ResourceVersion
+			}
+			versions.reset(listed)
+			return list, nil
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			s.TweakListOptions(&options)
+			var watches []watch.Interface
+			for _, ns := range s.Namespaces {
+				nsOptions := options
+				if rv := versions.get(ns); rv != "" {
+					nsOptions.ResourceVersion = rv
+				}
+				w, err := client.HelmV1().HelmReleases(ns).Watch(nsOptions)
+				if err != nil {
+					for _, w := range watches {
+						w.Stop()
+					}
+					return nil, err
+				}
+				watches = append(watches, w)
+			}
+			return newMergedWatch(watches, versions), nil
+		},
+	}
+}
+
+// namespaceVersions holds the latest resource version of each watched
+// namespace.
+type namespaceVersions struct {
+	mu       sync.Mutex
+	versions map[string]string
+}
+
+func (v *namespaceVersions) reset(versions map[string]string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.versions = versions
+}
+
+func (v *namespaceVersions) get(namespace string) string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.versions[namespace]
+}
+
+// observe records the resource version of the object of the event as
+// the version of its namespace.
+func (v *namespaceVersions) observe(e watch.Event) {
+	if e.Type == watch.Error {
+		return
+	}
+	obj, err := meta.Accessor(e.Object)
+	if err != nil || obj.GetResourceVersion() == "" {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.versions[obj.GetNamespace()] = obj.GetResourceVersion()
+}
+
+// mergedWatch merges the events of multiple watches, recording the
+// resource versions of their namespaces. It is stopped once any of the
+// watches ends, so the watches are restarted together.
+type mergedWatch struct {
+	watches []watch.Interface
+	result  chan watch.Event
+	stop    chan struct{}
+	once    sync.Once
+}
+
+func newMergedWatch(watches []watch.Interface, versions *namespaceVersions) *mergedWatch {
+	m := &mergedWatch{
+		watches: watches,
+		result:  make(chan watch.Event),
+		stop:    make(chan struct{}),
+	}
+	var wg sync.WaitGroup
+	for _, w := range watches {
+		wg.Add(1)
+		go func(w watch.Interface) {
+			defer wg.Done()
+			defer m.Stop()
+			for e := range w.ResultChan() {
+				select {
+				case m.result <- e:
+					versions.observe(e)
+				case <-m.stop:
+					return
+				}
+			}
+		}(w)
+	}
+	go func() {
+		wg.Wait()
+		close(m.result)
+	}()
+	return m
+}
+
+func (m *mergedWatch) Stop() {
+	m.once.Do(func() {
+		close(m.stop)
+		for _, w := range m.watches {
+			w.Stop()
+		}
+	})
+}
+
+func (m *mergedWatch) ResultChan() <-chan watch.Event {
+	return m.result
+}
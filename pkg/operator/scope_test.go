@@ -0,0 +1,106 @@
+package operator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+
+	helmfluxv1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+)
+
+func newHelmRelease(namespace, name string, labels map[string]string) *helmfluxv1.HelmRelease {
+	return &helmfluxv1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels}}
+}
+
+func TestScopeInformer(t *testing.T) {
+	client := ifclientsetfake.NewSimpleClientset(
+		newHelmRelease("a", "podinfo", map[string]string{"tenant": "a"}),
+		newHelmRelease("b", "podinfo", map[string]string{"tenant": "a"}),
+		newHelmRelease("b", "other", map[string]string{"tenant": "b"}),
+		newHelmRelease("c", "podinfo", map[string]string{"tenant": "a"}),
+	)
+	scope := Scope{Namespaces: []string{"a", "b"}, LabelSelector: "tenant=a"}
+	informer := scope.NewInformer(client, 0)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	informer.Start(stop)
+	assert.True(t, cache.WaitForCacheSync(stop, informer.Informer().HasSynced))
+
+	hrs, err := informer.Lister().List(labels.Everything())
+	assert.NoError(t, err)
+	var keys []string
+	for _, hr := range hrs {
+		keys = append(keys, hr.Namespace+"/"+hr.Name)
+	}
+	assert.ElementsMatch(t, []string{"a/podinfo", "b/podinfo"}, keys)
+
+	// HelmReleases created since the list are received by the watch
+	_, err = client.HelmV1().HelmReleases("b").Create(newHelmRelease("b", "new", map[string]string{"tenant": "a"}))
+	assert.NoError(t, err)
+	_, err = client.HelmV1().HelmReleases("c").Create(newHelmRelease("c", "new", map[string]string{"tenant": "a"}))
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := informer.Lister().HelmReleases("b").Get("new")
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	_, err = informer.Lister().HelmReleases("c").Get("new")
+	assert.Error(t, err)
+}
+
+func TestMergedWatchStop(t *testing.T) {
+	client := ifclientsetfake.NewSimpleClientset()
+	lw := Scope{Namespaces: []string{"a", "b"}}.listWatch(client)
+	w, err := lw.Watch(metav1.ListOptions{})
+	assert.NoError(t, err)
+	w.Stop()
+	select {
+	case _, ok := <-w.ResultChan():
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("result channel not closed after stop")
+	}
+}
+
+func TestMergedWatchNamespaceVersions(t *testing.T) {
+	client := ifclientsetfake.NewSimpleClientset()
+	watched := make(chan map[string]string, 2)
+	versions := map[string]string{}
+	client.PrependWatchReactor("helmreleases", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		versions[action.GetNamespace()] = action.(k8stesting.WatchActionImpl).WatchRestrictions.ResourceVersion
+		if len(versions) == 2 {
+			watched <- versions
+			versions = map[string]string{}
+		}
+		return false, nil, nil
+	})
+	lw := Scope{Namespaces: []string{"a", "b"}}.listWatch(client)
+	_, err := lw.List(metav1.ListOptions{})
+	assert.NoError(t, err)
+
+	w, err := lw.Watch(metav1.ListOptions{ResourceVersion: "1"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "b": "1"}, <-watched)
+	hr := newHelmRelease("a", "podinfo", nil)
+	hr.ResourceVersion = "42"
+	_, err = client.HelmV1().HelmReleases("a").Create(hr)
+	assert.NoError(t, err)
+	e := <-w.ResultChan()
+	assert.Equal(t, watch.Added, e.Type)
+	w.Stop()
+	for range w.ResultChan() {
+	}
+
+	// each namespace is watched from its own resource version
+	w, err = lw.Watch(metav1.ListOptions{ResourceVersion: "7"})
+	assert.NoError(t, err)
+	defer w.Stop()
+	assert.Equal(t, map[string]string{"a": "42", "b": "7"}, <-watched)
+}
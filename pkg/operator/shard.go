@@ -0,0 +1,76 @@
+package operator
+
+import (
+	"hash/fnv"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	helmfluxv1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	iflister "github.com/lstack-org/helm-operator/pkg/client/listers/helm.fluxcd.io/v1"
+)
+
+// Shard determines the HelmReleases processed by an operator instance,
+// so that the load can be split over multiple instances. The zero
+// value owns all HelmReleases.
+type Shard struct {
+	// Selector, if set, selects the HelmReleases by label.
+	Selector labels.Selector
+	// Index and Total, if Total is larger than one, select the
+	// HelmReleases whose namespace and name hash to Index.
+	Index int
+	Total int
+}
+
+// Owns returns if the given HelmRelease belongs to the shard.
+func (s Shard) Owns(hr *helmfluxv1.HelmRelease) bool {
+	if s.Selector != nil && !s.Selector.Matches(labels.Set(hr.GetLabels())) {
+		return false
+	}
+	if s.Total <= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(hr.Namespace + "/" + hr.Name))
+	return int(h.Sum32()%uint32(s.Total)) == s.Index
+}
+
+// Lister returns a lister which only lists the HelmReleases belonging
+// to the shard. Getting a HelmRelease by name is not filtered, so that
+// references to HelmReleases in other shards can still be resolved.
+func (s Shard) Lister(lister iflister.HelmReleaseLister) iflister.HelmReleaseLister {
+	return shardLister{HelmReleaseLister: lister, shard: s}
+}
+
+type shardLister struct {
+	iflister.HelmReleaseLister
+	shard Shard
+}
+
+func (l shardLister) List(selector labels.Selector) ([]*helmfluxv1.HelmRelease, error) {
+	list, err := l.HelmReleaseLister.List(selector)
+	return l.shard.filter(list), err
+}
+
+func (l shardLister) HelmReleases(namespace string) iflister.HelmReleaseNamespaceLister {
+	return shardNamespaceLister{HelmReleaseNamespaceLister: l.HelmReleaseLister.HelmReleases(namespace), shard: l.shard}
+}
+
+type shardNamespaceLister struct {
+	iflister.HelmReleaseNamespaceLister
+	shard Shard
+}
+
+func (l shardNamespaceLister) List(selector labels.Selector) ([]*helmfluxv1.HelmRelease, error) {
+	list, err := l.HelmReleaseNamespaceLister.List(selector)
+	return l.shard.filter(list), err
+}
+
+func (s Shard) filter(list []*helmfluxv1.HelmRelease) []*helmfluxv1.HelmRelease {
+	var owned []*helmfluxv1.HelmRelease
+	for _, hr := range list {
+		if s.Owns(hr) {
+			owned = append(owned, hr)
+		}
+	}
+	return owned
+}
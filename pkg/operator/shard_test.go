@@ -0,0 +1,58 @@
+package operator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+
+	helmfluxv1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	iflister "github.com/lstack-org/helm-operator/pkg/client/listers/helm.fluxcd.io/v1"
+)
+
+func TestShardOwns(t *testing.T) {
+	hrs := []*helmfluxv1.HelmRelease{
+		newHelmRelease("a", "podinfo", map[string]string{"shard": "a"}),
+		newHelmRelease("b", "podinfo", map[string]string{"shard": "b"}),
+		newHelmRelease("c", "podinfo", nil),
+		newHelmRelease("c", "other", nil),
+	}
+
+	assert.True(t, Shard{}.Owns(hrs[0]))
+	selector := Shard{Selector: labels.SelectorFromSet(labels.Set{"shard": "a"})}
+	assert.True(t, selector.Owns(hrs[0]))
+	assert.False(t, selector.Owns(hrs[1]))
+
+	// every HelmRelease belongs to exactly one of the hashed shards
+	for _, hr := range hrs {
+		var owners int
+		for i := 0; i < 3; i++ {
+			if (Shard{Index: i, Total: 3}).Owns(hr) {
+				owners++
+			}
+		}
+		assert.Equal(t, 1, owners)
+	}
+}
+
+func TestShardLister(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	assert.NoError(t, indexer.Add(newHelmRelease("a", "podinfo", map[string]string{"shard": "a"})))
+	assert.NoError(t, indexer.Add(newHelmRelease("a", "other", map[string]string{"shard": "b"})))
+	shard := Shard{Selector: labels.SelectorFromSet(labels.Set{"shard": "a"})}
+	lister := shard.Lister(iflister.NewHelmReleaseLister(indexer))
+
+	list, err := lister.List(labels.Everything())
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+	assert.Equal(t, "podinfo", list[0].Name)
+	list, err = lister.HelmReleases("a").List(labels.Everything())
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+
+	// HelmReleases of other shards can still be referenced
+	hr, err := lister.HelmReleases("a").Get("other")
+	assert.NoError(t, err)
+	assert.Equal(t, "other", hr.Name)
+}
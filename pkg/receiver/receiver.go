@@ -0,0 +1,334 @@
+/*
+Package receiver receives webhooks of Git hosting services and chart
+registries, and immediately enqueues the `HelmRelease` resources
+referring to the pushed repository or chart for a sync, instead of
+waiting for the next poll of the Git mirrors or resync.
+
+GitHub webhooks are verified with their HMAC signature, GitLab and
+Harbor webhooks with the token they are configured with; both use the
+shared secret of the receiver.
+*/
+package receiver
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	iflister "github.com/lstack-org/helm-operator/pkg/client/listers/helm.fluxcd.io/v1"
+)
+
+// The providers webhooks are received from.
+const (
+	GitHub = "github"
+	GitLab = "gitlab"
+	Harbor = "harbor"
+)
+
+var (
+	// ErrDisabled is returned if the receiver has no secret to verify
+	// webhooks with.
+	ErrDisabled = errors.New("webhook receiver is disabled")
+	// ErrUnauthorized is returned for webhooks with an invalid
+	// signature or token.
+	ErrUnauthorized = errors.New("invalid webhook signature or token")
+)
+
+// UnsupportedProviderError is returned for webhooks of unknown
+// providers.
+type UnsupportedProviderError struct {
+	Provider string
+}
+
+func (err UnsupportedProviderError) Error() string {
+	return fmt.Sprintf("unsupported webhook provider '%s'", err.Provider)
+}
+
+// MirrorSyncer syncs the Git mirror of a HelmRelease.
+type MirrorSyncer interface {
+	SyncMirror(hr *v1.HelmRelease)
+}
+
+// Receiver enqueues the HelmReleases matching received webhooks.
+type Receiver struct {
+	logger        log.Logger
+	secret        []byte
+	hrLister      iflister.HelmReleaseLister
+	mirrors       MirrorSyncer
+	queue         workqueue.Interface
+	defaultGitRef string
+}
+
+// New returns a new Receiver verifying webhooks with the given
+// secret; webhooks are rejected if the secret is empty.
+func New(logger log.Logger, secret []byte, hrLister iflister.HelmReleaseLister, mirrors MirrorSyncer,
+	queue workqueue.Interface, defaultGitRef string) *Receiver {
+	return &Receiver{
+		logger:        logger,
+		secret:        secret,
+		hrLister:      hrLister,
+		mirrors:       mirrors,
+		queue:         queue,
+		defaultGitRef: defaultGitRef,
+	}
+}
+
+// event is a received push of a Git repository or chart.
+type event struct {
+	// gitURLs are the URLs of the pushed Git repository.
+	gitURLs []string
+	// ref is the pushed Git ref, i.e. `refs/heads/master`.
+	ref string
+	// chartRepoURL is the URL of the chart repository of the pushed
+	// chart.
+	chartRepoURL string
+	// chart is the name of the pushed chart.
+	chart string
+}
+
+// Receive verifies the webhook of the given provider and enqueues
+// the HelmReleases matching it. It returns the number of enqueued
+// HelmReleases; webhooks of events other than pushes are accepted
+// but ignored.
+func (r *Receiver) Receive(provider string, header http.Header, payload []byte) (int, error) {
+	if len(r.secret) == 0 {
+		return 0, ErrDisabled
+	}
+	var e *event
+	var err error
+	switch provider {
+	case GitHub:
+		if !r.validSignature(header, payload) {
+			return 0, ErrUnauthorized
+		}
+		e, err = parseGitHub(header.Get("X-GitHub-Event"), payload)
+	case GitLab:
+		if !r.validToken(header.Get("X-Gitlab-Token")) {
+			return 0, ErrUnauthorized
+		}
+		e, err = parseGitLab(header.Get("X-Gitlab-Event"), payload)
+	case Harbor:
+		if !r.validToken(strings.TrimPrefix(header.Get("Authorization"), "Bearer ")) {
+			return 0, ErrUnauthorized
+		}
+		e, err = parseHarbor(payload)
+	default:
+		return 0, UnsupportedProviderError{provider}
+	}
+	if err != nil || e == nil {
+		return 0, err
+	}
+	return r.enqueue(provider, e)
+}
+
+// validSignature returns if the GitHub webhook is signed with the
+// secret, preferring the SHA-256 over the legacy SHA-1 signature.
+func (r *Receiver) validSignature(header http.Header, payload []byte) bool {
+	var sig string
+	var h func() hash.Hash
+	switch {
+	case header.Get("X-Hub-Signature-256") != "":
+		sig, h = strings.TrimPrefix(header.Get("X-Hub-Signature-256"), "sha256="), sha256.New
+	case header.Get("X-Hub-Signature") != "":
+		sig, h = strings.TrimPrefix(header.Get("X-Hub-Signature"), "sha1="), sha1.New
+	default:
+		return false
+	}
+	expected, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(h, r.secret)
+	mac.Write(payload)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+func (r *Receiver) validToken(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), r.secret) == 1
+}
+
+// enqueue enqueues the HelmReleases matching the event, syncing the
+// mirrors of Git chart sources first so the sync sees the push.
+func (r *Receiver) enqueue(provider string, e *event) (int, error) {
+	hrs, err := r.hrLister.List(labels.Everything())
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	for _, hr := range hrs {
+		if hr.Spec.Suspend || !r.matches(hr, e) {
+			continue
+		}
+		key, err := cache.MetaNamespaceKeyFunc(hr)
+		if err != nil {
+			continue
+		}
+		if hr.Spec.GitChartSource != nil {
+			r.mirrors.SyncMirror(hr)
+		}
+		r.queue.Add(key)
+		n++
+		r.logger.Log("info", "enqueued HelmRelease for webhook", "provider", provider, "resource", hr.ResourceID().String())
+	}
+	return n, nil
+}
+
+// matches returns if the chart source of the HelmRelease refers to
+// the pushed repository or chart.
+func (r *Receiver) matches(hr *v1.HelmRelease, e *event) bool {
+	switch {
+	case hr.Spec.GitChartSource != nil && len(e.gitURLs) > 0:
+		if !matchesRef(hr.Spec.GitChartSource.RefOrDefault(r.defaultGitRef), e.ref) {
+			return false
+		}
+		source := normalizeGitURL(hr.Spec.GitURL)
+		for _, u := range e.gitURLs {
+			if normalizeGitURL(u) == source {
+				return true
+			}
+		}
+	case hr.Spec.RepoChartSource != nil && e.chart != "":
+		return hr.Spec.Name == e.chart && normalizeRepoURL(hr.Spec.RepoURL) == normalizeRepoURL(e.chartRepoURL)
+	}
+	return false
+}
+
+// matchesRef returns if the pushed ref is the ref of a chart source.
+func matchesRef(ref, pushed string) bool {
+	if pushed == "" {
+		return true
+	}
+	return ref == pushed || "refs/heads/"+ref == pushed || "refs/tags/"+ref == pushed
+}
+
+// normalizeGitURL returns the host and path of the Git URL, so the
+// HTTP(S) and SSH URLs of a repository compare equal.
+func normalizeGitURL(gitURL string) string {
+	s := gitURL
+	if !strings.Contains(s, "://") {
+		// scp-like syntax, i.e. git@github.com:org/repo
+		if i := strings.Index(s, ":"); i > 0 {
+			s = "ssh://" + s[:i] + "/" + s[i+1:]
+		}
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return gitURL
+	}
+	p := strings.TrimSuffix(strings.TrimSuffix(path.Clean(u.Path), "/"), ".git")
+	return strings.ToLower(u.Hostname()) + p
+}
+
+// normalizeRepoURL returns the host and path of the chart repository
+// URL.
+func normalizeRepoURL(repoURL string) string {
+	s := repoURL
+	if !strings.Contains(s, "://") {
+		s = "//" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return repoURL
+	}
+	return strings.ToLower(u.Hostname()) + strings.TrimSuffix(path.Clean("/"+u.Path), "/")
+}
+
+func parseGitHub(eventType string, payload []byte) (*event, error) {
+	if eventType != "push" {
+		return nil, nil
+	}
+	var push struct {
+		Ref        string `json:"ref"`
+		Repository struct {
+			CloneURL string `json:"clone_url"`
+			SSHURL   string `json:"ssh_url"`
+			HTMLURL  string `json:"html_url"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(payload, &push); err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub push event: %w", err)
+	}
+	return &event{
+		gitURLs: nonEmpty(push.Repository.CloneURL, push.Repository.SSHURL, push.Repository.HTMLURL),
+		ref:     push.Ref,
+	}, nil
+}
+
+func parseGitLab(eventType string, payload []byte) (*event, error) {
+	if eventType != "Push Hook" && eventType != "Tag Push Hook" {
+		return nil, nil
+	}
+	var push struct {
+		Ref     string `json:"ref"`
+		Project struct {
+			GitHTTPURL string `json:"git_http_url"`
+			GitSSHURL  string `json:"git_ssh_url"`
+			WebURL     string `json:"web_url"`
+		} `json:"project"`
+	}
+	if err := json.Unmarshal(payload, &push); err != nil {
+		return nil, fmt.Errorf("failed to parse GitLab push event: %w", err)
+	}
+	return &event{
+		gitURLs: nonEmpty(push.Project.GitHTTPURL, push.Project.GitSSHURL, push.Project.WebURL),
+		ref:     push.Ref,
+	}, nil
+}
+
+// parseHarbor parses chart uploads to the chart repositories of
+// Harbor projects, which are served at `<host>/chartrepo/<project>`.
+func parseHarbor(payload []byte) (*event, error) {
+	var upload struct {
+		Type      string `json:"type"`
+		EventData struct {
+			Resources []struct {
+				ResourceURL string `json:"resource_url"`
+			} `json:"resources"`
+			Repository struct {
+				Name string `json:"name"`
+			} `json:"repository"`
+		} `json:"event_data"`
+	}
+	if err := json.Unmarshal(payload, &upload); err != nil {
+		return nil, fmt.Errorf("failed to parse Harbor event: %w", err)
+	}
+	if upload.Type != "UPLOAD_CHART" || len(upload.EventData.Resources) == 0 {
+		return nil, nil
+	}
+	// i.e. https://harbor.example.com/chartrepo/library/charts/podinfo-1.0.0.tgz
+	resourceURL := upload.EventData.Resources[0].ResourceURL
+	i := strings.LastIndex(resourceURL, "/charts/")
+	if i < 0 {
+		return nil, fmt.Errorf("unexpected URL of uploaded chart: %s", resourceURL)
+	}
+	return &event{
+		chartRepoURL: resourceURL[:i],
+		chart:        upload.EventData.Repository.Name,
+	}, nil
+}
+
+func nonEmpty(values ...string) []string {
+	var res []string
+	for _, v := range values {
+		if v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
@@ -0,0 +1,171 @@
+package registry
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const (
+	// cosignSignatureAnnotation is the annotation of the layers of a
+	// cosign signature manifest holding the signature of the layer.
+	cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+	// maxCosignPayloadSize is the maximum size of a signed payload
+	// read from the registry.
+	maxCosignPayloadSize = 1 << 20
+	signatureMediaTypes  = "application/vnd.oci.image.manifest.v1+json," +
+		"application/vnd.docker.distribution.manifest.v2+json"
+)
+
+// ParsePublicKey parses the given PEM encoded public key, as written
+// by `cosign generate-key-pair`.
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded public key found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	return key, nil
+}
+
+// VerifyCosign verifies the tag of the given image has been signed
+// with cosign using the private key of the given public key. It
+// returns the verified digest of the image.
+func (c *Client) VerifyCosign(image string, creds map[string]Credentials, key crypto.PublicKey) (string, error) {
+	digest, err := c.Digest(image, creds)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve digest of '%s': %w", image, err)
+	}
+	domain, repository, _ := ParseReference(image)
+	registryCreds := credentialsFor(creds, domain)
+
+	// cosign stores the signatures of a digest in a manifest tagged
+	// with the digest, every layer of it is a signed payload
+	sigTag := strings.Replace(digest, ":", "-", 1) + ".sig"
+	resp, err := c.do(http.MethodGet, manifestURL(domain, repository, sigTag), signatureMediaTypes, registryCreds)
+	if err != nil {
+		return "", err
+	}
+	var manifest struct {
+		Layers []struct {
+			Digest      string            `json:"digest"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"layers"`
+	}
+	err = func() error {
+		defer resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusOK:
+		case http.StatusNotFound:
+			return fmt.Errorf("no cosign signatures found for '%s@%s'", image, digest)
+		default:
+			return fmt.Errorf("registry responded with status %d", resp.StatusCode)
+		}
+		return json.NewDecoder(io.LimitReader(resp.Body, maxCosignPayloadSize)).Decode(&manifest)
+	}()
+	if err != nil {
+		return "", err
+	}
+
+	var lastErr error
+	for _, layer := range manifest.Layers {
+		sig, ok := layer.Annotations[cosignSignatureAnnotation]
+		if !ok {
+			continue
+		}
+		payload, err := c.blob(domain, repository, layer.Digest, registryCreds)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if lastErr = verifyCosignPayload(payload, sig, digest, key); lastErr == nil {
+			return digest, nil
+		}
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no cosign signatures found")
+	}
+	return "", fmt.Errorf("no valid cosign signature for '%s@%s': %w", image, digest, lastErr)
+}
+
+// blob returns the contents of the blob with the given digest, after
+// verifying them against the digest.
+func (c *Client) blob(domain, repository, digest string, creds *Credentials) ([]byte, error) {
+	if !strings.HasPrefix(digest, "sha256:") {
+		return nil, fmt.Errorf("unsupported digest '%s'", digest)
+	}
+	u := fmt.Sprintf("https://%s/v2/%s/blobs/%s", registryHost(domain), repository, digest)
+	resp, err := c.do(http.MethodGet, u, "*/*", creds)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("registry responded with status %d", resp.StatusCode)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxCosignPayloadSize))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(b)
+	if "sha256:"+hex.EncodeToString(sum[:]) != digest {
+		return nil, fmt.Errorf("blob does not match digest '%s'", digest)
+	}
+	return b, nil
+}
+
+// verifyCosignPayload verifies the given base64 encoded signature of
+// the payload with the public key, and that the payload is a cosign
+// signature for the given digest.
+func verifyCosignPayload(payload []byte, signature, digest string, key crypto.PublicKey) error {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	sum := sha256.Sum256(payload)
+	var valid bool
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(k, sum[:], sig)
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig) == nil
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(k, payload, sig)
+	default:
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+	if !valid {
+		return fmt.Errorf("signature does not match the public key")
+	}
+
+	var simpleSigning struct {
+		Critical struct {
+			Image struct {
+				DockerManifestDigest string `json:"docker-manifest-digest"`
+			} `json:"image"`
+			Type string `json:"type"`
+		} `json:"critical"`
+	}
+	if err := json.Unmarshal(payload, &simpleSigning); err != nil {
+		return fmt.Errorf("invalid signed payload: %w", err)
+	}
+	if simpleSigning.Critical.Image.DockerManifestDigest != digest {
+		return fmt.Errorf("signed payload is for digest '%s'", simpleSigning.Critical.Image.DockerManifestDigest)
+	}
+	return nil
+}
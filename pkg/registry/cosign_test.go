@@ -0,0 +1,103 @@
+package registry
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyCosign(t *testing.T) {
+	const digest = "sha256:4f1d5efc2dcd0ec8e0ae3f7b7d1ab9b26d1bfb2e0a978a4bd7a4a2b1c7a3e8d0"
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	sign := func(payload string) string {
+		sum := sha256.Sum256([]byte(payload))
+		sig, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+		assert.NoError(t, err)
+		return base64.StdEncoding.EncodeToString(sig)
+	}
+	payloadFor := func(digest string) string {
+		return fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"charts/app"},"image":{"docker-manifest-digest":"%s"},"type":"cosign container image signature"},"optional":null}`, digest)
+	}
+	blobDigest := func(payload string) string {
+		sum := sha256.Sum256([]byte(payload))
+		return "sha256:" + hex.EncodeToString(sum[:])
+	}
+
+	for _, tc := range []struct {
+		name    string
+		payload string
+		sig     func(payload string) string
+		noSig   bool
+		wantErr bool
+	}{
+		{name: "valid", payload: payloadFor(digest), sig: sign},
+		{name: "not signed", noSig: true, wantErr: true},
+		{name: "other digest", payload: payloadFor("sha256:0123"), sig: sign, wantErr: true},
+		{name: "other key", payload: payloadFor(digest), wantErr: true, sig: func(payload string) string {
+			sum := sha256.Sum256([]byte(payload))
+			sig, _ := ecdsa.SignASN1(rand.Reader, other, sum[:])
+			return base64.StdEncoding.EncodeToString(sig)
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/v2/charts/app/manifests/1.0.0":
+					w.Header().Set("Docker-Content-Digest", digest)
+				case "/v2/charts/app/manifests/" + strings.Replace(digest, ":", "-", 1) + ".sig":
+					if tc.noSig {
+						w.WriteHeader(http.StatusNotFound)
+						return
+					}
+					fmt.Fprintf(w, `{"schemaVersion":2,"layers":[{"mediaType":"application/vnd.dev.cosign.simplesigning.v1+json","digest":"%s","annotations":{"%s":"%s"}}]}`,
+						blobDigest(tc.payload), cosignSignatureAnnotation, tc.sig(tc.payload))
+				case "/v2/charts/app/blobs/" + blobDigest(tc.payload):
+					fmt.Fprint(w, tc.payload)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer srv.Close()
+			host := strings.TrimPrefix(srv.URL, "https://")
+
+			c := NewClient(srv.Client())
+			verified, err := c.VerifyCosign(host+"/charts/app:1.0.0", nil, &key.PublicKey)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, digest, verified)
+		})
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.NoError(t, err)
+
+	parsed, err := ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	assert.NoError(t, err)
+	assert.Equal(t, &key.PublicKey, parsed)
+
+	_, err = ParsePublicKey([]byte("not a key"))
+	assert.Error(t, err)
+}
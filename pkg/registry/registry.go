@@ -0,0 +1,384 @@
+/*
+Package registry implements a minimal client for the Docker registry
+HTTP API, to resolve image tags to digests and to list the tags of
+image repositories.
+*/
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// digestCacheTTL is the duration a resolved image digest is cached
+	// for.
+	digestCacheTTL = 5 * time.Minute
+	// manifestMediaTypes are the media types accepted when resolving
+	// a digest; manifest lists are preferred, so that the digest is
+	// valid for all platforms.
+	manifestMediaTypes = "application/vnd.docker.distribution.manifest.list.v2+json," +
+		"application/vnd.oci.image.index.v1+json," +
+		"application/vnd.docker.distribution.manifest.v2+json," +
+		"application/vnd.oci.image.manifest.v1+json"
+)
+
+// Credentials holds the credentials for a registry.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// CredentialsFromSecret returns the credentials per registry domain
+// from the given Docker config Secret. Secrets of other types yield
+// no credentials.
+func CredentialsFromSecret(secret *corev1.Secret) (map[string]Credentials, error) {
+	type authEntry struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Auth     string `json:"auth"`
+	}
+	var auths map[string]authEntry
+	switch secret.Type {
+	case corev1.SecretTypeDockerConfigJson:
+		var config struct {
+			Auths map[string]authEntry `json:"auths"`
+		}
+		if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &config); err != nil {
+			return nil, err
+		}
+		auths = config.Auths
+	case corev1.SecretTypeDockercfg:
+		if err := json.Unmarshal(secret.Data[corev1.DockerConfigKey], &auths); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+
+	creds := make(map[string]Credentials, len(auths))
+	for server, entry := range auths {
+		c := Credentials{Username: entry.Username, Password: entry.Password}
+		if entry.Auth != "" {
+			b, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("invalid auth for registry '%s': %w", server, err)
+			}
+			c.Username, c.Password = splitUserPass(string(b))
+		}
+		creds[normalizeDomain(server)] = c
+	}
+	return creds, nil
+}
+
+func splitUserPass(s string) (string, string) {
+	if i := strings.Index(s, ":"); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+// normalizeDomain returns the registry domain of the given server
+// address, as used in Docker configs.
+func normalizeDomain(server string) string {
+	server = strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+	if i := strings.Index(server, "/"); i >= 0 {
+		server = server[:i]
+	}
+	switch server {
+	case "index.docker.io", "registry-1.docker.io":
+		return "docker.io"
+	}
+	return server
+}
+
+// SplitImage splits the given image reference into its name, tag
+// and digest.
+func SplitImage(image string) (name, tag, digest string) {
+	name = image
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, digest = name[:i], name[i+1:]
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, tag = name[:i], name[i+1:]
+	}
+	return
+}
+
+// ParseReference returns the registry domain, repository and tag of
+// the given image reference, applying the same defaults as Docker.
+func ParseReference(image string) (domain, repository, tag string) {
+	repository, tag, _ = SplitImage(image)
+	if tag == "" {
+		tag = "latest"
+	}
+	domain = "docker.io"
+	if i := strings.Index(repository, "/"); i >= 0 {
+		if d := repository[:i]; strings.ContainsAny(d, ".:") || d == "localhost" {
+			domain, repository = normalizeDomain(d), repository[i+1:]
+		}
+	}
+	if domain == "docker.io" && !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+	return
+}
+
+// Client queries registries using the Docker registry HTTP API.
+// Resolved digests are cached per credentials, so that images which
+// are only accessible with credentials are not resolved from the
+// cache for requests without them.
+type Client struct {
+	httpClient *http.Client
+
+	mu      sync.Mutex
+	digests map[string]cachedDigest
+}
+
+type cachedDigest struct {
+	digest  string
+	expires time.Time
+}
+
+// NewClient returns a new Client using the given HTTP client, or a
+// default client if nil.
+func NewClient(httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Client{
+		httpClient: httpClient,
+		digests:    make(map[string]cachedDigest),
+	}
+}
+
+// Digest returns the digest the tag of the given image resolves to,
+// using the credentials for the registry of the image if required.
+func (c *Client) Digest(image string, creds map[string]Credentials) (string, error) {
+	domain, repository, tag := ParseReference(image)
+	registryCreds := credentialsFor(creds, domain)
+	key := domain + "/" + repository + ":" + tag
+	if registryCreds != nil {
+		sum := sha256.Sum256([]byte(registryCreds.Username + "\x00" + registryCreds.Password))
+		key += "@" + hex.EncodeToString(sum[:])
+	}
+
+	c.mu.Lock()
+	cached, ok := c.digests[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.digest, nil
+	}
+
+	resp, err := c.do(http.MethodHead, manifestURL(domain, repository, tag), manifestMediaTypes, registryCreds)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry responded with status %d", resp.StatusCode)
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("registry did not return a digest")
+	}
+
+	c.mu.Lock()
+	c.digests[key] = cachedDigest{digest: digest, expires: time.Now().Add(digestCacheTTL)}
+	c.mu.Unlock()
+	return digest, nil
+}
+
+// Tags returns all tags of the given image repository, using the
+// credentials for the registry of the repository if required.
+func (c *Client) Tags(repository string, creds map[string]Credentials) ([]string, error) {
+	domain, repository, _ := ParseReference(repository)
+	base := &url.URL{Scheme: "https", Host: registryHost(domain)}
+	next := base.ResolveReference(&url.URL{Path: fmt.Sprintf("/v2/%s/tags/list", repository), RawQuery: "n=1000"})
+
+	var tags []string
+	for next != nil {
+		resp, err := c.do(http.MethodGet, next.String(), "application/json", credentialsFor(creds, domain))
+		if err != nil {
+			return nil, err
+		}
+		var list struct {
+			Tags []string `json:"tags"`
+		}
+		err = func() error {
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("registry responded with status %d", resp.StatusCode)
+			}
+			return json.NewDecoder(resp.Body).Decode(&list)
+		}()
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, list.Tags...)
+		next = nextPage(next, resp.Header.Get("Link"))
+	}
+	return tags, nil
+}
+
+// nextPage returns the URL of the next page from the given Link
+// header, or nil if there is none.
+func nextPage(current *url.URL, link string) *url.URL {
+	if !strings.Contains(link, `rel="next"`) {
+		return nil
+	}
+	start, end := strings.Index(link, "<"), strings.Index(link, ">")
+	if start < 0 || end < start {
+		return nil
+	}
+	u, err := url.Parse(link[start+1 : end])
+	if err != nil {
+		return nil
+	}
+	return current.ResolveReference(u)
+}
+
+func registryHost(domain string) string {
+	if domain == "docker.io" {
+		return "registry-1.docker.io"
+	}
+	return domain
+}
+
+func manifestURL(domain, repository, tag string) string {
+	return fmt.Sprintf("https://%s/v2/%s/manifests/%s", registryHost(domain), repository, tag)
+}
+
+func credentialsFor(creds map[string]Credentials, domain string) *Credentials {
+	if c, ok := creds[domain]; ok {
+		return &c
+	}
+	return nil
+}
+
+// do performs the request, and repeats it with authorization if the
+// registry challenges it. The caller must close the response body.
+func (c *Client) do(method, u, accept string, creds *Credentials) (*http.Response, error) {
+	resp, err := c.request(method, u, accept, "")
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	resp.Body.Close()
+	auth, err := c.authorization(resp.Header.Get("WWW-Authenticate"), creds)
+	if err != nil {
+		return nil, err
+	}
+	return c.request(method, u, accept, auth)
+}
+
+func (c *Client) request(method, u, accept, authorization string) (*http.Response, error) {
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return c.httpClient.Do(req)
+}
+
+// authorization returns the Authorization header value satisfying the
+// given WWW-Authenticate challenge. For bearer challenges a token is
+// requested from the token service, anonymously if no credentials
+// are given.
+func (c *Client) authorization(challenge string, creds *Credentials) (string, error) {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if creds == nil {
+			return "", fmt.Errorf("registry requires credentials")
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(creds.Username+":"+creds.Password)), nil
+	case "bearer":
+		realm, err := url.Parse(params["realm"])
+		if err != nil || params["realm"] == "" {
+			return "", fmt.Errorf("invalid token realm '%s'", params["realm"])
+		}
+		q := realm.Query()
+		for _, p := range []string{"service", "scope"} {
+			if v := params[p]; v != "" {
+				q.Set(p, v)
+			}
+		}
+		realm.RawQuery = q.Encode()
+		req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+		if err != nil {
+			return "", err
+		}
+		if creds != nil {
+			req.SetBasicAuth(creds.Username, creds.Password)
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("failed to request token: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("token service responded with status %d", resp.StatusCode)
+		}
+		var token struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+			return "", fmt.Errorf("failed to decode token: %w", err)
+		}
+		if token.Token == "" {
+			token.Token = token.AccessToken
+		}
+		return "Bearer " + token.Token, nil
+	}
+	return "", fmt.Errorf("unsupported authentication challenge '%s'", challenge)
+}
+
+// parseChallenge parses a WWW-Authenticate challenge into its scheme
+// and parameters.
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := make(map[string]string)
+	challenge = strings.TrimSpace(challenge)
+	i := strings.Index(challenge, " ")
+	if i < 0 {
+		return challenge, params
+	}
+	scheme, rest := challenge[:i], challenge[i+1:]
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " ,")
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if end := strings.Index(rest, ","); end >= 0 {
+			value, rest = rest[:end], rest[end:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = value
+	}
+	return scheme, params
+}
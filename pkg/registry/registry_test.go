@@ -0,0 +1,109 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestParseReference(t *testing.T) {
+	for image, expected := range map[string][3]string{
+		"nginx":                                {"docker.io", "library/nginx", "latest"},
+		"nginx:1.19":                           {"docker.io", "library/nginx", "1.19"},
+		"org/app:v1":                           {"docker.io", "org/app", "v1"},
+		"index.docker.io/org/app:v1":           {"docker.io", "org/app", "v1"},
+		"registry.example.com/team/app:v2":     {"registry.example.com", "team/app", "v2"},
+		"localhost:5000/app":                   {"localhost:5000", "app", "latest"},
+		"localhost/app:v3@sha256:0123456789ab": {"localhost", "app", "v3"},
+	} {
+		domain, repository, tag := ParseReference(image)
+		assert.Equal(t, expected, [3]string{domain, repository, tag}, image)
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.example.com/token",service="registry.example.com",scope="repository:app:pull,push"`)
+	assert.Equal(t, "Bearer", scheme)
+	assert.Equal(t, map[string]string{
+		"realm":   "https://auth.example.com/token",
+		"service": "registry.example.com",
+		"scope":   "repository:app:pull,push",
+	}, params)
+}
+
+func TestCredentialsFromSecret(t *testing.T) {
+	creds, err := CredentialsFromSecret(&corev1.Secret{
+		Type: corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{
+			corev1.DockerConfigJsonKey: []byte(`{"auths":{
+				"https://index.docker.io/v1/":{"auth":"dXNlcjpzZWNyZXQ="},
+				"registry.example.com":{"username":"robot","password":"p4ss"}}}`),
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]Credentials{
+		"docker.io":            {Username: "user", Password: "secret"},
+		"registry.example.com": {Username: "robot", Password: "p4ss"},
+	}, creds)
+
+	creds, err = CredentialsFromSecret(&corev1.Secret{Type: corev1.SecretTypeOpaque})
+	assert.NoError(t, err)
+	assert.Nil(t, creds)
+}
+
+func TestClientTags(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Query().Get("last") {
+		case "":
+			w.Header().Set("Link", `</v2/team/app/tags/list?n=2&last=v2>; rel="next"`)
+			fmt.Fprint(w, `{"name":"team/app","tags":["v1","v2"]}`)
+		default:
+			fmt.Fprint(w, `{"name":"team/app","tags":["v3"]}`)
+		}
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	c := NewClient(srv.Client())
+	tags, err := c.Tags(host+"/team/app", map[string]Credentials{host: {Username: "user", Password: "secret"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v1", "v2", "v3"}, tags)
+
+	_, err = c.Tags(host+"/team/app", nil)
+	assert.Error(t, err)
+}
+
+func TestClientDigest(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", "sha256:0123")
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	c := NewClient(srv.Client())
+	digest, err := c.Digest(host+"/team/app:v1", map[string]Credentials{host: {Username: "user", Password: "secret"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:0123", digest)
+
+	// the digest resolved with credentials is not served from the
+	// cache to requests without them, or with other credentials
+	_, err = c.Digest(host+"/team/app:v1", nil)
+	assert.Error(t, err)
+	_, err = c.Digest(host+"/team/app:v1", map[string]Credentials{host: {Username: "user", Password: "guess"}})
+	assert.Error(t, err)
+}
@@ -1,15 +1,19 @@
 package release
 
 import (
-	"context"
-	"errors"
-	"os/exec"
-	"strings"
-	"time"
+	"encoding/json"
+	"fmt"
 
 	"helm.sh/helm/v3/pkg/releaseutil"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/yaml"
 
 	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
@@ -22,60 +26,77 @@ import (
 // of the `v1.HelmRelease`. In case the annotation is not found, we
 // assume the release has been installed manually and we want to
 // take over.
-func managedByHelmRelease(release *helm.Release, hr v1.HelmRelease) (bool, string, error) {
-	objs := releaseManifestToUnstructured(release.Manifest)
+func managedByHelmRelease(client dynamic.Interface, mapper meta.RESTMapper, release *helm.Release, hr v1.HelmRelease) (bool, string, error) {
+	antecedent, err := releaseAntecedent(client, mapper, release)
+	if err != nil {
+		return false, "", err
+	}
+	if antecedent == "" {
+		return true, hr.ResourceID().String(), nil
+	}
+	return antecedent == hr.ResourceID().String(), antecedent, nil
+}
 
-	escapedAnnotation := strings.ReplaceAll(v1.AntecedentAnnotation, ".", `\.`)
-	args := []string{"-o", "jsonpath={.metadata.annotations." + escapedAnnotation + "}", "get"}
+// releaseAntecedent returns the antecedent annotation of the first
+// resource of the given `helm.Release` which can be retrieved from the
+// cluster, being the resource ID of the `v1.HelmRelease` managing the
+// release. It is empty if the resource has no antecedent annotation,
+// or if none of the resources exist.
+func releaseAntecedent(client dynamic.Interface, mapper meta.RESTMapper, release *helm.Release) (string, error) {
+	objs := releaseManifestToUnstructured(release.Manifest)
 
 	errs := errCollection{}
-	for ns, res := range namespacedResourceMap(objs, release.Namespace) {
-		for _, r := range res {
-			a := append(args, "--namespace", ns, r)
-
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			cmd := exec.CommandContext(ctx, "kubectl", a...)
-			out, err := cmd.Output()
-			cancel()
-			if err != nil {
-				errs = append(errs, err)
-			}
+	for _, obj := range objs {
+		ri, err := resourceInterfaceFor(client, mapper, obj, release.Namespace)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
 
-			v := strings.TrimSpace(string(out))
-			if v == "" {
-				return true, hr.ResourceID().String(), nil
+		var current *unstructured.Unstructured
+		err = retry.OnError(retry.DefaultBackoff, isRetriable, func() (err error) {
+			current, err = ri.Get(obj.GetName(), metav1.GetOptions{})
+			return
+		})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
 			}
-			return v == hr.ResourceID().String(), v, nil
+			errs = append(errs, fmt.Errorf("failed to get %s: %w", objectDescription(obj, release.Namespace), err))
+			continue
 		}
+
+		// The first resource we are able to retrieve determines
+		// ownership over the release.
+		return current.GetAnnotations()[v1.AntecedentAnnotation], nil
 	}
 
 	if !errs.Empty() {
-		return false, "", errs
+		return "", errs
 	}
-	return true, hr.ResourceID().String(), nil
+	return "", nil
 }
 
 // annotateResources annotates each of the resources created (or updated)
-// by the release so that we can spot them.
-func annotateResources(rel *helm.Release, resourceID resource.ID) error {
+// by the release so that we can spot them. The annotation is owned by
+// the given field manager.
+func annotateResources(client dynamic.Interface, mapper meta.RESTMapper, rel *helm.Release, resourceID resource.ID, fieldManager string) error {
 	objs := releaseManifestToUnstructured(rel.Manifest)
 
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				v1.AntecedentAnnotation: resourceID.String(),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
 	errs := errCollection{}
-	for namespace, res := range namespacedResourceMap(objs, rel.Namespace) {
-		args := []string{"annotate", "--overwrite"}
-		args = append(args, "--namespace", namespace)
-		args = append(args, res...)
-		args = append(args, v1.AntecedentAnnotation+"="+resourceID.String())
-
-		// The timeout is set to a high value as it may take some time
-		// to annotate large umbrella charts.
-		ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
-		defer cancel()
-
-		cmd := exec.CommandContext(ctx, "kubectl", args...)
-		output, err := cmd.CombinedOutput()
-		if err != nil && len(output) > 0 {
-			err = errors.New(string(output))
+	for _, obj := range objs {
+		if err := patchResource(client, mapper, obj, rel.Namespace, patch, fieldManager); err != nil {
 			errs = append(errs, err)
 		}
 	}
@@ -86,6 +107,75 @@ func annotateResources(rel *helm.Release, resourceID resource.ID) error {
 	return nil
 }
 
+// patchResource applies the given JSON merge patch to the cluster
+// object matching the given object as the given field manager,
+// retrying on transient errors. A merge patch is used rather than a strategic merge patch, as the
+// latter is not supported for custom resources.
+func patchResource(client dynamic.Interface, mapper meta.RESTMapper, obj unstructured.Unstructured, releaseNamespace string, patch []byte, fieldManager string) error {
+	ri, err := resourceInterfaceFor(client, mapper, obj, releaseNamespace)
+	if err != nil {
+		return err
+	}
+	err = retry.OnError(retry.DefaultBackoff, isRetriable, func() error {
+		_, err := ri.Patch(obj.GetName(), types.MergePatchType, patch, metav1.PatchOptions{FieldManager: fieldManager})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to patch %s: %w", objectDescription(obj, releaseNamespace), err)
+	}
+	return nil
+}
+
+// resourceInterfaceFor returns the dynamic resource interface for the
+// given object. Objects without a namespace, which are not cluster
+// scoped, are mapped against the given release namespace.
+func resourceInterfaceFor(client dynamic.Interface, mapper meta.RESTMapper, obj unstructured.Unstructured, releaseNamespace string) (dynamic.ResourceInterface, error) {
+	gvk := obj.GroupVersionKind()
+	mapping, err := restMapping(mapper, gvk)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map %s to a resource: %w", objectDescription(obj, releaseNamespace), err)
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return client.Resource(mapping.Resource), nil
+	}
+	namespace := obj.GetNamespace()
+	if namespace == "" {
+		namespace = releaseNamespace
+	}
+	return client.Resource(mapping.Resource).Namespace(namespace), nil
+}
+
+// restMapping maps the given kind to a resource. Mappers caching the
+// discovered API resources, like the deferred discovery mapper, do not
+// know about kinds of CRDs installed after the cache was filled, so
+// the cache is reset and the mapping retried once on a no match.
+func restMapping(mapper meta.RESTMapper, gvk schema.GroupVersionKind) (*meta.RESTMapping, error) {
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		if m, ok := mapper.(interface{ Reset() }); ok {
+			m.Reset()
+			mapping, err = mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		}
+	}
+	return mapping, err
+}
+
+// objectDescription returns a human readable description of the given
+// object for use in errors, e.g. `Deployment default/podinfo`.
+func objectDescription(obj unstructured.Unstructured, releaseNamespace string) string {
+	namespace := obj.GetNamespace()
+	if namespace == "" {
+		namespace = releaseNamespace
+	}
+	return fmt.Sprintf("%s %s/%s", obj.GetKind(), namespace, obj.GetName())
+}
+
+// isRetriable returns if the given API error is of a transient nature.
+func isRetriable(err error) bool {
+	return apierrors.IsConflict(err) || apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err) ||
+		apierrors.IsTooManyRequests(err) || apierrors.IsInternalError(err) || apierrors.IsServiceUnavailable(err)
+}
+
 // releaseManifestToUnstructured turns a string containing YAML
 // manifests into an array of Unstructured objects.
 func releaseManifestToUnstructured(manifest string) []unstructured.Unstructured {
@@ -113,21 +203,3 @@ func releaseManifestToUnstructured(manifest string) []unstructured.Unstructured
 	}
 	return objs
 }
-
-// namespacedResourceMap iterates over the given objects and maps the
-// resource identifier against the namespace from the object, if no
-// namespace is present (either because the object kind has no namespace
-// or it belongs to the release namespace) it gets mapped against the
-// given release namespace.
-func namespacedResourceMap(objs []unstructured.Unstructured, releaseNamespace string) map[string][]string {
-	resources := make(map[string][]string)
-	for _, obj := range objs {
-		namespace := obj.GetNamespace()
-		if namespace == "" {
-			namespace = releaseNamespace
-		}
-		res := obj.GetKind() + "/" + obj.GetName()
-		resources[namespace] = append(resources[namespace], res)
-	}
-	return resources
-}
@@ -0,0 +1,46 @@
+package release
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// resettableMapper is a mapper which only learns about the kinds added
+// to it once it is reset, like a discovery mapper does about CRDs
+// installed after its cache was filled.
+type resettableMapper struct {
+	*meta.DefaultRESTMapper
+	pending []schema.GroupVersionKind
+	resets  int
+}
+
+func (m *resettableMapper) Reset() {
+	m.resets++
+	for _, gvk := range m.pending {
+		m.Add(gvk, meta.RESTScopeNamespace)
+	}
+	m.pending = nil
+}
+
+func TestRESTMapping(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	mapper := &resettableMapper{DefaultRESTMapper: meta.NewDefaultRESTMapper(nil), pending: []schema.GroupVersionKind{gvk}}
+
+	mapping, err := restMapping(mapper, gvk)
+	assert.NoError(t, err)
+	assert.Equal(t, "widgets", mapping.Resource.Resource)
+	assert.Equal(t, 1, mapper.resets)
+
+	// known kinds do not reset the mapper
+	_, err = restMapping(mapper, gvk)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, mapper.resets)
+
+	// kinds unknown after a reset are retried only once
+	_, err = restMapping(mapper, schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Gadget"})
+	assert.True(t, meta.IsNoMatchError(err))
+	assert.Equal(t, 2, mapper.resets)
+}
@@ -0,0 +1,91 @@
+package release
+
+import (
+	"fmt"
+
+	"github.com/go-kit/kit/log"
+	corev1 "k8s.io/api/core/v1"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/approval"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+// UpgradeApproved is the reason of the Event emitted when the approval
+// webhook allowed an upgrade.
+const UpgradeApproved = "UpgradeApproved"
+
+// checkApproval asks the approval webhook to approve the upgrade of
+// the HelmRelease from curRel to the dry-run release dryRel; the
+// upgrade is dry-run first if dryRel is nil. Drift is the diff of the
+// live objects, if they drifted, and missing are the resources of the
+// release the upgrade recreates. It returns an error with the
+// UpgradeDenied reason if the upgrade is denied.
+func (r *Release) checkApproval(logger log.Logger, client helm.Client, hr *apiV1.HelmRelease, curRel, dryRel *helm.Release,
+	chart chart, values []byte, drift string, missing []string) error {
+	if r.config.Approval == nil || !r.config.Approval.Applies(hr) {
+		return nil
+	}
+	if dryRel == nil {
+		var err error
+		if dryRel, _, err = r.dryRunCompare(client, curRel, hr, chart, values); err != nil {
+			status.SetStatusPhaseWithReason(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseFailed, apiV1.ReasonValuesRenderError)
+			return ReasonError{apiV1.ReasonValuesRenderError, err}
+		}
+	}
+	req := approvalRequest(hr, curRel, dryRel, chart, drift, missing)
+	if req.Diff.Empty() {
+		return nil
+	}
+
+	decision, err := r.config.Approval.Review(req)
+	if err != nil {
+		logger.Log("warning", err, "allowed", decision.Allowed)
+	}
+	if !decision.Allowed {
+		err = fmt.Errorf("upgrade denied by approval webhook")
+		if decision.Reason != "" {
+			err = fmt.Errorf("%s: %s", err, decision.Reason)
+		}
+		status.SetStatusPhaseWithMessage(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseFailed,
+			apiV1.ReasonUpgradeDenied, err.Error())
+		return ReasonError{apiV1.ReasonUpgradeDenied, err}
+	}
+	logger.Log("info", "upgrade approved", "default", decision.Default, "reason", decision.Reason)
+	if r.recorder != nil {
+		message := "upgrade approved by approval webhook"
+		if decision.Reason != "" {
+			message += ": " + decision.Reason
+		}
+		r.recorder.Event(hr, corev1.EventTypeNormal, UpgradeApproved, message)
+	}
+	return nil
+}
+
+// approvalRequest returns the approval request for the upgrade from
+// curRel to dryRel.
+func approvalRequest(hr *apiV1.HelmRelease, curRel, dryRel *helm.Release, chart chart, drift string, missing []string) approval.Request {
+	req := approval.Request{
+		Namespace:       hr.Namespace,
+		Name:            hr.Name,
+		ReleaseName:     hr.GetReleaseName(),
+		TargetNamespace: hr.GetTargetNamespace(),
+		Revision:        chart.revision,
+		Diff: approval.Diff{
+			Values:  helm.DiffValues(curRel, dryRel),
+			Chart:   helm.DiffChart(curRel, dryRel),
+			Live:    drift,
+			Missing: missing,
+		},
+	}
+	if curRel.Chart != nil {
+		req.Chart.Name = curRel.Chart.Name
+		req.Chart.FromVersion = curRel.Chart.Version
+	}
+	if dryRel.Chart != nil {
+		req.Chart.Name = dryRel.Chart.Name
+		req.Chart.ToVersion = dryRel.Chart.Version
+	}
+	return req
+}
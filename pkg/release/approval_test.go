@@ -0,0 +1,73 @@
+package release
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/approval"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+func TestCheckApproval(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"allowed": false, "reason": "not scheduled"}`))
+	}))
+	defer srv.Close()
+
+	curRel := &helm.Release{Chart: &helm.Chart{Name: "podinfo", Version: "1.0.0"}, Values: map[string]interface{}{"replicas": 1}}
+	for _, tc := range []struct {
+		name      string
+		namespace string
+		dryRel    *helm.Release
+		missing   []string
+		denied    bool
+	}{
+		{"denied", "prod", &helm.Release{Chart: &helm.Chart{Name: "podinfo", Version: "1.1.0"}, Values: map[string]interface{}{"replicas": 1}}, nil, true},
+		{"unprotected namespace", "dev", &helm.Release{Chart: &helm.Chart{Name: "podinfo", Version: "1.1.0"}}, nil, false},
+		{"no changes", "prod", curRel, nil, false},
+		{"recreate", "prod", curRel, []string{"Service prod/podinfo"}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			requests = 0
+			hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: tc.namespace, Name: "podinfo"}}
+			client := ifclientsetfake.NewSimpleClientset(hr)
+			r := &Release{
+				hrClient: client.HelmV1(),
+				recorder: record.NewFakeRecorder(1),
+				config:   Config{Approval: approval.NewWebhook(approval.Config{URL: srv.URL, Namespaces: []string{"prod"}})},
+			}
+
+			err := r.checkApproval(log.NewNopLogger(), nil, hr, curRel, tc.dryRel, chart{revision: "1.1.0"}, nil, "", tc.missing)
+			assert.Equal(t, tc.denied, err != nil)
+			assert.Equal(t, tc.denied, requests == 1)
+			if tc.denied {
+				assert.Equal(t, apiV1.ReasonUpgradeDenied, Reason(err))
+				assert.Contains(t, err.Error(), "not scheduled")
+			}
+		})
+	}
+}
+
+func TestApprovalRequest(t *testing.T) {
+	hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Name: "podinfo"}}
+	req := approvalRequest(hr,
+		&helm.Release{Chart: &helm.Chart{Name: "podinfo", Version: "1.0.0"}, Values: map[string]interface{}{"replicas": 1}},
+		&helm.Release{Chart: &helm.Chart{Name: "podinfo", Version: "1.0.0"}, Values: map[string]interface{}{"replicas": 2}},
+		chart{revision: "1.0.0"}, "", []string{"Service prod/podinfo"})
+	assert.Equal(t, approval.ChartChange{Name: "podinfo", FromVersion: "1.0.0", ToVersion: "1.0.0"}, req.Chart)
+	assert.Equal(t, "prod-podinfo", req.ReleaseName)
+	assert.Equal(t, "prod", req.TargetNamespace)
+	assert.NotEmpty(t, req.Diff.Values)
+	assert.Empty(t, req.Diff.Chart)
+	assert.Equal(t, []string{"Service prod/podinfo"}, req.Diff.Missing)
+}
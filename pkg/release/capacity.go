@@ -0,0 +1,253 @@
+package release
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+// CapacityCheckPolicy determines what happens when an upgrade is
+// estimated to request more resources than the cluster is able to
+// schedule.
+type CapacityCheckPolicy string
+
+const (
+	// CapacityCheckDisabled disables the capacity check.
+	CapacityCheckDisabled CapacityCheckPolicy = ""
+	// CapacityCheckWarn logs a warning but continues the upgrade.
+	CapacityCheckWarn CapacityCheckPolicy = "warn"
+	// CapacityCheckBlock fails the upgrade before it is applied.
+	CapacityCheckBlock CapacityCheckPolicy = "block"
+)
+
+// capacityResources are the resources taken into account while
+// estimating the capacity required by an upgrade.
+var capacityResources = []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory}
+
+// InsufficientCapacityError is returned when the additional resources
+// requested by an upgrade exceed the schedulable capacity of the
+// cluster.
+type InsufficientCapacityError struct {
+	Required  corev1.ResourceList
+	Available corev1.ResourceList
+}
+
+func (err InsufficientCapacityError) Error() string {
+	return fmt.Sprintf("upgrade requires additional %s while only %s is schedulable",
+		formatResourceList(err.Required), formatResourceList(err.Available))
+}
+
+// checkCapacity estimates the additional CPU and memory the workloads
+// in the new release request compared to the current release, and
+// compares this against the capacity which can still be scheduled on
+// the cluster. It returns an `InsufficientCapacityError` if the upgrade
+// can not possibly be scheduled. The estimate is an aggregate over all
+// nodes; it does not take scheduling constraints into account.
+func checkCapacity(coreV1Client corev1client.CoreV1Interface, curRel, newRel *helm.Release) error {
+	var current corev1.ResourceList
+	if curRel != nil {
+		current = manifestRequests(curRel.Manifest)
+	}
+	required := subtractResources(manifestRequests(newRel.Manifest), current)
+	if len(required) == 0 {
+		return nil
+	}
+
+	available, err := schedulableCapacity(coreV1Client)
+	if err != nil {
+		return fmt.Errorf("failed to determine schedulable cluster capacity: %w", err)
+	}
+	for name, q := range required {
+		if a := available[name]; q.Cmp(a) > 0 {
+			return InsufficientCapacityError{Required: required, Available: available}
+		}
+	}
+	return nil
+}
+
+// manifestRequests returns the total of resource requests of all
+// workloads with a replica count in the given manifest.
+func manifestRequests(manifest string) corev1.ResourceList {
+	total := corev1.ResourceList{}
+	for _, obj := range releaseManifestToUnstructured(manifest) {
+		switch obj.GetKind() {
+		case "Deployment", "StatefulSet", "ReplicaSet", "ReplicationController":
+		default:
+			continue
+		}
+		replicas, found, err := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+		if err != nil {
+			continue
+		}
+		if !found {
+			replicas = 1
+		}
+		tpl, found, err := unstructured.NestedMap(obj.Object, "spec", "template")
+		if err != nil || !found {
+			continue
+		}
+		var podTemplate corev1.PodTemplateSpec
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(tpl, &podTemplate); err != nil {
+			continue
+		}
+		for name, q := range podRequests(podTemplate.Spec) {
+			addResource(total, name, *resource.NewMilliQuantity(q.MilliValue()*replicas, q.Format))
+		}
+	}
+	return total
+}
+
+// podRequests returns the effective resource requests of a pod, which
+// is the highest of the sum of all app containers and the request of
+// any individual init container.
+func podRequests(spec corev1.PodSpec) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	for _, c := range spec.Containers {
+		for _, name := range capacityResources {
+			if q, ok := c.Resources.Requests[name]; ok {
+				addResource(requests, name, q)
+			}
+		}
+	}
+	for _, c := range spec.InitContainers {
+		for _, name := range capacityResources {
+			q, ok := c.Resources.Requests[name]
+			if !ok {
+				continue
+			}
+			if cur, ok := requests[name]; !ok || q.Cmp(cur) > 0 {
+				requests[name] = q.DeepCopy()
+			}
+		}
+	}
+	return requests
+}
+
+// schedulableCapacity returns the allocatable resources of all
+// schedulable and ready nodes, minus the resources requested by
+// all non-terminated pods.
+func schedulableCapacity(coreV1Client corev1client.CoreV1Interface) (corev1.ResourceList, error) {
+	nodes, err := coreV1Client.Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	allocatable := corev1.ResourceList{}
+	schedulable := map[string]bool{}
+	for _, n := range nodes.Items {
+		if n.Spec.Unschedulable || !nodeReady(n) {
+			continue
+		}
+		schedulable[n.Name] = true
+		for _, name := range capacityResources {
+			if q, ok := n.Status.Allocatable[name]; ok {
+				addResource(allocatable, name, q)
+			}
+		}
+	}
+
+	pods, err := coreV1Client.Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+		FieldSelector: "status.phase!=Succeeded,status.phase!=Failed",
+	})
+	if err != nil {
+		return nil, err
+	}
+	requested := corev1.ResourceList{}
+	for _, p := range pods.Items {
+		if !schedulable[p.Spec.NodeName] {
+			continue
+		}
+		for name, q := range podRequests(p.Spec) {
+			addResource(requested, name, q)
+		}
+	}
+
+	available := corev1.ResourceList{}
+	for _, name := range capacityResources {
+		q := allocatable[name].DeepCopy()
+		q.Sub(requested[name])
+		if q.Sign() < 0 {
+			q.Set(0)
+		}
+		available[name] = q
+	}
+	return available, nil
+}
+
+// nodeReady returns if the given node reports a ready condition.
+func nodeReady(node corev1.Node) bool {
+	for _, c := range node.Status.Conditions {
+		if c.Type == corev1.NodeReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// subtractResources returns the positive differences between the
+// resources in `a` and `b`.
+func subtractResources(a, b corev1.ResourceList) corev1.ResourceList {
+	diff := corev1.ResourceList{}
+	for name, q := range a {
+		d := q.DeepCopy()
+		if bq, ok := b[name]; ok {
+			d.Sub(bq)
+		}
+		if d.Sign() > 0 {
+			diff[name] = d
+		}
+	}
+	return diff
+}
+
+func addResource(list corev1.ResourceList, name corev1.ResourceName, q resource.Quantity) {
+	if cur, ok := list[name]; ok {
+		cur.Add(q)
+		list[name] = cur
+		return
+	}
+	list[name] = q.DeepCopy()
+}
+
+func formatResourceList(list corev1.ResourceList) string {
+	var s string
+	for _, name := range capacityResources {
+		q, ok := list[name]
+		if !ok {
+			continue
+		}
+		if s != "" {
+			s += ", "
+		}
+		s += fmt.Sprintf("%s=%s", name, q.String())
+	}
+	if s == "" {
+		return "nothing"
+	}
+	return s
+}
+
+// checkUpgradeCapacity renders the upgrade for the given HelmRelease
+// using a dry-run, and checks if the cluster has the capacity to
+// schedule the additional resources it requests.
+func (r *Release) checkUpgradeCapacity(client helm.Client, hr *apiV1.HelmRelease, curRel *helm.Release,
+	chart chart, values []byte) error {
+	dryRel, err := client.UpgradeFromPath(chart.chartPath, hr.GetReleaseName(), values, helm.UpgradeOptions{
+		DryRun:      true,
+		Namespace:   hr.GetTargetNamespace(),
+		Force:       hr.Spec.ForceUpgrade,
+		ReuseValues: hr.GetReuseValues(),
+		ResetValues: !hr.GetReuseValues(),
+	})
+	if err != nil {
+		return fmt.Errorf("dry-run upgrade for capacity check failed: %w", err)
+	}
+	return checkCapacity(r.coreV1Client, curRel, dryRel)
+}
@@ -0,0 +1,81 @@
+package release
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestManifestRequests(t *testing.T) {
+	manifest := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 3
+  template:
+    spec:
+      initContainers:
+      - name: init
+        resources:
+          requests:
+            memory: 1Gi
+      containers:
+      - name: app
+        resources:
+          requests:
+            cpu: 100m
+            memory: 128Mi
+      - name: sidecar
+        resources:
+          requests:
+            cpu: 50m
+---
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: db
+spec:
+  template:
+    spec:
+      containers:
+      - name: db
+        resources:
+          requests:
+            cpu: "1"
+            memory: 2Gi
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: ignored
+spec:
+  containers:
+  - name: ignored
+    resources:
+      requests:
+        cpu: "8"
+`
+	requests := manifestRequests(manifest)
+	assert.Equal(t, int64(1450), requests.Cpu().MilliValue())
+	expectedMemory := resource.MustParse("5Gi")
+	assert.Equal(t, expectedMemory.Value(), requests.Memory().Value())
+}
+
+func TestSubtractResources(t *testing.T) {
+	a := corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("2"),
+		corev1.ResourceMemory: resource.MustParse("1Gi"),
+	}
+	b := corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("500m"),
+		corev1.ResourceMemory: resource.MustParse("2Gi"),
+	}
+	diff := subtractResources(a, b)
+	assert.Equal(t, int64(1500), diff.Cpu().MilliValue())
+	_, ok := diff[corev1.ResourceMemory]
+	assert.False(t, ok)
+}
@@ -0,0 +1,52 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	corev1 "k8s.io/api/core/v1"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/chartsync"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+// ChartChanged is the reason of the Event emitted when the chart of a
+// Git chart source changed, describing the commit which changed it.
+const ChartChanged = "ChartChanged"
+
+// recordChartCommit records the latest commit changing the chart of
+// the Git chart source in the status of the HelmRelease and, if the
+// chart changed since the last sync, emits it as an Event, so changes
+// can be attributed to their author. Reading the commit is limited to
+// the Git timeout.
+func (r *Release) recordChartCommit(ctx context.Context, logger log.Logger, hr *apiV1.HelmRelease, chart chart) {
+	if hr.Spec.GitChartSource == nil || chart.revision == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.config.GitTimeout)
+	defer cancel()
+	commit, err := chartsync.GitCommitOf(ctx, chart.chartPath, chart.revision, ".")
+	if err != nil {
+		logger.Log("warning", fmt.Sprintf("failed to read commit of chart: %v", err))
+		return
+	}
+	if err := status.SetChartCommit(r.hrClient.HelmReleases(hr.Namespace), hr, commit); err != nil {
+		logger.Log("warning", fmt.Sprintf("failed to record chart commit in status: %v", err))
+	}
+	if chart.changed && r.recorder != nil {
+		r.recorder.Event(hr, corev1.EventTypeNormal, ChartChanged, describeCommit(commit))
+	}
+}
+
+// describeCommit returns a one line description of the commit.
+func describeCommit(commit *apiV1.GitCommit) string {
+	revision := commit.Revision
+	if len(revision) > 7 {
+		revision = revision[:7]
+	}
+	return fmt.Sprintf("chart changed in commit %s by %s at %s: %s",
+		revision, commit.Author, commit.Time.UTC().Format(time.RFC3339), commit.Subject)
+}
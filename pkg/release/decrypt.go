@@ -0,0 +1,53 @@
+package release
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/sops"
+)
+
+// valuesDecrypter decrypts the SOPS encrypted values sources of a
+// HelmRelease, with the keys of its decryption which are read when
+// they are first needed.
+type valuesDecrypter struct {
+	coreV1Client corev1client.CoreV1Interface
+	hr           *apiV1.HelmRelease
+	keys         *sops.Keys
+}
+
+func newValuesDecrypter(coreV1Client corev1client.CoreV1Interface, hr *apiV1.HelmRelease) *valuesDecrypter {
+	return &valuesDecrypter{coreV1Client: coreV1Client, hr: hr}
+}
+
+// decrypt returns the values read from the given source decrypted if
+// they are encrypted, or as is otherwise.
+func (d *valuesDecrypter) decrypt(b []byte, source string) ([]byte, error) {
+	if !sops.IsEncrypted(b) {
+		return b, nil
+	}
+	decryption := d.hr.Spec.Decryption
+	if decryption == nil || decryption.SecretRef == nil {
+		return nil, fmt.Errorf("values from %s are encrypted with SOPS, but no decryption is configured", source)
+	}
+	if decryption.Provider != apiV1.DecryptionProviderSOPS {
+		return nil, fmt.Errorf("unsupported decryption provider '%s'", decryption.Provider)
+	}
+	if d.keys == nil {
+		secret, err := d.coreV1Client.Secrets(d.hr.Namespace).Get(decryption.SecretRef.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get decryption keys: %w", err)
+		}
+		if d.keys, err = sops.ParseKeys(secret.Data); err != nil {
+			return nil, fmt.Errorf("invalid decryption keys in Secret %s/%s: %w", d.hr.Namespace, decryption.SecretRef.Name, err)
+		}
+	}
+	out, err := sops.Decrypt(b, d.keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt values from %s: %w", source, err)
+	}
+	return out, nil
+}
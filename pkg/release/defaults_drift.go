@@ -0,0 +1,109 @@
+package release
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+// ChartDefaultsChanged is the reason of the Event emitted when the
+// default values of the chart changed in an upgrade which reuses the
+// values of the release, and the changes are thus ignored.
+const ChartDefaultsChanged = "ChartDefaultsChanged"
+
+// maxDefaultsDriftPaths is the maximum number of changed paths listed
+// in the Event message.
+const maxDefaultsDriftPaths = 20
+
+// reportChartDefaultsDrift reports the default values of the chart
+// which changed since the current release, when the upgrade reuses
+// the values of the release. Helm upgrades with reused values keep
+// the chart defaults of the current release, so these changes would
+// otherwise silently be ignored. Changes to values overridden by the
+// reused or given values are not reported, as they have no effect.
+func (r *Release) reportChartDefaultsDrift(logger log.Logger, client helm.Client, hr *apiV1.HelmRelease,
+	curRel *helm.Release, chart chart, values []byte) error {
+	if !r.config.ChartDefaultsDrift || !hr.GetReuseValues() || curRel == nil || curRel.Chart == nil {
+		return nil
+	}
+	newDefaults, err := client.GetChartValues(chart.chartPath)
+	if err != nil {
+		return err
+	}
+	var overrides map[string]interface{}
+	if err := yaml.Unmarshal(values, &overrides); err != nil {
+		return fmt.Errorf("failed to parse values: %w", err)
+	}
+	paths := chartDefaultsDrift(curRel.Chart.Values, newDefaults, curRel.Values, overrides)
+	if len(paths) == 0 {
+		return nil
+	}
+	logger.Log("warning", "chart default values changed, but are ignored as the values of the release are reused; set resetValues to apply them",
+		"paths", strings.Join(paths, ","))
+	if r.recorder != nil {
+		listed := paths
+		if len(listed) > maxDefaultsDriftPaths {
+			listed = append(listed[:maxDefaultsDriftPaths:maxDefaultsDriftPaths], fmt.Sprintf("and %d more", len(paths)-maxDefaultsDriftPaths))
+		}
+		r.recorder.Event(hr, corev1.EventTypeWarning, ChartDefaultsChanged,
+			fmt.Sprintf("default values of chart changed but are ignored as the release values are reused: %s", strings.Join(listed, ", ")))
+	}
+	return nil
+}
+
+// chartDefaultsDrift returns the sorted paths of the values which
+// differ between the old and new defaults, and are not overridden by
+// any of the given overrides.
+func chartDefaultsDrift(oldDefaults, newDefaults map[string]interface{}, overrides ...map[string]interface{}) []string {
+	var paths []string
+	diffDefaults("", oldDefaults, newDefaults, overrides, &paths)
+	sort.Strings(paths)
+	return paths
+}
+
+func diffDefaults(prefix string, oldValues, newValues map[string]interface{}, overrides []map[string]interface{}, paths *[]string) {
+	keys := make(map[string]bool)
+	for k := range oldValues {
+		keys[k] = true
+	}
+	for k := range newValues {
+		keys[k] = true
+	}
+	for k := range keys {
+		path := prefix + k
+		oldValue, newValue := oldValues[k], newValues[k]
+		var nested []map[string]interface{}
+		overridden := false
+		for _, o := range overrides {
+			v, ok := o[k]
+			if !ok {
+				continue
+			}
+			if m, isMap := v.(map[string]interface{}); isMap {
+				nested = append(nested, m)
+				continue
+			}
+			overridden = true
+		}
+		if overridden {
+			continue
+		}
+		oldMap, oldIsMap := oldValue.(map[string]interface{})
+		newMap, newIsMap := newValue.(map[string]interface{})
+		if oldIsMap && newIsMap {
+			diffDefaults(path+".", oldMap, newMap, nested, paths)
+			continue
+		}
+		if !reflect.DeepEqual(oldValue, newValue) {
+			*paths = append(*paths, path)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package release
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/yaml"
+)
+
+func TestChartDefaultsDrift(t *testing.T) {
+	parse := func(s string) map[string]interface{} {
+		var m map[string]interface{}
+		assert.NoError(t, yaml.Unmarshal([]byte(s), &m))
+		return m
+	}
+	oldDefaults := parse(`
+replicas: 1
+image:
+  repository: podinfo
+  tag: 1.0.0
+resources:
+  limits:
+    cpu: 100m
+removed: true
+`)
+	newDefaults := parse(`
+replicas: 2
+image:
+  repository: podinfo
+  tag: 2.0.0
+resources:
+  limits:
+    cpu: 200m
+added: true
+`)
+	reused := parse(`
+image:
+  tag: 1.2.0
+`)
+	given := parse(`
+resources: {}
+replicas: 3
+`)
+
+	assert.Equal(t, []string{"added", "removed", "resources.limits.cpu"}, chartDefaultsDrift(oldDefaults, newDefaults, reused, given))
+	assert.Equal(t, []string{"added", "image.tag", "removed", "replicas", "resources.limits.cpu"}, chartDefaultsDrift(oldDefaults, newDefaults))
+	assert.Empty(t, chartDefaultsDrift(oldDefaults, oldDefaults))
+}
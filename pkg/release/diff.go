@@ -0,0 +1,66 @@
+package release
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/notify"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+const (
+	// ReleaseDiffDetected is the reason of the Event emitted when a
+	// difference is detected during the release comparison.
+	ReleaseDiffDetected = "ReleaseDiffDetected"
+
+	// maxDiffSummarySize is the maximum size of the diff summary
+	// recorded in the status.
+	maxDiffSummarySize = 4096
+	// maxDiffEventSize is the maximum size of the diff in the Event
+	// message.
+	maxDiffEventSize = 1024
+)
+
+// recordDiff records a summary of the given diff in the status of the
+// HelmRelease and, if configured, emits it as an Event. As the diff
+// may contain sensitive values, it is only recorded when diffs are
+// logged; the drift is notified without the diff.
+func (r *Release) recordDiff(logger log.Logger, hr *apiV1.HelmRelease, chart chart, diff string) {
+	r.notify(notify.DriftDetected, hr, nil, fmt.Sprintf("difference detected during release comparison of revision '%s'", chart.revision))
+	if !r.config.LogDiffs {
+		return
+	}
+	summary, truncated := truncateDiff(diff, maxDiffSummarySize)
+	lastDiff := &apiV1.ReleaseDiff{
+		Time:      metav1.Now(),
+		Revision:  chart.revision,
+		Summary:   summary,
+		Truncated: truncated,
+	}
+	if err := status.SetLastDiff(r.hrClient.HelmReleases(hr.Namespace), hr, lastDiff); err != nil {
+		logger.Log("warning", fmt.Sprintf("failed to record diff in status: %v", err))
+	}
+	if r.config.DiffEvents && r.recorder != nil {
+		message, _ := truncateDiff(diff, maxDiffEventSize)
+		r.recorder.Event(hr, corev1.EventTypeNormal, ReleaseDiffDetected, message)
+	}
+}
+
+// truncateDiff truncates the given diff to at most max bytes, on a
+// line boundary if possible. It returns the diff and if it has been
+// truncated.
+func truncateDiff(diff string, max int) (string, bool) {
+	if len(diff) <= max {
+		return diff, false
+	}
+	diff = diff[:max]
+	if i := strings.LastIndex(diff, "\n"); i > 0 {
+		diff = diff[:i+1]
+	}
+	return diff, true
+}
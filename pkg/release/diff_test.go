@@ -0,0 +1,21 @@
+package release
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTruncateDiff(t *testing.T) {
+	diff, truncated := truncateDiff("a\nb\n", 10)
+	assert.Equal(t, "a\nb\n", diff)
+	assert.False(t, truncated)
+
+	diff, truncated = truncateDiff("first line\nsecond line\n", 15)
+	assert.Equal(t, "first line\n", diff)
+	assert.True(t, truncated)
+
+	diff, truncated = truncateDiff("a single long line", 8)
+	assert.Equal(t, "a single", diff)
+	assert.True(t, truncated)
+}
@@ -0,0 +1,158 @@
+package release
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+// maxDriftReports is the maximum number of drifted fields reported
+// by `liveDrift`.
+const maxDriftReports = 10
+
+// liveDrift compares the objects in the manifest of the given release
+// with the live objects on the cluster. An object has drifted when it
+// no longer exists, or when any of the fields set in the manifest has
+// a different value in the live object; fields which are only present
+// in the live object (e.g. defaults and status) are ignored. It
+// returns a description of the drifted fields, or an empty string if
+// there is no drift.
+func liveDrift(client dynamic.Interface, mapper meta.RESTMapper, rel *helm.Release) (string, error) {
+	var drift []string
+	for _, obj := range releaseManifestToUnstructured(rel.Manifest) {
+		ri, err := resourceInterfaceFor(client, mapper, obj, rel.Namespace)
+		if err != nil {
+			return "", err
+		}
+		var live *unstructured.Unstructured
+		err = retry.OnError(retry.DefaultBackoff, isRetriable, func() (err error) {
+			live, err = ri.Get(obj.GetName(), metav1.GetOptions{})
+			return
+		})
+		desc := objectDescription(obj, rel.Namespace)
+		switch {
+		case apierrors.IsNotFound(err):
+			drift = append(drift, fmt.Sprintf("%s: missing", desc))
+		case err != nil:
+			return "", fmt.Errorf("failed to get %s: %w", desc, err)
+		default:
+			desired := obj.DeepCopy().Object
+			// these are managed by the operator and the API server
+			delete(desired, "status")
+			unstructured.RemoveNestedField(desired, "metadata", "namespace")
+			if obj.GetKind() == "Secret" {
+				// the API server merges stringData into data
+				delete(desired, "stringData")
+			}
+			for _, d := range subsetDiff("", desired, live.Object) {
+				drift = append(drift, fmt.Sprintf("%s: %s", desc, d))
+			}
+		}
+		if len(drift) >= maxDriftReports {
+			drift = append(drift[:maxDriftReports], "...")
+			break
+		}
+	}
+	return strings.Join(drift, "\n"), nil
+}
+
+// subsetDiff returns the paths of the fields in `desired` which are
+// absent in, or differ from, `live`.
+func subsetDiff(path string, desired, live interface{}) []string {
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return []string{pathOrRoot(path) + " differs"}
+		}
+		var diffs []string
+		for k, v := range d {
+			lv, ok := l[k]
+			if !ok {
+				if v == nil {
+					continue
+				}
+				diffs = append(diffs, path+"."+k+" is missing")
+				continue
+			}
+			diffs = append(diffs, subsetDiff(path+"."+k, v, lv)...)
+		}
+		return diffs
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok || len(d) != len(l) {
+			return []string{pathOrRoot(path) + " differs"}
+		}
+		var diffs []string
+		for i := range d {
+			diffs = append(diffs, subsetDiff(fmt.Sprintf("%s[%d]", path, i), d[i], l[i])...)
+		}
+		return diffs
+	}
+	if scalarEqual(desired, live) {
+		return nil
+	}
+	return []string{pathOrRoot(path) + " differs"}
+}
+
+// scalarEqual compares two scalar values, treating numbers of
+// different types and quantities with different notations (e.g.
+// `1000m` and `1`) as equals.
+func scalarEqual(a, b interface{}) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	if af, ok := toFloat(a); ok {
+		bf, ok := toFloat(b)
+		return ok && af == bf
+	}
+	as, ok := a.(string)
+	if !ok {
+		return false
+	}
+	var bs string
+	switch v := b.(type) {
+	case string:
+		bs = v
+	case int64, float64:
+		// the API server may return a quantity as a number
+		bs = fmt.Sprint(v)
+	default:
+		return false
+	}
+	aq, err := resource.ParseQuantity(as)
+	if err != nil {
+		return false
+	}
+	bq, err := resource.ParseQuantity(bs)
+	return err == nil && aq.Cmp(bq) == 0
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "."
+	}
+	return path
+}
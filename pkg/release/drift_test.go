@@ -0,0 +1,56 @@
+package release
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubsetDiff(t *testing.T) {
+	desired := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas": int64(2),
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{
+							"name":  "app",
+							"image": "nginx:1.19",
+							"resources": map[string]interface{}{
+								"limits": map[string]interface{}{"cpu": "1000m"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	live := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas":             float64(2),
+			"revisionHistoryLimit": int64(10),
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{
+							"name":            "app",
+							"image":           "nginx:1.19",
+							"imagePullPolicy": "IfNotPresent",
+							"resources": map[string]interface{}{
+								"limits": map[string]interface{}{"cpu": "1"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	assert.Empty(t, subsetDiff("", desired, live))
+
+	live["spec"].(map[string]interface{})["replicas"] = int64(5)
+	delete(live["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})[0].(map[string]interface{}), "image")
+	assert.ElementsMatch(t, []string{
+		".spec.replicas differs",
+		".spec.template.spec.containers[0].image is missing",
+	}, subsetDiff("", desired, live))
+}
@@ -0,0 +1,101 @@
+package release
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	corev1 "k8s.io/api/core/v1"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/freeze"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+const (
+	// FreezeOverrideAnnotation overrides release freezes for the
+	// HelmRelease in an emergency while it is set; its value should
+	// give the reason of the override.
+	FreezeOverrideAnnotation = "helm.fluxcd.io/freeze-override"
+
+	// FreezeOverridden is the reason of the Event emitted when an
+	// upgrade during a release freeze proceeds due to an override.
+	FreezeOverridden = "FreezeOverridden"
+
+	// freezeRecheckInterval is the interval the freeze windows are
+	// determined again at, while they can not be determined.
+	freezeRecheckInterval = time.Minute
+)
+
+// FrozenError is returned for syncs which held an upgrade during a
+// release freeze, or because the freeze windows could not be
+// determined, in which case Err holds why and the Window ends when
+// they are determined again.
+type FrozenError struct {
+	Window freeze.Window
+	Err    error
+}
+
+func (err FrozenError) Error() string {
+	if err.Err != nil {
+		return fmt.Sprintf("upgrade held until %s, failed to determine release freeze windows: %v", err.Window.End.UTC().Format(time.RFC3339), err.Err)
+	}
+	msg := fmt.Sprintf("upgrade held during release freeze '%s' until %s", err.Window.Name, err.Window.End.UTC().Format(time.RFC3339))
+	if err.Window.Reason != "" {
+		msg += ": " + err.Window.Reason
+	}
+	return msg
+}
+
+// Frozen returns the freeze window the sync which returned the error
+// held an upgrade during, or nil.
+func Frozen(err error) *freeze.Window {
+	if errs, ok := err.(errCollection); ok {
+		for _, err := range errs {
+			if w := Frozen(err); w != nil {
+				return w
+			}
+		}
+		return nil
+	}
+	var frozenErr FrozenError
+	if errors.As(err, &frozenErr) {
+		return &frozenErr.Window
+	}
+	return nil
+}
+
+// checkFreeze returns a FrozenError if an upgrade of the HelmRelease
+// should be held due to a release freeze, recording the held changes
+// in the FrozenPendingChanges condition. If the freeze windows can not
+// be determined, the upgrade is held as well until they are determined
+// again; as with any held upgrade, this does not fail the sync.
+func (r *Release) checkFreeze(logger log.Logger, hr *apiV1.HelmRelease) error {
+	if r.config.Freeze == nil {
+		return nil
+	}
+	now := time.Now()
+	window, err := r.config.Freeze.Active(hr, now)
+	if err != nil {
+		frozenErr := FrozenError{Window: freeze.Window{End: now.Add(freezeRecheckInterval)}, Err: err}
+		status.SetFrozenPendingChanges(r.hrClient.HelmReleases(hr.Namespace), hr, frozenErr.Error())
+		return frozenErr
+	}
+	if window == nil {
+		status.SetFrozenPendingChanges(r.hrClient.HelmReleases(hr.Namespace), hr, "")
+		return nil
+	}
+	if override := hr.GetAnnotations()[FreezeOverrideAnnotation]; override != "" {
+		logger.Log("info", "overriding release freeze", "freeze", window.Name, "reason", override)
+		if r.recorder != nil {
+			r.recorder.Event(hr, corev1.EventTypeWarning, FreezeOverridden,
+				fmt.Sprintf("release freeze '%s' overridden: %s", window.Name, override))
+		}
+		status.SetFrozenPendingChanges(r.hrClient.HelmReleases(hr.Namespace), hr, "")
+		return nil
+	}
+	frozenErr := FrozenError{Window: *window}
+	status.SetFrozenPendingChanges(r.hrClient.HelmReleases(hr.Namespace), hr, frozenErr.Error())
+	return frozenErr
+}
@@ -0,0 +1,72 @@
+package release
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+	"github.com/lstack-org/helm-operator/pkg/freeze"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+type freezeFunc func(hr *apiV1.HelmRelease, t time.Time) (*freeze.Window, error)
+
+func (f freezeFunc) Active(hr *apiV1.HelmRelease, t time.Time) (*freeze.Window, error) {
+	return f(hr, t)
+}
+
+func TestCheckFreeze(t *testing.T) {
+	window := &freeze.Window{Name: "weekend", End: time.Now().Add(time.Hour)}
+	for _, tc := range []struct {
+		name        string
+		window      *freeze.Window
+		err         error
+		annotations map[string]string
+		held        bool
+	}{
+		{name: "not frozen"},
+		{name: "frozen", window: window, held: true},
+		{name: "overridden", window: window, annotations: map[string]string{FreezeOverrideAnnotation: "hotfix"}},
+		{name: "unknown", err: fmt.Errorf("calendar unavailable"), held: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "podinfo", Annotations: tc.annotations}}
+			client := ifclientsetfake.NewSimpleClientset(hr)
+			r := &Release{
+				hrClient: client.HelmV1(),
+				recorder: record.NewFakeRecorder(1),
+				config: Config{Freeze: freezeFunc(func(*apiV1.HelmRelease, time.Time) (*freeze.Window, error) {
+					return tc.window, tc.err
+				})},
+			}
+
+			err := r.checkFreeze(log.NewNopLogger(), hr)
+			assert.Equal(t, tc.held, err != nil)
+			switch {
+			case tc.window != nil && tc.held:
+				if w := Frozen(errCollection{err}); assert.NotNil(t, w) {
+					assert.Equal(t, "weekend", w.Name)
+				}
+			case tc.held:
+				// held until the windows are determined again, rather
+				// than failed
+				if w := Frozen(errCollection{err}); assert.NotNil(t, w) {
+					assert.WithinDuration(t, time.Now().Add(freezeRecheckInterval), w.End, time.Second)
+				}
+				assert.Contains(t, err.Error(), "calendar unavailable")
+			default:
+				assert.Nil(t, Frozen(err))
+			}
+			updated, getErr := client.HelmV1().HelmReleases(hr.Namespace).Get(hr.Name, metav1.GetOptions{})
+			assert.NoError(t, getErr)
+			assert.Equal(t, tc.held, status.GetCondition(updated.Status, apiV1.HelmReleaseFrozenPendingChanges) != nil)
+		})
+	}
+}
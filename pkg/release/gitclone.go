@@ -0,0 +1,61 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/chartsync"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+// cloneGitChart clones the repository of the Git chart source of the
+// given HelmRelease into the workspace with the clone options, which
+// the shared mirrors do not support, e.g. a limited depth or a sparse
+// checkout, or with short-lived credentials of a code service. As the
+// history of the clone may be incomplete, the chart is changed
+// whenever the cloned commit is not the last attempted one.
+func (r *Release) cloneGitChart(client helm.Client, hr *apiV1.HelmRelease, ws *chartsync.Workspace, opts chartsync.GitCloneOptions) (chart, error) {
+	source := hr.Spec.GitChartSource
+	creds, err := chartsync.GitCredentialsFor(r.coreV1Client, hr.Namespace, r.config.CrossNamespaceValues, r.config.GitProviderCredentials, ws, source)
+	if err != nil {
+		return chart{}, err
+	}
+	opts.Env = creds.Env
+	ref := source.Ref
+	if ref == "" {
+		ref = r.config.GitDefaultRef
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.config.GitTimeout)
+	defer cancel()
+	dir := filepath.Join(ws.Dir(), "git")
+	start := time.Now()
+	err = opts.Clone(ctx, creds.URL, ref, dir)
+	chartsync.ObserveChartFetch(chartsync.SourceGit, start, err)
+	if err != nil {
+		return chart{}, fmt.Errorf("failed to clone Git repository: %w", err)
+	}
+	revision, err := chartsync.GitHead(ctx, dir)
+	if err != nil {
+		return chart{}, err
+	}
+
+	chartPath := filepath.Join(dir, source.Path)
+	if r.config.UpdateDeps && !source.SkipDepUpdate {
+		err = updateDependencies(client, ws, chartPath)
+	} else {
+		err = ws.Check(chartPath)
+	}
+	if err != nil {
+		return chart{}, err
+	}
+	return chart{
+		chartPath: chartPath,
+		revision:  revision,
+		changed:   hr.Status.LastAttemptedRevision != revision,
+		repoDir:   dir,
+	}, nil
+}
@@ -0,0 +1,65 @@
+package release
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-kit/kit/log"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+// HaltedError is returned for syncs which held a mutating Helm action
+// while the operator is halted.
+type HaltedError struct {
+	Action action
+	Reason string
+}
+
+func (err HaltedError) Error() string {
+	msg := fmt.Sprintf("%s held while the operator is halted", err.Action)
+	if err.Reason != "" {
+		msg += ": " + err.Reason
+	}
+	return msg
+}
+
+// Halted returns if the sync which returned the error held a mutating
+// Helm action while the operator is halted.
+func Halted(err error) bool {
+	if errs, ok := err.(errCollection); ok {
+		for _, err := range errs {
+			if Halted(err) {
+				return true
+			}
+		}
+		return false
+	}
+	var haltedErr HaltedError
+	return errors.As(err, &haltedErr)
+}
+
+// checkHalt returns a HaltedError if the given mutating Helm action
+// for the HelmRelease should be held due to the halt switch, recording
+// it in the Halted condition. If the switch can not be determined, the
+// action is held as well.
+func (r *Release) checkHalt(logger log.Logger, action action, hr *apiV1.HelmRelease) error {
+	if r.config.Halt == nil {
+		return nil
+	}
+	reason, halted, err := r.config.Halt.Halted()
+	if err != nil {
+		err = fmt.Errorf("failed to determine halt switch, holding %s: %w", action, err)
+		status.SetHalted(r.hrClient.HelmReleases(hr.Namespace), hr, err.Error())
+		return err
+	}
+	if !halted {
+		status.SetHalted(r.hrClient.HelmReleases(hr.Namespace), hr, "")
+		return nil
+	}
+	haltedErr := HaltedError{Action: action, Reason: reason}
+	logger.Log("info", haltedErr.Error(), "action", action)
+	status.SetHalted(r.hrClient.HelmReleases(hr.Namespace), hr, haltedErr.Error())
+	return haltedErr
+}
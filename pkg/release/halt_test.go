@@ -0,0 +1,76 @@
+package release
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+type haltFunc func() (string, bool, error)
+
+func (f haltFunc) Halted() (string, bool, error) {
+	return f()
+}
+
+func TestCheckHalt(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		reason string
+		halted bool
+		err    error
+		held   bool
+	}{
+		{name: "not halted"},
+		{name: "halted", reason: "incident 42", halted: true, held: true},
+		{name: "unknown", err: fmt.Errorf("ConfigMap unavailable"), held: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "podinfo"}}
+			client := ifclientsetfake.NewSimpleClientset(hr)
+			r := &Release{
+				hrClient: client.HelmV1(),
+				config: Config{Halt: haltFunc(func() (string, bool, error) {
+					return tc.reason, tc.halted, tc.err
+				})},
+			}
+
+			err := r.checkHalt(log.NewNopLogger(), UpgradeAction, hr)
+			assert.Equal(t, tc.held, err != nil)
+			assert.Equal(t, tc.halted, Halted(errCollection{err}))
+			if tc.halted {
+				assert.EqualError(t, err, "upgrade held while the operator is halted: incident 42")
+			}
+			updated, getErr := client.HelmV1().HelmReleases(hr.Namespace).Get(hr.Name, metav1.GetOptions{})
+			assert.NoError(t, getErr)
+			assert.Equal(t, tc.held, status.GetCondition(updated.Status, apiV1.HelmReleaseHalted) != nil)
+		})
+	}
+}
+
+func TestUninstallWhileHalted(t *testing.T) {
+	hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "podinfo"}}
+	r := &Release{
+		hrClient: ifclientsetfake.NewSimpleClientset(hr).HelmV1(),
+		config: Config{Halt: haltFunc(func() (string, bool, error) {
+			return "incident 42", true, nil
+		})},
+	}
+
+	// the release of a deleted HelmRelease is uninstalled
+	client := &uninstallHelmClient{}
+	assert.NoError(t, r.run(log.NewNopLogger(), client, UninstallAction, hr, nil, chart{}, nil))
+	assert.True(t, client.uninstalled)
+
+	// installs are still held
+	client = &uninstallHelmClient{}
+	err := r.run(log.NewNopLogger(), client, InstallAction, hr, nil, chart{}, nil)
+	assert.True(t, Halted(err))
+	assert.False(t, client.uninstalled)
+}
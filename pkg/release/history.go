@@ -0,0 +1,58 @@
+package release
+
+import (
+	"fmt"
+
+	"github.com/go-kit/kit/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+// recordHistory records the given release in the history of the
+// HelmRelease, linking it to the generation it was released for.
+// Failures are logged, as they should not fail the release.
+func (r *Release) recordHistory(logger log.Logger, hr *apiV1.HelmRelease, rel *helm.Release) {
+	if rel == nil {
+		return
+	}
+	entry := apiV1.ReleaseHistoryEntry{
+		Generation: hr.Generation,
+		Version:    rel.Version,
+		Time:       metav1.Now(),
+	}
+	if rel.Chart != nil {
+		entry.ChartVersion = rel.Chart.Version
+	}
+	max := hr.GetMaxHistory()
+	if max <= 0 {
+		max = maxIntrospectedHistory
+	}
+	if err := status.AddHistory(r.hrClient.HelmReleases(hr.Namespace), hr, entry, max); err != nil {
+		logger.Log("warning", fmt.Sprintf("failed to record release in history: %v", err))
+	}
+}
+
+// generationVersion returns the version of the latest revision of the
+// Helm release released for the given generation of the HelmRelease,
+// or false if there is none in its history.
+func generationVersion(hr *apiV1.HelmRelease, generation int64) (int, bool) {
+	for i := len(hr.Status.History) - 1; i >= 0; i-- {
+		if e := hr.Status.History[i]; e.Generation == generation {
+			return e.Version, true
+		}
+	}
+	return 0, false
+}
+
+// historyGenerations returns the generations of the HelmRelease by the
+// versions of the Helm release in its history.
+func historyGenerations(hr *apiV1.HelmRelease) map[int]int64 {
+	generations := make(map[int]int64, len(hr.Status.History))
+	for _, e := range hr.Status.History {
+		generations[e.Version] = e.Generation
+	}
+	return generations
+}
@@ -0,0 +1,84 @@
+package release
+
+import (
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/lstack-org/helm-operator/pkg/api"
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+func TestRecordHistory(t *testing.T) {
+	maxHistory := 2
+	hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "podinfo", Generation: 1}}
+	hr.Spec.MaxHistory = &maxHistory
+	client := ifclientsetfake.NewSimpleClientset(hr)
+	r := &Release{hrClient: client.HelmV1()}
+
+	get := func() *apiV1.HelmRelease {
+		updated, err := client.HelmV1().HelmReleases("ns").Get("podinfo", metav1.GetOptions{})
+		assert.NoError(t, err)
+		return updated
+	}
+	record := func(generation int64, version int, chartVersion string) {
+		hr = get()
+		hr.Generation = generation
+		r.recordHistory(log.NewNopLogger(), hr, &helm.Release{Version: version, Chart: &helm.Chart{Version: chartVersion}})
+	}
+
+	record(1, 1, "1.0.0")
+	record(2, 2, "1.1.0")
+	// a rollback to the first generation
+	record(1, 3, "1.0.0")
+
+	history := get().Status.History
+	assert.Len(t, history, 2)
+	assert.Equal(t, int64(2), history[0].Generation)
+	assert.Equal(t, 2, history[0].Version)
+	assert.Equal(t, "1.1.0", history[0].ChartVersion)
+	assert.Equal(t, int64(1), history[1].Generation)
+	assert.Equal(t, 3, history[1].Version)
+
+	version, ok := generationVersion(get(), 1)
+	assert.True(t, ok)
+	assert.Equal(t, 3, version)
+	_, ok = generationVersion(get(), 3)
+	assert.False(t, ok)
+	assert.Equal(t, map[int]int64{2: 2, 3: 1}, historyGenerations(get()))
+}
+
+func TestRequestRollbackTarget(t *testing.T) {
+	hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "podinfo"}}
+	hr.Status.History = []apiV1.ReleaseHistoryEntry{{Generation: 3, Version: 4}, {Generation: 4, Version: 5}}
+	client := ifclientsetfake.NewSimpleClientset(hr)
+	r := &Release{hrClient: client.HelmV1()}
+
+	assert.NoError(t, r.RequestAction("ns", "podinfo", api.ReleaseActionRollback, api.RollbackTarget{Generation: 3}))
+	updated, err := client.HelmV1().HelmReleases("ns").Get("podinfo", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "4", updated.GetAnnotations()[RollbackVersionAnnotation])
+
+	assert.NoError(t, r.RequestAction("ns", "podinfo", api.ReleaseActionRollback, api.RollbackTarget{Revision: 2}))
+	updated, err = client.HelmV1().HelmReleases("ns").Get("podinfo", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "2", updated.GetAnnotations()[RollbackVersionAnnotation])
+
+	// a rollback to the previous version removes the target
+	assert.NoError(t, r.RequestAction("ns", "podinfo", api.ReleaseActionRollback, api.RollbackTarget{}))
+	updated, err = client.HelmV1().HelmReleases("ns").Get("podinfo", metav1.GetOptions{})
+	assert.NoError(t, err)
+	_, ok := updated.GetAnnotations()[RollbackVersionAnnotation]
+	assert.False(t, ok)
+
+	for _, target := range []api.RollbackTarget{{Generation: 1}, {Revision: -1}, {Revision: 2, Generation: 3}} {
+		err = r.RequestAction("ns", "podinfo", api.ReleaseActionRollback, target)
+		assert.IsType(t, api.InvalidActionError{}, err)
+	}
+	err = r.RequestAction("ns", "podinfo", api.ReleaseActionTest, api.RollbackTarget{Revision: 2})
+	assert.IsType(t, api.InvalidActionError{}, err)
+}
@@ -0,0 +1,267 @@
+package release
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	helmrelease "helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	v1client "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/typed/helm.fluxcd.io/v1"
+	iflister "github.com/lstack-org/helm-operator/pkg/client/listers/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+// The reasons revisions of a release are pruned from its storage for.
+const (
+	PrunedForHistory = "history"
+	PrunedForOrphan  = "orphaned"
+)
+
+// HistoryGCConfig holds the configuration of the release storage
+// garbage collection.
+type HistoryGCConfig struct {
+	// StorageDriver is the storage driver of the Helm v3 releases.
+	StorageDriver string
+	// Namespaces are the namespaces of the HelmReleases of which the
+	// release storage is collected; all namespaces if empty. The storage
+	// of a release is in the target namespace of its HelmRelease, which
+	// is collected along.
+	Namespaces []string
+}
+
+// HistoryGC prunes the storage of the Helm v3 releases in the cluster
+// of the operator. The revisions of the releases of HelmReleases beyond
+// their maximum history are pruned, as Helm only prunes these on
+// upgrades, e.g. when the maximum was lowered; the deployed revision is
+// always kept. All revisions of a release managed by a HelmRelease
+// which no longer exists are pruned once two consecutive collections
+// found it orphaned, so the uninstall of a deleted HelmRelease is not
+// raced. Releases without an antecedent, e.g. those installed with the
+// Helm CLI, are left alone.
+type HistoryGC struct {
+	config        HistoryGCConfig
+	coreV1Client  corev1client.CoreV1Interface
+	hrClient      v1client.HelmV1Interface
+	hrLister      iflister.HelmReleaseLister
+	dynamicClient dynamic.Interface
+	restMapper    meta.RESTMapper
+
+	// orphans are the releases found orphaned by the last collection,
+	// by namespace and name
+	orphans map[string]bool
+}
+
+// NewHistoryGC returns a new garbage collector for the storage of the
+// releases of the given HelmReleases.
+func NewHistoryGC(config HistoryGCConfig, coreV1Client corev1client.CoreV1Interface, hrClient v1client.HelmV1Interface,
+	hrLister iflister.HelmReleaseLister, dynamicClient dynamic.Interface, restMapper meta.RESTMapper) *HistoryGC {
+	return &HistoryGC{
+		config:        config,
+		coreV1Client:  coreV1Client,
+		hrClient:      hrClient,
+		hrLister:      hrLister,
+		dynamicClient: dynamicClient,
+		restMapper:    restMapper,
+		orphans:       make(map[string]bool),
+	}
+}
+
+// Loop collects the garbage in the release storage on every interval,
+// until stop is closed.
+func (gc *HistoryGC) Loop(stop <-chan struct{}, interval time.Duration, logger log.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			logger.Log("loop", "stopping")
+			return
+		case <-ticker.C:
+		}
+		if err := gc.Collect(logger); err != nil {
+			logger.Log("error", fmt.Sprintf("release storage garbage collection failed: %v", err))
+		}
+	}
+}
+
+// Collect prunes the revisions exceeding the maximum history of the
+// releases of HelmReleases, and the orphaned releases.
+func (gc *HistoryGC) Collect(logger log.Logger) error {
+	hrs, err := gc.hrLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	managed := make(map[string]*apiV1.HelmRelease)
+	for _, hr := range hrs {
+		// the storage of remote releases is in their own cluster
+		if remoteTarget(hr) {
+			continue
+		}
+		managed[hr.GetTargetNamespace()+"/"+hr.GetReleaseName()] = hr
+	}
+
+	releases := make(map[string][]*helmrelease.Release)
+	for _, ns := range gc.storageNamespaces(managed) {
+		s, err := gc.storage(ns)
+		if err != nil {
+			return err
+		}
+		rels, err := s.ListReleases()
+		if err != nil {
+			return fmt.Errorf("failed to list releases: %w", err)
+		}
+		for _, rel := range rels {
+			key := rel.Namespace + "/" + rel.Name
+			releases[key] = append(releases[key], rel)
+		}
+	}
+
+	orphans := make(map[string]bool)
+	for key, revisions := range releases {
+		sort.Slice(revisions, func(i, j int) bool {
+			return revisions[i].Version > revisions[j].Version
+		})
+		if hr, ok := managed[key]; ok {
+			gc.pruneHistory(logger, hr.GetMaxHistory(), revisions)
+			continue
+		}
+		orphaned, err := gc.orphaned(revisions[0])
+		if err != nil {
+			logger.Log("warning", fmt.Sprintf("failed to determine if release is orphaned: %v", err), "release", key)
+			continue
+		}
+		if !orphaned {
+			continue
+		}
+		if !gc.orphans[key] {
+			logger.Log("info", "found orphaned release, pruning it on the next collection", "release", key)
+			orphans[key] = true
+			continue
+		}
+		gc.prune(logger, PrunedForOrphan, revisions)
+	}
+	gc.orphans = orphans
+	return nil
+}
+
+// storageNamespaces returns the namespaces of the release storage to
+// collect: those of the HelmReleases in scope, the target namespaces of
+// the given managed HelmReleases, and those of the orphans found by the
+// last collection, which are pruned once their HelmRelease no longer
+// targets the namespace. All namespaces are collected if the scope is
+// not limited to namespaces.
+func (gc *HistoryGC) storageNamespaces(managed map[string]*apiV1.HelmRelease) []string {
+	if len(gc.config.Namespaces) == 0 {
+		return []string{metav1.NamespaceAll}
+	}
+	seen := make(map[string]bool)
+	var namespaces []string
+	add := func(ns string) {
+		if !seen[ns] {
+			seen[ns] = true
+			namespaces = append(namespaces, ns)
+		}
+	}
+	for _, ns := range gc.config.Namespaces {
+		add(ns)
+	}
+	for _, hr := range managed {
+		add(hr.GetTargetNamespace())
+	}
+	for key := range gc.orphans {
+		add(key[:strings.Index(key, "/")])
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// pruneHistory prunes the revisions, sorted from new to old, beyond
+// the given maximum history, except for the deployed revision.
+func (gc *HistoryGC) pruneHistory(logger log.Logger, max int, revisions []*helmrelease.Release) {
+	if max <= 0 || len(revisions) <= max {
+		return
+	}
+	var prunable []*helmrelease.Release
+	for _, rel := range revisions[max:] {
+		if rel.Info != nil && rel.Info.Status == helmrelease.StatusDeployed {
+			continue
+		}
+		prunable = append(prunable, rel)
+	}
+	gc.prune(logger, PrunedForHistory, prunable)
+}
+
+// prune deletes the given revisions from the release storage.
+func (gc *HistoryGC) prune(logger log.Logger, reason string, revisions []*helmrelease.Release) {
+	for _, rel := range revisions {
+		s, err := gc.storage(rel.Namespace)
+		if err != nil {
+			logger.Log("warning", err)
+			return
+		}
+		if _, err := s.Delete(rel.Name, rel.Version); err != nil && err != driver.ErrReleaseNotFound {
+			logger.Log("warning", fmt.Sprintf("failed to prune release revision: %v", err),
+				"release", rel.Namespace+"/"+rel.Name, "revision", rel.Version)
+			continue
+		}
+		ObserveStoragePrune(reason, rel.Namespace)
+		logger.Log("info", "pruned release revision from storage",
+			"release", rel.Namespace+"/"+rel.Name, "revision", rel.Version, "reason", reason)
+	}
+}
+
+// orphaned returns if the given release is managed by a HelmRelease
+// which no longer exists, according to the antecedent of its resources.
+func (gc *HistoryGC) orphaned(rel *helmrelease.Release) (bool, error) {
+	antecedent, err := releaseAntecedent(gc.dynamicClient, gc.restMapper,
+		&helm.Release{Name: rel.Name, Namespace: rel.Namespace, Manifest: rel.Manifest})
+	if err != nil {
+		return false, err
+	}
+	namespace, name, ok := parseAntecedent(antecedent)
+	if !ok {
+		return false, nil
+	}
+	_, err = gc.hrClient.HelmReleases(namespace).Get(name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		return true, nil
+	case err != nil:
+		return false, err
+	}
+	return false, nil
+}
+
+func (gc *HistoryGC) storage(namespace string) (*storage.Storage, error) {
+	switch gc.config.StorageDriver {
+	case "secret", "secrets", "":
+		return storage.Init(driver.NewSecrets(gc.coreV1Client.Secrets(namespace))), nil
+	case "configmap", "configmaps":
+		return storage.Init(driver.NewConfigMaps(gc.coreV1Client.ConfigMaps(namespace))), nil
+	default:
+		return nil, fmt.Errorf("unsupported storage driver '%s'", gc.config.StorageDriver)
+	}
+}
+
+// parseAntecedent returns the namespace and name of the HelmRelease of
+// the given antecedent annotation, of the form
+// `<namespace>:helmrelease/<name>`.
+func parseAntecedent(antecedent string) (namespace, name string, ok bool) {
+	i, j := strings.Index(antecedent, ":"), strings.Index(antecedent, "/")
+	if i <= 0 || j < i || !strings.EqualFold(antecedent[i+1:j], "helmrelease") || j == len(antecedent)-1 {
+		return "", "", false
+	}
+	return antecedent[:i], antecedent[j+1:], true
+}
@@ -0,0 +1,165 @@
+package release
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	helmrelease "helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+	iflister "github.com/lstack-org/helm-operator/pkg/client/listers/helm.fluxcd.io/v1"
+)
+
+func TestHistoryGC(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+	store := func(namespace, name string, version int, status helmrelease.Status, manifest string) {
+		rel := &helmrelease.Release{
+			Name:      name,
+			Namespace: namespace,
+			Version:   version,
+			Info:      &helmrelease.Info{Status: status},
+			Manifest:  manifest,
+		}
+		key := fmt.Sprintf("sh.helm.release.v1.%s.v%d", name, version)
+		assert.NoError(t, driver.NewSecrets(kubeClient.CoreV1().Secrets(namespace)).Create(key, rel))
+	}
+	stored := func(namespace, name string) []int {
+		rels, err := driver.NewSecrets(kubeClient.CoreV1().Secrets(namespace)).Query(map[string]string{"name": name, "owner": "helm"})
+		if err == driver.ErrReleaseNotFound {
+			return nil
+		}
+		assert.NoError(t, err)
+		var versions []int
+		for _, rel := range rels {
+			versions = append(versions, rel.Version)
+		}
+		sort.Ints(versions)
+		return versions
+	}
+
+	// the release of a HelmRelease, of which the revision deployed
+	// before the failed upgrades is kept
+	maxHistory := 2
+	hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "podinfo"}}
+	hr.Spec.MaxHistory = &maxHistory
+	store("ns", "ns-podinfo", 1, helmrelease.StatusSuperseded, "")
+	store("ns", "ns-podinfo", 2, helmrelease.StatusDeployed, "")
+	store("ns", "ns-podinfo", 3, helmrelease.StatusFailed, "")
+	store("ns", "ns-podinfo", 4, helmrelease.StatusFailed, "")
+
+	// the release of a deleted HelmRelease, and that of a HelmRelease
+	// which is not watched
+	manifest := func(name string) string {
+		return "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: " + name + "\n"
+	}
+	store("apps", "gone", 1, helmrelease.StatusDeployed, manifest("gone"))
+	store("apps", "elsewhere", 1, helmrelease.StatusDeployed, manifest("elsewhere"))
+	// a release installed with the Helm CLI
+	store("apps", "cli", 1, helmrelease.StatusDeployed, manifest("cli"))
+
+	configMap := func(name, antecedent string) runtime.Object {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("v1")
+		obj.SetKind("ConfigMap")
+		obj.SetNamespace("apps")
+		obj.SetName(name)
+		if antecedent != "" {
+			obj.SetAnnotations(map[string]string{apiV1.AntecedentAnnotation: antecedent})
+		}
+		return obj
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		configMap("gone", "apps:helmrelease/gone"),
+		configMap("elsewhere", "other:helmrelease/elsewhere"),
+		configMap("cli", ""))
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.NoError(t, indexer.Add(hr))
+	elsewhere := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "elsewhere"}}
+	hrClient := ifclientsetfake.NewSimpleClientset(hr, elsewhere)
+
+	gc := NewHistoryGC(HistoryGCConfig{}, kubeClient.CoreV1(), hrClient.HelmV1(), iflister.NewHelmReleaseLister(indexer), dynamicClient, mapper)
+	assert.NoError(t, gc.Collect(log.NewNopLogger()))
+	assert.Equal(t, []int{2, 3, 4}, stored("ns", "ns-podinfo"))
+	// orphans are only pruned by the next collection
+	assert.Equal(t, []int{1}, stored("apps", "gone"))
+
+	assert.NoError(t, gc.Collect(log.NewNopLogger()))
+	assert.Empty(t, stored("apps", "gone"))
+	assert.Equal(t, []int{1}, stored("apps", "elsewhere"))
+	assert.Equal(t, []int{1}, stored("apps", "cli"))
+}
+
+func TestParseAntecedent(t *testing.T) {
+	namespace, name, ok := parseAntecedent("apps:helmrelease/podinfo")
+	assert.True(t, ok)
+	assert.Equal(t, "apps", namespace)
+	assert.Equal(t, "podinfo", name)
+	for _, antecedent := range []string{"", "podinfo", "apps:deployment/podinfo", ":helmrelease/podinfo", "apps:helmrelease/"} {
+		_, _, ok := parseAntecedent(antecedent)
+		assert.False(t, ok, antecedent)
+	}
+}
+
+func TestHistoryGCTargetNamespaces(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+	secrets := func(namespace string) *driver.Secrets {
+		return driver.NewSecrets(kubeClient.CoreV1().Secrets(namespace))
+	}
+	manifest := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: gone\n"
+	for version := 1; version <= 2; version++ {
+		rel := &helmrelease.Release{Name: "podinfo", Namespace: "apps", Version: version,
+			Info: &helmrelease.Info{Status: helmrelease.StatusSuperseded}}
+		assert.NoError(t, secrets("apps").Create(fmt.Sprintf("sh.helm.release.v1.podinfo.v%d", version), rel))
+	}
+	gone := &helmrelease.Release{Name: "gone", Namespace: "apps", Version: 1,
+		Info: &helmrelease.Info{Status: helmrelease.StatusDeployed}, Manifest: manifest}
+	assert.NoError(t, secrets("apps").Create("sh.helm.release.v1.gone.v1", gone))
+
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("ConfigMap")
+	obj.SetNamespace("apps")
+	obj.SetName("gone")
+	obj.SetAnnotations(map[string]string{apiV1.AntecedentAnnotation: "ns:helmrelease/gone"})
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), obj)
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+
+	// the HelmRelease in the scope releases to another namespace
+	maxHistory := 1
+	hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "podinfo"}}
+	hr.Spec.TargetNamespace = "apps"
+	hr.Spec.ReleaseName = "podinfo"
+	hr.Spec.MaxHistory = &maxHistory
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.NoError(t, indexer.Add(hr))
+
+	gc := NewHistoryGC(HistoryGCConfig{Namespaces: []string{"ns"}}, kubeClient.CoreV1(),
+		ifclientsetfake.NewSimpleClientset(hr).HelmV1(), iflister.NewHelmReleaseLister(indexer), dynamicClient, mapper)
+	assert.Equal(t, []string{"apps", "ns"}, gc.storageNamespaces(map[string]*apiV1.HelmRelease{"apps/podinfo": hr}))
+	assert.NoError(t, gc.Collect(log.NewNopLogger()))
+	_, err := secrets("apps").Get("sh.helm.release.v1.podinfo.v1")
+	assert.Equal(t, driver.ErrReleaseNotFound, err)
+
+	// the orphan is pruned once no HelmRelease targets its namespace
+	assert.NoError(t, indexer.Delete(hr))
+	assert.NoError(t, gc.Collect(log.NewNopLogger()))
+	_, err = secrets("apps").Get("sh.helm.release.v1.gone.v1")
+	assert.Equal(t, driver.ErrReleaseNotFound, err)
+}
@@ -0,0 +1,59 @@
+package release
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+// HookFailed is the reason of the Event emitted for a failed hook of
+// an install or upgrade.
+const HookFailed = "HookFailed"
+
+// setDeployFailed sets the DeployFailed phase with the given reason
+// on the HelmRelease. If hooks failed, their name, kind and the tail
+// of their logs are added to the condition message and emitted as
+// Events, so failing hooks can be diagnosed from the HelmRelease.
+// Policy violations blocking the release are listed in the message.
+func (r *Release) setDeployFailed(hr *apiV1.HelmRelease, reason string, err error) {
+	var violationErr PolicyViolationError
+	if errors.As(err, &violationErr) {
+		status.SetStatusPhaseWithMessage(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseDeployFailed, reason,
+			policyViolationsMessage(hr, violationErr.Violations))
+		return
+	}
+	var hookErr helm.HookError
+	if !errors.As(err, &hookErr) || len(hookErr.Hooks) == 0 {
+		status.SetStatusPhaseWithReason(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseDeployFailed, reason)
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, `Installation or upgrade failed for Helm release '%s' in '%s'.`, hr.GetReleaseName(), hr.GetTargetNamespace())
+	for _, h := range hookErr.Hooks {
+		description := hookDescription(h)
+		fmt.Fprintf(&b, " %s failed", description)
+		if h.Log != "" {
+			fmt.Fprintf(&b, ":\n%s", strings.TrimRight(h.Log, "\n"))
+		}
+		if r.recorder != nil {
+			r.recorder.Event(hr, corev1.EventTypeWarning, HookFailed,
+				fmt.Sprintf("%s of Helm release '%s' failed:\n%s", description, hr.GetReleaseName(), h.Log))
+		}
+	}
+	status.SetStatusPhaseWithMessage(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseDeployFailed, reason, b.String())
+}
+
+// hookDescription returns a description of the failed hook, i.e.
+// `pre-install hook Job 'migrate'`.
+func hookDescription(h helm.FailedHook) string {
+	if h.Events == "" {
+		return fmt.Sprintf("hook %s '%s'", h.Kind, h.Name)
+	}
+	return fmt.Sprintf("%s hook %s '%s'", h.Events, h.Kind, h.Name)
+}
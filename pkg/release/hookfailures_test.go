@@ -0,0 +1,38 @@
+package release
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+func TestSetDeployFailed(t *testing.T) {
+	hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "podinfo"}}
+	client := ifclientsetfake.NewSimpleClientset(hr)
+	recorder := record.NewFakeRecorder(2)
+	r := &Release{hrClient: client.HelmV1(), recorder: recorder}
+
+	err := fmt.Errorf("installation failed: %w", helm.HookError{
+		Err:   errors.New("pre-install hook failed"),
+		Hooks: []helm.FailedHook{{Name: "podinfo-migrate", Kind: "Job", Events: "pre-install", Log: "migration failed\n"}},
+	})
+	r.setDeployFailed(hr, apiV1.ReasonHelmInstallFailed, err)
+	updated, getErr := client.HelmV1().HelmReleases(hr.Namespace).Get(hr.Name, metav1.GetOptions{})
+	assert.NoError(t, getErr)
+	assert.Equal(t, apiV1.HelmReleasePhaseDeployFailed, updated.Status.Phase)
+	condition := status.GetCondition(updated.Status, apiV1.HelmReleaseReleased)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, apiV1.ReasonHelmInstallFailed, condition.Reason)
+		assert.Contains(t, condition.Message, "pre-install hook Job 'podinfo-migrate' failed:\nmigration failed")
+	}
+	assert.Contains(t, <-recorder.Events, "migration failed")
+}
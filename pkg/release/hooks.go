@@ -0,0 +1,53 @@
+package release
+
+import (
+	"fmt"
+
+	"github.com/go-kit/kit/log"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+	"github.com/lstack-org/helm-operator/pkg/releasehook"
+)
+
+// SetReleaseHooks sets the dispatcher the release hook events of
+// successful installs, upgrades and uninstalls are fired to.
+func (r *Release) SetReleaseHooks(hooks *releasehook.Dispatcher) {
+	r.hooks = hooks
+}
+
+// fireReleaseHook fires the release hook event for the given action
+// and release of the HelmRelease, if release hooks are configured.
+// Failures are logged, as they must not fail the release.
+func (r *Release) fireReleaseHook(logger log.Logger, action releasehook.Action, hr *apiV1.HelmRelease, rel *helm.Release) {
+	if r.hooks == nil {
+		return
+	}
+	if err := r.hooks.Fire(releaseHookEvent(action, hr, rel)); err != nil {
+		logger.Log("error", fmt.Sprintf("failed to fire release hook: %v", err), "action", action)
+	}
+}
+
+// releaseHookEvent returns the release hook event for the given
+// action and release of the HelmRelease. The release may be nil.
+func releaseHookEvent(action releasehook.Action, hr *apiV1.HelmRelease, rel *helm.Release) releasehook.Event {
+	e := releasehook.Event{
+		Action:          action,
+		Namespace:       hr.Namespace,
+		Name:            hr.Name,
+		Labels:          hr.Labels,
+		ReleaseName:     hr.GetReleaseName(),
+		TargetNamespace: hr.GetTargetNamespace(),
+		AppId:           hr.Spec.AppId,
+		ComponentId:     hr.Spec.ComponentId,
+	}
+	if rel != nil {
+		e.Revision = rel.Version
+		if rel.Chart != nil {
+			e.ChartName = rel.Chart.Name
+			e.ChartVersion = rel.Chart.Version
+			e.AppVersion = rel.Chart.AppVersion
+		}
+	}
+	return e
+}
@@ -0,0 +1,56 @@
+package release
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/go-kit/kit/log"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+// recordImages records the container images of the given release in
+// the status of the HelmRelease. Failures are logged, as they should
+// not fail the release.
+func (r *Release) recordImages(logger log.Logger, hr *apiV1.HelmRelease, rel *helm.Release) {
+	if rel == nil {
+		return
+	}
+	images := manifestImages(rel.Manifest)
+	if err := status.SetImages(r.hrClient.HelmReleases(hr.Namespace), hr, images); err != nil {
+		logger.Log("warning", fmt.Sprintf("failed to record images in status: %v", err))
+	}
+}
+
+// manifestImages returns the sorted, unique images of the (init)
+// containers of the workloads in the given manifest.
+func manifestImages(manifest string) []string {
+	seen := make(map[string]bool)
+	var images []string
+	for _, obj := range releaseManifestToUnstructured(manifest) {
+		path := podSpecPath(obj.GetKind())
+		if path == nil {
+			continue
+		}
+		for _, field := range []string{"initContainers", "containers"} {
+			containers, _, _ := unstructured.NestedSlice(obj.Object, append(append([]string{}, path...), field)...)
+			for _, c := range containers {
+				container, ok := c.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				image, ok := container["image"].(string)
+				if !ok || image == "" || seen[image] {
+					continue
+				}
+				seen[image] = true
+				images = append(images, image)
+			}
+		}
+	}
+	sort.Strings(images)
+	return images
+}
@@ -0,0 +1,65 @@
+package release
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+// installedObjects returns the objects of the given release by their
+// injection key, these keep the values injected on their creation.
+func installedObjects(rel *helm.Release) map[string]unstructured.Unstructured {
+	if rel == nil {
+		return nil
+	}
+	objs := make(map[string]unstructured.Unstructured)
+	for _, obj := range releaseManifestToUnstructured(rel.Manifest) {
+		objs[injectionKey(obj)] = obj
+	}
+	return objs
+}
+
+// injectionKey returns the key identifying the given object across
+// renders of a release.
+func injectionKey(obj unstructured.Unstructured) string {
+	return obj.GetAPIVersion() + "/" + obj.GetKind() + "/" + obj.GetNamespace() + "/" + obj.GetName()
+}
+
+// keepInjected sets the labels and annotations injected by the
+// built-in post-renderer on the given target to their values on the
+// given previously rendered object, so that the object is not
+// mutated by the injection.
+func keepInjected(target, prev unstructured.Unstructured) unstructured.Unstructured {
+	if labels := keepKeys(target.GetLabels(), prev.GetLabels(), AppIdLabelKey, ComponentIdLabelKey); labels != nil {
+		target.SetLabels(labels)
+	}
+	if annotations := keepKeys(target.GetAnnotations(), prev.GetAnnotations(), LogCollectAnnotateKey); annotations != nil {
+		target.SetAnnotations(annotations)
+	}
+	for _, path := range [][]string{matchLabelsPath, templateLabelsPath} {
+		cur, _, _ := unstructured.NestedStringMap(target.Object, path...)
+		old, _, _ := unstructured.NestedStringMap(prev.Object, path...)
+		if labels := keepKeys(cur, old, AppIdLabelKey, ComponentIdLabelKey, IstioEnableLabelKey); labels != nil {
+			_ = unstructured.SetNestedStringMap(target.Object, labels, path...)
+		}
+	}
+	return target
+}
+
+// keepKeys sets the given keys of the target map to their values in
+// the previous map, removing the keys it does not have. It returns
+// nil if the target is nil and there is nothing to set.
+func keepKeys(target, prev map[string]string, keys ...string) map[string]string {
+	for _, k := range keys {
+		v, ok := prev[k]
+		switch {
+		case ok && target == nil:
+			target = map[string]string{k: v}
+		case ok:
+			target[k] = v
+		default:
+			delete(target, k)
+		}
+	}
+	return target
+}
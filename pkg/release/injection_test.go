@@ -0,0 +1,102 @@
+package release
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+func TestInjectionOnInstall(t *testing.T) {
+	installed := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  labels:
+    oam.runtime.app.id: app-v1
+    oam.runtime.component.id: web
+`
+	rendered := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: credentials
+`
+	hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"}}
+	hr.Spec.AppId = "app-v2"
+	hr.Spec.ComponentId = "web"
+	hr.Spec.Injection = &apiV1.Injection{Mode: apiV1.InjectionOnInstall}
+	r := &Release{logger: log.NewNopLogger(), hrClient: ifclientsetfake.NewSimpleClientset(hr).HelmV1()}
+
+	out, err := r.getPostRenderer(hr, &helm.Release{Manifest: installed}, false).Run(bytes.NewBufferString(rendered))
+	assert.NoError(t, err)
+	appIds := make(map[string]string)
+	for _, obj := range releaseManifestToUnstructured(out.String()) {
+		appIds[obj.GetName()] = obj.GetLabels()[AppIdLabelKey]
+	}
+	// the installed object keeps its values, the created object is
+	// injected into
+	assert.Equal(t, map[string]string{"config": "app-v1", "credentials": "app-v2"}, appIds)
+
+	hr.Spec.Injection.Mode = apiV1.InjectionNever
+	out, err = r.getPostRenderer(hr, nil, false).Run(bytes.NewBufferString(rendered))
+	assert.NoError(t, err)
+	for _, obj := range releaseManifestToUnstructured(out.String()) {
+		assert.Empty(t, obj.GetLabels())
+	}
+}
+
+func TestKeepInjected(t *testing.T) {
+	prev := releaseManifestToUnstructured(`---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  selector:
+    matchLabels:
+      app: web
+      oam.runtime.app.id: app-v1
+  template:
+    metadata:
+      labels:
+        app: web
+        istio-injection: enabled
+`)[0]
+	target := releaseManifestToUnstructured(`---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    oam.runtime.app.id: app-v2
+spec:
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+`)[0]
+
+	kept := keepInjected(target, prev)
+	assert.Empty(t, kept.GetLabels())
+	matchLabels, _, _ := unstructured.NestedStringMap(kept.Object, matchLabelsPath...)
+	assert.Equal(t, map[string]string{"app": "web", AppIdLabelKey: "app-v1"}, matchLabels)
+	templateLabels, _, _ := unstructured.NestedStringMap(kept.Object, templateLabelsPath...)
+	assert.Equal(t, map[string]string{"app": "web", IstioEnableLabelKey: "enabled"}, templateLabels)
+}
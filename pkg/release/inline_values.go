@@ -0,0 +1,135 @@
+package release
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/go-kit/kit/log"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+const (
+	// ExternalizedValuesLabel is set on the Secrets holding inline
+	// values which have been externalized by the operator.
+	ExternalizedValuesLabel = "helm.fluxcd.io/externalized-values"
+	// externalizedValuesKey is the key the values are stored under
+	// in the Secret.
+	externalizedValuesKey = "values.yaml"
+)
+
+// ExternalizedValuesSecretName returns the name of the Secret the
+// inline values of the given HelmRelease are externalized to.
+func ExternalizedValuesSecretName(hr *apiV1.HelmRelease) string {
+	return hr.Name + "-inline-values"
+}
+
+// guardInlineValues warns about inline values of the given HelmRelease
+// exceeding the configured size, or returns an error if large inline
+// values are rejected. With externalization enabled, large inline
+// values are instead copied to an operator managed Secret, which is
+// referenced with their checksum from the status. The spec is never
+// changed, as it is owned by whoever applies it.
+func (r *Release) guardInlineValues(logger log.Logger, hr *apiV1.HelmRelease) error {
+	if r.config.InlineValuesWarnSize <= 0 {
+		return r.removeExternalizedValues(hr)
+	}
+	var b []byte
+	if len(hr.Spec.Values.Data) > 0 {
+		var err error
+		if b, err = yaml.Marshal(hr.Spec.Values.Data); err != nil {
+			return err
+		}
+	}
+	if len(b) <= r.config.InlineValuesWarnSize {
+		return r.removeExternalizedValues(hr)
+	}
+	switch {
+	case r.config.RejectLargeInlineValues:
+		return fmt.Errorf("inline values of %d bytes exceed the maximum of %d bytes, move them to valuesFrom",
+			len(b), r.config.InlineValuesWarnSize)
+	case !r.config.ExternalizeInlineValues:
+		logger.Log("warning", fmt.Sprintf("inline values of %d bytes exceed the recommended maximum of %d bytes, consider using valuesFrom",
+			len(b), r.config.InlineValuesWarnSize))
+		return r.removeExternalizedValues(hr)
+	}
+
+	sum := sha256.Sum256(b)
+	ref := &apiV1.ExternalizedValues{SecretName: ExternalizedValuesSecretName(hr), SHA256: hex.EncodeToString(sum[:])}
+	if current := hr.Status.ExternalizedValues; current != nil && *current == *ref {
+		return nil
+	}
+	if err := r.writeExternalizedValues(hr, ref, b); err != nil {
+		return fmt.Errorf("failed to externalize inline values: %w", err)
+	}
+	if err := status.SetExternalizedValues(r.hrClient.HelmReleases(hr.Namespace), hr, ref); err != nil {
+		return fmt.Errorf("failed to record externalized values in status: %w", err)
+	}
+	logger.Log("info", fmt.Sprintf("externalized %d bytes of inline values to Secret '%s'", len(b), ref.SecretName),
+		"sha256", ref.SHA256)
+	return nil
+}
+
+// writeExternalizedValues creates or updates the Secret for the given
+// reference with the values.
+func (r *Release) writeExternalizedValues(hr *apiV1.HelmRelease, ref *apiV1.ExternalizedValues, values []byte) error {
+	controller := true
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ref.SecretName,
+			Namespace: hr.Namespace,
+			Labels:    r.backupLabels(map[string]string{ExternalizedValuesLabel: hr.Name}),
+			Annotations: map[string]string{
+				apiV1.AntecedentAnnotation: hr.ResourceID().String(),
+			},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: apiV1.SchemeGroupVersion.String(),
+				Kind:       "HelmRelease",
+				Name:       hr.Name,
+				UID:        hr.UID,
+				Controller: &controller,
+			}},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{externalizedValuesKey: values},
+	}
+
+	secrets := r.coreV1Client.Secrets(hr.Namespace)
+	current, err := secrets.Get(ref.SecretName, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		_, err = secrets.Create(secret)
+		return err
+	case err != nil:
+		return err
+	}
+	if current.Labels[ExternalizedValuesLabel] != hr.Name {
+		return fmt.Errorf("Secret '%s' exists and is not managed by the operator", ref.SecretName)
+	}
+	current.Data = secret.Data
+	current.Labels = r.backupLabels(current.Labels)
+	current.OwnerReferences = secret.OwnerReferences
+	_, err = secrets.Update(current)
+	return err
+}
+
+// removeExternalizedValues deletes the Secret the inline values of the
+// given HelmRelease have been externalized to, if any, and removes its
+// reference from the status.
+func (r *Release) removeExternalizedValues(hr *apiV1.HelmRelease) error {
+	ref := hr.Status.ExternalizedValues
+	if ref == nil {
+		return nil
+	}
+	err := r.coreV1Client.Secrets(hr.Namespace).Delete(ref.SecretName, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete Secret '%s' of externalized values: %w", ref.SecretName, err)
+	}
+	return status.SetExternalizedValues(r.hrClient.HelmReleases(hr.Namespace), hr, nil)
+}
@@ -0,0 +1,89 @@
+package release
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+)
+
+func TestGuardInlineValues(t *testing.T) {
+	hr := &apiV1.HelmRelease{
+		Spec: apiV1.HelmReleaseSpec{
+			Values: apiV1.HelmValues{Data: map[string]interface{}{"config": strings.Repeat("x", 64)}},
+		},
+	}
+	original := hr.DeepCopy()
+
+	for _, tc := range []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{name: "disabled", config: Config{RejectLargeInlineValues: true}},
+		{name: "below the size", config: Config{InlineValuesWarnSize: 1024, RejectLargeInlineValues: true}},
+		{name: "warned about", config: Config{InlineValuesWarnSize: 16}},
+		{name: "rejected", config: Config{InlineValuesWarnSize: 16, RejectLargeInlineValues: true}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &Release{config: tc.config}
+			err := r.guardInlineValues(log.NewNopLogger(), hr)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, original, hr)
+		})
+	}
+}
+
+func TestGuardInlineValuesExternalize(t *testing.T) {
+	hr := &apiV1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "podinfo"},
+		Spec: apiV1.HelmReleaseSpec{
+			Values: apiV1.HelmValues{Data: map[string]interface{}{"config": strings.Repeat("x", 64)}},
+		},
+	}
+	coreClient := fake.NewSimpleClientset()
+	hrClient := ifclientsetfake.NewSimpleClientset(hr)
+	r := &Release{
+		coreV1Client: coreClient.CoreV1(),
+		hrClient:     hrClient.HelmV1(),
+		config: Config{InlineValuesWarnSize: 16, ExternalizeInlineValues: true,
+			BackupLabels: map[string]string{"backup": "helm-operator"}},
+	}
+
+	assert.NoError(t, r.guardInlineValues(log.NewNopLogger(), hr))
+
+	secret, err := coreClient.CoreV1().Secrets("default").Get("podinfo-inline-values", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{ExternalizedValuesLabel: "podinfo", "backup": "helm-operator"}, secret.Labels)
+	values := secret.Data[externalizedValuesKey]
+	assert.Contains(t, string(values), strings.Repeat("x", 64))
+	sum := sha256.Sum256(values)
+
+	updated, err := hrClient.HelmV1().HelmReleases("default").Get("podinfo", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, &apiV1.ExternalizedValues{SecretName: "podinfo-inline-values", SHA256: hex.EncodeToString(sum[:])},
+		updated.Status.ExternalizedValues)
+	assert.Equal(t, hr.Spec, updated.Spec)
+
+	// Once the values no longer exceed the size, the Secret and its
+	// reference are removed.
+	updated.Spec.Values.Data = map[string]interface{}{"config": "x"}
+	assert.NoError(t, r.guardInlineValues(log.NewNopLogger(), updated))
+	_, err = coreClient.CoreV1().Secrets("default").Get("podinfo-inline-values", metav1.GetOptions{})
+	assert.Error(t, err)
+	updated, err = hrClient.HelmV1().HelmReleases("default").Get("podinfo", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Nil(t, updated.Status.ExternalizedValues)
+}
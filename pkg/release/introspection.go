@@ -0,0 +1,110 @@
+package release
+
+import (
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/lstack-org/helm-operator/pkg/api"
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+// helmReleaseResource is the resource Helm releases are reported as
+// not found for.
+var helmReleaseResource = schema.GroupResource{Group: "helm.sh", Resource: "releases"}
+
+// maxIntrospectedHistory is the maximum amount of revisions returned
+// of the history of a Helm release, which equals the default of Helm.
+const maxIntrospectedHistory = 256
+
+// ReleaseState returns the sync state of the given HelmRelease.
+func (r *Release) ReleaseState(namespace, name string) (api.ReleaseState, error) {
+	hr, err := r.hrClient.HelmReleases(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return api.ReleaseState{}, err
+	}
+	return api.ReleaseState{
+		Namespace:       hr.Namespace,
+		Name:            hr.Name,
+		ReleaseName:     hr.GetReleaseName(),
+		TargetNamespace: hr.GetTargetNamespace(),
+		Generation:      hr.Generation,
+		Suspended:       hr.Spec.Suspend,
+		Status:          hr.Status,
+	}, nil
+}
+
+// ReleaseManifest returns the manifest of the current Helm release of
+// the given HelmRelease, with the data of Secrets redacted.
+func (r *Release) ReleaseManifest(namespace, name string) (string, error) {
+	hr, client, err := r.introspect(namespace, name)
+	if err != nil {
+		return "", err
+	}
+	rel, err := client.Get(hr.GetReleaseName(), helm.GetOptions{Namespace: hr.GetTargetNamespace()})
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve Helm release: %w", err)
+	}
+	if rel == nil {
+		return "", apierrors.NewNotFound(helmReleaseResource, hr.GetReleaseName())
+	}
+	return redactSecrets(rel.Manifest)
+}
+
+// ReleaseHistory returns the revisions of the Helm release of the
+// given HelmRelease, the latest first.
+func (r *Release) ReleaseHistory(namespace, name string) ([]api.ReleaseRevision, error) {
+	hr, client, err := r.introspect(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	if rel, err := client.Get(hr.GetReleaseName(), helm.GetOptions{Namespace: hr.GetTargetNamespace()}); err != nil {
+		return nil, fmt.Errorf("failed to retrieve Helm release: %w", err)
+	} else if rel == nil {
+		return nil, apierrors.NewNotFound(helmReleaseResource, hr.GetReleaseName())
+	}
+	hist, err := client.History(hr.GetReleaseName(), helm.HistoryOptions{Namespace: hr.GetTargetNamespace(), Max: maxIntrospectedHistory})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve history of Helm release: %w", err)
+	}
+	generations := historyGenerations(hr)
+	revisions := make([]api.ReleaseRevision, 0, len(hist))
+	for _, rel := range hist {
+		revision := releaseRevision(rel)
+		revision.Generation = generations[rel.Version]
+		revisions = append(revisions, revision)
+	}
+	return revisions, nil
+}
+
+// introspect returns the given HelmRelease with the Helm client for
+// its version.
+func (r *Release) introspect(namespace, name string) (*apiV1.HelmRelease, helm.Client, error) {
+	hr, err := r.hrClient.HelmReleases(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := r.HelmClient(hr)
+	if err != nil {
+		return nil, nil, err
+	}
+	return hr, client, nil
+}
+
+func releaseRevision(rel *helm.Release) api.ReleaseRevision {
+	revision := api.ReleaseRevision{Version: rel.Version}
+	if rel.Info != nil {
+		revision.Status = rel.Info.Status.String()
+		revision.Updated = rel.Info.LastDeployed
+		revision.Description = rel.Info.Description
+	}
+	if rel.Chart != nil {
+		revision.Chart = rel.Chart.Name
+		revision.ChartVersion = rel.Chart.Version
+		revision.AppVersion = rel.Chart.AppVersion
+	}
+	return revision
+}
@@ -0,0 +1,52 @@
+package release
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/lstack-org/helm-operator/pkg/api"
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+func TestReleaseState(t *testing.T) {
+	hr := &apiV1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "podinfo", Generation: 3},
+		Status:     apiV1.HelmReleaseStatus{Phase: apiV1.HelmReleasePhaseDeployed, ObservedGeneration: 2},
+	}
+	hr.Spec.TargetNamespace = "apps"
+	r := &Release{hrClient: ifclientsetfake.NewSimpleClientset(hr).HelmV1()}
+
+	state, err := r.ReleaseState("ns", "podinfo")
+	assert.NoError(t, err)
+	assert.Equal(t, "ns-apps-podinfo", state.ReleaseName)
+	assert.Equal(t, "apps", state.TargetNamespace)
+	assert.Equal(t, int64(3), state.Generation)
+	assert.Equal(t, hr.Status, state.Status)
+
+	_, err = r.ReleaseState("ns", "missing")
+	assert.Error(t, err)
+}
+
+func TestReleaseRevision(t *testing.T) {
+	deployed := time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)
+	rel := &helm.Release{
+		Version: 4,
+		Chart:   &helm.Chart{Name: "podinfo", Version: "3.2.0", AppVersion: "3.2.0"},
+		Info:    &helm.Info{Status: helm.StatusDeployed, LastDeployed: deployed, Description: "Upgrade complete"},
+	}
+	assert.Equal(t, api.ReleaseRevision{
+		Version:      4,
+		Status:       "deployed",
+		Chart:        "podinfo",
+		ChartVersion: "3.2.0",
+		AppVersion:   "3.2.0",
+		Updated:      deployed,
+		Description:  "Upgrade complete",
+	}, releaseRevision(rel))
+	assert.Equal(t, api.ReleaseRevision{Version: 1}, releaseRevision(&helm.Release{Version: 1}))
+}
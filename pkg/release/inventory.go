@@ -0,0 +1,165 @@
+package release
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+const (
+	// ResourcesRecreated is the reason of the Event emitted when the
+	// release is upgraded to recreate missing resources.
+	ResourcesRecreated = "ResourcesRecreated"
+
+	// maxMissingReports is the maximum number of missing resources
+	// listed in the ResourcesMissing condition.
+	maxMissingReports = 10
+)
+
+// recordInventory records the resources of the given release in the
+// status of the HelmRelease. Failures are logged, as they should not
+// fail the release.
+func (r *Release) recordInventory(logger log.Logger, hr *apiV1.HelmRelease, rel *helm.Release) {
+	if rel == nil {
+		return
+	}
+	inventory := manifestInventory(rel.Manifest)
+	if err := status.SetInventory(r.hrClient.HelmReleases(hr.Namespace), hr, inventory); err != nil {
+		logger.Log("warning", fmt.Sprintf("failed to record inventory in status: %v", err))
+	}
+}
+
+// manifestInventory returns the sorted references to the objects in
+// the given manifest.
+func manifestInventory(manifest string) []apiV1.ResourceRef {
+	var inventory []apiV1.ResourceRef
+	for _, obj := range releaseManifestToUnstructured(manifest) {
+		if obj.GetKind() == "" || obj.GetName() == "" {
+			continue
+		}
+		inventory = append(inventory, apiV1.ResourceRef{
+			APIVersion: obj.GetAPIVersion(),
+			Kind:       obj.GetKind(),
+			Namespace:  obj.GetNamespace(),
+			Name:       obj.GetName(),
+		})
+	}
+	sort.Slice(inventory, func(i, j int) bool {
+		a, b := inventory[i], inventory[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return inventory
+}
+
+// verifyInventory verifies that the resources in the inventory of the
+// HelmRelease exist, following its policy for missing resources.
+// HelmReleases without an inventory, e.g. released before inventories
+// were recorded, have it backfilled from the manifest of the current
+// release. It returns the missing resources if the release should be
+// upgraded to recreate them; rolled back releases are never upgraded
+// for this, as that would retry the failed upgrade. Failures are
+// logged, as they should not fail the sync.
+func (r *Release) verifyInventory(logger log.Logger, hr *apiV1.HelmRelease, curRel *helm.Release) []string {
+	policy := hr.Spec.MissingResources
+	if policy == "" || policy == apiV1.MissingResourcesIgnore || remoteTarget(hr) {
+		status.SetResourcesMissing(r.hrClient.HelmReleases(hr.Namespace), hr, "")
+		return nil
+	}
+	inventory := hr.Status.Inventory
+	if len(inventory) == 0 && curRel != nil && !status.HasRolledBack(hr) {
+		// the current release of rolled back HelmReleases is the
+		// failed release, whose manifest was never applied in full
+		inventory = manifestInventory(curRel.Manifest)
+		r.recordInventory(logger, hr, curRel)
+	}
+	missing, err := r.missingResources(hr, inventory)
+	if err != nil {
+		logger.Log("warning", fmt.Sprintf("failed to verify inventory of release: %v", err))
+		return nil
+	}
+	if len(missing) == 0 {
+		status.SetResourcesMissing(r.hrClient.HelmReleases(hr.Namespace), hr, "")
+		return nil
+	}
+
+	list := missing
+	if len(list) > maxMissingReports {
+		list = append(list[:maxMissingReports:maxMissingReports], "...")
+	}
+	message := fmt.Sprintf("%d resource(s) of the release are missing: %s", len(missing), strings.Join(list, ", "))
+	if policy == apiV1.MissingResourcesRecreate && !status.HasRolledBack(hr) {
+		logger.Log("info", "recreating missing resources of release", "missing", strings.Join(list, ", "))
+		if r.recorder != nil {
+			r.recorder.Event(hr, corev1.EventTypeWarning, ResourcesRecreated, message)
+		}
+		return missing
+	}
+	logger.Log("warning", "resources of release are missing", "missing", strings.Join(list, ", "))
+	status.SetResourcesMissing(r.hrClient.HelmReleases(hr.Namespace), hr, message)
+	return nil
+}
+
+// missingResources returns the descriptions of the resources in the
+// given inventory of the HelmRelease which do not exist. The resources
+// are listed once per kind and namespace, rather than fetched one by
+// one.
+func (r *Release) missingResources(hr *apiV1.HelmRelease, inventory []apiV1.ResourceRef) ([]string, error) {
+	type group struct{ apiVersion, kind, namespace string }
+	existing := make(map[group]map[string]bool)
+	var missing []string
+	for _, ref := range inventory {
+		obj := unstructured.Unstructured{}
+		obj.SetAPIVersion(ref.APIVersion)
+		obj.SetKind(ref.Kind)
+		obj.SetNamespace(ref.Namespace)
+		obj.SetName(ref.Name)
+
+		g := group{ref.APIVersion, ref.Kind, ref.Namespace}
+		names, ok := existing[g]
+		if !ok {
+			ri, err := resourceInterfaceFor(r.dynamicClient, r.restMapper, obj, hr.GetTargetNamespace())
+			if err != nil {
+				return nil, err
+			}
+			var list *unstructured.UnstructuredList
+			err = retry.OnError(retry.DefaultBackoff, isRetriable, func() (err error) {
+				list, err = ri.List(metav1.ListOptions{})
+				return err
+			})
+			switch {
+			case apierrors.IsNotFound(err):
+				// the resource itself is not served anymore
+			case err != nil:
+				return nil, fmt.Errorf("failed to list %s resources: %w", ref.Kind, err)
+			}
+			names = make(map[string]bool)
+			if list != nil {
+				for _, item := range list.Items {
+					names[item.GetName()] = true
+				}
+			}
+			existing[g] = names
+		}
+		if !names[ref.Name] {
+			missing = append(missing, objectDescription(obj, hr.GetTargetNamespace()))
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,111 @@
+package release
+
+import (
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+func TestManifestInventory(t *testing.T) {
+	manifest := `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: podinfo
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: podinfo
+  namespace: apps
+`
+	assert.Equal(t, []apiV1.ResourceRef{
+		{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "apps", Name: "podinfo"},
+		{APIVersion: "v1", Kind: "Service", Name: "podinfo"},
+	}, manifestInventory(manifest))
+}
+
+func TestVerifyInventory(t *testing.T) {
+	deployment := &unstructured.Unstructured{}
+	deployment.SetAPIVersion("apps/v1")
+	deployment.SetKind("Deployment")
+	deployment.SetNamespace("apps")
+	deployment.SetName("podinfo")
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Service"}, meta.RESTScopeNamespace)
+
+	for _, tc := range []struct {
+		name     string
+		policy   apiV1.MissingResourcesPolicy
+		backfill bool
+		recreate bool
+		message  bool
+	}{
+		{name: "ignore", policy: apiV1.MissingResourcesIgnore},
+		{name: "report", policy: apiV1.MissingResourcesReport, message: true},
+		{name: "recreate", policy: apiV1.MissingResourcesRecreate, recreate: true},
+		{name: "backfill", policy: apiV1.MissingResourcesReport, backfill: true, message: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "podinfo"}}
+			hr.Spec.TargetNamespace = "apps"
+			hr.Spec.MissingResources = tc.policy
+			inventory := []apiV1.ResourceRef{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "podinfo"},
+				{APIVersion: "v1", Kind: "Service", Name: "podinfo"},
+			}
+			if !tc.backfill {
+				hr.Status.Inventory = inventory
+			}
+			curRel := &helm.Release{Manifest: "---\napiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: podinfo\n" +
+				"---\napiVersion: v1\nkind: Service\nmetadata:\n  name: podinfo\n"}
+			client := ifclientsetfake.NewSimpleClientset(hr)
+			r := &Release{
+				hrClient:      client.HelmV1(),
+				dynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), deployment),
+				restMapper:    mapper,
+				recorder:      record.NewFakeRecorder(1),
+			}
+
+			missing := r.verifyInventory(log.NewNopLogger(), hr, curRel)
+			assert.Equal(t, tc.recreate, len(missing) > 0)
+			updated, err := client.HelmV1().HelmReleases("ns").Get("podinfo", metav1.GetOptions{})
+			assert.NoError(t, err)
+			if tc.backfill {
+				var backfilled []apiV1.ResourceRef
+				for _, action := range client.Actions() {
+					if update, ok := action.(k8stesting.UpdateAction); ok && action.GetSubresource() == "status" {
+						if hr := update.GetObject().(*apiV1.HelmRelease); hr.Status.Inventory != nil {
+							backfilled = hr.Status.Inventory
+						}
+					}
+				}
+				assert.Equal(t, inventory, backfilled)
+			}
+			condition := status.GetCondition(updated.Status, apiV1.HelmReleaseResourcesMissing)
+			if !tc.message {
+				assert.Nil(t, condition)
+				return
+			}
+			if assert.NotNil(t, condition) {
+				assert.Equal(t, "1 resource(s) of the release are missing: Service apps/podinfo", condition.Message)
+			}
+		})
+	}
+}
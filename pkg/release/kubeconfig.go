@@ -0,0 +1,207 @@
+package release
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+// HelmClient returns the Helm client for the given HelmRelease. For a
+// HelmRelease with a KubeConfig, this is a client for the remote
+// cluster of the kubeconfig in its Secret.
+func (r *Release) HelmClient(hr *apiV1.HelmRelease) (helm.Client, error) {
+	version := hr.GetHelmVersion(r.config.DefaultHelmVersion)
+	if !remoteTarget(hr) {
+		client, ok := r.helmClients.Load(version)
+		if !ok {
+			return nil, fmt.Errorf("no client found for Helm '%s'", version)
+		}
+		return client, nil
+	}
+	target, err := r.target(hr, false)
+	if err != nil {
+		return nil, err
+	}
+	return target.Client, nil
+}
+
+// uninstallClient returns the Helm client for the uninstall of the
+// release of the given HelmRelease. As the kubeconfig Secret of a
+// remote target is commonly deleted together with the HelmRelease,
+// e.g. with its namespace, the kubeconfig of its last sync is used if
+// the Secret no longer exists.
+func (r *Release) uninstallClient(hr *apiV1.HelmRelease) (helm.Client, error) {
+	if !remoteTarget(hr) {
+		return r.HelmClient(hr)
+	}
+	target, err := r.target(hr, true)
+	if err != nil {
+		return nil, err
+	}
+	return target.Client, nil
+}
+
+// objectClients returns the clients for the objects of the release of
+// the given HelmRelease, which are those of the remote cluster for a
+// HelmRelease with a KubeConfig.
+func (r *Release) objectClients(hr *apiV1.HelmRelease) (dynamic.Interface, meta.RESTMapper, error) {
+	if !remoteTarget(hr) {
+		return r.dynamicClient, r.restMapper, nil
+	}
+	target, err := r.target(hr, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	return target.Dynamic, target.Mapper, nil
+}
+
+// target returns the clients for the remote cluster of the kubeconfig
+// in the Secret of the given HelmRelease.
+func (r *Release) target(hr *apiV1.HelmRelease, cached bool) (helm.Target, error) {
+	if r.config.TargetClients == nil {
+		return helm.Target{}, fmt.Errorf("releases to remote clusters are not allowed by this operator")
+	}
+	kc := hr.Spec.KubeConfig
+	if kc.SecretRef == nil || kc.SecretRef.Name == "" {
+		return helm.Target{}, fmt.Errorf("kubeconfig of HelmRelease does not refer to a Secret")
+	}
+	kubeConfig, err := r.kubeConfig(hr, cached)
+	if err != nil {
+		return helm.Target{}, err
+	}
+	if err := validateKubeConfig(kubeConfig, r.config.RemoteTargetServers); err != nil {
+		return helm.Target{}, fmt.Errorf("invalid kubeconfig in Secret '%s': %w", kc.SecretRef.Name, err)
+	}
+	target, err := r.config.TargetClients.Load(hr.GetHelmVersion(r.config.DefaultHelmVersion), kubeConfig)
+	if err != nil {
+		return helm.Target{}, fmt.Errorf("failed to create Helm client from kubeconfig Secret '%s': %w", kc.SecretRef.Name, err)
+	}
+	r.kubeConfigs.set(hr.Namespace, hr.Name, kubeConfig)
+	return target, nil
+}
+
+// kubeConfig returns the kubeconfig in the Secret of the given
+// HelmRelease. With cached, the kubeconfig of its last sync is
+// returned if the Secret does not exist.
+func (r *Release) kubeConfig(hr *apiV1.HelmRelease, cached bool) ([]byte, error) {
+	kc := hr.Spec.KubeConfig
+	secret, err := r.coreV1Client.Secrets(hr.Namespace).Get(kc.SecretRef.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) && cached {
+		if kubeConfig, ok := r.kubeConfigs.get(hr.Namespace, hr.Name); ok {
+			return kubeConfig, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kubeconfig Secret '%s': %w", kc.SecretRef.Name, err)
+	}
+	kubeConfig, ok := secret.Data[kc.GetKey()]
+	if !ok {
+		return nil, fmt.Errorf("kubeconfig Secret '%s' has no key '%s'", kc.SecretRef.Name, kc.GetKey())
+	}
+	return kubeConfig, nil
+}
+
+// remoteTarget returns if the Helm release of the given HelmRelease is
+// made to a remote cluster. Apart from the ownership of the release,
+// of which the objects are read with the clients of the remote
+// cluster, the checks and mutations of the objects of the release
+// outside of Helm are skipped for those, as they are made with the
+// clients for the cluster of the operator.
+func remoteTarget(hr *apiV1.HelmRelease) bool {
+	return hr.Spec.KubeConfig != nil
+}
+
+// validateKubeConfig validates the given kubeconfig of a remote
+// cluster. As it is provided by the author of a HelmRelease, it may
+// not run commands or read files in the container of the operator,
+// which would expose the credentials of the operator, and its servers
+// must be HTTPS URLs of which the host matches one of the given
+// patterns, if any.
+func validateKubeConfig(kubeConfig []byte, servers []string) error {
+	config, err := clientcmd.Load(kubeConfig)
+	if err != nil {
+		return err
+	}
+	for name, cluster := range config.Clusters {
+		switch {
+		case cluster.CertificateAuthority != "":
+			return fmt.Errorf("cluster '%s' refers to a certificate authority file", name)
+		case cluster.InsecureSkipTLSVerify:
+			return fmt.Errorf("cluster '%s' skips the verification of the server certificate", name)
+		}
+		if err := validateServer(cluster.Server, servers); err != nil {
+			return fmt.Errorf("cluster '%s': %w", name, err)
+		}
+	}
+	for name, user := range config.AuthInfos {
+		switch {
+		case user.Exec != nil:
+			return fmt.Errorf("user '%s' uses an exec credential plugin", name)
+		case user.AuthProvider != nil:
+			return fmt.Errorf("user '%s' uses an auth provider", name)
+		case user.TokenFile != "" || user.ClientCertificate != "" || user.ClientKey != "":
+			return fmt.Errorf("user '%s' refers to a credentials file", name)
+		}
+	}
+	return nil
+}
+
+// validateServer validates the given server URL is an HTTPS URL of
+// which the host matches one of the given patterns, if any.
+func validateServer(server string, patterns []string) error {
+	u, err := url.Parse(server)
+	if err != nil {
+		return fmt.Errorf("invalid server URL: %w", err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("server '%s' is not an HTTPS URL", server)
+	}
+	if len(patterns) == 0 {
+		return nil
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, u.Hostname()); ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("server '%s' is not allowed", server)
+}
+
+// kubeConfigCache holds the kubeconfig of the last sync of each
+// `HelmRelease` with a KubeConfig, by namespace and name.
+type kubeConfigCache struct {
+	mu      sync.RWMutex
+	configs map[string][]byte
+}
+
+func (c *kubeConfigCache) set(namespace, name string, kubeConfig []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.configs == nil {
+		c.configs = make(map[string][]byte)
+	}
+	c.configs[namespace+"/"+name] = kubeConfig
+}
+
+func (c *kubeConfigCache) get(namespace, name string) ([]byte, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	kubeConfig, ok := c.configs[namespace+"/"+name]
+	return kubeConfig, ok
+}
+
+func (c *kubeConfigCache) remove(namespace, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.configs, namespace+"/"+name)
+}
@@ -0,0 +1,104 @@
+package release
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+const remoteKubeConfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: remote
+  cluster:
+    server: https://remote.example.com
+contexts:
+- name: remote
+  context:
+    cluster: remote
+    user: remote
+current-context: remote
+users:
+- name: remote
+  user:
+    token: secret
+`
+
+type remoteHelmClient struct {
+	helm.Client
+	kubeConfig string
+}
+
+func TestHelmClient(t *testing.T) {
+	local := remoteHelmClient{}
+	helmClients := &helm.Clients{}
+	helmClients.Add("v3", local)
+
+	var created int
+	remoteDynamic := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	targets := helm.NewTargetClients(func(version string, kubeConfig []byte) (helm.Target, error) {
+		created++
+		return helm.Target{Client: remoteHelmClient{kubeConfig: string(kubeConfig)}, Dynamic: remoteDynamic}, nil
+	}, time.Minute)
+
+	kubeClient := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "remote"},
+		Data: map[string][]byte{
+			"value":  []byte(remoteKubeConfig),
+			"exec":   []byte(remoteKubeConfig + "    exec:\n      command: /bin/sh\n      apiVersion: client.authentication.k8s.io/v1beta1\n"),
+			"broken": []byte("{"),
+			"http":   []byte(strings.Replace(remoteKubeConfig, "https://", "http://", 1)),
+			"other":  []byte(strings.Replace(remoteKubeConfig, "remote.example.com", "kubernetes.default", 1)),
+		},
+	})
+	r := &Release{
+		helmClients:  helmClients,
+		coreV1Client: kubeClient.CoreV1(),
+		config:       Config{DefaultHelmVersion: "v3", TargetClients: targets, RemoteTargetServers: []string{"*.example.com"}},
+	}
+
+	hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "podinfo"}}
+	client, err := r.HelmClient(hr)
+	assert.NoError(t, err)
+	assert.Equal(t, local, client)
+
+	hr.Spec.KubeConfig = &apiV1.KubeConfig{SecretRef: &apiV1.LocalObjectReference{Name: "remote"}}
+	client, err = r.HelmClient(hr)
+	assert.NoError(t, err)
+	assert.Equal(t, remoteKubeConfig, client.(remoteHelmClient).kubeConfig)
+	// the ownership of remote releases is determined on the remote cluster
+	dynamicClient, _, err := r.objectClients(hr)
+	assert.NoError(t, err)
+	assert.Equal(t, remoteDynamic, dynamicClient)
+
+	for _, key := range []string{"exec", "broken", "missing", "http", "other"} {
+		hr.Spec.KubeConfig.Key = key
+		_, err = r.HelmClient(hr)
+		assert.Error(t, err, key)
+	}
+	assert.Equal(t, 1, created)
+
+	// the kubeconfig of the last sync uninstalls the release once the
+	// Secret is deleted
+	hr.Spec.KubeConfig.Key = ""
+	assert.NoError(t, kubeClient.CoreV1().Secrets("ns").Delete("remote", &metav1.DeleteOptions{}))
+	_, err = r.HelmClient(hr)
+	assert.Error(t, err)
+	client, err = r.uninstallClient(hr)
+	assert.NoError(t, err)
+	assert.Equal(t, remoteKubeConfig, client.(remoteHelmClient).kubeConfig)
+
+	r.config.TargetClients = nil
+	_, err = r.HelmClient(hr)
+	assert.Error(t, err)
+}
@@ -0,0 +1,108 @@
+package release
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+// kustomizePostRenderer applies the kustomize patches and image
+// overrides of a HelmRelease to the rendered manifests. Like
+// kustomize, strategic merge patches are applied first, followed by
+// the JSON 6902 patches and image overrides.
+type kustomizePostRenderer struct {
+	kustomize apiV1.Kustomize
+	namespace string
+}
+
+func (k kustomizePostRenderer) Run(renderedManifests *bytes.Buffer) (*bytes.Buffer, error) {
+	objs := releaseManifestToUnstructured(renderedManifests.String())
+
+	for i, patch := range k.kustomize.PatchesStrategicMerge {
+		if err := k.applyStrategicMergePatch(objs, patch); err != nil {
+			return nil, fmt.Errorf("kustomize: failed to apply strategic merge patch %d: %w", i, err)
+		}
+	}
+	for i := range objs {
+		obj := &objs[i]
+		for _, patch := range k.kustomize.PatchesJSON6902 {
+			if !patchTargetMatches(patch.Target, *obj, k.namespace) {
+				continue
+			}
+			if err := applyJSON6902Patch(obj, patch.Patch); err != nil {
+				return nil, fmt.Errorf("kustomize: failed to patch %s: %w", objectDescription(*obj, k.namespace), err)
+			}
+		}
+		if len(k.kustomize.Images) > 0 {
+			if err := overrideImages(obj, k.kustomize.Images); err != nil {
+				return nil, fmt.Errorf("kustomize: failed to override images of %s: %w", objectDescription(*obj, k.namespace), err)
+			}
+		}
+	}
+	return unstructuredToManifests(objs)
+}
+
+// applyStrategicMergePatch applies the given patch to the object it
+// targets. It returns an error if the patch does not target any of
+// the objects.
+func (k kustomizePostRenderer) applyStrategicMergePatch(objs []unstructured.Unstructured, patch string) error {
+	var p unstructured.Unstructured
+	if err := yaml.Unmarshal([]byte(patch), &p); err != nil {
+		return fmt.Errorf("failed to parse patch: %w", err)
+	}
+	target := apiV1.PatchTarget{
+		Group:     p.GroupVersionKind().Group,
+		Version:   p.GroupVersionKind().Version,
+		Kind:      p.GetKind(),
+		Name:      p.GetName(),
+		Namespace: p.GetNamespace(),
+	}
+	if target.Kind == "" || target.Name == "" {
+		return fmt.Errorf("patch must set a kind and metadata.name")
+	}
+	patchJSON, err := p.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	for i := range objs {
+		obj := &objs[i]
+		if !patchTargetMatches(target, *obj, k.namespace) {
+			continue
+		}
+		objJSON, err := obj.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		var patched []byte
+		// Strategic merge patches require the Go type of the object
+		// to look up the patch strategy; fall back to a JSON merge
+		// patch for kinds we do not know about (e.g. custom resources).
+		if dataStruct, err := scheme.Scheme.New(obj.GroupVersionKind()); err == nil {
+			patched, err = strategicpatch.StrategicMergePatch(objJSON, patchJSON, dataStruct)
+			if err != nil {
+				return err
+			}
+		} else {
+			patched, err = jsonpatch.MergePatch(objJSON, patchJSON)
+			if err != nil {
+				return err
+			}
+		}
+		var out map[string]interface{}
+		if err := json.Unmarshal(patched, &out); err != nil {
+			return err
+		}
+		obj.Object = out
+		return nil
+	}
+	return fmt.Errorf("no resource matches %s %s", target.Kind, target.Name)
+}
@@ -0,0 +1,62 @@
+package release
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+func TestKustomizePostRenderer(t *testing.T) {
+	manifest := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        image: nginx:1.17
+      - name: sidecar
+        image: envoy:1.14
+`
+	k := kustomizePostRenderer{
+		namespace: "default",
+		kustomize: apiV1.Kustomize{
+			PatchesStrategicMerge: []string{`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: sidecar
+        resources:
+          limits:
+            memory: 64Mi
+`},
+			Images: []apiV1.ImageOverride{{Name: "envoy", NewTag: "1.15"}},
+		},
+	}
+	out, err := k.Run(bytes.NewBufferString(manifest))
+	assert.NoError(t, err)
+
+	objs := releaseManifestToUnstructured(out.String())
+	assert.Len(t, objs, 1)
+	containers, _, _ := unstructured.NestedSlice(objs[0].Object, "spec", "template", "spec", "containers")
+	assert.Len(t, containers, 2)
+	sidecar := containers[1].(map[string]interface{})
+	assert.Equal(t, "envoy:1.15", sidecar["image"])
+	memory, _, _ := unstructured.NestedString(sidecar, "resources", "limits", "memory")
+	assert.Equal(t, "64Mi", memory)
+
+	k.kustomize.PatchesStrategicMerge = []string{"apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n"}
+	_, err = k.Run(bytes.NewBufferString(manifest))
+	assert.Error(t, err)
+}
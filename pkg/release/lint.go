@@ -0,0 +1,96 @@
+package release
+
+import (
+	"fmt"
+
+	"github.com/go-kit/kit/log"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+// maxLintFindings is the maximum amount of findings of the chart
+// linter recorded in the status of a HelmRelease.
+const maxLintFindings = 20
+
+// LintFailedError is returned if the chart linter reported findings
+// of the severity configured to fail the release.
+type LintFailedError struct {
+	Findings []apiV1.LintFinding
+}
+
+func (err LintFailedError) Error() string {
+	f := err.Findings[0]
+	return fmt.Sprintf("chart lint failed with %d finding(s), first: [%s] %s: %s", len(err.Findings), f.Severity, f.Path, f.Message)
+}
+
+// lintChart lints the chart with the composed values of the given
+// HelmRelease, and records the findings of at least the configured
+// severity in its status. It returns a LintFailedError if findings
+// of the severity configured to fail the release are reported.
+func (r *Release) lintChart(logger log.Logger, client helm.Client, hr *apiV1.HelmRelease, chart chart, values []byte) error {
+	if !hr.Spec.Lint.Enable {
+		if len(hr.Status.LintFindings) > 0 {
+			status.SetLintFindings(r.hrClient.HelmReleases(hr.Namespace), hr, nil)
+		}
+		return nil
+	}
+	messages, err := client.Lint(chart.chartPath, values, helm.LintOptions{Namespace: hr.GetTargetNamespace()})
+	if err != nil {
+		return fmt.Errorf("failed to lint chart: %w", err)
+	}
+
+	findings, failed := lintFindings(messages, hr.Spec.Lint)
+	for _, f := range findings {
+		logger.Log("info", "chart lint finding", "severity", f.Severity, "path", f.Path, "message", f.Message)
+	}
+	recorded := findings
+	if len(recorded) > maxLintFindings {
+		recorded = recorded[:maxLintFindings]
+	}
+	if err := status.SetLintFindings(r.hrClient.HelmReleases(hr.Namespace), hr, recorded); err != nil {
+		logger.Log("warning", fmt.Sprintf("failed to record chart lint findings: %v", err))
+	}
+	if len(failed) > 0 {
+		return LintFailedError{Findings: failed}
+	}
+	return nil
+}
+
+// lintFindings returns the messages of the linter of at least the
+// configured severity, and the messages failing the release.
+func lintFindings(messages []helm.LintMessage, lint apiV1.Lint) (findings, failed []apiV1.LintFinding) {
+	threshold := lintSeverity(lint.GetSeverity())
+	for _, m := range messages {
+		finding := apiV1.LintFinding{Severity: lintFindingSeverity(m.Severity), Path: m.Path, Message: m.Message}
+		fails := lint.FailOn != "" && m.Severity >= lintSeverity(lint.FailOn)
+		if fails {
+			failed = append(failed, finding)
+		}
+		if fails || m.Severity >= threshold {
+			findings = append(findings, finding)
+		}
+	}
+	return
+}
+
+func lintSeverity(s apiV1.LintSeverity) helm.LintSeverity {
+	switch s {
+	case apiV1.LintSeverityInfo:
+		return helm.LintInfo
+	case apiV1.LintSeverityError:
+		return helm.LintError
+	}
+	return helm.LintWarning
+}
+
+func lintFindingSeverity(s helm.LintSeverity) apiV1.LintSeverity {
+	switch s {
+	case helm.LintInfo:
+		return apiV1.LintSeverityInfo
+	case helm.LintError:
+		return apiV1.LintSeverityError
+	}
+	return apiV1.LintSeverityWarning
+}
@@ -0,0 +1,41 @@
+package release
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+func TestLintFindings(t *testing.T) {
+	messages := []helm.LintMessage{
+		{Severity: helm.LintInfo, Path: "Chart.yaml", Message: "icon is recommended"},
+		{Severity: helm.LintWarning, Path: "values.yaml", Message: "file is empty"},
+		{Severity: helm.LintError, Path: "templates/deployment.yaml", Message: "unable to parse YAML"},
+	}
+	info := apiV1.LintFinding{Severity: apiV1.LintSeverityInfo, Path: "Chart.yaml", Message: "icon is recommended"}
+	warning := apiV1.LintFinding{Severity: apiV1.LintSeverityWarning, Path: "values.yaml", Message: "file is empty"}
+	errorFinding := apiV1.LintFinding{Severity: apiV1.LintSeverityError, Path: "templates/deployment.yaml", Message: "unable to parse YAML"}
+
+	for _, tc := range []struct {
+		name         string
+		lint         apiV1.Lint
+		wantFindings []apiV1.LintFinding
+		wantFailed   []apiV1.LintFinding
+	}{
+		{name: "default", wantFindings: []apiV1.LintFinding{warning, errorFinding}},
+		{name: "info", lint: apiV1.Lint{Severity: apiV1.LintSeverityInfo}, wantFindings: []apiV1.LintFinding{info, warning, errorFinding}},
+		{name: "fail on error", lint: apiV1.Lint{FailOn: apiV1.LintSeverityError},
+			wantFindings: []apiV1.LintFinding{warning, errorFinding}, wantFailed: []apiV1.LintFinding{errorFinding}},
+		{name: "fail below severity", lint: apiV1.Lint{Severity: apiV1.LintSeverityError, FailOn: apiV1.LintSeverityWarning},
+			wantFindings: []apiV1.LintFinding{warning, errorFinding}, wantFailed: []apiV1.LintFinding{warning, errorFinding}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			findings, failed := lintFindings(messages, tc.lint)
+			assert.Equal(t, tc.wantFindings, findings)
+			assert.Equal(t, tc.wantFailed, failed)
+		})
+	}
+}
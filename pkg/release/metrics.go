@@ -6,6 +6,8 @@ import (
 
 	"github.com/go-kit/kit/metrics/prometheus"
 	stdprometheus "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/lstack-org/helm-operator/pkg/metrics"
 )
 
 const (
@@ -14,6 +16,9 @@ const (
 	LabelTargetNamespace = "target_namespace"
 	LabelReleaseName     = "release_name"
 	LabelAction          = "action"
+	LabelStage           = "stage"
+	LabelReason          = "reason"
+	LabelResult          = "result"
 )
 
 var (
@@ -43,20 +48,51 @@ var (
 		ConstLabels: nil,
 		Buckets:     durationBuckets,
 	}, []string{LabelAction, LabelSuccess, LabelTargetNamespace, LabelReleaseName})
+	postRenderFailures = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "post_render_failures_total",
+		Help:      "Count of failures of the built-in post-renderer, by stage.",
+	}, []string{LabelStage, LabelTargetNamespace, LabelReleaseName})
+	skippedSyncs = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "release_sync_skipped_total",
+		Help:      "Count of release syncs skipped, e.g. due to lock contention, a release status which does not allow an upgrade, or an ownership conflict, by reason.",
+	}, []string{LabelReason, LabelTargetNamespace, LabelReleaseName})
+	reconcileDuration = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "release_reconcile_duration_seconds",
+		Help:      "Release reconciliation duration in seconds, by the action the reconciliation started with, or `prepare` if it failed before determining one, and its result.",
+		Buckets:   durationBuckets,
+	}, []string{LabelAction, LabelResult, LabelTargetNamespace, LabelReleaseName})
+	storagePrunes = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "release_storage_pruned_total",
+		Help:      "Count of release revisions pruned from the release storage, by reason.",
+	}, []string{LabelReason, LabelTargetNamespace})
 	syncAction = "sync"
 )
 
+// The results of reconciliations, the values of the result label.
+const (
+	resultSuccess = "success"
+	resultFailure = "failure"
+)
+
 func ObserveRelease(start time.Time, success bool, namespace, releaseName string) {
 	releaseDuration.With(
 		LabelSuccess, fmt.Sprint(success),
 		LabelNamespace, namespace,
-		LabelReleaseName, releaseName,
+		LabelReleaseName, metrics.ReleaseName(namespace, releaseName),
 	).Observe(time.Since(start).Seconds())
 	releaseActionDuration.With(
 		LabelAction, syncAction,
 		LabelSuccess, fmt.Sprint(success),
 		LabelTargetNamespace, namespace,
-		LabelReleaseName, releaseName,
+		LabelReleaseName, metrics.ReleaseName(namespace, releaseName),
 	).Observe(time.Since(start).Seconds())
 }
 
@@ -65,12 +101,48 @@ func ObserveReleaseAction(start time.Time, action action, success bool, namespac
 		LabelAction, string(action),
 		LabelSuccess, fmt.Sprint(success),
 		LabelNamespace, namespace,
-		LabelReleaseName, releaseName,
+		LabelReleaseName, metrics.ReleaseName(namespace, releaseName),
 	).Observe(time.Since(start).Seconds())
 	releaseActionDuration.With(
 		LabelAction, string(action),
 		LabelSuccess, fmt.Sprint(success),
 		LabelTargetNamespace, namespace,
-		LabelReleaseName, releaseName,
+		LabelReleaseName, metrics.ReleaseName(namespace, releaseName),
 	).Observe(time.Since(start).Seconds())
 }
+
+func ObserveReconcile(start time.Time, action action, err error, namespace, releaseName string) {
+	result := resultSuccess
+	if err != nil {
+		result = resultFailure
+	}
+	reconcileDuration.With(
+		LabelAction, string(action),
+		LabelResult, result,
+		LabelTargetNamespace, namespace,
+		LabelReleaseName, metrics.ReleaseName(namespace, releaseName),
+	).Observe(time.Since(start).Seconds())
+}
+
+func ObservePostRenderFailure(stage postRenderStage, namespace, releaseName string) {
+	postRenderFailures.With(
+		LabelStage, string(stage),
+		LabelTargetNamespace, namespace,
+		LabelReleaseName, metrics.ReleaseName(namespace, releaseName),
+	).Add(1)
+}
+
+func ObserveSkippedSync(reason, namespace, releaseName string) {
+	skippedSyncs.With(
+		LabelReason, reason,
+		LabelTargetNamespace, namespace,
+		LabelReleaseName, metrics.ReleaseName(namespace, releaseName),
+	).Add(1)
+}
+
+func ObserveStoragePrune(reason, namespace string) {
+	storagePrunes.With(
+		LabelReason, reason,
+		LabelTargetNamespace, namespace,
+	).Add(1)
+}
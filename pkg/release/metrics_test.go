@@ -0,0 +1,44 @@
+package release
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+// reconcileCount returns the count of observed reconciliations in the
+// given target namespace by action and result.
+func reconcileCount(t *testing.T, namespace string) map[string]uint64 {
+	families, err := stdprometheus.DefaultGatherer.Gather()
+	assert.NoError(t, err)
+	counts := make(map[string]uint64)
+	for _, f := range families {
+		if f.GetName() != "flux_helm_operator_release_reconcile_duration_seconds" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			labels := make(map[string]string)
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels[LabelTargetNamespace] == namespace {
+				counts[labels[LabelAction]+"/"+labels[LabelResult]] += m.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	return counts
+}
+
+func TestObserveReconcile(t *testing.T) {
+	ObserveReconcile(time.Now(), PrepareAction, errors.New("failed to prepare chart"), "reconcile-test", "podinfo")
+	ObserveReconcile(time.Now(), UpgradeAction, nil, "reconcile-test", "podinfo")
+	ObserveReconcile(time.Now(), UpgradeAction, nil, "reconcile-test", "podinfo")
+
+	assert.Equal(t, map[string]uint64{
+		"prepare/failure": 1,
+		"upgrade/success": 2,
+	}, reconcileCount(t, "reconcile-test"))
+}
@@ -0,0 +1,38 @@
+package release
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+// maxNotesSize is the maximum size of the notes recorded in the
+// status.
+const maxNotesSize = 8192
+
+// recordNotes records the rendered notes of the chart of the given
+// release in the status of the HelmRelease. Failures are logged, as
+// they should not fail the release.
+func (r *Release) recordNotes(logger log.Logger, hr *apiV1.HelmRelease, rel *helm.Release) {
+	if rel == nil || rel.Info == nil {
+		return
+	}
+	if err := status.SetNotes(r.hrClient.HelmReleases(hr.Namespace), hr, releaseNotes(rel.Info.Notes)); err != nil {
+		logger.Log("warning", fmt.Sprintf("failed to record notes in status: %v", err))
+	}
+}
+
+// releaseNotes returns the given notes trimmed, and truncated to the
+// maximum size on a line boundary.
+func releaseNotes(notes string) string {
+	notes, truncated := truncateDiff(strings.TrimSpace(notes), maxNotesSize)
+	if truncated {
+		notes += "..."
+	}
+	return notes
+}
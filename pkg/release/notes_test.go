@@ -0,0 +1,17 @@
+package release
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReleaseNotes(t *testing.T) {
+	assert.Equal(t, "Visit http://podinfo.local", releaseNotes("\nVisit http://podinfo.local\n\n"))
+
+	long := strings.Repeat("kubectl port-forward svc/podinfo 8080:9898\n", 500)
+	notes := releaseNotes(long)
+	assert.True(t, len(notes) <= maxNotesSize+len("..."))
+	assert.True(t, strings.HasSuffix(notes, "9898\n..."))
+}
@@ -0,0 +1,38 @@
+package release
+
+import (
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+	"github.com/lstack-org/helm-operator/pkg/notify"
+)
+
+// SetNotifier sets the notifier the lifecycle events of releases are
+// sent to.
+func (r *Release) SetNotifier(notifier *notify.Notifier) {
+	r.notifier = notifier
+}
+
+// notify sends the event of the given type for the given release of
+// the HelmRelease, if notifications are configured. The release may
+// be nil.
+func (r *Release) notify(eventType notify.EventType, hr *apiV1.HelmRelease, rel *helm.Release, message string) {
+	if r.notifier == nil {
+		return
+	}
+	e := notify.Event{
+		Type:            eventType,
+		Namespace:       hr.Namespace,
+		Name:            hr.Name,
+		ReleaseName:     hr.GetReleaseName(),
+		TargetNamespace: hr.GetTargetNamespace(),
+		Message:         message,
+	}
+	if rel != nil {
+		e.Revision = rel.Version
+		if rel.Chart != nil {
+			e.ChartName = rel.Chart.Name
+			e.ChartVersion = rel.Chart.Version
+		}
+	}
+	r.notifier.Notify(e)
+}
@@ -0,0 +1,157 @@
+package release
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/lstack-org/helm-operator/pkg/api"
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+	"github.com/lstack-org/helm-operator/pkg/notify"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+const (
+	// RequestedActionAnnotation is the annotation on a HelmRelease
+	// holding the action requested through the API, run on the
+	// reconciliation requested with it instead of a regular sync.
+	RequestedActionAnnotation = "helm.fluxcd.io/requested-action"
+	// RollbackVersionAnnotation is the annotation on a HelmRelease
+	// holding the version of the Helm release a requested rollback
+	// rolls back to, the previous version if it is not set.
+	RollbackVersionAnnotation = "helm.fluxcd.io/rollback-version"
+
+	// ReleaseActionRequested is the reason of the Event emitted when a
+	// requested action has been run.
+	ReleaseActionRequested = "ReleaseActionRequested"
+)
+
+// RequestAction requests the given action for the given HelmRelease,
+// by requesting a reconciliation of it with the action annotated. The
+// target is only used by rollbacks.
+func (r *Release) RequestAction(namespace, name string, action api.ReleaseAction, target api.RollbackTarget) error {
+	hr, err := r.hrClient.HelmReleases(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if action != api.ReleaseActionRollback && target != (api.RollbackTarget{}) {
+		return api.InvalidActionError{Reason: fmt.Sprintf("a %s has no rollback target", action)}
+	}
+
+	var requested, version interface{}
+	switch action {
+	case api.ReleaseActionSync:
+		// a sync removes any pending action
+	case api.ReleaseActionTest:
+		requested = string(action)
+	case api.ReleaseActionRollback:
+		requested = string(action)
+		switch {
+		case target.Revision != 0 && target.Generation != 0:
+			return api.InvalidActionError{Reason: "a rollback targets either a revision or a generation"}
+		case target.Revision < 0:
+			return api.InvalidActionError{Reason: fmt.Sprintf("invalid revision %d", target.Revision)}
+		case target.Revision > 0:
+			version = strconv.Itoa(target.Revision)
+		case target.Generation != 0:
+			v, ok := generationVersion(hr, target.Generation)
+			if !ok {
+				return api.InvalidActionError{Reason: fmt.Sprintf("no revision in the history for generation %d", target.Generation)}
+			}
+			version = strconv.Itoa(v)
+		}
+	default:
+		return api.InvalidActionError{Reason: fmt.Sprintf("unsupported action '%s'", action)}
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				apiV1.ReconcileAtAnnotation: time.Now().UTC().Format(time.RFC3339Nano),
+				RequestedActionAnnotation:   requested,
+				RollbackVersionAnnotation:   version,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.hrClient.HelmReleases(namespace).Patch(name, types.MergePatchType, patch)
+	return err
+}
+
+// requestedAction returns the action requested for the given
+// HelmRelease, if its reconciliation has been requested with one.
+func requestedAction(hr *apiV1.HelmRelease) action {
+	if !status.ReconcileRequested(hr) {
+		return ""
+	}
+	switch a := action(hr.GetAnnotations()[RequestedActionAnnotation]); a {
+	case RollbackAction, TestAction:
+		return a
+	}
+	return ""
+}
+
+// runRequestedAction runs the requested action for the given
+// HelmRelease, which requires its Helm release to exist. Neither
+// action uses the chart of the HelmRelease.
+func (r *Release) runRequestedAction(logger log.Logger, client helm.Client, action action, hr *apiV1.HelmRelease) error {
+	curRel, err := client.Get(hr.GetReleaseName(), helm.GetOptions{Namespace: hr.GetTargetNamespace()})
+	if err != nil {
+		err = fmt.Errorf("failed to retrieve Helm release: %w", err)
+		logger.Log("error", err, "action", action)
+		return err
+	}
+	if curRel == nil {
+		err = apierrors.NewNotFound(helmReleaseResource, hr.GetReleaseName())
+		logger.Log("error", fmt.Sprintf("failed to run requested %s: %v", action, err), "action", action)
+		return err
+	}
+
+	logger.Log("info", fmt.Sprintf("running requested %s", action), "action", action)
+	switch action {
+	case RollbackAction:
+		version, _ := strconv.Atoi(hr.GetAnnotations()[RollbackVersionAnnotation])
+		if version == 0 && curRel.Version < 2 {
+			err = fmt.Errorf("release version '%d' has no previous version to roll back to", curRel.Version)
+			logger.Log("error", err, "action", action)
+			return err
+		}
+		if err := r.checkHalt(logger, action, hr); err != nil {
+			return err
+		}
+		newRel, err := r.rollback(client, hr, hr.Status.Revision, version)
+		if err != nil {
+			logger.Log("error", err, "action", action)
+			return err
+		}
+		if err := r.annotate(hr, newRel); err != nil {
+			logger.Log("warning", err, "action", action)
+		}
+		r.recordImages(logger, hr, newRel)
+		r.pruneResources(logger, hr, curRel, newRel)
+		r.recordInventory(logger, hr, newRel)
+		r.recordNotes(logger, hr, newRel)
+		r.recordHistory(logger, hr, newRel)
+		r.notify(notify.RolledBack, hr, newRel, "requested rollback succeeded")
+	case TestAction:
+		if err := r.test(client, hr); err != nil {
+			logger.Log("error", err, "action", action)
+			return err
+		}
+	}
+	logger.Log("info", fmt.Sprintf("requested %s succeeded", action), "action", action)
+	if r.recorder != nil {
+		r.recorder.Event(hr, corev1.EventTypeNormal, ReleaseActionRequested,
+			fmt.Sprintf("Requested %s of release version '%d' succeeded", action, curRel.Version))
+	}
+	return nil
+}
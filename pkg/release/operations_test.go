@@ -0,0 +1,41 @@
+package release
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/lstack-org/helm-operator/pkg/api"
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+)
+
+func TestRequestAction(t *testing.T) {
+	hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "podinfo"}}
+	client := ifclientsetfake.NewSimpleClientset(hr)
+	r := &Release{hrClient: client.HelmV1()}
+
+	assert.NoError(t, r.RequestAction("ns", "podinfo", api.ReleaseActionRollback, api.RollbackTarget{}))
+	updated, err := client.HelmV1().HelmReleases("ns").Get("podinfo", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, updated.GetAnnotations()[apiV1.ReconcileAtAnnotation])
+	assert.Equal(t, "rollback", updated.GetAnnotations()[RequestedActionAnnotation])
+	assert.Equal(t, RollbackAction, requestedAction(updated))
+
+	// the action is no longer requested once the reconciliation
+	// has been handled
+	updated.Status.LastHandledReconcileAt = updated.GetAnnotations()[apiV1.ReconcileAtAnnotation]
+	assert.Equal(t, action(""), requestedAction(updated))
+
+	// a sync removes the pending action
+	assert.NoError(t, r.RequestAction("ns", "podinfo", api.ReleaseActionSync, api.RollbackTarget{}))
+	updated, err = client.HelmV1().HelmReleases("ns").Get("podinfo", metav1.GetOptions{})
+	assert.NoError(t, err)
+	_, ok := updated.GetAnnotations()[RequestedActionAnnotation]
+	assert.False(t, ok)
+	assert.Equal(t, action(""), requestedAction(updated))
+
+	assert.Error(t, r.RequestAction("ns", "podinfo", api.ReleaseAction("uninstall"), api.RollbackTarget{}))
+	assert.Error(t, r.RequestAction("ns", "missing", api.ReleaseActionTest, api.RollbackTarget{}))
+}
@@ -0,0 +1,112 @@
+package release
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-kit/kit/log"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/chartsync"
+)
+
+// OssCredentialsLabel marks the Secrets the operator migrated the
+// encrypted inline object storage credentials of a HelmRelease to, with
+// the name of the HelmRelease as the value.
+const OssCredentialsLabel = "helm.fluxcd.io/oss-credentials"
+
+// OssCredentialsSecretName returns the name of the Secret the inline
+// object storage credentials of the HelmRelease are migrated to.
+func OssCredentialsSecretName(hr *apiV1.HelmRelease) string {
+	return hr.Name + "-oss-credentials"
+}
+
+// migrateOssCredentials moves the encrypted inline object storage
+// credentials of the given HelmRelease to a Secret, if enabled in the
+// config. The credentials are decrypted with the configured key, and
+// the spec is patched to reference the Secret instead, so releases
+// encrypted with the key which used to be built into the operator keep
+// working once their credentials have been migrated. It returns the
+// patched HelmRelease.
+func (r *Release) migrateOssCredentials(logger log.Logger, hr *apiV1.HelmRelease) (*apiV1.HelmRelease, error) {
+	source := hr.Spec.Oss
+	if !r.config.MigrateOssCredentials || source == nil || !source.AckEncrypted || source.SecretRef != nil {
+		return hr, nil
+	}
+	creds, err := chartsync.DecryptOssCredentials(r.coreV1Client, hr.Namespace, source, r.config.OssDecryptionKey)
+	if err != nil {
+		return hr, fmt.Errorf("failed to migrate object storage credentials: %w", err)
+	}
+	if err := r.writeOssCredentials(hr, creds); err != nil {
+		return hr, fmt.Errorf("failed to migrate object storage credentials: %w", err)
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"chart": map[string]interface{}{
+				"oss": map[string]interface{}{
+					"ackId":            "",
+					"ackSecret":        "",
+					"ackEncrypted":     false,
+					"decryptionKeyRef": nil,
+					"secretRef":        map[string]string{"name": OssCredentialsSecretName(hr)},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return hr, err
+	}
+	updated, err := r.hrClient.HelmReleases(hr.Namespace).Patch(hr.Name, types.MergePatchType, patch)
+	if err != nil {
+		return hr, fmt.Errorf("failed to migrate object storage credentials: %w", err)
+	}
+	logger.Log("info", fmt.Sprintf("migrated encrypted object storage credentials to Secret '%s'", OssCredentialsSecretName(hr)))
+	return updated, nil
+}
+
+// writeOssCredentials creates or updates the Secret holding the
+// migrated object storage credentials of the given HelmRelease.
+func (r *Release) writeOssCredentials(hr *apiV1.HelmRelease, creds chartsync.Credentials) error {
+	controller := true
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      OssCredentialsSecretName(hr),
+			Namespace: hr.Namespace,
+			Labels:    map[string]string{OssCredentialsLabel: hr.Name},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: apiV1.SchemeGroupVersion.String(),
+				Kind:       "HelmRelease",
+				Name:       hr.Name,
+				UID:        hr.UID,
+				Controller: &controller,
+			}},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			"ackId":     []byte(creds.AccessKeyID),
+			"ackSecret": []byte(creds.AccessKeySecret),
+		},
+	}
+
+	secrets := r.coreV1Client.Secrets(hr.Namespace)
+	current, err := secrets.Get(secret.Name, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		_, err = secrets.Create(secret)
+		return err
+	case err != nil:
+		return err
+	}
+	if current.Labels[OssCredentialsLabel] != hr.Name {
+		return fmt.Errorf("Secret '%s' exists and is not managed by the operator", secret.Name)
+	}
+	current.Data = secret.Data
+	current.OwnerReferences = secret.OwnerReferences
+	_, err = secrets.Update(current)
+	return err
+}
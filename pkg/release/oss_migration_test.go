@@ -0,0 +1,80 @@
+package release
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+)
+
+func TestMigrateOssCredentials(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	encrypt := func(plain string) string {
+		c, err := aes.NewCipher(key)
+		assert.NoError(t, err)
+		padding := aes.BlockSize - len(plain)%aes.BlockSize
+		data := append([]byte(plain), bytes.Repeat([]byte{byte(padding)}, padding)...)
+		for start := 0; start < len(data); start += aes.BlockSize {
+			c.Encrypt(data[start:start+aes.BlockSize], data[start:start+aes.BlockSize])
+		}
+		return base64.StdEncoding.EncodeToString(data)
+	}
+	hr := &apiV1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "flux", Name: "podinfo", UID: "uid"},
+		Spec: apiV1.HelmReleaseSpec{ChartSource: apiV1.ChartSource{Oss: &apiV1.Oss{
+			CloudProvider: "aliyun",
+			Bucket:        "charts",
+			Key:           "podinfo.tgz",
+			AckId:         encrypt("id"),
+			AckSecret:     encrypt("secret"),
+			AckEncrypted:  true,
+		}}},
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		r := &Release{hrClient: ifclientsetfake.NewSimpleClientset(hr).HelmV1(), coreV1Client: fake.NewSimpleClientset().CoreV1(),
+			config: Config{OssDecryptionKey: key}}
+		updated, err := r.migrateOssCredentials(log.NewNopLogger(), hr)
+		assert.NoError(t, err)
+		assert.Equal(t, hr, updated)
+	})
+
+	t.Run("migrated", func(t *testing.T) {
+		coreClient := fake.NewSimpleClientset()
+		r := &Release{hrClient: ifclientsetfake.NewSimpleClientset(hr).HelmV1(), coreV1Client: coreClient.CoreV1(),
+			config: Config{OssDecryptionKey: key, MigrateOssCredentials: true}}
+		updated, err := r.migrateOssCredentials(log.NewNopLogger(), hr)
+		assert.NoError(t, err)
+		assert.Equal(t, &apiV1.LocalObjectReference{Name: "podinfo-oss-credentials"}, updated.Spec.Oss.SecretRef)
+		assert.False(t, updated.Spec.Oss.AckEncrypted)
+		assert.Empty(t, updated.Spec.Oss.AckId)
+		assert.Empty(t, updated.Spec.Oss.AckSecret)
+
+		secret, err := coreClient.CoreV1().Secrets("flux").Get("podinfo-oss-credentials", metav1.GetOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, "id", string(secret.Data["ackId"]))
+		assert.Equal(t, "secret", string(secret.Data["ackSecret"]))
+		assert.Equal(t, hr.UID, secret.OwnerReferences[0].UID)
+
+		// once migrated, the credentials are not migrated again
+		again, err := r.migrateOssCredentials(log.NewNopLogger(), updated)
+		assert.NoError(t, err)
+		assert.Equal(t, updated, again)
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		r := &Release{hrClient: ifclientsetfake.NewSimpleClientset(hr).HelmV1(), coreV1Client: fake.NewSimpleClientset().CoreV1(),
+			config: Config{OssDecryptionKey: []byte("fedcba9876543210"), MigrateOssCredentials: true}}
+		updated, err := r.migrateOssCredentials(log.NewNopLogger(), hr)
+		assert.Error(t, err)
+		assert.Equal(t, hr, updated)
+	})
+}
@@ -0,0 +1,89 @@
+package release
+
+import (
+	"bytes"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/lstack-org/helm-operator/pkg/registry"
+)
+
+// imagePinningPostRenderer pins the images of the (init) containers
+// in the rendered manifests to the digests their tags resolve to.
+// Credentials for private registries are read from the image pull
+// secrets of the pod specs.
+type imagePinningPostRenderer struct {
+	registry *registry.Client
+	secrets  corev1client.SecretInterface
+}
+
+func (p imagePinningPostRenderer) Run(renderedManifests *bytes.Buffer) (*bytes.Buffer, error) {
+	objs := releaseManifestToUnstructured(renderedManifests.String())
+	secrets := make(map[string]map[string]registry.Credentials)
+	for i := range objs {
+		obj := &objs[i]
+		if podSpecPath(obj.GetKind()) == nil {
+			continue
+		}
+		creds, err := p.pullCredentials(*obj, secrets)
+		if err != nil {
+			return nil, fmt.Errorf("image pinning: %w", err)
+		}
+		err = mapContainerImages(obj, func(image string) (string, error) {
+			if _, _, digest := registry.SplitImage(image); digest != "" {
+				return image, nil
+			}
+			digest, err := p.registry.Digest(image, creds)
+			if err != nil {
+				return "", fmt.Errorf("failed to resolve digest of image '%s': %w", image, err)
+			}
+			return image + "@" + digest, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("image pinning: %s: %w", objectDescription(*obj, ""), err)
+		}
+	}
+	return unstructuredToManifests(objs)
+}
+
+// pullCredentials returns the registry credentials from the image
+// pull secrets of the pod spec of the given object. Secrets are read
+// once per run; missing secrets are ignored, like the kubelet does.
+func (p imagePinningPostRenderer) pullCredentials(obj unstructured.Unstructured,
+	secrets map[string]map[string]registry.Credentials) (map[string]registry.Credentials, error) {
+	refs, _, _ := unstructured.NestedSlice(obj.Object, append(podSpecPath(obj.GetKind()), "imagePullSecrets")...)
+	creds := make(map[string]registry.Credentials)
+	for _, ref := range refs {
+		m, ok := ref.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := m["name"].(string)
+		if name == "" {
+			continue
+		}
+		if _, ok := secrets[name]; !ok {
+			secret, err := p.secrets.Get(name, metav1.GetOptions{})
+			switch {
+			case errors.IsNotFound(err):
+				secrets[name] = nil
+				continue
+			case err != nil:
+				return nil, fmt.Errorf("failed to get image pull secret '%s': %w", name, err)
+			}
+			if secrets[name], err = registry.CredentialsFromSecret(secret); err != nil {
+				return nil, fmt.Errorf("failed to read image pull secret '%s': %w", name, err)
+			}
+		}
+		for registry, c := range secrets[name] {
+			if _, ok := creds[registry]; !ok {
+				creds[registry] = c
+			}
+		}
+	}
+	return creds, nil
+}
@@ -0,0 +1,87 @@
+package release
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/lstack-org/helm-operator/pkg/registry"
+)
+
+func TestImagePinningPostRenderer(t *testing.T) {
+	const digest = "sha256:4c4f1f0bf4a7d4c1a7c2e3b2d9d6b8c7e6f5a4b3c2d1e0f9a8b7c6d5e4f3a2b1"
+	var manifestRequests int
+	var srv *httptest.Server
+	srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			user, pass, ok := r.BasicAuth()
+			if !ok || user != "user" || pass != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			assert.Equal(t, "repository:team/app:pull", r.URL.Query().Get("scope"))
+			fmt.Fprint(w, `{"token":"t0ken"}`)
+		case r.URL.Path == "/v2/team/app/manifests/v1":
+			manifestRequests++
+			if r.Header.Get("Authorization") != "Bearer t0ken" {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:team/app:pull"`, srv.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", digest)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "pull", Namespace: "ns"},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{
+			corev1.DockerConfigJsonKey: []byte(fmt.Sprintf(`{"auths":{"https://%s":{"auth":"dXNlcjpzZWNyZXQ="}}}`, host)),
+		},
+	})
+	p := imagePinningPostRenderer{registry: registry.NewClient(srv.Client()), secrets: client.CoreV1().Secrets("ns")}
+
+	manifest := fmt.Sprintf(`---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      imagePullSecrets:
+      - name: pull
+      - name: missing
+      containers:
+      - name: app
+        image: %[1]s/team/app:v1
+      - name: pinned
+        image: %[1]s/team/app@%[2]s
+`, host, digest)
+	for i := 0; i < 2; i++ {
+		out, err := p.Run(bytes.NewBufferString(manifest))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			fmt.Sprintf("%s/team/app:v1@%s", host, digest),
+			fmt.Sprintf("%s/team/app@%s", host, digest),
+		}, manifestImages(out.String()))
+	}
+	// the second run is served from the cache
+	assert.Equal(t, 2, manifestRequests)
+
+	_, err := p.Run(bytes.NewBufferString(strings.Replace(manifest, "app:v1", "app:v2", 1)))
+	assert.Error(t, err)
+}
@@ -0,0 +1,282 @@
+package release
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+// PlatformCheckPolicy determines what happens when a release contains
+// workloads requiring a node OS or architecture the cluster lacks.
+type PlatformCheckPolicy string
+
+const (
+	// PlatformCheckDisabled disables the platform check.
+	PlatformCheckDisabled PlatformCheckPolicy = ""
+	// PlatformCheckWarn logs a warning but continues the release.
+	PlatformCheckWarn PlatformCheckPolicy = "warn"
+	// PlatformCheckBlock fails the release before it is applied.
+	PlatformCheckBlock PlatformCheckPolicy = "block"
+)
+
+// platformLabels are the node labels describing the platform of a
+// node, with the legacy labels they replace.
+var platformLabels = map[string]string{
+	corev1.LabelOSStable:   "beta.kubernetes.io/os",
+	corev1.LabelArchStable: "beta.kubernetes.io/arch",
+}
+
+// UnsupportedPlatformError is returned when workloads in a release
+// require a node platform none of the schedulable nodes provide.
+type UnsupportedPlatformError struct {
+	Issues []string
+}
+
+func (err UnsupportedPlatformError) Error() string {
+	return fmt.Sprintf("release targets unavailable node platforms: %s", strings.Join(err.Issues, "; "))
+}
+
+// checkPlatform renders the release for the given HelmRelease using
+// a dry-run, and checks if the OS and architecture requirements of
+// its workloads can be satisfied by any of the schedulable nodes.
+func (r *Release) checkPlatform(client helm.Client, hr *apiV1.HelmRelease, curRel *helm.Release,
+	chart chart, values []byte) error {
+	dryRel, err := client.UpgradeFromPath(chart.chartPath, hr.GetReleaseName(), values, helm.UpgradeOptions{
+		DryRun:      true,
+		Install:     curRel == nil,
+		Namespace:   hr.GetTargetNamespace(),
+		Force:       hr.Spec.ForceUpgrade,
+		ReuseValues: hr.GetReuseValues(),
+		ResetValues: !hr.GetReuseValues(),
+	})
+	if err != nil {
+		return fmt.Errorf("dry-run for platform check failed: %w", err)
+	}
+	nodes, err := r.coreV1Client.Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes for platform check: %w", err)
+	}
+	var schedulable []corev1.Node
+	for _, n := range nodes.Items {
+		if !n.Spec.Unschedulable && nodeReady(n) {
+			schedulable = append(schedulable, n)
+		}
+	}
+	if issues := platformIssues(dryRel.Manifest, schedulable, hr.GetTargetNamespace()); len(issues) > 0 {
+		return UnsupportedPlatformError{Issues: issues}
+	}
+	return nil
+}
+
+// preflightPlatform runs the platform check if enabled. It returns an
+// error if the release should not continue.
+func (r *Release) preflightPlatform(logger log.Logger, client helm.Client, action action, hr *apiV1.HelmRelease,
+	curRel *helm.Release, chart chart, values []byte) error {
+	if r.config.PlatformCheck == PlatformCheckDisabled || remoteTarget(hr) {
+		return nil
+	}
+	err := r.checkPlatform(client, hr, curRel, chart, values)
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(UnsupportedPlatformError); ok && r.config.PlatformCheck == PlatformCheckBlock {
+		status.SetStatusPhase(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseFailed)
+		logger.Log("error", err, "action", action)
+		return fmt.Errorf("platform check failed: %w", err)
+	}
+	logger.Log("warning", err, "action", action)
+	return nil
+}
+
+// platformIssues returns a description of every workload in the given
+// manifest whose node OS and architecture requirements, expressed by
+// its node selector or required node affinity, are not met by any of
+// the given nodes, sorted.
+func platformIssues(manifest string, nodes []corev1.Node, namespace string) []string {
+	platforms := nodePlatforms(nodes)
+	var issues []string
+	for _, obj := range releaseManifestToUnstructured(manifest) {
+		path := podSpecPath(obj.GetKind())
+		if path == nil {
+			continue
+		}
+		m, found, err := unstructured.NestedMap(obj.Object, path...)
+		if err != nil || !found {
+			continue
+		}
+		var spec corev1.PodSpec
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m, &spec); err != nil {
+			continue
+		}
+		if !hasPlatformRequirements(spec) {
+			continue
+		}
+		var satisfied bool
+		for _, p := range platforms {
+			if platformMatches(spec, p) {
+				satisfied = true
+				break
+			}
+		}
+		if !satisfied {
+			issues = append(issues, fmt.Sprintf("%s requires %s, available: %s",
+				objectDescription(obj, namespace), describePlatformRequirements(spec), describePlatforms(platforms)))
+		}
+	}
+	sort.Strings(issues)
+	return issues
+}
+
+// nodePlatforms returns the distinct platform labels of the nodes.
+func nodePlatforms(nodes []corev1.Node) []map[string]string {
+	seen := make(map[string]bool)
+	var platforms []map[string]string
+	for _, n := range nodes {
+		p := map[string]string{
+			corev1.LabelOSStable:   n.Status.NodeInfo.OperatingSystem,
+			corev1.LabelArchStable: n.Status.NodeInfo.Architecture,
+		}
+		for label, legacy := range platformLabels {
+			if v, ok := n.Labels[label]; ok {
+				p[label] = v
+			} else if v, ok := n.Labels[legacy]; ok {
+				p[label] = v
+			}
+		}
+		key := p[corev1.LabelOSStable] + "/" + p[corev1.LabelArchStable]
+		if !seen[key] {
+			seen[key] = true
+			platforms = append(platforms, p)
+		}
+	}
+	return platforms
+}
+
+// platformKey returns the stable platform label for the given label,
+// or an empty string if it is not a platform label.
+func platformKey(label string) string {
+	for stable, legacy := range platformLabels {
+		if label == stable || label == legacy {
+			return stable
+		}
+	}
+	return ""
+}
+
+func hasPlatformRequirements(spec corev1.PodSpec) bool {
+	for k := range spec.NodeSelector {
+		if platformKey(k) != "" {
+			return true
+		}
+	}
+	for _, term := range requiredNodeSelectorTerms(spec) {
+		for _, expr := range term.MatchExpressions {
+			if platformKey(expr.Key) != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func requiredNodeSelectorTerms(spec corev1.PodSpec) []corev1.NodeSelectorTerm {
+	if spec.Affinity == nil || spec.Affinity.NodeAffinity == nil ||
+		spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return nil
+	}
+	return spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+}
+
+// platformMatches returns if the platform requirements of the pod
+// spec are met by the given platform. Requirements on other labels
+// are ignored.
+func platformMatches(spec corev1.PodSpec, platform map[string]string) bool {
+	for k, v := range spec.NodeSelector {
+		if key := platformKey(k); key != "" && platform[key] != v {
+			return false
+		}
+	}
+	terms := requiredNodeSelectorTerms(spec)
+	if len(terms) == 0 {
+		return true
+	}
+	// node selector terms are ORed, their expressions ANDed
+	for _, term := range terms {
+		matches := true
+		for _, expr := range term.MatchExpressions {
+			key := platformKey(expr.Key)
+			if key == "" {
+				continue
+			}
+			if !platformExpressionMatches(expr, platform[key]) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+func platformExpressionMatches(expr corev1.NodeSelectorRequirement, value string) bool {
+	var in bool
+	for _, v := range expr.Values {
+		if v == value {
+			in = true
+			break
+		}
+	}
+	switch expr.Operator {
+	case corev1.NodeSelectorOpIn:
+		return in
+	case corev1.NodeSelectorOpNotIn:
+		return !in
+	case corev1.NodeSelectorOpExists:
+		return value != ""
+	case corev1.NodeSelectorOpDoesNotExist:
+		return value == ""
+	}
+	return true
+}
+
+func describePlatformRequirements(spec corev1.PodSpec) string {
+	var reqs []string
+	for k, v := range spec.NodeSelector {
+		if platformKey(k) != "" {
+			reqs = append(reqs, fmt.Sprintf("%s=%s", k, v))
+		}
+	}
+	for _, term := range requiredNodeSelectorTerms(spec) {
+		for _, expr := range term.MatchExpressions {
+			if platformKey(expr.Key) != "" {
+				reqs = append(reqs, fmt.Sprintf("%s %s (%s)", expr.Key, expr.Operator, strings.Join(expr.Values, ",")))
+			}
+		}
+	}
+	sort.Strings(reqs)
+	return strings.Join(reqs, ", ")
+}
+
+func describePlatforms(platforms []map[string]string) string {
+	if len(platforms) == 0 {
+		return "no schedulable nodes"
+	}
+	var s []string
+	for _, p := range platforms {
+		s = append(s, p[corev1.LabelOSStable]+"/"+p[corev1.LabelArchStable])
+	}
+	sort.Strings(s)
+	return strings.Join(s, ", ")
+}
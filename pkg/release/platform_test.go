@@ -0,0 +1,79 @@
+package release
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPlatformIssues(t *testing.T) {
+	manifest := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: amd64-only
+spec:
+  template:
+    spec:
+      nodeSelector:
+        kubernetes.io/arch: amd64
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: multi-arch
+spec:
+  template:
+    spec:
+      affinity:
+        nodeAffinity:
+          requiredDuringSchedulingIgnoredDuringExecution:
+            nodeSelectorTerms:
+            - matchExpressions:
+              - key: kubernetes.io/arch
+                operator: In
+                values: [amd64, arm64]
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: windows
+spec:
+  template:
+    spec:
+      nodeSelector:
+        beta.kubernetes.io/os: windows
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: unconstrained
+spec:
+  template:
+    spec:
+      nodeSelector:
+        disktype: ssd
+`
+	nodes := []corev1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"kubernetes.io/arch": "arm64", "kubernetes.io/os": "linux"}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"beta.kubernetes.io/arch": "arm64"}},
+			Status:     corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{OperatingSystem: "linux"}},
+		},
+	}
+	assert.Equal(t, []string{
+		"Deployment default/amd64-only requires kubernetes.io/arch=amd64, available: linux/arm64",
+		"Deployment default/windows requires beta.kubernetes.io/os=windows, available: linux/arm64",
+	}, platformIssues(manifest, nodes, "default"))
+
+	nodes = append(nodes, corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"kubernetes.io/arch": "s390x", "kubernetes.io/os": "windows"}},
+	})
+	assert.Equal(t, []string{
+		"Deployment default/amd64-only requires kubernetes.io/arch=amd64, available: linux/arm64, windows/s390x",
+	}, platformIssues(manifest, nodes, "default"))
+}
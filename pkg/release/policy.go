@@ -0,0 +1,278 @@
+package release
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+	"github.com/lstack-org/helm-operator/pkg/registry"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+// maxPolicyViolations is the maximum amount of policy violations
+// recorded in the status of a HelmRelease.
+const maxPolicyViolations = 20
+
+// The built-in policy rules, as named in violations.
+const (
+	policyDisallowLatestTag     = "disallowLatestTag"
+	policyRequireResourceLimits = "requireResourceLimits"
+	policyForbiddenKinds        = "forbiddenKinds"
+)
+
+// PolicyViolationError is returned if the rendered manifests of a
+// release violate the policies checked for it.
+type PolicyViolationError struct {
+	Violations []apiV1.PolicyViolation
+}
+
+func (err PolicyViolationError) Error() string {
+	v := err.Violations[0]
+	if v.Object != "" {
+		return fmt.Sprintf("manifests violate %d policy check(s), first: [%s] %s: %s", len(err.Violations), v.Policy, v.Object, v.Message)
+	}
+	return fmt.Sprintf("manifests violate %d policy check(s), first: [%s] %s", len(err.Violations), v.Policy, v.Message)
+}
+
+// policyViolationsMessage returns the condition message listing the
+// policy violations blocking the release of the given HelmRelease.
+func policyViolationsMessage(hr *apiV1.HelmRelease, violations []apiV1.PolicyViolation) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `Installation or upgrade blocked by %d policy violation(s) for Helm release '%s' in '%s':`,
+		len(violations), hr.GetReleaseName(), hr.GetTargetNamespace())
+	for i, v := range violations {
+		if i == maxPolicyViolations {
+			fmt.Fprintf(&b, "\n(%d more)", len(violations)-i)
+			break
+		}
+		if v.Object != "" {
+			fmt.Fprintf(&b, "\n- [%s] %s: %s", v.Policy, v.Object, v.Message)
+		} else {
+			fmt.Fprintf(&b, "\n- [%s] %s", v.Policy, v.Message)
+		}
+	}
+	return b.String()
+}
+
+// isPolicyViolation returns if the given error of an installation or
+// upgrade was caused by policy violations.
+func isPolicyViolation(err error) bool {
+	var violationErr PolicyViolationError
+	return errors.As(err, &violationErr)
+}
+
+// policiesChecked returns if the rendered manifests of the given
+// HelmRelease are checked against any policy.
+func (r *Release) policiesChecked(hr *apiV1.HelmRelease) bool {
+	if len(r.config.PolicyDecisions) > 0 {
+		return true
+	}
+	c := hr.Spec.PolicyChecks
+	return c != nil && (c.DisallowLatestTag || c.RequireResourceLimits || len(c.ForbiddenKinds) > 0 || len(c.OPADecisions) > 0)
+}
+
+// policyPostRenderer checks the rendered manifests of a release
+// against its policies, and records the violations in the status of
+// the HelmRelease unless it renders a preview. It fails with a
+// PolicyViolationError if there are any, blocking the release; the
+// manifests are never modified.
+type policyPostRenderer struct {
+	release *Release
+	hr      *apiV1.HelmRelease
+	preview bool
+}
+
+func (p policyPostRenderer) Run(renderedManifests *bytes.Buffer) (*bytes.Buffer, error) {
+	objs := releaseManifestToUnstructured(renderedManifests.String())
+	violations, err := p.release.checkPolicies(p.hr, objs)
+	if err != nil {
+		return nil, fmt.Errorf("policy check failed: %w", err)
+	}
+	if !p.preview {
+		p.release.recordPolicyViolations(p.hr, violations)
+	}
+	if len(violations) > 0 {
+		return nil, PolicyViolationError{Violations: violations}
+	}
+	return renderedManifests, nil
+}
+
+// recordPolicyViolations records the given violations, up to the
+// maximum, in the status of the given HelmRelease.
+func (r *Release) recordPolicyViolations(hr *apiV1.HelmRelease, violations []apiV1.PolicyViolation) {
+	if len(violations) > maxPolicyViolations {
+		violations = violations[:maxPolicyViolations]
+	}
+	status.SetPolicyViolations(r.hrClient.HelmReleases(hr.Namespace), hr, violations)
+}
+
+// checkUnrenderedPolicies checks the hooks of the release and the CRDs
+// of the chart of an installation or upgrade with the given options
+// against the policies of the given HelmRelease. Helm applies these
+// without passing them to the post-renderer, they are therefore taken
+// from a dry-run of the installation or upgrade beforehand. The
+// violations are recorded like those of the rendered manifests, and
+// it returns a PolicyViolationError if there are any.
+func (r *Release) checkUnrenderedPolicies(client helm.Client, hr *apiV1.HelmRelease, chart chart, values []byte, opts helm.UpgradeOptions) error {
+	if !r.policiesChecked(hr) || (opts.DisableHooks && (!opts.Install || opts.SkipCRDs)) {
+		return nil
+	}
+	dryRel, err := client.UpgradeFromPath(chart.chartPath, hr.GetReleaseName(), values, helm.UpgradeOptions{
+		DryRun:            true,
+		Namespace:         opts.Namespace,
+		Install:           opts.Install,
+		Force:             opts.Force,
+		ReuseValues:       opts.ReuseValues,
+		ResetValues:       opts.ResetValues,
+		SkipCRDs:          opts.SkipCRDs,
+		DisableHooks:      opts.DisableHooks,
+		DisableValidation: opts.DisableValidation,
+		ChartAnnotations:  opts.ChartAnnotations,
+	})
+	if err != nil {
+		return fmt.Errorf("dry-run for policy check failed: %w", err)
+	}
+	objs := unrenderedObjects(dryRel, opts)
+	if len(objs) == 0 {
+		return nil
+	}
+	violations, err := r.checkPolicies(hr, objs)
+	if err != nil {
+		return fmt.Errorf("policy check failed: %w", err)
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	r.recordPolicyViolations(hr, violations)
+	return PolicyViolationError{Violations: violations}
+}
+
+// unrenderedObjects returns the objects of the hooks of the given
+// release, unless disabled in the given options, and those of the
+// CRDs of its chart, which Helm only applies on an installation.
+func unrenderedObjects(rel *helm.Release, opts helm.UpgradeOptions) []unstructured.Unstructured {
+	var objs []unstructured.Unstructured
+	if !opts.DisableHooks {
+		for _, hook := range rel.Hooks {
+			objs = append(objs, releaseManifestToUnstructured(string(hook.Data))...)
+		}
+	}
+	if opts.Install && !opts.SkipCRDs && rel.Chart != nil {
+		for _, crd := range rel.Chart.CRDs {
+			objs = append(objs, releaseManifestToUnstructured(string(crd.Data))...)
+		}
+	}
+	return objs
+}
+
+// checkPolicies returns the violations of the built-in rules enabled
+// for the given HelmRelease by the objects, followed by those of the
+// OPA decisions configured in the operator and the HelmRelease. The
+// objects are sorted, for the violations to be in a stable order.
+func (r *Release) checkPolicies(hr *apiV1.HelmRelease, objs []unstructured.Unstructured) ([]apiV1.PolicyViolation, error) {
+	ns := hr.GetTargetNamespace()
+	sort.SliceStable(objs, func(i, j int) bool {
+		return objectDescription(objs[i], ns) < objectDescription(objs[j], ns)
+	})
+	var violations []apiV1.PolicyViolation
+	var decisions []string
+	decisions = append(decisions, r.config.PolicyDecisions...)
+	if c := hr.Spec.PolicyChecks; c != nil {
+		for _, obj := range objs {
+			violations = append(violations, builtinPolicyViolations(*c, obj, ns)...)
+		}
+		decisions = append(decisions, c.OPADecisions...)
+	}
+	if len(decisions) == 0 {
+		return violations, nil
+	}
+
+	if r.config.OPA == nil {
+		return nil, fmt.Errorf("OPA decisions %s are checked, but no OPA server is configured", strings.Join(decisions, ", "))
+	}
+	manifests := make([]interface{}, 0, len(objs))
+	for _, obj := range objs {
+		manifests = append(manifests, obj.Object)
+	}
+	input := map[string]interface{}{
+		"release": map[string]interface{}{
+			"name":      hr.GetReleaseName(),
+			"namespace": ns,
+		},
+		"helmRelease": map[string]interface{}{
+			"name":      hr.Name,
+			"namespace": hr.Namespace,
+		},
+		"manifests": manifests,
+	}
+	for _, decision := range decisions {
+		messages, err := r.config.OPA.Evaluate(decision, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate OPA decision %s: %w", decision, err)
+		}
+		for _, m := range messages {
+			violations = append(violations, apiV1.PolicyViolation{Policy: decision, Message: m})
+		}
+	}
+	return violations, nil
+}
+
+// builtinPolicyViolations returns the violations of the built-in rules
+// enabled in the policy checks by the given object.
+func builtinPolicyViolations(c apiV1.PolicyChecks, obj unstructured.Unstructured, namespace string) []apiV1.PolicyViolation {
+	var violations []apiV1.PolicyViolation
+	object := objectDescription(obj, namespace)
+	for _, kind := range c.ForbiddenKinds {
+		if obj.GetKind() == kind {
+			violations = append(violations, apiV1.PolicyViolation{Policy: policyForbiddenKinds, Object: object,
+				Message: fmt.Sprintf("resources of kind %s are forbidden", kind)})
+		}
+	}
+	for _, container := range podContainers(obj) {
+		name, _ := container["name"].(string)
+		if image, ok := container["image"].(string); ok && c.DisallowLatestTag && !strings.Contains(image, "@") {
+			if _, tag, _ := registry.SplitImage(image); tag == "" || tag == "latest" {
+				violations = append(violations, apiV1.PolicyViolation{Policy: policyDisallowLatestTag, Object: object,
+					Message: fmt.Sprintf("container '%s' uses image '%s' without a fixed tag", name, image)})
+			}
+		}
+		if c.RequireResourceLimits {
+			var missing []string
+			for _, resource := range []string{"cpu", "memory"} {
+				if _, found, _ := unstructured.NestedFieldNoCopy(container, "resources", "limits", resource); !found {
+					missing = append(missing, resource)
+				}
+			}
+			if len(missing) > 0 {
+				violations = append(violations, apiV1.PolicyViolation{Policy: policyRequireResourceLimits, Object: object,
+					Message: fmt.Sprintf("container '%s' has no %s limit", name, strings.Join(missing, " and "))})
+			}
+		}
+	}
+	return violations
+}
+
+// podContainers returns the (init) containers in the pod spec of the
+// given object.
+func podContainers(obj unstructured.Unstructured) []map[string]interface{} {
+	path := podSpecPath(obj.GetKind())
+	if path == nil {
+		return nil
+	}
+	var out []map[string]interface{}
+	for _, field := range []string{"initContainers", "containers"} {
+		containers, _, _ := unstructured.NestedSlice(obj.Object, append(append([]string{}, path...), field)...)
+		for _, c := range containers {
+			if container, ok := c.(map[string]interface{}); ok {
+				out = append(out, container)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,177 @@
+package release
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+	"github.com/lstack-org/helm-operator/pkg/opa"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+const policyManifest = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: migrate
+        image: registry.example.com/migrate@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef
+      containers:
+      - name: web
+        image: nginx
+        resources:
+          limits:
+            memory: 128Mi
+      - name: sidecar
+        image: envoy:v1.16.0
+        resources:
+          limits:
+            cpu: 100m
+            memory: 64Mi
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: web
+`
+
+func TestCheckPolicies(t *testing.T) {
+	hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	hr.Spec.PolicyChecks = &apiV1.PolicyChecks{DisallowLatestTag: true, RequireResourceLimits: true, ForbiddenKinds: []string{"ClusterRole"}}
+	r := &Release{}
+
+	objs := releaseManifestToUnstructured(policyManifest)
+	violations, err := r.checkPolicies(hr, objs)
+	assert.NoError(t, err)
+	assert.Equal(t, []apiV1.PolicyViolation{
+		{Policy: policyForbiddenKinds, Object: "ClusterRole default/web", Message: "resources of kind ClusterRole are forbidden"},
+		{Policy: policyRequireResourceLimits, Object: "Deployment default/web", Message: "container 'migrate' has no cpu and memory limit"},
+		{Policy: policyDisallowLatestTag, Object: "Deployment default/web", Message: "container 'web' uses image 'nginx' without a fixed tag"},
+		{Policy: policyRequireResourceLimits, Object: "Deployment default/web", Message: "container 'web' has no cpu limit"},
+	}, violations)
+
+	assert.Empty(t, builtinPolicyViolations(apiV1.PolicyChecks{}, objs[1], "default"))
+}
+
+func TestPolicyPostRenderer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/data/helm/deny":
+			w.Write([]byte(`{"result":["no ClusterRoles"]}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+	opaClient, err := opa.New(server.URL, 0)
+	assert.NoError(t, err)
+
+	hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	client := ifclientsetfake.NewSimpleClientset(hr)
+	r := &Release{hrClient: client.HelmV1(), config: Config{OPA: opaClient, PolicyDecisions: []string{"helm/allow"}}}
+
+	// manifests meeting the policies are released unmodified
+	assert.True(t, r.policiesChecked(hr))
+	out, err := policyPostRenderer{release: r, hr: hr}.Run(bytes.NewBufferString(policyManifest))
+	assert.NoError(t, err)
+	assert.Equal(t, policyManifest, out.String())
+
+	hr.Spec.PolicyChecks = &apiV1.PolicyChecks{ForbiddenKinds: []string{"ClusterRole"}, OPADecisions: []string{"helm/deny"}}
+	// the violations of a preview are not recorded
+	_, err = policyPostRenderer{release: r, hr: hr, preview: true}.Run(bytes.NewBufferString(policyManifest))
+	assert.True(t, isPolicyViolation(err))
+	updated, getErr := client.HelmV1().HelmReleases(hr.Namespace).Get(hr.Name, metav1.GetOptions{})
+	assert.NoError(t, getErr)
+	assert.Empty(t, updated.Status.PolicyViolations)
+
+	_, err = policyPostRenderer{release: r, hr: hr}.Run(bytes.NewBufferString(policyManifest))
+	want := []apiV1.PolicyViolation{
+		{Policy: policyForbiddenKinds, Object: "ClusterRole default/web", Message: "resources of kind ClusterRole are forbidden"},
+		{Policy: "helm/deny", Message: "no ClusterRoles"},
+	}
+	// Helm wraps the errors of post-renderers
+	err = errors.Wrap(err, "error while running post render on files")
+	assert.True(t, isPolicyViolation(err))
+
+	updated, getErr = client.HelmV1().HelmReleases(hr.Namespace).Get(hr.Name, metav1.GetOptions{})
+	assert.NoError(t, getErr)
+	assert.Equal(t, want, updated.Status.PolicyViolations)
+
+	r.setDeployFailed(updated, apiV1.ReasonPolicyViolation, err)
+	updated, getErr = client.HelmV1().HelmReleases(hr.Namespace).Get(hr.Name, metav1.GetOptions{})
+	assert.NoError(t, getErr)
+	condition := status.GetCondition(updated.Status, apiV1.HelmReleaseReleased)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, apiV1.ReasonPolicyViolation, condition.Reason)
+		assert.Equal(t, "Installation or upgrade blocked by 2 policy violation(s) for Helm release 'default-web' in 'default':\n"+
+			"- [forbiddenKinds] ClusterRole default/web: resources of kind ClusterRole are forbidden\n"+
+			"- [helm/deny] no ClusterRoles", condition.Message)
+	}
+
+	// OPA decisions can not be checked without an OPA server
+	r.config.OPA = nil
+	_, err = r.checkPolicies(hr, releaseManifestToUnstructured(policyManifest))
+	assert.Error(t, err)
+}
+
+// dryRunHelmClient returns the given release for a dry-run upgrade,
+// recording its options.
+type dryRunHelmClient struct {
+	helm.Client
+	rel  *helm.Release
+	opts helm.UpgradeOptions
+}
+
+func (c *dryRunHelmClient) UpgradeFromPath(chartPath string, releaseName string, values []byte, opts helm.UpgradeOptions) (*helm.Release, error) {
+	c.opts = opts
+	return c.rel, nil
+}
+
+func TestCheckUnrenderedPolicies(t *testing.T) {
+	hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	hr.Spec.PolicyChecks = &apiV1.PolicyChecks{ForbiddenKinds: []string{"ClusterRole", "CustomResourceDefinition"}}
+	client := ifclientsetfake.NewSimpleClientset(hr)
+	r := &Release{hrClient: client.HelmV1()}
+	helmClient := &dryRunHelmClient{rel: &helm.Release{
+		Hooks: []*helm.File{{Name: "web/templates/hook.yaml", Data: []byte(policyManifest)}},
+		Chart: &helm.Chart{CRDs: []*helm.File{{Name: "crds/crd.yaml", Data: []byte(`apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: webs.example.com
+`)}}},
+	}}
+
+	// hooks and CRDs are checked on an installation
+	err := r.checkUnrenderedPolicies(helmClient, hr, chart{}, nil, helm.UpgradeOptions{Install: true, Namespace: "default"})
+	assert.True(t, isPolicyViolation(err))
+	assert.True(t, helmClient.opts.DryRun)
+	assert.Nil(t, helmClient.opts.PostRenderer)
+	want := []apiV1.PolicyViolation{
+		{Policy: policyForbiddenKinds, Object: "ClusterRole default/web", Message: "resources of kind ClusterRole are forbidden"},
+		{Policy: policyForbiddenKinds, Object: "CustomResourceDefinition default/webs.example.com", Message: "resources of kind CustomResourceDefinition are forbidden"},
+	}
+	updated, getErr := client.HelmV1().HelmReleases(hr.Namespace).Get(hr.Name, metav1.GetOptions{})
+	assert.NoError(t, getErr)
+	assert.Equal(t, want, updated.Status.PolicyViolations)
+
+	// CRDs are only applied on an installation
+	err = r.checkUnrenderedPolicies(helmClient, hr, chart{}, nil, helm.UpgradeOptions{Namespace: "default"})
+	assert.Equal(t, PolicyViolationError{Violations: want[:1]}, err)
+
+	// disabled hooks and skipped CRDs are not checked
+	helmClient.opts = helm.UpgradeOptions{}
+	assert.NoError(t, r.checkUnrenderedPolicies(helmClient, hr, chart{}, nil, helm.UpgradeOptions{Install: true, SkipCRDs: true, DisableHooks: true}))
+	assert.False(t, helmClient.opts.DryRun)
+}
@@ -0,0 +1,295 @@
+package release
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"helm.sh/helm/v3/pkg/postrender"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+	"github.com/lstack-org/helm-operator/pkg/registry"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+// PostRenderFailurePolicy determines what happens when the built-in
+// post-renderer fails to mutate the rendered manifests.
+type PostRenderFailurePolicy string
+
+const (
+	// PostRenderFailureFallback applies the manifests without the
+	// failed mutations.
+	PostRenderFailureFallback PostRenderFailurePolicy = "fallback"
+	// PostRenderFailureFail fails the release.
+	PostRenderFailureFail PostRenderFailurePolicy = "fail"
+)
+
+// postRenderStage is the stage of the built-in post-renderer a
+// failure occurred in.
+type postRenderStage string
+
+const (
+	postRenderIstioStage postRenderStage = "istio"
+)
+
+// postRenderFailure records a failure of the built-in post-renderer
+// in the given stage, and returns an error if the release must fail;
+// either because of the failure policy, or because the failure means
+// the mandatory Istio injection labels are missing from the manifests.
+func (r *Release) postRenderFailure(hr *apiV1.HelmRelease, stage postRenderStage, err error) error {
+	ObservePostRenderFailure(stage, hr.GetTargetNamespace(), hr.GetReleaseName())
+	status.SetPostRenderFailed(r.hrClient.HelmReleases(hr.Namespace), hr,
+		fmt.Sprintf("post-render %s stage failed: %s", stage, err.Error()))
+	if r.config.PostRenderFailure == PostRenderFailureFail || hr.Spec.IstioEnabled {
+		return fmt.Errorf("post-render %s stage failed: %w", stage, err)
+	}
+	return nil
+}
+
+// postRendererChain is a post-renderer which runs its post-renderers
+// in order, feeding the output of one into the next.
+type postRendererChain []postrender.PostRenderer
+
+func (c postRendererChain) Run(renderedManifests *bytes.Buffer) (*bytes.Buffer, error) {
+	modifiedManifests := renderedManifests
+	for _, p := range c {
+		var err error
+		if modifiedManifests, err = p.Run(modifiedManifests); err != nil {
+			return nil, err
+		}
+	}
+	return modifiedManifests, nil
+}
+
+// getPostRenderer returns the post-renderer for the given HelmRelease
+// and current release, which is nil for installs, rendering a preview
+// if preview is set. The built-in app
+// manager post-renderer runs first unless its injection is disabled,
+// followed by the kustomize patches, the post-render steps declared
+// in the spec and the substitution of the post-build variables. Images
+// are pinned after these, so that overridden images are pinned, and
+// the final manifests are checked against the policies last.
+func (r *Release) getPostRenderer(hr *apiV1.HelmRelease, curRel *helm.Release, preview bool) postrender.PostRenderer {
+	var chain postRendererChain
+	switch hr.Spec.Injection.GetMode() {
+	case apiV1.InjectionAlways:
+		chain = append(chain, r.getAppManagerPostRenderer(hr, nil))
+	case apiV1.InjectionOnInstall:
+		chain = append(chain, r.getAppManagerPostRenderer(hr, installedObjects(curRel)))
+	}
+	if hr.Spec.Kustomize != nil {
+		chain = append(chain, kustomizePostRenderer{kustomize: *hr.Spec.Kustomize, namespace: hr.GetTargetNamespace()})
+	}
+	for i, step := range hr.Spec.PostRenderers {
+		chain = append(chain, specPostRenderer{index: i, step: step, namespace: hr.GetTargetNamespace()})
+	}
+	if hr.Spec.PostBuild.Substitutes(apiV1.SubstituteManifests) {
+		chain = append(chain, substitutePostRenderer{coreV1Client: r.coreV1Client, hr: hr})
+	}
+	if hr.Spec.ImagePinning == apiV1.ImagePinningDigest && !remoteTarget(hr) {
+		chain = append(chain, imagePinningPostRenderer{registry: r.registry, secrets: r.coreV1Client.Secrets(hr.GetTargetNamespace())})
+	}
+	// the check also runs to clear the violations of an earlier
+	// attempt once the policies are no longer checked
+	if r.policiesChecked(hr) || len(hr.Status.PolicyViolations) > 0 {
+		chain = append(chain, policyPostRenderer{release: r, hr: hr, preview: preview})
+	}
+	return chain
+}
+
+// specPostRenderer applies a post-render step declared in the spec
+// of a HelmRelease.
+type specPostRenderer struct {
+	index     int
+	step      apiV1.PostRenderer
+	namespace string
+}
+
+func (p specPostRenderer) Run(renderedManifests *bytes.Buffer) (*bytes.Buffer, error) {
+	objs := releaseManifestToUnstructured(renderedManifests.String())
+	for i := range objs {
+		obj := &objs[i]
+		if len(p.step.Labels) > 0 {
+			obj.SetLabels(mergeStringMaps(obj.GetLabels(), p.step.Labels))
+		}
+		if len(p.step.Annotations) > 0 {
+			obj.SetAnnotations(mergeStringMaps(obj.GetAnnotations(), p.step.Annotations))
+		}
+		if len(p.step.Images) > 0 {
+			if err := overrideImages(obj, p.step.Images); err != nil {
+				return nil, fmt.Errorf("post-renderer %d: failed to override images of %s: %w",
+					p.index, objectDescription(*obj, p.namespace), err)
+			}
+		}
+		for _, patch := range p.step.Patches {
+			if !patchTargetMatches(patch.Target, *obj, p.namespace) {
+				continue
+			}
+			if err := applyJSON6902Patch(obj, patch.Patch); err != nil {
+				return nil, fmt.Errorf("post-renderer %d: failed to patch %s: %w",
+					p.index, objectDescription(*obj, p.namespace), err)
+			}
+		}
+	}
+	return unstructuredToManifests(objs)
+}
+
+// mergeStringMaps returns a copy of dst with the keys and values of
+// src set on it.
+func mergeStringMaps(dst, src map[string]string) map[string]string {
+	out := make(map[string]string, len(dst)+len(src))
+	for k, v := range dst {
+		out[k] = v
+	}
+	for k, v := range src {
+		out[k] = v
+	}
+	return out
+}
+
+// podSpecPath returns the path to the pod spec of the given object
+// kind, or nil if the kind does not embed a pod spec.
+func podSpecPath(kind string) []string {
+	switch kind {
+	case "Pod":
+		return []string{"spec"}
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "ReplicationController", "Job":
+		return []string{"spec", "template", "spec"}
+	case "CronJob":
+		return []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	}
+	return nil
+}
+
+// overrideImages applies the image overrides to the (init) containers
+// in the pod spec of the given object.
+func overrideImages(obj *unstructured.Unstructured, overrides []apiV1.ImageOverride) error {
+	return mapContainerImages(obj, func(image string) (string, error) {
+		return overrideImage(image, overrides), nil
+	})
+}
+
+// mapContainerImages replaces the images of the (init) containers in
+// the pod spec of the given object with the result of the function.
+func mapContainerImages(obj *unstructured.Unstructured, f func(image string) (string, error)) error {
+	path := podSpecPath(obj.GetKind())
+	if path == nil {
+		return nil
+	}
+	for _, field := range []string{"initContainers", "containers"} {
+		containerPath := append(append([]string{}, path...), field)
+		containers, found, err := unstructured.NestedSlice(obj.Object, containerPath...)
+		if err != nil {
+			return err
+		}
+		if !found {
+			continue
+		}
+		for _, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			image, ok := container["image"].(string)
+			if !ok {
+				continue
+			}
+			if container["image"], err = f(image); err != nil {
+				return err
+			}
+		}
+		if err := unstructured.SetNestedSlice(obj.Object, containers, containerPath...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// overrideImage returns the image with the first matching override
+// applied to it.
+func overrideImage(image string, overrides []apiV1.ImageOverride) string {
+	name, tag, digest := registry.SplitImage(image)
+	for _, o := range overrides {
+		if o.Name != name {
+			continue
+		}
+		if o.NewName != "" {
+			name = o.NewName
+		}
+		switch {
+		case o.Digest != "":
+			return name + "@" + o.Digest
+		case o.NewTag != "":
+			return name + ":" + o.NewTag
+		case digest != "":
+			return name + "@" + digest
+		case tag != "":
+			return name + ":" + tag
+		}
+		return name
+	}
+	return image
+}
+
+// patchTargetMatches returns if the given object is selected by the
+// patch target. The namespace is used for objects which do not have
+// a namespace set in the manifest.
+func patchTargetMatches(target apiV1.PatchTarget, obj unstructured.Unstructured, namespace string) bool {
+	gvk := obj.GroupVersionKind()
+	objNamespace := obj.GetNamespace()
+	if objNamespace == "" {
+		objNamespace = namespace
+	}
+	return (target.Group == "" || target.Group == gvk.Group) &&
+		(target.Version == "" || target.Version == gvk.Version) &&
+		(target.Kind == "" || target.Kind == gvk.Kind) &&
+		(target.Name == "" || target.Name == obj.GetName()) &&
+		(target.Namespace == "" || target.Namespace == objNamespace)
+}
+
+// applyJSON6902Patch applies the given JSON 6902 patch, in JSON or
+// YAML, to the object.
+func applyJSON6902Patch(obj *unstructured.Unstructured, patch string) error {
+	patchJSON, err := yaml.YAMLToJSON([]byte(patch))
+	if err != nil {
+		return fmt.Errorf("failed to parse patch: %w", err)
+	}
+	p, err := jsonpatch.DecodePatch(patchJSON)
+	if err != nil {
+		return fmt.Errorf("failed to decode patch: %w", err)
+	}
+	objJSON, err := obj.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	patched, err := p.Apply(objJSON)
+	if err != nil {
+		return err
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(patched, &out); err != nil {
+		return err
+	}
+	obj.Object = out
+	return nil
+}
+
+// unstructuredToManifests marshals the given objects into a multi
+// document YAML manifest.
+func unstructuredToManifests(objs []unstructured.Unstructured) (*bytes.Buffer, error) {
+	out := bytes.NewBuffer([]byte{})
+	for _, obj := range objs {
+		b, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+		out.WriteString("---\n")
+		out.Write(b)
+		out.WriteString("\n")
+	}
+	return out, nil
+}
@@ -0,0 +1,155 @@
+package release
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+func TestOverrideImage(t *testing.T) {
+	overrides := []apiV1.ImageOverride{
+		{Name: "nginx", NewTag: "1.19"},
+		{Name: "registry:5000/app", NewName: "mirror.example.com/app"},
+		{Name: "redis", Digest: "sha256:abc"},
+	}
+	for image, expected := range map[string]string{
+		"nginx":                        "nginx:1.19",
+		"nginx:1.17":                   "nginx:1.19",
+		"registry:5000/app:v1":         "mirror.example.com/app:v1",
+		"registry:5000/app@sha256:def": "mirror.example.com/app@sha256:def",
+		"redis:6":                      "redis@sha256:abc",
+		"memcached:1":                  "memcached:1",
+	} {
+		assert.Equal(t, expected, overrideImage(image, overrides), image)
+	}
+}
+
+func TestSpecPostRenderer(t *testing.T) {
+	manifest := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    app: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        image: nginx:1.17
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  type: ClusterIP
+`
+	p := specPostRenderer{
+		namespace: "default",
+		step: apiV1.PostRenderer{
+			Labels: map[string]string{"team": "a"},
+			Images: []apiV1.ImageOverride{{Name: "nginx", NewTag: "1.19"}},
+			Patches: []apiV1.JSON6902Patch{{
+				Target: apiV1.PatchTarget{Kind: "Service", Name: "web"},
+				Patch:  "- op: replace\n  path: /spec/type\n  value: NodePort\n",
+			}},
+		},
+	}
+	out, err := p.Run(bytes.NewBufferString(manifest))
+	assert.NoError(t, err)
+
+	objs := releaseManifestToUnstructured(out.String())
+	assert.Len(t, objs, 2)
+	for _, obj := range objs {
+		assert.Equal(t, "a", obj.GetLabels()["team"])
+		switch obj.GetKind() {
+		case "Deployment":
+			assert.Equal(t, "web", obj.GetLabels()["app"])
+			containers := obj.Object["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})
+			assert.Equal(t, "nginx:1.19", containers[0].(map[string]interface{})["image"])
+		case "Service":
+			assert.Equal(t, "NodePort", obj.Object["spec"].(map[string]interface{})["type"])
+		}
+	}
+}
+
+func TestManifestImages(t *testing.T) {
+	manifest := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: busybox:1.32
+      containers:
+      - name: app
+        image: nginx:1.19
+      - name: sidecar
+        image: busybox:1.32
+---
+apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: job
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: job
+            image: alpine:3.12
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+`
+	assert.Equal(t, []string{"alpine:3.12", "busybox:1.32", "nginx:1.19"}, manifestImages(manifest))
+	assert.Nil(t, manifestImages(""))
+}
+
+func TestPostRenderFailure(t *testing.T) {
+	hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+	for _, tc := range []struct {
+		name    string
+		policy  PostRenderFailurePolicy
+		istio   bool
+		wantErr bool
+	}{
+		{"fallback", PostRenderFailureFallback, false, false},
+		{"fail", PostRenderFailureFail, false, true},
+		{"fallback with mandatory injection", PostRenderFailureFallback, true, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hr := hr.DeepCopy()
+			hr.Spec.IstioEnabled = tc.istio
+			client := ifclientsetfake.NewSimpleClientset(hr)
+			r := &Release{hrClient: client.HelmV1(), config: Config{PostRenderFailure: tc.policy}}
+
+			err := r.postRenderFailure(hr, postRenderIstioStage, fmt.Errorf("boom"))
+			assert.Equal(t, tc.wantErr, err != nil)
+
+			updated, err := client.HelmV1().HelmReleases(hr.Namespace).Get(hr.Name, metav1.GetOptions{})
+			assert.NoError(t, err)
+			c := status.GetCondition(updated.Status, apiV1.HelmReleasePostRenderFailed)
+			if assert.NotNil(t, c) {
+				assert.Equal(t, apiV1.ConditionTrue, c.Status)
+				assert.Contains(t, c.Message, "boom")
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package release
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pmezard/go-difflib/difflib"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+const (
+	// DryRunAnnotation puts the HelmRelease in dry-run mode while it
+	// is set to "true": syncs render the release and compare it with
+	// the current release, and write the result to the preview
+	// ConfigMap instead of applying it. The diff is the diff of the
+	// manifests, in which the data of Secrets is redacted; the values
+	// of the release are not recorded.
+	DryRunAnnotation = "helm.fluxcd.io/dry-run"
+	// PreviewLabel is set on the preview ConfigMaps, to the name of
+	// their HelmRelease.
+	PreviewLabel = "helm.fluxcd.io/preview"
+
+	// ReleasePreviewed is the reason of the Event emitted when a sync
+	// in dry-run mode rendered changes to the release.
+	ReleasePreviewed = "ReleasePreviewed"
+
+	// previewDiffKey and previewManifestKey are the keys the diff and
+	// the rendered manifest are stored under in the ConfigMap.
+	previewDiffKey     = "diff"
+	previewManifestKey = "manifest"
+	// maxPreviewSize is the maximum total size of the diff and the
+	// manifest in the ConfigMap, well below the 1MiB size limit of
+	// objects; the diff takes at most maxPreviewDiffSize of it.
+	maxPreviewSize     = 768 << 10
+	maxPreviewDiffSize = 256 << 10
+	// redactedValue replaces the data of Secrets in the manifest.
+	redactedValue = "<redacted>"
+)
+
+// PreviewConfigMapName returns the name of the ConfigMap the preview
+// of the given HelmRelease is written to.
+func PreviewConfigMapName(hr *apiV1.HelmRelease) string {
+	return hr.Name + "-preview"
+}
+
+// dryRunRequested returns if the given HelmRelease is in dry-run mode.
+func dryRunRequested(hr *apiV1.HelmRelease) bool {
+	return hr.GetAnnotations()[DryRunAnnotation] == "true"
+}
+
+// preview renders the release for the given action with a dry-run,
+// and records its diff with the current release and the rendered
+// manifest in the preview ConfigMap and the status, without applying
+// it. Actions other than installs, upgrades and comparisons have
+// nothing to preview.
+func (r *Release) preview(logger log.Logger, client helm.Client, action action, hr *apiV1.HelmRelease, curRel *helm.Release,
+	chart chart, values []byte) error {
+	switch action {
+	case InstallAction:
+	case UpgradeAction, DryRunCompareAction:
+		action = UpgradeAction
+	default:
+		logger.Log("info", "nothing to preview in dry-run mode", "action", action)
+		return nil
+	}
+
+	dryRel, err := client.UpgradeFromPath(chart.chartPath, hr.GetReleaseName(), values, helm.UpgradeOptions{
+		DryRun:            true,
+		Namespace:         hr.GetTargetNamespace(),
+		Install:           action == InstallAction,
+		Force:             hr.Spec.ForceUpgrade,
+		ReuseValues:       hr.GetReuseValues(),
+		ResetValues:       !hr.GetReuseValues(),
+		SkipCRDs:          hr.Spec.SkipCRDs,
+		DisableHooks:      hr.Spec.DisableHooks,
+		DisableValidation: hr.Spec.DisableOpenAPIValidation,
+		PostRenderer:      r.getPostRenderer(hr, curRel, true),
+		ChartAnnotations:  chartProvenance(hr, chart),
+	})
+	if err != nil {
+		status.SetStatusPhaseWithReason(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseFailed, apiV1.ReasonValuesRenderError)
+		err = ReasonError{apiV1.ReasonValuesRenderError, fmt.Errorf("dry-run %s for preview failed: %w", action, err)}
+		logger.Log("error", err)
+		return err
+	}
+
+	var diff string
+	changed := true
+	manifest, err := redactSecrets(dryRel.Manifest)
+	if err != nil {
+		return fmt.Errorf("failed to redact Secrets of preview: %w", err)
+	}
+	if curRel != nil {
+		current, err := redactSecrets(curRel.Manifest)
+		if err != nil {
+			return fmt.Errorf("failed to redact Secrets of preview: %w", err)
+		}
+		if diff, err = manifestDiff(current, manifest); err != nil {
+			return fmt.Errorf("failed to diff preview: %w", err)
+		}
+		changed = helm.Diff(curRel, dryRel) != "" || curRel.Manifest != dryRel.Manifest
+	}
+	diff, _ = truncateDiff(diff, maxPreviewDiffSize)
+	manifest, _ = truncateDiff(manifest, maxPreviewSize-len(diff))
+	if err := r.writePreview(hr, map[string]string{previewDiffKey: diff, previewManifestKey: manifest}); err != nil {
+		return fmt.Errorf("failed to write preview: %w", err)
+	}
+
+	preview := &apiV1.ReleasePreview{
+		Time:          metav1.Now(),
+		Revision:      chart.revision,
+		Action:        string(action),
+		Changed:       changed,
+		ConfigMapName: PreviewConfigMapName(hr),
+	}
+	if err := status.SetPreview(r.hrClient.HelmReleases(hr.Namespace), hr, preview); err != nil {
+		logger.Log("warning", fmt.Sprintf("failed to record preview in status: %v", err))
+	}
+	logger.Log("info", "rendered preview in dry-run mode", "action", action, "changed", changed)
+	if changed && r.recorder != nil && (hr.Status.Preview == nil || hr.Status.Preview.Revision != chart.revision || !hr.Status.Preview.Changed) {
+		r.recorder.Event(hr, corev1.EventTypeNormal, ReleasePreviewed,
+			fmt.Sprintf("dry-run %s of revision '%s' previewed in ConfigMap '%s'", action, chart.revision, preview.ConfigMapName))
+	}
+	return nil
+}
+
+// clearPreview removes the preview of a HelmRelease which left the
+// dry-run mode, from the status and the ConfigMap.
+func (r *Release) clearPreview(logger log.Logger, hr *apiV1.HelmRelease) {
+	if hr.Status.Preview == nil {
+		return
+	}
+	err := r.coreV1Client.ConfigMaps(hr.Namespace).Delete(hr.Status.Preview.ConfigMapName, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		logger.Log("warning", fmt.Sprintf("failed to delete preview ConfigMap: %v", err))
+		return
+	}
+	if err := status.SetPreview(r.hrClient.HelmReleases(hr.Namespace), hr, nil); err != nil {
+		logger.Log("warning", fmt.Sprintf("failed to remove preview from status: %v", err))
+	}
+}
+
+// writePreview creates or updates the preview ConfigMap of the given
+// HelmRelease with the data.
+func (r *Release) writePreview(hr *apiV1.HelmRelease, data map[string]string) error {
+	controller := true
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      PreviewConfigMapName(hr),
+			Namespace: hr.Namespace,
+			Labels:    map[string]string{PreviewLabel: hr.Name},
+			Annotations: map[string]string{
+				apiV1.AntecedentAnnotation: hr.ResourceID().String(),
+			},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: apiV1.SchemeGroupVersion.String(),
+				Kind:       "HelmRelease",
+				Name:       hr.Name,
+				UID:        hr.UID,
+				Controller: &controller,
+			}},
+		},
+		Data: data,
+	}
+
+	configMaps := r.coreV1Client.ConfigMaps(hr.Namespace)
+	current, err := configMaps.Get(cm.Name, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		_, err = configMaps.Create(cm)
+		return err
+	case err != nil:
+		return err
+	}
+	if current.Labels[PreviewLabel] != hr.Name {
+		return fmt.Errorf("ConfigMap '%s' exists and is not managed by the operator", cm.Name)
+	}
+	if reflect.DeepEqual(current.Data, cm.Data) && reflect.DeepEqual(current.OwnerReferences, cm.OwnerReferences) {
+		return nil
+	}
+	current.Data = cm.Data
+	current.OwnerReferences = cm.OwnerReferences
+	_, err = configMaps.Update(current)
+	return err
+}
+
+// manifestDiff returns the unified diff of the given manifests, or an
+// empty string if they are equal.
+func manifestDiff(current, desired string) (string, error) {
+	if current == desired {
+		return "", nil
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(current),
+		B:        difflib.SplitLines(desired),
+		FromFile: "current",
+		ToFile:   "desired",
+		Context:  3,
+	})
+}
+
+// redactSecrets returns the given manifest with the data of Secrets
+// replaced, ordered by kind, namespace and name.
+func redactSecrets(manifest string) (string, error) {
+	objs := releaseManifestToUnstructured(manifest)
+	for i := range objs {
+		obj := &objs[i]
+		if obj.GetKind() != "Secret" {
+			continue
+		}
+		for _, field := range []string{"data", "stringData"} {
+			data, ok, _ := unstructured.NestedMap(obj.Object, field)
+			if !ok {
+				continue
+			}
+			for k := range data {
+				data[k] = redactedValue
+			}
+			if err := unstructured.SetNestedMap(obj.Object, data, field); err != nil {
+				return "", err
+			}
+		}
+	}
+	sort.SliceStable(objs, func(i, j int) bool {
+		a, b := objs[i], objs[j]
+		if a.GetKind() != b.GetKind() {
+			return a.GetKind() < b.GetKind()
+		}
+		if a.GetNamespace() != b.GetNamespace() {
+			return a.GetNamespace() < b.GetNamespace()
+		}
+		return a.GetName() < b.GetName()
+	})
+	out, err := unstructuredToManifests(objs)
+	if err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,119 @@
+package release
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+)
+
+func TestRedactSecrets(t *testing.T) {
+	manifest := `---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: credentials
+data:
+  password: c2VjcmV0
+stringData:
+  token: secret
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  key: value
+`
+	redacted, err := redactSecrets(manifest)
+	assert.NoError(t, err)
+	assert.NotContains(t, redacted, "c2VjcmV0")
+	assert.NotContains(t, redacted, "token: secret")
+	assert.Contains(t, redacted, "password: <redacted>")
+	assert.Contains(t, redacted, "key: value")
+	assert.Less(t, strings.Index(redacted, "kind: ConfigMap"), strings.Index(redacted, "kind: Secret"), "objects are ordered by kind")
+}
+
+func TestWritePreview(t *testing.T) {
+	hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "podinfo", UID: "uid"}}
+	coreClient := fake.NewSimpleClientset()
+	hrClient := ifclientsetfake.NewSimpleClientset(hr)
+	r := &Release{coreV1Client: coreClient.CoreV1(), hrClient: hrClient.HelmV1()}
+
+	assert.NoError(t, r.writePreview(hr, map[string]string{previewDiffKey: "a"}))
+	assert.NoError(t, r.writePreview(hr, map[string]string{previewDiffKey: "b"}))
+	cm, err := coreClient.CoreV1().ConfigMaps("ns").Get("podinfo-preview", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "b", cm.Data[previewDiffKey])
+	assert.Equal(t, "podinfo", cm.Labels[PreviewLabel])
+	assert.Equal(t, hr.UID, cm.OwnerReferences[0].UID)
+
+	// the preview is removed when the dry-run mode is left
+	hr.Status.Preview = &apiV1.ReleasePreview{ConfigMapName: cm.Name}
+	r.clearPreview(log.NewNopLogger(), hr)
+	_, err = coreClient.CoreV1().ConfigMaps("ns").Get("podinfo-preview", metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err))
+	updated, err := hrClient.HelmV1().HelmReleases("ns").Get("podinfo", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Nil(t, updated.Status.Preview)
+}
+
+func TestWritePreviewUnmanagedConfigMap(t *testing.T) {
+	hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "podinfo"}}
+	coreClient := fake.NewSimpleClientset(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "podinfo-preview"}})
+	r := &Release{coreV1Client: coreClient.CoreV1()}
+	assert.Error(t, r.writePreview(hr, nil))
+}
+
+func TestManifestDiff(t *testing.T) {
+	current, err := redactSecrets(`---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: credentials
+data:
+  password: b2xk
+`)
+	assert.NoError(t, err)
+	desired, err := redactSecrets(`---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: credentials
+data:
+  password: bmV3
+  token: bmV3
+`)
+	assert.NoError(t, err)
+
+	diff, err := manifestDiff(current, desired)
+	assert.NoError(t, err)
+	assert.Contains(t, diff, "+  token: <redacted>")
+	assert.NotContains(t, diff, "b2xk")
+	assert.NotContains(t, diff, "bmV3")
+
+	diff, err = manifestDiff(current, current)
+	assert.NoError(t, err)
+	assert.Empty(t, diff)
+}
+
+func TestWritePreviewUnchanged(t *testing.T) {
+	hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "podinfo", UID: "uid"}}
+	coreClient := fake.NewSimpleClientset()
+	r := &Release{coreV1Client: coreClient.CoreV1()}
+
+	assert.NoError(t, r.writePreview(hr, map[string]string{previewDiffKey: "a"}))
+	coreClient.ClearActions()
+	assert.NoError(t, r.writePreview(hr, map[string]string{previewDiffKey: "a"}))
+	for _, a := range coreClient.Actions() {
+		assert.Equal(t, "get", a.GetVerb(), "an unchanged preview is not written again")
+	}
+}
@@ -0,0 +1,60 @@
+package release
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+// WaitProgress is the reason of the Event emitted with the progress
+// of a wait for the resources of a release.
+const WaitProgress = "WaitProgress"
+
+// maxUnreadyResources is the maximum amount of unready resources
+// listed in a progress message.
+const maxUnreadyResources = 10
+
+// reportWaitProgress returns a function which records the progress
+// of a wait for the resources of the release in the message of the
+// condition of the given phase, and emits it as an Event if it
+// changed since the last report.
+func (r *Release) reportWaitProgress(hr *apiV1.HelmRelease, phase apiV1.HelmReleasePhase) func(helm.WaitProgress) {
+	var last string
+	return func(p helm.WaitProgress) {
+		message := waitProgressMessage(hr, p)
+		if message == last {
+			return
+		}
+		last = message
+		status.SetStatusPhaseWithMessage(r.hrClient.HelmReleases(hr.Namespace), hr, phase, string(phase), message)
+		if r.recorder != nil {
+			r.recorder.Event(hr, corev1.EventTypeNormal, WaitProgress, message)
+		}
+	}
+}
+
+// waitProgressMessage returns the message describing the progress,
+// i.e. `Waiting for resources of Helm release 'podinfo' in 'default':
+// 1/3 pods ready, unready: Deployment/podinfo.`
+func waitProgressMessage(hr *apiV1.HelmRelease, p helm.WaitProgress) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Waiting for resources of Helm release '%s' in '%s': %d/%d pods ready",
+		hr.GetReleaseName(), hr.GetTargetNamespace(), p.ReadyPods, p.DesiredPods)
+	if len(p.Unready) > 0 {
+		unready := p.Unready
+		if len(unready) > maxUnreadyResources {
+			unready = unready[:maxUnreadyResources]
+		}
+		fmt.Fprintf(&b, ", unready: %s", strings.Join(unready, ", "))
+		if more := len(p.Unready) - len(unready); more > 0 {
+			fmt.Fprintf(&b, " and %d more", more)
+		}
+	}
+	b.WriteString(".")
+	return b.String()
+}
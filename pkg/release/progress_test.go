@@ -0,0 +1,36 @@
+package release
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+func TestReportWaitProgress(t *testing.T) {
+	hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "podinfo"}}
+	client := ifclientsetfake.NewSimpleClientset(hr)
+	recorder := record.NewFakeRecorder(2)
+	r := &Release{hrClient: client.HelmV1(), recorder: recorder}
+
+	report := r.reportWaitProgress(hr, apiV1.HelmReleasePhaseInstalling)
+	progress := helm.WaitProgress{ReadyPods: 1, DesiredPods: 3, Unready: []string{"Deployment/podinfo"}}
+	report(progress)
+	// unchanged progress is not reported again
+	report(progress)
+
+	updated, err := client.HelmV1().HelmReleases(hr.Namespace).Get(hr.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	condition := status.GetCondition(updated.Status, apiV1.HelmReleaseDeployed)
+	want := "Waiting for resources of Helm release 'default-podinfo' in 'default': 1/3 pods ready, unready: Deployment/podinfo."
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, want, condition.Message)
+	}
+	assert.Len(t, recorder.Events, 1)
+}
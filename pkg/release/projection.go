@@ -0,0 +1,167 @@
+package release
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/lstack-org/helm-operator/pkg/api"
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/chartsync"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+// ProjectDiff returns the diff the given mutation of the spec of the
+// HelmRelease would make to its release. The chart is fetched and
+// rendered with a dry-run in a workspace of its own, but neither the
+// HelmRelease, its status nor the Helm storage are changed. Like the
+// previews of the dry-run mode, the diff is the diff of the manifests
+// with the data of Secrets redacted; values read from Secrets and Vault
+// are redacted as well, wherever the chart renders them.
+func (r *Release) ProjectDiff(namespace, name string, mutation api.SpecMutation) (api.ProjectedDiff, error) {
+	hr, err := r.hrClient.HelmReleases(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return api.ProjectedDiff{}, err
+	}
+	hr = hr.DeepCopy()
+	if err := mutateSpec(hr, mutation); err != nil {
+		return api.ProjectedDiff{}, err
+	}
+	client, err := r.HelmClient(hr)
+	if err != nil {
+		return api.ProjectedDiff{}, err
+	}
+
+	ws, err := chartsync.NewWorkspace(r.config.ChartCache, hr.Namespace+"_"+hr.Name+"_projection", r.config.WorkspaceQuota, r.config.HTTPTransport)
+	if err != nil {
+		return api.ProjectedDiff{}, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	defer ws.Clean()
+
+	chart, cleanup, err := r.prepareChart(client, hr, ws)
+	if err != nil {
+		return api.ProjectedDiff{}, fmt.Errorf("failed to prepare chart: %w", err)
+	}
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if chart.chartPath, err = chartsync.ApplyOverlays(r.coreV1Client, hr.Namespace, ws, chart.chartPath, chart.repoDir, hr.Spec.OverlaysFrom); err != nil {
+		return api.ProjectedDiff{}, fmt.Errorf("failed to apply chart overlays: %w", err)
+	}
+	values, layers, err := composeValuesLayers(r.coreV1Client, r.dynamicClient, r.restMapper, hr, chart, r.config)
+	if err != nil {
+		return api.ProjectedDiff{}, fmt.Errorf("failed to compose values: %w", err)
+	}
+
+	curRel, err := client.Get(hr.GetReleaseName(), helm.GetOptions{Namespace: hr.GetTargetNamespace()})
+	if err != nil {
+		return api.ProjectedDiff{}, fmt.Errorf("failed to retrieve Helm release: %w", err)
+	}
+	action := UpgradeAction
+	if curRel == nil {
+		action = InstallAction
+	}
+	dryRel, err := client.UpgradeFromPath(chart.chartPath, hr.GetReleaseName(), values, helm.UpgradeOptions{
+		DryRun:      true,
+		Namespace:   hr.GetTargetNamespace(),
+		Install:     curRel == nil,
+		Force:       hr.Spec.ForceUpgrade,
+		ReuseValues: hr.GetReuseValues(),
+		ResetValues: !hr.GetReuseValues(),
+	})
+	if err != nil {
+		return api.ProjectedDiff{}, fmt.Errorf("dry-run %s failed: %w", action, err)
+	}
+
+	projected := api.ProjectedDiff{Action: string(action), Revision: chart.revision, Changed: true}
+	if dryRel.Chart != nil {
+		projected.ChartVersion = dryRel.Chart.Version
+	}
+	if curRel != nil {
+		secrets := secretValues(layers)
+		current, err := redactSecrets(curRel.Manifest)
+		if err != nil {
+			return api.ProjectedDiff{}, fmt.Errorf("failed to redact Secrets of projection: %w", err)
+		}
+		desired, err := redactSecrets(dryRel.Manifest)
+		if err != nil {
+			return api.ProjectedDiff{}, fmt.Errorf("failed to redact Secrets of projection: %w", err)
+		}
+		if projected.Diff, err = manifestDiff(redactValues(current, secrets), redactValues(desired, secrets)); err != nil {
+			return api.ProjectedDiff{}, fmt.Errorf("failed to diff projection: %w", err)
+		}
+		projected.Changed = helm.Diff(curRel, dryRel) != "" || curRel.Manifest != dryRel.Manifest
+	}
+	return projected, nil
+}
+
+// secretValues returns the string values of the given layers which
+// were read from Secrets or Vault, longest first.
+func secretValues(layers []valuesLayer) []string {
+	var values []string
+	var collect func(v interface{})
+	collect = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for _, e := range v {
+				collect(e)
+			}
+		case []interface{}:
+			for _, e := range v {
+				collect(e)
+			}
+		case string:
+			if v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	for _, l := range layers {
+		if strings.HasPrefix(l.source, "secretKeyRef ") || strings.HasPrefix(l.source, "vaultRef ") {
+			collect(map[string]interface{}(l.values))
+		}
+	}
+	sort.SliceStable(values, func(i, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+	return values
+}
+
+// redactValues returns the given manifest with every occurrence of the
+// values, as well as their base64 encoding, replaced.
+func redactValues(manifest string, values []string) string {
+	if len(values) == 0 {
+		return manifest
+	}
+	oldnew := make([]string, 0, 4*len(values))
+	for _, v := range values {
+		oldnew = append(oldnew, v, redactedValue, base64.StdEncoding.EncodeToString([]byte(v)), redactedValue)
+	}
+	return strings.NewReplacer(oldnew...).Replace(manifest)
+}
+
+// mutateSpec applies the mutation to the spec of the given HelmRelease.
+func mutateSpec(hr *apiV1.HelmRelease, mutation api.SpecMutation) error {
+	if mutation.ChartVersion != "" {
+		if hr.Spec.RepoChartSource == nil || hr.Spec.RepoURL == "" {
+			return api.InvalidMutationError{Reason: "chartVersion requires a Helm repository chart source"}
+		}
+		hr.Spec.Version = mutation.ChartVersion
+	}
+	if mutation.GitRef != "" {
+		if hr.Spec.GitChartSource == nil || hr.Spec.GitURL == "" {
+			return api.InvalidMutationError{Reason: "gitRef requires a Git chart source"}
+		}
+		hr.Spec.Ref = mutation.GitRef
+	}
+	if len(mutation.Values) > 0 {
+		if hr.Spec.Values.Data == nil {
+			hr.Spec.Values.Data = map[string]interface{}{}
+		}
+		hr.Spec.Values.Data = mergeValues(hr.Spec.Values.Data, mutation.Values)
+	}
+	return nil
+}
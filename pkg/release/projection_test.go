@@ -0,0 +1,58 @@
+package release
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lstack-org/helm-operator/pkg/api"
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+func TestMutateSpec(t *testing.T) {
+	repo := func() *apiV1.HelmRelease {
+		hr := &apiV1.HelmRelease{}
+		hr.Spec.RepoChartSource = &apiV1.RepoChartSource{RepoURL: "https://charts.example.com", Name: "podinfo", Version: "1.0.0"}
+		hr.Spec.Values.Data = map[string]interface{}{"image": map[string]interface{}{"tag": "1.0.0", "pullPolicy": "Always"}}
+		return hr
+	}
+
+	hr := repo()
+	err := mutateSpec(hr, api.SpecMutation{
+		ChartVersion: "1.1.0",
+		Values:       map[string]interface{}{"image": map[string]interface{}{"tag": "1.1.0"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "1.1.0", hr.Spec.Version)
+	assert.Equal(t, map[string]interface{}{"image": map[string]interface{}{"tag": "1.1.0", "pullPolicy": "Always"}}, hr.Spec.Values.Data)
+
+	hr = &apiV1.HelmRelease{}
+	assert.NoError(t, mutateSpec(hr, api.SpecMutation{Values: map[string]interface{}{"replicas": 2}}))
+	assert.Equal(t, map[string]interface{}{"replicas": 2}, hr.Spec.Values.Data)
+
+	err = mutateSpec(repo(), api.SpecMutation{GitRef: "release-1.1"})
+	assert.IsType(t, api.InvalidMutationError{}, err)
+
+	hr = &apiV1.HelmRelease{}
+	hr.Spec.GitChartSource = &apiV1.GitChartSource{GitURL: "https://example.com/charts.git", Path: "podinfo"}
+	assert.IsType(t, api.InvalidMutationError{}, mutateSpec(hr, api.SpecMutation{ChartVersion: "1.1.0"}))
+	assert.NoError(t, mutateSpec(hr, api.SpecMutation{GitRef: "release-1.1"}))
+	assert.Equal(t, "release-1.1", hr.Spec.Ref)
+}
+
+func TestRedactSecretValues(t *testing.T) {
+	layers := []valuesLayer{
+		{source: "inline", values: map[string]interface{}{"image": map[string]interface{}{"tag": "1.0.0"}}},
+		{source: "secretKeyRef flux/podinfo:values.yaml", values: map[string]interface{}{
+			"db": map[string]interface{}{"password": "hunter2", "hosts": []interface{}{"db.example.com"}, "port": 5432},
+		}},
+		{source: "vaultRef secret/podinfo", values: map[string]interface{}{"token": "s3cr3t-token"}},
+	}
+	values := secretValues(layers)
+	assert.Equal(t, []string{"db.example.com", "s3cr3t-token", "hunter2"}, values)
+
+	manifest := "env:\n- name: PASSWORD\n  value: hunter2\n- name: TOKEN\n  value: czNjcjN0LXRva2Vu\nimage: podinfo:1.0.0\n"
+	assert.Equal(t, "env:\n- name: PASSWORD\n  value: <redacted>\n- name: TOKEN\n  value: <redacted>\nimage: podinfo:1.0.0\n",
+		redactValues(manifest, values))
+	assert.Equal(t, manifest, redactValues(manifest, nil))
+}
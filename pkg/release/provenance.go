@@ -0,0 +1,128 @@
+package release
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+// Annotations recorded in the chart metadata of every release made by
+// the operator, so that each release revision can be traced back to
+// the exact chart artifact it was produced from.
+const (
+	ChartDigestAnnotation    = "helm.fluxcd.io/chart-digest"
+	ChartSourceAnnotation    = "helm.fluxcd.io/chart-source"
+	ChartRevisionAnnotation  = "helm.fluxcd.io/chart-revision"
+	ChartFetchedAtAnnotation = "helm.fluxcd.io/chart-fetched-at"
+)
+
+// chartProvenance returns the provenance annotations for the given
+// chart of the HelmRelease. Information which can not be determined
+// is omitted.
+func chartProvenance(hr *apiV1.HelmRelease, chart chart) map[string]string {
+	annotations := map[string]string{
+		ChartRevisionAnnotation: chart.revision,
+	}
+	if source := chartSourceURL(hr); source != "" {
+		annotations[ChartSourceAnnotation] = source
+	}
+	if fi, err := os.Stat(chart.chartPath); err == nil {
+		annotations[ChartFetchedAtAnnotation] = fi.ModTime().UTC().Format(time.RFC3339)
+	}
+	if digest, err := chartDigest(chart.chartPath); err == nil {
+		annotations[ChartDigestAnnotation] = digest
+	}
+	return annotations
+}
+
+// chartSourceURL returns an URL describing the chart source of the
+// given HelmRelease. Credentials and query parameters are stripped
+// from URLs, as these may contain secrets.
+func chartSourceURL(hr *apiV1.HelmRelease) string {
+	switch {
+	case hr.Spec.GitChartSource != nil && hr.Spec.GitURL != "":
+		return fmt.Sprintf("%s//%s", redactURL(hr.Spec.GitURL), hr.Spec.GitChartSource.Path)
+	case hr.Spec.RepoChartSource != nil && hr.Spec.RepoURL != "":
+		return fmt.Sprintf("%s%s-%s", redactURL(hr.Spec.RepoChartSource.CleanRepoURL()), hr.Spec.RepoChartSource.Name,
+			hr.Spec.RepoChartSource.Version)
+	case hr.Spec.Customize != nil && hr.Spec.Customize.Key != "":
+		return redactURL(hr.Spec.Customize.Key)
+	case hr.Spec.Oss != nil:
+		return fmt.Sprintf("oss://%s/%s", hr.Spec.Oss.Bucket, hr.Spec.Oss.Key)
+	}
+	return ""
+}
+
+// redactURL strips user info and the query from the given URL, if it
+// can be parsed as such.
+func redactURL(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Scheme == "" {
+		return u
+	}
+	parsed.User = nil
+	parsed.RawQuery = ""
+	return parsed.String()
+}
+
+// chartDigest returns the SHA256 digest of the chart at the given
+// path. For a chart archive this is the digest of the archive, for a
+// chart directory it is computed over the relative paths and contents
+// of all files in lexical order.
+func chartDigest(chartPath string) (string, error) {
+	fi, err := os.Stat(chartPath)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if !fi.IsDir() {
+		if err := hashFile(h, chartPath); err != nil {
+			return "", err
+		}
+		return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	var files []string
+	err = filepath.Walk(chartPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		rel, err := filepath.Rel(chartPath, f)
+		if err != nil {
+			return "", err
+		}
+		io.WriteString(h, filepath.ToSlash(rel)+"\x00")
+		if err := hashFile(h, f); err != nil {
+			return "", err
+		}
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
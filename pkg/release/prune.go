@@ -0,0 +1,170 @@
+package release
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/retry"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+const (
+	// PruneAnnotation set to PruneSkip on a resource of a release
+	// protects it from being pruned once it has been removed from the
+	// release.
+	PruneAnnotation = "helm.fluxcd.io/prune"
+	PruneSkip       = "skip"
+
+	// ResourcesPruned is the reason of the Event emitted when resources
+	// removed from the release have been pruned.
+	ResourcesPruned = "ResourcesPruned"
+
+	// The annotation of the resource policy keeping a resource.
+	helmResourcePolicyAnnotation = "helm.sh/resource-policy"
+	helmResourcePolicyKeep       = "keep"
+)
+
+// pruneResources deletes the resources in the inventory of the
+// HelmRelease which are no longer part of the given release, but were
+// part of the given previous release, if it is enabled for the
+// HelmRelease. Failures are logged, as they should not fail the
+// release.
+func (r *Release) pruneResources(logger log.Logger, hr *apiV1.HelmRelease, prevRel, rel *helm.Release) {
+	if !hr.Spec.Prune || prevRel == nil || rel == nil || remoteTarget(hr) {
+		return
+	}
+	namespace := hr.GetTargetNamespace()
+	previous := make(map[string]bool)
+	for _, ref := range manifestInventory(prevRel.Manifest) {
+		previous[resourceKey(ref, namespace)] = true
+	}
+	pruned, err := r.prune(logger, hr, removedResources(hr.Status.Inventory, manifestInventory(rel.Manifest), namespace), previous)
+	if len(pruned) > 0 {
+		list := pruned
+		if len(list) > maxMissingReports {
+			list = append(list[:maxMissingReports:maxMissingReports], "...")
+		}
+		message := fmt.Sprintf("pruned %d resource(s) removed from the release: %s", len(pruned), strings.Join(list, ", "))
+		logger.Log("info", message)
+		if r.recorder != nil {
+			r.recorder.Event(hr, corev1.EventTypeNormal, ResourcesPruned, message)
+		}
+	}
+	if err != nil {
+		logger.Log("warning", fmt.Sprintf("failed to prune resources removed from the release: %v", err))
+	}
+}
+
+// removedResources returns the references in the previous inventory
+// to resources not in the current inventory. Resources are compared
+// by group, kind, namespace and name, so resources of which only the
+// API version changed are not removed.
+func removedResources(previous, current []apiV1.ResourceRef, namespace string) []apiV1.ResourceRef {
+	keep := make(map[string]bool, len(current))
+	for _, ref := range current {
+		keep[resourceKey(ref, namespace)] = true
+	}
+	var removed []apiV1.ResourceRef
+	for _, ref := range previous {
+		if !keep[resourceKey(ref, namespace)] {
+			removed = append(removed, ref)
+		}
+	}
+	return removed
+}
+
+// resourceKey returns the key of the referenced resource by group,
+// kind, namespace and name, defaulting to the given namespace.
+func resourceKey(ref apiV1.ResourceRef, namespace string) string {
+	gv, _ := schema.ParseGroupVersion(ref.APIVersion)
+	ns := ref.Namespace
+	if ns == "" {
+		ns = namespace
+	}
+	return strings.Join([]string{gv.Group, ref.Kind, ns, ref.Name}, "/")
+}
+
+// prune deletes the referenced resources still owned by the release of
+// the HelmRelease, of which the given keys are those of the resources
+// of its previous release, unless they are protected from pruning. It
+// returns the descriptions of the deleted resources, and the first
+// error.
+func (r *Release) prune(logger log.Logger, hr *apiV1.HelmRelease, refs []apiV1.ResourceRef, previous map[string]bool) ([]string, error) {
+	var pruned []string
+	for _, ref := range refs {
+		obj := unstructured.Unstructured{}
+		obj.SetAPIVersion(ref.APIVersion)
+		obj.SetKind(ref.Kind)
+		obj.SetNamespace(ref.Namespace)
+		obj.SetName(ref.Name)
+		description := objectDescription(obj, hr.GetTargetNamespace())
+		ri, err := resourceInterfaceFor(r.dynamicClient, r.restMapper, obj, hr.GetTargetNamespace())
+		if err != nil {
+			return pruned, err
+		}
+
+		var live *unstructured.Unstructured
+		err = retry.OnError(retry.DefaultBackoff, isRetriable, func() (err error) {
+			live, err = ri.Get(ref.Name, metav1.GetOptions{})
+			return err
+		})
+		switch {
+		case apierrors.IsNotFound(err):
+			continue
+		case err != nil:
+			return pruned, fmt.Errorf("failed to get %s: %w", description, err)
+		}
+		if reason := pruneProtection(hr, live, previous[resourceKey(ref, hr.GetTargetNamespace())]); reason != "" {
+			logger.Log("info", fmt.Sprintf("not pruning %s removed from the release, %s", description, reason))
+			continue
+		}
+
+		// the UID precondition guards against deleting a resource which
+		// has been recreated in the meantime
+		uid := live.GetUID()
+		propagation := metav1.DeletePropagationBackground
+		err = ri.Delete(ref.Name, &metav1.DeleteOptions{
+			Preconditions:     &metav1.Preconditions{UID: &uid},
+			PropagationPolicy: &propagation,
+		})
+		switch {
+		case apierrors.IsNotFound(err) || apierrors.IsConflict(err):
+			continue
+		case err != nil:
+			return pruned, fmt.Errorf("failed to delete %s: %w", description, err)
+		}
+		pruned = append(pruned, description)
+	}
+	return pruned, nil
+}
+
+// pruneProtection returns why the given resource may not be pruned
+// for the HelmRelease, or an empty string if it may be pruned. As Helm
+// 3.1.2 does not record the owning release on the resources, they are
+// only pruned if they were part of the previous release and are still
+// annotated as belonging to the HelmRelease, so resources adopted by
+// another release in the meantime are never deleted.
+func pruneProtection(hr *apiV1.HelmRelease, obj *unstructured.Unstructured, previous bool) string {
+	annotations := obj.GetAnnotations()
+	switch {
+	case annotations[PruneAnnotation] == PruneSkip:
+		return fmt.Sprintf("it is annotated with %s: %s", PruneAnnotation, PruneSkip)
+	case annotations[helmResourcePolicyAnnotation] == helmResourcePolicyKeep:
+		return "it is kept by its Helm resource policy"
+	case !previous:
+		return "it was not part of the previous release"
+	case annotations[apiV1.AntecedentAnnotation] != hr.ResourceID().String():
+		return "it is not owned by the release"
+	case obj.GetDeletionTimestamp() != nil:
+		return "it is being deleted"
+	}
+	return ""
+}
@@ -0,0 +1,133 @@
+package release
+
+import (
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/tools/record"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+func TestPruneResources(t *testing.T) {
+	object := func(apiVersion, kind, name string, annotations map[string]string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind(kind)
+		obj.SetNamespace("apps")
+		obj.SetName(name)
+		obj.SetAnnotations(annotations)
+		return obj
+	}
+	hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "podinfo"}}
+	hr.Spec.ReleaseName = "podinfo"
+	hr.Spec.TargetNamespace = "apps"
+	hr.Spec.Prune = true
+	owned := map[string]string{apiV1.AntecedentAnnotation: hr.ResourceID().String()}
+	skipped := map[string]string{PruneAnnotation: PruneSkip}
+	kept := map[string]string{helmResourcePolicyAnnotation: helmResourcePolicyKeep}
+	for k, v := range owned {
+		skipped[k], kept[k] = v, v
+	}
+	adopted := map[string]string{apiV1.AntecedentAnnotation: "ns:helmrelease/other"}
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	for _, gvk := range []schema.GroupVersionKind{
+		{Group: "apps", Version: "v1", Kind: "Deployment"},
+		{Group: "apps", Version: "v1beta2", Kind: "Deployment"},
+		{Version: "v1", Kind: "Service"},
+		{Version: "v1", Kind: "ConfigMap"},
+		{Version: "v1", Kind: "Secret"},
+	} {
+		mapper.Add(gvk, meta.RESTScopeNamespace)
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		object("apps/v1", "Deployment", "podinfo", owned),
+		object("v1", "Service", "podinfo", owned),
+		object("v1", "ConfigMap", "skipped", skipped),
+		object("v1", "ConfigMap", "kept", kept),
+		object("v1", "Secret", "adopted", adopted),
+		object("v1", "Secret", "unreleased", owned),
+	)
+	recorder := record.NewFakeRecorder(1)
+	r := &Release{dynamicClient: dynamicClient, restMapper: mapper, recorder: recorder}
+
+	hr.Status.Inventory = []apiV1.ResourceRef{
+		{APIVersion: "apps/v1beta2", Kind: "Deployment", Name: "podinfo"},
+		{APIVersion: "v1", Kind: "ConfigMap", Name: "kept"},
+		{APIVersion: "v1", Kind: "ConfigMap", Name: "missing"},
+		{APIVersion: "v1", Kind: "ConfigMap", Name: "skipped"},
+		{APIVersion: "v1", Kind: "Secret", Name: "adopted"},
+		{APIVersion: "v1", Kind: "Secret", Name: "unreleased"},
+		{APIVersion: "v1", Kind: "Service", Name: "podinfo"},
+	}
+	// the resources of the previous release, the Secret 'unreleased'
+	// is not part of it
+	prevRel := &helm.Release{Manifest: `---
+apiVersion: apps/v1beta2
+kind: Deployment
+metadata:
+  name: podinfo
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: podinfo
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: kept
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: skipped
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: adopted
+`}
+	rel := &helm.Release{Manifest: `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: podinfo
+`}
+
+	r.pruneResources(log.NewNopLogger(), hr, prevRel, rel)
+	assert.Equal(t, "Normal ResourcesPruned pruned 1 resource(s) removed from the release: Service apps/podinfo", <-recorder.Events)
+
+	for _, ref := range []struct {
+		resource schema.GroupVersionResource
+		name     string
+		exists   bool
+	}{
+		{schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, "podinfo", true},
+		{schema.GroupVersionResource{Version: "v1", Resource: "services"}, "podinfo", false},
+		{schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, "skipped", true},
+		{schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, "kept", true},
+		{schema.GroupVersionResource{Version: "v1", Resource: "secrets"}, "adopted", true},
+		{schema.GroupVersionResource{Version: "v1", Resource: "secrets"}, "unreleased", true},
+	} {
+		_, err := dynamicClient.Resource(ref.resource).Namespace("apps").Get(ref.name, metav1.GetOptions{})
+		assert.Equal(t, ref.exists, err == nil, ref.resource.Resource+"/"+ref.name)
+	}
+
+	// nothing is pruned unless enabled
+	hr.Spec.Prune = false
+	hr.Status.Inventory = []apiV1.ResourceRef{{APIVersion: "apps/v1", Kind: "Deployment", Name: "podinfo"}}
+	r.pruneResources(log.NewNopLogger(), hr, prevRel, &helm.Release{})
+	_, err := dynamicClient.Resource(schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}).
+		Namespace("apps").Get("podinfo", metav1.GetOptions{})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,38 @@
+package release
+
+import (
+	"errors"
+)
+
+// ReasonError annotates an error with the reason code of the failure,
+// as set on the conditions of the HelmRelease.
+type ReasonError struct {
+	Reason string
+	Err    error
+}
+
+func (err ReasonError) Unwrap() error {
+	return err.Err
+}
+
+func (err ReasonError) Error() string {
+	return err.Err.Error()
+}
+
+// Reason returns the reason code of the first failure in the given
+// error returned by a sync, or an empty string if it has none.
+func Reason(err error) string {
+	if errs, ok := err.(errCollection); ok {
+		for _, err := range errs {
+			if reason := Reason(err); reason != "" {
+				return reason
+			}
+		}
+		return ""
+	}
+	var reasonErr ReasonError
+	if errors.As(err, &reasonErr) {
+		return reasonErr.Reason
+	}
+	return ""
+}
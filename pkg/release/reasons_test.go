@@ -0,0 +1,32 @@
+package release
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+func TestReason(t *testing.T) {
+	upgradeErr := ReasonError{apiV1.ReasonHelmUpgradeFailed, errors.New("upgrade failed")}
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"no reason", errors.New("failed"), ""},
+		{"reason", upgradeErr, apiV1.ReasonHelmUpgradeFailed},
+		{"wrapped", fmt.Errorf("sync failed: %w", upgradeErr), apiV1.ReasonHelmUpgradeFailed},
+		{"first in collection", errCollection{errors.New("failed"), upgradeErr,
+			ReasonError{apiV1.ReasonTestFailed, errors.New("test failed")}}, apiV1.ReasonHelmUpgradeFailed},
+		{"none in collection", errCollection{errors.New("failed")}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Reason(tt.err))
+		})
+	}
+}
@@ -6,12 +6,14 @@ import (
 	"fmt"
 	"helm.sh/helm/v3/pkg/postrender"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/klog"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	"net/http"
 	"path/filepath"
 	"sigs.k8s.io/yaml"
 	"strconv"
@@ -20,21 +22,103 @@ import (
 	"github.com/go-kit/kit/log"
 
 	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/approval"
 	"github.com/lstack-org/helm-operator/pkg/chartsync"
 	v1client "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/typed/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/freeze"
+	"github.com/lstack-org/helm-operator/pkg/halt"
 	"github.com/lstack-org/helm-operator/pkg/helm"
 	helmV3 "github.com/lstack-org/helm-operator/pkg/helm/v3"
+	"github.com/lstack-org/helm-operator/pkg/messages"
+	"github.com/lstack-org/helm-operator/pkg/notify"
+	"github.com/lstack-org/helm-operator/pkg/opa"
+	"github.com/lstack-org/helm-operator/pkg/registry"
+	"github.com/lstack-org/helm-operator/pkg/releasehook"
 	"github.com/lstack-org/helm-operator/pkg/status"
+	"github.com/lstack-org/helm-operator/pkg/vault"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 )
 
 // Config holds the configuration for releases.
 type Config struct {
-	ChartCache         string
-	UpdateDeps         bool
-	LogDiffs           bool
-	DefaultHelmVersion string
+	ChartCache              string
+	UpdateDeps              bool
+	LogDiffs                bool
+	DefaultHelmVersion      string
+	CapacityCheck           CapacityCheckPolicy
+	PlatformCheck           PlatformCheckPolicy
+	CrossNamespaceValues    bool
+	NamespaceDefaults       bool
+	InlineValuesWarnSize    int
+	RejectLargeInlineValues bool
+	// ExternalizeInlineValues copies inline values exceeding the
+	// InlineValuesWarnSize to an operator managed Secret.
+	ExternalizeInlineValues bool
+	LiveDiff                bool
+	// ServerSideApply is the default for applying the resources of
+	// releases server-side, owned by the FieldManager.
+	ServerSideApply bool
+	FieldManager    string
+	DiffEvents      bool
+	WorkspaceQuota  int64
+	// HTTPTransport is the transport chart sources and external
+	// values are requested with, or nil for the default transport.
+	HTTPTransport    *http.Transport
+	Keyring          string
+	CosignKey        string
+	OssDecryptionKey []byte
+	// GitTimeout is the timeout of the clones of Git chart sources
+	// with clone options, which are cloned into the workspace.
+	GitTimeout time.Duration
+	// GitDefaultRef is the ref Git chart sources without a ref are
+	// cloned from.
+	GitDefaultRef string
+	// GitProviderCredentials restricts which HelmReleases may use the
+	// short-lived credentials of the code services, and the hosts
+	// they are obtained for.
+	GitProviderCredentials chartsync.GitProviderCredentials
+	// OssAmbientCredentials restricts which HelmReleases may access
+	// object storages with the credentials of the operator itself.
+	OssAmbientCredentials chartsync.AmbientCredentials
+	// MigrateOssCredentials moves encrypted inline object storage
+	// credentials to Secrets, decrypted with the OssDecryptionKey.
+	MigrateOssCredentials bool
+	PostRenderFailure     PostRenderFailurePolicy
+	// ChartDefaultsDrift reports changes to the chart default values
+	// which are ignored by upgrades reusing the release values.
+	ChartDefaultsDrift bool
+	// BackupLabels are set on HelmReleases and the Secrets managed by
+	// the operator, for Velero backups to select them.
+	BackupLabels map[string]string
+	// Freeze provides the release freeze windows during which upgrades
+	// are held; upgrades are never held if nil.
+	Freeze freeze.Provider
+	// Approval asks for the approval of upgrades; upgrades do not
+	// require approval if nil.
+	Approval *approval.Webhook
+	// Halt is the emergency halt switch holding all mutating Helm
+	// actions while it is set; actions are never held if nil.
+	Halt halt.Switch
+	// TargetClients are the Helm clients for the remote clusters of
+	// HelmReleases with a KubeConfig; these are not allowed if nil.
+	TargetClients *helm.TargetClients
+	// RemoteTargetServers are the host patterns the servers of the
+	// remote clusters must match; any host is allowed if empty.
+	RemoteTargetServers []string
+	// Vault reads the secrets of `vaultRef` values sources; these are
+	// not supported if nil.
+	Vault *vault.Client
+	// OPA evaluates the OPA decisions of the policy checks; these are
+	// not supported if nil.
+	OPA *opa.Client
+	// PolicyDecisions are the OPA decisions the rendered manifests of
+	// all releases are checked against.
+	PolicyDecisions []string
+	// Retry holds the default settings for retrying failed syncs, of
+	// which the retries of failed installs and upgrades are part.
+	Retry apiV1.Retry
 }
 
 // WithDefaults sets the default values for the release config.
@@ -42,95 +126,299 @@ func (c Config) WithDefaults() Config {
 	if c.ChartCache == "" {
 		c.ChartCache = "/tmp"
 	}
+	if c.FieldManager == "" {
+		c.FieldManager = "helm-operator"
+	}
+	if c.PostRenderFailure == "" {
+		c.PostRenderFailure = PostRenderFailureFallback
+	}
+	if c.GitTimeout == 0 {
+		c.GitTimeout = 20 * time.Second
+	}
+	if c.GitDefaultRef == "" {
+		c.GitDefaultRef = "master"
+	}
 	return c
 }
 
 // Release holds the elements required to perform a Helm release,
 // and provides the methods to perform a sync or uninstall.
 type Release struct {
-	logger       log.Logger
-	helmClients  *helm.Clients
-	coreV1Client corev1client.CoreV1Interface
-	hrClient     v1client.HelmV1Interface
-	gitChartSync *chartsync.GitChartSync
-	config       Config
-	converter    helmV3.Converter
+	logger        log.Logger
+	helmClients   *helm.Clients
+	coreV1Client  corev1client.CoreV1Interface
+	hrClient      v1client.HelmV1Interface
+	dynamicClient dynamic.Interface
+	restMapper    meta.RESTMapper
+	gitChartSync  *chartsync.GitChartSync
+	config        Config
+	converter     helmV3.Converter
+	recorder      record.EventRecorder
+	registry      *registry.Client
+	hooks         *releasehook.Dispatcher
+	notifier      *notify.Notifier
+	provenances   valuesProvenances
+	kubeConfigs   kubeConfigCache
 }
 
 // New returns a new instance of Release
 func New(logger log.Logger, helmClients *helm.Clients, coreV1Client corev1client.CoreV1Interface, hrClient v1client.HelmV1Interface,
-	gitChartSync *chartsync.GitChartSync, config Config, converter helmV3.Converter) *Release {
+	dynamicClient dynamic.Interface, restMapper meta.RESTMapper, gitChartSync *chartsync.GitChartSync, config Config,
+	converter helmV3.Converter) *Release {
 	r := &Release{
-		logger:       logger,
-		helmClients:  helmClients,
-		coreV1Client: coreV1Client,
-		hrClient:     hrClient,
-		gitChartSync: gitChartSync,
-		config:       config.WithDefaults(),
-		converter:    converter,
+		logger:        logger,
+		helmClients:   helmClients,
+		coreV1Client:  coreV1Client,
+		hrClient:      hrClient,
+		dynamicClient: dynamicClient,
+		restMapper:    restMapper,
+		gitChartSync:  gitChartSync,
+		config:        config.WithDefaults(),
+		converter:     converter,
+		registry:      registry.NewClient(nil),
+	}
+	// remove the workspaces of syncs interrupted by a restart
+	if err := chartsync.RemoveWorkspaces(r.config.ChartCache); err != nil {
+		logger.Log("warning", fmt.Sprintf("failed to remove stale workspaces: %v", err))
 	}
 	return r
 }
 
+// SetEventRecorder sets the recorder used to emit Events for the
+// HelmReleases.
+func (r *Release) SetEventRecorder(recorder record.EventRecorder) {
+	r.recorder = recorder
+}
+
 // Sync synchronizes the given HelmRelease with Helm.
 func (r *Release) Sync(hr *apiV1.HelmRelease) (err error) {
-	client, ok := r.helmClients.Load(hr.GetHelmVersion(r.config.DefaultHelmVersion))
-	if !ok {
+	client, err := r.HelmClient(hr)
+	if err != nil {
 		status.SetStatusPhase(r.hrClient.HelmReleases(hr.GetTargetNamespace()), hr, apiV1.HelmReleasePhaseFailed)
-		return fmt.Errorf("no client found for Helm '%s'", r.config.DefaultHelmVersion)
+		return err
 	}
 	logger := releaseLogger(r.logger, client, hr)
 
+	if err := status.SetSuspended(r.hrClient.HelmReleases(hr.Namespace), hr, false); err != nil {
+		logger.Log("warning", fmt.Sprintf("failed to remove suspended condition: %v", err))
+	}
+	if err := status.SetDependencyNotReady(r.hrClient.HelmReleases(hr.Namespace), hr, ""); err != nil {
+		logger.Log("warning", fmt.Sprintf("failed to remove dependency not ready condition: %v", err))
+	}
+
+	hr, err = r.applyValuesPatch(logger, hr)
+	if err != nil {
+		logger.Log("error", err)
+		return
+	}
+	if err = r.guardInlineValues(logger, hr); err != nil {
+		status.SetStatusPhaseWithMessage(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseFailed,
+			apiV1.ReasonInlineValuesTooLarge, err.Error())
+		err = ReasonError{apiV1.ReasonInlineValuesTooLarge, err}
+		logger.Log("error", err)
+		return
+	}
+	if updated, err := r.migrateOssCredentials(logger, hr); err != nil {
+		logger.Log("warning", err.Error())
+	} else {
+		hr = updated
+	}
+	if updated, err := r.ensureBackupLabels(hr); err != nil {
+		logger.Log("warning", fmt.Sprintf("failed to set backup labels: %v", err))
+	} else {
+		hr = updated
+	}
+
 	defer func(start time.Time) {
 		ObserveRelease(start, err == nil, hr.GetTargetNamespace(), hr.GetReleaseName())
 	}(time.Now())
+	// reconciled is the action the reconciliation started with
+	reconciled := PrepareAction
+	defer func(start time.Time) {
+		ObserveReconcile(start, reconciled, err, hr.GetTargetNamespace(), hr.GetReleaseName())
+	}(time.Now())
+	defer func() {
+		// held actions are not failures
+		if err != nil && Frozen(err) == nil && !Halted(err) {
+			r.notify(notify.Failed, hr, nil, err.Error())
+		}
+	}()
 	defer status.SetObservedGeneration(r.hrClient.HelmReleases(hr.Namespace), hr, hr.Generation)
+	if status.ReconcileRequested(hr) {
+		defer status.SetLastHandledReconcileAt(r.hrClient.HelmReleases(hr.Namespace), hr, hr.GetAnnotations()[apiV1.ReconcileAtAnnotation])
+	}
 
 	logger.Log("info", "starting sync run")
+	// a requested rollback does not depend on the chart, it is run
+	// before the chart is prepared so that releases can be rolled back
+	// while their chart source is broken
+	if requestedAction(hr) == RollbackAction {
+		reconciled = RollbackAction
+		return r.runRequestedAction(logger, client, RollbackAction, hr)
+	}
+	// ctx is the context of the sync run, the commands it runs are
+	// cancelled once it has finished
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	chart, cleanup, err := r.prepareChart(client, hr)
+	ws, err := chartsync.NewWorkspace(r.config.ChartCache, hr.Namespace+"_"+hr.Name, r.config.WorkspaceQuota, r.config.HTTPTransport)
 	if err != nil {
 		status.SetStatusPhase(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseChartFetchFailed)
-		err = fmt.Errorf("failed to prepare chart for release: %w", err)
+		err = fmt.Errorf("failed to create workspace for release: %w", err)
+		logger.Log("error", err)
+		return
+	}
+	defer func() {
+		if err := ws.Clean(); err != nil {
+			logger.Log("warning", fmt.Sprintf("failed to clean workspace: %v", err))
+		}
+	}()
+
+	chart, cleanup, err := r.prepareChart(client, hr, ws)
+	if err != nil {
+		status.SetStatusPhaseWithReason(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseChartFetchFailed, apiV1.ReasonChartPullBackOff)
+		err = ReasonError{apiV1.ReasonChartPullBackOff, fmt.Errorf("failed to prepare chart for release: %w", err)}
 		logger.Log("error", err)
 		return
 	}
 	if cleanup != nil {
 		defer cleanup()
 	}
+	logger = log.With(logger, "revision", chart.revision)
+	if hr.Spec.RepoChartSource != nil {
+		status.SetChartVersion(r.hrClient.HelmReleases(hr.Namespace), hr, chart.resolvedVersion)
+	}
+	if hr.Spec.Verify != nil {
+		if err = r.verifyChart(client, hr, chart, ws); err != nil {
+			status.SetStatusPhaseWithReason(r.hrClient.HelmReleases(hr.Namespace), hr,
+				apiV1.HelmReleasePhaseChartVerificationFailed, apiV1.ReasonChartVerificationFailed)
+			err = ReasonError{apiV1.ReasonChartVerificationFailed, err}
+			logger.Log("error", err)
+			return
+		}
+	}
+	if chart.chartPath, err = chartsync.ApplyOverlays(r.coreV1Client, hr.Namespace, ws, chart.chartPath, chart.repoDir, hr.Spec.OverlaysFrom); err != nil {
+		status.SetStatusPhaseWithReason(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseChartFetchFailed, apiV1.ReasonChartPullBackOff)
+		err = ReasonError{apiV1.ReasonChartPullBackOff, fmt.Errorf("failed to apply chart overlays for release: %w", err)}
+		logger.Log("error", err)
+		return
+	}
+	r.recordChartCommit(ctx, logger, hr, chart)
 	if chart.changed {
 		status.SetStatusPhase(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseChartFetched)
 	}
 
 	var values []byte
-	values, err = composeValues(r.coreV1Client, hr, chart.chartPath)
+	var layers []valuesLayer
+	values, layers, err = composeValuesLayers(r.coreV1Client, r.dynamicClient, r.restMapper, hr, chart, r.config)
 	if err != nil {
-		status.SetStatusPhase(r.hrClient.HelmReleases(hr.GetTargetNamespace()), hr, apiV1.HelmReleasePhaseFailed)
-		err = fmt.Errorf("failed to compose values for release: %w", err)
+		status.SetStatusPhaseWithReason(r.hrClient.HelmReleases(hr.GetTargetNamespace()), hr, apiV1.HelmReleasePhaseFailed, apiV1.ReasonValuesRenderError)
+		err = ReasonError{apiV1.ReasonValuesRenderError, fmt.Errorf("failed to compose values for release: %w", err)}
+		logger.Log("error", err)
+		return
+	}
+	r.recordValuesProvenance(logger, client, hr, chart, layers)
+	if err = r.validateValues(client, hr, chart, values); err != nil {
+		status.SetStatusPhaseWithMessage(r.hrClient.HelmReleases(hr.Namespace), hr,
+			apiV1.HelmReleasePhaseValuesValidationFailed, apiV1.ReasonValuesValidationFailed, err.Error())
+		err = ReasonError{apiV1.ReasonValuesValidationFailed, err}
+		logger.Log("error", err)
+		return
+	}
+	if err = r.lintChart(logger, client, hr, chart, values); err != nil {
+		status.SetStatusPhaseWithReason(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseFailed, apiV1.ReasonChartLintFailed)
+		err = ReasonError{apiV1.ReasonChartLintFailed, err}
 		logger.Log("error", err)
 		return
 	}
+	if err := status.SetSkipped(r.hrClient.HelmReleases(hr.Namespace), hr, "", ""); err != nil {
+		logger.Log("warning", fmt.Sprintf("failed to remove reconciling condition: %v", err))
+	}
+	if requested := requestedAction(hr); requested != "" {
+		reconciled = requested
+		return r.runRequestedAction(logger, client, requested, hr)
+	}
 	var action action
 	var curRel *helm.Release
 	action, curRel, err = r.determineSyncAction(client, hr, chart)
 	if err != nil {
-		status.SetStatusPhase(r.hrClient.HelmReleases(hr.GetTargetNamespace()), hr, apiV1.HelmReleasePhaseFailed)
+		if reason := Reason(err); reason != "" {
+			status.SetStatusPhaseWithReason(r.hrClient.HelmReleases(hr.GetTargetNamespace()), hr, apiV1.HelmReleasePhaseFailed, reason)
+		} else {
+			status.SetStatusPhase(r.hrClient.HelmReleases(hr.GetTargetNamespace()), hr, apiV1.HelmReleasePhaseFailed)
+		}
 		err = fmt.Errorf("failed to determine sync action for release: %w", err)
 		logger.Log("error", err)
 		return
 	}
+	reconciled = action
+	if dryRunRequested(hr) {
+		return r.preview(logger, client, action, hr, curRel, chart, values)
+	}
+	r.clearPreview(logger, hr)
 	return r.run(logger, client, action, hr, curRel, chart, values)
 }
 
+// Suspend records that the reconciliation of the given HelmRelease
+// is suspended.
+func (r *Release) Suspend(hr *apiV1.HelmRelease) error {
+	return status.SetSuspended(r.hrClient.HelmReleases(hr.Namespace), hr, true)
+}
+
+// SetFailures records the amount of consecutive failed syncs of the
+// given HelmRelease.
+func (r *Release) SetFailures(hr *apiV1.HelmRelease, failures int64) error {
+	return status.SetFailures(r.hrClient.HelmReleases(hr.Namespace), hr, failures)
+}
+
+// RecordPanic records that the sync of the given HelmRelease failed
+// with a panic, described by the given message.
+func (r *Release) RecordPanic(hr *apiV1.HelmRelease, message string) error {
+	return status.SetStatusPhaseWithMessage(r.hrClient.HelmReleases(hr.Namespace), hr,
+		apiV1.HelmReleasePhaseFailed, apiV1.ReasonSyncPanicked, message)
+}
+
+// Deleted returns if the given HelmRelease has been deleted from the
+// cluster. The informer also reports HelmReleases which left the
+// watched scope, e.g. by being relabeled, as deleted, so the
+// HelmRelease is looked up in the API rather than the cache; a
+// HelmRelease recreated with the same name counts as deleted.
+func (r *Release) Deleted(hr *apiV1.HelmRelease) (bool, error) {
+	var current *apiV1.HelmRelease
+	err := retry.OnError(retry.DefaultBackoff, isRetriable, func() (err error) {
+		current, err = r.hrClient.HelmReleases(hr.Namespace).Get(hr.Name, metav1.GetOptions{})
+		return err
+	})
+	switch {
+	case errors.IsNotFound(err):
+		return true, nil
+	case err != nil:
+		return false, err
+	}
+	return current.UID != hr.UID || current.DeletionTimestamp != nil, nil
+}
+
+// SetDependencyNotReady records that the given HelmRelease is waiting
+// for its dependencies.
+func (r *Release) SetDependencyNotReady(hr *apiV1.HelmRelease, reason error) error {
+	message := fmt.Sprintf(`Waiting for dependencies of Helm release '%s' in '%s': %s.`, hr.GetReleaseName(), hr.GetTargetNamespace(), reason)
+	return status.SetDependencyNotReady(r.hrClient.HelmReleases(hr.Namespace), hr, message)
+}
+
 // Uninstalls removes the Helm release for the given HelmRelease,
 // and the git chart source if present.
 func (r *Release) Uninstall(hr *apiV1.HelmRelease) error {
-	client, ok := r.helmClients.Load(hr.GetHelmVersion(r.config.DefaultHelmVersion))
-	if !ok {
-		return fmt.Errorf(`no client found for Helm '%s'`, r.config.DefaultHelmVersion)
+	client, err := r.uninstallClient(hr)
+	if err != nil {
+		return err
 	}
 	logger := releaseLogger(r.logger, client, hr)
-	return r.run(logger, client, UninstallAction, hr, nil, chart{}, nil)
+	r.provenances.remove(hr.Namespace, hr.Name)
+	if err := r.run(logger, client, UninstallAction, hr, nil, chart{}, nil); err != nil {
+		return err
+	}
+	r.kubeConfigs.remove(hr.Namespace, hr.Name)
+	return nil
 }
 
 // chart is a reference to a Helm chart used internally during the release.
@@ -138,19 +426,37 @@ type chart struct {
 	chartPath string
 	revision  string
 	changed   bool
+	// repoDir is the root of the Git repository of Git chart sources.
+	repoDir string
+	// values holds the values fetched along with the chart, i.e. the
+	// values file of an object storage source.
+	values helm.Values
+	// resolvedVersion is the version the version range of a Helm
+	// repository chart source resolved to.
+	resolvedVersion string
 }
 
 // prepareChart returns the chart for the configured chart source in
-// the given HelmRelease, or an error.
-func (r *Release) prepareChart(client helm.Client, hr *apiV1.HelmRelease) (chart, func() error, error) {
-	var chartPath, revision string
+// the given HelmRelease, or an error. Charts are fetched into the
+// given workspace, and must be within its size quota. The status of
+// the HelmRelease is left untouched.
+func (r *Release) prepareChart(client helm.Client, hr *apiV1.HelmRelease, ws *chartsync.Workspace) (chart, func() error, error) {
+	var chartPath, revision, resolved string
 	var changed bool
+	var values helm.Values
 	switch {
 	case hr.Spec.GitChartSource != nil && hr.Spec.GitURL != "" && hr.Spec.Path != "":
 		var export *git.Export
 		var err error
 
+		if opts := chartsync.CloneOptionsFor(hr.Spec.GitChartSource); opts.Key() != "" || chartsync.ProviderCredentials(hr.Spec.GitChartSource) {
+			chart, err := r.cloneGitChart(client, hr, ws, opts)
+			return chart, nil, err
+		}
+
+		start := time.Now()
 		export, revision, err = r.gitChartSync.GetMirrorCopy(hr)
+		chartsync.ObserveChartFetch(chartsync.SourceGit, start, err)
 		if err != nil {
 			return chart{}, nil, err
 		}
@@ -160,15 +466,26 @@ func (r *Release) prepareChart(client helm.Client, hr *apiV1.HelmRelease) (chart
 			return 0 < len(i)
 		}()
 		if r.config.UpdateDeps && !hr.Spec.GitChartSource.SkipDepUpdate {
-			if err := client.DependencyUpdate(chartPath); err != nil {
-				return chart{}, nil, err
-			}
+			err = updateDependencies(client, ws, chartPath)
+		} else {
+			err = ws.Check(chartPath)
+		}
+		if err != nil {
+			export.Clean()
+			return chart{}, nil, err
 		}
-		return chart{chartPath, revision, changed}, export.Clean, nil
+		return chart{chartPath, revision, changed, export.Dir(), nil, ""}, export.Clean, nil
 	case hr.Spec.RepoChartSource != nil && hr.Spec.RepoURL != "" && hr.Spec.Name != "" && hr.Spec.Version != "":
 		var err error
 
-		chartPath, _, err = chartsync.EnsureChartFetched(client, r.config.ChartCache, hr.Spec.RepoChartSource)
+		source, err := chartsync.ResolveChartVersion(client, r.coreV1Client, hr.Namespace, ws, hr.Spec.RepoChartSource)
+		if err != nil {
+			return chart{}, nil, err
+		}
+		if source != hr.Spec.RepoChartSource {
+			resolved = source.Version
+		}
+		chartPath, _, err = chartsync.EnsureChartFetched(client, r.coreV1Client, hr.Namespace, r.config.ChartCache, ws, source, hr.Spec.Verify != nil && !isOCISource(source))
 		if err != nil {
 			return chart{}, nil, err
 		}
@@ -180,7 +497,7 @@ func (r *Release) prepareChart(client helm.Client, hr *apiV1.HelmRelease) (chart
 	case hr.Spec.Customize != nil && hr.Spec.Customize.Key != "":
 		var err error
 
-		chartPath, err = chartsync.DownloadFile(hr.Spec.Customize.Key, r.config.ChartCache, hr.Spec.Customize.UseCache)
+		chartPath, err = chartsync.DownloadFile(hr.Spec.Customize.Key, hr.Spec.Customize.Checksum, r.config.ChartCache, ws, hr.Spec.Customize.UseCache)
 		if err != nil {
 			return chart{}, nil, err
 		}
@@ -193,7 +510,10 @@ func (r *Release) prepareChart(client helm.Client, hr *apiV1.HelmRelease) (chart
 	case hr.Spec.Oss != nil:
 		var err error
 
-		provider, err := chartsync.NewProvider(hr.Spec.Oss, r.config.ChartCache)
+		provider, err := chartsync.NewProvider(r.coreV1Client, hr.Namespace, hr.Spec.Oss, chartsync.ProviderConfig{
+			DecryptionKey: r.config.OssDecryptionKey,
+			Ambient:       r.config.OssAmbientCredentials,
+		}, r.config.ChartCache, ws)
 		if err != nil {
 			return chart{}, nil, err
 		}
@@ -207,11 +527,35 @@ func (r *Release) prepareChart(client helm.Client, hr *apiV1.HelmRelease) (chart
 		if err != nil {
 			return chart{}, nil, err
 		}
+		if hr.Spec.Oss.ValuesKey != "" {
+			valuesPath, err := provider.DownloadValuesFile(hr.Spec.Oss.UseCache)
+			if err != nil {
+				return chart{}, nil, err
+			}
+			var valuesRevision string
+			if values, valuesRevision, err = readValuesFile(valuesPath); err != nil {
+				return chart{}, nil, err
+			}
+			revision = revision + "+values." + valuesRevision
+		}
 		changed = hr.Status.LastAttemptedRevision != revision
 	default:
 		return chart{}, nil, fmt.Errorf("could not find valid chart source configuration for release")
 	}
-	return chart{chartPath, revision, changed}, nil, nil
+	return chart{chartPath, revision, changed, "", values, resolved}, nil, nil
+}
+
+// updateDependencies updates the dependencies of the chart at the
+// given path within the size quota of the workspace, which the chart
+// must be within before and after its dependencies are downloaded.
+func updateDependencies(client helm.Client, ws *chartsync.Workspace, chartPath string) error {
+	if err := ws.Check(chartPath); err != nil {
+		return err
+	}
+	if err := client.DependencyUpdate(chartPath); err != nil {
+		return err
+	}
+	return ws.Check(chartPath)
 }
 
 type action string
@@ -226,10 +570,18 @@ const (
 	DryRunCompareAction action = "dry-run-compare"
 	AnnotateAction      action = "annotate"
 	TestAction          action = "test"
+	RetainAction        action = "retain"
+	// PrepareAction is the action of reconciliations which failed
+	// before any other action was determined, e.g. to fetch the chart.
+	PrepareAction action = "prepare"
 )
 
 const (
 	MigrateAnnotation string = "helm.fluxcd.io/migrate"
+
+	// ReleaseMigrationFailed is the reason of the Event emitted when
+	// the 2to3 conversion of a release fails or times out.
+	ReleaseMigrationFailed = "ReleaseMigrationFailed"
 )
 
 // shouldSync determines if the given HelmRelease should be synced
@@ -276,23 +628,31 @@ func (r *Release) determineSyncAction(client helm.Client, hr *apiV1.HelmRelease,
 	// Check if the release is managed by our resource: if the release is
 	// appears to be managed by another `HelmRelease` resource, or an error
 	// is returned, we skip to avoid conflicts.
-	managedBy, antecedent, err := managedByHelmRelease(curRel, *hr)
+	dynamicClient, restMapper, err := r.objectClients(hr)
+	if err != nil {
+		return SkipAction, nil, fmt.Errorf("failed to determine ownership over release: %w", err)
+	}
+	managedBy, antecedent, err := managedByHelmRelease(dynamicClient, restMapper, curRel, *hr)
 	if err != nil {
 		return SkipAction, nil, fmt.Errorf("failed to determine ownership over release: %w", err)
 	}
 	if !managedBy {
-		return SkipAction, nil, fmt.Errorf("release appears to be managed by '%s'", antecedent)
+		err = fmt.Errorf("release appears to be managed by '%s'", antecedent)
+		r.RecordSkip(hr, SkippedOwnershipConflict, err)
+		return SkipAction, nil, ReasonError{apiV1.ReasonOwnershipConflict, err}
 	}
 
 	// If the current state of the release does not allow us to safely
 	// upgrade, we skip.
 	if s := curRel.Info.Status; !s.AllowsUpgrade() {
-		return SkipAction, nil, fmt.Errorf("status '%s' of release does not allow a safe upgrade", s.String())
+		err = fmt.Errorf("status '%s' of release does not allow a safe upgrade", s.String())
+		r.RecordSkip(hr, SkippedReleaseStatus, err)
+		return SkipAction, nil, ReasonError{apiV1.ReasonHelmUpgradeFailed, err}
 	}
 
 	// If this revision of the `HelmRelease` has not been synchronized
-	// yet, we attempt an upgrade.
-	if !status.HasSynced(hr) {
+	// yet, or a reconciliation has been requested, we attempt an upgrade.
+	if !status.HasSynced(hr) || status.ReconcileRequested(hr) {
 		return UpgradeAction, curRel, nil
 	}
 
@@ -314,6 +674,13 @@ func (r *Release) determineSyncAction(client helm.Client, hr *apiV1.HelmRelease,
 	} else if chart.changed {
 		return UpgradeAction, curRel, nil
 	}
+
+	// The dry-run comparison has been disabled for this release, as
+	// neither the chart nor the HelmRelease changed there is nothing
+	// to do.
+	if hr.Spec.SkipDryRunCompare {
+		return SkipAction, curRel, nil
+	}
 	return DryRunCompareAction, curRel, nil
 }
 
@@ -321,6 +688,12 @@ func (r *Release) determineSyncAction(client helm.Client, hr *apiV1.HelmRelease,
 func (r *Release) run(logger log.Logger, client helm.Client, action action, hr *apiV1.HelmRelease, curRel *helm.Release,
 	chart chart, values []byte) error {
 	var newRel *helm.Release
+	// dryRel, drift and missing hold the dry-run release, the drift of
+	// the live objects and the missing resources which caused an
+	// upgrade, for its approval
+	var dryRel *helm.Release
+	var drift string
+	var missing []string
 	errs := errCollection{}
 next:
 	var err error
@@ -330,11 +703,12 @@ next:
 		var diff string
 		newRel, diff, err = r.dryRunCompare(client, curRel, hr, chart, values)
 		if err != nil {
-			status.SetStatusPhase(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseFailed)
+			status.SetStatusPhaseWithReason(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseFailed, apiV1.ReasonValuesRenderError)
 			logger.Log("error", err, "phase", action)
-			errs = append(errs, fmt.Errorf("dry-run upgrade failed: %w", err))
+			errs = append(errs, ReasonError{apiV1.ReasonValuesRenderError, fmt.Errorf("dry-run upgrade failed: %w", err)})
 			break
 		}
+		r.recordImages(logger, hr, newRel)
 		if diff != "" {
 			switch r.config.LogDiffs {
 			case true:
@@ -342,25 +716,63 @@ next:
 			default:
 				logger.Log("info", "difference detected during release comparison", "phase", action)
 			}
+			r.recordDiff(logger, hr, chart, diff)
+			dryRel = newRel
+			action = UpgradeAction
+			goto next
+		}
+		// The release may be unchanged while the objects on the cluster
+		// have been mutated; compare against the live objects to detect
+		// this. This is skipped for rolled back releases, as `curRel`
+		// then refers to the failed release.
+		if r.config.LiveDiff && !status.HasRolledBack(hr) && !remoteTarget(hr) {
+			liveDiff, err := liveDrift(r.dynamicClient, r.restMapper, curRel)
+			if err != nil {
+				logger.Log("warning", fmt.Sprintf("failed to compare release with live objects: %v", err), "phase", action)
+			} else if liveDiff != "" {
+				switch r.config.LogDiffs {
+				case true:
+					logger.Log("info", "live objects drifted from release", "diff", liveDiff, "phase", action)
+				default:
+					logger.Log("info", "live objects drifted from release", "phase", action)
+				}
+				r.recordDiff(logger, hr, chart, liveDiff)
+				dryRel, drift = newRel, liveDiff
+				action = UpgradeAction
+				goto next
+			}
+		}
+		if missing = r.verifyInventory(logger, hr, curRel); len(missing) > 0 {
+			dryRel = newRel
 			action = UpgradeAction
 			goto next
 		}
 		if !status.HasRolledBack(hr) {
 			status.SetStatusPhase(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseSucceeded)
 		}
+		status.SetFrozenPendingChanges(r.hrClient.HelmReleases(hr.Namespace), hr, "")
+		status.SetHalted(r.hrClient.HelmReleases(hr.Namespace), hr, "")
 		logger.Log("info", "no changes", "phase", action)
 	case InstallAction:
+		if err = r.checkHalt(logger, action, hr); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		if err = r.preflightPlatform(logger, client, action, hr, curRel, chart, values); err != nil {
+			errs = append(errs, err)
+			break
+		}
 		logger.Log("info", "running installation", "phase", action)
 		newRel, err = r.install(client, hr, chart, values)
 		if err != nil {
 			logger.Log("error", err, "phase", action)
 			errs = append(errs, err)
 
-			action = UninstallAction
+			action = r.remediate(logger, hr, true)
 			goto next
 		}
 
-		logger.Log("info", "installation succeeded", "revision", chart.revision, "phase", action)
+		logger.Log("info", "installation succeeded", "phase", action)
 
 		action = TestAction
 		goto next
@@ -373,7 +785,13 @@ next:
 			dryRun = true
 			logger.Log("info", "running helm 2to3 conversion in dry-run mode")
 		}
-		newRel, err = r.migrate(client, hr, chart, dryRun)
+		if !dryRun {
+			if err = r.checkHalt(logger, action, hr); err != nil {
+				errs = append(errs, err)
+				break
+			}
+		}
+		newRel, err = r.migrate(logger, client, hr, chart, dryRun)
 
 		if err != nil {
 			status.SetStatusPhase(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseFailed)
@@ -390,18 +808,51 @@ next:
 		}
 		goto next
 	case UpgradeAction:
+		if err = r.checkHalt(logger, action, hr); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		if err = r.checkFreeze(logger, hr); err != nil {
+			logger.Log("info", err, "action", action)
+			errs = append(errs, err)
+			break
+		}
+		if err = r.checkApproval(logger, client, hr, curRel, dryRel, chart, values, drift, missing); err != nil {
+			logger.Log("error", err, "action", action)
+			errs = append(errs, err)
+			break
+		}
+		if r.config.CapacityCheck != CapacityCheckDisabled && !remoteTarget(hr) {
+			if err = r.checkUpgradeCapacity(client, hr, curRel, chart, values); err != nil {
+				if _, ok := err.(InsufficientCapacityError); ok && r.config.CapacityCheck == CapacityCheckBlock {
+					status.SetStatusPhase(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseFailed)
+					logger.Log("error", err, "action", action)
+					errs = append(errs, fmt.Errorf("capacity check failed: %w", err))
+					break
+				}
+				logger.Log("warning", err, "action", action)
+			}
+		}
+		if err = r.preflightPlatform(logger, client, action, hr, curRel, chart, values); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		if err := r.reportChartDefaultsDrift(logger, client, hr, curRel, chart, values); err != nil {
+			logger.Log("warning", fmt.Sprintf("failed to compare chart default values: %v", err), "action", action)
+		}
+
 		logger.Log("info", "running upgrade", "action", action)
-		newRel, err = r.upgrade(client, hr, chart, values)
+		newRel, err = r.upgrade(client, hr, curRel, chart, values)
 
 		if err != nil {
 			logger.Log("error", err, "action", action)
 			errs = append(errs, err)
 
-			action = RollbackAction
+			action = r.remediate(logger, hr, false)
 			goto next
 		}
 
-		logger.Log("info", "upgrade succeeded", "revision", chart.revision, "phase", action)
+		logger.Log("info", "upgrade succeeded", "phase", action)
 
 		action = TestAction
 		goto next
@@ -414,54 +865,92 @@ next:
 				errs = append(errs, err)
 
 				if !hr.Spec.Test.GetIgnoreFailures() {
-					if curRel == nil {
-						action = UninstallAction
-					} else {
-						action = RollbackAction
-					}
+					action = r.remediate(logger, hr, curRel == nil)
 					goto next
 				} else {
-					logger.Log("info", "test failed - ignoring failures", "revision", chart.revision)
+					logger.Log("info", "test failed - ignoring failures", "action", action)
 				}
 			} else {
-				logger.Log("info", "test succeeded", "revision", chart.revision, "action", action)
+				logger.Log("info", "test succeeded", "action", action)
 			}
 		}
 
 		status.SetStatusPhaseWithRevision(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseSucceeded, chart.revision)
+		if newRel != nil && newRel.Chart != nil {
+			status.SetLastAppliedChartVersion(r.hrClient.HelmReleases(hr.Namespace), hr, newRel.Chart.Version)
+		}
+		if curRel == nil {
+			r.fireReleaseHook(logger, releasehook.Install, hr, newRel)
+			r.notify(notify.Installed, hr, newRel, "installation succeeded")
+		} else {
+			r.fireReleaseHook(logger, releasehook.Upgrade, hr, newRel)
+			r.notify(notify.Upgraded, hr, newRel, "upgrade succeeded")
+		}
 
 		action = AnnotateAction
 		goto next
 	case AnnotateAction:
-		if err := annotate(hr, newRel); err != nil {
+		if err := r.annotate(hr, newRel); err != nil {
 			logger.Log("warning", err, "phase", action)
 		}
+		r.recordImages(logger, hr, newRel)
+		r.pruneResources(logger, hr, curRel, newRel)
+		r.recordInventory(logger, hr, newRel)
+		r.recordNotes(logger, hr, newRel)
+		r.recordHistory(logger, hr, newRel)
 	case RollbackAction:
-		if hr.Spec.Rollback.Enable {
-			latestRel, err := client.Get(hr.GetReleaseName(), helm.GetOptions{Namespace: hr.GetTargetNamespace(), Version: 0})
-			if err != nil {
-				err = fmt.Errorf("unable to determine if rollback should be performed: %w", err)
-				logger.Log("error", err, "phase", action)
+		latestRel, err := client.Get(hr.GetReleaseName(), helm.GetOptions{Namespace: hr.GetTargetNamespace(), Version: 0})
+		if err != nil {
+			err = fmt.Errorf("unable to determine if rollback should be performed: %w", err)
+			logger.Log("error", err, "phase", action)
+			errs = append(errs, err)
+			break
+		}
+		if curRel.Version < latestRel.Version {
+			if err = r.checkHalt(logger, action, hr); err != nil {
 				errs = append(errs, err)
 				break
 			}
-			if curRel.Version < latestRel.Version {
-				logger.Log("info", "running rollback", "phase", action)
-				if newRel, err = r.rollback(client, hr, chart.revision); err != nil {
-					errs = append(errs, err)
-					logger.Log("error", err, "phase", action)
-					break
-				}
-				logger.Log("info", "rollback succeeded", "phase", action)
+			logger.Log("info", "running rollback", "phase", action)
+			if newRel, err = r.rollback(client, hr, chart.revision, 0); err != nil {
+				errs = append(errs, err)
+				logger.Log("error", err, "phase", action)
+				break
+			}
+			logger.Log("info", "rollback succeeded", "phase", action)
+			r.notify(notify.RolledBack, hr, newRel, "rollback succeeded")
 
-				action = AnnotateAction
+			action = AnnotateAction
+			goto next
+		}
+	case SkipAction:
+		// Releases which skip the dry-run comparison are skipped with
+		// the current release, their inventory is still verified.
+		if curRel != nil {
+			if missing = r.verifyInventory(logger, hr, curRel); len(missing) > 0 {
+				action = UpgradeAction
 				goto next
 			}
 		}
+		logger.Log("info", "skipping release", "phase", action)
+	case RetainAction:
+		logger.Log("info", "retaining failed release", "phase", action)
 	case UninstallAction:
+		// The uninstall of a deleted HelmRelease is not held, as it
+		// would never be retried and orphan the release; only the
+		// cleanup of a failed install is.
+		if !errs.Empty() {
+			if err = r.checkHalt(logger, action, hr); err != nil {
+				errs = append(errs, err)
+				break
+			}
+		}
 		logger.Log("info", "running uninstall", "phase", action)
 		if err := uninstall(client, hr); err != nil {
 			logger.Log("warning", err, "phase", action)
+		} else if errs.Empty() {
+			// not a cleanup of a failed install
+			r.fireReleaseHook(logger, releasehook.Uninstall, hr, curRel)
 		}
 		if hr.Spec.GitChartSource != nil {
 			r.gitChartSync.Delete(hr)
@@ -563,7 +1052,7 @@ func (r *Release) deleteOldRes(client dynamic.Interface, resource schema.GroupVe
 		return err
 	}
 
-	//等待删除彻底成功
+	// wait for the deletion to complete
 	withTimeout, cancelFunc := context.WithTimeout(context.TODO(), 10*time.Second)
 	wait.UntilWithContext(withTimeout, func(context.Context) {
 		_, err := client.Resource(resource).Namespace(namespace).Get(name, metav1.GetOptions{})
@@ -575,12 +1064,20 @@ func (r *Release) deleteOldRes(client dynamic.Interface, resource schema.GroupVe
 }
 
 func (r *Release) istioInjectHandle(hr *apiV1.HelmRelease, client dynamic.Interface, resource schema.GroupVersionResource, target unstructured.Unstructured, istioInject bool) (unstructured.Unstructured, error) {
+	if remoteTarget(hr) {
+		// the deployed workloads of remote releases are not seen,
+		// inject as for new workloads
+		if istioInject {
+			target = r.istioInject(hr, target)
+		}
+		return target, nil
+	}
 	current, err := client.Resource(resource).Namespace(hr.Namespace).Get(target.GetName(), metav1.GetOptions{})
 	if err != nil {
 		if !errors.IsNotFound(err) {
 			return target, err
 		} else {
-			//工作负载不存在、istio注入
+			// the workload does not exist yet, inject if enabled
 			if istioInject {
 				target = r.istioInject(hr, target)
 			}
@@ -590,9 +1087,9 @@ func (r *Release) istioInjectHandle(hr *apiV1.HelmRelease, client dynamic.Interf
 	} else {
 		templateLabels, _, _ := unstructured.NestedStringMap(current.Object, templateLabelsPath...)
 		value, ok := templateLabels[IstioEnableLabelKey]
-		//开启服务网格
+		// the service mesh is enabled
 		if istioInject {
-			//若当前已部署的工作负载不存在istio注入标签，则删除当前已部署的工作负载
+			// delete the deployed workload if it lacks the Istio injection label
 			if !ok || value != IstioEnableLabelValue {
 				err := r.deleteOldRes(client, resource, target.GetNamespace(), target.GetName())
 				if err != nil {
@@ -601,7 +1098,7 @@ func (r *Release) istioInjectHandle(hr *apiV1.HelmRelease, client dynamic.Interf
 			}
 			return r.istioInject(hr, target), nil
 		} else {
-			//若关闭服务网格时，当前已部署的工作负载中有istio注入标签，则删除当前已部署的工作负载
+			// the service mesh is disabled, delete the deployed workload if it has the Istio injection label
 			if ok && value == IstioEnableLabelValue {
 				err := r.deleteOldRes(client, resource, target.GetNamespace(), target.GetName())
 				if err != nil {
@@ -613,24 +1110,28 @@ func (r *Release) istioInjectHandle(hr *apiV1.HelmRelease, client dynamic.Interf
 	}
 }
 
-func (r *Release) getAppManagerPostRenderer(hr *apiV1.HelmRelease) postrender.PostRenderer {
+// getAppManagerPostRenderer returns the built-in post-renderer, which
+// labels the workloads of the release for the app manager and injects
+// the Istio sidecar labels. Objects in the given installed objects keep
+// their injected values instead. Failures are handled according to the
+// configured post-render failure policy.
+func (r *Release) getAppManagerPostRenderer(hr *apiV1.HelmRelease, installed map[string]unstructured.Unstructured) postrender.PostRenderer {
 	return appManagerPostRenderer(func(renderedManifests *bytes.Buffer) (modifiedManifests *bytes.Buffer, err error) {
-		config, err := clientcmd.BuildConfigFromFlags("", "")
-		if err != nil {
-			klog.Error(err.Error())
-			return renderedManifests, nil
-		}
-
-		dynamicClient, err := dynamic.NewForConfig(config)
-		if err != nil {
-			klog.Error(err.Error())
-			return renderedManifests, nil
-		}
-
 		helmReleaseSpec := hr.Spec
 		unstructuredList := releaseManifestToUnstructured(renderedManifests.String())
 		modifiedManifests = bytes.NewBuffer([]byte{})
+		write := func(u unstructured.Unstructured) {
+			modifiedManifests.WriteString("---\n")
+			marshal, _ := yaml.Marshal(u.Object)
+			modifiedManifests.Write(marshal)
+			modifiedManifests.WriteString("\n")
+		}
+		var failed bool
 		for _, u := range unstructuredList {
+			if prev, ok := installed[injectionKey(u)]; ok {
+				write(keepInjected(u, prev))
+				continue
+			}
 
 			labels := u.GetLabels()
 			if labels == nil {
@@ -652,29 +1153,35 @@ func (r *Release) getAppManagerPostRenderer(hr *apiV1.HelmRelease) postrender.Po
 				u.SetAnnotations(annotations)
 			}
 
+			var resource schema.GroupVersionResource
 			switch u.GetKind() {
 			case "StatefulSet":
-				u = r.appInfoInject(hr, u)
-				istioInjectHandled, err := r.istioInjectHandle(hr, dynamicClient, statefulsetGroupVersionResource, u, helmReleaseSpec.IstioEnabled)
-				if err != nil {
-					klog.Error(err.Error())
-				}
-				u = istioInjectHandled
+				resource = statefulsetGroupVersionResource
 			case "Deployment":
+				resource = deploymentGroupVersionResource
+			}
+			if !resource.Empty() {
 				u = r.appInfoInject(hr, u)
-				istioInjectHandled, err := r.istioInjectHandle(hr, dynamicClient, deploymentGroupVersionResource, u, helmReleaseSpec.IstioEnabled)
+				istioInjectHandled, err := r.istioInjectHandle(hr, r.dynamicClient, resource, u, helmReleaseSpec.IstioEnabled)
 				if err != nil {
-					klog.Error(err.Error())
+					r.logger.Log("error", messages.Get(messages.IstioInjectionFailed, u.GetKind(), u.GetName(), err),
+						"release", hr.GetReleaseName(), "namespace", hr.Namespace, "targetNamespace", hr.GetTargetNamespace())
+					failed = true
+					if err := r.postRenderFailure(hr, postRenderIstioStage,
+						fmt.Errorf("%s '%s': %w", u.GetKind(), u.GetName(), err)); err != nil {
+						return nil, err
+					}
 				}
 				u = istioInjectHandled
 			}
 
-			modifiedManifests.WriteString("---\n")
-			marshal, _ := yaml.Marshal(u.Object)
-			modifiedManifests.Write(marshal)
-			modifiedManifests.WriteString("\n")
+			write(u)
 		}
-		klog.Info(modifiedManifests.String())
+		if !failed {
+			status.SetPostRenderFailed(r.hrClient.HelmReleases(hr.Namespace), hr, "")
+		}
+		r.logger.Log("debug", messages.Get(messages.PostRenderedManifests, hr.GetReleaseName(), modifiedManifests.String()),
+			"release", hr.GetReleaseName(), "namespace", hr.Namespace, "targetNamespace", hr.GetTargetNamespace())
 		return modifiedManifests, nil
 	})
 
@@ -688,7 +1195,7 @@ func (r *Release) install(client helm.Client, hr *apiV1.HelmRelease, chart chart
 		ObserveReleaseAction(start, InstallAction, err == nil, hr.GetTargetNamespace(), hr.GetReleaseName())
 	}(time.Now())
 	status.SetStatusPhaseWithRevision(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseInstalling, chart.revision)
-	rel, err = client.UpgradeFromPath(chart.chartPath, hr.GetReleaseName(), values, helm.UpgradeOptions{
+	opts := helm.UpgradeOptions{
 		Namespace:         hr.GetTargetNamespace(),
 		Timeout:           hr.GetTimeout(),
 		Install:           true,
@@ -696,29 +1203,63 @@ func (r *Release) install(client helm.Client, hr *apiV1.HelmRelease, chart chart
 		SkipCRDs:          hr.Spec.SkipCRDs,
 		MaxHistory:        hr.GetMaxHistory(),
 		Wait:              hr.GetWait(),
+		Atomic:            hr.Spec.Atomic,
+		WaitForJobs:       hr.Spec.WaitForJobs,
+		DisableHooks:      hr.Spec.DisableHooks,
+		SubNotes:          hr.Spec.SubNotes,
 		DisableValidation: hr.Spec.DisableOpenAPIValidation,
-		PostRenderer:      r.getAppManagerPostRenderer(hr),
-	})
+		PostRenderer:      r.getPostRenderer(hr, nil, false),
+		ServerSideApply:   hr.GetServerSideApply(r.config.ServerSideApply),
+		FieldManager:      r.config.FieldManager,
+		ChartAnnotations:  chartProvenance(hr, chart),
+		Progress:          r.reportWaitProgress(hr, apiV1.HelmReleasePhaseInstalling),
+	}
+	if err = r.checkUnrenderedPolicies(client, hr, chart, values, opts); err == nil {
+		rel, err = client.UpgradeFromPath(chart.chartPath, hr.GetReleaseName(), values, opts)
+	}
 	if err != nil {
-		status.SetStatusPhase(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseDeployFailed)
-		err = fmt.Errorf("installation failed: %w", err)
+		reason := apiV1.ReasonHelmInstallFailed
+		switch {
+		case isPolicyViolation(err):
+			reason = apiV1.ReasonPolicyViolation
+		case r.v2ReleaseExists(hr):
+			reason = apiV1.ReasonMigrationRequired
+		}
+		r.setDeployFailed(hr, reason, err)
+		err = ReasonError{reason, fmt.Errorf("installation failed: %w", err)}
 		return
 	}
 	status.SetStatusPhase(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseDeployed)
 	return
 }
 
+// v2ReleaseExists returns if a Helm v2 release exists for the given
+// Helm v3 HelmRelease, which prevents its installation until it has
+// been migrated.
+func (r *Release) v2ReleaseExists(hr *apiV1.HelmRelease) bool {
+	if hr.GetHelmVersion(r.config.DefaultHelmVersion) != string(apiV1.HelmV3) {
+		return false
+	}
+	exists, err := r.converter.V2ReleaseExists(hr.GetReleaseName())
+	return err == nil && exists
+}
+
 // migrate performs a migration with the given HelmRelease,
 // chart, and values while recording the phases on the HelmRelease.
 // It returns the release result or an error.
-func (r *Release) migrate(client helm.Client, hr *apiV1.HelmRelease, chart chart, dryRun bool) (rel *helm.Release, err error) {
+func (r *Release) migrate(logger log.Logger, client helm.Client, hr *apiV1.HelmRelease, chart chart, dryRun bool) (rel *helm.Release, err error) {
 	defer func(start time.Time) {
 		ObserveReleaseAction(start, MigrateAction, err == nil, hr.GetTargetNamespace(), hr.GetReleaseName())
 	}(time.Now())
 	status.SetStatusPhaseWithRevision(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseMigrating, chart.revision)
 
-	err = r.converter.Convert(hr.GetReleaseName(), dryRun)
+	err = r.converter.Convert(hr.GetReleaseName(), dryRun, func(line string) {
+		logger.Log("info", line, "phase", MigrateAction)
+	})
 	if err != nil {
+		if r.recorder != nil {
+			r.recorder.Event(hr, corev1.EventTypeWarning, ReleaseMigrationFailed, err.Error())
+		}
 		status.SetStatusPhase(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseFailed)
 		err = fmt.Errorf("installation failed: %w", err)
 		return
@@ -727,15 +1268,16 @@ func (r *Release) migrate(client helm.Client, hr *apiV1.HelmRelease, chart chart
 	return
 }
 
-// upgrade performs an upgrade with the given HelmRelease,
-// chart and values while recording the phases and revision on
-// the HelmRelease. It returns the release result or an error.
-func (r *Release) upgrade(client helm.Client, hr *apiV1.HelmRelease, chart chart, values []byte) (rel *helm.Release, err error) {
+// upgrade performs an upgrade of the given current release with the
+// given HelmRelease, chart and values while recording the phases and
+// revision on the HelmRelease. It returns the release result or an
+// error.
+func (r *Release) upgrade(client helm.Client, hr *apiV1.HelmRelease, curRel *helm.Release, chart chart, values []byte) (rel *helm.Release, err error) {
 	defer func(start time.Time) {
 		ObserveReleaseAction(start, UpgradeAction, err == nil, hr.GetTargetNamespace(), hr.GetReleaseName())
 	}(time.Now())
 	status.SetStatusPhaseWithRevision(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseUpgrading, chart.revision)
-	rel, err = client.UpgradeFromPath(chart.chartPath, hr.GetReleaseName(), values, helm.UpgradeOptions{
+	opts := helm.UpgradeOptions{
 		Namespace:         hr.GetTargetNamespace(),
 		Timeout:           hr.GetTimeout(),
 		Install:           false,
@@ -745,22 +1287,39 @@ func (r *Release) upgrade(client helm.Client, hr *apiV1.HelmRelease, chart chart
 		SkipCRDs:          hr.Spec.SkipCRDs,
 		MaxHistory:        hr.GetMaxHistory(),
 		Wait:              hr.GetWait(),
+		Atomic:            hr.Spec.Atomic,
+		CleanupOnFail:     hr.Spec.CleanupOnFail,
+		WaitForJobs:       hr.Spec.WaitForJobs,
+		DisableHooks:      hr.Spec.DisableHooks,
+		SubNotes:          hr.Spec.SubNotes,
 		DisableValidation: hr.Spec.DisableOpenAPIValidation,
-		PostRenderer:      r.getAppManagerPostRenderer(hr),
-	})
+		PostRenderer:      r.getPostRenderer(hr, curRel, false),
+		ServerSideApply:   hr.GetServerSideApply(r.config.ServerSideApply),
+		FieldManager:      r.config.FieldManager,
+		ChartAnnotations:  chartProvenance(hr, chart),
+		Progress:          r.reportWaitProgress(hr, apiV1.HelmReleasePhaseUpgrading),
+	}
+	if err = r.checkUnrenderedPolicies(client, hr, chart, values, opts); err == nil {
+		rel, err = client.UpgradeFromPath(chart.chartPath, hr.GetReleaseName(), values, opts)
+	}
 	if err != nil {
-		status.SetStatusPhase(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseDeployFailed)
-		err = fmt.Errorf("upgrade failed: %w", err)
+		reason := apiV1.ReasonHelmUpgradeFailed
+		if isPolicyViolation(err) {
+			reason = apiV1.ReasonPolicyViolation
+		}
+		r.setDeployFailed(hr, reason, err)
+		err = ReasonError{reason, fmt.Errorf("upgrade failed: %w", err)}
 		return
 	}
 	status.SetStatusPhase(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseDeployed)
 	return
 }
 
-// rollback performs a rollback for the given HelmRelease,
-// while recording the phases on  the HelmRelease. It returns
-// the release result or an error.
-func (r *Release) rollback(client helm.Client, hr *apiV1.HelmRelease, revision string) (rel *helm.Release, err error) {
+// rollback performs a rollback for the given HelmRelease to the
+// given version, or the previous version if it is zero, while
+// recording the phases on  the HelmRelease. It returns the release
+// result or an error.
+func (r *Release) rollback(client helm.Client, hr *apiV1.HelmRelease, revision string, version int) (rel *helm.Release, err error) {
 	defer func(start time.Time) {
 		ObserveReleaseAction(start, RollbackAction, err == nil, hr.GetTargetNamespace(), hr.GetReleaseName())
 	}(time.Now())
@@ -768,6 +1327,7 @@ func (r *Release) rollback(client helm.Client, hr *apiV1.HelmRelease, revision s
 	status.SetStatusPhase(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseRollingBack)
 	rel, err = client.Rollback(hr.GetReleaseName(), helm.RollbackOptions{
 		Namespace:    hr.GetTargetNamespace(),
+		Version:      version,
 		Timeout:      hr.Spec.Rollback.GetTimeout(),
 		Wait:         hr.Spec.Rollback.Wait,
 		DisableHooks: hr.Spec.Rollback.DisableHooks,
@@ -792,13 +1352,16 @@ func (r *Release) test(client helm.Client, hr *apiV1.HelmRelease) (err error) {
 	}(time.Now())
 	status.SetStatusPhase(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseTesting)
 	err = client.Test(hr.GetReleaseName(), helm.TestOptions{
-		Namespace: hr.GetTargetNamespace(),
-		Timeout:   hr.Spec.Test.GetTimeout(),
-		Cleanup:   hr.Spec.Test.GetCleanup(),
+		Namespace:    hr.GetTargetNamespace(),
+		Timeout:      hr.Spec.Test.GetTimeout(),
+		Cleanup:      hr.Spec.Test.GetCleanup(),
+		Filters:      hr.Spec.Test.Filters,
+		LogTailLines: hr.Spec.Test.GetLogTailLines(),
 	})
+	r.recordTestLogs(hr, err)
 	if err != nil {
-		status.SetStatusPhase(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseTestFailed)
-		err = fmt.Errorf("test failed: %w", err)
+		status.SetStatusPhaseWithReason(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseTestFailed, apiV1.ReasonTestFailed)
+		err = ReasonError{apiV1.ReasonTestFailed, fmt.Errorf("test failed: %w", err)}
 		return
 	}
 	status.SetStatusPhase(r.hrClient.HelmReleases(hr.Namespace), hr, apiV1.HelmReleasePhaseTested)
@@ -807,11 +1370,15 @@ func (r *Release) test(client helm.Client, hr *apiV1.HelmRelease) (err error) {
 
 // annotate annotates the given release resources on the cluster with
 // the resource ID of the given HelmRelease.
-func annotate(hr *apiV1.HelmRelease, rel *helm.Release) (err error) {
+func (r *Release) annotate(hr *apiV1.HelmRelease, rel *helm.Release) (err error) {
 	defer func(start time.Time) {
 		ObserveReleaseAction(start, AnnotateAction, err == nil, hr.GetTargetNamespace(), hr.GetReleaseName())
 	}(time.Now())
-	err = annotateResources(rel, hr.ResourceID())
+	dynamicClient, restMapper, err := r.objectClients(hr)
+	if err != nil {
+		return fmt.Errorf("failed to annotate release resources: %w", err)
+	}
+	err = annotateResources(dynamicClient, restMapper, rel, hr.ResourceID(), r.config.FieldManager)
 	if err != nil {
 		err = fmt.Errorf("failed to annotate release resources: %w", err)
 	}
@@ -823,9 +1390,11 @@ func uninstall(client helm.Client, hr *apiV1.HelmRelease) (err error) {
 		ObserveReleaseAction(start, UninstallAction, err == nil, hr.GetTargetNamespace(), hr.GetReleaseName())
 	}(time.Now())
 	err = client.Uninstall(hr.GetReleaseName(), helm.UninstallOptions{
-		Namespace:   hr.GetTargetNamespace(),
-		KeepHistory: false,
-		Timeout:     hr.GetTimeout(),
+		Namespace:           hr.GetTargetNamespace(),
+		DisableHooks:        hr.Spec.Uninstall.DisableHooks,
+		KeepHistory:         hr.Spec.Uninstall.KeepHistory,
+		Timeout:             hr.Spec.Uninstall.GetTimeout(hr.GetTimeout()),
+		DeletionPropagation: deletionPropagation(hr.Spec.Uninstall.DeletionPropagation),
 	})
 	if err != nil {
 		err = fmt.Errorf("uninstall failed: %w", err)
@@ -833,11 +1402,26 @@ func uninstall(client helm.Client, hr *apiV1.HelmRelease) (err error) {
 	return
 }
 
+// deletionPropagation returns the Kubernetes propagation policy for
+// the given deletion propagation of an uninstall.
+func deletionPropagation(p apiV1.DeletionPropagation) string {
+	switch p {
+	case apiV1.DeletionPropagationForeground:
+		return string(metav1.DeletePropagationForeground)
+	case apiV1.DeletionPropagationOrphan:
+		return string(metav1.DeletePropagationOrphan)
+	case apiV1.DeletionPropagationBackground:
+		return string(metav1.DeletePropagationBackground)
+	}
+	return ""
+}
+
 // releaseLogger returns a logger in the context of the given
 // HelmRelease (that being, with metadata included).
 func releaseLogger(logger log.Logger, client helm.Client, hr *apiV1.HelmRelease) log.Logger {
 	return log.With(logger,
 		"release", hr.GetReleaseName(),
+		"namespace", hr.Namespace,
 		"targetNamespace", hr.GetTargetNamespace(),
 		"resource", hr.ResourceID().String(),
 		"helmVersion", client.Version(),
@@ -0,0 +1,133 @@
+package release
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/chartsync"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+// dependencyHelmClient writes a dependency of the given size into the
+// charts directory of the chart on a dependency update.
+type dependencyHelmClient struct {
+	helm.Client
+	size    int
+	updated bool
+}
+
+func (c *dependencyHelmClient) DependencyUpdate(chartPath string) error {
+	c.updated = true
+	if err := os.MkdirAll(filepath.Join(chartPath, "charts"), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(chartPath, "charts", "dep.tgz"), make([]byte, c.size), 0600)
+}
+
+func TestUpdateDependencies(t *testing.T) {
+	base, err := ioutil.TempDir("", "update-dependencies")
+	assert.NoError(t, err)
+	defer os.RemoveAll(base)
+
+	newChart := func(size int) string {
+		chartPath, err := ioutil.TempDir(base, "chart")
+		assert.NoError(t, err)
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(chartPath, "Chart.yaml"), make([]byte, size), 0600))
+		return chartPath
+	}
+	ws, err := chartsync.NewWorkspace(base, "test", 1024, nil)
+	assert.NoError(t, err)
+
+	client := &dependencyHelmClient{size: 512}
+	assert.NoError(t, updateDependencies(client, ws, newChart(256)))
+	assert.True(t, client.updated)
+
+	// the downloaded dependencies exceed the quota
+	client = &dependencyHelmClient{size: 1024}
+	assert.IsType(t, chartsync.QuotaExceededError{}, updateDependencies(client, ws, newChart(256)))
+
+	// dependencies are not downloaded for a chart exceeding the quota
+	client = &dependencyHelmClient{}
+	assert.IsType(t, chartsync.QuotaExceededError{}, updateDependencies(client, ws, newChart(2048)))
+	assert.False(t, client.updated)
+}
+
+// uninstallHelmClient records the options of an uninstall.
+type uninstallHelmClient struct {
+	helm.Client
+	opts        helm.UninstallOptions
+	uninstalled bool
+}
+
+func (c *uninstallHelmClient) Uninstall(releaseName string, opts helm.UninstallOptions) error {
+	c.opts = opts
+	c.uninstalled = true
+	return nil
+}
+
+func TestUninstallOptions(t *testing.T) {
+	timeout := int64(60)
+	hr := &apiV1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "podinfo"},
+		Spec:       apiV1.HelmReleaseSpec{TargetNamespace: "apps"},
+	}
+	client := &uninstallHelmClient{}
+	assert.NoError(t, uninstall(client, hr))
+	assert.Equal(t, helm.UninstallOptions{Namespace: "apps", Timeout: hr.GetTimeout()}, client.opts)
+
+	hr.Spec.Uninstall = apiV1.Uninstall{
+		KeepHistory:         true,
+		DisableHooks:        true,
+		DeletionPropagation: apiV1.DeletionPropagationForeground,
+		Timeout:             &timeout,
+	}
+	assert.NoError(t, uninstall(client, hr))
+	assert.Equal(t, helm.UninstallOptions{
+		Namespace:           "apps",
+		DisableHooks:        true,
+		KeepHistory:         true,
+		Timeout:             time.Minute,
+		DeletionPropagation: "Foreground",
+	}, client.opts)
+}
+
+func TestDeletionPropagation(t *testing.T) {
+	for p, want := range map[apiV1.DeletionPropagation]string{
+		"":                                  "",
+		apiV1.DeletionPropagationBackground: "Background",
+		apiV1.DeletionPropagationForeground: "Foreground",
+		apiV1.DeletionPropagationOrphan:     "Orphan",
+	} {
+		assert.Equal(t, want, deletionPropagation(p), string(p))
+	}
+}
+
+func TestDeleted(t *testing.T) {
+	hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "podinfo", UID: "1"}}
+	client := ifclientsetfake.NewSimpleClientset(hr)
+	r := &Release{hrClient: client.HelmV1()}
+
+	// a HelmRelease which left the watched scope still exists
+	deleted, err := r.Deleted(hr)
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+
+	recreated := hr.DeepCopy()
+	recreated.UID = "2"
+	deleted, err = r.Deleted(recreated)
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+
+	assert.NoError(t, client.HelmV1().HelmReleases("default").Delete("podinfo", &metav1.DeleteOptions{}))
+	deleted, err = r.Deleted(hr)
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+}
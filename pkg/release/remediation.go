@@ -0,0 +1,43 @@
+package release
+
+import (
+	"fmt"
+
+	"github.com/go-kit/kit/log"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+// remediate returns the action remediating a failed install or upgrade
+// of the HelmRelease according to its remediation policy. The failure
+// fails the sync, so it counts against the retries of failed syncs of
+// the HelmRelease; there is no separate budget for failed releases.
+func (r *Release) remediate(logger log.Logger, hr *apiV1.HelmRelease, install bool) action {
+	policy := hr.GetUpgradeRemediation()
+	if install {
+		policy = hr.GetInstallRemediation()
+	}
+	failures := int64(1)
+	if status.IsRetry(hr) {
+		failures = hr.Status.Failures + 1
+	}
+	exhausted := hr.GetRetry(r.config.Retry).Exhausted(failures)
+	if exhausted {
+		logger.Log("info", fmt.Sprintf("retries exhausted after %d failures", failures), "strategy", policy.Strategy)
+	}
+	if hr.Spec.Atomic {
+		// Helm has uninstalled or rolled back the release already
+		return RetainAction
+	}
+	if !policy.ShouldRemediate(exhausted) {
+		return RetainAction
+	}
+	switch policy.Strategy {
+	case apiV1.RemediationUninstall:
+		return UninstallAction
+	case apiV1.RemediationRollback:
+		return RollbackAction
+	}
+	return RetainAction
+}
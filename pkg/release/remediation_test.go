@@ -0,0 +1,78 @@
+package release
+
+import (
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+func TestRemediate(t *testing.T) {
+	one := int64(1)
+	rollback := &apiV1.Remediation{Upgrade: &apiV1.RemediationPolicy{Strategy: apiV1.RemediationRollback}}
+	for _, tc := range []struct {
+		name    string
+		spec    apiV1.HelmReleaseSpec
+		status  apiV1.HelmReleaseStatus
+		install bool
+		want    action
+	}{
+		{name: "install default", install: true, want: UninstallAction},
+		{name: "upgrade default", want: RetainAction},
+		{name: "upgrade with rollback enabled", spec: apiV1.HelmReleaseSpec{Rollback: apiV1.Rollback{Enable: true}},
+			want: RollbackAction},
+		{name: "install atomic", spec: apiV1.HelmReleaseSpec{Atomic: true}, install: true, want: RetainAction},
+		{name: "install retained",
+			spec:    apiV1.HelmReleaseSpec{Remediation: &apiV1.Remediation{Install: &apiV1.RemediationPolicy{Strategy: apiV1.RemediationRetain}}},
+			install: true, want: RetainAction},
+		{name: "upgrade uninstalled",
+			spec: apiV1.HelmReleaseSpec{Remediation: &apiV1.Remediation{Upgrade: &apiV1.RemediationPolicy{Strategy: apiV1.RemediationUninstall}}},
+			want: UninstallAction},
+		{name: "retry",
+			spec:   apiV1.HelmReleaseSpec{Remediation: rollback, Retry: &apiV1.Retry{MaxRetries: &one}},
+			status: apiV1.HelmReleaseStatus{ObservedGeneration: 1, Failures: 0},
+			want:   RollbackAction},
+		{name: "last failure retained",
+			spec:   apiV1.HelmReleaseSpec{Remediation: rollback, Retry: &apiV1.Retry{MaxRetries: &one}},
+			status: apiV1.HelmReleaseStatus{ObservedGeneration: 1, Failures: 1},
+			want:   RetainAction},
+		{name: "last failure remediated",
+			spec: apiV1.HelmReleaseSpec{
+				Remediation: &apiV1.Remediation{Upgrade: &apiV1.RemediationPolicy{Strategy: apiV1.RemediationRollback, RemediateLastFailure: true}},
+				Retry:       &apiV1.Retry{MaxRetries: &one},
+			},
+			status: apiV1.HelmReleaseStatus{ObservedGeneration: 1, Failures: 1},
+			want:   RollbackAction},
+		{name: "failures of previous generation reset",
+			spec:   apiV1.HelmReleaseSpec{Remediation: rollback, Retry: &apiV1.Retry{MaxRetries: &one}},
+			status: apiV1.HelmReleaseStatus{ObservedGeneration: 0, Failures: 1},
+			want:   RollbackAction},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hr := &apiV1.HelmRelease{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "podinfo", Generation: 1},
+				Spec:       tc.spec,
+				Status:     tc.status,
+			}
+			r := &Release{}
+			assert.Equal(t, tc.want, r.remediate(log.NewNopLogger(), hr, tc.install))
+		})
+	}
+}
+
+func TestRemediateDefaultRetries(t *testing.T) {
+	two := int64(2)
+	hr := &apiV1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "podinfo", Generation: 1},
+		Spec:       apiV1.HelmReleaseSpec{Rollback: apiV1.Rollback{Enable: true}},
+		Status:     apiV1.HelmReleaseStatus{ObservedGeneration: 1, Failures: 2},
+	}
+	r := &Release{config: Config{Retry: apiV1.Retry{MaxRetries: &two}}}
+	assert.Equal(t, RetainAction, r.remediate(log.NewNopLogger(), hr, false))
+
+	hr.Status.Failures = 1
+	assert.Equal(t, RollbackAction, r.remediate(log.NewNopLogger(), hr, false))
+}
@@ -0,0 +1,88 @@
+package release
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"sigs.k8s.io/yaml"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+// defaultSchemaKey is the key of the schema in the ConfigMap
+// referenced by the values schema source if no key is given.
+const defaultSchemaKey = "values.schema.json"
+
+// validateValues validates the composed values of the given
+// HelmRelease against the JSON schemas of its chart, and the schema
+// referenced by the HelmRelease, before they are used to render the
+// chart. The returned error describes all violations.
+func (r *Release) validateValues(client helm.Client, hr *apiV1.HelmRelease, chart chart, values []byte) error {
+	schemas, err := valuesSchemas(r.coreV1Client, hr, r.config)
+	if err != nil {
+		return err
+	}
+	if err := client.ValidateValues(chart.chartPath, values, helm.ValidateOptions{Schemas: schemas}); err != nil {
+		return fmt.Errorf("values do not meet the schema: %w", err)
+	}
+	return nil
+}
+
+// valuesSchemas returns the schema referenced by the values schema
+// source of the given HelmRelease as JSON, by the name of its source.
+// It returns no schemas if the HelmRelease references none, or the
+// referenced optional external source can not be read.
+func valuesSchemas(coreV1Client corev1client.CoreV1Interface, hr *apiV1.HelmRelease, config Config) (map[string][]byte, error) {
+	s := hr.Spec.ValuesSchemaFrom
+	if s == nil {
+		return nil, nil
+	}
+
+	var b []byte
+	var source string
+	switch {
+	case s.ConfigMapKeyRef != nil:
+		cm := s.ConfigMapKeyRef
+		ns := hr.Namespace
+		if cm.Namespace != "" {
+			ns = cm.Namespace
+		}
+		if ns != hr.Namespace && !config.CrossNamespaceValues {
+			return nil, fmt.Errorf("reference to ConfigMap %s/%s is not allowed, cross-namespace values are disabled", ns, cm.Name)
+		}
+		key := cm.Key
+		if key == "" {
+			key = defaultSchemaKey
+		}
+		source = fmt.Sprintf("ConfigMap %s/%s:%s", ns, cm.Name, key)
+		configMap, err := coreV1Client.ConfigMaps(ns).Get(cm.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get values schema: %w", err)
+		}
+		d, ok := configMap.Data[key]
+		if !ok {
+			return nil, fmt.Errorf("could not find key %v in ConfigMap %s/%s", key, ns, cm.Name)
+		}
+		b = []byte(d)
+	case s.ExternalSourceRef != nil:
+		es := s.ExternalSourceRef
+		source = "URL " + es.URL
+		var err error
+		if b, err = readExternalSource(coreV1Client, hr.Namespace, es, config.ChartCache, config.HTTPTransport); err != nil {
+			if es.Optional != nil && *es.Optional {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unable to read values schema from URL %s: %w", es.URL, err)
+		}
+	default:
+		return nil, nil
+	}
+
+	schema, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid values schema in %s: %w", source, err)
+	}
+	return map[string][]byte{source: schema}, nil
+}
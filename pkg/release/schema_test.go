@@ -0,0 +1,89 @@
+package release
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+	helmV3 "github.com/lstack-org/helm-operator/pkg/helm/v3"
+)
+
+func TestValuesSchemas(t *testing.T) {
+	coreV1Client := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "flux", Name: "schemas"},
+		Data: map[string]string{
+			"values.schema.json": `{"required": ["replicaCount"]}`,
+			"app.yaml":           "required:\n- image\n",
+		},
+	}).CoreV1()
+	optional := true
+	for _, tc := range []struct {
+		name    string
+		source  *apiV1.ValuesSchemaSource
+		config  Config
+		want    map[string][]byte
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "default key", source: &apiV1.ValuesSchemaSource{ConfigMapKeyRef: &apiV1.ConfigMapKeySelector{
+			LocalObjectReference: apiV1.LocalObjectReference{Name: "schemas"},
+		}}, want: map[string][]byte{"ConfigMap flux/schemas:values.schema.json": []byte(`{"required":["replicaCount"]}`)}},
+		{name: "YAML schema", source: &apiV1.ValuesSchemaSource{ConfigMapKeyRef: &apiV1.ConfigMapKeySelector{
+			LocalObjectReference: apiV1.LocalObjectReference{Name: "schemas"}, Key: "app.yaml",
+		}}, want: map[string][]byte{"ConfigMap flux/schemas:app.yaml": []byte(`{"required":["image"]}`)}},
+		{name: "missing key", source: &apiV1.ValuesSchemaSource{ConfigMapKeyRef: &apiV1.ConfigMapKeySelector{
+			LocalObjectReference: apiV1.LocalObjectReference{Name: "schemas"}, Key: "missing.json",
+		}}, wantErr: true},
+		{name: "cross-namespace", source: &apiV1.ValuesSchemaSource{ConfigMapKeyRef: &apiV1.ConfigMapKeySelector{
+			LocalObjectReference: apiV1.LocalObjectReference{Name: "schemas"}, Namespace: "other",
+		}}, wantErr: true},
+		{name: "optional external source", source: &apiV1.ValuesSchemaSource{ExternalSourceRef: &apiV1.ExternalSourceSelector{
+			URL: "http://127.0.0.1:1/schema.json", Optional: &optional,
+		}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hr := &apiV1.HelmRelease{Spec: apiV1.HelmReleaseSpec{ValuesSchemaFrom: tc.source}}
+			hr.Namespace = "flux"
+			schemas, err := valuesSchemas(coreV1Client, hr, tc.config)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, schemas)
+		})
+	}
+}
+
+func TestValidateValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "validate-values")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{
+		"Chart.yaml":         "apiVersion: v2\nname: app\nversion: 1.0.0\n",
+		"values.yaml":        "replicaCount: 1\n",
+		"values.schema.json": `{"properties": {"replicaCount": {"type": "integer", "minimum": 1}}}`,
+	} {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	client := &helmV3.HelmV3{}
+	schemas := map[string][]byte{"ConfigMap flux/schemas:values.schema.json": []byte(`{"required": ["image"]}`)}
+
+	assert.NoError(t, client.ValidateValues(dir, []byte("image: nginx\n"), helm.ValidateOptions{Schemas: schemas}))
+	// the default values of the chart are validated as well
+	assert.NoError(t, client.ValidateValues(dir, nil, helm.ValidateOptions{}))
+
+	err = client.ValidateValues(dir, []byte("replicaCount: 0\n"), helm.ValidateOptions{Schemas: schemas})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "app:\n- replicaCount: Must be greater than or equal to 1")
+		assert.Contains(t, err.Error(), "ConfigMap flux/schemas:values.schema.json:\n- (root): image is required")
+	}
+}
@@ -0,0 +1,47 @@
+package release
+
+import (
+	"fmt"
+
+	"helm.sh/helm/v3/pkg/strvals"
+	"sigs.k8s.io/yaml"
+
+	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+// applySetValues returns a copy of the values with the given values
+// set at their paths, in order, with the coercion of the `--set` and
+// `--set-string` flags of Helm. The values are copied first, as the
+// merged values share maps with the values of their sources.
+func applySetValues(values helm.Values, setValues []v1.SetValue) (helm.Values, error) {
+	if len(setValues) == 0 {
+		return values, nil
+	}
+	b, err := values.YAML()
+	if err != nil {
+		return nil, err
+	}
+	result := helm.Values{}
+	if err := yaml.Unmarshal(b, &result); err != nil {
+		return nil, err
+	}
+	for i, sv := range setValues {
+		if sv.Path == "" {
+			return nil, fmt.Errorf("setValues[%d] has no path", i)
+		}
+		s := sv.Path + "=" + sv.Value
+		switch sv.Type {
+		case "", v1.SetValueAuto:
+			err = strvals.ParseInto(s, result)
+		case v1.SetValueString:
+			err = strvals.ParseIntoString(s, result)
+		default:
+			err = fmt.Errorf("unknown type '%s'", sv.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to set value at path '%s': %w", sv.Path, err)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,27 @@
+package release
+
+import (
+	"fmt"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+// The reasons a sync is skipped for, as recorded in the metrics and
+// the Reconciling condition.
+const (
+	SkippedLockContention    = "LockContention"
+	SkippedReleaseStatus     = "ReleaseStatusPreventsUpgrade"
+	SkippedOwnershipConflict = apiV1.ReasonOwnershipConflict
+	SkippedRestoreInProgress = "RestoreInProgress"
+	SkippedRetriesExhausted  = "RetriesExhausted"
+)
+
+// RecordSkip records that the sync of the given HelmRelease has been
+// skipped for the given reason, in the metrics and the Reconciling
+// condition.
+func (r *Release) RecordSkip(hr *apiV1.HelmRelease, reason string, cause error) error {
+	ObserveSkippedSync(reason, hr.GetTargetNamespace(), hr.GetReleaseName())
+	message := fmt.Sprintf(`Sync of Helm release '%s' in '%s' skipped: %s.`, hr.GetReleaseName(), hr.GetTargetNamespace(), cause)
+	return status.SetSkipped(r.hrClient.HelmReleases(hr.Namespace), hr, reason, message)
+}
@@ -0,0 +1,34 @@
+package release
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+func TestRecordSkip(t *testing.T) {
+	hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "podinfo"}}
+	client := ifclientsetfake.NewSimpleClientset(hr)
+	r := &Release{hrClient: client.HelmV1()}
+
+	assert.NoError(t, r.RecordSkip(hr, SkippedOwnershipConflict, fmt.Errorf("release appears to be managed by 'other'")))
+	updated, err := client.HelmV1().HelmReleases(hr.Namespace).Get(hr.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	c := status.GetCondition(updated.Status, apiV1.HelmReleaseReconciling)
+	if assert.NotNil(t, c) {
+		assert.Equal(t, apiV1.ConditionFalse, c.Status)
+		assert.Equal(t, SkippedOwnershipConflict, c.Reason)
+		assert.Contains(t, c.Message, "managed by 'other'")
+	}
+
+	assert.NoError(t, status.SetSkipped(client.HelmV1().HelmReleases(hr.Namespace), updated, "", ""))
+	updated, err = client.HelmV1().HelmReleases(hr.Namespace).Get(hr.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Nil(t, status.GetCondition(updated.Status, apiV1.HelmReleaseReconciling))
+}
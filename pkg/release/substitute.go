@@ -0,0 +1,115 @@
+package release
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+// variablePattern matches `${var}` and `${var:=default}` variables,
+// and variables escaped as `$${var}`.
+var variablePattern = regexp.MustCompile(`\$(\$?)\{([_a-zA-Z][_a-zA-Z0-9]*)(:=([^}]*))?\}`)
+
+// substitutionVariables returns the variables of the post-build
+// substitution of the given HelmRelease, from the referenced ConfigMaps
+// and Secrets in order, overridden by the inline variables.
+func substitutionVariables(coreV1Client corev1client.CoreV1Interface, hr *apiV1.HelmRelease) (map[string]string, error) {
+	vars := make(map[string]string)
+	for _, ref := range hr.Spec.PostBuild.SubstituteFrom {
+		switch ref.Kind {
+		case "ConfigMap":
+			cm, err := coreV1Client.ConfigMaps(hr.Namespace).Get(ref.Name, metav1.GetOptions{})
+			if err != nil {
+				if errors.IsNotFound(err) && ref.Optional {
+					continue
+				}
+				return nil, fmt.Errorf("failed to get substitution variables from ConfigMap %s/%s: %w", hr.Namespace, ref.Name, err)
+			}
+			for k, v := range cm.Data {
+				vars[k] = v
+			}
+		case "Secret":
+			secret, err := coreV1Client.Secrets(hr.Namespace).Get(ref.Name, metav1.GetOptions{})
+			if err != nil {
+				if errors.IsNotFound(err) && ref.Optional {
+					continue
+				}
+				return nil, fmt.Errorf("failed to get substitution variables from Secret %s/%s: %w", hr.Namespace, ref.Name, err)
+			}
+			for k, v := range secret.Data {
+				vars[k] = string(v)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported kind '%s' of substitution variables %s", ref.Kind, ref.Name)
+		}
+	}
+	for k, v := range hr.Spec.PostBuild.Substitute {
+		vars[k] = v
+	}
+	return vars, nil
+}
+
+// substitute replaces the variables in b with their values, or their
+// defaults if not set. Variables without a value or default are left
+// as is, and escaped variables are unescaped.
+func substitute(b []byte, vars map[string]string) []byte {
+	return variablePattern.ReplaceAllFunc(b, func(match []byte) []byte {
+		m := variablePattern.FindSubmatch(match)
+		if len(m[1]) > 0 {
+			return match[1:]
+		}
+		if v, ok := vars[string(m[2])]; ok {
+			return []byte(v)
+		}
+		if len(m[3]) > 0 {
+			return m[4]
+		}
+		return match
+	})
+}
+
+// substituteValues returns a copy of the given values, in which the
+// variables in the string values are substituted. Keys and the values
+// of other types are kept as is, so the values of the variables can not
+// change the structure of the values.
+func substituteValues(v interface{}, vars map[string]string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = substituteValues(e, vars)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, e := range v {
+			l[i] = substituteValues(e, vars)
+		}
+		return l
+	case string:
+		return string(substitute([]byte(v), vars))
+	default:
+		return v
+	}
+}
+
+// substitutePostRenderer substitutes the post-build variables of a
+// HelmRelease in the rendered manifests.
+type substitutePostRenderer struct {
+	coreV1Client corev1client.CoreV1Interface
+	hr           *apiV1.HelmRelease
+}
+
+func (p substitutePostRenderer) Run(renderedManifests *bytes.Buffer) (*bytes.Buffer, error) {
+	vars, err := substitutionVariables(p.coreV1Client, p.hr)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewBuffer(substitute(renderedManifests.Bytes(), vars)), nil
+}
@@ -0,0 +1,110 @@
+package release
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/yaml"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+func TestSubstitute(t *testing.T) {
+	vars := map[string]string{"cluster": "prod", "empty": ""}
+	for in, out := range map[string]string{
+		"name: ${cluster}":               "name: prod",
+		"name: ${cluster}-${cluster}":    "name: prod-prod",
+		"name: ${empty}":                 "name: ",
+		"region: ${region:=eu-west-1}":   "region: eu-west-1",
+		"name: ${cluster:=dev}":          "name: prod",
+		"name: ${unset}":                 "name: ${unset}",
+		"name: $${cluster}":              "name: ${cluster}",
+		"script: echo $HOME ${1}":        "script: echo $HOME ${1}",
+		"name: ${cluster name}":          "name: ${cluster name}",
+		"region: ${region:=}-${cluster}": "region: -prod",
+	} {
+		assert.Equal(t, out, string(substitute([]byte(in), vars)), in)
+	}
+}
+
+func TestSubstitutionVariables(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "flux"},
+			Data:       map[string]string{"cluster": "prod", "region": "eu-west-1"},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "flux"},
+			Data:       map[string][]byte{"token": []byte("secret"), "region": []byte("us-east-1")},
+		},
+	)
+	hr := &apiV1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "flux"},
+		Spec: apiV1.HelmReleaseSpec{
+			PostBuild: &apiV1.PostBuild{
+				Substitute: map[string]string{"cluster": "staging"},
+				SubstituteFrom: []apiV1.SubstituteReference{
+					{Kind: "ConfigMap", Name: "cluster"},
+					{Kind: "Secret", Name: "credentials"},
+					{Kind: "Secret", Name: "missing", Optional: true},
+				},
+			},
+		},
+	}
+	vars, err := substitutionVariables(client.CoreV1(), hr)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"cluster": "staging", "region": "us-east-1", "token": "secret"}, vars)
+
+	hr.Spec.PostBuild.SubstituteFrom[2].Optional = false
+	_, err = substitutionVariables(client.CoreV1(), hr)
+	assert.Error(t, err)
+}
+
+func TestComposeValuesSubstitute(t *testing.T) {
+	hr := &apiV1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "flux"},
+		Spec: apiV1.HelmReleaseSpec{
+			Values: apiV1.HelmValues{Data: map[string]interface{}{
+				"replicaCount": "${replicas:=1}",
+				"ingress":      map[string]interface{}{"host": "podinfo.${domain}"},
+				"hosts":        []interface{}{"${domain}", 80},
+				"annotation":   "${injected}",
+			}},
+			PostBuild: &apiV1.PostBuild{Substitute: map[string]string{
+				"replicas": "3",
+				"domain":   "example.com",
+				"injected": "x\nadmin: true",
+			}},
+		},
+	}
+	values, err := composeValues(fake.NewSimpleClientset().CoreV1(), nil, nil, hr, chart{}, Config{})
+	assert.NoError(t, err)
+	var hv helm.Values
+	assert.NoError(t, yaml.Unmarshal(values, &hv))
+	// only string values are substituted, so variables can not inject
+	// keys
+	assert.Equal(t, helm.Values{
+		"replicaCount": "3",
+		"ingress":      map[string]interface{}{"host": "podinfo.example.com"},
+		"hosts":        []interface{}{"example.com", float64(80)},
+		"annotation":   "x\nadmin: true",
+	}, hv)
+
+	// only the manifests are substituted
+	hr.Spec.PostBuild.Targets = []apiV1.SubstituteTarget{apiV1.SubstituteManifests}
+	values, err = composeValues(fake.NewSimpleClientset().CoreV1(), nil, nil, hr, chart{}, Config{})
+	assert.NoError(t, err)
+	hv = helm.Values{}
+	assert.NoError(t, yaml.Unmarshal(values, &hv))
+	assert.Equal(t, "${replicas:=1}", hv["replicaCount"])
+
+	p := substitutePostRenderer{coreV1Client: fake.NewSimpleClientset().CoreV1(), hr: hr}
+	out, err := p.Run(bytes.NewBufferString("host: podinfo.${domain}\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "host: podinfo.example.com\n", out.String())
+}
@@ -0,0 +1,37 @@
+package release
+
+import (
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+	"github.com/lstack-org/helm-operator/pkg/status"
+)
+
+// TestPodFailed is the reason of the Event emitted with the logs of a
+// failed test pod.
+const TestPodFailed = "TestPodFailed"
+
+// recordTestLogs records the logs of the failed test pods captured in
+// the given error of a test run in the status of the HelmRelease, and
+// emits them as Events, so failed tests can be debugged after their
+// pods have been removed. The logs are cleared if the tests passed.
+func (r *Release) recordTestLogs(hr *apiV1.HelmRelease, err error) {
+	var logs []apiV1.TestLog
+	var testErr helm.TestError
+	if errors.As(err, &testErr) {
+		for _, l := range testErr.Logs {
+			logs = append(logs, apiV1.TestLog{Name: l.Name, Log: l.Log})
+			if r.recorder != nil {
+				r.recorder.Event(hr, corev1.EventTypeWarning, TestPodFailed,
+					fmt.Sprintf("test pod '%s' of Helm release '%s' failed:\n%s", l.Name, hr.GetReleaseName(), l.Log))
+			}
+		}
+	}
+	if len(logs) > 0 || len(hr.Status.TestLogs) > 0 {
+		status.SetTestLogs(r.hrClient.HelmReleases(hr.Namespace), hr, logs)
+	}
+}
@@ -0,0 +1,37 @@
+package release
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+)
+
+func TestRecordTestLogs(t *testing.T) {
+	hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "podinfo"}}
+	client := ifclientsetfake.NewSimpleClientset(hr)
+	recorder := record.NewFakeRecorder(2)
+	r := &Release{hrClient: client.HelmV1(), recorder: recorder}
+
+	err := fmt.Errorf("test failed: %w", helm.TestError{
+		Err:  errors.New("pod podinfo-test failed"),
+		Logs: []helm.TestLog{{Name: "podinfo-test", Log: "connection refused"}},
+	})
+	r.recordTestLogs(hr, err)
+	updated, getErr := client.HelmV1().HelmReleases(hr.Namespace).Get(hr.Name, metav1.GetOptions{})
+	assert.NoError(t, getErr)
+	assert.Equal(t, []apiV1.TestLog{{Name: "podinfo-test", Log: "connection refused"}}, updated.Status.TestLogs)
+	assert.Contains(t, <-recorder.Events, "connection refused")
+
+	r.recordTestLogs(updated, nil)
+	updated, getErr = client.HelmV1().HelmReleases(hr.Namespace).Get(hr.Name, metav1.GetOptions{})
+	assert.NoError(t, getErr)
+	assert.Empty(t, updated.Status.TestLogs)
+}
@@ -1,29 +1,111 @@
 package release
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 
+	"github.com/go-kit/kit/log"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/util/jsonpath"
 	"sigs.k8s.io/yaml"
 
 	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
 	"github.com/lstack-org/helm-operator/pkg/helm"
+	"github.com/lstack-org/helm-operator/pkg/vault"
 )
 
 // composeValues attempts to compose the final values for the given
-// `HelmRelease`. It returns the values as bytes and a checksum,
+// `HelmRelease`, applying the `setValues` to the merged values of all
+// sources, and substituting the post-build variables if enabled.
+// ConfigMaps, Secrets and other objects in another namespace than the
+// `HelmRelease` may only be referenced if cross-namespace values are
+// enabled in the config. It returns the values as bytes and a checksum,
 // or an error in case anything went wrong.
-func composeValues(coreV1Client corev1client.CoreV1Interface, hr *v1.HelmRelease, chartPath string) ([]byte, error) {
+func composeValues(coreV1Client corev1client.CoreV1Interface, dynamicClient dynamic.Interface, restMapper meta.RESTMapper,
+	hr *v1.HelmRelease, chart chart, config Config) ([]byte, error) {
+	b, _, err := composeValuesLayers(coreV1Client, dynamicClient, restMapper, hr, chart, config)
+	return b, err
+}
+
+// composeValuesLayers composes the final values like composeValues,
+// and also returns the layers they were merged from, the `setValues`
+// last, to record the provenance of the values with.
+func composeValuesLayers(coreV1Client corev1client.CoreV1Interface, dynamicClient dynamic.Interface, restMapper meta.RESTMapper,
+	hr *v1.HelmRelease, chart chart, config Config) ([]byte, []valuesLayer, error) {
+	layers, err := valuesLayers(coreV1Client, dynamicClient, restMapper, hr, chart, config)
+	if err != nil {
+		return nil, nil, err
+	}
 	result := helm.Values{}
+	for _, l := range layers {
+		result = mergeValues(result, l.values)
+	}
+	if result, err = applySetValues(result, hr.Spec.SetValues); err != nil {
+		return nil, nil, err
+	}
+	if len(hr.Spec.SetValues) > 0 {
+		setValues, err := applySetValues(helm.Values{}, hr.Spec.SetValues)
+		if err != nil {
+			return nil, nil, err
+		}
+		layers = append(layers, valuesLayer{source: "setValues", values: setValues})
+	}
+	if hr.Spec.PostBuild.Substitutes(v1.SubstituteValues) {
+		vars, err := substitutionVariables(coreV1Client, hr)
+		if err != nil {
+			return nil, nil, err
+		}
+		result = substituteValues(map[string]interface{}(result), vars).(map[string]interface{})
+	}
+	b, err := result.YAML()
+	return b, layers, err
+}
+
+// valuesLayer holds the values read from a single values source.
+type valuesLayer struct {
+	source string
+	values helm.Values
+}
+
+// valuesLayers returns the values of the sources of the given
+// `HelmRelease`, in the order they are merged: the default values of
+// the namespace if enabled, the values fetched along with the chart,
+// the `valuesFrom` sources and the inline values.
+func valuesLayers(coreV1Client corev1client.CoreV1Interface, dynamicClient dynamic.Interface, restMapper meta.RESTMapper,
+	hr *v1.HelmRelease, chart chart, config Config) ([]valuesLayer, error) {
+	var layers []valuesLayer
 
+	if config.NamespaceDefaults {
+		defaults, err := namespaceDefaults(coreV1Client, hr.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, defaults...)
+	}
+
+	if chart.values != nil && hr.Spec.Oss != nil {
+		layers = append(layers, valuesLayer{source: fmt.Sprintf("oss %s/%s", hr.Spec.Oss.Bucket, hr.Spec.Oss.ValuesKey), values: chart.values})
+	}
+
+	decrypter := newValuesDecrypter(coreV1Client, hr)
 	for _, v := range hr.GetValuesFromSources() {
 		var valueFile helm.Values
+		var source string
 		ns := hr.Namespace
 
 		switch {
@@ -33,6 +115,9 @@ func composeValues(coreV1Client corev1client.CoreV1Interface, hr *v1.HelmRelease
 			if cm.Namespace != "" {
 				ns = cm.Namespace
 			}
+			if ns != hr.Namespace && !config.CrossNamespaceValues {
+				return nil, fmt.Errorf("reference to ConfigMap %s/%s is not allowed, cross-namespace values are disabled", ns, name)
+			}
 			key := cm.Key
 			if key == "" {
 				key = "values.yaml"
@@ -51,18 +136,26 @@ func composeValues(coreV1Client corev1client.CoreV1Interface, hr *v1.HelmRelease
 				}
 				return nil, fmt.Errorf("could not find key %v in ConfigMap %s/%s", key, ns, name)
 			}
-			if err := yaml.Unmarshal([]byte(d), &valueFile); err != nil {
+			b, err := decrypter.decrypt([]byte(d), fmt.Sprintf("ConfigMap %s/%s:%s", ns, name, key))
+			if err != nil {
+				return nil, err
+			}
+			if err := yaml.Unmarshal(b, &valueFile); err != nil {
 				if cm.Optional {
 					continue
 				}
 				return nil, fmt.Errorf("unable to yaml.Unmarshal %v from %s in ConfigMap %s/%s", d, key, ns, name)
 			}
+			source = fmt.Sprintf("configMapKeyRef %s/%s:%s", ns, name, key)
 		case v.SecretKeyRef != nil:
 			s := v.SecretKeyRef
 			name := s.Name
 			if s.Namespace != "" {
 				ns = s.Namespace
 			}
+			if ns != hr.Namespace && !config.CrossNamespaceValues {
+				return nil, fmt.Errorf("reference to Secret %s/%s is not allowed, cross-namespace values are disabled", ns, name)
+			}
 			key := s.Key
 			if key == "" {
 				key = "values.yaml"
@@ -81,19 +174,29 @@ func composeValues(coreV1Client corev1client.CoreV1Interface, hr *v1.HelmRelease
 				}
 				return nil, fmt.Errorf("could not find key %s in Secret %s/%s", key, ns, name)
 			}
+			if d, err = decrypter.decrypt(d, fmt.Sprintf("Secret %s/%s:%s", ns, name, key)); err != nil {
+				return nil, err
+			}
 			if err := yaml.Unmarshal(d, &valueFile); err != nil {
+				if s.Optional {
+					continue
+				}
 				return nil, fmt.Errorf("unable to yaml.Unmarshal %v from %s in Secret %s/%s", d, key, ns, name)
 			}
+			source = fmt.Sprintf("secretKeyRef %s/%s:%s", ns, name, key)
 		case v.ExternalSourceRef != nil:
 			es := v.ExternalSourceRef
 			u := es.URL
 			optional := es.Optional != nil && *es.Optional
-			b, err := readURL(u)
+			b, err := readExternalSource(coreV1Client, hr.Namespace, es, config.ChartCache, config.HTTPTransport)
 			if err != nil {
 				if optional {
 					continue
 				}
-				return nil, fmt.Errorf("unable to read value file from URL %s", u)
+				return nil, fmt.Errorf("unable to read value file from URL %s: %w", u, err)
+			}
+			if b, err = decrypter.decrypt(b, "URL "+u); err != nil {
+				return nil, err
 			}
 			if err := yaml.Unmarshal(b, &valueFile); err != nil {
 				if optional {
@@ -101,33 +204,277 @@ func composeValues(coreV1Client corev1client.CoreV1Interface, hr *v1.HelmRelease
 				}
 				return nil, fmt.Errorf("unable to yaml.Unmarshal %v from URL %s", b, u)
 			}
+			source = "externalSourceRef " + u
 		case v.ChartFileRef != nil:
 			cf := v.ChartFileRef
 			filePath := cf.Path
 			optional := cf.Optional != nil && *cf.Optional
-			f, err := readLocalChartFile(filepath.Join(chartPath, filePath))
+			f, err := readLocalChartFile(filepath.Join(chart.chartPath, filePath))
 			if err != nil {
 				if optional {
 					continue
 				}
 				return nil, fmt.Errorf("unable to read value file from path %s", filePath)
 			}
+			if f, err = decrypter.decrypt(f, "path "+filePath); err != nil {
+				return nil, err
+			}
 			if err := yaml.Unmarshal(f, &valueFile); err != nil {
 				if optional {
 					continue
 				}
 				return nil, fmt.Errorf("unable to yaml.Unmarshal %v from path %s", f, filePath)
 			}
+			source = "chartFileRef " + filePath
+		case v.ObjectFieldRef != nil:
+			of := v.ObjectFieldRef
+			optional := of.Optional != nil && *of.Optional
+			var err error
+			valueFile, source, err = readObjectField(dynamicClient, restMapper, hr.Namespace, of, config.CrossNamespaceValues)
+			if err != nil {
+				if optional && !isForbiddenReference(err) {
+					continue
+				}
+				return nil, err
+			}
+		case v.VaultRef != nil:
+			vs := v.VaultRef
+			optional := vs.Optional != nil && *vs.Optional
+			var err error
+			valueFile, source, err = readVaultSecret(config.Vault, hr.Namespace, vs)
+			if err != nil {
+				if optional && !isForbiddenReference(err) {
+					continue
+				}
+				return nil, err
+			}
+		}
+		layers = append(layers, valuesLayer{source: source, values: valueFile})
+	}
+
+	layers = append(layers, valuesLayer{source: "inline", values: hr.Spec.Values.Data})
+	return layers, nil
+}
+
+// readExternalSource reads the values of the given external source,
+// authenticating with the credentials from the referenced secret and
+// verifying the checksum if configured. Retrieved values are cached
+// in the cache directory, per namespace, credentials and URL: when a
+// checksum is configured, values matching it are served from the
+// cache without a request; otherwise, the cached values of optional
+// sources are used as a fallback while the source is temporarily
+// unavailable.
+func readExternalSource(coreV1Client corev1client.CoreV1Interface, namespace string, es *v1.ExternalSourceSelector,
+	cacheDir string, transport *http.Transport) ([]byte, error) {
+	var cachePath string
+	if cacheDir != "" {
+		var secretName string
+		if es.SecretRef != nil {
+			secretName = es.SecretRef.Name
+		}
+		sum := sha256.Sum256([]byte(strings.Join([]string{namespace, secretName, es.URL}, "\x00")))
+		cachePath = filepath.Join(cacheDir, "values", hex.EncodeToString(sum[:])+".yaml")
+	}
+	if cachePath != "" && es.SHA256 != "" {
+		if b, err := ioutil.ReadFile(cachePath); err == nil && verifyChecksum(b, es.SHA256) == nil {
+			return b, nil
+		}
+	}
+
+	header := http.Header{}
+	if es.SecretRef != nil {
+		secret, err := coreV1Client.Secrets(namespace).Get(es.SecretRef.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get credentials: %w", err)
+		}
+		switch {
+		case len(secret.Data["token"]) > 0:
+			header.Set("Authorization", "Bearer "+string(secret.Data["token"]))
+		case len(secret.Data["username"]) > 0:
+			auth := string(secret.Data["username"]) + ":" + string(secret.Data["password"])
+			header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(auth)))
+		default:
+			return nil, fmt.Errorf("secret %s/%s holds neither a token nor a username", namespace, es.SecretRef.Name)
+		}
+	}
+
+	b, err := readURL(transport, es.URL, header)
+	if err == nil && es.SHA256 != "" {
+		err = verifyChecksum(b, es.SHA256)
+	}
+	if err != nil {
+		optional := es.Optional != nil && *es.Optional
+		if optional && isTransientReadError(err) && cachePath != "" && es.SHA256 == "" {
+			if cached, cacheErr := ioutil.ReadFile(cachePath); cacheErr == nil {
+				return cached, nil
+			}
 		}
-		result = mergeValues(result, valueFile)
+		return nil, err
 	}
 
-	result = mergeValues(result, hr.Spec.Values.Data)
-	return result.YAML()
+	if cachePath != "" {
+		// failing to cache is not fatal, the values are still good
+		if err := os.MkdirAll(filepath.Dir(cachePath), 0700); err == nil {
+			_ = ioutil.WriteFile(cachePath, b, 0600)
+		}
+	}
+	return b, nil
+}
+
+// forbiddenReference is returned for a reference to an object which
+// may not be referenced, which is an error even if the source is
+// optional.
+type forbiddenReference struct {
+	error
+}
+
+func isForbiddenReference(err error) bool {
+	_, ok := err.(forbiddenReference)
+	return ok
 }
 
-// readURL attempts to read a file from an HTTP(S) URL.
-func readURL(URL string) ([]byte, error) {
+// readObjectField reads the field of the object referenced by the
+// given selector, and returns it as values along with a description
+// of the source. The field is set at the target path of the selector,
+// or merged into the values if it holds a map, or YAML or JSON with
+// a map, and no target path is set.
+func readObjectField(dynamicClient dynamic.Interface, restMapper meta.RESTMapper, namespace string,
+	of *v1.ObjectFieldSelector, crossNamespace bool) (helm.Values, string, error) {
+	gvk := schema.FromAPIVersionAndKind(of.APIVersion, of.Kind)
+	mapping, err := restMapping(restMapper, gvk)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to map %s %s: %w", of.APIVersion, of.Kind, err)
+	}
+
+	var ri dynamic.ResourceInterface
+	var key string
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		ns := namespace
+		if of.Namespace != "" {
+			ns = of.Namespace
+		}
+		if ns != namespace && !crossNamespace {
+			return nil, "", forbiddenReference{fmt.Errorf("reference to %s %s/%s is not allowed, cross-namespace values are disabled", of.Kind, ns, of.Name)}
+		}
+		ri = dynamicClient.Resource(mapping.Resource).Namespace(ns)
+		key = ns + "/" + of.Name
+	} else {
+		if !crossNamespace {
+			return nil, "", forbiddenReference{fmt.Errorf("reference to cluster scoped %s %s is not allowed, cross-namespace values are disabled", of.Kind, of.Name)}
+		}
+		ri = dynamicClient.Resource(mapping.Resource)
+		key = of.Name
+	}
+	source := fmt.Sprintf("objectFieldRef %s %s:%s", of.Kind, key, of.FieldPath)
+
+	obj, err := ri.Get(of.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, "", err
+	}
+	field, err := objectField(obj.Object, of.FieldPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to read field %s of %s %s: %w", of.FieldPath, of.Kind, key, err)
+	}
+
+	if of.TargetPath != "" {
+		return atTargetPath(of.TargetPath, field), source, nil
+	}
+	switch f := field.(type) {
+	case map[string]interface{}:
+		return f, source, nil
+	case string:
+		var values helm.Values
+		if err := yaml.Unmarshal([]byte(f), &values); err != nil {
+			return nil, "", fmt.Errorf("unable to yaml.Unmarshal field %s of %s %s", of.FieldPath, of.Kind, key)
+		}
+		return values, source, nil
+	default:
+		return nil, "", fmt.Errorf("field %s of %s %s holds no map, a target path is required", of.FieldPath, of.Kind, key)
+	}
+}
+
+// readVaultSecret reads the secret referenced by the given selector
+// from Vault, and returns it as values along with a description of the
+// source. The values are the keys and values of the secret, or the YAML
+// held by the key of the selector, set at its target path if any.
+func readVaultSecret(client *vault.Client, namespace string, vs *v1.VaultSelector) (helm.Values, string, error) {
+	source := "vaultRef " + vs.GetMount() + "/" + vs.Path
+	if client == nil {
+		return nil, source, forbiddenReference{fmt.Errorf("reference to Vault secret %s is not allowed, Vault is not configured", vs.Path)}
+	}
+	data, err := client.ReadKV(namespace, vs.GetServiceAccountName(), vs.Role, vs.GetMount(), vs.Path, vs.Version)
+	if err != nil {
+		return nil, source, fmt.Errorf("unable to read Vault secret %s/%s: %w", vs.GetMount(), vs.Path, err)
+	}
+
+	var values helm.Values
+	if vs.Key != "" {
+		s, ok := data[vs.Key].(string)
+		if !ok {
+			return nil, source, fmt.Errorf("could not find key %v in Vault secret %s/%s", vs.Key, vs.GetMount(), vs.Path)
+		}
+		if err := yaml.Unmarshal([]byte(s), &values); err != nil {
+			return nil, source, fmt.Errorf("unable to yaml.Unmarshal key %v of Vault secret %s/%s", vs.Key, vs.GetMount(), vs.Path)
+		}
+		source += ":" + vs.Key
+	} else {
+		values = data
+	}
+	if vs.TargetPath != "" {
+		return atTargetPath(vs.TargetPath, map[string]interface{}(values)), source, nil
+	}
+	return values, source, nil
+}
+
+// atTargetPath returns values with the given value set at the dot
+// separated target path.
+func atTargetPath(targetPath string, value interface{}) helm.Values {
+	values := helm.Values{}
+	m := values
+	keys := strings.Split(targetPath, ".")
+	for _, k := range keys[:len(keys)-1] {
+		next := map[string]interface{}{}
+		m[k] = next
+		m = next
+	}
+	m[keys[len(keys)-1]] = value
+	return values
+}
+
+// objectField returns the single field of the given object selected
+// by the JSONPath expression, which may omit the enclosing braces.
+func objectField(obj map[string]interface{}, fieldPath string) (interface{}, error) {
+	if !strings.HasPrefix(fieldPath, "{") {
+		fieldPath = "{" + fieldPath + "}"
+	}
+	jp := jsonpath.New("fieldPath")
+	if err := jp.Parse(fieldPath); err != nil {
+		return nil, err
+	}
+	results, err := jp.FindResults(obj)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != 1 || len(results[0]) != 1 {
+		return nil, fmt.Errorf("field path does not select a single field")
+	}
+	return results[0][0].Interface(), nil
+}
+
+// verifyChecksum returns an error if the SHA256 checksum of b does
+// not equal the expected hex encoded checksum.
+func verifyChecksum(b []byte, expected string) error {
+	sum := sha256.Sum256(b)
+	if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("checksum mismatch: expected sha256 '%s', got '%s'", expected, actual)
+	}
+	return nil
+}
+
+// readURL attempts to read a file from an HTTP(S) URL, sending the
+// given headers with the request, using the given transport or the
+// default transport if nil.
+func readURL(transport *http.Transport, URL string, header http.Header) ([]byte, error) {
 	u, err := url.Parse(URL)
 	if err != nil {
 		return []byte{}, err
@@ -135,20 +482,167 @@ func readURL(URL string) ([]byte, error) {
 	if u.Scheme != "http" && u.Scheme != "https" {
 		return []byte{}, fmt.Errorf("URL scheme should be HTTP(S), got '%s'", u.Scheme)
 	}
-	resp, err := http.Get(u.String())
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
 	if err != nil {
 		return []byte{}, err
 	}
+	req.Header = header
+	client := http.DefaultClient
+	if transport != nil {
+		client = &http.Client{Transport: transport}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return []byte{}, transientReadError{err}
+	}
+	defer resp.Body.Close()
 	switch resp.StatusCode {
 	case http.StatusOK:
 		body, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
-			return []byte{}, err
+			return []byte{}, transientReadError{err}
 		}
 		return body, nil
 	default:
-		return []byte{}, fmt.Errorf("failed to retrieve file from URL, status '%s (%d)'", resp.Status, resp.StatusCode)
+		err := fmt.Errorf("failed to retrieve file from URL, status '%s (%d)'", resp.Status, resp.StatusCode)
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests {
+			err = transientReadError{err}
+		}
+		return []byte{}, err
+	}
+}
+
+// transientReadError is returned for failures to read a URL which may
+// succeed later, like connection failures and server errors.
+type transientReadError struct {
+	error
+}
+
+func isTransientReadError(err error) bool {
+	_, ok := err.(transientReadError)
+	return ok
+}
+
+// DefaultValuesLabel marks the ConfigMaps holding the default values
+// for every `HelmRelease` in their namespace.
+const DefaultValuesLabel = "helm.fluxcd.io/default-values"
+
+// namespaceDefaults returns the default values of the given namespace,
+// from the `values.yaml` of the ConfigMaps labeled with
+// DefaultValuesLabel, in the order of their names.
+func namespaceDefaults(coreV1Client corev1client.CoreV1Interface, namespace string) ([]valuesLayer, error) {
+	list, err := coreV1Client.ConfigMaps(namespace).List(metav1.ListOptions{LabelSelector: DefaultValuesLabel + "=true"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list default values ConfigMaps in %s: %w", namespace, err)
+	}
+	cms := list.Items
+	sort.Slice(cms, func(i, j int) bool { return cms[i].Name < cms[j].Name })
+
+	var layers []valuesLayer
+	for _, cm := range cms {
+		d, ok := cm.Data["values.yaml"]
+		if !ok {
+			continue
+		}
+		var values helm.Values
+		if err := yaml.Unmarshal([]byte(d), &values); err != nil {
+			return nil, fmt.Errorf("unable to yaml.Unmarshal %v from values.yaml in default values ConfigMap %s/%s", d, namespace, cm.Name)
+		}
+		layers = append(layers, valuesLayer{source: fmt.Sprintf("namespace default %s/%s", namespace, cm.Name), values: values})
+	}
+	return layers, nil
+}
+
+// valuesProvenance returns, for each top-level key of the composed
+// values, the sources which provided it, in the order they were
+// merged. Sources are recorded the way mergeValues merges them: if a
+// key holds a map in both the existing and the next values both
+// sources contribute, otherwise the next source replaces the value.
+func valuesProvenance(chartDefaults helm.Values, layers []valuesLayer) map[string][]string {
+	layers = append([]valuesLayer{{source: "chart default", values: chartDefaults}}, layers...)
+	merged := helm.Values{}
+	result := make(map[string][]string)
+	for _, l := range layers {
+		for k, v := range l.values {
+			_, srcMap := v.(map[string]interface{})
+			_, destMap := merged[k].(map[string]interface{})
+			if srcMap && destMap {
+				result[k] = append(result[k], l.source)
+			} else {
+				result[k] = []string{l.source}
+			}
+			merged[k] = v
+		}
+	}
+	return result
+}
+
+// valuesProvenances holds the values provenance recorded by the last
+// sync of each `HelmRelease`, by namespace and name.
+type valuesProvenances struct {
+	mu      sync.RWMutex
+	records map[string]map[string][]string
+}
+
+func (p *valuesProvenances) set(namespace, name string, provenance map[string][]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.records == nil {
+		p.records = make(map[string]map[string][]string)
+	}
+	p.records[namespace+"/"+name] = provenance
+}
+
+func (p *valuesProvenances) get(namespace, name string) (map[string][]string, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	provenance, ok := p.records[namespace+"/"+name]
+	return provenance, ok
+}
+
+func (p *valuesProvenances) remove(namespace, name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.records, namespace+"/"+name)
+}
+
+// recordValuesProvenance records the provenance of the values composed
+// from the given layers for the `HelmRelease`, reading the default
+// values of its chart. Failures are logged, as they should not fail
+// the release.
+func (r *Release) recordValuesProvenance(logger log.Logger, client helm.Client, hr *v1.HelmRelease, chart chart, layers []valuesLayer) {
+	chartDefaults, err := client.GetChartValues(chart.chartPath)
+	if err != nil {
+		logger.Log("warning", fmt.Sprintf("failed to record values provenance: %v", err))
+		return
+	}
+	r.provenances.set(hr.Namespace, hr.Name, valuesProvenance(chartDefaults, layers))
+}
+
+// ValuesProvenance reports, for each top-level key of the values of
+// the given `HelmRelease`, which sources provided it, as recorded by
+// its last sync which composed the values.
+func (r *Release) ValuesProvenance(namespace, name string) (map[string][]string, error) {
+	provenance, ok := r.provenances.get(namespace, name)
+	if !ok {
+		return nil, errors.NewNotFound(v1.Resource("helmreleases"), namespace+"/"+name)
+	}
+	return provenance, nil
+}
+
+// readValuesFile reads the values file at the given path, and returns
+// the values with a revision derived from its content.
+func readValuesFile(path string) (helm.Values, string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	values := helm.Values{}
+	if err := yaml.Unmarshal(b, &values); err != nil {
+		return nil, "", fmt.Errorf("unable to yaml.Unmarshal values file: %w", err)
 	}
+	sum := sha256.Sum256(b)
+	return values, hex.EncodeToString(sum[:])[:12], nil
 }
 
 // readLocalChartFile attempts to read a file from the chart path.
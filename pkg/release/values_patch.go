@@ -0,0 +1,83 @@
+package release
+
+import (
+	"encoding/json"
+	"fmt"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/go-kit/kit/log"
+	corev1 "k8s.io/api/core/v1"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+const (
+	// ValuesPatchAnnotation holds a JSON Patch (RFC 6902) which the
+	// operator applies to the inline values of the HelmRelease, after
+	// which the annotation is removed. Paths are relative to
+	// `spec.values`, i.e. `/image/tag`. The patch is applied with the
+	// removal of the annotation in a single update, which fails if the
+	// HelmRelease changed since it was read; `test` operations can be
+	// used to only apply the patch to the expected values.
+	ValuesPatchAnnotation = "helm.fluxcd.io/values-patch"
+
+	// ValuesPatchFailed is the reason of the Event emitted when the
+	// values patch of a HelmRelease can not be applied.
+	ValuesPatchFailed = "ValuesPatchFailed"
+)
+
+// applyValuesPatch applies the values patch annotation of the given
+// HelmRelease to its inline values and removes the annotation. A patch
+// which does not apply is removed as well, as it would not apply on
+// a retry either, and reported with an Event. It returns the (updated)
+// HelmRelease, or an error.
+func (r *Release) applyValuesPatch(logger log.Logger, hr *apiV1.HelmRelease) (*apiV1.HelmRelease, error) {
+	patch, ok := hr.GetAnnotations()[ValuesPatchAnnotation]
+	if !ok {
+		return hr, nil
+	}
+
+	cHr := hr.DeepCopy()
+	delete(cHr.Annotations, ValuesPatchAnnotation)
+	values, patchErr := patchValues(hr.Spec.Values.Data, []byte(patch))
+	if patchErr == nil {
+		cHr.Spec.Values = apiV1.HelmValues{Data: values}
+	}
+	updated, err := r.hrClient.HelmReleases(hr.Namespace).Update(cHr)
+	if err != nil {
+		return hr, fmt.Errorf("failed to apply values patch: %w", err)
+	}
+
+	if patchErr != nil {
+		logger.Log("warning", fmt.Sprintf("discarded values patch: %v", patchErr))
+		if r.recorder != nil {
+			r.recorder.Event(hr, corev1.EventTypeWarning, ValuesPatchFailed, fmt.Sprintf("values patch discarded: %v", patchErr))
+		}
+		return updated, nil
+	}
+	logger.Log("info", "applied values patch")
+	return updated, nil
+}
+
+// patchValues returns the given values with the JSON Patch applied.
+func patchValues(values map[string]interface{}, patch []byte) (map[string]interface{}, error) {
+	p, err := jsonpatch.DecodePatch(patch)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON patch: %w", err)
+	}
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	doc, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	if doc, err = p.Apply(doc); err != nil {
+		return nil, fmt.Errorf("failed to apply JSON patch: %w", err)
+	}
+	var patched map[string]interface{}
+	if err := json.Unmarshal(doc, &patched); err != nil {
+		return nil, fmt.Errorf("patched values are not an object: %w", err)
+	}
+	return patched, nil
+}
@@ -0,0 +1,67 @@
+package release
+
+import (
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+)
+
+func TestApplyValuesPatch(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		patch      string
+		wantValues map[string]interface{}
+		wantEvent  bool
+	}{
+		{
+			name:       "patch",
+			patch:      `[{"op": "test", "path": "/image/tag", "value": "1.0.0"}, {"op": "replace", "path": "/image/tag", "value": "1.1.0"}, {"op": "add", "path": "/replicas", "value": 2}]`,
+			wantValues: map[string]interface{}{"image": map[string]interface{}{"tag": "1.1.0"}, "replicas": float64(2)},
+		},
+		{
+			name:       "failed test",
+			patch:      `[{"op": "test", "path": "/image/tag", "value": "0.9.0"}, {"op": "replace", "path": "/image/tag", "value": "1.1.0"}]`,
+			wantValues: map[string]interface{}{"image": map[string]interface{}{"tag": "1.0.0"}},
+			wantEvent:  true,
+		},
+		{
+			name:       "invalid patch",
+			patch:      `{"image": {"tag": "1.1.0"}}`,
+			wantValues: map[string]interface{}{"image": map[string]interface{}{"tag": "1.0.0"}},
+			wantEvent:  true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hr := &apiV1.HelmRelease{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   "default",
+					Name:        "podinfo",
+					Annotations: map[string]string{ValuesPatchAnnotation: tc.patch, "other": "kept"},
+				},
+				Spec: apiV1.HelmReleaseSpec{
+					Values: apiV1.HelmValues{Data: map[string]interface{}{"image": map[string]interface{}{"tag": "1.0.0"}}},
+				},
+			}
+			client := ifclientsetfake.NewSimpleClientset(hr)
+			recorder := record.NewFakeRecorder(1)
+			r := &Release{hrClient: client.HelmV1(), recorder: recorder}
+
+			updated, err := r.applyValuesPatch(log.NewNopLogger(), hr)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantValues, updated.Spec.Values.Data)
+			assert.Equal(t, map[string]string{"other": "kept"}, updated.Annotations)
+			assert.Equal(t, tc.wantEvent, len(recorder.Events) == 1)
+
+			stored, err := client.HelmV1().HelmReleases(hr.Namespace).Get(hr.Name, metav1.GetOptions{})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantValues, stored.Spec.Values.Data)
+			assert.NotContains(t, stored.Annotations, ValuesPatchAnnotation)
+		})
+	}
+}
@@ -1,17 +1,32 @@
 package release
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
 	"k8s.io/client-go/kubernetes/fake"
 	"sigs.k8s.io/yaml"
 
 	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
 	"github.com/lstack-org/helm-operator/pkg/helm"
+	"github.com/lstack-org/helm-operator/pkg/vault"
 )
 
 func TestComposeValues(t *testing.T) {
@@ -209,7 +224,7 @@ func TestComposeValues(t *testing.T) {
 			}
 			hr.Namespace = c.releaseNamespace
 
-			values, err := composeValues(client.CoreV1(), hr, "")
+			values, err := composeValues(client.CoreV1(), nil, nil, hr, chart{}, Config{CrossNamespaceValues: true})
 			t.Log(values)
 			assert.NoError(t, err)
 			for _, assertion := range c.assertions {
@@ -220,3 +235,473 @@ func TestComposeValues(t *testing.T) {
 		})
 	}
 }
+
+func TestComposeValuesCrossNamespace(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "release-configmap",
+				Namespace: "other-namespace",
+			},
+			Data: map[string]string{
+				"values.yaml": `cross-namespace-configmap: true`,
+			},
+		},
+	)
+	hr := &v1.HelmRelease{
+		Spec: v1.HelmReleaseSpec{
+			ValuesFrom: []v1.ValuesFromSource{
+				{
+					ConfigMapKeyRef: &v1.OptionalConfigMapKeySelector{
+						ConfigMapKeySelector: v1.ConfigMapKeySelector{
+							LocalObjectReference: v1.LocalObjectReference{
+								Name: "release-configmap",
+							},
+							Namespace: "other-namespace",
+						},
+					},
+				},
+				{
+					SecretKeyRef: &v1.OptionalSecretKeySelector{
+						SecretKeySelector: v1.SecretKeySelector{
+							LocalObjectReference: v1.LocalObjectReference{
+								Name: "missing-secret",
+							},
+						},
+						Optional: true,
+					},
+				},
+			},
+		},
+	}
+	hr.Namespace = "flux"
+
+	_, err := composeValues(client.CoreV1(), nil, nil, hr, chart{}, Config{})
+	assert.Error(t, err)
+
+	values, err := composeValues(client.CoreV1(), nil, nil, hr, chart{}, Config{CrossNamespaceValues: true})
+	assert.NoError(t, err)
+	var hv helm.Values
+	yaml.Unmarshal(values, &hv)
+	assert.Equal(t, true, hv["cross-namespace-configmap"])
+}
+
+func TestComposeValuesNamespaceDefaults(t *testing.T) {
+	defaults := func(name, namespace, values string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels:    map[string]string{DefaultValuesLabel: "true"},
+			},
+			Data: map[string]string{"values.yaml": values},
+		}
+	}
+	client := fake.NewSimpleClientset(
+		defaults("b-registry", "flux", "image:\n  registry: mirror.local\nproxy: http://proxy:3128"),
+		defaults("a-resources", "flux", "resources:\n  limits:\n    cpu: 100m\nproxy: http://ignored:3128"),
+		defaults("other", "other-namespace", "other: true"),
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "unlabeled", Namespace: "flux"},
+			Data:       map[string]string{"values.yaml": "unlabeled: true"},
+		},
+	)
+	hr := &v1.HelmRelease{
+		Spec: v1.HelmReleaseSpec{
+			Values: v1.HelmValues{Data: map[string]interface{}{
+				"image": map[string]interface{}{"tag": "1.0"},
+			}},
+		},
+	}
+	hr.Namespace = "flux"
+
+	values, err := composeValues(client.CoreV1(), nil, nil, hr, chart{}, Config{})
+	assert.NoError(t, err)
+	var hv helm.Values
+	assert.NoError(t, yaml.Unmarshal(values, &hv))
+	assert.Equal(t, helm.Values{"image": map[string]interface{}{"tag": "1.0"}}, hv)
+
+	values, err = composeValues(client.CoreV1(), nil, nil, hr, chart{}, Config{NamespaceDefaults: true})
+	assert.NoError(t, err)
+	hv = helm.Values{}
+	assert.NoError(t, yaml.Unmarshal(values, &hv))
+	assert.Equal(t, helm.Values{
+		"image":     map[string]interface{}{"registry": "mirror.local", "tag": "1.0"},
+		"proxy":     "http://proxy:3128",
+		"resources": map[string]interface{}{"limits": map[string]interface{}{"cpu": "100m"}},
+	}, hv)
+}
+
+func TestComposeValuesObjectFieldRef(t *testing.T) {
+	object := func(apiVersion, kind, namespace, name string, fields map[string]interface{}) runtime.Object {
+		obj := &unstructured.Unstructured{Object: fields}
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind(kind)
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+		return obj
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		object("v1", "Service", "flux", "db", map[string]interface{}{
+			"spec": map[string]interface{}{"clusterIP": "10.0.0.1"},
+		}),
+		object("v1", "ConfigMap", "flux", "app", map[string]interface{}{
+			"data": map[string]interface{}{"config.json": `{"replicaCount": 2}`},
+		}),
+		object("v1", "Service", "other-namespace", "db", map[string]interface{}{
+			"spec": map[string]interface{}{"clusterIP": "10.0.0.2"},
+		}))
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Service"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+
+	optional := true
+	hr := &v1.HelmRelease{
+		Spec: v1.HelmReleaseSpec{
+			ValuesFrom: []v1.ValuesFromSource{
+				{ObjectFieldRef: &v1.ObjectFieldSelector{APIVersion: "v1", Kind: "Service", Name: "db",
+					FieldPath: ".spec.clusterIP", TargetPath: "db.host"}},
+				{ObjectFieldRef: &v1.ObjectFieldSelector{APIVersion: "v1", Kind: "ConfigMap", Name: "app",
+					FieldPath: `{.data.config\.json}`}},
+				{ObjectFieldRef: &v1.ObjectFieldSelector{APIVersion: "v1", Kind: "Service", Name: "missing",
+					FieldPath: ".spec.clusterIP", TargetPath: "missing", Optional: &optional}},
+			},
+		},
+	}
+	hr.Namespace = "flux"
+
+	values, err := composeValues(fake.NewSimpleClientset().CoreV1(), dynamicClient, mapper, hr, chart{}, Config{})
+	assert.NoError(t, err)
+	var hv helm.Values
+	assert.NoError(t, yaml.Unmarshal(values, &hv))
+	assert.Equal(t, helm.Values{
+		"db":           map[string]interface{}{"host": "10.0.0.1"},
+		"replicaCount": float64(2),
+	}, hv)
+
+	// objects in other namespaces can only be referenced with
+	// cross-namespace values, even if optional
+	hr.Spec.ValuesFrom = []v1.ValuesFromSource{
+		{ObjectFieldRef: &v1.ObjectFieldSelector{APIVersion: "v1", Kind: "Service", Name: "db", Namespace: "other-namespace",
+			FieldPath: ".spec.clusterIP", TargetPath: "db.host", Optional: &optional}},
+	}
+	_, err = composeValues(fake.NewSimpleClientset().CoreV1(), dynamicClient, mapper, hr, chart{}, Config{})
+	assert.Error(t, err)
+	values, err = composeValues(fake.NewSimpleClientset().CoreV1(), dynamicClient, mapper, hr, chart{}, Config{CrossNamespaceValues: true})
+	assert.NoError(t, err)
+	hv = helm.Values{}
+	assert.NoError(t, yaml.Unmarshal(values, &hv))
+	assert.Equal(t, helm.Values{"db": map[string]interface{}{"host": "10.0.0.2"}}, hv)
+}
+
+func TestComposeValuesVaultRef(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/kubernetes/login":
+			w.Write([]byte(`{"auth":{"client_token":"vault-token","lease_duration":600}}`))
+		case "/v1/secret/data/apps/db":
+			w.Write([]byte(`{"data":{"data":{"username":"app","password":"s3cr3t"}}}`))
+		case "/v1/kv/data/apps/web":
+			w.Write([]byte(`{"data":{"data":{"values.yaml":"replicaCount: 2\n"}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	vaultClient, err := vault.New(vault.Config{Address: server.URL, Role: "apps"}, func(namespace, serviceAccount string) (string, error) {
+		return "sa-token", nil
+	})
+	assert.NoError(t, err)
+
+	optional := true
+	hr := &v1.HelmRelease{
+		Spec: v1.HelmReleaseSpec{
+			ValuesFrom: []v1.ValuesFromSource{
+				{VaultRef: &v1.VaultSelector{Path: "apps/db", TargetPath: "database.credentials"}},
+				{VaultRef: &v1.VaultSelector{Mount: "kv", Path: "apps/web", Key: "values.yaml"}},
+				{VaultRef: &v1.VaultSelector{Path: "apps/missing", Optional: &optional}},
+			},
+		},
+	}
+	hr.Namespace = "flux"
+
+	values, err := composeValues(fake.NewSimpleClientset().CoreV1(), nil, nil, hr, chart{}, Config{Vault: vaultClient})
+	assert.NoError(t, err)
+	var hv helm.Values
+	assert.NoError(t, yaml.Unmarshal(values, &hv))
+	assert.Equal(t, helm.Values{
+		"database": map[string]interface{}{
+			"credentials": map[string]interface{}{"username": "app", "password": "s3cr3t"},
+		},
+		"replicaCount": float64(2),
+	}, hv)
+
+	// references to Vault secrets fail without Vault, even if optional
+	_, err = composeValues(fake.NewSimpleClientset().CoreV1(), nil, nil, hr, chart{}, Config{})
+	assert.Error(t, err)
+}
+
+func TestComposeValuesVaultRefCached(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/kubernetes/login":
+			w.Write([]byte(`{"auth":{"client_token":"vault-token","lease_duration":600}}`))
+		case "/v1/secret/data/apps/db":
+			w.Write([]byte(`{"data":{"data":{"password":"s3cr3t"}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	vaultClient, err := vault.New(vault.Config{Address: server.URL, Role: "apps", CacheTTL: time.Minute}, func(namespace, serviceAccount string) (string, error) {
+		return "sa-token", nil
+	})
+	assert.NoError(t, err)
+
+	newHelmRelease := func(inline map[string]interface{}) *v1.HelmRelease {
+		hr := &v1.HelmRelease{
+			Spec: v1.HelmReleaseSpec{
+				ValuesFrom: []v1.ValuesFromSource{{VaultRef: &v1.VaultSelector{Path: "apps/db", TargetPath: "secrets"}}},
+			},
+		}
+		hr.Namespace = "flux"
+		hr.Spec.Values.Data = inline
+		return hr
+	}
+
+	// the inline values merged into the secret do not end up in the
+	// cached secret read by the next HelmRelease
+	for _, inline := range []map[string]interface{}{
+		{"secrets": map[string]interface{}{"extra": "value"}},
+		nil,
+	} {
+		values, err := composeValues(fake.NewSimpleClientset().CoreV1(), nil, nil, newHelmRelease(inline), chart{}, Config{Vault: vaultClient})
+		assert.NoError(t, err)
+		var hv helm.Values
+		assert.NoError(t, yaml.Unmarshal(values, &hv))
+		want := map[string]interface{}{"password": "s3cr3t"}
+		if inline != nil {
+			want["extra"] = "value"
+		}
+		assert.Equal(t, helm.Values{"secrets": want}, hv)
+	}
+}
+
+func TestComposeValuesEncrypted(t *testing.T) {
+	encrypted := `password: ENC[AES256_GCM,data:b2s=,iv:aXY=,tag:dGFn,type:str]
+sops:
+  lastmodified: "2020-06-01T12:00:00Z"
+  mac: ENC[AES256_GCM,data:bWFj,iv:aXY=,tag:dGFn,type:str]
+`
+	client := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "values", Namespace: "flux"},
+			Data:       map[string]string{"values.yaml": encrypted},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "sops-keys", Namespace: "flux"},
+			Data:       map[string][]byte{"values.yaml": []byte("not: a key")},
+		},
+	)
+	hr := &v1.HelmRelease{
+		Spec: v1.HelmReleaseSpec{
+			ValuesFrom: []v1.ValuesFromSource{{ConfigMapKeyRef: &v1.OptionalConfigMapKeySelector{
+				ConfigMapKeySelector: v1.ConfigMapKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "values"}},
+			}}},
+		},
+	}
+	hr.Namespace = "flux"
+
+	_, err := composeValues(client.CoreV1(), nil, nil, hr, chart{}, Config{})
+	assert.EqualError(t, err, "values from ConfigMap flux/values:values.yaml are encrypted with SOPS, but no decryption is configured")
+
+	hr.Spec.Decryption = &v1.Decryption{Provider: v1.DecryptionProviderSOPS, SecretRef: &v1.LocalObjectReference{Name: "sops-keys"}}
+	_, err = composeValues(client.CoreV1(), nil, nil, hr, chart{}, Config{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid decryption keys")
+}
+
+func TestReadExternalSource(t *testing.T) {
+	values := []byte("external: true\n")
+	sum := sha256.Sum256(values)
+	checksum := hex.EncodeToString(sum[:])
+
+	available := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !available {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(values)
+	}))
+	defer srv.Close()
+
+	cacheDir, err := ioutil.TempDir("", "values-cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "values-auth", Namespace: "flux"},
+		Data:       map[string][]byte{"token": []byte("s3cr3t")},
+	})
+	es := &v1.ExternalSourceSelector{
+		URL:       srv.URL,
+		SHA256:    checksum,
+		SecretRef: &v1.LocalObjectReference{Name: "values-auth"},
+	}
+
+	b, err := readExternalSource(client.CoreV1(), "flux", es, cacheDir, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, values, b)
+
+	// served from the cache as it matches the checksum
+	available = false
+	b, err = readExternalSource(client.CoreV1(), "flux", es, cacheDir, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, values, b)
+
+	es.SHA256 = "0000"
+	_, err = readExternalSource(client.CoreV1(), "flux", es, cacheDir, nil)
+	assert.Error(t, err)
+
+	// only optional sources fall back to the cache when no checksum
+	// is configured
+	es.SHA256 = ""
+	_, err = readExternalSource(client.CoreV1(), "flux", es, cacheDir, nil)
+	assert.Error(t, err)
+	optional := true
+	es.Optional = &optional
+	b, err = readExternalSource(client.CoreV1(), "flux", es, cacheDir, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, values, b)
+
+	// the cache is not shared with other namespaces
+	_, err = readExternalSource(client.CoreV1(), "other-namespace", &v1.ExternalSourceSelector{
+		URL:      srv.URL,
+		Optional: &optional,
+	}, cacheDir, nil)
+	assert.Error(t, err)
+
+	// nor used when the source rejects the request
+	client.CoreV1().Secrets("flux").Update(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "values-auth", Namespace: "flux"},
+		Data:       map[string][]byte{"token": []byte("revoked")},
+	})
+	_, err = readExternalSource(client.CoreV1(), "flux", es, cacheDir, nil)
+	assert.Error(t, err)
+}
+
+func TestValuesProvenance(t *testing.T) {
+	chartDefaults := helm.Values{
+		"image":    map[string]interface{}{"repository": "nginx", "tag": "1.19"},
+		"replicas": 1,
+		"service":  map[string]interface{}{"type": "ClusterIP"},
+		"debug":    false,
+	}
+	layers := []valuesLayer{
+		{source: "configMapKeyRef flux/defaults:values.yaml", values: helm.Values{
+			"image":    map[string]interface{}{"tag": "1.20"},
+			"replicas": 2,
+		}},
+		{source: "secretKeyRef flux/secrets:values.yaml", values: helm.Values{
+			"service": "none",
+			"token":   "secret",
+		}},
+		{source: "inline", values: helm.Values{
+			"replicas": 3,
+			"service":  map[string]interface{}{"type": "NodePort"},
+		}},
+	}
+
+	assert.Equal(t, map[string][]string{
+		"image":    {"chart default", "configMapKeyRef flux/defaults:values.yaml"},
+		"replicas": {"inline"},
+		"service":  {"inline"},
+		"debug":    {"chart default"},
+		"token":    {"secretKeyRef flux/secrets:values.yaml"},
+	}, valuesProvenance(chartDefaults, layers))
+}
+
+func TestReleaseValuesProvenance(t *testing.T) {
+	r := &Release{}
+	_, err := r.ValuesProvenance("flux", "podinfo")
+	assert.True(t, errors.IsNotFound(err))
+
+	provenance := map[string][]string{"replicas": {"inline"}}
+	r.provenances.set("flux", "podinfo", provenance)
+	got, err := r.ValuesProvenance("flux", "podinfo")
+	assert.NoError(t, err)
+	assert.Equal(t, provenance, got)
+
+	r.provenances.remove("flux", "podinfo")
+	_, err = r.ValuesProvenance("flux", "podinfo")
+	assert.True(t, errors.IsNotFound(err))
+}
+
+func TestComposeValuesSetValues(t *testing.T) {
+	inline := map[string]interface{}{
+		"image": map[string]interface{}{"tag": "1.0"},
+		"hosts": []interface{}{"a.local", "b.local"},
+	}
+	hr := &v1.HelmRelease{
+		Spec: v1.HelmReleaseSpec{
+			Values: v1.HelmValues{Data: inline},
+			SetValues: []v1.SetValue{
+				{Path: "image.tag", Value: "2.0"},
+				{Path: "replicas", Value: "3"},
+				{Path: "version", Value: "3", Type: v1.SetValueString},
+				{Path: "hosts[1]", Value: "c.local"},
+			},
+		},
+	}
+	hr.Namespace = "flux"
+
+	values, err := composeValues(fake.NewSimpleClientset().CoreV1(), nil, nil, hr, chart{}, Config{})
+	assert.NoError(t, err)
+	var hv helm.Values
+	assert.NoError(t, yaml.Unmarshal(values, &hv))
+	assert.Equal(t, helm.Values{
+		"image":    map[string]interface{}{"tag": "2.0"},
+		"hosts":    []interface{}{"a.local", "c.local"},
+		"replicas": float64(3),
+		"version":  "3",
+	}, hv)
+	// the inline values are not modified
+	assert.Equal(t, map[string]interface{}{"tag": "1.0"}, inline["image"])
+
+	hr.Spec.SetValues = []v1.SetValue{{Path: "image.tag", Value: "2.0", Type: "json"}}
+	_, err = composeValues(fake.NewSimpleClientset().CoreV1(), nil, nil, hr, chart{}, Config{})
+	assert.Error(t, err)
+}
+
+func TestComposeValuesOssValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oss-values")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "values.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("image:\n  repository: app\n  tag: \"1.0\"\n"), 0600))
+
+	ossValues, revision, err := readValuesFile(path)
+	assert.NoError(t, err)
+	assert.Len(t, revision, 12)
+
+	hr := &v1.HelmRelease{
+		Spec: v1.HelmReleaseSpec{
+			ChartSource: v1.ChartSource{Oss: &v1.Oss{Bucket: "charts", Key: "app/chart.tgz", ValuesKey: "app/values.yaml"}},
+			Values: v1.HelmValues{Data: map[string]interface{}{
+				"image": map[string]interface{}{"tag": "2.0"},
+			}},
+		},
+	}
+	hr.Namespace = "flux"
+
+	values, err := composeValues(fake.NewSimpleClientset().CoreV1(), nil, nil, hr, chart{values: ossValues}, Config{})
+	assert.NoError(t, err)
+	var hv helm.Values
+	assert.NoError(t, yaml.Unmarshal(values, &hv))
+	assert.Equal(t, helm.Values{"image": map[string]interface{}{"repository": "app", "tag": "2.0"}}, hv)
+}
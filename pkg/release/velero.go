@@ -0,0 +1,97 @@
+package release
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+// VeleroRestoreLabel is set by Velero on every object it restores,
+// with the name of the restore as value.
+const VeleroRestoreLabel = "velero.io/restore-name"
+
+// veleroRestoreGroupVersionResource is the resource of Velero restores.
+var veleroRestoreGroupVersionResource = schema.GroupVersionResource{
+	Group:    "velero.io",
+	Version:  "v1",
+	Resource: "restores",
+}
+
+// veleroRestoreDone are the phases of a Velero restore which has
+// finished restoring objects.
+var veleroRestoreDone = map[string]bool{
+	"Completed":        true,
+	"PartiallyFailed":  true,
+	"Failed":           true,
+	"FailedValidation": true,
+}
+
+// RestoreInProgress returns the name of the Velero restore which
+// restored the given HelmRelease, if it is still in progress. Until
+// the restore has finished, the Helm release storage Secrets may not
+// have been restored yet, and syncing the HelmRelease would install
+// the release a second time over the restored workloads. Once the
+// restore has finished, the restored release is upgraded as usual.
+func (r *Release) RestoreInProgress(hr *apiV1.HelmRelease) (string, error) {
+	name := hr.GetLabels()[VeleroRestoreLabel]
+	if name == "" {
+		return "", nil
+	}
+	list, err := r.dynamicClient.Resource(veleroRestoreGroupVersionResource).Namespace(metav1.NamespaceAll).List(metav1.ListOptions{
+		FieldSelector: "metadata.name=" + name,
+	})
+	switch {
+	case errors.IsNotFound(err):
+		// Velero is not installed (anymore)
+		return "", nil
+	case err != nil:
+		return "", fmt.Errorf("failed to get Velero restore '%s': %w", name, err)
+	}
+	for _, restore := range list.Items {
+		phase, _, _ := unstructured.NestedString(restore.Object, "status", "phase")
+		if !veleroRestoreDone[phase] {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+// ensureBackupLabels adds the configured backup labels to the given
+// HelmRelease, so that it is selected by Velero backups of operator
+// managed objects. Labels already set on the HelmRelease are kept.
+func (r *Release) ensureBackupLabels(hr *apiV1.HelmRelease) (*apiV1.HelmRelease, error) {
+	missing := make(map[string]string)
+	for k, v := range r.config.BackupLabels {
+		if _, ok := hr.GetLabels()[k]; !ok {
+			missing[k] = v
+		}
+	}
+	if len(missing) == 0 {
+		return hr, nil
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": missing},
+	})
+	if err != nil {
+		return hr, err
+	}
+	return r.hrClient.HelmReleases(hr.Namespace).Patch(hr.Name, types.MergePatchType, patch)
+}
+
+// backupLabels returns the labels of an operator managed object, with
+// the configured backup labels added.
+func (r *Release) backupLabels(labels map[string]string) map[string]string {
+	for k, v := range r.config.BackupLabels {
+		if _, ok := labels[k]; !ok {
+			labels[k] = v
+		}
+	}
+	return labels
+}
@@ -0,0 +1,66 @@
+package release
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+)
+
+func TestRestoreInProgress(t *testing.T) {
+	restore := func(phase string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion("velero.io/v1")
+		u.SetKind("Restore")
+		u.SetNamespace("velero")
+		u.SetName("restore-1")
+		unstructured.SetNestedField(u.Object, phase, "status", "phase")
+		return u
+	}
+	hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "podinfo"}}
+	restored := hr.DeepCopy()
+	restored.Labels = map[string]string{VeleroRestoreLabel: "restore-1"}
+
+	for _, tc := range []struct {
+		name    string
+		hr      *apiV1.HelmRelease
+		phase   string
+		restore string
+	}{
+		{name: "not restored", hr: hr, phase: "InProgress"},
+		{name: "in progress", hr: restored, phase: "InProgress", restore: "restore-1"},
+		{name: "new", hr: restored, phase: "", restore: "restore-1"},
+		{name: "completed", hr: restored, phase: "Completed"},
+		{name: "partially failed", hr: restored, phase: "PartiallyFailed"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &Release{dynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), restore(tc.phase))}
+			name, err := r.RestoreInProgress(tc.hr)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.restore, name)
+		})
+	}
+}
+
+func TestEnsureBackupLabels(t *testing.T) {
+	hr := &apiV1.HelmRelease{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "default",
+		Name:      "podinfo",
+		Labels:    map[string]string{"backup": "custom"},
+	}}
+	client := ifclientsetfake.NewSimpleClientset(hr)
+	r := &Release{hrClient: client.HelmV1(), config: Config{BackupLabels: map[string]string{"backup": "helm-operator", "team": "platform"}}}
+
+	updated, err := r.ensureBackupLabels(hr)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"backup": "custom", "team": "platform"}, updated.Labels)
+
+	assert.Equal(t, map[string]string{ExternalizedValuesLabel: "podinfo", "backup": "helm-operator", "team": "platform"},
+		r.backupLabels(map[string]string{ExternalizedValuesLabel: "podinfo"}))
+}
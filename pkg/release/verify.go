@@ -0,0 +1,161 @@
+package release
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/chartsync"
+	"github.com/lstack-org/helm-operator/pkg/helm"
+	"github.com/lstack-org/helm-operator/pkg/registry"
+)
+
+const (
+	// defaultKeyringKey is the key of the keyring in the Secret
+	// referenced by the verification options if no key is given.
+	defaultKeyringKey = "pubring.gpg"
+	// defaultCosignKeyKey is the key of the cosign public key in the
+	// Secret referenced by the verification options if no key is given.
+	defaultCosignKeyKey = "cosign.pub"
+)
+
+// verifyChart verifies the given chart of the HelmRelease: charts from
+// OCI registries against their cosign signature, other charts against
+// their provenance file, using the keys from the verification options
+// of the HelmRelease or the keys configured in the operator.
+func (r *Release) verifyChart(client helm.Client, hr *apiV1.HelmRelease, chart chart, ws *chartsync.Workspace) error {
+	source := hr.Spec.RepoChartSource
+	if source == nil {
+		return fmt.Errorf("chart verification failed: only charts from Helm repositories and OCI registries can be verified")
+	}
+	if isOCISource(source) {
+		if err := r.verifyCosign(hr); err != nil {
+			return fmt.Errorf("chart verification failed: %w", err)
+		}
+		return nil
+	}
+	keyring, err := r.keyring(hr, ws)
+	if err != nil {
+		return fmt.Errorf("chart verification failed: %w", err)
+	}
+	provPath, err := chartsync.ProvenancePath(r.config.ChartCache, chart.chartPath)
+	if err != nil {
+		return fmt.Errorf("chart verification failed: %w", err)
+	}
+	if err := client.VerifyChart(chart.chartPath, provPath, keyring); err != nil {
+		return fmt.Errorf("chart verification failed: %w", err)
+	}
+	return nil
+}
+
+// isOCISource returns if the chart of the given source is pulled from
+// an OCI registry.
+func isOCISource(source *apiV1.RepoChartSource) bool {
+	return strings.HasPrefix(source.RepoURL, "oci://")
+}
+
+// keyring returns the path to the keyring to verify the chart of the
+// HelmRelease against. Keyrings from Secrets are written to the
+// workspace.
+func (r *Release) keyring(hr *apiV1.HelmRelease, ws *chartsync.Workspace) (string, error) {
+	ref := hr.Spec.Verify.KeyringRef
+	if ref == nil {
+		if r.config.Keyring == "" {
+			return "", fmt.Errorf("no keyring configured")
+		}
+		return r.config.Keyring, nil
+	}
+	data, err := r.verificationKey(hr, ref, defaultKeyringKey)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(ws.Dir(), "keyring.gpg")
+	if err := ioutil.WriteFile(path, data, 00600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// verifyCosign verifies the cosign signature of the OCI chart of the
+// HelmRelease, using the credentials of its chart pull Secret.
+func (r *Release) verifyCosign(hr *apiV1.HelmRelease) error {
+	var data []byte
+	if ref := hr.Spec.Verify.CosignKeyRef; ref != nil {
+		var err error
+		if data, err = r.verificationKey(hr, ref, defaultCosignKeyKey); err != nil {
+			return err
+		}
+	} else {
+		if r.config.CosignKey == "" {
+			return fmt.Errorf("no cosign public key configured")
+		}
+		var err error
+		if data, err = ioutil.ReadFile(r.config.CosignKey); err != nil {
+			return fmt.Errorf("failed to read cosign public key: %w", err)
+		}
+	}
+	key, err := registry.ParsePublicKey(data)
+	if err != nil {
+		return err
+	}
+
+	source := hr.Spec.RepoChartSource
+	image := strings.TrimSuffix(strings.TrimPrefix(source.RepoURL, "oci://"), "/") + "/" + source.Name + ":" + source.Version
+	creds, err := r.registryCredentials(hr, image)
+	if err != nil {
+		return err
+	}
+	_, err = r.registry.VerifyCosign(image, creds, key)
+	return err
+}
+
+// registryCredentials returns the credentials for the registry of the
+// given image from the chart pull Secret of the HelmRelease: either a
+// Docker config, or a username and password.
+func (r *Release) registryCredentials(hr *apiV1.HelmRelease, image string) (map[string]registry.Credentials, error) {
+	ref := hr.Spec.RepoChartSource.ChartPullSecret
+	if ref == nil {
+		return nil, nil
+	}
+	secret, err := r.coreV1Client.Secrets(hr.Namespace).Get(ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get registry credentials: %w", err)
+	}
+	creds, err := registry.CredentialsFromSecret(secret)
+	if err != nil || creds != nil {
+		return creds, err
+	}
+	if len(secret.Data["username"]) == 0 {
+		return nil, nil
+	}
+	domain, _, _ := registry.ParseReference(image)
+	return map[string]registry.Credentials{
+		domain: {Username: string(secret.Data["username"]), Password: string(secret.Data["password"])},
+	}, nil
+}
+
+// verificationKey returns the data at the key of the Secret the given
+// selector refers to, which must be in the namespace of the
+// HelmRelease.
+func (r *Release) verificationKey(hr *apiV1.HelmRelease, ref *apiV1.SecretKeySelector, defaultKey string) ([]byte, error) {
+	if ref.Namespace != "" && ref.Namespace != hr.Namespace {
+		return nil, fmt.Errorf("key Secret '%s' must be in the namespace of the HelmRelease", ref.Name)
+	}
+	key := ref.Key
+	if key == "" {
+		key = defaultKey
+	}
+	secret, err := r.coreV1Client.Secrets(hr.Namespace).Get(ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key Secret '%s': %w", ref.Name, err)
+	}
+	data, ok := secret.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("key '%s' not found in Secret '%s'", key, ref.Name)
+	}
+	return data, nil
+}
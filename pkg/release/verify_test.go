@@ -0,0 +1,63 @@
+package release
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	apiV1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/chartsync"
+)
+
+func TestKeyring(t *testing.T) {
+	base, err := ioutil.TempDir("", "keyring")
+	assert.NoError(t, err)
+	defer os.RemoveAll(base)
+	ws, err := chartsync.NewWorkspace(base, "test", 0, nil)
+	assert.NoError(t, err)
+
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "keys", Namespace: "default"},
+		Data:       map[string][]byte{"pubring.gpg": []byte("default"), "other.gpg": []byte("other")},
+	})
+	r := &Release{coreV1Client: client.CoreV1(), config: Config{Keyring: "/etc/keyring.gpg"}}
+
+	for _, tc := range []struct {
+		name     string
+		ref      *apiV1.SecretKeySelector
+		expected string
+		wantErr  bool
+	}{
+		{"operator keyring", nil, "", false},
+		{"default key", &apiV1.SecretKeySelector{LocalObjectReference: apiV1.LocalObjectReference{Name: "keys"}}, "default", false},
+		{"key", &apiV1.SecretKeySelector{LocalObjectReference: apiV1.LocalObjectReference{Name: "keys"}, Key: "other.gpg"}, "other", false},
+		{"missing key", &apiV1.SecretKeySelector{LocalObjectReference: apiV1.LocalObjectReference{Name: "keys"}, Key: "missing"}, "", true},
+		{"missing Secret", &apiV1.SecretKeySelector{LocalObjectReference: apiV1.LocalObjectReference{Name: "missing"}}, "", true},
+		{"other namespace", &apiV1.SecretKeySelector{LocalObjectReference: apiV1.LocalObjectReference{Name: "keys"}, Namespace: "other"}, "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hr := &apiV1.HelmRelease{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+				Spec:       apiV1.HelmReleaseSpec{Verify: &apiV1.ChartVerification{KeyringRef: tc.ref}},
+			}
+			path, err := r.keyring(hr, ws)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			if tc.ref == nil {
+				assert.Equal(t, "/etc/keyring.gpg", path)
+				return
+			}
+			b, err := ioutil.ReadFile(path)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, string(b))
+		})
+	}
+}
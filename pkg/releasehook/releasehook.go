@@ -0,0 +1,297 @@
+/*
+Package releasehook notifies external systems, e.g. a CMDB or a cost
+allocation system, of the releases made by the operator, by posting
+the release metadata as JSON to the configured webhook URLs.
+
+Events are written to a spool directory before they are delivered,
+and are only removed once the endpoint acknowledged them with a 2xx
+response. Failed deliveries are retried with an exponential backoff,
+and spooled events are delivered after a restart of the operator, so
+that every event is delivered at least once. Endpoints may thus
+receive an event more than once, and should use the event ID to
+deduplicate. Events are delivered to every endpoint in the order
+they were fired.
+*/
+package releasehook
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+// Action is the release action an event is fired for.
+type Action string
+
+const (
+	Install   Action = "install"
+	Upgrade   Action = "upgrade"
+	Uninstall Action = "uninstall"
+)
+
+// Event holds the metadata of a release, as posted to the endpoints.
+type Event struct {
+	// ID uniquely identifies the event, and is the same for every
+	// delivery attempt.
+	ID        string    `json:"id"`
+	Action    Action    `json:"action"`
+	Timestamp time.Time `json:"timestamp"`
+	// Namespace and Name are those of the HelmRelease.
+	Namespace string            `json:"namespace"`
+	Name      string            `json:"name"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	// ReleaseName and TargetNamespace are those of the Helm release.
+	ReleaseName     string `json:"releaseName"`
+	TargetNamespace string `json:"targetNamespace"`
+	// Revision is the revision of the Helm release; it is omitted for
+	// uninstalls.
+	Revision     int    `json:"revision,omitempty"`
+	ChartName    string `json:"chartName,omitempty"`
+	ChartVersion string `json:"chartVersion,omitempty"`
+	AppVersion   string `json:"appVersion,omitempty"`
+	AppId        string `json:"appId,omitempty"`
+	ComponentId  string `json:"componentId,omitempty"`
+}
+
+// Config holds the configuration of the Dispatcher.
+type Config struct {
+	// URLs are the endpoints every event is posted to.
+	URLs []string
+	// SpoolDir is the directory events are kept in until they have
+	// been delivered. It should be on a persistent volume for events
+	// to survive the pod being rescheduled.
+	SpoolDir string
+	// Timeout is the timeout of a single delivery attempt.
+	Timeout time.Duration
+	// MinBackoff and MaxBackoff bound the delay between the delivery
+	// attempts of an event.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// WithDefaults sets the default values for the dispatcher config.
+func (c Config) WithDefaults() Config {
+	if c.Timeout == 0 {
+		c.Timeout = 10 * time.Second
+	}
+	if c.MinBackoff == 0 {
+		c.MinBackoff = time.Second
+	}
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = 5 * time.Minute
+	}
+	return c
+}
+
+// Dispatcher delivers the release events to the endpoints.
+type Dispatcher struct {
+	config    Config
+	client    *http.Client
+	logger    log.Logger
+	endpoints []*endpoint
+
+	mu  sync.Mutex
+	seq uint64
+}
+
+// endpoint holds the spool of a single webhook URL.
+type endpoint struct {
+	url    string
+	dir    string
+	notify chan struct{}
+}
+
+// NewDispatcher returns a new Dispatcher, creating the spool
+// directories of the endpoints.
+func NewDispatcher(config Config, logger log.Logger) (*Dispatcher, error) {
+	config = config.WithDefaults()
+	if config.SpoolDir == "" {
+		return nil, fmt.Errorf("a spool directory is required")
+	}
+	d := &Dispatcher{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+		logger: logger,
+	}
+	for _, u := range config.URLs {
+		sum := sha256.Sum256([]byte(u))
+		e := &endpoint{
+			url:    u,
+			dir:    filepath.Join(config.SpoolDir, hex.EncodeToString(sum[:8])),
+			notify: make(chan struct{}, 1),
+		}
+		if err := os.MkdirAll(e.dir, 00700); err != nil {
+			return nil, fmt.Errorf("failed to create spool directory for '%s': %w", u, err)
+		}
+		d.endpoints = append(d.endpoints, e)
+	}
+	return d, nil
+}
+
+// Fire spools the given event for delivery to every endpoint. The ID
+// and timestamp of the event are set if empty.
+func (d *Dispatcher) Fire(e Event) error {
+	if e.ID == "" {
+		id, err := newID()
+		if err != nil {
+			return err
+		}
+		e.ID = id
+	}
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now().UTC()
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.seq++
+	// names sort in the order events are fired, also across restarts
+	name := fmt.Sprintf("%020d-%06d-%s.json", e.Timestamp.UnixNano(), d.seq%1000000, e.ID)
+	for _, ep := range d.endpoints {
+		if err := writeFile(filepath.Join(ep.dir, name), b); err != nil {
+			return fmt.Errorf("failed to spool %s event for '%s': %w", e.Action, ep.url, err)
+		}
+		select {
+		case ep.notify <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Run delivers the spooled events to the endpoints until stop is
+// closed.
+func (d *Dispatcher) Run(stop <-chan struct{}, wg *sync.WaitGroup) {
+	for _, ep := range d.endpoints {
+		wg.Add(1)
+		go func(ep *endpoint) {
+			defer wg.Done()
+			d.deliverLoop(ep, stop)
+		}(ep)
+	}
+}
+
+// deliverLoop delivers the spooled events of the endpoint one by one,
+// retrying each event until it has been delivered.
+func (d *Dispatcher) deliverLoop(ep *endpoint, stop <-chan struct{}) {
+	backoff := d.config.MinBackoff
+	for {
+		path, err := nextSpooled(ep.dir)
+		if err != nil {
+			d.logger.Log("error", fmt.Sprintf("failed to read release hook spool: %v", err), "url", ep.url)
+		}
+		if path == "" {
+			select {
+			case <-stop:
+				return
+			case <-ep.notify:
+				continue
+			case <-time.After(d.config.MaxBackoff):
+				continue
+			}
+		}
+
+		if err = d.deliver(ep.url, path); err == nil {
+			backoff = d.config.MinBackoff
+			continue
+		}
+		d.logger.Log("warning", fmt.Sprintf("failed to deliver release hook, retrying in %s: %v", backoff, err),
+			"url", ep.url, "event", filepath.Base(path))
+		select {
+		case <-stop:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > d.config.MaxBackoff {
+			backoff = d.config.MaxBackoff
+		}
+	}
+}
+
+// deliver posts the spooled event at path to the URL, and removes it
+// from the spool once it has been acknowledged.
+func (d *Dispatcher) deliver(url, path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var e Event
+	if err := json.Unmarshal(b, &e); err != nil {
+		// an unreadable event will never be delivered, drop it
+		d.logger.Log("error", fmt.Sprintf("dropping malformed release hook event: %v", err), "event", filepath.Base(path))
+		return os.Remove(path)
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Helm-Operator-Event", string(e.Action))
+	req.Header.Set("X-Helm-Operator-Event-ID", e.ID)
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("endpoint responded with status %d", resp.StatusCode)
+	}
+	return os.Remove(path)
+}
+
+// nextSpooled returns the path to the oldest spooled event in dir, or
+// an empty string if there is none.
+func nextSpooled(dir string) (string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var names []string
+	for _, f := range files {
+		if f.Mode().IsRegular() && strings.HasSuffix(f.Name(), ".json") {
+			names = append(names, f.Name())
+		}
+	}
+	if len(names) == 0 {
+		return "", nil
+	}
+	sort.Strings(names)
+	return filepath.Join(dir, names[0]), nil
+}
+
+// writeFile writes the file atomically, so that a partially written
+// event is never delivered.
+func writeFile(path string, b []byte) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 00600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,81 @@
+package releasehook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispatcher(t *testing.T) {
+	spool, err := ioutil.TempDir("", "releasehook")
+	assert.NoError(t, err)
+	defer os.RemoveAll(spool)
+
+	var mu sync.Mutex
+	var attempts int
+	var received []Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		// fail the first attempt to exercise the retry
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var e Event
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&e))
+		assert.Equal(t, e.ID, r.Header.Get("X-Helm-Operator-Event-ID"))
+		received = append(received, e)
+	}))
+	defer srv.Close()
+
+	d, err := NewDispatcher(Config{
+		URLs:       []string{srv.URL},
+		SpoolDir:   spool,
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 50 * time.Millisecond,
+	}, log.NewNopLogger())
+	assert.NoError(t, err)
+
+	// events fired before the dispatcher runs are spooled
+	assert.NoError(t, d.Fire(Event{Action: Install, Namespace: "flux", Name: "podinfo", Revision: 1}))
+	assert.NoError(t, d.Fire(Event{Action: Upgrade, Namespace: "flux", Name: "podinfo", Revision: 2}))
+
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	d.Run(stop, wg)
+	assert.NoError(t, d.Fire(Event{Action: Uninstall, Namespace: "flux", Name: "podinfo"}))
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	close(stop)
+	wg.Wait()
+
+	var actions []Action
+	for _, e := range received {
+		assert.NotEmpty(t, e.ID)
+		actions = append(actions, e.Action)
+	}
+	assert.Equal(t, []Action{Install, Upgrade, Uninstall}, actions)
+
+	path, err := nextSpooled(d.endpoints[0].dir)
+	assert.NoError(t, err)
+	assert.Empty(t, path)
+}
+
+func TestDispatcherRequiresSpoolDir(t *testing.T) {
+	_, err := NewDispatcher(Config{URLs: []string{"http://example.com"}}, log.NewNopLogger())
+	assert.Error(t, err)
+}
@@ -0,0 +1,134 @@
+/*
+Package resolver resolves the hosts of chart sources using the static
+host aliases and name servers configured in the operator, so that Helm
+repositories and object storage endpoints which are only resolvable in
+internal DNS zones can be reached without changing the DNS config of
+the operator pod.
+*/
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Resolver dials addresses by resolving their hosts using the host
+// aliases first, and the name servers otherwise. Without name servers
+// the system resolver is used.
+type Resolver struct {
+	aliases  map[string][]string
+	resolver *net.Resolver
+	dialer   *net.Dialer
+}
+
+// New returns a new Resolver for the given host aliases, by host, and
+// name servers in the form `ip:port`.
+func New(aliases map[string][]string, nameservers []string) *Resolver {
+	resolver := net.DefaultResolver
+	if len(nameservers) > 0 {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial:     dialNameservers(nameservers),
+		}
+	}
+	normalized := make(map[string][]string, len(aliases))
+	for host, ips := range aliases {
+		normalized[strings.ToLower(host)] = ips
+	}
+	return &Resolver{
+		aliases:  normalized,
+		resolver: resolver,
+		dialer: &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Resolver:  resolver,
+		},
+	}
+}
+
+// ParseHostAliases parses the given host aliases in the form
+// `host=ip[;ip...]` into IPs by host.
+func ParseHostAliases(aliases []string) (map[string][]string, error) {
+	parsed := make(map[string][]string, len(aliases))
+	for _, alias := range aliases {
+		i := strings.Index(alias, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid host alias '%s', expected host=ip[;ip...]", alias)
+		}
+		host := strings.ToLower(alias[:i])
+		for _, ip := range strings.Split(alias[i+1:], ";") {
+			if net.ParseIP(ip) == nil {
+				return nil, fmt.Errorf("invalid IP '%s' in host alias '%s'", ip, alias)
+			}
+			parsed[host] = append(parsed[host], ip)
+		}
+	}
+	return parsed, nil
+}
+
+// ParseNameservers validates the given name servers in the form
+// `ip[:port]`, and returns them with the default DNS port added where
+// it is missing.
+func ParseNameservers(nameservers []string) ([]string, error) {
+	var parsed []string
+	for _, ns := range nameservers {
+		host, port, err := net.SplitHostPort(ns)
+		if err != nil {
+			host, port = ns, "53"
+		}
+		if net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("invalid name server '%s', expected ip[:port]", ns)
+		}
+		parsed = append(parsed, net.JoinHostPort(host, port))
+	}
+	return parsed, nil
+}
+
+// DialContext connects to the address on the named network, resolving
+// the host of the address using the host aliases and name servers.
+func (r *Resolver) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	ips, ok := r.aliases[strings.ToLower(host)]
+	if !ok {
+		return r.dialer.DialContext(ctx, network, address)
+	}
+	for _, ip := range ips {
+		var conn net.Conn
+		if conn, err = r.dialer.DialContext(ctx, network, net.JoinHostPort(ip, port)); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// Transport returns a clone of the default HTTP transport which dials
+// using the resolver, for the clients of the operator requesting chart
+// sources. The default transport itself is left alone.
+func (r *Resolver) Transport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = r.DialContext
+	return t
+}
+
+// dialNameservers returns a dial func for a net.Resolver which dials
+// the given name servers in order until a connection is made.
+func dialNameservers(nameservers []string) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, _ string) (net.Conn, error) {
+		var d net.Dialer
+		var err error
+		for _, ns := range nameservers {
+			var conn net.Conn
+			if conn, err = d.DialContext(ctx, network, ns); err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
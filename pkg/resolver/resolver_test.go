@@ -0,0 +1,67 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHostAliases(t *testing.T) {
+	aliases, err := ParseHostAliases([]string{"charts.internal=10.0.0.1;10.0.0.2", "OSS.internal=fd00::1"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"charts.internal": {"10.0.0.1", "10.0.0.2"},
+		"oss.internal":    {"fd00::1"},
+	}, aliases)
+
+	for _, invalid := range []string{"charts.internal", "=10.0.0.1", "charts.internal=not-an-ip"} {
+		_, err := ParseHostAliases([]string{invalid})
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestParseNameservers(t *testing.T) {
+	nameservers, err := ParseNameservers([]string{"10.0.0.10", "10.0.0.11:5353", "fd00::10", "[fd00::11]:5353"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.10:53", "10.0.0.11:5353", "[fd00::10]:53", "[fd00::11]:5353"}, nameservers)
+
+	_, err = ParseNameservers([]string{"dns.internal"})
+	assert.Error(t, err)
+}
+
+func TestDialContext(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	r := New(map[string][]string{"Charts.Internal": {"127.0.0.1"}}, nil)
+	conn, err := r.DialContext(context.Background(), "tcp", net.JoinHostPort("charts.internal", port))
+	if assert.NoError(t, err) {
+		assert.Equal(t, l.Addr().String(), conn.RemoteAddr().String())
+		conn.Close()
+	}
+}
+
+func TestTransport(t *testing.T) {
+	defaultDial := http.DefaultTransport.(*http.Transport).DialContext
+	r := New(map[string][]string{"charts.internal": {"127.0.0.1"}}, []string{"127.0.0.1:53"})
+	transport := r.Transport()
+	assert.NotNil(t, transport.DialContext)
+	// the default transport and resolver are left alone
+	assert.Equal(t, fmt.Sprintf("%p", defaultDial), fmt.Sprintf("%p", http.DefaultTransport.(*http.Transport).DialContext))
+	assert.False(t, net.DefaultResolver.PreferGo)
+}
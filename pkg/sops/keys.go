@@ -0,0 +1,120 @@
+package sops
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"go.mozilla.org/sops/v3/keyservice"
+	"golang.org/x/crypto/openpgp"
+	pgparmor "golang.org/x/crypto/openpgp/armor"
+	"google.golang.org/grpc"
+)
+
+const (
+	// AgeKeySuffix is the suffix of the keys of a Secret holding age
+	// identities, one per line.
+	AgeKeySuffix = ".agekey"
+	// PGPKeySuffix is the suffix of the keys of a Secret holding an
+	// armored PGP private key ring.
+	PGPKeySuffix = ".asc"
+)
+
+// Keys holds the private keys to decrypt the data key of SOPS
+// documents with.
+type Keys struct {
+	age []age.Identity
+	pgp openpgp.EntityList
+}
+
+// ParseKeys parses the age identities and PGP private keys in the data
+// of a Secret, from the keys ending with AgeKeySuffix and PGPKeySuffix
+// respectively. PGP keys must not be protected with a passphrase.
+func ParseKeys(data map[string][]byte) (*Keys, error) {
+	var names []string
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	keys := &Keys{}
+	for _, name := range names {
+		switch {
+		case strings.HasSuffix(name, AgeKeySuffix):
+			ids, err := age.ParseIdentities(bytes.NewReader(data[name]))
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse age identities in %s: %w", name, err)
+			}
+			keys.age = append(keys.age, ids...)
+		case strings.HasSuffix(name, PGPKeySuffix):
+			entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data[name]))
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse PGP keys in %s: %w", name, err)
+			}
+			keys.pgp = append(keys.pgp, entities...)
+		}
+	}
+	if len(keys.age) == 0 && len(keys.pgp) == 0 {
+		return nil, fmt.Errorf("no keys ending with %s or %s", AgeKeySuffix, PGPKeySuffix)
+	}
+	return keys, nil
+}
+
+// keyService is an in-process SOPS key service decrypting the data
+// keys encrypted for age and PGP master keys with the given keys.
+type keyService struct {
+	keys *Keys
+}
+
+func (s keyService) Encrypt(context.Context, *keyservice.EncryptRequest, ...grpc.CallOption) (*keyservice.EncryptResponse, error) {
+	return nil, errors.New("encryption is not supported")
+}
+
+func (s keyService) Decrypt(_ context.Context, req *keyservice.DecryptRequest, _ ...grpc.CallOption) (*keyservice.DecryptResponse, error) {
+	var plaintext []byte
+	var err error
+	switch req.Key.KeyType.(type) {
+	case *keyservice.Key_AgeKey:
+		plaintext, err = s.keys.decryptAge(req.Ciphertext)
+	case *keyservice.Key_PgpKey:
+		plaintext, err = s.keys.decryptPGP(req.Ciphertext)
+	default:
+		err = errors.New("only age and PGP master keys are supported")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &keyservice.DecryptResponse{Plaintext: plaintext}, nil
+}
+
+func (k *Keys) decryptAge(enc []byte) ([]byte, error) {
+	if len(k.age) == 0 {
+		return nil, errors.New("no age identities")
+	}
+	r, err := age.Decrypt(armor.NewReader(bytes.NewReader(enc)), k.age...)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+func (k *Keys) decryptPGP(enc []byte) ([]byte, error) {
+	if len(k.pgp) == 0 {
+		return nil, errors.New("no PGP keys")
+	}
+	block, err := pgparmor.Decode(bytes.NewReader(enc))
+	if err != nil {
+		return nil, err
+	}
+	md, err := openpgp.ReadMessage(block.Body, k.pgp, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(md.UnverifiedBody)
+}
@@ -0,0 +1,63 @@
+/*
+Package sops decrypts YAML and JSON documents encrypted with SOPS
+(https://github.com/mozilla/sops), using the SOPS libraries. The data
+key is decrypted by an in-process key service with the age identities
+and PGP private keys of a Secret, never with keys of the environment
+of the operator; cloud KMS and Vault master keys are not supported.
+*/
+package sops
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mozilla.org/sops/v3/aes"
+	"go.mozilla.org/sops/v3/keyservice"
+	sopsyaml "go.mozilla.org/sops/v3/stores/yaml"
+	"gopkg.in/yaml.v2"
+)
+
+// IsEncrypted returns if the given YAML or JSON document is encrypted
+// with SOPS, i.e. has SOPS metadata with a MAC.
+func IsEncrypted(b []byte) bool {
+	var doc struct {
+		SOPS *struct {
+			MAC string `yaml:"mac"`
+		} `yaml:"sops"`
+	}
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return false
+	}
+	return doc.SOPS != nil && doc.SOPS.MAC != ""
+}
+
+// Decrypt decrypts the given SOPS encrypted YAML or JSON document with
+// the keys, verifying its MAC, and returns it as YAML without the SOPS
+// metadata.
+func Decrypt(b []byte, keys *Keys) ([]byte, error) {
+	// JSON documents are parsed as YAML, which they are a subset of
+	store := &sopsyaml.Store{}
+	tree, err := store.LoadEncryptedFile(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse document: %w", err)
+	}
+	dataKey, err := tree.Metadata.GetDataKeyWithKeyServices([]keyservice.KeyServiceClient{keyService{keys: keys}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt the data key: %w", err)
+	}
+
+	cipher := aes.NewCipher()
+	mac, err := tree.Decrypt(dataKey, cipher)
+	if err != nil {
+		return nil, err
+	}
+	originalMAC, err := cipher.Decrypt(tree.Metadata.MessageAuthenticationCode, dataKey, tree.Metadata.LastModified.Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt MAC: %w", err)
+	}
+	if originalMAC != mac {
+		return nil, errors.New("MAC mismatch, the document was tampered with")
+	}
+	return store.EmitPlainFile(tree.Branches)
+}
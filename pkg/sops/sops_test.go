@@ -0,0 +1,160 @@
+package sops
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/stretchr/testify/assert"
+	sopsv3 "go.mozilla.org/sops/v3"
+	"go.mozilla.org/sops/v3/aes"
+	sopsage "go.mozilla.org/sops/v3/age"
+	"go.mozilla.org/sops/v3/keys"
+	"go.mozilla.org/sops/v3/pgp"
+	sopsyaml "go.mozilla.org/sops/v3/stores/yaml"
+	"golang.org/x/crypto/openpgp"
+	pgparmor "golang.org/x/crypto/openpgp/armor"
+	// the default hash of openpgp.Encrypt
+	_ "golang.org/x/crypto/ripemd160"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+func TestDecryptAge(t *testing.T) {
+	identity, recipient := newAgeIdentity(t)
+	keys, err := ParseKeys(map[string][]byte{"identity.agekey": []byte("# created: today\n" + identity + "\n")})
+	assert.NoError(t, err)
+
+	dataKey := randomBytes(t, 32)
+	doc := encrypt(t, dataKey, `image:
+  repository: nginx
+  tag_unencrypted: "1.17"
+database:
+  password: s3cr3t
+  port: 5432
+  ssl: true
+hosts:
+- a.example.com
+- b.example.com
+`, &sopsage.MasterKey{Recipient: recipient, EncryptedKey: ageEncrypt(t, recipient, dataKey)})
+	assert.True(t, IsEncrypted(doc))
+	assert.NotContains(t, string(doc), "s3cr3t")
+
+	out, err := Decrypt(doc, keys)
+	assert.NoError(t, err)
+	var values map[string]interface{}
+	assert.NoError(t, sigsyaml.Unmarshal(out, &values))
+	assert.Equal(t, map[string]interface{}{
+		"image":    map[string]interface{}{"repository": "nginx", "tag_unencrypted": "1.17"},
+		"database": map[string]interface{}{"password": "s3cr3t", "port": float64(5432), "ssl": true},
+		"hosts":    []interface{}{"a.example.com", "b.example.com"},
+	}, values)
+
+	// values which are changed without the data key fail the MAC
+	tampered := bytes.Replace(doc, []byte(`tag_unencrypted: "1.17"`), []byte(`tag_unencrypted: "1.18"`), 1)
+	_, err = Decrypt(tampered, keys)
+	assert.Error(t, err)
+
+	other, _ := newAgeIdentity(t)
+	otherKeys, err := ParseKeys(map[string][]byte{"other.agekey": []byte(other)})
+	assert.NoError(t, err)
+	_, err = Decrypt(doc, otherKeys)
+	assert.Error(t, err)
+}
+
+func TestDecryptPGP(t *testing.T) {
+	entity, err := openpgp.NewEntity("helm-operator", "", "helm-operator@example.com", nil)
+	assert.NoError(t, err)
+	var private bytes.Buffer
+	w, err := pgparmor.Encode(&private, openpgp.PrivateKeyType, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, entity.SerializePrivate(w, nil))
+	assert.NoError(t, w.Close())
+	keys, err := ParseKeys(map[string][]byte{"sops.asc": private.Bytes()})
+	assert.NoError(t, err)
+
+	dataKey := randomBytes(t, 32)
+	var enc bytes.Buffer
+	aw, err := pgparmor.Encode(&enc, "PGP MESSAGE", nil)
+	assert.NoError(t, err)
+	pw, err := openpgp.Encrypt(aw, openpgp.EntityList{entity}, nil, nil, nil)
+	assert.NoError(t, err)
+	_, err = pw.Write(dataKey)
+	assert.NoError(t, err)
+	assert.NoError(t, pw.Close())
+	assert.NoError(t, aw.Close())
+
+	doc := encrypt(t, dataKey, "password: s3cr3t\n",
+		&pgp.MasterKey{Fingerprint: fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint), EncryptedKey: enc.String()})
+	out, err := Decrypt(doc, keys)
+	assert.NoError(t, err)
+	assert.Equal(t, "password: s3cr3t\n", string(out))
+}
+
+func TestParseKeys(t *testing.T) {
+	_, err := ParseKeys(map[string][]byte{"values.yaml": []byte("foo: bar")})
+	assert.Error(t, err)
+	_, err = ParseKeys(map[string][]byte{"identity.agekey": []byte("AGE-SECRET-KEY-1INVALID")})
+	assert.Error(t, err)
+	assert.False(t, IsEncrypted([]byte("foo: bar\n")))
+}
+
+// encrypt encrypts the values of the given document with the data key
+// using the SOPS libraries, leaving the values of keys with the
+// unencrypted suffix in plain text, and adds the metadata with the
+// given master keys, which hold the encrypted data key.
+func encrypt(t *testing.T, dataKey []byte, plain string, masterKeys ...keys.MasterKey) []byte {
+	store := &sopsyaml.Store{}
+	branches, err := store.LoadPlainFile([]byte(plain))
+	assert.NoError(t, err)
+	tree := sopsv3.Tree{
+		Branches: branches,
+		Metadata: sopsv3.Metadata{
+			KeyGroups:         []sopsv3.KeyGroup{masterKeys},
+			UnencryptedSuffix: "_unencrypted",
+			Version:           "3.7.3",
+		},
+	}
+	cipher := aes.NewCipher()
+	mac, err := tree.Encrypt(dataKey, cipher)
+	assert.NoError(t, err)
+	tree.Metadata.LastModified = time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	tree.Metadata.MessageAuthenticationCode, err = cipher.Encrypt(mac, dataKey, tree.Metadata.LastModified.Format(time.RFC3339))
+	assert.NoError(t, err)
+	out, err := store.EmitEncryptedFile(tree)
+	assert.NoError(t, err)
+	return out
+}
+
+// ageEncrypt encrypts the plain text to the recipient, as an armored
+// age file.
+func ageEncrypt(t *testing.T, recipient string, plaintext []byte) string {
+	r, err := age.ParseX25519Recipient(recipient)
+	assert.NoError(t, err)
+	var out bytes.Buffer
+	aw := armor.NewWriter(&out)
+	w, err := age.Encrypt(aw, r)
+	assert.NoError(t, err)
+	_, err = w.Write(plaintext)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	assert.NoError(t, aw.Close())
+	return out.String()
+}
+
+// newAgeIdentity returns a new age identity and its recipient.
+func newAgeIdentity(t *testing.T) (string, string) {
+	id, err := age.GenerateX25519Identity()
+	assert.NoError(t, err)
+	return id.String(), id.Recipient().String()
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	assert.NoError(t, err)
+	return b
+}
@@ -42,6 +42,7 @@ func SetConditions(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, con
 				condition.LastTransitionTime = currCondition.LastTransitionTime
 			}
 
+			condition.ObservedGeneration = hr.Generation
 			cHr.Status.Conditions = append(filterOutCondition(cHr.Status.Conditions, condition.Type), condition)
 			switch {
 			case condition.Type == v1.HelmReleaseReleased && condition.Status == v1.ConditionTrue:
@@ -54,9 +55,13 @@ func SetConditions(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, con
 		for _, setter := range setters {
 			setter(cHr)
 		}
+		setStandardConditions(cHr)
 
 		ObserveReleaseConditions(hr, cHr)
 		_, err = client.UpdateStatus(cHr)
+		if err == nil && len(conditions) > 0 {
+			recordPhaseTransition(hr, cHr, conditions[0])
+		}
 		firstTry = false
 		return
 	})
@@ -74,6 +79,37 @@ func SetStatusPhase(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, ph
 	return SetConditions(client, hr, conditions, setters...)
 }
 
+// SetStatusPhaseWithReason sets the phase like SetStatusPhase, with
+// the given reason code on the conditions instead of the phase.
+func SetStatusPhaseWithReason(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, phase v1.HelmReleasePhase, reason string) error {
+	conditions, ok := ConditionsForPhase(hr, phase)
+	if !ok {
+		return nil
+	}
+	for i := range conditions {
+		conditions[i].Reason = reason
+	}
+	return SetConditions(client, hr, conditions, func(cHr *v1.HelmRelease) {
+		cHr.Status.Phase = phase
+	})
+}
+
+// SetStatusPhaseWithMessage sets the phase like
+// SetStatusPhaseWithReason, with the given message on the conditions.
+func SetStatusPhaseWithMessage(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, phase v1.HelmReleasePhase, reason, message string) error {
+	conditions, ok := ConditionsForPhase(hr, phase)
+	if !ok {
+		return nil
+	}
+	for i := range conditions {
+		conditions[i].Reason = reason
+		conditions[i].Message = message
+	}
+	return SetConditions(client, hr, conditions, func(cHr *v1.HelmRelease) {
+		cHr.Status.Phase = phase
+	})
+}
+
 func SetStatusPhaseWithRevision(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, phase v1.HelmReleasePhase, revision string) error {
 	return SetStatusPhase(client, hr, phase, func(cHr *v1.HelmRelease) {
 		switch {
@@ -85,6 +121,105 @@ func SetStatusPhaseWithRevision(client v1client.HelmReleaseInterface, hr *v1.Hel
 	})
 }
 
+// SetSuspended sets the Suspended condition of the HelmRelease when
+// suspended is true, and removes it otherwise.
+func SetSuspended(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, suspended bool) error {
+	var message string
+	if suspended {
+		message = fmt.Sprintf(`Reconciliation is suspended for Helm release '%s' in '%s'.`, hr.GetReleaseName(), hr.GetTargetNamespace())
+	}
+	return setOrRemoveCondition(client, hr, v1.HelmReleaseSuspended, message)
+}
+
+// SetDependencyNotReady sets the DependencyNotReady condition of the
+// HelmRelease with the given message, or removes it if the message is
+// empty.
+func SetDependencyNotReady(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, message string) error {
+	return setOrRemoveCondition(client, hr, v1.HelmReleaseDependencyNotReady, message)
+}
+
+// SetPostRenderFailed sets the PostRenderFailed condition of the
+// HelmRelease with the given message, or removes it if the message is
+// empty.
+func SetPostRenderFailed(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, message string) error {
+	return setOrRemoveCondition(client, hr, v1.HelmReleasePostRenderFailed, message)
+}
+
+// SetFrozenPendingChanges sets the FrozenPendingChanges condition of
+// the HelmRelease with the given message, or removes it if the message
+// is empty.
+func SetFrozenPendingChanges(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, message string) error {
+	return setOrRemoveCondition(client, hr, v1.HelmReleaseFrozenPendingChanges, message)
+}
+
+// SetHalted sets the Halted condition of the HelmRelease with the
+// given message, or removes it if the message is empty.
+func SetHalted(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, message string) error {
+	return setOrRemoveCondition(client, hr, v1.HelmReleaseHalted, message)
+}
+
+// SetResourcesMissing sets the ResourcesMissing condition of the
+// HelmRelease with the given message, or removes it if the message is
+// empty.
+func SetResourcesMissing(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, message string) error {
+	return setOrRemoveCondition(client, hr, v1.HelmReleaseResourcesMissing, message)
+}
+
+// SetSkipped sets the Reconciling condition of the HelmRelease to
+// false with the given reason and message, or removes it if the
+// message is empty.
+func SetSkipped(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, reason, message string) error {
+	current := GetCondition(hr.Status, v1.HelmReleaseReconciling)
+	if message == "" {
+		if current == nil {
+			return nil
+		}
+		return SetConditions(client, hr, nil, func(cHr *v1.HelmRelease) {
+			cHr.Status.Conditions = filterOutCondition(cHr.Status.Conditions, v1.HelmReleaseReconciling)
+		})
+	}
+	if current != nil && current.Status == v1.ConditionFalse && current.Reason == reason && current.Message == message {
+		return nil
+	}
+	nowTime := metav1.NewTime(Clock.Now())
+	return SetConditions(client, hr, []v1.HelmReleaseCondition{{
+		Type:               v1.HelmReleaseReconciling,
+		Status:             v1.ConditionFalse,
+		LastUpdateTime:     &nowTime,
+		LastTransitionTime: &nowTime,
+		Reason:             reason,
+		Message:            message,
+	}})
+}
+
+// setOrRemoveCondition sets the condition of the given type to true
+// with the given message, or removes it if the message is empty.
+func setOrRemoveCondition(client v1client.HelmReleaseInterface, hr *v1.HelmRelease,
+	conditionType v1.HelmReleaseConditionType, message string) error {
+
+	current := GetCondition(hr.Status, conditionType)
+	if message == "" {
+		if current == nil {
+			return nil
+		}
+		return SetConditions(client, hr, nil, func(cHr *v1.HelmRelease) {
+			cHr.Status.Conditions = filterOutCondition(cHr.Status.Conditions, conditionType)
+		})
+	}
+	if current != nil && current.Status == v1.ConditionTrue && current.Message == message {
+		return nil
+	}
+	nowTime := metav1.NewTime(Clock.Now())
+	return SetConditions(client, hr, []v1.HelmReleaseCondition{{
+		Type:               conditionType,
+		Status:             v1.ConditionTrue,
+		LastUpdateTime:     &nowTime,
+		LastTransitionTime: &nowTime,
+		Reason:             string(conditionType),
+		Message:            message,
+	}})
+}
+
 // ConditionsForPhrase returns conditions for the given phase.
 func ConditionsForPhase(hr *v1.HelmRelease, phase v1.HelmReleasePhase) ([]v1.HelmReleaseCondition, bool) {
 	condition := &v1.HelmReleaseCondition{}
@@ -166,6 +301,20 @@ func ConditionsForPhase(hr *v1.HelmRelease, phase v1.HelmReleasePhase) ([]v1.Hel
 			Status:  v1.ConditionFalse,
 			Message: message,
 		})
+	case v1.HelmReleasePhaseChartVerificationFailed:
+		message := fmt.Sprintf(`Chart verification failed for Helm release '%s' in '%s'.`, hr.GetReleaseName(), hr.GetTargetNamespace())
+		condition.Type = v1.HelmReleaseChartFetched
+		condition.Status = v1.ConditionFalse
+		condition.Message = message
+		conditions = append(conditions, &v1.HelmReleaseCondition{
+			Type:    v1.HelmReleaseReleased,
+			Status:  v1.ConditionFalse,
+			Message: message,
+		})
+	case v1.HelmReleasePhaseValuesValidationFailed:
+		condition.Type = v1.HelmReleaseReleased
+		condition.Status = v1.ConditionFalse
+		condition.Message = fmt.Sprintf(`Values validation failed for Helm release '%s' in '%s'.`, hr.GetReleaseName(), hr.GetTargetNamespace())
 	default:
 		return []v1.HelmReleaseCondition{}, false
 	}
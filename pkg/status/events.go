@@ -0,0 +1,47 @@
+package status
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+// recorder is the recorder used to emit Events for the phase
+// transitions of HelmReleases, no Events are emitted if it is nil.
+var recorder record.EventRecorder
+
+// SetEventRecorder sets the recorder used to emit Events for the
+// phase transitions of HelmReleases.
+func SetEventRecorder(r record.EventRecorder) {
+	recorder = r
+}
+
+// recordPhaseTransition emits an Event for the transition of the old
+// HelmRelease to the phase of the new HelmRelease, if it has
+// transitioned. The reason of the Event is the reason of the given
+// condition of the phase if it has one, or else the phase itself,
+// and it is a warning if the condition is false.
+func recordPhaseTransition(old, new *v1.HelmRelease, condition v1.HelmReleaseCondition) {
+	if recorder == nil || new.Status.Phase == "" || old.Status.Phase == new.Status.Phase {
+		return
+	}
+	eventType := corev1.EventTypeNormal
+	if condition.Status == v1.ConditionFalse {
+		eventType = corev1.EventTypeWarning
+	}
+	reason := condition.Reason
+	if reason == "" {
+		reason = string(new.Status.Phase)
+	}
+	message := fmt.Sprintf("Phase transitioned to %s", new.Status.Phase)
+	if old.Status.Phase != "" {
+		message = fmt.Sprintf("Phase transitioned from %s to %s", old.Status.Phase, new.Status.Phase)
+	}
+	if condition.Message != "" {
+		message = fmt.Sprintf("%s: %s", message, condition.Message)
+	}
+	recorder.Event(new, eventType, reason, message)
+}
@@ -0,0 +1,43 @@
+package status
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+)
+
+func TestPhaseTransitionEvents(t *testing.T) {
+	fakeRecorder := record.NewFakeRecorder(10)
+	SetEventRecorder(fakeRecorder)
+	defer SetEventRecorder(nil)
+
+	hr := &v1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "podinfo"}}
+	client := ifclientsetfake.NewSimpleClientset(hr).HelmV1().HelmReleases(hr.Namespace)
+	get := func() *v1.HelmRelease {
+		hr, err := client.Get(hr.Name, metav1.GetOptions{})
+		assert.NoError(t, err)
+		return hr
+	}
+
+	assert.NoError(t, SetStatusPhase(client, hr, v1.HelmReleasePhaseUpgrading))
+	hr = get()
+	// the phase has not transitioned
+	assert.NoError(t, SetStatusPhase(client, hr, v1.HelmReleasePhaseUpgrading))
+	hr = get()
+	assert.NoError(t, SetStatusPhaseWithReason(client, hr, v1.HelmReleasePhaseDeployFailed, v1.ReasonHelmUpgradeFailed))
+
+	close(fakeRecorder.Events)
+	var events []string
+	for e := range fakeRecorder.Events {
+		events = append(events, e)
+	}
+	assert.Equal(t, []string{
+		"Normal Upgrading Phase transitioned to Upgrading: Running upgrade for Helm release 'default-podinfo' in 'default'.",
+		"Warning HelmUpgradeFailed Phase transitioned from Upgrading to DeployFailed: Installation or upgrade failed for Helm release 'default-podinfo' in 'default'.",
+	}, events)
+}
@@ -2,6 +2,7 @@ package status
 
 import (
 	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/metrics"
 	stdprometheus "github.com/prometheus/client_golang/prometheus"
 )
 
@@ -9,6 +10,7 @@ const (
 	LabelTargetNamespace = "target_namespace"
 	LabelReleaseName     = "release_name"
 	LabelCondition       = "condition"
+	LabelImage           = "image"
 )
 
 var (
@@ -23,12 +25,24 @@ var (
 		Name:      "release_condition_info",
 		Help:      "Current HelmRelease condition status. Values are -1 (false), 0 (unknown or absent), 1 (true)",
 	}, []string{LabelTargetNamespace, LabelReleaseName, LabelCondition})
+	releaseImage = stdprometheus.NewGaugeVec(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "release_image_info",
+		Help:      "Container images run by the workloads of a HelmRelease. The value is always 1.",
+	}, []string{LabelTargetNamespace, LabelReleaseName, LabelImage})
 )
 
 func init() {
 	stdprometheus.MustRegister(releaseCondition)
+	stdprometheus.MustRegister(releaseImage)
 }
 
+// ObserveReleaseConditions records the conditions of the new
+// HelmRelease, and removes conditions of the old HelmRelease which
+// are no longer present. The conditions are recorded for every
+// release, regardless of the release labels configuration, as the
+// generated alerting rules select them by release name.
 func ObserveReleaseConditions(old *v1.HelmRelease, new *v1.HelmRelease) {
 	conditions := make(map[v1.HelmReleaseConditionType]*v1.ConditionStatus)
 
@@ -58,3 +72,34 @@ func labelsForRelease(hr *v1.HelmRelease, conditionType v1.HelmReleaseConditionT
 		LabelCondition:       string(conditionType),
 	}
 }
+
+// ObserveReleaseImages records the images of the new HelmRelease,
+// and removes images of the old HelmRelease which are no longer
+// present. The new HelmRelease may be nil, e.g. when it has been
+// deleted. The images can not be aggregated, so they are only
+// recorded for releases with fine-grained metrics.
+func ObserveReleaseImages(old *v1.HelmRelease, new *v1.HelmRelease) {
+	if !metrics.FineGrained(old.GetTargetNamespace(), old.GetReleaseName()) {
+		return
+	}
+	images := make(map[string]bool)
+	if new != nil {
+		for _, image := range new.Status.Images {
+			images[image] = true
+			releaseImage.With(imageLabelsForRelease(new, image)).Set(1)
+		}
+	}
+	for _, image := range old.Status.Images {
+		if !images[image] {
+			releaseImage.Delete(imageLabelsForRelease(old, image))
+		}
+	}
+}
+
+func imageLabelsForRelease(hr *v1.HelmRelease, image string) stdprometheus.Labels {
+	return stdprometheus.Labels{
+		LabelTargetNamespace: hr.GetTargetNamespace(),
+		LabelReleaseName:     hr.GetReleaseName(),
+		LabelImage:           image,
+	}
+}
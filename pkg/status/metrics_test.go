@@ -0,0 +1,30 @@
+package status
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	"github.com/lstack-org/helm-operator/pkg/metrics"
+)
+
+func TestObserveReleaseConditionsAggregated(t *testing.T) {
+	metrics.Install(metrics.ReleaseLabels{Mode: metrics.ReleaseLabelNamespace})
+	defer metrics.Install(metrics.ReleaseLabels{Mode: metrics.ReleaseLabelFull})
+
+	old := &v1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "podinfo"}}
+	hr := old.DeepCopy()
+	hr.Status.Conditions = []v1.HelmReleaseCondition{{Type: v1.HelmReleaseReleased, Status: v1.ConditionFalse}}
+	hr.Status.Images = []string{"stefanprodan/podinfo:3.2.0"}
+
+	ObserveReleaseConditions(old, hr)
+	ObserveReleaseImages(old, hr)
+	defer ObserveReleaseConditions(hr, nil)
+
+	// the alerting rules select the condition gauge by release name
+	assert.Equal(t, float64(-1), testutil.ToFloat64(releaseCondition.With(labelsForRelease(hr, v1.HelmReleaseReleased))))
+	assert.False(t, releaseImage.Delete(imageLabelsForRelease(hr, hr.Status.Images[0])))
+}
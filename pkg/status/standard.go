@@ -0,0 +1,89 @@
+package status
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+)
+
+// ReasonProgressing is the reason of the Ready condition while a
+// release is in progress.
+const ReasonProgressing = "Progressing"
+
+// setStandardConditions sets the Ready, TestSuccess and Remediated
+// conditions of the HelmRelease, derived from its phase and the
+// Released, Tested and RolledBack conditions. The conditions mirror
+// the standard Kubernetes conditions, which can not be used directly
+// as they are not available in the API machinery of the operator.
+func setStandardConditions(hr *v1.HelmRelease) {
+	conditions := []v1.HelmReleaseCondition{readyCondition(hr)}
+	for _, mirror := range []struct {
+		conditionType, source v1.HelmReleaseConditionType
+	}{
+		{v1.HelmReleaseTestSuccess, v1.HelmReleaseTested},
+		{v1.HelmReleaseRemediated, v1.HelmReleaseRolledBack},
+	} {
+		c := GetCondition(hr.Status, mirror.source)
+		if c == nil {
+			hr.Status.Conditions = filterOutCondition(hr.Status.Conditions, mirror.conditionType)
+			continue
+		}
+		conditions = append(conditions, v1.HelmReleaseCondition{
+			Type:    mirror.conditionType,
+			Status:  c.Status,
+			Reason:  c.Reason,
+			Message: c.Message,
+		})
+	}
+
+	nowTime := metav1.NewTime(Clock.Now())
+	for _, condition := range conditions {
+		condition.LastUpdateTime = &nowTime
+		condition.LastTransitionTime = &nowTime
+		if current := GetCondition(hr.Status, condition.Type); current != nil && current.Status == condition.Status {
+			condition.LastTransitionTime = current.LastTransitionTime
+		}
+		condition.ObservedGeneration = hr.Generation
+		hr.Status.Conditions = append(filterOutCondition(hr.Status.Conditions, condition.Type), condition)
+	}
+}
+
+// readyCondition returns the Ready condition for the phase of the
+// HelmRelease: true if the release succeeded, false if it failed,
+// and unknown while it is in progress. The reason and message are
+// taken from the Released condition, or the condition of the failure.
+func readyCondition(hr *v1.HelmRelease) v1.HelmReleaseCondition {
+	ready := v1.HelmReleaseCondition{Type: v1.HelmReleaseReady}
+	var source v1.HelmReleaseConditionType
+	switch hr.Status.Phase {
+	case v1.HelmReleasePhaseSucceeded:
+		ready.Status = v1.ConditionTrue
+		source = v1.HelmReleaseReleased
+	case v1.HelmReleasePhaseChartFetchFailed, v1.HelmReleasePhaseChartVerificationFailed:
+		ready.Status = v1.ConditionFalse
+		source = v1.HelmReleaseChartFetched
+	case v1.HelmReleasePhaseDeployFailed, v1.HelmReleasePhaseFailed, v1.HelmReleasePhaseValuesValidationFailed:
+		ready.Status = v1.ConditionFalse
+		source = v1.HelmReleaseReleased
+	case v1.HelmReleasePhaseTestFailed:
+		ready.Status = v1.ConditionFalse
+		source = v1.HelmReleaseTested
+	case v1.HelmReleasePhaseRolledBack, v1.HelmReleasePhaseRollbackFailed:
+		ready.Status = v1.ConditionFalse
+		source = v1.HelmReleaseRolledBack
+	default:
+		ready.Status = v1.ConditionUnknown
+		ready.Reason = ReasonProgressing
+		ready.Message = "Reconciliation in progress."
+		return ready
+	}
+	if c := GetCondition(hr.Status, source); c != nil {
+		ready.Reason = c.Reason
+		ready.Message = c.Message
+	}
+	if hr.Status.Phase == v1.HelmReleasePhaseTestFailed && hr.Spec.Test.GetIgnoreFailures() {
+		// failed tests do not fail the release if they are ignored
+		ready.Status = v1.ConditionTrue
+	}
+	return ready
+}
@@ -0,0 +1,59 @@
+package status
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+)
+
+func TestStandardConditions(t *testing.T) {
+	hr := &v1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "podinfo", Generation: 3}}
+	client := ifclientsetfake.NewSimpleClientset(hr).HelmV1().HelmReleases(hr.Namespace)
+	get := func() *v1.HelmRelease {
+		hr, err := client.Get(hr.Name, metav1.GetOptions{})
+		assert.NoError(t, err)
+		return hr
+	}
+
+	assert.NoError(t, SetStatusPhase(client, hr, v1.HelmReleasePhaseUpgrading))
+	hr = get()
+	ready := GetCondition(hr.Status, v1.HelmReleaseReady)
+	if assert.NotNil(t, ready) {
+		assert.Equal(t, v1.ConditionUnknown, ready.Status)
+		assert.Equal(t, ReasonProgressing, ready.Reason)
+		assert.Equal(t, int64(3), ready.ObservedGeneration)
+	}
+
+	assert.NoError(t, SetStatusPhaseWithReason(client, hr, v1.HelmReleasePhaseDeployFailed, v1.ReasonHelmUpgradeFailed))
+	hr = get()
+	ready = GetCondition(hr.Status, v1.HelmReleaseReady)
+	if assert.NotNil(t, ready) {
+		assert.Equal(t, v1.ConditionFalse, ready.Status)
+		assert.Equal(t, v1.ReasonHelmUpgradeFailed, ready.Reason)
+	}
+
+	assert.NoError(t, SetStatusPhase(client, hr, v1.HelmReleasePhaseRolledBack))
+	hr = get()
+	remediated := GetCondition(hr.Status, v1.HelmReleaseRemediated)
+	if assert.NotNil(t, remediated) {
+		assert.Equal(t, v1.ConditionTrue, remediated.Status)
+	}
+
+	assert.NoError(t, SetStatusPhase(client, hr, v1.HelmReleasePhaseTested))
+	assert.NoError(t, SetStatusPhase(client, get(), v1.HelmReleasePhaseSucceeded))
+	hr = get()
+	ready = GetCondition(hr.Status, v1.HelmReleaseReady)
+	if assert.NotNil(t, ready) {
+		assert.Equal(t, v1.ConditionTrue, ready.Status)
+	}
+	testSuccess := GetCondition(hr.Status, v1.HelmReleaseTestSuccess)
+	if assert.NotNil(t, testSuccess) {
+		assert.Equal(t, v1.ConditionTrue, testSuccess.Status)
+	}
+	// the RolledBack condition is removed once released successfully
+	assert.Nil(t, GetCondition(hr.Status, v1.HelmReleaseRemediated))
+}
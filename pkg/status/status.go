@@ -14,6 +14,7 @@ correspond. Specifically,
 package status
 
 import (
+	"reflect"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -35,8 +36,12 @@ type Updater struct {
 	kube               kube.Interface
 	helmClients        *helm.Clients
 	defaultHelmVersion string
+	clientFunc         ClientFunc
 }
 
+// ClientFunc returns the Helm client for the given HelmRelease.
+type ClientFunc func(hr *v1.HelmRelease) (helm.Client, error)
+
 func New(hrClient ifclientset.Interface, hrLister iflister.HelmReleaseLister, helmClients *helm.Clients, defaultHelmVersion string) *Updater {
 	return &Updater{
 		hrClient:           hrClient,
@@ -46,6 +51,13 @@ func New(hrClient ifclientset.Interface, hrLister iflister.HelmReleaseLister, he
 	}
 }
 
+// SetClientFunc sets the function returning the Helm client for a
+// HelmRelease, e.g. for the remote cluster of its KubeConfig. Without
+// it, the client of the Helm version of the HelmRelease is used.
+func (u *Updater) SetClientFunc(f ClientFunc) {
+	u.clientFunc = f
+}
+
 func (u *Updater) Loop(stop <-chan struct{}, interval time.Duration, logger log.Logger) {
 	ticker := time.NewTicker(interval)
 	var logErr error
@@ -65,7 +77,7 @@ bail:
 		for _, hr := range list {
 			nsHrClient := u.hrClient.HelmV1().HelmReleases(hr.Namespace)
 			releaseName := hr.GetReleaseName()
-			c, ok := u.helmClients.Load(hr.GetHelmVersion(u.defaultHelmVersion))
+			c, ok := u.client(hr)
 			// If we are unable to get the client, we do not care why
 			if !ok {
 				continue
@@ -86,6 +98,14 @@ bail:
 	logger.Log("loop", "stopping", "err", logErr)
 }
 
+func (u *Updater) client(hr *v1.HelmRelease) (helm.Client, bool) {
+	if u.clientFunc != nil {
+		c, err := u.clientFunc(hr)
+		return c, err == nil
+	}
+	return u.helmClients.Load(hr.GetHelmVersion(u.defaultHelmVersion))
+}
+
 // SetReleaseStatus updates the status of the HelmRelease to the given
 // release name and/or release status.
 func SetReleaseStatus(client v1client.HelmReleaseInterface, hr *v1.HelmRelease,
@@ -170,6 +190,481 @@ func SetObservedGeneration(client v1client.HelmReleaseInterface, hr *v1.HelmRele
 	return err
 }
 
+// SetImages updates the images in the status of the HelmRelease to
+// the given images.
+func SetImages(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, images []string) error {
+	firstTry := true
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() (err error) {
+		if !firstTry {
+			var getErr error
+			hr, getErr = client.Get(hr.Name, metav1.GetOptions{})
+			if getErr != nil {
+				return getErr
+			}
+		}
+
+		if reflect.DeepEqual(hr.Status.Images, images) {
+			return
+		}
+
+		cHr := hr.DeepCopy()
+		cHr.Status.Images = images
+
+		ObserveReleaseImages(hr, cHr)
+		_, err = client.UpdateStatus(cHr)
+		firstTry = false
+		return
+	})
+	return err
+}
+
+// SetLintFindings updates the findings of the chart linter in the
+// status of the HelmRelease to the given findings.
+func SetLintFindings(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, findings []v1.LintFinding) error {
+	firstTry := true
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() (err error) {
+		if !firstTry {
+			var getErr error
+			hr, getErr = client.Get(hr.Name, metav1.GetOptions{})
+			if getErr != nil {
+				return getErr
+			}
+		}
+
+		if reflect.DeepEqual(hr.Status.LintFindings, findings) {
+			return
+		}
+
+		cHr := hr.DeepCopy()
+		cHr.Status.LintFindings = findings
+
+		_, err = client.UpdateStatus(cHr)
+		firstTry = false
+		return
+	})
+	return err
+}
+
+// SetPolicyViolations updates the violations of the policies by the
+// rendered manifests in the status of the HelmRelease to the given
+// violations.
+func SetPolicyViolations(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, violations []v1.PolicyViolation) error {
+	firstTry := true
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() (err error) {
+		if !firstTry {
+			var getErr error
+			hr, getErr = client.Get(hr.Name, metav1.GetOptions{})
+			if getErr != nil {
+				return getErr
+			}
+		}
+
+		if reflect.DeepEqual(hr.Status.PolicyViolations, violations) {
+			return
+		}
+
+		cHr := hr.DeepCopy()
+		cHr.Status.PolicyViolations = violations
+
+		_, err = client.UpdateStatus(cHr)
+		firstTry = false
+		return
+	})
+	return err
+}
+
+// SetImageUpdates updates the state of the image update policies in
+// the status of the HelmRelease to the given state.
+func SetImageUpdates(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, updates []v1.ImageUpdateStatus) error {
+	firstTry := true
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() (err error) {
+		if !firstTry {
+			var getErr error
+			hr, getErr = client.Get(hr.Name, metav1.GetOptions{})
+			if getErr != nil {
+				return getErr
+			}
+		}
+
+		if reflect.DeepEqual(hr.Status.ImageUpdates, updates) {
+			return
+		}
+
+		cHr := hr.DeepCopy()
+		cHr.Status.ImageUpdates = updates
+
+		_, err = client.UpdateStatus(cHr)
+		firstTry = false
+		return
+	})
+	return err
+}
+
+// SetTestLogs updates the logs of the failed test pods in the
+// status of the HelmRelease to the given logs.
+func SetTestLogs(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, logs []v1.TestLog) error {
+	firstTry := true
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() (err error) {
+		if !firstTry {
+			var getErr error
+			hr, getErr = client.Get(hr.Name, metav1.GetOptions{})
+			if getErr != nil {
+				return getErr
+			}
+		}
+
+		if reflect.DeepEqual(hr.Status.TestLogs, logs) {
+			return
+		}
+
+		cHr := hr.DeepCopy()
+		cHr.Status.TestLogs = logs
+
+		_, err = client.UpdateStatus(cHr)
+		firstTry = false
+		return
+	})
+	return err
+}
+
+// SetChartVersion updates the resolved chart version in the status
+// of the HelmRelease to the given version.
+func SetChartVersion(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, version string) error {
+	firstTry := true
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() (err error) {
+		if !firstTry {
+			var getErr error
+			hr, getErr = client.Get(hr.Name, metav1.GetOptions{})
+			if getErr != nil {
+				return getErr
+			}
+		}
+
+		if hr.Status.ChartVersion == version {
+			return
+		}
+
+		cHr := hr.DeepCopy()
+		cHr.Status.ChartVersion = version
+
+		_, err = client.UpdateStatus(cHr)
+		firstTry = false
+		return
+	})
+	return err
+}
+
+// SetLastAppliedChartVersion updates the version of the chart last
+// released successfully in the status of the HelmRelease.
+func SetLastAppliedChartVersion(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, version string) error {
+	firstTry := true
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() (err error) {
+		if !firstTry {
+			var getErr error
+			hr, getErr = client.Get(hr.Name, metav1.GetOptions{})
+			if getErr != nil {
+				return getErr
+			}
+		}
+
+		if hr.Status.LastAppliedChartVersion == version {
+			return
+		}
+
+		cHr := hr.DeepCopy()
+		cHr.Status.LastAppliedChartVersion = version
+
+		_, err = client.UpdateStatus(cHr)
+		firstTry = false
+		return
+	})
+	return err
+}
+
+// SetChartCommit updates the chart commit in the status of the
+// HelmRelease to the given commit.
+func SetChartCommit(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, commit *v1.GitCommit) error {
+	firstTry := true
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() (err error) {
+		if !firstTry {
+			var getErr error
+			hr, getErr = client.Get(hr.Name, metav1.GetOptions{})
+			if getErr != nil {
+				return getErr
+			}
+		}
+
+		// the revision identifies the commit, while the time may be
+		// in another location after a round trip
+		cur := hr.Status.ChartCommit
+		if (cur == nil && commit == nil) || (cur != nil && commit != nil && cur.Revision == commit.Revision) {
+			return
+		}
+
+		cHr := hr.DeepCopy()
+		cHr.Status.ChartCommit = commit
+
+		_, err = client.UpdateStatus(cHr)
+		firstTry = false
+		return
+	})
+	return err
+}
+
+// SetLastDiff updates the last diff in the status of the HelmRelease
+// to the given diff. The status is not updated if only the time of the
+// diff differs from the last diff, as the same difference is detected
+// on every sync until it is released.
+func SetLastDiff(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, diff *v1.ReleaseDiff) error {
+	firstTry := true
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() (err error) {
+		if !firstTry {
+			var getErr error
+			hr, getErr = client.Get(hr.Name, metav1.GetOptions{})
+			if getErr != nil {
+				return getErr
+			}
+		}
+
+		if last := hr.Status.LastDiff; last != nil && diff != nil && last.Revision == diff.Revision &&
+			last.Summary == diff.Summary && last.Truncated == diff.Truncated {
+			return
+		}
+
+		cHr := hr.DeepCopy()
+		cHr.Status.LastDiff = diff
+
+		_, err = client.UpdateStatus(cHr)
+		firstTry = false
+		return
+	})
+	return err
+}
+
+// SetInventory updates the inventory in the status of the HelmRelease
+// to the given resources.
+func SetInventory(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, inventory []v1.ResourceRef) error {
+	firstTry := true
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() (err error) {
+		if !firstTry {
+			var getErr error
+			hr, getErr = client.Get(hr.Name, metav1.GetOptions{})
+			if getErr != nil {
+				return getErr
+			}
+		}
+
+		if reflect.DeepEqual(hr.Status.Inventory, inventory) {
+			return
+		}
+
+		cHr := hr.DeepCopy()
+		cHr.Status.Inventory = inventory
+
+		_, err = client.UpdateStatus(cHr)
+		firstTry = false
+		return
+	})
+	return err
+}
+
+// AddHistory adds the given entry to the history in the status of the
+// HelmRelease, replacing an entry of the same Helm release version and
+// dropping the oldest entries beyond max.
+func AddHistory(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, entry v1.ReleaseHistoryEntry, max int) error {
+	firstTry := true
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() (err error) {
+		if !firstTry {
+			var getErr error
+			hr, getErr = client.Get(hr.Name, metav1.GetOptions{})
+			if getErr != nil {
+				return getErr
+			}
+		}
+
+		history := make([]v1.ReleaseHistoryEntry, 0, len(hr.Status.History)+1)
+		for _, e := range hr.Status.History {
+			if e.Version != entry.Version {
+				history = append(history, e)
+			}
+		}
+		history = append(history, entry)
+		if len(history) > max {
+			history = history[len(history)-max:]
+		}
+
+		cHr := hr.DeepCopy()
+		cHr.Status.History = history
+
+		_, err = client.UpdateStatus(cHr)
+		firstTry = false
+		return
+	})
+	return err
+}
+
+// SetNotes updates the rendered notes of the chart in the status of
+// the HelmRelease to the given notes.
+func SetNotes(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, notes string) error {
+	firstTry := true
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() (err error) {
+		if !firstTry {
+			var getErr error
+			hr, getErr = client.Get(hr.Name, metav1.GetOptions{})
+			if getErr != nil {
+				return getErr
+			}
+		}
+
+		if hr.Status.Notes == notes {
+			return
+		}
+
+		cHr := hr.DeepCopy()
+		cHr.Status.Notes = notes
+
+		_, err = client.UpdateStatus(cHr)
+		firstTry = false
+		return
+	})
+	return err
+}
+
+// SetPreview updates the preview status of the HelmRelease to the
+// given preview, or removes it if nil. A preview which only differs
+// from the recorded one in its time is not written.
+func SetPreview(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, preview *v1.ReleasePreview) error {
+	firstTry := true
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() (err error) {
+		if !firstTry {
+			var getErr error
+			hr, getErr = client.Get(hr.Name, metav1.GetOptions{})
+			if getErr != nil {
+				return getErr
+			}
+		}
+
+		if samePreview(hr.Status.Preview, preview) {
+			return
+		}
+
+		cHr := hr.DeepCopy()
+		cHr.Status.Preview = preview
+
+		_, err = client.UpdateStatus(cHr)
+		firstTry = false
+		return
+	})
+	return err
+}
+
+// samePreview returns if the previews are the same, regardless of the
+// time they were rendered.
+func samePreview(a, b *v1.ReleasePreview) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Revision == b.Revision && a.Action == b.Action &&
+		a.Changed == b.Changed && a.ConfigMapName == b.ConfigMapName
+}
+
+// SetExternalizedValues updates the externalized values status of
+// the HelmRelease to the given reference.
+func SetExternalizedValues(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, ref *v1.ExternalizedValues) error {
+	firstTry := true
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() (err error) {
+		if !firstTry {
+			var getErr error
+			hr, getErr = client.Get(hr.Name, metav1.GetOptions{})
+			if getErr != nil {
+				return getErr
+			}
+		}
+
+		current := hr.Status.ExternalizedValues
+		if current == ref || (current != nil && ref != nil && *current == *ref) {
+			return
+		}
+
+		cHr := hr.DeepCopy()
+		cHr.Status.ExternalizedValues = ref
+
+		_, err = client.UpdateStatus(cHr)
+		firstTry = false
+		return
+	})
+	return err
+}
+
+// SetLastHandledReconcileAt records the given value of the reconcileAt
+// annotation as handled in the status of the HelmRelease.
+func SetLastHandledReconcileAt(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, reconcileAt string) error {
+	firstTry := true
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() (err error) {
+		if !firstTry {
+			var getErr error
+			hr, getErr = client.Get(hr.Name, metav1.GetOptions{})
+			if getErr != nil {
+				return getErr
+			}
+		}
+
+		if hr.Status.LastHandledReconcileAt == reconcileAt {
+			return
+		}
+
+		cHr := hr.DeepCopy()
+		cHr.Status.LastHandledReconcileAt = reconcileAt
+
+		_, err = client.UpdateStatus(cHr)
+		firstTry = false
+		return
+	})
+	return err
+}
+
+// SetFailures updates the amount of consecutive failed syncs in the
+// status of the HelmRelease.
+func SetFailures(client v1client.HelmReleaseInterface, hr *v1.HelmRelease, failures int64) error {
+	firstTry := true
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() (err error) {
+		if !firstTry {
+			var getErr error
+			hr, getErr = client.Get(hr.Name, metav1.GetOptions{})
+			if getErr != nil {
+				return getErr
+			}
+		}
+
+		if hr.Status.Failures == failures {
+			return
+		}
+
+		cHr := hr.DeepCopy()
+		cHr.Status.Failures = failures
+
+		_, err = client.UpdateStatus(cHr)
+		firstTry = false
+		return
+	})
+	return err
+}
+
+// IsRetry returns if a sync of the HelmRelease retries the generation
+// of the previous sync, i.e. the generation has been synced already
+// and no reconciliation has been requested since.
+func IsRetry(hr *v1.HelmRelease) bool {
+	return HasSynced(hr) && !ReconcileRequested(hr)
+}
+
+// ReconcileRequested returns if a reconciliation of the HelmRelease
+// has been requested with the reconcileAt annotation, which has not
+// been handled yet.
+func ReconcileRequested(hr *v1.HelmRelease) bool {
+	reconcileAt := hr.GetAnnotations()[v1.ReconcileAtAnnotation]
+	return reconcileAt != "" && reconcileAt != hr.Status.LastHandledReconcileAt
+}
+
 // HasSynced returns if the HelmRelease has been processed by the
 // controller.
 func HasSynced(hr *v1.HelmRelease) bool {
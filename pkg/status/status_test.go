@@ -0,0 +1,87 @@
+package status
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1 "github.com/lstack-org/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	ifclientsetfake "github.com/lstack-org/helm-operator/pkg/client/clientset/versioned/fake"
+)
+
+func TestSetLastDiff(t *testing.T) {
+	hr := &v1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "podinfo"}}
+	clientset := ifclientsetfake.NewSimpleClientset(hr)
+	client := clientset.HelmV1().HelmReleases(hr.Namespace)
+	setLastDiff := func(diff v1.ReleaseDiff) int {
+		clientset.ClearActions()
+		hr, err := client.Get(hr.Name, metav1.GetOptions{})
+		assert.NoError(t, err)
+		assert.NoError(t, SetLastDiff(client, hr, &diff))
+		updates := 0
+		for _, a := range clientset.Actions() {
+			if a.GetVerb() == "update" && a.GetSubresource() == "status" {
+				updates++
+			}
+		}
+		return updates
+	}
+
+	diff := v1.ReleaseDiff{Time: metav1.Now(), Revision: "1.0.0", Summary: "-replicas: 1\n+replicas: 2\n"}
+	assert.Equal(t, 1, setLastDiff(diff))
+
+	// the same diff detected later is not written again
+	diff.Time = metav1.NewTime(diff.Time.Add(time.Minute))
+	assert.Equal(t, 0, setLastDiff(diff))
+
+	diff.Summary = "-replicas: 1\n+replicas: 3\n"
+	assert.Equal(t, 1, setLastDiff(diff))
+}
+
+func TestSetLastAppliedChartVersion(t *testing.T) {
+	hr := &v1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "podinfo"}}
+	clientset := ifclientsetfake.NewSimpleClientset(hr)
+	client := clientset.HelmV1().HelmReleases(hr.Namespace)
+	set := func(version string) int {
+		clientset.ClearActions()
+		hr, err := client.Get(hr.Name, metav1.GetOptions{})
+		assert.NoError(t, err)
+		assert.NoError(t, SetLastAppliedChartVersion(client, hr, version))
+		return len(clientset.Actions())
+	}
+
+	assert.Equal(t, 2, set("3.2.0"))
+	hr, err := client.Get(hr.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "3.2.0", hr.Status.LastAppliedChartVersion)
+
+	// an unchanged version is not written again
+	assert.Equal(t, 1, set("3.2.0"))
+}
+
+func TestSetPreview(t *testing.T) {
+	hr := &v1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "podinfo"}}
+	clientset := ifclientsetfake.NewSimpleClientset(hr)
+	client := clientset.HelmV1().HelmReleases(hr.Namespace)
+	setPreview := func(preview *v1.ReleasePreview) int {
+		clientset.ClearActions()
+		hr, err := client.Get(hr.Name, metav1.GetOptions{})
+		assert.NoError(t, err)
+		assert.NoError(t, SetPreview(client, hr, preview))
+		return len(clientset.Actions()) - 1
+	}
+
+	preview := v1.ReleasePreview{Time: metav1.Now(), Revision: "1.0.0", Action: "upgrade", Changed: true, ConfigMapName: "podinfo-preview"}
+	assert.Equal(t, 1, setPreview(&preview))
+
+	// the same preview rendered later is not written again
+	preview.Time = metav1.NewTime(preview.Time.Add(time.Minute))
+	assert.Equal(t, 0, setPreview(&preview))
+
+	preview.Changed = false
+	assert.Equal(t, 1, setPreview(&preview))
+	assert.Equal(t, 1, setPreview(nil))
+	assert.Equal(t, 0, setPreview(nil))
+}
@@ -0,0 +1,321 @@
+/*
+Package vault implements a minimal client for the HashiCorp Vault HTTP
+API, to read secrets from KV version 2 secrets engines with tokens
+obtained through the Kubernetes auth method.
+*/
+package vault
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ErrNotFound is returned for secrets which do not exist.
+var ErrNotFound = errors.New("secret not found")
+
+// TokenFunc returns a token of the given service account, to log in to
+// Vault with.
+type TokenFunc func(namespace, serviceAccount string) (string, error)
+
+// Config holds the configuration of the Vault client.
+type Config struct {
+	// Address is the address of the Vault server, e.g.
+	// `https://vault:8200`.
+	Address string
+	// AuthMount is the mount path of the Kubernetes auth method,
+	// defaults to `kubernetes`.
+	AuthMount string
+	// Role is the role logged in with if no role is requested.
+	Role string
+	// ServiceAccounts are the names of the service accounts a token
+	// may be obtained of to log in with, in the namespace the secrets
+	// are read for; defaults to `default` only.
+	ServiceAccounts []string
+	// CACert is the PEM encoded CA certificate to verify the server
+	// with; the system roots are used if empty.
+	CACert []byte
+	// CacheTTL is the duration secrets are cached for; secrets are
+	// not cached if zero.
+	CacheTTL time.Duration
+	// Timeout is the timeout of requests, defaults to 30 seconds.
+	Timeout time.Duration
+}
+
+// Client reads secrets from Vault. It logs in once per service account
+// and role, and renews the lease of its tokens while they are used. The
+// lock of the client is only held around its caches, not the requests
+// to Vault, so a slow Vault does not serialize the reads of releases.
+type Client struct {
+	config    Config
+	http      *http.Client
+	tokenFunc TokenFunc
+	now       func() time.Time
+
+	mu      sync.Mutex
+	tokens  map[string]*token
+	secrets map[string]cachedSecret
+}
+
+type token struct {
+	value     string
+	renewable bool
+	renewAt   time.Time
+	expires   time.Time
+}
+
+type cachedSecret struct {
+	data    map[string]interface{}
+	expires time.Time
+}
+
+// New returns a new Vault client logging in with the tokens from the
+// given function.
+func New(config Config, tokenFunc TokenFunc) (*Client, error) {
+	if _, err := url.Parse(config.Address); err != nil || config.Address == "" {
+		return nil, fmt.Errorf("invalid Vault address '%s'", config.Address)
+	}
+	if config.AuthMount == "" {
+		config.AuthMount = "kubernetes"
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+	if len(config.ServiceAccounts) == 0 {
+		config.ServiceAccounts = []string{"default"}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if len(config.CACert) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(config.CACert) {
+			return nil, errors.New("no valid CA certificate for Vault")
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return &Client{
+		config:    config,
+		http:      &http.Client{Transport: transport, Timeout: config.Timeout},
+		tokenFunc: tokenFunc,
+		now:       time.Now,
+		tokens:    make(map[string]*token),
+		secrets:   make(map[string]cachedSecret),
+	}, nil
+}
+
+// ReadKV returns the data of the version of the secret at the path in
+// the KV version 2 engine at the mount, or the latest version if zero,
+// read with a token of the given service account and role.
+func (c *Client) ReadKV(namespace, serviceAccount, role, mount, path string, version int) (map[string]interface{}, error) {
+	if role == "" {
+		role = c.config.Role
+	}
+	if role == "" {
+		return nil, errors.New("no Vault role")
+	}
+	if !c.allowedServiceAccount(serviceAccount) {
+		return nil, fmt.Errorf("service account '%s' is not allowed to log in to Vault", serviceAccount)
+	}
+	tokenKey := namespace + "/" + serviceAccount + "/" + role
+	secretKey := tokenKey + "/" + mount + "/" + path + "@" + strconv.Itoa(version)
+
+	now := c.now()
+	if data, ok := c.cachedSecret(secretKey, now); ok {
+		return data, nil
+	}
+
+	t, err := c.token(tokenKey, namespace, serviceAccount, role)
+	if err != nil {
+		return nil, err
+	}
+	u := strings.Trim(mount, "/") + "/data/" + strings.Trim(path, "/")
+	if version > 0 {
+		u += "?version=" + strconv.Itoa(version)
+	}
+	var resp struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := c.do(http.MethodGet, u, t.value, nil, &resp); err != nil {
+		if err == errPermissionDenied {
+			// the token may have been revoked, log in again on the
+			// next read
+			c.mu.Lock()
+			delete(c.tokens, tokenKey)
+			c.mu.Unlock()
+		}
+		return nil, err
+	}
+	// deleted and destroyed versions have no data
+	if resp.Data.Data == nil {
+		return nil, ErrNotFound
+	}
+	if c.config.CacheTTL > 0 {
+		// the returned data is merged with other values by the
+		// caller, the cache holds a copy of its own
+		c.mu.Lock()
+		c.secrets[secretKey] = cachedSecret{data: runtime.DeepCopyJSON(resp.Data.Data), expires: now.Add(c.config.CacheTTL)}
+		c.mu.Unlock()
+	}
+	return resp.Data.Data, nil
+}
+
+// allowedServiceAccount returns if a token of the given service account
+// may be obtained to log in with.
+func (c *Client) allowedServiceAccount(serviceAccount string) bool {
+	for _, sa := range c.config.ServiceAccounts {
+		if sa == serviceAccount {
+			return true
+		}
+	}
+	return false
+}
+
+// cachedSecret returns a copy of the data of the cached secret with
+// the given key, removing the expired secrets from the cache.
+func (c *Client) cachedSecret(key string, now time.Time) (map[string]interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, s := range c.secrets {
+		if !now.Before(s.expires) {
+			delete(c.secrets, k)
+		}
+	}
+	s, ok := c.secrets[key]
+	if !ok {
+		return nil, false
+	}
+	return runtime.DeepCopyJSON(s.data), true
+}
+
+// token returns the token for the given service account and role,
+// renewing its lease once half of it has passed, or logging in if
+// there is no token or it can no longer be renewed.
+func (c *Client) token(key, namespace, serviceAccount, role string) (*token, error) {
+	now := c.now()
+	c.mu.Lock()
+	t, ok := c.tokens[key]
+	c.mu.Unlock()
+	if ok && now.Before(t.expires) {
+		if !t.renewable || now.Before(t.renewAt) {
+			return t, nil
+		}
+		var resp authResponse
+		if err := c.do(http.MethodPost, "auth/token/renew-self", t.value, struct{}{}, &resp); err == nil && resp.Auth.ClientToken != "" {
+			t = resp.token(now)
+			c.setToken(key, t)
+			return t, nil
+		}
+		// the token can not be renewed, log in again
+	}
+	c.mu.Lock()
+	delete(c.tokens, key)
+	c.mu.Unlock()
+
+	jwt, err := c.tokenFunc(namespace, serviceAccount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token of service account %s/%s: %w", namespace, serviceAccount, err)
+	}
+	var resp authResponse
+	login := map[string]string{"role": role, "jwt": jwt}
+	if err := c.do(http.MethodPost, "auth/"+strings.Trim(c.config.AuthMount, "/")+"/login", "", login, &resp); err != nil {
+		return nil, fmt.Errorf("failed to log in to Vault with role '%s': %w", role, err)
+	}
+	if resp.Auth.ClientToken == "" {
+		return nil, fmt.Errorf("failed to log in to Vault with role '%s': no token", role)
+	}
+	t = resp.token(now)
+	c.setToken(key, t)
+	return t, nil
+}
+
+func (c *Client) setToken(key string, t *token) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens[key] = t
+}
+
+type authResponse struct {
+	Auth struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+}
+
+func (r authResponse) token(now time.Time) *token {
+	lease := time.Duration(r.Auth.LeaseDuration) * time.Second
+	t := &token{value: r.Auth.ClientToken, renewable: r.Auth.Renewable && lease > 0}
+	if lease <= 0 {
+		// tokens without a lease do not expire
+		t.expires = now.Add(100 * 365 * 24 * time.Hour)
+	} else {
+		t.renewAt = now.Add(lease / 2)
+		t.expires = now.Add(lease * 9 / 10)
+	}
+	return t
+}
+
+var errPermissionDenied = errors.New("permission denied")
+
+// do makes a request to the path of the Vault API, with the body
+// marshalled to JSON if not nil, and decodes the response into out.
+// Numbers are decoded as json.Number, so large integers in secrets keep
+// their precision.
+func (c *Client) do(method, path, vaultToken string, body, out interface{}) error {
+	var reqBody []byte
+	if body != nil {
+		var err error
+		if reqBody, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.config.Address, "/")+"/v1/"+path, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	if vaultToken != "" {
+		req.Header.Set("X-Vault-Token", vaultToken)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.UseNumber()
+		return d.Decode(out)
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusForbidden:
+		return errPermissionDenied
+	}
+	var e struct {
+		Errors []string `json:"errors"`
+	}
+	if json.Unmarshal(b, &e) == nil && len(e.Errors) > 0 {
+		return fmt.Errorf("Vault responded with status '%s': %s", resp.Status, strings.Join(e.Errors, "; "))
+	}
+	return fmt.Errorf("Vault responded with status '%s'", resp.Status)
+}
@@ -0,0 +1,131 @@
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeVault struct {
+	mu       sync.Mutex
+	logins   []map[string]string
+	renewals int
+	reads    []string
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/auth/kubernetes/login":
+		var login map[string]string
+		json.NewDecoder(r.Body).Decode(&login)
+		f.logins = append(f.logins, login)
+		if login["jwt"] != "sa-token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		w.Write([]byte(`{"auth":{"client_token":"vault-token","lease_duration":600,"renewable":true}}`))
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/auth/token/renew-self":
+		f.renewals++
+		w.Write([]byte(`{"auth":{"client_token":"vault-token","lease_duration":600,"renewable":true}}`))
+	case r.Method == http.MethodGet && r.Header.Get("X-Vault-Token") != "vault-token":
+		w.WriteHeader(http.StatusForbidden)
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/secret/data/apps/db":
+		f.reads = append(f.reads, r.URL.RequestURI())
+		w.Write([]byte(`{"data":{"data":{"password":"s3cr3t","id":9007199254740993},"metadata":{"version":2}}}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/secret/data/apps/deleted":
+		w.Write([]byte(`{"data":{"data":null,"metadata":{"version":1}}}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errors":[]}`))
+	}
+}
+
+func TestReadKV(t *testing.T) {
+	fake := &fakeVault{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	var tokenRequests []string
+	config := Config{Address: server.URL, Role: "apps", CacheTTL: time.Minute, ServiceAccounts: []string{"default", "deployer"}}
+	client, err := New(config, func(namespace, serviceAccount string) (string, error) {
+		tokenRequests = append(tokenRequests, namespace+"/"+serviceAccount)
+		return "sa-token", nil
+	})
+	assert.NoError(t, err)
+	now := time.Now()
+	client.now = func() time.Time { return now }
+
+	data, err := client.ReadKV("team-a", "default", "", "secret", "apps/db", 0)
+	assert.NoError(t, err)
+	// numbers keep their precision
+	assert.Equal(t, map[string]interface{}{"password": "s3cr3t", "id": json.Number("9007199254740993")}, data)
+	assert.Equal(t, []map[string]string{{"role": "apps", "jwt": "sa-token"}}, fake.logins)
+	assert.Equal(t, []string{"team-a/default"}, tokenRequests)
+
+	// cached secrets are not read again, nor changed with the
+	// returned data
+	data["password"] = "changed"
+	data, err = client.ReadKV("team-a", "default", "", "secret", "apps/db", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t", data["password"])
+	data["password"] = "changed"
+	data, err = client.ReadKV("team-a", "default", "", "secret", "apps/db", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t", data["password"])
+	assert.Len(t, fake.reads, 1)
+
+	// versions are read with the token of the earlier login
+	_, err = client.ReadKV("team-a", "default", "", "secret", "/apps/db/", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/v1/secret/data/apps/db", "/v1/secret/data/apps/db?version=2"}, fake.reads)
+	assert.Len(t, fake.logins, 1)
+
+	// the token is renewed once half of its lease has passed
+	now = now.Add(6 * time.Minute)
+	_, err = client.ReadKV("team-a", "default", "", "secret", "apps/db", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, fake.renewals)
+	assert.Len(t, fake.logins, 1)
+
+	// other service accounts log in with their own token
+	_, err = client.ReadKV("team-b", "deployer", "team-b", "secret", "apps/db", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"team-a/default", "team-b/deployer"}, tokenRequests)
+
+	// service accounts which are not allowed can not log in
+	_, err = client.ReadKV("team-b", "admin", "team-b", "secret", "apps/db", 0)
+	assert.EqualError(t, err, "service account 'admin' is not allowed to log in to Vault")
+	assert.Len(t, tokenRequests, 2)
+
+	_, err = client.ReadKV("team-a", "default", "", "secret", "apps/missing", 0)
+	assert.Equal(t, ErrNotFound, err)
+	_, err = client.ReadKV("team-a", "default", "", "secret", "apps/deleted", 0)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestReadKVLoginFailure(t *testing.T) {
+	server := httptest.NewServer(&fakeVault{})
+	defer server.Close()
+
+	client, err := New(Config{Address: server.URL}, func(namespace, serviceAccount string) (string, error) {
+		return "invalid", nil
+	})
+	assert.NoError(t, err)
+	_, err = client.ReadKV("team-a", "default", "", "secret", "apps/db", 0)
+	assert.EqualError(t, err, "no Vault role")
+	_, err = client.ReadKV("team-a", "default", "apps", "secret", "apps/db", 0)
+	assert.Error(t, err)
+
+	_, err = New(Config{}, nil)
+	assert.Error(t, err)
+	_, err = New(Config{Address: server.URL, CACert: []byte("invalid")}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,48 @@
+#!/usr/bin/env bats
+
+function setup() {
+  # Load libraries in setup() to access BATS_* variables
+  load lib/env
+  load lib/helm
+}
+
+@test "ServiceMonitor scrapes the metrics endpoint" {
+  if [ "$HELM_VERSION" != "v3" ]; then
+    skip
+  fi
+
+  run helm template helm-operator "${ROOT_DIR}/chart/helm-operator" \
+    --show-only templates/servicemonitor.yaml \
+    --set prometheus.serviceMonitor.create=true
+  [ "$status" -eq 0 ]
+  echo "$output" | grep -q '^  - port: http$'
+  echo "$output" | grep -q '^    path: /metrics$'
+  ! echo "$output" | grep -q 'scheme: https'
+  ! echo "$output" | grep -q 'bearerTokenSecret'
+}
+
+@test "ServiceMonitor scrapes the metrics endpoint over TLS with a bearer token" {
+  if [ "$HELM_VERSION" != "v3" ]; then
+    skip
+  fi
+
+  run helm template helm-operator "${ROOT_DIR}/chart/helm-operator" \
+    --show-only templates/servicemonitor.yaml \
+    --set prometheus.serviceMonitor.create=true \
+    --set prometheus.tls.enable=true \
+    --set prometheus.bearerTokenSecret.name=metrics-token
+  [ "$status" -eq 0 ]
+  echo "$output" | grep -q '^    scheme: https$'
+  echo "$output" | grep -q '^      insecureSkipVerify: true$'
+  echo "$output" | grep -q '^      name: metrics-token$'
+  echo "$output" | grep -q '^      key: token$'
+
+  run helm template helm-operator "${ROOT_DIR}/chart/helm-operator" \
+    --show-only templates/deployment.yaml \
+    --set prometheus.tls.enable=true \
+    --set prometheus.bearerTokenSecret.name=metrics-token
+  [ "$status" -eq 0 ]
+  echo "$output" | grep -q -- '- --listen-tls-auto-generate$'
+  echo "$output" | grep -q -- '- --metrics-bearer-token-path=/etc/fluxd/metrics-token/token$'
+  echo "$output" | grep -q '^            scheme: HTTPS$'
+}